@@ -0,0 +1,364 @@
+// Package backtest replays historic candles through an analysis plugin and simulates the trades it signals,
+// so a plugin and its options can be tried on past prices before they trade. Candles are read from the
+// candle database Leprechaun keeps, or imported from a CSV or JSON file. The result of a backtest holds
+// each trade, the account's value over time and a summary of its performance, and can be written as JSON.
+//
+// Each step of the replay passes the plugin the candles of one analysis period, like the bot does, and
+// the signal is acted on at the open of the next candle. Entries are long (buy, then sell) or, if allowed,
+// short (sell, then buy back). An entry is closed by the opposite signal, when it reaches the profit
+// margin, if one is set, or at the end of the replay. `Optimize` backtests every combination of ranges of
+// parameters to find the best ones, and `RunWalkForward` checks that the best ones hold up on later candles.
+// `RunMonteCarlo` backtests on made-up price series to show the spread of outcomes a strategy may have.
+//
+// The analysis options are resolved from the user's settings, so they must be loaded, and passed to the
+// core with `core.SetConfig`, before a backtest is run.
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/michaellormann/leprechaun/core"
+)
+
+var (
+	// ErrNotEnoughCandles is returned when there are fewer candles than one analysis period needs.
+	ErrNotEnoughCandles = errors.New("not enough candles to backtest the plugin")
+	// ErrInvalidConfig is returned when the settings of a backtest are out of range.
+	ErrInvalidConfig = errors.New("invalid backtest settings")
+)
+
+// Config holds the settings of a backtest.
+type Config struct {
+	// Plugin is the name of the analysis plugin that is tested.
+	Plugin string
+	// Asset is the code of the asset the candles are of, e.g. "XBT". The plugin's options for the asset are used.
+	Asset string
+	// Interval is the length of the candles. Zero uses the interval of the plugin's options.
+	Interval time.Duration
+	// StartingBalance is the fiat balance the simulated account starts with.
+	StartingBalance float64
+	// PurchaseUnit is the amount of fiat spent on each entry. Zero spends the whole balance.
+	PurchaseUnit float64
+	// Fee is the fee charged on each order, as a fraction of its value, e.g. 0.001 for 0.1%.
+	Fee float64
+	// Slippage is how much worse than the open of the next candle orders fill, as a fraction of the price.
+	Slippage float64
+	// MinVolume is the smallest order, in units of the asset, the exchange accepts. Smaller entries are skipped.
+	MinVolume float64
+	// AllowShort lets short signals open short positions, instead of only closing long ones.
+	AllowShort bool
+	// ProfitMargin closes a position once the price has moved this fraction in its favour, e.g. 0.03, like
+	// the bot's profit margin. Zero closes positions on the opposite signal only.
+	ProfitMargin float64
+	// Overrides replaces the plugin's analysis options for the asset, e.g. to try another trading mode.
+	// `Interval` takes precedence over the interval of the overrides, and their plugin is not used.
+	Overrides core.AnalyzerOverrides
+	// Start is the time trading starts from. Earlier candles are only analyzed. Zero starts as soon as
+	// there are enough candles for an analysis period.
+	Start time.Time
+}
+
+// Validate returns `ErrInvalidConfig` if the balance is not positive, or a rate or override is out of range.
+func (c Config) Validate() error {
+	switch {
+	case c.Plugin == "":
+		return fmt.Errorf("%w (no plugin was given)", ErrInvalidConfig)
+	case c.StartingBalance <= 0 || c.PurchaseUnit < 0:
+		return fmt.Errorf("%w (the starting balance must be positive and the purchase unit may not be negative)", ErrInvalidConfig)
+	case c.Fee < 0 || c.Fee >= 1 || c.Slippage < 0 || c.Slippage >= 1 || c.MinVolume < 0 || c.Interval < 0:
+		return fmt.Errorf("%w (fee %v, slippage %v, minimum volume %v)", ErrInvalidConfig, c.Fee, c.Slippage, c.MinVolume)
+	case c.ProfitMargin < 0 || c.ProfitMargin >= 1:
+		return fmt.Errorf("%w (profit margin %v)", ErrInvalidConfig, c.ProfitMargin)
+	}
+	if err := c.Overrides.Validate(); err != nil {
+		return fmt.Errorf("%w (%v)", ErrInvalidConfig, err)
+	}
+	return nil
+}
+
+// Trade is a position opened and closed during a backtest.
+type Trade struct {
+	Side                  core.SIGNAL // `core.SignalLong` or `core.SignalShort`.
+	EntryTime, ExitTime   time.Time
+	EntryPrice, ExitPrice float64 // Fill prices, slippage included.
+	Volume                float64
+	Fees                  float64
+	Profit                float64 // Fiat profit after fees.
+	// Confidence is the plugin's confidence in the signal the position was opened on.
+	Confidence float64
+	// ClosedAtEnd reports whether the position was still open when the replay ended.
+	ClosedAtEnd bool
+}
+
+// ReturnPct returns the profit of the trade as a percentage of its entry value.
+func (t Trade) ReturnPct() float64 {
+	cost := t.EntryPrice * t.Volume
+	if cost == 0 {
+		return 0
+	}
+	return t.Profit / cost * 100
+}
+
+// Summary holds the statistics of a backtest.
+type Summary struct {
+	Trades, Wins, Losses int
+	// Skipped is the number of entries that were smaller than the minimum volume.
+	Skipped         int
+	WinRate         float64 // Share of the trades that made a profit, from 0 to 1.
+	NetProfit       float64
+	TotalFees       float64
+	StartingBalance float64
+	FinalBalance    float64
+	ReturnPct       float64
+	// BuyAndHoldPct is the return of buying at the first analyzed candle and selling at the last one.
+	BuyAndHoldPct float64
+	// MaxDrawdown is the largest fall of the account's value from a peak, as a fraction of the peak.
+	MaxDrawdown float64
+	// VsBuyAndHoldPct is the return of the backtest less the return of buying and holding, in percentage points.
+	VsBuyAndHoldPct float64
+	// SharpeRatio and SortinoRatio are the annualized ratios of the mean return of each candle to the
+	// standard deviation of the returns and to their downside deviation.
+	SharpeRatio, SortinoRatio float64
+	// AverageHolding is how long the trades were held on average.
+	AverageHolding time.Duration
+	// FeeDragPct is the fees paid as a percentage of the starting balance.
+	FeeDragPct float64
+	// Signals counts the signals emitted by the plugin.
+	Signals map[core.SIGNAL]int
+	// Errors is the number of analyses the plugin could not complete.
+	Errors int
+}
+
+// Result holds the trades and statistics of a backtest.
+type Result struct {
+	Config
+	From, To time.Time
+	Trades   []Trade
+	Summary  Summary
+	// Equity is the value of the account at the close of each replayed candle.
+	Equity []EquityPoint
+	// Steps holds each replayed candle and the signal acted on at its open, so the backtest can be replayed.
+	Steps []Step
+}
+
+// Step is a replayed candle and the signal the plugin emitted on the candles before it.
+type Step struct {
+	Time                   time.Time
+	Open, High, Low, Close float64
+	Signal                 core.SIGNAL
+	Confidence             float64
+}
+
+// String summarizes the result in a few lines.
+func (r Result) String() string {
+	s := r.Summary
+	lines := []string{
+		fmt.Sprintf("%s on %s, %s to %s", r.Plugin, r.Asset, r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04")),
+		fmt.Sprintf("Trades: %d (%d won, %d lost, %.0f%% win rate), %d skipped", s.Trades, s.Wins, s.Losses, s.WinRate*100, s.Skipped),
+		fmt.Sprintf("Net profit: %.2f (%.2f%%) after %.2f in fees (%.2f%% of the balance). Buy and hold: %.2f%% (%+.2f points)",
+			s.NetProfit, s.ReturnPct, s.TotalFees, s.FeeDragPct, s.BuyAndHoldPct, s.VsBuyAndHoldPct),
+		fmt.Sprintf("Balance: %.2f -> %.2f. Max drawdown: %.2f%%. Sharpe: %.2f, Sortino: %.2f. Average holding time: %v",
+			s.StartingBalance, s.FinalBalance, s.MaxDrawdown*100, s.SharpeRatio, s.SortinoRatio, s.AverageHolding.Round(time.Minute)),
+		fmt.Sprintf("Signals: %d long, %d short, %d wait. %d analyses failed", s.Signals[core.SignalLong],
+			s.Signals[core.SignalShort], s.Signals[core.SignalWait], s.Errors),
+	}
+	return strings.Join(lines, "\n")
+}
+
+// account is the simulated account of a backtest.
+type account struct {
+	cfg      Config
+	balance  float64
+	position *Trade
+	trades   []Trade
+	skipped  int
+	fees     float64
+}
+
+// open opens a position on `side` at `price`, before slippage.
+func (a *account) open(side core.SIGNAL, at time.Time, price, confidence float64) {
+	spend := a.balance
+	if a.cfg.PurchaseUnit > 0 && a.cfg.PurchaseUnit < spend {
+		spend = a.cfg.PurchaseUnit
+	}
+	fill := price * (1 + a.cfg.Slippage)
+	if side == core.SignalShort {
+		fill = price * (1 - a.cfg.Slippage)
+	}
+	volume := spend / (fill * (1 + a.cfg.Fee))
+	if spend <= 0 || volume < a.cfg.MinVolume || volume == 0 {
+		a.skipped++
+		return
+	}
+	fee := volume * fill * a.cfg.Fee
+	// The value of a short entry is set aside, like the margin it is sold on.
+	a.balance -= volume*fill + fee
+	a.fees += fee
+	a.position = &Trade{Side: side, EntryTime: at, EntryPrice: fill, Volume: volume, Fees: fee, Confidence: confidence}
+}
+
+// close closes the open position at `price`, before slippage.
+func (a *account) close(at time.Time, price float64, atEnd bool) {
+	trade := a.position
+	fill := price * (1 - a.cfg.Slippage)
+	if trade.Side == core.SignalShort {
+		fill = price * (1 + a.cfg.Slippage)
+	}
+	fee := trade.Volume * fill * a.cfg.Fee
+	a.fees += fee
+	trade.ExitTime, trade.ExitPrice, trade.ClosedAtEnd = at, fill, atEnd
+	trade.Fees += fee
+	if trade.Side == core.SignalShort {
+		trade.Profit = trade.Volume*(trade.EntryPrice-fill) - trade.Fees
+	} else {
+		trade.Profit = trade.Volume*(fill-trade.EntryPrice) - trade.Fees
+	}
+	// The entry's value and fee were paid when it was opened.
+	a.balance += trade.Volume*trade.EntryPrice + trade.Profit + (trade.Fees - fee)
+	a.trades = append(a.trades, *trade)
+	a.position = nil
+}
+
+// value returns the balance and the value of the open position at `price`.
+func (a *account) value(price float64) float64 {
+	if a.position == nil {
+		return a.balance
+	}
+	p := a.position
+	unrealized := p.Volume * (price - p.EntryPrice)
+	if p.Side == core.SignalShort {
+		unrealized = -unrealized
+	}
+	return a.balance + p.Volume*p.EntryPrice + unrealized
+}
+
+// Run replays `candles`, ordered from the earliest, through the plugin set in `cfg` and simulates the
+// trades it signals. The candlestick pattern thresholds of the analysis options are set for the whole
+// process, as the bot does, so backtests with different thresholds must not run at the same time.
+func Run(cfg Config, candles []core.OHLC) (result Result, err error) {
+	if err = cfg.Validate(); err != nil {
+		return
+	}
+	plugin, err := core.PluginHandler.Plugin(cfg.Plugin)
+	if err != nil {
+		return
+	}
+	opts := core.ResolveAnalysisOptions(plugin, cfg.Asset)
+	cfg.Overrides.Apply(opts)
+	if cfg.Interval > 0 {
+		opts.Interval = cfg.Interval
+	}
+	// A second timeframe is confirmed by the bot, from the exchange, so it is not part of a backtest.
+	opts.SecondaryInterval, opts.SecondaryPeriod = 0, 0
+	cfg.Interval = opts.Interval
+	window := 1
+	if opts.Interval > 0 {
+		window = int(opts.AnalysisPeriod / opts.Interval)
+	}
+	start := window
+	for start < len(candles) && candles[start].Time.Before(cfg.Start) {
+		start++
+	}
+	if window < 1 || len(candles) <= start {
+		return result, fmt.Errorf("%w (%d candles, at least %d are needed)", ErrNotEnoughCandles, len(candles), window+1)
+	}
+	if err = core.SetPatternSensitivity(opts.Patterns); err != nil {
+		return
+	}
+	result = Result{Config: cfg, From: candles[start-window].Time, To: candles[len(candles)-1].Time}
+	acct := &account{cfg: cfg, balance: cfg.StartingBalance}
+	summary := Summary{StartingBalance: cfg.StartingBalance, Signals: map[core.SIGNAL]int{}}
+	peak := cfg.StartingBalance
+	for i := start; i < len(candles); i++ {
+		analyzed, next := candles[i-window:i], candles[i]
+		signal, confidence, err := analyze(plugin, opts, analyzed)
+		if err != nil {
+			summary.Errors++
+			signal = core.SignalWait
+		} else {
+			summary.Signals[signal]++
+		}
+		switch {
+		case signal == core.SignalLong && acct.position == nil:
+			acct.open(core.SignalLong, next.Time, next.Open, confidence)
+		case signal == core.SignalShort && acct.position == nil && cfg.AllowShort:
+			acct.open(core.SignalShort, next.Time, next.Open, confidence)
+		case acct.position != nil && signal != core.SignalWait && signal != acct.position.Side:
+			acct.close(next.Time, next.Open, false)
+		}
+		if p := acct.position; p != nil && cfg.ProfitMargin > 0 {
+			// The position is closed at its target if the price reached it during the candle.
+			if p.Side == core.SignalLong && next.High >= p.EntryPrice*(1+cfg.ProfitMargin) {
+				acct.close(next.Time, p.EntryPrice*(1+cfg.ProfitMargin), false)
+			} else if p.Side == core.SignalShort && next.Low <= p.EntryPrice*(1-cfg.ProfitMargin) {
+				acct.close(next.Time, p.EntryPrice*(1-cfg.ProfitMargin), false)
+			}
+		}
+		result.Steps = append(result.Steps, Step{Time: next.Time, Open: next.Open, High: next.High, Low: next.Low,
+			Close: next.Close, Signal: signal, Confidence: confidence})
+		value := acct.value(next.Close)
+		result.Equity = append(result.Equity, EquityPoint{Time: next.Time, Value: value})
+		peak = math.Max(peak, value)
+		if peak > 0 {
+			summary.MaxDrawdown = math.Max(summary.MaxDrawdown, (peak-value)/peak)
+		}
+	}
+	last := candles[len(candles)-1]
+	if acct.position != nil {
+		acct.close(last.Time, last.Close, true)
+		result.Equity[len(result.Equity)-1].Value = acct.balance
+	}
+	first := candles[start].Open
+	if first > 0 {
+		summary.BuyAndHoldPct = (last.Close - first) / first * 100
+	}
+	for _, trade := range acct.trades {
+		if trade.Profit > 0 {
+			summary.Wins++
+		} else {
+			summary.Losses++
+		}
+	}
+	summary.Trades, summary.Skipped, summary.TotalFees = len(acct.trades), acct.skipped, acct.fees
+	if summary.Trades > 0 {
+		summary.WinRate = float64(summary.Wins) / float64(summary.Trades)
+	}
+	summary.FinalBalance = acct.balance
+	summary.NetProfit = acct.balance - cfg.StartingBalance
+	summary.ReturnPct = summary.NetProfit / cfg.StartingBalance * 100
+	summary.report(cfg, acct.trades, result.Equity)
+	result.Trades, result.Summary = acct.trades, summary
+	return result, nil
+}
+
+// analyze passes the candles of one analysis period to the plugin and returns its signal and its
+// confidence in it. The current price is the close of the latest candle.
+func analyze(plugin core.Analyzer, opts *core.AnalysisOptions, candles []core.OHLC) (core.SIGNAL, float64, error) {
+	prices := make([]float64, len(candles))
+	for i, candle := range candles {
+		prices[i] = candle.Close
+	}
+	copied := *opts
+	if err := plugin.SetOptions(&copied); err != nil {
+		return core.SignalWait, 0, err
+	}
+	if err := plugin.SetClosingPrices(prices); err != nil {
+		return core.SignalWait, 0, err
+	}
+	if err := plugin.SetCurrentPrice(prices[len(prices)-1]); err != nil {
+		return core.SignalWait, 0, err
+	}
+	if err := plugin.SetOHLC(candles); err != nil {
+		return core.SignalWait, 0, err
+	}
+	if rated, ok := plugin.(core.AnalyzerV2); ok {
+		signal, confidence, err := rated.EmitConfidence()
+		return signal, math.Max(0, math.Min(confidence, 1)), err
+	}
+	signal, err := plugin.Emit()
+	return signal, 1, err
+}
@@ -0,0 +1,211 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/michaellormann/leprechaun/core"
+)
+
+// candlePlugin signals long after a candle that closed up, short after one that closed down and wait
+// after one that closed where it opened, so the trades of a backtest can be worked out by hand.
+type candlePlugin struct {
+	candles []core.OHLC
+}
+
+// testPlugin is the name the candle plugin is registered under.
+const testPlugin = "candle test"
+
+func init() {
+	core.SetConfig(&core.Configuration{})
+	core.PluginHandler.RegisterFactory(testPlugin, func() core.Analyzer { return &candlePlugin{} })
+}
+
+func (p *candlePlugin) Emit() (core.SIGNAL, error) {
+	last := p.candles[len(p.candles)-1]
+	switch {
+	case last.Close > last.Open:
+		return core.SignalLong, nil
+	case last.Close < last.Open:
+		return core.SignalShort, nil
+	}
+	return core.SignalWait, nil
+}
+
+func (p *candlePlugin) SetClosingPrices(prices []float64) error     { return nil }
+func (p *candlePlugin) SetOHLC(candles []core.OHLC) error           { p.candles = candles; return nil }
+func (p *candlePlugin) SetCurrentPrice(float64) error               { return nil }
+func (p *candlePlugin) SetOptions(opts *core.AnalysisOptions) error { return nil }
+func (p *candlePlugin) Description() string                         { return "Follows the direction of the last candle." }
+
+// testStart is the time the first test candle began.
+var testStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// hourly returns hourly candles from `testStart` with the given open, high, low and close prices.
+func hourly(prices ...[4]float64) []core.OHLC {
+	candles := make([]core.OHLC, len(prices))
+	for i, p := range prices {
+		candles[i] = core.NewOHLC(testStart.Add(time.Duration(i)*time.Hour), time.Hour, p[0], p[1], p[2], p[3], 1)
+	}
+	return candles
+}
+
+// testCandles rise for two candles, fall for two and rise for two again. Each candle is analyzed on its
+// own and acted on at the open of the next one.
+var testCandles = hourly(
+	[4]float64{95, 100, 95, 100},
+	[4]float64{100, 110, 95, 105},
+	[4]float64{105, 106, 90, 90},
+	[4]float64{90, 92, 85, 88},
+	[4]float64{88, 95, 88, 95},
+	[4]float64{95, 100, 94, 100},
+)
+
+// repeated returns the test candles `n` times over, one after the other.
+func repeated(n int) (candles []core.OHLC) {
+	for i := 0; i < n; i++ {
+		for _, c := range testCandles {
+			start := c.Time.Add(time.Duration(i*len(testCandles)) * time.Hour)
+			candles = append(candles, core.NewOHLC(start, time.Hour, c.Open, c.High, c.Low, c.Close, c.TotalVolume))
+		}
+	}
+	return
+}
+
+// testConfig backtests the candle plugin on hourly candles analyzed one at a time.
+func testConfig() Config {
+	return Config{Plugin: testPlugin, Asset: "XBT", Interval: time.Hour, StartingBalance: 1000,
+		Overrides: core.AnalyzerOverrides{AnalysisPeriod: 1}}
+}
+
+func TestRun(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(c *Config)
+		// The trades, their profits and the final balance were worked out by hand.
+		profits         []float64
+		final, winRate  float64
+		drawdown        float64
+		sharpe, sortino float64
+	}{
+		{
+			// Long at 100, closed by the short signal at 90, then long at 95 until the last close of 100.
+			name:    "long only",
+			profits: []float64{-100, 900.0 / 95 * 5},
+			final:   900 + 900.0/95*5, winRate: 0.5,
+			// The account peaked at 1050 and fell to 900.
+			drawdown: 150.0 / 1050,
+			// The returns of the candles are 5%, -1/7, 0, 0 and 5/95, annualized over hourly candles.
+			sharpe: -10.574030958103174, sortino: -11.786021581057012,
+		},
+		{
+			// The short signal closes the long at 90, and the next opens a short at 88 that the long signal
+			// closes at 95.
+			name:    "shorts",
+			change:  func(c *Config) { c.AllowShort = true },
+			profits: []float64{-100, -900.0 / 88 * 7},
+			final:   900 - 900.0/88*7, winRate: 0, drawdown: 1 - (900-900.0/88*7)/1050,
+		},
+		{
+			// The first long reaches 105 during its candle, the second is closed by the short signal at 90
+			// and the third reaches 99.75.
+			name:    "profit margin",
+			change:  func(c *Config) { c.ProfitMargin = 0.05 },
+			profits: []float64{50, -150, 900.0 / 95 * 4.75},
+			final:   945, winRate: 2.0 / 3, drawdown: 150.0 / 1050,
+		},
+		{
+			// Each entry spends at most 500, fees included, and pays 1% of its value in fees on the way in
+			// and out. The first buys 500/1.01/100 coins at 100, the second 500/1.01/95 at 95.
+			name:    "purchase unit and fees",
+			change:  func(c *Config) { c.PurchaseUnit, c.Fee = 500, 0.01 },
+			profits: []float64{-500 / 1.01 / 100 * (10 + 1.9), 500 / 1.01 / 95 * (5 - 1.95)},
+			final:   1000 - 500/1.01/100*(10+1.9) + 500/1.01/95*(5-1.95), winRate: 0.5,
+			// The account peaked at the first close of 105, and was worth least once the first trade closed.
+			drawdown: 1 - (1000-500/1.01/100*(10+1.9))/(1000+500/1.01/100*(5-1)),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testConfig()
+			if test.change != nil {
+				test.change(&cfg)
+			}
+			result, err := Run(cfg, testCandles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := result.Summary
+			if len(result.Trades) != len(test.profits) {
+				t.Fatalf("made %d trades (%+v), want %d", len(result.Trades), result.Trades, len(test.profits))
+			}
+			for i, trade := range result.Trades {
+				if !near(trade.Profit, test.profits[i]) {
+					t.Errorf("trade %d made %v, want %v", i+1, trade.Profit, test.profits[i])
+				}
+			}
+			if !near(s.FinalBalance, test.final) || !near(s.ReturnPct, (test.final-1000)/10) {
+				t.Errorf("the final balance is %v (%v%%), want %v", s.FinalBalance, s.ReturnPct, test.final)
+			}
+			if !near(s.WinRate, test.winRate) {
+				t.Errorf("the win rate is %v, want %v", s.WinRate, test.winRate)
+			}
+			if !near(s.MaxDrawdown, test.drawdown) {
+				t.Errorf("the max drawdown is %v, want %v", s.MaxDrawdown, test.drawdown)
+			}
+			if test.sharpe != 0 && (!near(s.SharpeRatio, test.sharpe) || !near(s.SortinoRatio, test.sortino)) {
+				t.Errorf("the Sharpe and Sortino ratios are %v and %v, want %v and %v", s.SharpeRatio, s.SortinoRatio,
+					test.sharpe, test.sortino)
+			}
+			if s.BuyAndHoldPct != 0 || len(result.Equity) != len(testCandles)-1 {
+				t.Errorf("buy and hold returned %v%% over %d candles, want 0%% over %d", s.BuyAndHoldPct,
+					len(result.Equity), len(testCandles)-1)
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	cfg := testConfig()
+	cfg.StartingBalance = 0
+	if _, err := Run(cfg, testCandles); err == nil {
+		t.Error("a backtest without a balance ran")
+	}
+	cfg = testConfig()
+	cfg.Overrides.AnalysisPeriod = 24
+	if _, err := Run(cfg, testCandles); err == nil {
+		t.Error("a backtest of a day of hourly candles ran on six")
+	}
+}
+
+func TestRatios(t *testing.T) {
+	day := 24 * time.Hour
+	for _, test := range []struct {
+		name            string
+		equity          []float64
+		sharpe, sortino float64
+	}{
+		{"one point", []float64{110}, 0, 0},
+		{"steady growth", []float64{110, 121}, 0, 0},
+		{"no mean return", []float64{110, 99}, 0, 0},
+		// The returns are 10% and -5%: their mean is 2.5%, their deviation 7.5% and their downside
+		// deviation the root of 0.05² / 2. There are 365 days in a year.
+		{"up and down", []float64{110, 104.5}, 0.025 / 0.075 * math.Sqrt(365), 0.025 / math.Sqrt(0.00125) * math.Sqrt(365)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			equity := make([]EquityPoint, len(test.equity))
+			for i, value := range test.equity {
+				equity[i] = EquityPoint{Time: testStart.Add(time.Duration(i) * day), Value: value}
+			}
+			sharpe, sortino := ratios(100, equity, day)
+			if !near(sharpe, test.sharpe) || !near(sortino, test.sortino) {
+				t.Errorf("ratios() = %v, %v, want %v, %v", sharpe, sortino, test.sharpe, test.sortino)
+			}
+		})
+	}
+}
+
+// near reports whether `a` and `b` are equal but for rounding.
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
@@ -0,0 +1,319 @@
+package backtest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michaellormann/leprechaun/core"
+)
+
+// Formats of the files history is imported from.
+const (
+	// FormatCSV is a CSV file of candles or trades. Candles are "time,open,high,low,close,volume" rows,
+	// with or without a header. Trades need a header naming the time, price and volume columns, as in
+	// Luno's trade exports.
+	FormatCSV = "csv"
+	// FormatJSON is a JSON list of candles or trades, or an object holding the list under "candles",
+	// "trades" or "data", like the responses of Luno's trades API.
+	FormatJSON = "json"
+)
+
+// ErrInvalidHistory is returned when a file of candles or trades can not be read.
+var ErrInvalidHistory = errors.New("invalid history file")
+
+// Tick is a trade, e.g. from an export of an exchange's trade history.
+type Tick struct {
+	Time          time.Time
+	Price, Volume float64
+}
+
+// Names the columns of candles and trades may have. A column is matched if its name starts with one of
+// its names, case-insensitively, e.g. "Timestamp (UTC)" is a time column.
+var columnNames = map[string][]string{
+	"time":   {"time", "timestamp", "date", "open_time", "opentime"},
+	"open":   {"open"},
+	"high":   {"high"},
+	"low":    {"low"},
+	"close":  {"close"},
+	"volume": {"volume", "vol", "base", "amount", "quantity"},
+	"price":  {"price", "rate"},
+}
+
+// LoadStored returns the candles of `pair` that are `interval` long, began from `from` up to, but not
+// including, `to`, and were saved in the candle database.
+func LoadStored(pair string, interval time.Duration, from, to time.Time) ([]core.OHLC, error) {
+	return core.StoredCandles(pair, interval, from, to)
+}
+
+// FormatOf returns the format of the file at `path`, from its extension.
+func FormatOf(path string) string {
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		return FormatJSON
+	}
+	return FormatCSV
+}
+
+// Load reads candles or trades in `format` from `r`. Trades are combined into candles that are `interval`
+// long. The candles are returned ordered from the earliest.
+func Load(r io.Reader, format string, interval time.Duration) ([]core.OHLC, error) {
+	var (
+		rows []map[string]string
+		err  error
+	)
+	switch format {
+	case FormatCSV:
+		rows, err = csvRows(r)
+	case FormatJSON:
+		rows, err = jsonRows(r)
+	default:
+		return nil, fmt.Errorf("%w (unknown format %q)", ErrInvalidHistory, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w (the file is empty)", ErrInvalidHistory)
+	}
+	if _, ok := rows[0]["open"]; ok {
+		return parseCandles(rows, interval)
+	}
+	ticks, err := parseTicks(rows)
+	if err != nil {
+		return nil, err
+	}
+	return CandlesFromTrades(ticks, interval), nil
+}
+
+// Import reads candles or trades in `format` from `r`, like `Load`, and saves the candles in the candle
+// database under `pair`, so later analyses, backtests and the stats use them.
+func Import(pair string, interval time.Duration, r io.Reader, format string) ([]core.OHLC, error) {
+	candles, err := Load(r, format, interval)
+	if err != nil {
+		return nil, err
+	}
+	return candles, core.SaveCandles(pair, interval, candles)
+}
+
+// CandlesFromTrades combines trades into candles that are `interval` long, ordered from the earliest.
+// Periods without trades have no candle.
+func CandlesFromTrades(ticks []Tick, interval time.Duration) (candles []core.OHLC) {
+	sort.SliceStable(ticks, func(i, j int) bool { return ticks[i].Time.Before(ticks[j].Time) })
+	for i := 0; i < len(ticks); {
+		start := ticks[i].Time.Truncate(interval)
+		open, high, low, volume := ticks[i].Price, ticks[i].Price, ticks[i].Price, 0.0
+		closing := open
+		for ; i < len(ticks) && ticks[i].Time.Before(start.Add(interval)); i++ {
+			price := ticks[i].Price
+			if price > high {
+				high = price
+			}
+			if price < low {
+				low = price
+			}
+			closing = price
+			volume += ticks[i].Volume
+		}
+		candles = append(candles, core.NewOHLC(start, interval, open, high, low, closing, volume))
+	}
+	return
+}
+
+// Resample combines consecutive candles, ordered from the earliest, into candles that are `interval` long.
+// Periods that are not fully covered by the candles have no candle.
+func Resample(candles []core.OHLC, interval time.Duration) (resampled []core.OHLC) {
+	length := candleLength(candles)
+	if length <= 0 || interval <= length {
+		return candles
+	}
+	for i := 0; i < len(candles); {
+		start := candles[i].Time.Truncate(interval)
+		open, high, low, volume := candles[i].Open, candles[i].High, candles[i].Low, 0.0
+		j := i
+		for ; j < len(candles) && candles[j].Time.Before(start.Add(interval)); j++ {
+			high, low = math.Max(high, candles[j].High), math.Min(low, candles[j].Low)
+			volume += candles[j].TotalVolume
+		}
+		if time.Duration(j-i)*length >= interval {
+			resampled = append(resampled, core.NewOHLC(start, interval, open, high, low, candles[j-1].Close, volume))
+		}
+		i = j
+	}
+	return
+}
+
+// candleLength returns the length of the candles, or zero if it is not known.
+func candleLength(candles []core.OHLC) time.Duration {
+	switch {
+	case len(candles) > 0 && candles[0].Period > 0:
+		return candles[0].Period
+	case len(candles) > 1:
+		return candles[1].Time.Sub(candles[0].Time)
+	}
+	return 0
+}
+
+// csvRows reads the rows of a CSV file, keyed by column. Files without a header are read as candles.
+func csvRows(r io.Reader) (rows []map[string]string, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrInvalidHistory, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	columns := []string{"time", "open", "high", "low", "close", "volume"}
+	if _, err := parseTime(records[0][0]); err != nil {
+		// The first row is a header.
+		columns = make([]string, len(records[0]))
+		for i, name := range records[0] {
+			columns[i] = columnOf(name)
+		}
+		records = records[1:]
+	}
+	for _, record := range records {
+		row := map[string]string{}
+		for i, value := range record {
+			if i >= len(columns) || columns[i] == "" {
+				continue
+			}
+			if _, taken := row[columns[i]]; !taken {
+				row[columns[i]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// jsonRows reads the candles or trades of a JSON file, keyed by column.
+func jsonRows(r io.Reader) (rows []map[string]string, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var list []map[string]interface{}
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '{' {
+		wrapped := map[string]json.RawMessage{}
+		if err = json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrInvalidHistory, err)
+		}
+		for key, value := range wrapped {
+			switch strings.ToLower(key) {
+			case "candles", "trades", "data":
+				if len(list) == 0 {
+					json.Unmarshal(value, &list)
+				}
+			}
+		}
+	} else if err = json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrInvalidHistory, err)
+	}
+	for _, item := range list {
+		names := make([]string, 0, len(item))
+		for name := range item {
+			names = append(names, name)
+		}
+		// If several fields hold a column, e.g. "volumefrom" and "volumeto", the first by name is used.
+		sort.Strings(names)
+		row := map[string]string{}
+		for _, name := range names {
+			column := columnOf(name)
+			if _, taken := row[column]; column == "" || taken {
+				continue
+			}
+			row[column] = fmt.Sprint(item[name])
+			if number, ok := item[name].(float64); ok {
+				row[column] = strconv.FormatFloat(number, 'f', -1, 64)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// columnOf returns the column a field named `name` holds, or an empty string if it is not used.
+func columnOf(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	// Names are matched longest first, so "open_time" is a time column and not an open column.
+	best, length := "", 0
+	for column, names := range columnNames {
+		for _, prefix := range names {
+			if strings.HasPrefix(name, prefix) && len(prefix) > length {
+				best, length = column, len(prefix)
+			}
+		}
+	}
+	return best
+}
+
+// parseCandles parses rows of candles.
+func parseCandles(rows []map[string]string, interval time.Duration) (candles []core.OHLC, err error) {
+	for i, row := range rows {
+		start, err := parseTime(row["time"])
+		if err != nil {
+			return nil, fmt.Errorf("%w (row %d: %v)", ErrInvalidHistory, i+1, err)
+		}
+		values := make([]float64, 5)
+		for j, column := range []string{"open", "high", "low", "close", "volume"} {
+			if values[j], err = strconv.ParseFloat(row[column], 64); err != nil {
+				return nil, fmt.Errorf("%w (row %d: the %s is %q)", ErrInvalidHistory, i+1, column, row[column])
+			}
+		}
+		candles = append(candles, core.NewOHLC(start, interval, values[0], values[1], values[2], values[3], values[4]))
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Time.Before(candles[j].Time) })
+	return candles, nil
+}
+
+// parseTicks parses rows of trades.
+func parseTicks(rows []map[string]string) (ticks []Tick, err error) {
+	for i, row := range rows {
+		tick := Tick{}
+		if tick.Time, err = parseTime(row["time"]); err != nil {
+			return nil, fmt.Errorf("%w (row %d: %v)", ErrInvalidHistory, i+1, err)
+		}
+		if tick.Price, err = strconv.ParseFloat(row["price"], 64); err != nil || tick.Price <= 0 {
+			return nil, fmt.Errorf("%w (row %d: the price is %q)", ErrInvalidHistory, i+1, row["price"])
+		}
+		if tick.Volume, err = strconv.ParseFloat(row["volume"], 64); err != nil {
+			return nil, fmt.Errorf("%w (row %d: the volume is %q)", ErrInvalidHistory, i+1, row["volume"])
+		}
+		ticks = append(ticks, tick)
+	}
+	return ticks, nil
+}
+
+// timeLayouts are the layouts of the dates that are parsed, besides Unix timestamps.
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseTime parses a Unix timestamp, in seconds or milliseconds, or a date. Dates without a time zone are in UTC.
+func parseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		if number > 1e12 {
+			// Luno's timestamps are in milliseconds.
+			return time.Unix(0, int64(number)*int64(time.Millisecond)), nil
+		}
+		return time.Unix(int64(number), 0), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time", value)
+}
@@ -0,0 +1,290 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michaellormann/leprechaun/core"
+)
+
+// Ways a Monte Carlo simulation makes up price series from the historic candles.
+const (
+	// MethodBootstrap rebuilds the series from random blocks of consecutive candles, so the moves of the
+	// candles are kept but happen in another order.
+	MethodBootstrap = "bootstrap"
+	// MethodPerturb keeps the order of the candles but adds random noise to the move of each.
+	MethodPerturb = "perturb"
+)
+
+// MonteCarlo holds the settings of a Monte Carlo simulation. The candles are made into many price series
+// that could have happened instead, and each scenario is backtested on every series, so the spread of
+// its outcomes shows how much of its result is down to the particular history.
+type MonteCarlo struct {
+	// Base holds the settings of the backtests.
+	Base Config
+	// PurchaseUnits and ProfitMargins are the values tried in place of those of the base settings. Every
+	// combination is a scenario, and all scenarios are backtested on the same series.
+	PurchaseUnits []float64
+	ProfitMargins []float64
+	// Runs is the number of series. Zero makes 200.
+	Runs int
+	// Method is `MethodBootstrap`, the default, or `MethodPerturb`.
+	Method string
+	// BlockSize is the number of consecutive candles the bootstrap keeps together. Zero keeps 10.
+	BlockSize int
+	// Noise is the standard deviation of the noise the perturbation adds to the move of each candle, as a
+	// fraction of the price. Zero adds 0.005.
+	Noise float64
+	// RuinDrawdown is the fall of the account's value from a peak, as a fraction, at which a run counts as
+	// ruined. Zero counts a fall of a half.
+	RuinDrawdown float64
+	// Seed seeds the random series, so a simulation can be repeated. Zero seeds it with the time.
+	Seed int64
+	// Workers is the number of backtests run at the same time, as in `Sweep`.
+	Workers int
+}
+
+// Percentiles summarizes a distribution of outcomes.
+type Percentiles struct {
+	P5, P25, Median, P75, P95 float64
+}
+
+// Distribution holds the outcomes of a scenario of a Monte Carlo simulation.
+type Distribution struct {
+	PurchaseUnit, ProfitMargin float64
+	// History summarizes the backtest on the historic candles.
+	History Summary
+	// Runs is the number of series the scenario was backtested on, and Failed the number of those whose backtest failed.
+	Runs, Failed int
+	ReturnPct    Percentiles
+	MaxDrawdown  Percentiles
+	// ProfitableShare is the share of the runs that made a profit, from 0 to 1.
+	ProfitableShare float64
+	// RuinProbability is the share of the runs whose drawdown reached the ruin drawdown, from 0 to 1.
+	RuinProbability float64
+}
+
+// MonteCarloResult holds the distributions of the scenarios of a Monte Carlo simulation.
+type MonteCarloResult struct {
+	Plugin, Asset string
+	Method        string
+	Seed          int64
+	RuinDrawdown  float64
+	Scenarios     []Distribution
+}
+
+// String summarizes each scenario in a few lines.
+func (r MonteCarloResult) String() string {
+	lines := []string{fmt.Sprintf("Monte Carlo simulation of %s on %s (%s, seed %d). Ruin is a drawdown of %.0f%%.",
+		r.Plugin, r.Asset, r.Method, r.Seed, r.RuinDrawdown*100)}
+	for _, d := range r.Scenarios {
+		lines = append(lines,
+			fmt.Sprintf("Purchase unit %.2f, margin %.2f%%: history returned %.2f%%. %d runs (%d failed)",
+				d.PurchaseUnit, d.ProfitMargin*100, d.History.ReturnPct, d.Runs, d.Failed),
+			fmt.Sprintf("   Return: 5%% %.2f%%, 25%% %.2f%%, median %.2f%%, 75%% %.2f%%, 95%% %.2f%%",
+				d.ReturnPct.P5, d.ReturnPct.P25, d.ReturnPct.Median, d.ReturnPct.P75, d.ReturnPct.P95),
+			fmt.Sprintf("   Max drawdown: median %.2f%%, 95%% %.2f%%. Profitable: %.0f%%. Ruin: %.1f%%",
+				d.MaxDrawdown.Median*100, d.MaxDrawdown.P95*100, d.ProfitableShare*100, d.RuinProbability*100))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RunMonteCarlo runs the Monte Carlo simulation set in `mc` on `candles`, ordered from the earliest.
+func RunMonteCarlo(mc MonteCarlo, candles []core.OHLC) (result MonteCarloResult, err error) {
+	if err = mc.Base.Validate(); err != nil {
+		return
+	}
+	switch {
+	case mc.Method != "" && mc.Method != MethodBootstrap && mc.Method != MethodPerturb:
+		return result, fmt.Errorf("%w (unknown method %q)", ErrInvalidConfig, mc.Method)
+	case mc.Runs < 0 || mc.BlockSize < 0 || mc.Noise < 0 || mc.Workers < 0 || mc.RuinDrawdown < 0 || mc.RuinDrawdown > 1:
+		return result, fmt.Errorf("%w (runs %d, block size %d, noise %v, ruin drawdown %v)", ErrInvalidConfig,
+			mc.Runs, mc.BlockSize, mc.Noise, mc.RuinDrawdown)
+	case len(candles) < 2:
+		return result, fmt.Errorf("%w (%d candles)", ErrNotEnoughCandles, len(candles))
+	}
+	if mc.Runs == 0 {
+		mc.Runs = 200
+	}
+	if mc.Method == "" {
+		mc.Method = MethodBootstrap
+	}
+	if mc.BlockSize == 0 {
+		mc.BlockSize = 10
+	}
+	if mc.Noise == 0 {
+		mc.Noise = 0.005
+	}
+	if mc.RuinDrawdown == 0 {
+		mc.RuinDrawdown = 0.5
+	}
+	if mc.Seed == 0 {
+		mc.Seed = time.Now().UnixNano()
+	}
+	if mc.Workers == 0 {
+		mc.Workers = runtime.NumCPU()
+	}
+	if !core.PluginHandler.HasFactory(mc.Base.Plugin) {
+		mc.Workers = 1
+	}
+
+	scenarios := mc.scenarios()
+	for _, cfg := range scenarios {
+		if err = cfg.Validate(); err != nil {
+			return
+		}
+	}
+	result = MonteCarloResult{Plugin: mc.Base.Plugin, Asset: mc.Base.Asset, Method: mc.Method, Seed: mc.Seed,
+		RuinDrawdown: mc.RuinDrawdown}
+	// summaries[i][run] is the summary of scenario i on series `run`, or nil if its backtest failed.
+	summaries := make([][]*Summary, len(scenarios))
+	for i := range summaries {
+		summaries[i] = make([]*Summary, mc.Runs)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < mc.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range jobs {
+				// Each series has a seed of its own, so the series do not depend on the order the runs are done in.
+				series := mc.series(candles, rand.New(rand.NewSource(mc.Seed+int64(run))))
+				for i, cfg := range scenarios {
+					if r, err := Run(cfg, series); err == nil {
+						summaries[i][run] = &r.Summary
+					}
+				}
+			}
+		}()
+	}
+	for run := 0; run < mc.Runs; run++ {
+		jobs <- run
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, cfg := range scenarios {
+		history, err := Run(cfg, candles)
+		if err != nil {
+			return result, err
+		}
+		result.Scenarios = append(result.Scenarios, mc.distribution(cfg, history.Summary, summaries[i]))
+	}
+	return result, nil
+}
+
+// scenarios returns the settings of each combination of purchase units and profit margins.
+func (mc MonteCarlo) scenarios() (configs []Config) {
+	units, margins := mc.PurchaseUnits, mc.ProfitMargins
+	if len(units) == 0 {
+		units = []float64{mc.Base.PurchaseUnit}
+	}
+	if len(margins) == 0 {
+		margins = []float64{mc.Base.ProfitMargin}
+	}
+	for _, unit := range units {
+		for _, margin := range margins {
+			cfg := mc.Base
+			cfg.PurchaseUnit, cfg.ProfitMargin = unit, margin
+			configs = append(configs, cfg)
+		}
+	}
+	return
+}
+
+// distribution summarizes the outcomes of a scenario.
+func (mc MonteCarlo) distribution(cfg Config, history Summary, summaries []*Summary) Distribution {
+	d := Distribution{PurchaseUnit: cfg.PurchaseUnit, ProfitMargin: cfg.ProfitMargin, History: history, Runs: len(summaries)}
+	returns, drawdowns := []float64{}, []float64{}
+	for _, s := range summaries {
+		if s == nil {
+			d.Failed++
+			continue
+		}
+		returns, drawdowns = append(returns, s.ReturnPct), append(drawdowns, s.MaxDrawdown)
+		if s.NetProfit > 0 {
+			d.ProfitableShare++
+		}
+		if s.MaxDrawdown >= mc.RuinDrawdown {
+			d.RuinProbability++
+		}
+	}
+	if completed := float64(len(returns)); completed > 0 {
+		d.ProfitableShare /= completed
+		d.RuinProbability /= completed
+	}
+	d.ReturnPct, d.MaxDrawdown = percentiles(returns), percentiles(drawdowns)
+	return d
+}
+
+// percentiles returns the percentiles of `values`, interpolated between the nearest values.
+func percentiles(values []float64) (p Percentiles) {
+	if len(values) == 0 {
+		return
+	}
+	sort.Float64s(values)
+	at := func(q float64) float64 {
+		pos := q * float64(len(values)-1)
+		low := int(math.Floor(pos))
+		if low+1 >= len(values) {
+			return values[low]
+		}
+		return values[low] + (values[low+1]-values[low])*(pos-float64(low))
+	}
+	return Percentiles{P5: at(0.05), P25: at(0.25), Median: at(0.5), P75: at(0.75), P95: at(0.95)}
+}
+
+// move is the prices of a candle relative to the close of the candle before it.
+type move struct {
+	open, high, low, close, volume float64
+}
+
+// series returns a price series made up from `candles` with `rng`. It starts at the first candle and
+// has as many candles, at the same times.
+func (mc MonteCarlo) series(candles []core.OHLC, rng *rand.Rand) []core.OHLC {
+	moves := make([]move, len(candles)-1)
+	for i := 1; i < len(candles); i++ {
+		previous, c := candles[i-1].Close, candles[i]
+		if previous <= 0 {
+			previous = c.Open
+		}
+		moves[i-1] = move{c.Open / previous, c.High / previous, c.Low / previous, c.Close / previous, c.TotalVolume}
+	}
+	if mc.Method == MethodBootstrap {
+		shuffled := make([]move, 0, len(moves))
+		for len(shuffled) < len(moves) {
+			start := rng.Intn(len(moves))
+			for i := start; i < start+mc.BlockSize && i < len(moves) && len(shuffled) < len(moves); i++ {
+				shuffled = append(shuffled, moves[i])
+			}
+		}
+		moves = shuffled
+	} else {
+		for i, m := range moves {
+			// The whole candle moves with its close, so its shape is kept.
+			factor := 1 + rng.NormFloat64()*mc.Noise
+			if factor <= 0.01 {
+				factor = 0.01
+			}
+			moves[i] = move{m.open * factor, m.high * factor, m.low * factor, m.close * factor, m.volume}
+		}
+	}
+	series := make([]core.OHLC, len(candles))
+	series[0] = candles[0]
+	closing := candles[0].Close
+	for i, m := range moves {
+		c := candles[i+1]
+		open, high, low, next := closing*m.open, closing*m.high, closing*m.low, closing*m.close
+		high, low = math.Max(high, math.Max(open, next)), math.Min(low, math.Min(open, next))
+		series[i+1] = core.NewOHLC(c.Time, c.Period, open, high, low, next, m.volume)
+		closing = next
+	}
+	return series
+}
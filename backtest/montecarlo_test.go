@@ -0,0 +1,132 @@
+package backtest
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestPercentiles(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		values []float64
+		want   Percentiles
+	}{
+		{"none", nil, Percentiles{}},
+		{"one", []float64{3}, Percentiles{3, 3, 3, 3, 3}},
+		// The 5th percentile lies a fifth of the way from 1 to 2, as 0.05 * 4 = 0.2.
+		{"unsorted", []float64{5, 1, 4, 2, 3}, Percentiles{1.2, 2, 3, 4, 4.8}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := percentiles(test.values)
+			for _, p := range [][2]float64{{got.P5, test.want.P5}, {got.P25, test.want.P25}, {got.Median, test.want.Median},
+				{got.P75, test.want.P75}, {got.P95, test.want.P95}} {
+				if !near(p[0], p[1]) {
+					t.Fatalf("percentiles(%v) = %+v, want %+v", test.values, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	mc := MonteCarlo{RuinDrawdown: 0.5}
+	summaries := []*Summary{
+		{ReturnPct: 10, NetProfit: 100, MaxDrawdown: 0.1},
+		{ReturnPct: -20, NetProfit: -200, MaxDrawdown: 0.5},
+		nil,
+		{ReturnPct: 30, NetProfit: 300, MaxDrawdown: 0.2},
+	}
+	d := mc.distribution(testConfig(), Summary{}, summaries)
+	// One of the three completed runs lost money, and reached the ruin drawdown.
+	if d.Runs != 4 || d.Failed != 1 || !near(d.ProfitableShare, 2.0/3) || !near(d.RuinProbability, 1.0/3) {
+		t.Errorf("distribution() = %+v, want 4 runs, 1 failed, 2 in 3 profitable and 1 in 3 ruined", d)
+	}
+	if d.ReturnPct.Median != 10 || d.MaxDrawdown.Median != 0.2 {
+		t.Errorf("the median return is %v and drawdown %v, want 10 and 0.2", d.ReturnPct.Median, d.MaxDrawdown.Median)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	candles := repeated(2)
+	moves := map[float64]bool{}
+	for i := 1; i < len(candles); i++ {
+		moves[candles[i].Close/candles[i-1].Close] = true
+	}
+	for _, test := range []struct {
+		name string
+		mc   MonteCarlo
+	}{
+		{"bootstrap", MonteCarlo{Method: MethodBootstrap, BlockSize: 1}},
+		{"perturb", MonteCarlo{Method: MethodPerturb, Noise: 1e-12}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			series := test.mc.series(candles, rand.New(rand.NewSource(1)))
+			if len(series) != len(candles) || !reflect.DeepEqual(series[0], candles[0]) {
+				t.Fatalf("the series has %d candles from %+v, want %d from the first candle", len(series), series[0], len(candles))
+			}
+			for i := 1; i < len(series); i++ {
+				c, move := series[i], series[i].Close/series[i-1].Close
+				if !c.Time.Equal(candles[i].Time) || c.High < c.Open || c.High < c.Close || c.Low > c.Open || c.Low > c.Close {
+					t.Fatalf("candle %d is %+v, want a candle at %v", i, c, candles[i].Time)
+				}
+				switch test.mc.Method {
+				case MethodBootstrap:
+					found := false
+					for m := range moves {
+						found = found || near(move, m)
+					}
+					if !found {
+						t.Errorf("candle %d moved by %v, which no historic candle did", i, move)
+					}
+				case MethodPerturb:
+					if !near(c.Close, candles[i].Close) {
+						t.Errorf("candle %d closed at %v, want the historic close %v", i, c.Close, candles[i].Close)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRunMonteCarlo(t *testing.T) {
+	candles := repeated(4)
+	mc := MonteCarlo{Base: testConfig(), PurchaseUnits: []float64{500, 1000}, ProfitMargins: []float64{0, 0.05}, Runs: 20,
+		BlockSize: 3, Seed: 7, Workers: 4}
+	result, err := RunMonteCarlo(mc, candles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Scenarios) != 4 || result.Method != MethodBootstrap || result.RuinDrawdown != 0.5 {
+		t.Fatalf("the simulation has %d scenarios by %s, want 4 by bootstrap", len(result.Scenarios), result.Method)
+	}
+	for _, d := range result.Scenarios {
+		cfg := testConfig()
+		cfg.PurchaseUnit, cfg.ProfitMargin = d.PurchaseUnit, d.ProfitMargin
+		history, err := Run(cfg, candles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.History.ReturnPct != history.Summary.ReturnPct || d.Runs != 20 || d.Failed != 0 {
+			t.Errorf("the scenario %+v is not the backtest of its settings on the candles over 20 runs", d)
+		}
+		if d.ReturnPct.P5 > d.ReturnPct.Median || d.ReturnPct.Median > d.ReturnPct.P95 {
+			t.Errorf("the return percentiles of the scenario are out of order: %+v", d.ReturnPct)
+		}
+	}
+	// The series depend only on the seed, not on the order the workers backtest them in.
+	mc.Workers = 1
+	again, err := RunMonteCarlo(mc, candles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, result) {
+		t.Error("the simulation gave another result with the same seed")
+	}
+
+	mc.Method = "guess"
+	if _, err = RunMonteCarlo(mc, candles); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("a simulation by an unknown method returned %v, want ErrInvalidConfig", err)
+	}
+}
@@ -0,0 +1,431 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michaellormann/leprechaun/core"
+)
+
+// Objectives the configurations of a sweep are ranked by.
+const (
+	ObjectiveSharpe  = "sharpe"
+	ObjectiveSortino = "sortino"
+	ObjectiveReturn  = "return"
+)
+
+// minTrades is the number of trades below which the result of a configuration may be down to luck.
+const minTrades = 10
+
+// ErrInvalidSweep is returned when the settings of a parameter sweep are out of range.
+var ErrInvalidSweep = errors.New("invalid parameter sweep")
+
+// Grid holds the values each parameter of a sweep takes. Every combination of the values is backtested.
+// Parameters without values keep the value of the base settings.
+type Grid struct {
+	ProfitMargins []float64
+	// Intervals are the lengths of the analyzed candles. They must be multiples of the length of the swept candles.
+	Intervals []time.Duration
+	// AnalysisPeriods are whole numbers of hours.
+	AnalysisPeriods []time.Duration
+	// Modes are `core.ModeTrendFollowing` or `core.ModeContrarian`.
+	Modes                []string
+	MovingAverageWindows []int
+	// Patterns are thresholds of candlestick pattern detection. As the thresholds are set for the whole
+	// process, only combinations with the same thresholds are backtested at the same time.
+	Patterns []core.PatternSensitivity
+}
+
+// Size returns the number of combinations of the grid.
+func (g Grid) Size() int {
+	size := 1
+	for _, n := range []int{len(g.ProfitMargins), len(g.Intervals), len(g.AnalysisPeriods), len(g.Modes),
+		len(g.MovingAverageWindows), len(g.Patterns)} {
+		if n > 0 {
+			size *= n
+		}
+	}
+	return size
+}
+
+// Sweep holds the settings of a parameter sweep.
+type Sweep struct {
+	// Base holds the settings shared by every backtest of the sweep.
+	Base Config
+	Grid Grid
+	// Objective is what the configurations are ranked by: `ObjectiveSharpe`, the default,
+	// `ObjectiveSortino` or `ObjectiveReturn`.
+	Objective string
+	// Holdout is the share of the latest candles, up to a half, that the configurations are not ranked on.
+	// The best configurations are backtested on them, to check they do not only fit the earlier candles.
+	// Zero holds out no candles.
+	Holdout float64
+	// Top is the number of best configurations reported. Zero reports 5.
+	Top int
+	// Workers is the number of backtests run at the same time. Zero runs one for each CPU. Plugins that
+	// were not registered with a factory share their state, so they are backtested one at a time.
+	Workers int
+}
+
+// validate returns `ErrInvalidSweep` if any setting of the sweep is out of range.
+func (s Sweep) validate() error {
+	if err := s.Base.Validate(); err != nil {
+		return err
+	}
+	switch s.Objective {
+	case "", ObjectiveSharpe, ObjectiveSortino, ObjectiveReturn:
+	default:
+		return fmt.Errorf("%w (unknown objective %q)", ErrInvalidSweep, s.Objective)
+	}
+	if s.Holdout < 0 || s.Holdout > 0.5 || s.Top < 0 || s.Workers < 0 {
+		return fmt.Errorf("%w (holdout %v, top %d, workers %d)", ErrInvalidSweep, s.Holdout, s.Top, s.Workers)
+	}
+	for _, margin := range s.Grid.ProfitMargins {
+		if margin < 0 || margin >= 1 {
+			return fmt.Errorf("%w (profit margin %v)", ErrInvalidSweep, margin)
+		}
+	}
+	for _, period := range s.Grid.AnalysisPeriods {
+		if period < time.Hour || period%time.Hour != 0 {
+			return fmt.Errorf("%w (analysis period %v is not a whole number of hours)", ErrInvalidSweep, period)
+		}
+	}
+	for _, mode := range s.Grid.Modes {
+		if mode != core.ModeTrendFollowing && mode != core.ModeContrarian {
+			return fmt.Errorf("%w (unknown trading mode %q)", ErrInvalidSweep, mode)
+		}
+	}
+	for _, window := range s.Grid.MovingAverageWindows {
+		if window < 1 {
+			return fmt.Errorf("%w (moving average window %d)", ErrInvalidSweep, window)
+		}
+	}
+	for _, patterns := range s.Grid.Patterns {
+		if err := patterns.Validate(); err != nil {
+			return fmt.Errorf("%w (%v)", ErrInvalidSweep, err)
+		}
+	}
+	return nil
+}
+
+// score returns the objective of the sweep for `summary`.
+func (s Sweep) score(summary Summary) float64 {
+	switch s.Objective {
+	case ObjectiveReturn:
+		return summary.ReturnPct
+	case ObjectiveSortino:
+		return summary.SortinoRatio
+	}
+	return summary.SharpeRatio
+}
+
+// combinations returns the settings of each combination of the grid. Combinations with the same
+// candlestick pattern thresholds are next to each other.
+func (s Sweep) combinations() (configs []Config) {
+	g := s.Grid
+	margins, intervals, periods := g.ProfitMargins, g.Intervals, g.AnalysisPeriods
+	if len(margins) == 0 {
+		margins = []float64{s.Base.ProfitMargin}
+	}
+	if len(intervals) == 0 {
+		intervals = []time.Duration{s.Base.Interval}
+	}
+	if len(periods) == 0 {
+		periods = []time.Duration{time.Duration(s.Base.Overrides.AnalysisPeriod) * time.Hour}
+	}
+	modes, windows, patterns := g.Modes, g.MovingAverageWindows, g.Patterns
+	if len(modes) == 0 {
+		modes = []string{s.Base.Overrides.Mode}
+	}
+	if len(windows) == 0 {
+		windows = []int{s.Base.Overrides.MovingAverageWindow}
+	}
+	if len(patterns) == 0 {
+		patterns = []core.PatternSensitivity{s.Base.Overrides.Patterns}
+	}
+	for _, pattern := range patterns {
+		for _, margin := range margins {
+			for _, interval := range intervals {
+				for _, period := range periods {
+					for _, mode := range modes {
+						for _, window := range windows {
+							cfg := s.Base
+							cfg.ProfitMargin, cfg.Interval = margin, interval
+							cfg.Overrides.AnalysisPeriod = int32(period / time.Hour)
+							cfg.Overrides.Mode, cfg.Overrides.MovingAverageWindow = mode, window
+							cfg.Overrides.Patterns = pattern
+							configs = append(configs, cfg)
+						}
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// Candidate is a configuration tried by a sweep.
+type Candidate struct {
+	Config Config
+	// Score is the objective of the backtest on the candles that were not held out.
+	Score    float64
+	InSample Summary
+	// OutOfSample summarizes the backtest on the held-out candles, if any were held out.
+	OutOfSample *Summary
+	// Warnings are signs that the configuration is overfitted, i.e. only fits the candles it was chosen on.
+	Warnings []string
+}
+
+// Optimization holds the results of a parameter sweep.
+type Optimization struct {
+	Plugin, Asset string
+	Objective     string
+	// Tested is the number of configurations that were backtested, and Failed the number of those whose backtest failed.
+	Tested, Failed int
+	// HoldoutFrom is the time the held-out candles start from. It is zero if no candles were held out.
+	HoldoutFrom time.Time
+	// Best holds the best configurations, the best first.
+	Best []Candidate
+	// Warnings concern the sweep as a whole.
+	Warnings []string
+}
+
+// String summarizes the best configurations, one line each, followed by their warnings.
+func (o Optimization) String() string {
+	lines := []string{fmt.Sprintf("%d configurations of %s on %s were tested (%d failed), ranked by %s.",
+		o.Tested, o.Plugin, o.Asset, o.Failed, o.Objective)}
+	if !o.HoldoutFrom.IsZero() {
+		lines = append(lines, fmt.Sprintf("Candles from %s were held out.", o.HoldoutFrom.Format("2006-01-02 15:04")))
+	}
+	for _, warning := range o.Warnings {
+		lines = append(lines, "Warning: "+warning)
+	}
+	for i, c := range o.Best {
+		s := c.InSample
+		line := fmt.Sprintf("%d. %s: %s %.2f, return %.2f%%, %d trades, %.0f%% win rate, %.2f%% max drawdown",
+			i+1, c.Config.describe(), o.Objective, c.Score, s.ReturnPct, s.Trades, s.WinRate*100, s.MaxDrawdown*100)
+		if out := c.OutOfSample; out != nil {
+			line += fmt.Sprintf(". Held out: return %.2f%%, %d trades, Sharpe %.2f", out.ReturnPct, out.Trades, out.SharpeRatio)
+		}
+		lines = append(lines, line)
+		for _, warning := range c.Warnings {
+			lines = append(lines, "   Warning: "+warning)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describe returns the parameters a sweep varies.
+func (c Config) describe() string {
+	mode := c.Overrides.Mode
+	if mode == "" {
+		mode = "default mode"
+	}
+	parts := []string{fmt.Sprintf("margin %.2f%%", c.ProfitMargin*100), fmt.Sprintf("interval %v", c.Interval),
+		fmt.Sprintf("period %dh", c.Overrides.AnalysisPeriod), mode, fmt.Sprintf("moving average %d", c.Overrides.MovingAverageWindow)}
+	if p := c.Overrides.Patterns; p != (core.PatternSensitivity{}) {
+		parts = append(parts, fmt.Sprintf("patterns %+v", p))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Optimize backtests every combination of the values of the grid of `sweep` on `candles`, ordered from
+// the earliest, and returns the best configurations, with warnings about those that may be overfitted.
+// A zero interval, analysis period or moving average window uses the plugin's options.
+func Optimize(sweep Sweep, candles []core.OHLC) (opt Optimization, err error) {
+	if err = sweep.validate(); err != nil {
+		return
+	}
+	if sweep.Objective == "" {
+		sweep.Objective = ObjectiveSharpe
+	}
+	if sweep.Top == 0 {
+		sweep.Top = 5
+	}
+	if sweep.Workers == 0 {
+		sweep.Workers = runtime.NumCPU()
+	}
+	if !core.PluginHandler.HasFactory(sweep.Base.Plugin) {
+		sweep.Workers = 1
+	}
+	length := candleLength(candles)
+	series := map[time.Duration][]core.OHLC{}
+	for _, interval := range sweep.Grid.Intervals {
+		if length <= 0 || interval < length || interval%length != 0 {
+			return opt, fmt.Errorf("%w (candles that are %v long can not be combined into candles that are %v long)",
+				ErrInvalidSweep, length, interval)
+		}
+		series[interval] = Resample(candles, interval)
+	}
+	candlesOf := func(cfg Config) []core.OHLC {
+		if resampled, ok := series[cfg.Interval]; ok {
+			return resampled
+		}
+		return candles
+	}
+	opt = Optimization{Plugin: sweep.Base.Plugin, Asset: sweep.Base.Asset, Objective: sweep.Objective}
+	if cut := len(candles) - int(float64(len(candles))*sweep.Holdout); cut < len(candles) {
+		opt.HoldoutFrom = candles[cut].Time
+	}
+
+	configs := sweep.combinations()
+	summaries, errs := make([]*Summary, len(configs)), make([]error, len(configs))
+	for start := 0; start < len(configs); {
+		// The combinations with the same pattern thresholds are backtested at the same time.
+		end := start + 1
+		for end < len(configs) && configs[end].Overrides.Patterns == configs[start].Overrides.Patterns {
+			end++
+		}
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < sweep.Workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					result, err := Run(configs[i], before(candlesOf(configs[i]), opt.HoldoutFrom))
+					if summaries[i], errs[i] = &result.Summary, err; err != nil {
+						summaries[i] = nil
+					}
+				}
+			}()
+		}
+		for i := start; i < end; i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		start = end
+	}
+
+	opt.Tested = len(configs)
+	var firstErr error
+	for i, summary := range summaries {
+		if summary == nil {
+			opt.Failed++
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		opt.Best = append(opt.Best, Candidate{Config: configs[i], Score: sweep.score(*summary), InSample: *summary})
+	}
+	if len(opt.Best) == 0 {
+		return opt, firstErr
+	}
+	sort.SliceStable(opt.Best, func(i, j int) bool { return opt.Best[i].Score > opt.Best[j].Score })
+	if len(opt.Best) > sweep.Top {
+		opt.Best = opt.Best[:sweep.Top]
+	}
+	for i := range opt.Best {
+		c := &opt.Best[i]
+		if !opt.HoldoutFrom.IsZero() {
+			cfg := c.Config
+			cfg.Start = opt.HoldoutFrom
+			if result, err := Run(cfg, candlesOf(cfg)); err == nil {
+				c.OutOfSample = &result.Summary
+			} else {
+				c.Warnings = append(c.Warnings, fmt.Sprintf("it could not be backtested on the held-out candles: %v", err))
+			}
+		}
+		c.Warnings = append(c.Warnings, sweep.warnings(*c)...)
+	}
+	if opt.HoldoutFrom.IsZero() {
+		opt.Warnings = append(opt.Warnings, "no candles were held out, so the best configurations were not tried on prices they were not chosen on")
+	}
+	if opt.Tested > len(candles)/10 {
+		opt.Warnings = append(opt.Warnings, fmt.Sprintf("%d configurations were tested on %d candles. The more are tested, "+
+			"the likelier the best ones only fit noise", opt.Tested, len(candles)))
+	}
+	return opt, nil
+}
+
+// warnings returns the signs that the candidate is overfitted.
+func (s Sweep) warnings(c Candidate) (warnings []string) {
+	if c.InSample.Trades < minTrades {
+		warnings = append(warnings, fmt.Sprintf("only %d trades were made, too few to tell skill from luck", c.InSample.Trades))
+	}
+	if out := c.OutOfSample; out != nil {
+		switch {
+		case c.InSample.ReturnPct > 0 && out.ReturnPct <= 0:
+			warnings = append(warnings, fmt.Sprintf("it returned %.2f%% on the held-out candles, after %.2f%% on the others",
+				out.ReturnPct, c.InSample.ReturnPct))
+		case c.Score > 0 && s.score(*out) < c.Score/2:
+			warnings = append(warnings, fmt.Sprintf("its %s fell from %.2f to %.2f on the held-out candles",
+				s.Objective, c.Score, s.score(*out)))
+		}
+	}
+	g, cfg := s.Grid, c.Config
+	edges := map[string]bool{
+		"profit margin":         atEdge(cfg.ProfitMargin, g.ProfitMargins...),
+		"interval":              atEdge(float64(cfg.Interval), durations(g.Intervals)...),
+		"analysis period":       atEdge(float64(cfg.Overrides.AnalysisPeriod), hours(g.AnalysisPeriods)...),
+		"moving average window": atEdge(float64(cfg.Overrides.MovingAverageWindow), windows(g.MovingAverageWindows)...),
+	}
+	names := make([]string, 0, len(edges))
+	for name, edge := range edges {
+		if edge {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		warnings = append(warnings, fmt.Sprintf("its %s is at the edge of the range tested, so a better one may lie outside it", name))
+	}
+	return
+}
+
+// atEdge reports whether `value` is the smallest or largest of at least three `values`.
+func atEdge(value float64, values ...float64) bool {
+	if len(values) < 3 {
+		return false
+	}
+	low, high := values[0], values[0]
+	for _, v := range values {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+	return value == low || value == high
+}
+
+func durations(values []time.Duration) []float64 {
+	floats := make([]float64, len(values))
+	for i, v := range values {
+		floats[i] = float64(v)
+	}
+	return floats
+}
+
+func hours(values []time.Duration) []float64 {
+	floats := make([]float64, len(values))
+	for i, v := range values {
+		floats[i] = float64(v / time.Hour)
+	}
+	return floats
+}
+
+func windows(values []int) []float64 {
+	floats := make([]float64, len(values))
+	for i, v := range values {
+		floats[i] = float64(v)
+	}
+	return floats
+}
+
+// before returns the candles, ordered from the earliest, that began before `t`, or all of them if `t` is zero.
+func before(candles []core.OHLC, t time.Time) []core.OHLC {
+	if t.IsZero() {
+		return candles
+	}
+	end := sort.Search(len(candles), func(i int) bool { return !candles[i].Time.Before(t) })
+	return candles[:end]
+}
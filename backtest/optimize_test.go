@@ -0,0 +1,111 @@
+package backtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptimize(t *testing.T) {
+	candles := repeated(4)
+	margins := []float64{0, 0.05, 0.5}
+	returns := map[float64]float64{}
+	for _, margin := range margins {
+		cfg := testConfig()
+		cfg.ProfitMargin = margin
+		result, err := Run(cfg, candles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		returns[margin] = result.Summary.ReturnPct
+	}
+	// Taking profit at 5% locks in the rise of the second candle of each run up, which the other margins give back.
+	if returns[0.05] <= returns[0] || returns[0.05] <= returns[0.5] {
+		t.Fatalf("the returns of the margins are %v, want the 5%% margin to return the most", returns)
+	}
+
+	for _, test := range []struct {
+		name    string
+		holdout float64
+	}{
+		{"every candle", 0},
+		{"held out", 0.25},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sweep := Sweep{Base: testConfig(), Grid: Grid{ProfitMargins: margins}, Objective: ObjectiveReturn,
+				Holdout: test.holdout, Top: 2}
+			opt, err := Optimize(sweep, candles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opt.Tested != 3 || opt.Failed != 0 || len(opt.Best) != 2 {
+				t.Fatalf("tested %d configurations (%d failed) and kept %d, want 3 tested and the best 2", opt.Tested,
+					opt.Failed, len(opt.Best))
+			}
+			best := opt.Best[0]
+			if best.Config.ProfitMargin != 0.05 || best.Score != best.InSample.ReturnPct || opt.Best[1].Score > best.Score {
+				t.Errorf("the best configurations are %+v, want the 5%% margin first, ranked by return", opt.Best)
+			}
+			if test.holdout == 0 {
+				if best.Score != returns[0.05] || best.OutOfSample != nil || !opt.HoldoutFrom.IsZero() {
+					t.Errorf("the best configuration returned %v on every candle, want %v", best.Score, returns[0.05])
+				}
+				if !contains(opt.Warnings, "no candles were held out") {
+					t.Errorf("the warnings are %q, want one that no candles were held out", opt.Warnings)
+				}
+			} else if !opt.HoldoutFrom.Equal(candles[18].Time) || best.OutOfSample == nil {
+				t.Errorf("the candles from %v were held out (%+v), want the last 6", opt.HoldoutFrom, best.OutOfSample)
+			}
+			if runnerUp := opt.Best[1]; !contains(runnerUp.Warnings, "at the edge of the range") {
+				t.Errorf("the warnings of the runner-up are %q, want one that its margin is at the edge of the range", runnerUp.Warnings)
+			}
+		})
+	}
+}
+
+func TestOptimizeErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		sweep Sweep
+	}{
+		{"objective", Sweep{Base: testConfig(), Objective: "luck"}},
+		{"holdout", Sweep{Base: testConfig(), Holdout: 0.6}},
+		{"profit margin", Sweep{Base: testConfig(), Grid: Grid{ProfitMargins: []float64{1}}}},
+		{"analysis period", Sweep{Base: testConfig(), Grid: Grid{AnalysisPeriods: []time.Duration{90 * time.Minute}}}},
+		{"interval", Sweep{Base: testConfig(), Grid: Grid{Intervals: []time.Duration{90 * time.Minute}}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Optimize(test.sweep, repeated(2)); !errors.Is(err, ErrInvalidSweep) {
+				t.Errorf("Optimize() returned %v, want ErrInvalidSweep", err)
+			}
+		})
+	}
+}
+
+func TestAtEdge(t *testing.T) {
+	for _, test := range []struct {
+		value  float64
+		values []float64
+		want   bool
+	}{
+		{1, []float64{1, 2}, false},
+		{1, []float64{2, 1, 3}, true},
+		{3, []float64{2, 1, 3}, true},
+		{2, []float64{2, 1, 3}, false},
+	} {
+		if got := atEdge(test.value, test.values...); got != test.want {
+			t.Errorf("atEdge(%v, %v) = %v, want %v", test.value, test.values, got, test.want)
+		}
+	}
+}
+
+// contains reports whether any of `lines` contains `s`.
+func contains(lines []string, s string) bool {
+	for _, line := range lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
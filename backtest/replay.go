@@ -0,0 +1,165 @@
+package backtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/michaellormann/leprechaun/core"
+)
+
+// ErrInvalidResult is returned when a saved backtest result can not be replayed.
+var ErrInvalidResult = errors.New("invalid backtest result")
+
+// Kinds of the events of a replay.
+const (
+	EventSignal = "signal"
+	EventEntry  = "entry"
+	EventExit   = "exit"
+)
+
+// ReplayEvent is a decision shown by a replay: a signal, an order that opened a position or one that closed it.
+type ReplayEvent struct {
+	Time       time.Time
+	Kind       string
+	Signal     core.SIGNAL `json:",omitempty"`
+	Confidence float64     `json:",omitempty"`
+	Price      float64     `json:",omitempty"`
+	// Profit is the fiat profit of the position an exit closed.
+	Profit float64 `json:",omitempty"`
+	Detail string
+}
+
+// Replay holds candles and the decisions taken on them, ordered from the earliest, so a backtest or a
+// past live session can be stepped through.
+type Replay struct {
+	Title   string
+	Candles []core.OHLC
+	Events  []ReplayEvent
+}
+
+// EventsOf returns the events that happened during the candle at index `i`.
+func (r Replay) EventsOf(i int) (events []ReplayEvent) {
+	if i < 0 || i >= len(r.Candles) {
+		return nil
+	}
+	start, end := r.Candles[i].Time, time.Time{}
+	if i+1 < len(r.Candles) {
+		end = r.Candles[i+1].Time
+	}
+	for _, event := range r.Events {
+		if !event.Time.Before(start) && (end.IsZero() || event.Time.Before(end)) {
+			events = append(events, event)
+		}
+	}
+	return
+}
+
+// NextEvent returns the index of the first candle after the candle at index `i` that has events, or -1
+// if there is none.
+func (r Replay) NextEvent(i int) int {
+	for j := i + 1; j < len(r.Candles); j++ {
+		if len(r.EventsOf(j)) > 0 {
+			return j
+		}
+	}
+	return -1
+}
+
+// sortEvents orders the events from the earliest. Events at the same time keep their order.
+func (r *Replay) sortEvents() {
+	sort.SliceStable(r.Events, func(i, j int) bool { return r.Events[i].Time.Before(r.Events[j].Time) })
+}
+
+// LoadResult reads the result of a backtest written as JSON, e.g. by the backtest command's -json flag.
+func LoadResult(r io.Reader) (result Result, err error) {
+	if err = json.NewDecoder(r).Decode(&result); err != nil {
+		return result, fmt.Errorf("%w (%v)", ErrInvalidResult, err)
+	}
+	if len(result.Steps) == 0 {
+		return result, fmt.Errorf("%w (the result has no steps to replay)", ErrInvalidResult)
+	}
+	return result, nil
+}
+
+// ResultReplay returns the replay of a backtest.
+func ResultReplay(result Result) (replay Replay) {
+	replay.Title = fmt.Sprintf("Backtest of %s on %s", result.Plugin, result.Asset)
+	for _, step := range result.Steps {
+		replay.Candles = append(replay.Candles, core.NewOHLC(step.Time, result.Interval, step.Open, step.High, step.Low, step.Close, 0))
+		if step.Signal != "" && step.Signal != core.SignalWait {
+			replay.Events = append(replay.Events, ReplayEvent{Time: step.Time, Kind: EventSignal, Signal: step.Signal,
+				Confidence: step.Confidence, Detail: fmt.Sprintf("%s signal, %.0f%% confidence", step.Signal, step.Confidence*100)})
+		}
+	}
+	for _, trade := range result.Trades {
+		replay.Events = append(replay.Events,
+			ReplayEvent{Time: trade.EntryTime, Kind: EventEntry, Signal: trade.Side, Price: trade.EntryPrice,
+				Detail: fmt.Sprintf("Opened a %s position of %.6f %s at %.2f", trade.Side, trade.Volume, result.Asset, trade.EntryPrice)},
+			ReplayEvent{Time: trade.ExitTime, Kind: EventExit, Signal: trade.Side, Price: trade.ExitPrice, Profit: trade.Profit,
+				Detail: fmt.Sprintf("Closed the %s position at %.2f for a profit of %.2f (%.2f%%)", trade.Side,
+					trade.ExitPrice, trade.Profit, trade.ReturnPct())})
+	}
+	replay.sortEvents()
+	return
+}
+
+// SessionReplay returns the replay of the live trading of `asset` in `currency` from `from` up to `to`.
+// The candles are read from the candle database, the signals and entries from the round events file and
+// the exits from the saved sales and purchases, so round events must have been written.
+func SessionReplay(asset, currency string, interval time.Duration, from, to time.Time) (replay Replay, err error) {
+	replay.Title = fmt.Sprintf("%s from %s to %s", asset, from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"))
+	if replay.Candles, err = core.StoredCandles(asset+currency, interval, from, to); err != nil {
+		return
+	}
+	if len(replay.Candles) == 0 {
+		return replay, fmt.Errorf("%w (no candles of %s were saved in this period)", ErrNotEnoughCandles, asset)
+	}
+	within := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+	if file, e := os.Open(core.RoundEventsPath()); e == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			evt := core.RoundEvent{}
+			if json.Unmarshal(scanner.Bytes(), &evt) != nil || evt.Asset != asset || !within(evt.Time) {
+				continue
+			}
+			if evt.Signal != "" && evt.Signal != core.SignalWait {
+				replay.Events = append(replay.Events, ReplayEvent{Time: evt.Time, Kind: EventSignal, Signal: evt.Signal,
+					Confidence: evt.Confidence, Price: evt.Price,
+					Detail: fmt.Sprintf("%s signal at %.2f, %.0f%% confidence", evt.Signal, evt.Price, evt.Confidence*100)})
+			}
+			if evt.Action == core.ActionLong || evt.Action == core.ActionShort {
+				replay.Events = append(replay.Events, ReplayEvent{Time: evt.Time, Kind: EventEntry, Signal: evt.Signal,
+					Price: evt.Price, Detail: fmt.Sprintf("Opened a %s position of %.6f %s at %.2f (%s)", evt.Action,
+						evt.Volume, asset, evt.Price, evt.RecordID)})
+			}
+		}
+		file.Close()
+	}
+	// Longs are closed by selling and shorts by buying back.
+	exits := func(entries []*core.ProfitEntry, side core.SIGNAL) {
+		for _, entry := range entries {
+			closed, e := entry.Time()
+			if entry.Asset != asset || e != nil || !within(closed) {
+				continue
+			}
+			price := entry.SalePrice
+			if side == core.SignalShort {
+				price = entry.PurchasePrice
+			}
+			replay.Events = append(replay.Events, ReplayEvent{Time: closed, Kind: EventExit, Signal: side, Price: price, Profit: entry.Profit,
+				Detail: fmt.Sprintf("Closed the %s position %s at %.2f for a profit of %.2f", side, entry.OrderID, price, entry.Profit)})
+		}
+	}
+	sales, _ := core.GetSales()
+	purchases, _ := core.GetPurchases()
+	exits(sales, core.SignalLong)
+	exits(purchases, core.SignalShort)
+	replay.sortEvents()
+	return replay, nil
+}
@@ -0,0 +1,68 @@
+package backtest
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// year is the length of a year the ratios of a backtest are annualized over. Crypto markets never close.
+const year = 365 * 24 * time.Hour
+
+// EquityPoint is the value of the account of a backtest at a time.
+type EquityPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// report completes the summary with the statistics of the trades and of the account's value over time.
+func (s *Summary) report(cfg Config, trades []Trade, equity []EquityPoint) {
+	s.VsBuyAndHoldPct = s.ReturnPct - s.BuyAndHoldPct
+	s.FeeDragPct = s.TotalFees / cfg.StartingBalance * 100
+	if len(trades) > 0 {
+		var held time.Duration
+		for _, trade := range trades {
+			held += trade.ExitTime.Sub(trade.EntryTime)
+		}
+		s.AverageHolding = held / time.Duration(len(trades))
+	}
+	s.SharpeRatio, s.SortinoRatio = ratios(cfg.StartingBalance, equity, cfg.Interval)
+}
+
+// ratios returns the annualized Sharpe and Sortino ratios of the returns of each candle, with no
+// risk-free return. They are zero if the returns do not vary.
+func ratios(start float64, equity []EquityPoint, interval time.Duration) (sharpe, sortino float64) {
+	if len(equity) < 2 || interval <= 0 {
+		return
+	}
+	returns := make([]float64, len(equity))
+	previous, mean := start, 0.0
+	for i, point := range equity {
+		if previous > 0 {
+			returns[i] = point.Value/previous - 1
+		}
+		previous = point.Value
+		mean += returns[i]
+	}
+	mean /= float64(len(returns))
+	var variance, downside float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	periods := math.Sqrt(float64(year / interval))
+	if deviation := math.Sqrt(variance / float64(len(returns))); deviation > 0 {
+		sharpe = mean / deviation * periods
+	}
+	if deviation := math.Sqrt(downside / float64(len(returns))); deviation > 0 {
+		sortino = mean / deviation * periods
+	}
+	return
+}
+
+// JSON returns the result as indented JSON, e.g. for the UI.
+func (r Result) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
@@ -0,0 +1,160 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/michaellormann/leprechaun/core"
+)
+
+// Scenarios a synthetic price series can follow.
+const (
+	// ScenarioTrending drifts steadily in one direction, up if the drift is positive and down if negative.
+	ScenarioTrending = "trending"
+	// ScenarioMeanReverting wanders around the starting price and is pulled back towards it.
+	ScenarioMeanReverting = "mean-reverting"
+	// ScenarioChoppy swings up and down in short cycles without a trend, so trends reverse before they pay.
+	ScenarioChoppy = "choppy"
+	// ScenarioFlashCrash wanders until the price suddenly falls in a single candle, then recovers half the fall.
+	ScenarioFlashCrash = "flash-crash"
+)
+
+// Scenarios lists the scenarios a synthetic price series can follow.
+var Scenarios = []string{ScenarioTrending, ScenarioMeanReverting, ScenarioChoppy, ScenarioFlashCrash}
+
+// Synthetic holds the settings of a synthetic price series. Series with the same settings are the same,
+// so strategies can be backtested on edge conditions that may be missing from the saved candles, and
+// plugins can be checked against known markets. Fields that are zero take their defaults.
+type Synthetic struct {
+	// Scenario is the scenario the series follows.
+	Scenario string
+	// Start is the time the first candle began. Zero starts it at midnight UTC on 1 January 2020.
+	Start time.Time
+	// Interval is the length of the candles. Zero makes hourly candles.
+	Interval time.Duration
+	// Candles is the number of candles. Zero makes 1000.
+	Candles int
+	// Price is the price the series starts at. Zero starts it at 10000.
+	Price float64
+	// Volatility is the standard deviation of the return of each candle. Zero makes it 0.01.
+	Volatility float64
+	// Drift is the mean return of each candle of a trending series. Zero makes it 0.002.
+	Drift float64
+	// Reversion is the fraction of its distance from the starting price a mean-reverting series recovers
+	// in each candle. Zero makes it 0.1.
+	Reversion float64
+	// Cycle is the number of candles of a swing of a choppy series, up and down. Zero makes it 12.
+	Cycle int
+	// Crash is the fraction of the price a flash crash falls by. Zero makes it 0.3.
+	Crash float64
+	// CrashAt is the index of the candle of a flash crash. Zero crashes the candle halfway through the series.
+	CrashAt int
+	// Recovery is the number of candles a flash crash takes to recover half its fall. Zero makes it 24.
+	Recovery int
+	// Seed seeds the random moves of the candles. Zero seeds them with 1.
+	Seed int64
+}
+
+// Generate returns the candles of the series, ordered from the earliest.
+func (s Synthetic) Generate() ([]core.OHLC, error) {
+	if err := s.defaults(); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(s.Seed))
+	closes := make([]float64, s.Candles)
+	logPrice, mean := math.Log(s.Price), math.Log(s.Price)
+	for i := range closes {
+		noise := rng.NormFloat64() * s.Volatility
+		switch s.Scenario {
+		case ScenarioTrending:
+			logPrice += s.Drift + noise
+		case ScenarioMeanReverting:
+			logPrice += s.Reversion*(mean-logPrice) + noise
+		case ScenarioChoppy:
+			// The swings are several times wider than the noise, so they dominate it.
+			swing := 5 * s.Volatility * math.Sin(2*math.Pi*float64(i)/float64(s.Cycle))
+			logPrice = mean + swing + noise
+		case ScenarioFlashCrash:
+			logPrice += noise
+			switch {
+			case i == s.CrashAt:
+				logPrice += math.Log(1 - s.Crash)
+			case i > s.CrashAt && i <= s.CrashAt+s.Recovery:
+				// Half the fall is made up in equal steps.
+				logPrice -= math.Log(1-s.Crash) / 2 / float64(s.Recovery)
+			}
+		}
+		closes[i] = math.Exp(logPrice)
+	}
+	candles := make([]core.OHLC, s.Candles)
+	open := s.Price
+	for i, closing := range closes {
+		high := math.Max(open, closing) * (1 + math.Abs(rng.NormFloat64())*s.Volatility/2)
+		low := math.Min(open, closing) * (1 - math.Abs(rng.NormFloat64())*s.Volatility/2)
+		volume := 10 * (1 + math.Abs(rng.NormFloat64()))
+		if s.Scenario == ScenarioFlashCrash && i == s.CrashAt {
+			// Panic selling overshoots the close and trades heavily.
+			low, volume = math.Min(low, closing*(1-s.Crash/5)), volume*10
+		}
+		candles[i] = core.NewOHLC(s.Start.Add(time.Duration(i)*s.Interval), s.Interval, open, high, low, closing, volume)
+		open = closing
+	}
+	return candles, nil
+}
+
+// defaults sets the fields that are zero to their defaults and checks the others are in range.
+func (s *Synthetic) defaults() error {
+	known := false
+	for _, scenario := range Scenarios {
+		known = known || s.Scenario == scenario
+	}
+	switch {
+	case !known:
+		return fmt.Errorf("%w (unknown scenario %q, use one of %v)", ErrInvalidConfig, s.Scenario, Scenarios)
+	case s.Interval < 0 || s.Candles < 0 || s.Price < 0 || s.Volatility < 0 || s.Reversion < 0 || s.Reversion > 1 ||
+		s.Cycle < 0 || s.Crash < 0 || s.Crash >= 1 || s.CrashAt < 0 || s.Recovery < 0:
+		return fmt.Errorf("%w (the settings of the synthetic series are out of range: %+v)", ErrInvalidConfig, *s)
+	}
+	if s.Start.IsZero() {
+		s.Start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if s.Interval == 0 {
+		s.Interval = time.Hour
+	}
+	if s.Candles == 0 {
+		s.Candles = 1000
+	}
+	if s.Price == 0 {
+		s.Price = 10000
+	}
+	if s.Volatility == 0 {
+		s.Volatility = 0.01
+	}
+	if s.Drift == 0 {
+		s.Drift = 0.002
+	}
+	if s.Reversion == 0 {
+		s.Reversion = 0.1
+	}
+	if s.Cycle == 0 {
+		s.Cycle = 12
+	}
+	if s.Crash == 0 {
+		s.Crash = 0.3
+	}
+	if s.CrashAt == 0 {
+		s.CrashAt = s.Candles / 2
+	}
+	if s.Recovery == 0 {
+		s.Recovery = 24
+	}
+	if s.Seed == 0 {
+		s.Seed = 1
+	}
+	if s.CrashAt >= s.Candles {
+		return fmt.Errorf("%w (the crash at candle %d is after the last of %d candles)", ErrInvalidConfig, s.CrashAt, s.Candles)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/michaellormann/leprechaun/core"
+)
+
+// WalkForward holds the settings of a walk-forward analysis. The candles of a training window are swept
+// for the best configuration, which is then backtested on the validation window that follows it. Both
+// windows then roll forward, until the candles run out. Unlike a single sweep, every validation window is
+// traded with parameters chosen on earlier candles only, as they would be when trading live.
+type WalkForward struct {
+	// Sweep is the sweep run on each training window. Its holdout is not used.
+	Sweep Sweep
+	// Training and Validation are the lengths of the training and validation windows.
+	Training, Validation time.Duration
+	// Step is how far the windows roll forward each time. Zero rolls them forward by the validation window,
+	// so the validation windows follow each other.
+	Step time.Duration
+}
+
+// Fold is one training window and the validation window that follows it.
+type Fold struct {
+	TrainFrom, ValidateFrom, ValidateTo time.Time
+	// Best is the best configuration on the training window.
+	Best Candidate
+	// Validation summarizes the backtest of the best configuration on the validation window.
+	Validation Summary
+	// Score is the objective of the sweep on the validation window.
+	Score float64
+	// Err is the reason the fold could not be completed, e.g. too few candles. The other fields are then empty.
+	Err string `json:",omitempty"`
+}
+
+// WalkForwardResult holds the folds of a walk-forward analysis and how well the parameters held up.
+type WalkForwardResult struct {
+	Plugin, Asset string
+	Objective     string
+	Folds         []Fold
+	// ReturnPct is the return of trading every validation window in turn, compounded.
+	ReturnPct float64
+	// Profitable is the number of folds that made a profit on their validation window.
+	Profitable int
+	// TrainingScore and ValidationScore are the mean objectives of the completed folds.
+	TrainingScore, ValidationScore float64
+	// Efficiency is the mean validation objective as a fraction of the mean training objective. Parameters
+	// that generalize keep at least half of it. It is zero if the training objective is not positive.
+	Efficiency float64
+	// Changes is the number of folds whose best configuration differs from the previous fold's.
+	Changes int
+	// Warnings are signs that the parameters do not generalize.
+	Warnings []string
+}
+
+// String summarizes each fold in a line, followed by the totals and warnings.
+func (r WalkForwardResult) String() string {
+	lines := []string{fmt.Sprintf("Walk-forward analysis of %s on %s, ranked by %s:", r.Plugin, r.Asset, r.Objective)}
+	for i, fold := range r.Folds {
+		if fold.Err != "" {
+			lines = append(lines, fmt.Sprintf("%d. %s to %s: %s", i+1, fold.TrainFrom.Format("2006-01-02"),
+				fold.ValidateTo.Format("2006-01-02"), fold.Err))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%d. trained from %s, validated %s to %s: %s. %s %.2f -> %.2f, return %.2f%% -> %.2f%% (%d trades)",
+			i+1, fold.TrainFrom.Format("2006-01-02"), fold.ValidateFrom.Format("2006-01-02"), fold.ValidateTo.Format("2006-01-02"),
+			fold.Best.Config.describe(), r.Objective, fold.Best.Score, fold.Score, fold.Best.InSample.ReturnPct,
+			fold.Validation.ReturnPct, fold.Validation.Trades))
+	}
+	lines = append(lines, fmt.Sprintf("Validation return: %.2f%%. %d of %d folds were profitable. Efficiency: %.0f%%. "+
+		"The best configuration changed %d times.", r.ReturnPct, r.Profitable, len(r.Folds), r.Efficiency*100, r.Changes))
+	for _, warning := range r.Warnings {
+		lines = append(lines, "Warning: "+warning)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RunWalkForward runs the walk-forward analysis set in `wf` on `candles`, ordered from the earliest.
+func RunWalkForward(wf WalkForward, candles []core.OHLC) (result WalkForwardResult, err error) {
+	if wf.Training <= 0 || wf.Validation <= 0 || wf.Step < 0 {
+		return result, fmt.Errorf("%w (training window %v, validation window %v, step %v)", ErrInvalidSweep,
+			wf.Training, wf.Validation, wf.Step)
+	}
+	if wf.Step == 0 {
+		wf.Step = wf.Validation
+	}
+	sweep := wf.Sweep
+	sweep.Holdout, sweep.Top = 0, 1
+	if err = sweep.validate(); err != nil {
+		return
+	}
+	if sweep.Objective == "" {
+		sweep.Objective = ObjectiveSharpe
+	}
+	if len(candles) == 0 || candles[len(candles)-1].Time.Sub(candles[0].Time) < wf.Training+wf.Validation {
+		return result, fmt.Errorf("%w (the candles do not cover a training and a validation window)", ErrNotEnoughCandles)
+	}
+	result = WalkForwardResult{Plugin: sweep.Base.Plugin, Asset: sweep.Base.Asset, Objective: sweep.Objective}
+	last := candles[len(candles)-1].Time
+	growth, completed := 1.0, 0
+	var previous *Config
+	for from := candles[0].Time; !from.Add(wf.Training + wf.Validation).After(last); from = from.Add(wf.Step) {
+		fold := Fold{TrainFrom: from, ValidateFrom: from.Add(wf.Training), ValidateTo: from.Add(wf.Training + wf.Validation)}
+		if err := fold.run(sweep, between(candles, fold.TrainFrom, fold.ValidateTo)); err != nil {
+			fold.Err = err.Error()
+			result.Folds = append(result.Folds, fold)
+			continue
+		}
+		completed++
+		growth *= 1 + fold.Validation.ReturnPct/100
+		if fold.Validation.NetProfit > 0 {
+			result.Profitable++
+		}
+		result.TrainingScore += fold.Best.Score
+		result.ValidationScore += fold.Score
+		if previous != nil && *previous != fold.Best.Config {
+			result.Changes++
+		}
+		previous = &fold.Best.Config
+		result.Folds = append(result.Folds, fold)
+	}
+	if completed == 0 {
+		return result, fmt.Errorf("%w (no fold could be completed: %s)", ErrNotEnoughCandles, result.Folds[0].Err)
+	}
+	result.ReturnPct = (growth - 1) * 100
+	result.TrainingScore /= float64(completed)
+	result.ValidationScore /= float64(completed)
+	if result.TrainingScore > 0 {
+		result.Efficiency = math.Max(result.ValidationScore/result.TrainingScore, 0)
+	}
+	result.Warnings = result.warnings(completed)
+	return result, nil
+}
+
+// run sweeps the training window of the fold and backtests the best configuration on its validation
+// window. `candles` cover both windows.
+func (fold *Fold) run(sweep Sweep, candles []core.OHLC) error {
+	opt, err := Optimize(sweep, before(candles, fold.ValidateFrom))
+	if err != nil {
+		return err
+	}
+	fold.Best = opt.Best[0]
+	cfg := fold.Best.Config
+	cfg.Start = fold.ValidateFrom
+	// The training window supplies the candles analyzed at the start of the validation window.
+	validation, err := Run(cfg, Resample(candles, cfg.Interval))
+	if err != nil {
+		return err
+	}
+	fold.Validation, fold.Score = validation.Summary, sweep.score(validation.Summary)
+	return nil
+}
+
+// warnings returns the signs that the parameters do not generalize.
+func (r WalkForwardResult) warnings(completed int) (warnings []string) {
+	if completed < 3 {
+		warnings = append(warnings, fmt.Sprintf("only %d folds were completed, too few to judge the parameters", completed))
+	}
+	if r.TrainingScore > 0 && r.Efficiency < 0.5 {
+		warnings = append(warnings, fmt.Sprintf("the validation windows kept only %.0f%% of the training %s, "+
+			"so the parameters mostly fit the training windows", r.Efficiency*100, r.Objective))
+	}
+	if r.Profitable*2 < completed {
+		warnings = append(warnings, fmt.Sprintf("only %d of %d validation windows were profitable", r.Profitable, completed))
+	}
+	if completed > 2 && r.Changes*2 > completed-1 {
+		warnings = append(warnings, fmt.Sprintf("the best configuration changed in %d of %d folds, so no parameter set "+
+			"stays best for long", r.Changes, completed-1))
+	}
+	return
+}
+
+// between returns the candles, ordered from the earliest, that began from `from` up to, but not including, `to`.
+func between(candles []core.OHLC, from, to time.Time) []core.OHLC {
+	candles = before(candles, to)
+	for len(candles) > 0 && candles[0].Time.Before(from) {
+		candles = candles[1:]
+	}
+	return candles
+}
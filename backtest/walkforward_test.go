@@ -0,0 +1,75 @@
+package backtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunWalkForward(t *testing.T) {
+	wf := WalkForward{
+		Sweep:    Sweep{Base: testConfig(), Grid: Grid{ProfitMargins: []float64{0, 0.05, 0.5}}, Objective: ObjectiveReturn},
+		Training: 12 * time.Hour, Validation: 6 * time.Hour,
+	}
+	// The test candles repeat every 6 hours, so each fold trains and validates on the same prices.
+	candles := repeated(8)
+	result, err := RunWalkForward(wf, candles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The folds start every 6 hours until the last one ends at the last candle, 47 hours in.
+	if len(result.Folds) != 5 {
+		t.Fatalf("the analysis has %d folds, want 5", len(result.Folds))
+	}
+	// Each validation window takes 5% on the first two candles, buys at 105 what is sold at 90 and takes 5% on
+	// the last candle.
+	validation := (1.05*1.05*90/105*1.05 - 1) * 100
+	growth := 1.0
+	for i, fold := range result.Folds {
+		if fold.Err != "" {
+			t.Fatalf("fold %d failed: %s", i+1, fold.Err)
+		}
+		from := testStart.Add(time.Duration(6*i) * time.Hour)
+		if !fold.TrainFrom.Equal(from) || !fold.ValidateFrom.Equal(from.Add(12*time.Hour)) || !fold.ValidateTo.Equal(from.Add(18*time.Hour)) {
+			t.Errorf("fold %d trains from %v and validates %v to %v, want the windows from %v", i+1, fold.TrainFrom,
+				fold.ValidateFrom, fold.ValidateTo, from)
+		}
+		if fold.Best.Config.ProfitMargin != 0.05 || !near(fold.Validation.ReturnPct, validation) || fold.Score != fold.Validation.ReturnPct {
+			t.Errorf("fold %d chose %+v and returned %v%%, want the 5%% margin to return %v%%", i+1, fold.Best.Config,
+				fold.Validation.ReturnPct, validation)
+		}
+		growth *= 1 + fold.Validation.ReturnPct/100
+	}
+	if !near(result.ReturnPct, (growth-1)*100) {
+		t.Errorf("the validation return is %v%%, want the compounded return of the folds, %v%%", result.ReturnPct, (growth-1)*100)
+	}
+	if result.Changes != 0 || result.Profitable != 0 || !near(result.ValidationScore, validation) {
+		t.Errorf("the best configuration changed %d times, %d folds were profitable and they scored %v, want no changes "+
+			"and no profitable folds", result.Changes, result.Profitable, result.ValidationScore)
+	}
+	// The training windows lose money too, so the efficiency is not measured.
+	if result.TrainingScore >= 0 || result.Efficiency != 0 || !contains(result.Warnings, "only 0 of 5 validation windows were profitable") {
+		t.Errorf("the training score is %v, the efficiency %v and the warnings %q, want a loss, no efficiency and a "+
+			"warning about the losing folds", result.TrainingScore, result.Efficiency, result.Warnings)
+	}
+}
+
+func TestRunWalkForwardErrors(t *testing.T) {
+	sweep := Sweep{Base: testConfig()}
+	for _, test := range []struct {
+		name string
+		wf   WalkForward
+		want error
+	}{
+		{"no validation window", WalkForward{Sweep: sweep, Training: time.Hour}, ErrInvalidSweep},
+		{"negative step", WalkForward{Sweep: sweep, Training: time.Hour, Validation: time.Hour, Step: -time.Hour}, ErrInvalidSweep},
+		{"windows longer than the candles", WalkForward{Sweep: sweep, Training: 24 * time.Hour, Validation: 24 * time.Hour},
+			ErrNotEnoughCandles},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := RunWalkForward(test.wf, repeated(2)); !errors.Is(err, test.want) {
+				t.Errorf("RunWalkForward() returned %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+// Command backtest replays historic candles through one of Leprechaun's analysis plugins and prints the
+// trades it would have made and their statistics. It does not need the GUI, e.g.:
+//
+//	backtest -plugin hermes -asset XBT -days 30
+//	backtest -plugin ichimoku -asset ETH -file eth-hourly.csv -fee 0.001 -slippage 0.002
+//	backtest -asset XBT -file luno-trades.json -import
+//	backtest -asset XBT -days 90 -sweep-margins 0.01,0.02,0.05 -sweep-intervals 1h,4h -sweep-modes trend_following,contrarian
+//
+// Candles are read from the candle database in Leprechaun's data directory, or from a CSV or JSON file
+// of candles or trades (see the backtest package). The analysis options are read from the saved settings.
+// If any of the -sweep flags is given, every combination of their values is backtested and the best
+// configurations are printed instead. With -walk-train and -walk-validate, the sweep is run on rolling
+// training windows and its best configuration is validated on the window after each, e.g.:
+//
+//	backtest -asset XBT -days 180 -sweep-margins 0.02,0.04 -walk-train 720h -walk-validate 168h
+//
+// With -montecarlo, the candles are made into that many price series that could have happened instead,
+// and the spread of the outcomes of each purchase unit and margin given is printed, e.g.:
+//
+//	backtest -asset XBT -days 90 -montecarlo 500 -mc-units 5000,20000 -mc-margins 0.02,0.05
+//
+// With -synthetic, a made-up series that follows the scenario given is replayed instead of the saved
+// candles, so strategies can be tried on markets they have not met yet. The same seed makes the same series:
+//
+//	backtest -plugin hermes -synthetic flash-crash -seed 7
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michaellormann/leprechaun/backtest"
+	leprechaun "github.com/michaellormann/leprechaun/core"
+	_ "github.com/michaellormann/leprechaun/plugins" // Load analysis plugins
+)
+
+func main() {
+	configDir, _ := os.UserConfigDir()
+	dir := flag.String("dir", configDir, "the folder Leprechaun's data folder is in")
+	plugin := flag.String("plugin", "hermes", "the analysis plugin to test")
+	asset := flag.String("asset", "XBT", "the asset the candles are of")
+	currency := flag.String("currency", "", "the currency the asset is priced in (defaults to the currency in the settings)")
+	interval := flag.Duration("interval", 0, "the length of the candles (defaults to the interval of the plugin's options)")
+	days := flag.Int("days", 30, "the number of days of saved candles to replay, up to now")
+	file := flag.String("file", "", "replay the candles or trades in this CSV or JSON file instead of the saved candles")
+	save := flag.Bool("import", false, "save the candles of the file in the candle database")
+	balance := flag.Float64("balance", 100000, "the fiat balance the simulated account starts with")
+	unit := flag.Float64("unit", 0, "the amount of fiat spent on each entry (0 spends the whole balance)")
+	fee := flag.Float64("fee", 0.001, "the fee charged on each order, as a fraction of its value")
+	slippage := flag.Float64("slippage", 0.001, "how much worse than the next open orders fill, as a fraction of the price")
+	minVolume := flag.Float64("min-volume", 0, "the smallest order, in units of the asset, the exchange accepts")
+	short := flag.Bool("short", false, "let short signals open short positions")
+	margin := flag.Float64("margin", 0, "close positions once the price moves this fraction in their favour (0 closes them on signals only)")
+	trades := flag.Bool("trades", false, "print each trade")
+	asJSON := flag.Bool("json", false, "print the result as JSON")
+	margins := flag.String("sweep-margins", "", "comma-separated profit margins to sweep")
+	intervals := flag.String("sweep-intervals", "", "comma-separated intervals to sweep, e.g. 1h,4h")
+	periods := flag.String("sweep-periods", "", "comma-separated analysis periods to sweep, e.g. 24h,72h")
+	modes := flag.String("sweep-modes", "", "comma-separated trading modes to sweep: trend_following, contrarian")
+	windows := flag.String("sweep-windows", "", "comma-separated moving average windows to sweep")
+	objective := flag.String("objective", backtest.ObjectiveSharpe, "what a sweep ranks configurations by: sharpe, sortino or return")
+	holdout := flag.Float64("holdout", 0.3, "the share of the latest candles a sweep checks the best configurations on")
+	top := flag.Int("top", 5, "the number of best configurations a sweep prints")
+	train := flag.Duration("walk-train", 0, "the training window of a walk-forward analysis, e.g. 720h")
+	validate := flag.Duration("walk-validate", 0, "the validation window of a walk-forward analysis, e.g. 168h")
+	step := flag.Duration("walk-step", 0, "how far the windows of a walk-forward analysis roll forward (defaults to the validation window)")
+	runs := flag.Int("montecarlo", 0, "the number of price series a Monte Carlo simulation backtests on")
+	method := flag.String("mc-method", backtest.MethodBootstrap, "how the series are made up: bootstrap or perturb")
+	units := flag.String("mc-units", "", "comma-separated purchase units a Monte Carlo simulation compares")
+	mcMargins := flag.String("mc-margins", "", "comma-separated profit margins a Monte Carlo simulation compares")
+	seed := flag.Int64("seed", 0, "the seed of the random series (0 seeds Monte Carlo series with the time and synthetic series with 1)")
+	scenario := flag.String("synthetic", "", "replay a synthetic series instead of the saved candles: "+strings.Join(backtest.Scenarios, ", "))
+	syntheticCandles := flag.Int("synthetic-candles", 0, "the number of candles of the synthetic series (0 makes 1000)")
+	volatility := flag.Float64("synthetic-volatility", 0, "the standard deviation of the return of each synthetic candle (0 makes it 0.01)")
+	drift := flag.Float64("synthetic-drift", 0, "the mean return of each candle of a trending series, negative for a downtrend (0 makes it 0.002)")
+	flag.Parse()
+
+	config := new(leprechaun.Configuration)
+	if err := config.LoadConfig(*dir); err != nil {
+		log.Println("could not load saved settings. using default settings.")
+		if err = config.DefaultSettings(*dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Debug messages are sent to the UI, which is not running.
+	config.Debug = false
+	leprechaun.SetConfig(config)
+	for _, err := range leprechaun.PluginHandler.Discover(config.PluginDir()) {
+		log.Println(err)
+	}
+
+	if *currency == "" {
+		*currency = config.CurrencyCode
+	}
+	cfg := backtest.Config{Plugin: *plugin, Asset: strings.ToUpper(*asset), Interval: *interval,
+		StartingBalance: *balance, PurchaseUnit: *unit, Fee: *fee, Slippage: *slippage, MinVolume: *minVolume,
+		AllowShort: *short, ProfitMargin: *margin}
+	if cfg.Interval == 0 {
+		if analyzer, err := leprechaun.PluginHandler.Plugin(cfg.Plugin); err == nil {
+			cfg.Interval = leprechaun.ResolveAnalysisOptions(analyzer, cfg.Asset).Interval
+		}
+	}
+	pair := cfg.Asset + strings.ToUpper(*currency)
+
+	var (
+		candles []leprechaun.OHLC
+		err     error
+	)
+	switch {
+	case *scenario != "":
+		candles, err = backtest.Synthetic{Scenario: *scenario, Interval: cfg.Interval, Candles: *syntheticCandles,
+			Volatility: *volatility, Drift: *drift, Seed: *seed}.Generate()
+	case *file != "":
+		history, e := os.Open(filepath.Clean(*file))
+		if e != nil {
+			log.Fatal(e)
+		}
+		if *save {
+			candles, err = backtest.Import(pair, cfg.Interval, history, backtest.FormatOf(*file))
+		} else {
+			candles, err = backtest.Load(history, backtest.FormatOf(*file), cfg.Interval)
+		}
+		history.Close()
+	default:
+		now := time.Now()
+		candles, err = backtest.LoadStored(pair, cfg.Interval, now.AddDate(0, 0, -*days), now)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	grid := backtest.Grid{}
+	for _, field := range split(*margins) {
+		grid.ProfitMargins = append(grid.ProfitMargins, parseFloat(field))
+	}
+	for _, field := range split(*intervals) {
+		grid.Intervals = append(grid.Intervals, parseDuration(field))
+	}
+	for _, field := range split(*periods) {
+		grid.AnalysisPeriods = append(grid.AnalysisPeriods, parseDuration(field))
+	}
+	grid.Modes = split(*modes)
+	for _, field := range split(*windows) {
+		grid.MovingAverageWindows = append(grid.MovingAverageWindows, int(parseFloat(field)))
+	}
+	if *runs > 0 {
+		mc := backtest.MonteCarlo{Base: cfg, Runs: *runs, Method: *method, Seed: *seed}
+		for _, field := range split(*units) {
+			mc.PurchaseUnits = append(mc.PurchaseUnits, parseFloat(field))
+		}
+		for _, field := range split(*mcMargins) {
+			mc.ProfitMargins = append(mc.ProfitMargins, parseFloat(field))
+		}
+		result, err := backtest.RunMonteCarlo(mc, candles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *asJSON {
+			printJSON(result)
+		} else {
+			fmt.Println(result)
+		}
+		return
+	}
+	sweep := backtest.Sweep{Base: cfg, Grid: grid, Objective: *objective, Holdout: *holdout, Top: *top}
+	if *train > 0 || *validate > 0 {
+		result, err := backtest.RunWalkForward(backtest.WalkForward{Sweep: sweep, Training: *train, Validation: *validate,
+			Step: *step}, candles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *asJSON {
+			printJSON(result)
+		} else {
+			fmt.Println(result)
+		}
+		return
+	}
+	if grid.Size() > 1 {
+		opt, err := backtest.Optimize(sweep, candles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *asJSON {
+			printJSON(opt)
+		} else {
+			fmt.Println(opt)
+		}
+		return
+	}
+
+	result, err := backtest.Run(cfg, candles)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *asJSON {
+		printJSON(result)
+		return
+	}
+	if *trades {
+		for _, trade := range result.Trades {
+			fmt.Printf("%s -> %s  %-10s %.6f @ %.2f -> %.2f  profit %.2f (%.2f%%)\n",
+				trade.EntryTime.Format("2006-01-02 15:04"), trade.ExitTime.Format("2006-01-02 15:04"), trade.Side,
+				trade.Volume, trade.EntryPrice, trade.ExitPrice, trade.Profit, trade.ReturnPct())
+		}
+		fmt.Println()
+	}
+	fmt.Println(result)
+}
+
+// split returns the comma-separated fields of `list`.
+func split(list string) (fields []string) {
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return
+}
+
+func parseFloat(field string) float64 {
+	value, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return value
+}
+
+func parseDuration(field string) time.Duration {
+	value, err := time.ParseDuration(field)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return value
+}
+
+// printJSON prints `v` as indented JSON.
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(data))
+}
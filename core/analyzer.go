@@ -8,9 +8,13 @@ package core
 import (
 	"errors"
 	"fmt"
-	"math"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/michaellormann/leprechaun/indicators"
 )
 
 // Analyzer defines the interface for an arbitrary analysis pipeline.
@@ -74,6 +78,17 @@ type AnalysisOptions struct {
 	Interval time.Duration
 	// Mode is the trading mode for each
 	Mode TradeMode
+	// MovingAverageWindow is the number of data points averaged by the moving average.
+	MovingAverageWindow int
+	// Patterns holds the thresholds used for candlestick pattern detection.
+	Patterns PatternSensitivity
+	// Asset is the code of the asset being analyzed.
+	Asset string
+	// SecondaryInterval is the length of the candles of a second timeframe that must confirm the trend of
+	// the analyzed candles before a signal is acted on. Zero disables the confirmation.
+	SecondaryInterval time.Duration
+	// SecondaryPeriod is the period covered by the candles of the second timeframe.
+	SecondaryPeriod time.Duration
 }
 
 // SIGNAL is emitted by the Emit function based on results from the technical analysis
@@ -127,7 +142,8 @@ var (
 
 // AnalysisPlugins holds registered analysis plugins. Each plugin should
 // 	1) Be defined in a seperate file in the `plugins` package
-// 	2) Register itself with a unique string identifier in its `init()` method, by calling `AnalysisPlugins.Register`
+// 	2) Register itself with a unique string identifier in its `init()` method, by calling `AnalysisPlugins.Register`,
+//	   or `AnalysisPlugins.RegisterFactory` if it keeps the state of an analysis in its fields
 //	3) Be well documented and expose a conscise description in its Description variable. The description
 // may include links to further information and explanation about the plugin.
 // e.g. The Default "hermes" analyzer exposes its description as `Hermes.Description string`
@@ -135,10 +151,19 @@ var (
 // The UI will expose registered to the users, along with their descriptions and the selected
 // by the user will be used to emit trade signals.
 type AnalysisPlugins struct {
-	Default Analyzer
-	plugins map[string]Analyzer
+	Default    Analyzer
+	plugins    map[string]Analyzer
+	discovered []PluginInfo // Plugins loaded from the plugins folder.
+	factories  map[string]AnalyzerFactory
+	instances  map[string]Analyzer // Instance of each plugin with a factory for each asset, keyed by "plugin/asset".
+	mu         sync.Mutex
 }
 
+// AnalyzerFactory creates a new instance of an analysis plugin. A plugin that keeps the price data and
+// results of an analysis in its fields should be registered with a factory, so each asset is analyzed by
+// an instance of its own and the state of one asset's analysis never leaks into another's.
+type AnalyzerFactory func() Analyzer
+
 // Register makes an analysis plugin available for use. Each plugin must
 // ensure it provides a unique name. If a plugin's name clashes with that of
 // a previously registered plugin, it will not be registered. All plugins are defined
@@ -154,22 +179,170 @@ func (Plg *AnalysisPlugins) Register(name string, plugin Analyzer) {
 		}
 	}
 	Plg.plugins[name] = plugin
-	if len(Plg.plugins) == 1 {
-		Plg.Default = Plg.plugins[DefaultAnalysisPlugin]
+	if len(Plg.plugins) == 1 || name == strings.ToLower(DefaultAnalysisPlugin) {
+		Plg.Default = plugin
 	}
 	// Logger.Printf("%s plugin registered.", name)
 }
 
+// RegisterFactory makes the analysis plugin created by `factory` available for use, like `Register`. An
+// instance created by `factory` describes the plugin, and each asset is analyzed by another instance of its own.
+func (Plg *AnalysisPlugins) RegisterFactory(name string, factory AnalyzerFactory) {
+	name = strings.ToLower(name)
+	if _, ok := Plg.plugins[name]; ok || factory == nil {
+		debugf("Error! Unable to register plugin - %s, as another plugin with the same name has already been registered.", name)
+		return
+	}
+	Plg.factories[name] = factory
+	Plg.Register(name, factory())
+}
+
+// Plugin returns the plugin registered under `name`. Plugins registered with a factory return a new
+// instance, e.g. for a backtest, so it does not share the state of the instances that trade.
+func (Plg *AnalysisPlugins) Plugin(name string) (Analyzer, error) {
+	name = strings.ToLower(name)
+	if factory, ok := Plg.factories[name]; ok {
+		return factory(), nil
+	}
+	if plugin, ok := Plg.plugins[name]; ok {
+		return plugin, nil
+	}
+	return nil, fmt.Errorf("%w (%q)", ErrUnknownPlugin, name)
+}
+
+// HasFactory reports whether the plugin registered under `name` was registered with a factory, so the
+// instances returned by `Plugin` can be used at the same time.
+func (Plg *AnalysisPlugins) HasFactory(name string) bool {
+	_, ok := Plg.factories[strings.ToLower(name)]
+	return ok
+}
+
+// nameOf returns the name `plugin` is registered under, or an empty string if it is not registered.
+func (Plg *AnalysisPlugins) nameOf(plugin Analyzer) string {
+	if plugin == nil || !reflect.TypeOf(plugin).Comparable() {
+		// Comparing plugins that are not comparable, e.g. structs holding slices, would panic.
+		return ""
+	}
+	for name, registered := range Plg.plugins {
+		if reflect.TypeOf(registered).Comparable() && registered == plugin {
+			return name
+		}
+	}
+	return ""
+}
+
+// Instance returns the instance of `plugin` that analyzes `asset`. Plugins registered with a factory have
+// an instance for each asset, created the first time the asset is analyzed. Other plugins are shared by all assets.
+func (Plg *AnalysisPlugins) Instance(plugin Analyzer, asset string) Analyzer {
+	instance, _ := Plg.instance(plugin, asset)
+	return instance
+}
+
+// instance returns the instance of `plugin` that analyzes `asset`, like `Instance`, and reports whether it
+// is shared by all assets, so it can only analyze one asset at a time.
+func (Plg *AnalysisPlugins) instance(plugin Analyzer, asset string) (instance Analyzer, shared bool) {
+	name := Plg.nameOf(plugin)
+	factory, ok := Plg.factories[name]
+	if !ok {
+		return plugin, true
+	}
+	Plg.mu.Lock()
+	defer Plg.mu.Unlock()
+	key := name + "/" + asset
+	instance, ok = Plg.instances[key]
+	if !ok {
+		instance = factory()
+		Plg.instances[key] = instance
+	}
+	return instance, false
+}
+
+// resetInstances drops the instances created for each asset, so the next analysis of an asset creates one
+// with the settings that are current then.
+func (Plg *AnalysisPlugins) resetInstances() {
+	Plg.mu.Lock()
+	defer Plg.mu.Unlock()
+	Plg.instances = map[string]Analyzer{}
+}
+
+// Names returns the names of the registered plugins in alphabetical order.
+func (Plg *AnalysisPlugins) Names() (names []string) {
+	for name := range Plg.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// ErrUnknownPlugin is returned when no analysis plugin is registered under a name.
+var ErrUnknownPlugin = errors.New("no analysis plugin is registered under that name")
+
+// PluginDescription describes a registered analysis plugin, e.g. for a plugin picker.
+type PluginDescription struct {
+	Name        string
+	Description string
+	// Version is the version of a plugin loaded from the plugins folder. It is empty for built-in plugins.
+	Version string
+	// Options are the analysis options the plugin needs. Zero fields use the global defaults.
+	Options AnalysisOptions
+	// IsDefault reports whether the plugin is used when the user has not chosen one.
+	IsDefault bool
+}
+
+// Describe returns the description of the plugin registered under `name`.
+func (Plg *AnalysisPlugins) Describe(name string) (PluginDescription, error) {
+	name = strings.ToLower(name)
+	plugin, ok := Plg.plugins[name]
+	if !ok {
+		return PluginDescription{}, fmt.Errorf("%w (%q)", ErrUnknownPlugin, name)
+	}
+	desc := PluginDescription{Name: name, Description: strings.Join(strings.Fields(strings.Trim(plugin.Description(), `"`)), " "),
+		IsDefault: name == strings.ToLower(DefaultAnalysisPlugin)}
+	if provider, ok := plugin.(OptionsProvider); ok {
+		desc.Options = provider.DefaultOptions()
+	}
+	for _, info := range Plg.discovered {
+		if info.Name == name {
+			desc.Version = info.Version
+		}
+	}
+	return desc, nil
+}
+
+// List returns the descriptions of the registered plugins in alphabetical order.
+func (Plg *AnalysisPlugins) List() (plugins []PluginDescription) {
+	for _, name := range Plg.Names() {
+		if desc, err := Plg.Describe(name); err == nil {
+			plugins = append(plugins, desc)
+		}
+	}
+	return
+}
+
 // InitPlugins returns the plugin handler to be used to access and register
 // the analysis plugins.
 func InitPlugins() error {
 	if PluginHandler != nil {
 		return nil
 	}
+	// The ensemble plugin is part of the core, since it votes with the other plugins. The webhook
+	// plugin is too, since it shares the settings of the endpoint alerts are received on, and so is
+	// the script plugin, since it reads the user's files from the data directory. The model plugin is
+	// added if a model runtime is available. Each asset is analyzed by instances of its own.
 	PluginHandler = &AnalysisPlugins{
 		Default: nil,
 		plugins: map[string]Analyzer{},
+		factories: map[string]AnalyzerFactory{
+			EnsemblePlugin: func() Analyzer { return &Ensemble{} },
+			WebhookPlugin:  func() Analyzer { return &Webhook{} },
+			ScriptPlugin:   func() Analyzer { return &Script{} },
+		},
+		instances: map[string]Analyzer{},
+	}
+	for name, factory := range PluginHandler.factories {
+		PluginHandler.plugins[name] = factory()
 	}
+	registerModelPlugin()
 	return nil
 }
 
@@ -252,30 +425,44 @@ func doOHLC(startTime time.Time, prices []float64, volume float64) OHLC {
 	candle.High = Max64(prices)
 	candle.Low = Min64(prices)
 	candle.Range = candle.Close - candle.Open
-	if candle.Range < 1 {
+	if candle.Range > 0 {
+		// Positive price movement
+		candle.Trend = Bullish
+	} else if candle.Range < 0 {
 		// Negative price movement
 		candle.Trend = Bearish
 	} else {
-		// Positive price movement
-		candle.Trend = Bullish
+		candle.Trend = Indifferent
 	}
 	candle.percentChange = (candle.Range * 100) / candle.Open
-	switch candle.Trend {
-	case Bullish:
-		candle.UpperTail = candle.High - candle.Close
-		candle.LowerTail = candle.Open - candle.Low
-	case Bearish:
-		candle.UpperTail = candle.High - candle.Open
-		candle.LowerTail = candle.Close - candle.Low
-	}
+	candle.UpperTail, candle.LowerTail = candle.upperShadow(), candle.lowerShadow()
 	// candle.Period = time.Hour
 	return candle
 }
 
-// BB calculates the bollinger bands for a time series
-func BB(prices float64, SMA, deviation int64) {
-	// Calculate the simple moving average
-	// window = 1
+// BollingerBands are the bands drawn a number of standard deviations above and below the simple moving
+// average of a price series.
+type BollingerBands = indicators.BollingerBands
+
+// BB calculates the bollinger bands of the latest `window` prices in a time series, oldest first. The bands
+// are `deviations` standard deviations away from the simple moving average of the window.
+func BB(prices []float64, window int, deviations float64) (BollingerBands, error) {
+	return indicators.Bollinger(prices, window, deviations)
+}
+
+// VWAP calculates the volume weighted average price of a series of candles. Each candle is priced at its
+// typical price, the average of its high, low and close, and weighted by the volume traded in it.
+func VWAP(candles []OHLC) (float64, error) {
+	return indicators.VWAP(indicatorCandles(candles))
+}
+
+// indicatorCandles converts candles for the functions of the indicators package.
+func indicatorCandles(candles []OHLC) []indicators.Candle {
+	converted := make([]indicators.Candle, len(candles))
+	for i, candle := range candles {
+		converted[i] = candle.bar()
+	}
+	return converted
 }
 
 // IsBullish returns true if the candle closes at a higher price than its open price.
@@ -294,57 +481,6 @@ func (candle OHLC) IsBearish() bool {
 	return false
 }
 
-// IsDoji returns true if a candles opening price is virtually the same with its closing price.
-// See `https://www.investopedia.com/terms/d/doji.asp`
-func (candle OHLC) IsDoji() bool {
-	if math.Floor(candle.Open) == math.Floor(candle.Close) {
-		return true
-	}
-	return false
-}
-
-// IsHammer returns true if the candle is a hammer.
-// i.e. A black or white candlestick that consists of a small body near the high with little or no upper shadow and a long lower tail.
-// Considered a bullish pattern during a downtrend. See https://en.wikipedia.org/wiki/Hammer_(candlestick_pattern)
-func (candle OHLC) IsHammer() bool {
-	if candle.IsBullish() {
-		// The lower tail/shadow is at least twice as long as the upper tail.
-		if candle.LowerTail > (2 * candle.UpperTail) {
-			// if (candle.Open - candle.Low) > (candle.Close-candle.High)*2 {
-			return true
-		}
-	}
-	return false
-}
-
-// Engulfs checks if a candle (i.e. candleTwo)
-func (candle OHLC) Engulfs(candleTwo OHLC) bool {
-	if candle.High > candleTwo.High && candle.Low < candleTwo.Low {
-		return true
-	}
-	return false
-}
-
-// AllBearish returns true if all candles in the slice are bearish, returns false otherwise
-func (cht CandleChart) AllBearish(candles []OHLC) bool {
-	for _, candle := range candles {
-		if candle.IsBullish() {
-			return false
-		}
-	}
-	return true
-}
-
-// AllBullish returns true if all candles in the slice are bullish, returns false otherwise.
-func (cht CandleChart) AllBullish(candles []OHLC) bool {
-	for _, candle := range candles {
-		if candle.IsBearish() {
-			return false
-		}
-	}
-	return true
-}
-
 // ChartTrend represents the general price movement of a given OHLC unit. It may be bullish or bearish.
 type ChartTrend string
 
@@ -372,117 +508,13 @@ func (tr ChartTrend) IsIndifferent() bool {
 	return tr == "Indifferent"
 }
 
-// CandlestickPattern is a specific pattern for a set of candles.
-// The most recent candles in a candle chart are examined to see if they
-// match any of the patterns described. Basic candles chart patterns are included.
-// See `https://www.investopedia.com/trading/candlestick-charting-what-is-it/`
-type CandlestickPattern uint
-
-type (
-	// BearishCandlestickPattern is a bearish candlestick pattern
-	BearishCandlestickPattern CandlestickPattern
-	// BullishCandlestickPattern is a bullish candlestick pattern
-	BullishCandlestickPattern CandlestickPattern
-)
-
-const (
-	// BullishEngulfingPattern takes place when buyers outpace sellers.
-	// This is reflected in the chart by a long green real body engulfing a small red real body.
-	// With bulls having established some control, the price could head higher.
-	BullishEngulfingPattern BullishCandlestickPattern = iota
-	// BullishMorningStar Consists of a large black body candlestick followed by a small body (red or green) that occurs below the large red body candlestick.
-	// On the following day, a third white body candlestick is formed that closes well into the black body candlestick.
-	// It is considered a major reversal signal when it appears at the bottom
-	BullishMorningStar
-	// MorningDojiStar Consists of a large black body candlestick followed by a Doji that occurred below the preceding candlestick.
-	// On the following day, a third white body candlestick is formed that closes well into the black body candlestick which appeared before the Doji.
-	// It is considered a major reversal signal that is more bullish than the regular morning star pattern because of the existence of the Doji.
-	MorningDojiStar
-	// BullishHarami is the opposite of the upside down bearish harami.
-	// A downtrend is in play, and a small real body (green) occurs inside the large real body (red) of the previous day.
-	// This tells the technician that the trend is pausing. If it is followed by another up day, more upside could be forthcoming.
-	BullishHarami
-	// BullishHaramiCross occurs in a downtrend, where a down candle is followed by a doji.
-	// The doji is within the real body of the prior session.
-	// The implications are the same as the bullish harami.
-	BullishHaramiCross
-	// BullishRisingThree pattern starts out with what is called a "long white day."
-	// Then, on the second, third, and fourth trading sessions, small real bodies move the price lower,
-	// but they still stay within the price range of the long white day (day one in the pattern).
-	// The fifth and last day of the pattern is another long white day.
-	// Even though the pattern shows us that the price is falling for three straight days,
-	// a new low is not seen, and the bull traders prepare for the next move up
-	BullishRisingThree
-	// BullishRisingTwo is similar to the rising three patterns but with two small bearish candles instead of three.
-	BullishRisingTwo
-	// BullishKeyReversal is a key reversal in a downtrend occurs when the price opens below the prior bar's close,
-	// makes a new low, and then closes above the prior bar's high.
-	// This indicates a strong shift to the upside, warning of a potential rally.
-	BullishKeyReversal
-	// BullishGenericPattern is a pattern that is formed by subsequently higher closes of the candles in question.
-	// It is intended for use in the event the common patterns defined above are not detected.
-	BullishGenericPattern
-)
-
-const (
-	// BearishEngulfingPattern develops in an uptrend when sellers outnumber buyers.
-	// This action is reflected by a long red real body engulfing a small green real body.
-	// The pattern indicates that sellers are back in control and that the price could continue to decline.
-	BearishEngulfingPattern BearishCandlestickPattern = iota
-	// BearishEveningStar is a topping pattern.
-	// It is identified by the last candle in the pattern opening below the previous day's small real body.
-	// The small real body can be either red or green. The last candle closes deep into the real body of the candle two days prior.
-	// The pattern shows a stalling of the buyers and then the sellers taking control. More selling could develop.
-	BearishEveningStar
-	// EveningDojiStar Consists of three candlesticks.
-	// First is a large white body candlestick followed by a Doji that gaps above the white body.
-	// The third candlestick is a black body that closes well into the white body.
-	// When it appears at the top it is considered a reversal signal.
-	// It signals a more bearish trend than the evening star pattern because of the Doji that has appeared between the two bodies.
-	EveningDojiStar
-	// BearishHarami pattern is a small real body (red) completely inside the previous day's real body.
-	// This is not so much a pattern to act on, but it could be one to watch.
-	// The pattern shows indecision on the part of the buyers.
-	// If the price continues higher afterward, all may still be well with the uptrend,
-	// but a down candle following this pattern indicates a further slide.
-	BearishHarami
-	// BearishHaramiCross occurs in an uptrend, where an up candle is followed by a doji—the session where the candlestick has a virtually equal open and close.
-	// The doji is within the real body of the prior session. The implications are the same as the bearish harami
-	BearishHaramiCross
-	// BearishFallingThree pattern starts out with a strong down day.
-	// This is followed by three small real bodies that make upward progress but stay within the range of the first big down day.
-	// The pattern completes when the fifth day makes another large downward move.
-	// It shows that sellers are back in control and that the price could head lower.
-	BearishFallingThree
-	// BearishFallingTwo is the same as BearishFallingthree but has two small bullish bodies between the bearish candles.
-	BearishFallingTwo
-	// BearishKeyReversal is a key reversal in an uptrend and occurs when the price opens above the prior bar's close,
-	// makes a new high, and then closes below the prior bar's low.
-	// It shows a strong shift in momentum which could indicate a pullback is starting.
-	BearishKeyReversal
-	// BearishGenericPattern is a pattern that is formed by subsequently lower closes of the candles in question.
-	// It is intended for use in the event the common patterns defined above are not detected.
-	// Its score should be dependent on the number of candles that form the longest chain.
-	BearishGenericPattern
-)
-
 var (
-	// ErrLastCandle is returned while trying to trasverse the last candle in a chart. See `CandleChart.nextCandle` and `CandleChart.previousCandle`
+	// ErrLastCandle is returned while trying to trasverse the last candle in a chart.
 	ErrLastCandle = errors.New("there are no more candles in the chart. this is the last one")
+	// ErrNotEnoughPrices is returned when there are too few prices to compute an indicator.
+	ErrNotEnoughPrices = indicators.ErrNotEnoughPrices
 )
 
-// BullishChartPattern is a bullish candlestick pattern detected in the chart
-type BullishChartPattern struct {
-	Pattern         BullishCandlestickPattern
-	PreceedingTrend ChartTrend
-}
-
-// BearishChartPattern is a bearish candlestick pattern detected in the chart
-type BearishChartPattern struct {
-	Pattern         BearishCandlestickPattern
-	PreceedingTrend ChartTrend
-}
-
 // CandleChart is a chart that holds the OHLC data against time
 type CandleChart struct {
 	Candles           []OHLC
@@ -492,8 +524,12 @@ type CandleChart struct {
 	MovingAverage     map[string]int
 	Lines             [3]float64
 	MaxPatternCandles int // Maximum number of most recent candles to check for common candlestick patterns.
+	ContextCandles    int // Number of candles before a pattern that decide whether it formed at the top or the bottom.
 	BullishPatterns   []BullishChartPattern
 	BearishPatterns   []BearishChartPattern // These are the bearish patterns that have been detected in the most recent candles of the chart.
+	// Sensitivity holds the thresholds the patterns of the chart are detected with, e.g. those set for its
+	// asset. If it is empty the thresholds set with `SetPatternSensitivity` are used.
+	Sensitivity PatternSensitivity
 }
 
 // NewCandleChart returns a candlestick chart initialized with the provided values.
@@ -501,6 +537,7 @@ func NewCandleChart(candles []OHLC) CandleChart {
 	c := CandleChart{
 		Candles:           []OHLC{},
 		MaxPatternCandles: 5,
+		ContextCandles:    10,
 		BearishPatterns:   []BearishChartPattern{},
 		BullishPatterns:   []BullishChartPattern{},
 	}
@@ -511,58 +548,6 @@ func NewCandleChart(candles []OHLC) CandleChart {
 	return c
 }
 
-func (cht CandleChart) nextCandle(current OHLC) (candle OHLC, err error) {
-	if len(cht.Candles) >= current.ID+1 {
-		return OHLC{}, ErrLastCandle
-	}
-	return cht.Candles[current.ID+1], nil
-}
-
-func (cht CandleChart) nextCandles(num int, current OHLC) (candles []OHLC, err error) {
-	if len(cht.Candles) >= current.ID+1 {
-		return nil, ErrLastCandle
-	}
-	for i := 1; i == num; i++ {
-		candles = append(candles, cht.Candles[current.ID+i])
-	}
-	return
-}
-
-func (cht CandleChart) previousCandle(current OHLC) (candle OHLC, err error) {
-	if current.ID == 0 {
-		return OHLC{}, ErrLastCandle
-	}
-	return cht.Candles[current.ID-1], nil
-}
-
-func (cht CandleChart) previousCandles(num int, current OHLC) (candles []OHLC, err error) {
-	if current.ID == 0 {
-		return nil, ErrLastCandle
-	}
-	for i := 1; i <= num; i++ {
-		candles = append(candles, cht.Candles[current.ID-i])
-	}
-	return
-}
-
-// AddBearishPattern adds a detected bearish pattern to the chart struct as well as the trend
-// of the candles preceeding the detect pattern.
-func (cht CandleChart) AddBearishPattern(earliestCandle OHLC, pattern BearishCandlestickPattern) {
-	if previousThreeCandles, err := cht.previousCandles(3, earliestCandle); err != ErrLastCandle {
-		cht.BearishPatterns = append(cht.BearishPatterns, BearishChartPattern{Pattern: pattern,
-			PreceedingTrend: cht.DetectTrend(previousThreeCandles)})
-	}
-}
-
-// AddBullishPattern adds a detected bullish pattern to the chart struct as well as the trend
-// of the candles preceeding the detected pattern.
-func (cht CandleChart) AddBullishPattern(earliestCandle OHLC, pattern BullishCandlestickPattern) {
-	if previousThreeCandles, err := cht.previousCandles(3, earliestCandle); err != ErrLastCandle {
-		cht.BullishPatterns = append(cht.BullishPatterns, BullishChartPattern{Pattern: pattern,
-			PreceedingTrend: cht.DetectTrend(previousThreeCandles)})
-	}
-}
-
 // DetectTrend tries to score the overall trend of a group of candles that typically follow each other.
 // It is best but not necessary to provide an odd number of candles for a certain score.
 func (cht CandleChart) DetectTrend(candles []OHLC) ChartTrend {
@@ -586,208 +571,6 @@ func (cht CandleChart) DetectTrend(candles []OHLC) ChartTrend {
 
 }
 
-// DetectPatterns tries to match the most recent price data to common candlestick patterns
-func (cht CandleChart) DetectPatterns() {
-	fmt.Println(len(cht.Candles), cht.Candles)
-	patternCandles := cht.Candles[len(cht.Candles)-cht.MaxPatternCandles : len(cht.Candles)]
-	lastIdx := len(patternCandles) - 1
-	lastCandle := patternCandles[lastIdx]
-	// Check for patterns that end with a bearish candle, for example the bearish engulfing pattern
-	if lastCandle.IsBearish() {
-		if previousCandle, err := cht.previousCandle(lastCandle); err != ErrLastCandle {
-			if previousCandle.IsBullish() {
-				// Check for BearishEngulfingPattern. see https://www.investopedia.com/trading/candlestick-charting-what-is-it/ for more info
-				if lastCandle.Engulfs(previousCandle) {
-					// The last candle engulfs the preceeding one
-					cht.AddBearishPattern(previousCandle, BearishEngulfingPattern)
-				}
-				// Check for bearish harami
-				if previousCandle.Engulfs(lastCandle) {
-					// the last candle is engulfed by the preceeding one
-					cht.AddBearishPattern(previousCandle, BearishHarami)
-				}
-				// Check for bearish key reversal pattern
-				if lastCandle.Open > previousCandle.Close && lastCandle.High > lastCandle.Open {
-					if lastCandle.Close < previousCandle.Low {
-						cht.AddBearishPattern(previousCandle, BearishKeyReversal)
-					}
-				}
-			}
-			// Check for bearish evening star
-			if thirdCandle, err := cht.previousCandle(previousCandle); err != ErrLastCandle {
-				if thirdCandle.IsBullish() {
-					if previousCandle.IsDoji() {
-						if previousCandle.Low > thirdCandle.Close && lastCandle.Open < previousCandle.Close {
-							if lastCandle.Close > thirdCandle.Open {
-								// conditions for an evening doji star has been met.
-								cht.AddBearishPattern(thirdCandle, EveningDojiStar)
-							}
-						}
-					} else { // Next to last candle is Not a doji
-						// Previous candle is relatively small and gaps above the previous (third to last) candle
-						if previousCandle.Range <= (lastCandle.Range/2) && previousCandle.Open > thirdCandle.Open {
-							// Last candle opens below previous smaller candle and closes deep into the candle two periods before
-							if lastCandle.Open > previousCandle.Close && lastCandle.Close > thirdCandle.Open {
-								// Conditions for an evening star have been met
-								cht.AddBearishPattern(thirdCandle, BearishEveningStar)
-							}
-						}
-					}
-				}
-			}
-
-		}
-		// Check for bearish falling three (a.k.a Bearish 3-method formation)
-		if previousThreeCandles, err := cht.previousCandles(3, lastCandle); err != ErrLastCandle {
-			allThreeBullish := cht.AllBullish(previousThreeCandles)
-			if allThreeBullish {
-				if fifthCandle, err := cht.previousCandle(previousThreeCandles[len(previousThreeCandles)-1]); err != ErrLastCandle {
-					// fifthCandle is the one that preceedes the three bullish candles and of course our bearish current candle
-					if fifthCandle.IsBearish() {
-						highestPrices := []float64{}
-						for _, candle := range previousThreeCandles {
-							highestPrices = append(highestPrices, candle.High)
-						}
-						if Max64(highestPrices) < fifthCandle.High {
-							cht.AddBearishPattern(fifthCandle, BearishFallingThree)
-						}
-					}
-
-				}
-			}
-		}
-		// Check for bearish falling two
-		if previousTwoCandles, err := cht.previousCandles(2, lastCandle); err != ErrLastCandle {
-			bothBullish := cht.AllBullish(previousTwoCandles)
-			if bothBullish {
-				if fourthCandle, err := cht.previousCandle(previousTwoCandles[1]); err != ErrLastCandle {
-					if fourthCandle.IsBearish() {
-						highestPrices := []float64{}
-						for _, candle := range previousTwoCandles {
-							highestPrices = append(highestPrices, candle.High)
-						}
-						if Max64(highestPrices) < fourthCandle.High {
-							cht.AddBearishPattern(fourthCandle, BearishFallingTwo)
-						}
-					}
-				}
-			}
-		}
-
-		// In the event no patterns have been detected check for a generic bearish pattern
-		if previousThreeCandles, err := cht.previousCandles(3, lastCandle); err != ErrLastCandle {
-			if cht.AllBearish(previousThreeCandles) {
-				cht.AddBearishPattern(lastCandle, BearishGenericPattern)
-			}
-		}
-
-	} else if lastCandle.IsBullish() { // Check for patterns that end in a bullish candle
-		if previousCandle, err := cht.previousCandle(lastCandle); err != ErrLastCandle {
-			if previousCandle.IsBearish() {
-				// Check for BullishEngulfingPattern. see https://www.investopedia.com/trading/candlestick-charting-what-is-it/ for more info
-				if lastCandle.Engulfs(previousCandle) {
-					// The last candle engulfs the preceeding one
-					cht.AddBullishPattern(previousCandle, BullishEngulfingPattern)
-				}
-				// Check for bullish harami
-				if previousCandle.Engulfs(lastCandle) {
-					// The last candle is engulfed by the preceeding one
-					cht.AddBullishPattern(previousCandle, BullishHarami)
-				}
-				// Check for bullish key reversal
-				if lastCandle.Open < previousCandle.Close && lastCandle.Low < lastCandle.Open {
-					if lastCandle.Close > previousCandle.High {
-						cht.AddBullishPattern(previousCandle, BullishKeyReversal)
-					}
-				}
-			}
-			// Check for bullish morning star
-			if thirdCandle, err := cht.previousCandle(previousCandle); err != ErrLastCandle {
-				if thirdCandle.IsBearish() {
-					if previousCandle.IsDoji() { // Check for morning doji star
-						if previousCandle.High < thirdCandle.Close && lastCandle.Open > previousCandle.Close {
-							if lastCandle.Close < thirdCandle.Open {
-								// conditions for an evening doji star has been met.
-								cht.AddBearishPattern(thirdCandle, EveningDojiStar)
-							}
-						}
-					} else {
-						// Previous candle is relatively small and gaps below the previous (third to last) candle
-						// if previousCandle.Range <= (lastCandle.Range/2) && previousCandle.Open < thirdCandle.Close {
-						if previousCandle.Range <= (lastCandle.Range/2) && previousCandle.Close < thirdCandle.Close {
-							// Last candle closes above previous smaller candle and oens deep into the candle two periods before
-							// if lastCandle.Close > previousCandle.Open && lastCandle.Open < thirdCandle.Open {
-							if lastCandle.Open > previousCandle.Close && lastCandle.Close < thirdCandle.Open {
-								// Conditions for a morning star have been met
-								cht.AddBullishPattern(thirdCandle, BullishMorningStar)
-							}
-						}
-					}
-				}
-			}
-
-		}
-		// Check for bullish rising three (a.k.a Bullish 3-method formation)
-		if previousThreeCandles, err := cht.previousCandles(3, lastCandle); err != ErrLastCandle {
-			allThreeBearish := cht.AllBearish(previousThreeCandles)
-			if allThreeBearish {
-				if fifthCandle, err := cht.previousCandle(previousThreeCandles[len(previousThreeCandles)-1]); err != ErrLastCandle {
-					// fifthCandle is the one that preceedes the three bearish candles and of course our bullish current candle
-					if fifthCandle.IsBullish() {
-						lowestPrices := []float64{}
-						for _, candle := range previousThreeCandles {
-							lowestPrices = append(lowestPrices, candle.High)
-						}
-						if Min64(lowestPrices) > fifthCandle.Low {
-							cht.AddBullishPattern(fifthCandle, BullishRisingThree)
-						}
-					}
-				}
-			}
-		}
-		// Check for bullish rising two
-		if previousTwoCandles, err := cht.previousCandles(2, lastCandle); err != ErrLastCandle {
-			bothBearish := cht.AllBearish(previousTwoCandles)
-			if bothBearish {
-				if fourthCandle, err := cht.previousCandle(previousTwoCandles[1]); err != ErrLastCandle {
-					if fourthCandle.IsBullish() {
-						lowestPrices := []float64{}
-						for _, candle := range previousTwoCandles {
-							lowestPrices = append(lowestPrices, candle.Low)
-						}
-						if Max64(lowestPrices) > fourthCandle.Low {
-							cht.AddBearishPattern(fourthCandle, BearishFallingTwo)
-						}
-					}
-				}
-			}
-		}
-		// In the event no patterns have been detected check for a generic bullsih pattern
-		if previousThreeCandles, err := cht.previousCandles(3, lastCandle); err != ErrLastCandle {
-			if cht.AllBullish(previousThreeCandles) {
-				cht.AddBullishPattern(lastCandle, BullishGenericPattern)
-			}
-		}
-	}
-
-	// Check for patterns that end in  a doji
-	if lastCandle.IsDoji() {
-		// Check for bullish harami cross
-		if previousCandle, err := cht.previousCandle(lastCandle); err != ErrLastCandle {
-			if previousCandle.IsBearish() && lastCandle.High < previousCandle.High && lastCandle.Low > previousCandle.Low {
-				cht.AddBullishPattern(previousCandle, BullishHaramiCross)
-			}
-		}
-		// Check for bearish harami cross
-		if previousCandle, err := cht.previousCandle(lastCandle); err != ErrLastCandle {
-			if previousCandle.IsBullish() && lastCandle.High < previousCandle.High && lastCandle.Low > previousCandle.Low {
-				cht.AddBearishPattern(previousCandle, BearishHaramiCross)
-			}
-		}
-	}
-
-}
-
 // Min64 returns the smallest value in a float64 list
 func Min64(a []float64) float64 {
 	if len(a) == 0 {
@@ -0,0 +1,69 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `applock.go` holds the settings of the app lock. The UI can be locked with a PIN so someone who
+*  picks up the device can not view balances, change settings or start and stop trading. Only a
+*  salted hash of the PIN is saved. Locking the UI does not affect the running bot.
+ */
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrInvalidPIN is returned when a PIN is not made of 4 to 8 digits.
+var ErrInvalidPIN = errors.New("the PIN must be 4 to 8 digits")
+
+// pinHashRounds is the number of times a PIN is hashed, to slow down guessing from a copy of the settings file.
+const pinHashRounds = 100000
+
+// AppLockSettings configures the app lock.
+type AppLockSettings struct {
+	Enabled bool
+	PINHash string
+	PINSalt string
+}
+
+func hashPIN(pin, salt string) string {
+	sum := sha256.Sum256([]byte(salt + pin))
+	for i := 1; i < pinHashRounds; i++ {
+		sum = sha256.Sum256(sum[:])
+	}
+	return hex.EncodeToString(sum[:])
+}
+
+// SetPIN replaces the PIN that unlocks the app.
+func (s *AppLockSettings) SetPIN(pin string) error {
+	if len(pin) < 4 || len(pin) > 8 {
+		return ErrInvalidPIN
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return ErrInvalidPIN
+		}
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	s.PINSalt = hex.EncodeToString(salt)
+	s.PINHash = hashPIN(pin, s.PINSalt)
+	return nil
+}
+
+// HasPIN reports whether a PIN has been set.
+func (s AppLockSettings) HasPIN() bool {
+	return s.PINHash != ""
+}
+
+// CheckPIN reports whether `pin` unlocks the app.
+func (s AppLockSettings) CheckPIN(pin string) bool {
+	if !s.HasPIN() {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashPIN(pin, s.PINSalt)), []byte(s.PINHash)) == 1
+}
@@ -0,0 +1,123 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `approval.go` implements the "ask before trading" mode. When it is enabled, every long or short
+*  entry the analyzer recommends is sent to the UI as a proposal, and the order is only placed once
+*  the user approves it. Proposals that are not answered in time are rejected.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrProposalRejected is returned when the user rejects a trade proposal.
+	ErrProposalRejected = errors.New("the trade was rejected")
+	// ErrProposalExpired is returned when the user does not answer a trade proposal in time.
+	ErrProposalExpired = errors.New("the trade proposal expired before it was approved")
+	// ErrApprovalUnavailable is returned when manual approval is enabled but the UI can not receive proposals.
+	ErrApprovalUnavailable = errors.New("trades can not be approved. The UI is not listening for trade proposals")
+)
+
+// TradeProposal is a trade the bot wants to make. It waits for the user to approve or reject it.
+type TradeProposal struct {
+	ID      string
+	Asset   string
+	Signal  SIGNAL
+	Price   float64 // Current price of the asset.
+	Volume  float64
+	Cost    float64 // Value of the order in fiat.
+	Created time.Time
+	Expires time.Time
+
+	decision chan bool
+	once     sync.Once
+}
+
+var proposalCount int
+
+func newTradeProposal(cl *Client, signal SIGNAL, price, volume float64, timeout time.Duration) *TradeProposal {
+	proposalCount++
+	now := time.Now()
+	return &TradeProposal{
+		ID:       fmt.Sprintf("%s-%d-%d", cl.asset, now.Unix(), proposalCount),
+		Asset:    cl.asset,
+		Signal:   signal,
+		Price:    price,
+		Volume:   volume,
+		Cost:     price * volume,
+		Created:  now,
+		Expires:  now.Add(timeout),
+		decision: make(chan bool, 1),
+	}
+}
+
+// Approve lets the bot place the proposed trade. Only the first decision on a proposal counts.
+func (p *TradeProposal) Approve() {
+	p.decide(true)
+}
+
+// Reject stops the bot from placing the proposed trade. Only the first decision on a proposal counts.
+func (p *TradeProposal) Reject() {
+	p.decide(false)
+}
+
+// Expired returns true if the proposal can no longer be approved.
+func (p *TradeProposal) Expired() bool {
+	return time.Now().After(p.Expires)
+}
+
+func (p *TradeProposal) decide(approved bool) {
+	p.once.Do(func() {
+		p.decision <- approved
+	})
+}
+
+// requestApproval sends a proposal for the trade to the UI and waits for the user's decision.
+// It returns nil if the trade was approved, `ErrProposalRejected` or `ErrProposalExpired` if it
+// was not, and `ErrCancelled` if the user stops the bot while the proposal is pending.
+func (bot *Bot) requestApproval(cl *Client, signal SIGNAL, price, volume float64) error {
+	if UIChans.ProposalChan == nil {
+		return ErrApprovalUnavailable
+	}
+	timeout := time.Duration(cfg().Trade.ApprovalTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	proposal := newTradeProposal(cl, signal, price, volume, timeout)
+	expired := time.NewTimer(timeout)
+	defer expired.Stop()
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	select {
+	case UIChans.ProposalChan <- proposal:
+	case <-expired.C:
+		return ErrProposalExpired
+	}
+	notify(EventInfo, cl.asset, "Leprechaun wants to %v %.6f %s at %s %s. Approve or reject the trade within %v.",
+		signal, volume, cl.asset, cl.currency, GetPairInfo(cl.Pair).FormatPrice(price), timeout)
+	for {
+		select {
+		case approved := <-proposal.decision:
+			if !approved {
+				return ErrProposalRejected
+			}
+			debugf("The %v trade for %s has been approved.", signal, cl.name)
+			return nil
+		case <-expired.C:
+			// A late decision must not place the trade.
+			proposal.Reject()
+			return ErrProposalExpired
+		case <-tick.C:
+			if cancelled() {
+				proposal.Reject()
+				return ErrCancelled
+			}
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `audit.go` checks every open record in the ledger against the order and trade history of the exchange.
+*  `ReconcileOrders` only looks at recent orders, so a record whose order was cancelled, or filled for
+*  a different volume, while Leprechaun was not watching stays in the ledger and is traded as if it
+*  held the asset. The audit runs at startup and once a day after that. The records it flags are saved
+*  with the fill the exchange reports, so the user can repair them to match the exchange, or move them
+*  out of the ledger into the ARCHIVED_RECORDS table, from the stats page.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	luno "github.com/luno/luno-go"
+)
+
+// Kinds of issues the audit finds in the ledger.
+const (
+	// IssueUnfilled is a record whose order was completed or cancelled without filling any volume.
+	IssueUnfilled = "UNFILLED"
+	// IssueModified is a record whose volume or cost differs from what its order filled for.
+	IssueModified = "MODIFIED"
+	// IssueMissing is a record whose order the exchange has no trace of.
+	IssueMissing = "MISSING"
+)
+
+const (
+	// ledgerIssuesFile holds the issues found by the latest audit of each asset.
+	ledgerIssuesFile = "ledger-issues.json"
+	// ledgerAuditInterval is how often the ledger is audited while the bot runs.
+	ledgerAuditInterval = 24 * time.Hour
+	// auditTolerance is the fraction a record's volume or cost may differ from its fill by, e.g. from
+	// rounding, before it is flagged.
+	auditTolerance = 0.001
+	// auditTradeLimit is the number of the latest trades of a pair the audit sums.
+	auditTradeLimit = 1000
+)
+
+var (
+	// ErrNoLedgerIssue is returned when an issue that is repaired or archived is not in the latest audit.
+	ErrNoLedgerIssue = errors.New("no such ledger issue")
+	// ErrCannotRepair is returned when an issue can not be repaired from the exchange's history.
+	ErrCannotRepair = errors.New("the record can not be repaired from the exchange's history, archive it instead")
+)
+
+// ledgerIssuesMu guards the file of ledger issues.
+var ledgerIssuesMu sync.Mutex
+
+// LedgerIssue is a record in the ledger that does not match its order on the exchange.
+type LedgerIssue struct {
+	Kind     string
+	Asset    string
+	RecordID string
+	Type     OrderType
+	Message  string
+	// RecordVolume and RecordCost are the volume and cost of the record when it was audited.
+	RecordVolume, RecordCost float64
+	// Filled and Counter are the volume of the asset and the amount of fiat the order filled for.
+	Filled, Counter float64
+	Found           time.Time
+}
+
+// orderFill is the volume and cost an order filled for, summed from its trades.
+type orderFill struct {
+	base, counter float64
+}
+
+// AuditLedger checks the open records of the client's asset against the exchange's order and trade
+// history, then saves and reports the records that do not match. Simulated records, the tranches of
+// split positions and the aggregate records of DCA plans are not placed as single orders, so they are
+// skipped. Records whose orders are still open are left to the order tracker.
+func (bot *Bot) AuditLedger(cl *Client) (issues []LedgerIssue) {
+	ledger := bot.Ledger()
+	records, err := ledger.everyRecord()
+	ledger.Save()
+	if err != nil {
+		debugf("Could not audit the %s records in the ledger. Reason: %v", cl.asset, err)
+		return
+	}
+	aggregates := map[string]bool{}
+	for _, plan := range loadDCAPlans() {
+		aggregates[plan.RecordID] = true
+	}
+	audited := []Record{}
+	for _, rec := range records {
+		if rec.Asset != cl.asset || rec.Simulated || simulatedOrder(rec.ID) || rec.ParentID != "" || aggregates[rec.ID] {
+			continue
+		}
+		audited = append(audited, rec)
+	}
+	if len(audited) > 0 {
+		fills := cl.tradeFills()
+		listed := cl.listedOrders()
+		for _, rec := range audited {
+			issue, ok := cl.auditRecord(rec, fills, listed)
+			if ok {
+				issues = append(issues, issue)
+			}
+		}
+	}
+	if err = saveLedgerIssues(cl.asset, issues); err != nil {
+		debugf("Could not save the issues found in the %s records. Reason: %v", cl.asset, err)
+	}
+	for _, issue := range issues {
+		notify(EventAlert, issue.Asset, "Record %s: %s. Repair or archive it from the stats page.", issue.RecordID, issue.Message)
+	}
+	if len(issues) > 0 {
+		debugf("Found %d records of %s in the ledger that do not match the exchange.", len(issues), cl.asset)
+	}
+	return
+}
+
+// auditRecord compares `rec` with the fill of its order. The fill is summed from the order's trades if
+// any are in `fills`. Otherwise the order is looked up in `listed`, then on the exchange. It reports
+// false if the record matches its order, or its order could not be checked.
+func (cl *Client) auditRecord(rec Record, fills map[string]orderFill, listed map[string]luno.Order) (issue LedgerIssue, ok bool) {
+	issue = LedgerIssue{Asset: rec.Asset, RecordID: rec.ID, Type: rec.Type, RecordVolume: rec.Volume,
+		RecordCost: rec.Cost, Found: time.Now()}
+	fill, traded := fills[rec.ID]
+	if !traded {
+		o, found := listed[rec.ID]
+		if !found {
+			res, err := cl.CheckOrder(rec.ID)
+			var lunoErr *luno.Error
+			switch {
+			case errors.As(err, &lunoErr) && lunoErr.Code == "ErrOrderNotFound":
+				issue.Kind = IssueMissing
+				issue.Message = "its order is not on the exchange. It may have been placed on another account"
+				return issue, true
+			case err != nil:
+				debugf("Could not check the order of record %s. Reason: %v", rec.ID, err)
+				return issue, false
+			}
+			o = luno.Order{OrderId: res.OrderId, State: res.State, Base: res.Base, Counter: res.Counter}
+		}
+		if o.State == luno.OrderStatePending {
+			return issue, false
+		}
+		fill = orderFill{base: o.Base.Float64(), counter: o.Counter.Float64()}
+	}
+	issue.Filled, issue.Counter = fill.base, fill.counter
+	switch {
+	case fill.base == 0:
+		issue.Kind = IssueUnfilled
+		issue.Message = "its order was closed without filling any volume, so it holds nothing"
+	case differs(fill.base, rec.Volume) || differs(fill.counter, rec.Cost):
+		issue.Kind = IssueModified
+		issue.Message = fmt.Sprintf("it holds %.6f %s for %.2f, but its order filled %.6f for %.2f",
+			rec.Volume, rec.Asset, rec.Cost, fill.base, fill.counter)
+	default:
+		return issue, false
+	}
+	return issue, true
+}
+
+// differs reports whether `actual` and `recorded` are further apart than `auditTolerance` allows.
+func differs(actual, recorded float64) bool {
+	return math.Abs(actual-recorded) > auditTolerance*math.Max(math.Abs(actual), math.Abs(recorded))
+}
+
+// tradeFills sums the latest trades of the client's pair by order.
+func (cl *Client) tradeFills() (fills map[string]orderFill) {
+	fills = map[string]orderFill{}
+	sleep() // Error 429 safety
+	res, err := cl.ListUserTrades(ctx, &luno.ListUserTradesRequest{Pair: cl.Pair, Limit: auditTradeLimit, SortDesc: true})
+	if err != nil {
+		// Paper trading does not keep a trade history, so orders are looked up one by one.
+		debugf("Could not list the %s trades. Reason: %v", cl.Pair, err)
+		return
+	}
+	for _, t := range res.Trades {
+		fill := fills[t.OrderId]
+		fill.base += t.Base.Float64()
+		fill.counter += t.Counter.Float64()
+		fills[t.OrderId] = fill
+	}
+	if n := len(res.Trades); n == auditTradeLimit {
+		// Older trades of the earliest order may have been left out, so its order is looked up instead.
+		delete(fills, res.Trades[n-1].OrderId)
+	}
+	return
+}
+
+// listedOrders returns the orders of the client's pair the exchange lists, keyed by their IDs.
+func (cl *Client) listedOrders() map[string]luno.Order {
+	listed := map[string]luno.Order{}
+	sleep() // Error 429 safety
+	req := luno.ListOrdersRequest{Pair: cl.Pair, CreatedBefore: time.Now().UnixNano() / int64(time.Millisecond)}
+	res, err := cl.ListOrders(ctx, &req)
+	if err != nil {
+		debugf("Could not list the %s orders. Reason: %v", cl.Pair, err)
+		return listed
+	}
+	for _, o := range res.Orders {
+		listed[o.OrderId] = o
+	}
+	return listed
+}
+
+// LedgerIssues returns the issues found by the latest audit of each asset, from the earliest.
+func LedgerIssues() (issues []LedgerIssue, err error) {
+	ledgerIssuesMu.Lock()
+	defer ledgerIssuesMu.Unlock()
+	saved, err := loadLedgerIssues()
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range saved {
+		issues = append(issues, issue)
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Found.Before(issues[j].Found) })
+	return issues, nil
+}
+
+// loadLedgerIssues reads the saved issues, keyed by the IDs of their records. The caller must hold
+// `ledgerIssuesMu`.
+func loadLedgerIssues() (issues map[string]LedgerIssue, err error) {
+	issues = map[string]LedgerIssue{}
+	data, err := ioutil.ReadFile(filepath.Join(dataDir(), ledgerIssuesFile))
+	if os.IsNotExist(err) {
+		return issues, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &issues); err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+// writeLedgerIssues replaces the saved issues. The caller must hold `ledgerIssuesMu`.
+func writeLedgerIssues(issues map[string]LedgerIssue) error {
+	if err := os.MkdirAll(dataDir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileSynced(filepath.Join(dataDir(), ledgerIssuesFile), data)
+}
+
+// saveLedgerIssues replaces the saved issues of `asset` with `found`.
+func saveLedgerIssues(asset string, found []LedgerIssue) error {
+	ledgerIssuesMu.Lock()
+	defer ledgerIssuesMu.Unlock()
+	issues, err := loadLedgerIssues()
+	if err != nil {
+		// A damaged file is replaced by the latest audit.
+		issues = map[string]LedgerIssue{}
+	}
+	for id, issue := range issues {
+		if issue.Asset == asset {
+			delete(issues, id)
+		}
+	}
+	for _, issue := range found {
+		issues[issue.RecordID] = issue
+	}
+	return writeLedgerIssues(issues)
+}
+
+// resolveLedgerIssue calls `fix` with the saved issue of the record `id`, and forgets the issue if it
+// returns no error.
+func resolveLedgerIssue(id string, fix func(issue LedgerIssue, ledger *Ledger) error) error {
+	ledgerIssuesMu.Lock()
+	defer ledgerIssuesMu.Unlock()
+	issues, err := loadLedgerIssues()
+	if err != nil {
+		return err
+	}
+	issue, ok := issues[id]
+	if !ok {
+		return fmt.Errorf("%w (%q)", ErrNoLedgerIssue, id)
+	}
+	ledger := &Ledger{databasePath: ledgerPath()}
+	ledger.loadDatabase()
+	defer ledger.Save()
+	if _, err = ledger.GetRecordByID(id); err != nil {
+		// The record was closed or removed since it was audited, so there is nothing to fix.
+		delete(issues, id)
+		return writeLedgerIssues(issues)
+	}
+	if err = fix(issue, ledger); err != nil {
+		return err
+	}
+	delete(issues, id)
+	return writeLedgerIssues(issues)
+}
+
+// RepairRecord brings the record `id` in line with the fill its order had when the ledger was audited.
+// A record whose order filled nothing is removed from the ledger. A record whose order is missing from
+// the exchange can not be repaired, and must be archived.
+func RepairRecord(id string) error {
+	return resolveLedgerIssue(id, func(issue LedgerIssue, ledger *Ledger) error {
+		switch issue.Kind {
+		case IssueUnfilled:
+			debugf("Removed record %s from the ledger as its order was not filled.", id)
+			return ledger.DeleteRecord(id)
+		case IssueModified:
+			rec, err := ledger.GetRecordByID(id)
+			if err != nil {
+				return err
+			}
+			rec.applyFill(issue.Filled, issue.Counter)
+			debugf("Record %s now holds the %.6f %s its order filled.", id, rec.Volume, rec.Asset)
+			return ledger.UpdatePosition(rec)
+		}
+		return fmt.Errorf("%w (%s)", ErrCannotRepair, id)
+	})
+}
+
+// ArchiveRecord moves the record `id` out of the ledger into the ARCHIVED_RECORDS table, noting the
+// issue it was archived for. Archived records are no longer traded, but are kept for the user's books.
+func ArchiveRecord(id string) error {
+	return resolveLedgerIssue(id, func(issue LedgerIssue, ledger *Ledger) error {
+		return ledger.archiveRecord(id, fmt.Sprintf("%s: %s", issue.Kind, issue.Message))
+	})
+}
+
+// archiveInit creates the table archived records are moved to. It has the columns of the RECORDS table,
+// and the time each record was archived at and why.
+var (
+	archiveInit = strings.TrimSuffix(recordsTable("IF NOT EXISTS ARCHIVED_RECORDS"), ")") +
+		", ARCHIVED_AT TEXT NOT NULL DEFAULT '', REASON TEXT NOT NULL DEFAULT '')"
+	archiveMove = moveRecordOp("ARCHIVED_RECORDS", "ARCHIVED_AT", "REASON")
+)
+
+// archiveRecord moves the record `id` into the ARCHIVED_RECORDS table.
+func (l *Ledger) archiveRecord(id, reason string) (err error) {
+	store, c, done, err := l.open()
+	if err != nil {
+		return
+	}
+	defer done()
+	if err = store.ArchiveRecord(c, id, time.Now().Format(time.RFC3339), reason); err != nil {
+		return
+	}
+	debugf("Archived record %s. Reason: %s", id, reason)
+	return
+}
@@ -0,0 +1,352 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `backup.go` keeps local backups of the ledger, the trade journal and the profit stats, so the records
+*  of open positions survive a damaged database or a reinstall. Each backup is a folder in the backups
+*  folder of the data folder, named after the time it was taken. The databases are copied by the stores
+*  that keep them open, with SQLite's VACUUM INTO or a bbolt transaction, which take a consistent copy even
+*  while the bot writes to them. Backups are taken on a
+*  schedule while the bot runs, and the oldest are deleted so only the latest few are kept.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the format of the names of the backup folders. They sort in the order they were taken.
+const backupTimeFormat = "20060102-150405"
+
+// BackupSettings configures the scheduled backups of the ledger and stats.
+type BackupSettings struct {
+	Enabled bool
+	// Interval is the number of hours between scheduled backups.
+	Interval int32
+	// Keep is the number of backups kept. The oldest are deleted when a backup is taken.
+	Keep int32
+}
+
+// DefaultBackup backs up the ledger once a day and keeps a week of backups.
+var DefaultBackup = BackupSettings{Enabled: true, Interval: 24, Keep: 7}
+
+var (
+	// ErrNoBackup is returned when a backup to restore does not exist.
+	ErrNoBackup = errors.New("no such backup")
+	// ErrBackupWhileRunning is returned when a backup is restored while the bot is trading.
+	ErrBackupWhileRunning = errors.New("stop the bot before restoring a backup")
+	// ErrNothingToBackUp is returned when a backup is taken before there is a ledger or stats.
+	ErrNothingToBackUp = errors.New("there is nothing to back up yet")
+)
+
+// backupMu keeps backups and restores from running at the same time.
+var backupMu sync.Mutex
+
+// Backup is a copy of the ledger and stats taken at `Time`.
+type Backup struct {
+	Name string
+	Path string
+	Time time.Time
+	// Files are the names of the files in the backup.
+	Files []string
+}
+
+// BackupDir returns the folder the backups of the current trading mode are kept in.
+func BackupDir() string {
+	return filepath.Join(dataDir(), "backups")
+}
+
+// backupDatabases returns the databases that are backed up, keyed by their names in a backup. Ledgers
+// kept on a server are backed up by the server.
+func backupDatabases() map[string]string {
+	databases := map[string]string{filepath.Base(journalPath()): journalPath()}
+	if _, local := localLedger(); local {
+		databases[filepath.Base(ledgerPath())] = ledgerPath()
+	}
+	return databases
+}
+
+// backupStats returns the names of the stats files in the data folder that are backed up. The stats are
+// now kept in the ledger, but backups taken before they were may hold the files, which are moved into a
+// restored ledger that has no profits when it is opened.
+func backupStats() (names []string) {
+	names = []string{"sales.json", "purchases.json"}
+	for _, asset := range cfg().SupportedAssets {
+		names = append(names, fmt.Sprintf("%s-stats.json", strings.ToLower(assetNames[asset])))
+	}
+	return
+}
+
+// BackupLedger backs up the ledger, the trade journal and the stats, then deletes the oldest backups so
+// only `config.Backup.Keep` are left. Files that do not exist yet are skipped.
+func BackupLedger() (backup Backup, err error) {
+	if cfg() == nil {
+		return backup, errors.New("the settings have not been loaded")
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	backup, err = takeBackup()
+	if err != nil {
+		return
+	}
+	return backup, rotateBackups(int(cfg().Backup.Keep))
+}
+
+// takeBackup copies the databases and stats to a new backup folder. The caller must hold `backupMu`.
+func takeBackup() (backup Backup, err error) {
+	backup.Time = time.Now()
+	backup.Name = backup.Time.Format(backupTimeFormat)
+	backup.Path = filepath.Join(BackupDir(), backup.Name)
+	if exists(backup.Path) {
+		// A backup was already taken this second.
+		backup.Name += "-1"
+		backup.Path += "-1"
+	}
+	// The backup is written to a temporary folder, so a failed backup is never restored.
+	tmp := backup.Path + ".tmp"
+	if err = os.MkdirAll(tmp, 0755); err != nil {
+		return
+	}
+	defer os.RemoveAll(tmp)
+	for name, path := range backupDatabases() {
+		if !exists(path) {
+			continue
+		}
+		dest := filepath.Join(tmp, name)
+		if path == journalPath() {
+			err = copyJournal(dest)
+		} else {
+			err = copyLedger(path, dest)
+		}
+		if err != nil {
+			return backup, fmt.Errorf("could not back up %s: %w", name, err)
+		}
+		backup.Files = append(backup.Files, name)
+	}
+	for _, name := range backupStats() {
+		path := filepath.Join(dataDir(), name)
+		if !exists(path) {
+			continue
+		}
+		if err = copyFile(path, filepath.Join(tmp, name)); err != nil {
+			return backup, fmt.Errorf("could not back up %s: %w", name, err)
+		}
+		backup.Files = append(backup.Files, name)
+	}
+	if len(backup.Files) == 0 {
+		return backup, ErrNothingToBackUp
+	}
+	sort.Strings(backup.Files)
+	if err = os.Rename(tmp, backup.Path); err != nil {
+		return
+	}
+	syncDir(BackupDir())
+	return backup, nil
+}
+
+// copyLedger writes a consistent copy of the local ledger at `path` to `dest` through its storage.
+func copyLedger(path, dest string) error {
+	store, err := sharedStorage(path)
+	if err != nil {
+		return err
+	}
+	copier, ok := store.(interface{ copyTo(dest string) error })
+	if !ok {
+		return fmt.Errorf("the ledger at %s can not be copied", path)
+	}
+	return copier.copyTo(dest)
+}
+
+// copyFile copies the file at `src` to `dest`, replacing it if it exists.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// rotateBackups deletes the oldest backups so only `keep` are left. Zero or less keeps every backup.
+func rotateBackups(keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	backups, err := Backups()
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(backups); i++ {
+		if err = os.RemoveAll(backups[i].Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Backups returns the backups of the current trading mode, from the latest.
+func Backups() (backups []Backup, err error) {
+	infos, err := ioutil.ReadDir(BackupDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasSuffix(info.Name(), ".tmp") {
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(info.Name(), "-1"), time.Local)
+		if err != nil {
+			continue
+		}
+		backup := Backup{Name: info.Name(), Path: filepath.Join(BackupDir(), info.Name()), Time: t}
+		files, err := ioutil.ReadDir(backup.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			backup.Files = append(backup.Files, f.Name())
+		}
+		backups = append(backups, backup)
+	}
+	sort.SliceStable(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// RestoreBackup replaces the ledger, the trade journal and the stats with those of the backup `name`. The
+// current files, if any, are backed up first, so a restore can be undone by restoring that backup. Files
+// missing from the backup are left as they are. The bot must be stopped.
+func RestoreBackup(name string) (undo Backup, err error) {
+	if cfg() == nil {
+		return undo, errors.New("the settings have not been loaded")
+	}
+	healthMu.Lock()
+	running := loopRunning
+	healthMu.Unlock()
+	if running {
+		return undo, ErrBackupWhileRunning
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	path := filepath.Join(BackupDir(), filepath.Base(name))
+	if name == "" || !exists(path) {
+		return undo, fmt.Errorf("%w (%q)", ErrNoBackup, name)
+	}
+	undo, err = takeBackup()
+	if errors.Is(err, ErrNothingToBackUp) {
+		// There is nothing to undo, e.g. after a reinstall.
+		undo = Backup{}
+	} else if err != nil {
+		return undo, fmt.Errorf("could not back up the current ledger before restoring: %w", err)
+	}
+	// The open journal and ledger are closed so they are not written to while they are replaced.
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	closeJournal()
+	closeLedgers()
+	restore := map[string]string{}
+	for file, dest := range backupDatabases() {
+		restore[file] = dest
+	}
+	for _, file := range backupStats() {
+		restore[file] = filepath.Join(dataDir(), file)
+	}
+	for file, dest := range restore {
+		src := filepath.Join(path, file)
+		if !exists(src) {
+			continue
+		}
+		// The copy replaces the file in one step, so an interrupted restore never leaves half a database.
+		tmp := dest + ".restore"
+		if err = copyFile(src, tmp); err != nil {
+			return undo, fmt.Errorf("could not restore %s: %w", file, err)
+		}
+		// Journaling files of the replaced database would be applied to the restored one.
+		for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+			os.Remove(dest + suffix)
+		}
+		if err = os.Rename(tmp, dest); err != nil {
+			os.Remove(tmp)
+			return undo, fmt.Errorf("could not restore %s: %w", file, err)
+		}
+	}
+	syncDir(dataDir())
+	return undo, nil
+}
+
+// Backuper takes scheduled backups of the ledger and stats.
+type Backuper struct {
+	interval time.Duration
+	stop     chan struct{}
+}
+
+// NewBackuper creates a backuper that takes a backup every `interval`.
+func NewBackuper(interval time.Duration) *Backuper {
+	return &Backuper{interval: interval, stop: make(chan struct{})}
+}
+
+// Run starts taking backups until Stop is called. The first is taken once `interval` has passed since
+// the latest backup, which may be right away.
+func (b *Backuper) Run() {
+	if b.interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			next := time.Now()
+			if backups, err := Backups(); err == nil && len(backups) > 0 {
+				next = backups[0].Time.Add(b.interval)
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-b.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+				backup, err := BackupLedger()
+				if err != nil {
+					debugf("Could not back up the ledger. Reason: %v", err)
+					// Try again after an interval instead of right away.
+					select {
+					case <-b.stop:
+						return
+					case <-time.After(b.interval):
+					}
+					continue
+				}
+				debugf("Backed up the ledger to %s", backup.Path)
+			}
+		}
+	}()
+}
+
+// Stop stops taking backups.
+func (b *Backuper) Stop() {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+}
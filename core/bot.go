@@ -8,12 +8,16 @@ of price for an asset, say Bitcoin. If the price has been steadily increasing
 */
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"math"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	luno "github.com/luno/luno-go"
@@ -41,19 +45,36 @@ var (
 )
 
 var (
-	initialRound      bool   = false
 	loggerinitialized bool   = false
 	timeFormat        string = "2006-01-02 15:04:05"
 	// Logger for bot-related operations.
 	Logger *log.Logger
 
-	bot    *Bot
-	config *Configuration
+	bot *Bot
+	// activeConfig holds the settings in use, which the goroutines of the bot read without locks. Published
+	// settings are never changed in place. A changed copy is published instead, under `configMu`.
+	activeConfig atomic.Value
+	configMu     sync.Mutex
 )
 
 // SetConfig sets the package wide Configuration values for early access. (to be used by the UI.)
-func SetConfig(cfg *Configuration) {
-	config = cfg
+// A copy of `settings` is used, so it must be set again after the settings are changed.
+func SetConfig(settings *Configuration) {
+	if settings != nil {
+		settings = settings.Clone()
+	}
+	publishConfig(settings)
+}
+
+// cfg returns the settings in use. They must not be changed; see `publishConfig`.
+func cfg() *Configuration {
+	c, _ := activeConfig.Load().(*Configuration)
+	return c
+}
+
+// publishConfig makes `c` the settings in use. `c` must not be changed afterwards.
+func publishConfig(c *Configuration) {
+	activeConfig.Store(c)
 }
 
 // Channels
@@ -102,10 +123,16 @@ func (bot *Bot) InitChannels(chans *Channels) {
 	// for debug funcs
 	logChannel = bot.chans.LogChan
 	cancelled = func() bool {
+		if stopRequested() {
+			// Every goroutine of the trading loop stops, not only the one that received the signal.
+			return true
+		}
 		select {
 		case <-UIChans.CancelChan:
-			// Send a signal to the UI that we have recieved its STOP signal
-			UIChans.StoppedChan <- struct{}{} // Note: This must come first.
+			requestStop()
+			// Send a signal to the UI that we have recieved its STOP signal. The UI may have exited, so
+			// the bot does not wait for it to be received.
+			go func() { UIChans.StoppedChan <- struct{}{} }() // Note: This must come first.
 
 			// Stop the bot if critical operation not happening
 			// Check that we are not in a ledger/purchase/sale function first
@@ -125,235 +152,486 @@ func (bot *Bot) Run(settings *Configuration) error {
 	if !channelsInitialized {
 		return ErrChannelsNotInitialized
 	}
+	if settings.ChangelogPending() {
+		// Trading under a new version must not start before the user has reviewed its changes.
+		UIChans.ErrorChan <- ErrChangelogNotAcknowledged
+		return ErrChangelogNotAcknowledged
+	}
 	debug("Initializing...")
-	config = settings
-	for {
-		// Attempt to connect to the API and initialize clients for each asset.
+	clearStop()
+	// The bot trades with its own copy of the settings. Those the user saves while it runs are sent over
+	// the config channel.
+	publishConfig(settings.Clone())
+	ServeHealth()
+	ServeWebhook()
+	setLoopRunning(true)
+	defer setLoopRunning(false)
+	// Settings saved after the last safe point are applied when the bot stops, so they are not lost.
+	defer bot.applyConfigChanges()
+	if err := SetPatternSensitivity(cfg().Trade.PatternSensitivity); err != nil {
+		debugf("Invalid candlestick pattern settings. The defaults will be used. Reason: %v", err)
+		SetPatternSensitivity(DefaultPatternSensitivity)
+	}
+	// Attempt to connect to the API and initialize clients for each asset. Leprechaun tries again, waiting
+	// longer each time, until it connects or the error can not pass, e.g. the API key is invalid.
+	err := retry(context.Background(), connectRetryPolicy(), func() error {
 		err := bot.startup()
+		recordExchangeResult(err)
 		if err != nil {
 			fmt.Printf("init bot err in bot.go: %v\n", err)
-			if cancelled() {
-				return ErrCancelled
-			}
-			// We could not connect to the luno API.
-			// Probably due to a network error.
-			if config.ExitOnInitFailed || err == ErrInvalidAPICredentials {
-				// if the `config.ExitOnInitFailed` flag is set to true, Leprechaun will exit with an error.
-				UIChans.ErrorChan <- ErrInvalidAPICredentials
-				UIChans.StoppedChan <- struct{}{}
-			} else {
-				// We continue to try after a short wait until we connect.
-				debug("Leprechaun will try to connect again after some time...")
-				// shortSnooze()
-				if cancelled() {
-					return ErrCancelled
-				}
-				var e error
-				if err == ErrNetworkFailed {
-					if bot.connectRetries != 0 {
-						// Network error lets wait ten seconds
-						bot.connectRetries--
-						e = snoozeSeconds(10)
-						if e != nil {
-							return e
-						}
-						continue // retry
-					}
-				}
-				e = snooze(5) // Wait 5 minutes
-				if e != nil {
-					return e
-				}
-			}
-		} else {
-			// We have at least one client initialized. We can proceed with the trading loop.
-			break
+			debug("Leprechaun will try to connect again after some time...")
+		}
+		return err
+	})
+	if err != nil {
+		if err == ErrCancelled || cancelled() {
+			return ErrCancelled
 		}
+		// We could not connect to the luno API.
+		UIChans.ErrorChan <- err
+		UIChans.StoppedChan <- struct{}{}
+		return err
 	}
-	initialRound = true
-	var roundNo int = 1
-	var signal SIGNAL
-	var purchaseUnitToosmall int = 0
+	// Start following the orders placed by leprechaun, including those left over from previous sessions.
+	bot.orders = NewOrderTracker(filepath.Join(dataDir(), "orders.json"))
+	orderTracker = bot.orders
+	trackedClients := []*Client{}
+	for i := range bot.clients {
+		trackedClients = append(trackedClients, &bot.clients[i])
+	}
+	bot.orders.Run(trackedClients)
+	defer bot.orders.Stop()
+	// Record any orders that were placed but not written to the ledger before Leprechaun last stopped.
+	orderIntents = NewIntentJournal(filepath.Join(dataDir(), "intents.json"))
+	// Retry ledger writes that failed before Leprechaun last stopped.
+	retryQueue = NewRetryQueue(filepath.Join(dataDir(), "retries.json"))
+	retryQueue.Run()
+	defer retryQueue.Stop()
+	for i := range bot.clients {
+		bot.ReconcileIntents(&bot.clients[i])
+	}
+	notifications.Configure(cfg().Notifications)
+	// Report orders that were placed, or cancelled, on the exchange without the ledger knowing.
+	for i := range bot.clients {
+		bot.ReconcileOrders(&bot.clients[i])
+	}
+	// Check the older records in the ledger against the exchange's history. Each asset checks its own again once a day.
+	for i := range bot.clients {
+		bot.AuditLedger(&bot.clients[i])
+	}
+	snapshots := NewSnapshotter(time.Duration(cfg().SnapshotInterval)*time.Minute, trackedClients)
+	snapshots.Run()
+	defer snapshots.Stop()
+	if cfg().Backup.Enabled {
+		backups := NewBackuper(time.Duration(cfg().Backup.Interval) * time.Hour)
+		backups.Run()
+		defer backups.Stop()
+	}
+	stopStateWriter := make(chan struct{})
+	bot.runStateWriter(stopStateWriter)
+	defer close(stopStateWriter)
+	defer notifications.FlushDigests(true)
+
+	// Risk limits such as the maximum drawdown are measured from the start of the session.
+	bot.risk = NewRiskManager()
+	bot.recordStartEquity()
+	strategy.reset(cfg().Trade.AnalysisPlugin.Name)
+	defer roundEvents.close()
+	// Each asset is traded in rounds of its own by a goroutine. The checks made for all assets together are made here.
+	group := newClientGroup()
+	defer group.wait()
 	for {
 		// This is the main trading loop.
-		for clientNo := 0; clientNo < len(bot.clients); clientNo++ {
-			if cancelled() {
-				return ErrCancelled
+		// No asset is analyzed or placing an order while the settings saved since the last check are applied.
+		bot.applyConfigChanges()
+		bot.startNewClients()
+		refreshPairStatuses(bot.clients)
+		bot.superviseClients(group)
+		if cfg().Paper.Enabled && cfg().Paper.Rounds > 0 && group.running() == 0 {
+			if err := group.wait(); err != nil {
+				return err
 			}
-			cl := bot.clients[clientNo]
-			debugf("<========[ %s | Trading Round: %d ]========>", cl.name, roundNo)
+			// Every asset has traded the rounds of the guided paper trading session.
+			notify(EventInfo, "", "Paper trading session complete.\n%s", PaperSummary())
+			notifications.FlushDigests(true)
+			UIChans.StoppedChan <- struct{}{}
+			return ErrPaperSessionComplete
+		}
+		if err := waitSupervision(group); err != nil {
+			group.wait()
+			return err
+		}
+		if err := bot.checkSessionEquity(); err != nil {
+			group.wait()
+			notify(EventAlert, "", "Leprechaun has stopped trading. Reason: %v", err)
+			notifications.FlushDigests(true)
+			UIChans.StoppedChan <- struct{}{}
+			return err
+		}
+		notifications.FlushDigests(false)
+	}
+}
 
-			feeInfo, err := cl.FeeInfo()
-			if err != nil {
-				debugf("Error! Could not retrieve fee info for %s. %v", cl.Pair, err)
-				continue
-			}
+// tradeClient trades `cl` in rounds until `c` is done or trading must stop. It returns nil when the
+// client has traded every round of a guided paper trading session.
+func (bot *Bot) tradeClient(c context.Context, cl Client, group *clientGroup) error {
+	defer markPurchaseUnit(cl.asset, false, 0)
+	lastAudit := time.Now()
+	for roundNo := 1; ; roundNo++ {
+		if err := bot.tradeRound(c, cl, roundNo, group); err != nil {
+			return err
+		}
+		if cfg().Paper.Enabled && cfg().Paper.Rounds > 0 && roundNo >= int(cfg().Paper.Rounds) {
+			return nil
+		}
+		// Check the older records of the asset against the exchange's history once a day.
+		if time.Since(lastAudit) >= ledgerAuditInterval {
+			bot.AuditLedger(&cl)
+			lastAudit = time.Now()
+		}
+		minutes := snoozeMinutes()
+		debugf("Leprechaun will trade %s again in %d minute(s).", cl.name, minutes)
+		if err := snoozeFor(c, time.Duration(minutes)*time.Minute); err != nil {
+			return err
+		}
+	}
+}
 
-			if cancelled() {
-				return ErrCancelled
-			}
+// tradeRound trades a round of `cl`. Each round works on a copy of the client.
+func (bot *Bot) tradeRound(c context.Context, cl Client, roundNo int, group *clientGroup) error {
+	if c.Err() != nil {
+		return c.Err()
+	}
+	if cancelled() {
+		return ErrCancelled
+	}
+	heartbeat()
+	scheduler.startTurn(cl.asset)
+	defer scheduler.endTurn(cl.asset)
+	evt := newRoundEvent(roundNo, &cl)
+	defer emitRoundEvent(evt, &cl)
+	debugf("<========[ %s | Trading Round: %d ]========>", cl.name, roundNo)
+	if err := cl.checkPairStatus(); err != nil {
+		debugf("Leprechaun will not open new %s positions. Reason: %v", cl.name, err)
+		evt.skip(err)
+		if cfg().Trade.PairStatus.ExitPositions {
+			bot.exitPair(&cl)
+		}
+		return nil
+	}
+	if err := checkAPIPause(cl.asset); err != nil {
+		debugf("Leprechaun will not trade %s in this round. Reason: %v", cl.name, err)
+		evt.skip(err)
+		return nil
+	}
 
-			takerFee, _ := strconv.ParseFloat(feeInfo.TakerFee, 64)
-			if initialRound {
-				// Luno charges a taker fee for market orders.
-				// we compensate for that by buying more than
-				// the specified purchase Unit.
-				thirtyDayVol, _ := strconv.ParseFloat(feeInfo.ThirtyDayVolume, 64)
-				debugf("30 day trading volume: %.2f %s. | Luno taker fee for %s is %.1f%s",
-					thirtyDayVol, cl.asset, cl.name, takerFee*100, "%")
-			}
-			debugf("Your account balance is %.2f %s", cl.fiatBalance, cl.currency)
-			currentPrice, err := cl.CurrentPrice()
-			if err != nil {
-				debugf("Could not retrieve price info for %s. Reason: %s", cl.name, err)
-				if len(bot.clients) == 1 {
-					if cancelled() {
-						return ErrCancelled
-					}
-					// If we are only trading a  single asset. we should wait for some time.
-					e := snooze(1) // Wait for a minute
-					if e != nil {
-						return e
-					}
-				}
-				continue
-			}
+	feeInfo, err := cl.FeeInfo()
+	if err != nil {
+		debugf("Error! Could not retrieve fee info for %s. %v", cl.Pair, err)
+		evt.skip(err)
+		return nil
+	}
 
-			if config.PurchaseUnit < (cl.minOrderVol * currentPrice) {
-				debugf("The purchase amount you have specified %.2f can not purchase more than the minimum volume of %s that can be traded on the exchange (i.e %.2f %s)",
-					config.PurchaseUnit, cl.name, cl.minOrderVol, cl.asset)
-				purchaseUnitToosmall++
-				if len(bot.clients) == purchaseUnitToosmall {
-					UIChans.StoppedChan <- struct{}{}
-					return ErrInvalidPurchaseUnit
-				}
-				// continue the trading loop and move on to the next client
-				continue
-			}
-			debugf("The current ask price of %s(%s) is %s %.3f. Ask-Bid Spread is %.2f\n", cl.name, cl.asset, cl.currency, currentPrice, cl.spread)
+	if cancelled() {
+		return ErrCancelled
+	}
 
-			config.AdjustedPurchaseUnit = float64(config.PurchaseUnit) + (takerFee * float64(config.PurchaseUnit))
-			canPurchase, err := cl.CheckBalanceSufficiency()
-			if err != nil {
-				log.Println(err)
-			}
-			debug("Leprechaun is analyzing market data...")
-			signal, err = bot.Emit(&cl)
-			if err != nil {
-				debugf("Analysis for %s incomplete. Reason: %s. Will skip.", cl.name, err.Error())
-				continue
-			}
-			debugf("Recommended action for %s based on market analysis: %v", cl.name, signal)
+	takerFee, _ := strconv.ParseFloat(feeInfo.TakerFee, 64)
+	setTakerFee(cl.Pair, takerFee)
+	if roundNo == 1 {
+		// Luno charges a taker fee for market orders.
+		// we compensate for that by buying more than
+		// the specified purchase Unit.
+		thirtyDayVol, _ := strconv.ParseFloat(feeInfo.ThirtyDayVolume, 64)
+		debugf("30 day trading volume: %.2f %s. | Luno taker fee for %s is %.1f%s",
+			thirtyDayVol, cl.asset, cl.name, takerFee*100, "%")
+	}
+	if err = cl.retrieveBalances(); err != nil {
+		debugf("Could not retrieve your %s balance. Reason: %v", cl.currency, err)
+	}
+	debugf("Your account balance is %.2f %s", cl.fiatBalance, cl.currency)
+	currentPrice, err := cl.CurrentPrice()
+	recordExchangeResult(err)
+	if err == nil {
+		bot.equity.observe(&cl, currentPrice)
+	}
+	if err != nil {
+		debugf("Could not retrieve price info for %s. Reason: %s", cl.name, err)
+		evt.skip(err)
+		if group.running() == 1 {
 			if cancelled() {
 				return ErrCancelled
 			}
+			// If we are only trading a  single asset. we should wait for some time.
+			return snoozeFor(c, time.Minute)
+		}
+		return nil
+	}
+	evt.Price, evt.Spread = currentPrice, cl.spread
+	if err = cl.checkReferencePrice(currentPrice); err != nil {
+		// Open positions are not closed at a suspicious price either.
+		debugf("Leprechaun will not trade %s in this round. Reason: %v", cl.name, err)
+		evt.skip(err)
+		return nil
+	}
+	bot.updateDailyLoss(&cl, currentPrice)
+	if err = bot.checkFlashMove(&cl, currentPrice); err != nil {
+		debugf("Leprechaun will not trade %s in this round. Reason: %v", cl.name, err)
+		evt.skip(err)
+		return nil
+	}
+	if err = bot.checkOpenPositions(); err != nil {
+		// Only the open positions are worked on until some of them are closed.
+		debugf("Leprechaun will not open a %s position. Reason: %v", cl.name, err)
+		evt.skip(err)
+		bot.completeTrades(&cl)
+		return nil
+	}
 
-			var (
-				record         Record
-				purchaseVolume float64
-			)
-			if cl.name == RippleCoin && bot.exchange == ExchangeLuno {
-				// Luno only trades single units of ripple coin i.e no fractional or decimal units
-				purchaseVolume = math.Floor(config.AdjustedPurchaseUnit / currentPrice)
-			} else {
-				purchaseVolume = config.AdjustedPurchaseUnit / currentPrice
-			}
-			// volFormatted := strconv.FormatFloat(vol, 'f', -1, 64)
-			// purchaseVolume, _ := strconv.ParseFloat(volFormatted, 64)
-
-			switch signal {
-			case SignalLong:
-				// Go long
-				if canPurchase {
-					// Try to purchase `Client.asset`
-					record, err = cl.GoLong(purchaseVolume)
-					if err != nil {
-						debugf("An error occured while trying to purchase %.2f %s >> %s  ", purchaseVolume, cl.asset, err.Error())
-					}
-				} else {
-					// We don't have purchasing power.
-					if cancelled() {
-						return ErrCancelled
-					}
-					debugf("Leprechaun will not purchase any %s assets in this trading round as your balance (%s%.2f) is insufficent. Fund your account or specify a lower purchase unit.",
-						cl.name, cl.currency, cl.fiatBalance)
-				}
+	sizer := positionSizer()
+	purchaseUnit := sizer.Size(&cl, currentPrice)
+	if purchaseUnit < (cl.minOrderVol * currentPrice) {
+		debugf("The purchase amount you have specified %.2f can not purchase more than the minimum volume of %s that can be traded on the exchange (i.e %.2f %s)",
+			purchaseUnit, cl.name, cl.minOrderVol, cl.asset)
+		evt.skip(ErrInvalidPurchaseUnit)
+		if markPurchaseUnit(cl.asset, true, group.running()) {
+			UIChans.StoppedChan <- struct{}{}
+			return ErrInvalidPurchaseUnit
+		}
+		// The other assets are traded on.
+		return nil
+	}
+	markPurchaseUnit(cl.asset, false, group.running())
+	debugf("The current ask price of %s(%s) is %s %s. Ask-Bid Spread is %.2f\n", cl.name, cl.asset, cl.currency,
+		GetPairInfo(cl.Pair).FormatPrice(currentPrice), cl.spread)
 
-			case SignalShort:
-				// Go Short
-				record, err = cl.GoShort(math.Abs(purchaseVolume))
-				if cancelled() {
-					return ErrCancelled
-				}
+	if sizer.Name() != SizerFixedAmount {
+		debugf("Leprechaun will spend %s %.2f on each %s purchase in this round (%s sizing).",
+			cl.currency, purchaseUnit, cl.name, strings.Replace(sizer.Name(), "_", " ", -1))
+	} else if cfg().PurchasePercentage > 0 {
+		debugf("Leprechaun will spend %s %.2f (%.1f%s of your balance) on each %s purchase in this round.",
+			cl.currency, purchaseUnit, cfg().PurchasePercentage*100, "%", cl.name)
+	}
+	adjustedPurchaseUnit := purchaseUnit + (takerFee * purchaseUnit)
+	canPurchase, err := cl.CheckBalanceSufficiency(adjustedPurchaseUnit)
+	if err != nil {
+		log.Println(err)
+	}
+	var (
+		signal     SIGNAL
+		idle       bool
+		confidence float64
+	)
+	if signal, confidence, idle = idleSignal(&cl, currentPrice); idle {
+		debugf("No change in the %s market since its last analysis. The previous signal is used.", cl.name)
+		evt.SignalReused = true
+	} else {
+		debug("Leprechaun is analyzing market data...")
+		analysisStarted := time.Now()
+		signal, confidence, err = bot.Emit(&cl)
+		evt.AnalysisMs = time.Since(analysisStarted).Milliseconds()
+		if err != nil {
+			debugf("Analysis for %s incomplete. Reason: %s. Will skip.", cl.name, err.Error())
+			evt.skip(err)
+			return nil
+		}
+		recordIdleBaseline(&cl, currentPrice, signal, confidence)
+	}
+	evt.Signal, evt.Confidence = signal, confidence
+	debugf("Recommended action for %s based on market analysis: %v (%.0f%% confident)", cl.name, signal, confidence*100)
+	streak := recordSignal(cl.asset, signal)
+	accuracy := recordOutcome(cl.asset, signal, currentPrice)
+	if bot.checkStrategy() && signal != SignalWait {
+		debugf("Leprechaun will not act on the %v signal for %s. The analysis plugin has been retired.", signal, cl.name)
+		signal = SignalWait
+	}
+	if err = checkConfidence(signal, confidence); err != nil {
+		debugf("Leprechaun will not act on the %v signal for %s. Reason: %v", signal, cl.name, err)
+		signal = SignalWait
+	}
+	if cancelled() {
+		return ErrCancelled
+	}
 
-			case SignalWait:
-				// Market is indeterminate. Wait.
-				debug("The ", cl.asset, " market is indeterminate at this time. Will not buy or sell.")
-			}
-			if len(record.ID) > 0 {
-				// A trade has been executed. Here, we update the order details with server-side parameters.
-				updatedRecord, err := cl.UpdateOrderDetails(record)
-				if err != nil {
-					// N.B: User doesn't have to see this as they don't know
-					// what's happening in this section.
-					// Should be removed after testing is complete.
-					debugf("Update failed: %v", err)
-					// revert to our calulated values
-					updatedRecord = record
-				}
-				// Save our purchase to the ledger.
-				err = bot.addRecordToLedger(updatedRecord)
-				if err != nil {
-					debug("Error: ", err)
-					e := errors.New("could not add record with id: " + record.ID + " to the ledger")
-					UIChans.ErrorChan <- e
-					return ErrCancelled
-				}
-				// Send an alert on the purchase channel
+	var purchaseVolume float64
+	if cl.name == RippleCoin && bot.exchange == ExchangeLuno {
+		// Luno only trades single units of ripple coin i.e no fractional or decimal units
+		purchaseVolume = math.Floor(adjustedPurchaseUnit / currentPrice)
+	} else {
+		purchaseVolume = adjustedPurchaseUnit / currentPrice
+	}
+	// volFormatted := strconv.FormatFloat(vol, 'f', -1, 64)
+	// purchaseVolume, _ := strconv.ParseFloat(volFormatted, 64)
+	purchaseVolume = bot.streakVolume(&cl, signal, purchaseVolume, currentPrice, accuracy)
+	purchaseVolume = bot.volatilityVolume(&cl, signal, purchaseVolume, currentPrice)
+	purchaseVolume = bot.confidenceVolume(&cl, signal, purchaseVolume, confidence)
+	if err = bot.actOnSignal(&cl, evt, signal, purchaseVolume, currentPrice, canPurchase, streak); err != nil {
+		return err
+	}
+	if cancelled() {
+		return ErrCancelled
+	}
+	// Make the next purchase of a running DCA plan if it is due.
+	if dcaRecord, err := bot.ContinueDCA(&cl); err != nil {
+		debugf("An error occured while continuing the DCA plan for %s. Reason: %v", cl.name, err)
+	} else if len(dcaRecord.ID) > 0 {
+		UIChans.PurchaseChan <- struct{}{}
+	}
+	// We try to complete any viable pending transaction in every round
+	bot.completeTrades(&cl)
+	return nil
+}
+
+// actOnSignal checks the limits on new positions and places the order `signal` calls for. The assets
+// act on their signals one at a time, so the limits are checked against the positions opened by the others.
+func (bot *Bot) actOnSignal(cl *Client, evt *RoundEvent, signal SIGNAL, purchaseVolume, currentPrice float64, canPurchase bool, streak int) (err error) {
+	orderMu.Lock()
+	defer orderMu.Unlock()
+	signal = bot.withinLimits(cl, signal, purchaseVolume, currentPrice)
+	if cfg().Trade.ManualApproval && (signal == SignalShort || (signal == SignalLong && canPurchase)) {
+		// Ask the user before placing the order. The other assets may place orders while the user decides.
+		orderMu.Unlock()
+		err = bot.requestApproval(cl, signal, currentPrice, purchaseVolume)
+		orderMu.Lock()
+		if err == ErrCancelled {
+			return ErrCancelled
+		} else if err != nil {
+			debugf("Leprechaun will not trade %s in this round. Reason: %v", cl.name, err)
+			signal = SignalWait
+		} else if bot.withinLimits(cl, signal, purchaseVolume, currentPrice) != signal {
+			// The positions opened in the meantime count against the limits.
+			debugf("The approved %v trade for %s is no longer within your limits and will not be placed.", signal, cl.name)
+			signal = SignalWait
+		}
+	}
+
+	var record Record
+	switch signal {
+	case SignalLong:
+		// Go long
+		if base, ok := bot.pyramidBase(cl.asset); ok && canPurchase {
+			// Add to the open position instead of opening a new one.
+			addRecord, err := bot.Pyramid(cl, base, currentPrice, purchaseVolume, streak)
+			if err != nil {
+				debugf("Leprechaun will not add to the %s position. Reason: %v", cl.name, err)
+			} else if len(addRecord.ID) > 0 {
 				UIChans.PurchaseChan <- struct{}{}
 			}
-			if cancelled() {
-				return ErrCancelled
+		} else if canPurchase && cfg().Trade.DCA.Enabled {
+			// Spread the purchase over the DCA window.
+			dcaRecord, err := bot.StartDCA(cl, purchaseVolume)
+			if err == ErrDCAPlanActive {
+				debugf("Leprechaun is still building a %s position. The signal will be ignored.", cl.name)
+			} else if err != nil {
+				debugf("Could not start a DCA plan for %s. Reason: %v", cl.name, err)
+			} else if len(dcaRecord.ID) > 0 {
+				UIChans.PurchaseChan <- struct{}{}
 			}
-			// We try to complete any viable pending transaction in every round
-			err = bot.CompleteLongTrades(&cl)
+		} else if canPurchase {
+			// Try to purchase `Client.asset`
+			record, err = cl.GoLong(purchaseVolume)
 			if err != nil {
-				debugf("An error occured while trying to cleanup pending long trades. Reason: %v", err)
+				debugf("An error occured while trying to purchase %.2f %s >> %s  ", purchaseVolume, cl.asset, err.Error())
 			}
-			err = bot.CompleteShortTrades(&cl)
-			if err != nil {
-				debugf("An error occured while trying to cleanup pending short trades. Reason: %v", err)
+		} else {
+			// We don't have purchasing power.
+			if cancelled() {
+				return ErrCancelled
 			}
+			debugf("Leprechaun will not purchase any %s assets in this trading round as your balance (%s%.2f) is insufficent. Fund your account or specify a lower purchase unit.",
+				cl.name, cl.currency, cl.fiatBalance)
 		}
-		initialRound = false
-		if cancelled() {
+
+	case SignalShort:
+		// Go Short
+		// The order is recorded in the ledger below even if the bot is being stopped.
+		record, err = cl.GoShort(math.Abs(purchaseVolume))
+
+	case SignalWait:
+		// Market is indeterminate. Wait.
+		debug("The ", cl.asset, " market is indeterminate at this time. Will not buy or sell.")
+	}
+	if len(record.ID) > 0 {
+		// A trade has been executed. Here, we update the order details with server-side parameters.
+		updatedRecord, err := cl.UpdateOrderDetails(record)
+		if err != nil {
+			// N.B: User doesn't have to see this as they don't know
+			// what's happening in this section.
+			// Should be removed after testing is complete.
+			debugf("Update failed: %v", err)
+			// revert to our calulated values
+			updatedRecord = record
+		}
+		updatedRecord.Analysis = analysisOf(cl.asset)
+		// Save our purchase to the ledger.
+		err = bot.addRecordToLedger(updatedRecord)
+		if err != nil && !retryLater(PendingOperation{Kind: OpAddRecord, Record: updatedRecord}, err) {
+			debug("Error: ", err)
+			e := errors.New("could not add record with id: " + record.ID + " to the ledger")
+			notify(EventError, cl.asset, "%v", e)
+			UIChans.ErrorChan <- e
 			return ErrCancelled
 		}
-		err := Snooze()
-		if err != nil {
-			return err
+		confirmIntent(record.ClientRef)
+		evt.Action, evt.Volume, evt.RecordID = ActionLong, updatedRecord.Volume, updatedRecord.ID
+		if updatedRecord.Type == ShortOrder {
+			evt.Action = ActionShort
 		}
-		roundNo++
+		// Send an alert on the purchase channel
+		UIChans.PurchaseChan <- struct{}{}
+	}
+	return nil
+}
+
+// withinLimits returns `signal`, or SignalWait if the order it calls for would break a limit on new
+// positions. `orderMu` must be held, so the limits are checked against the positions opened by the other assets.
+func (bot *Bot) withinLimits(cl *Client, signal SIGNAL, purchaseVolume, currentPrice float64) SIGNAL {
+	if signal != SignalWait {
+		// Other assets may have opened positions since the limit was checked.
+		if err := bot.checkOpenPositions(); err != nil {
+			debugf("Leprechaun will not open a %s position. Reason: %v", cl.name, err)
+			signal = SignalWait
+		}
+	}
+	if err := cl.checkExecution(signal, purchaseVolume, currentPrice); err != nil {
+		debugf("Leprechaun will not trade %s in this round. Reason: %v", cl.name, err)
+		signal = SignalWait
+	}
+	if bot.checkRisk(cl, signal, purchaseVolume, currentPrice) != nil {
+		signal = SignalWait
+	}
+	if err := bot.checkExposureCap(cl, signal, purchaseVolume*currentPrice); err != nil {
+		debugf("Leprechaun will not open a %s position. Reason: %v", cl.name, err)
+		signal = SignalWait
+	}
+	return signal
+}
+
+// completeTrades completes the client's pending long and short trades that have become viable.
+func (bot *Bot) completeTrades(cl *Client) {
+	err := bot.CompleteLongTrades(cl)
+	if err != nil {
+		debugf("An error occured while trying to cleanup pending long trades. Reason: %v", err)
 	}
+	err = bot.CompleteShortTrades(cl)
+	if err != nil {
+		debugf("An error occured while trying to cleanup pending short trades. Reason: %v", err)
+	}
+	bot.alertStalePositions(cl.asset)
 }
 
 // NewBot create a new trading bot object
 func NewBot() *Bot {
 	bot = &Bot{
-		name:           Leprechaun,
-		exchange:       ExchangeLuno,
-		connectRetries: 3,
+		name:     Leprechaun,
+		exchange: ExchangeLuno,
 		// id:       rand.Intn(1000),
 	}
-	bot.analyzerOptions = &AnalysisOptions{
-		AnalysisPeriod: H24, // 24 Hours
-		Interval:       H1,  // Hourly interval
-		Mode:           config.Trade.TradingMode}
-	fmt.Println(bot.analyzer)
 	bot.analyzer = PluginHandler.Default
-	fmt.Println(bot.analyzer)
-	bot.SetAnalysisPlugin(PluginHandler.plugins[config.Trade.AnalysisPlugin.Name])
-	fmt.Println(bot.analyzer)
+	if plugin, ok := PluginHandler.plugins[strings.ToLower(cfg().Trade.AnalysisPlugin.Name)]; ok {
+		bot.SetAnalysisPlugin(plugin)
+	}
+	bot.analyzerOptions = ResolveAnalysisOptions(bot.analyzer, "")
 	bot.analyzer.SetOptions(bot.analyzerOptions)
 	return bot
 }
@@ -373,7 +651,7 @@ func (bot *Bot) Channels() *Channels {
 // startup initializes Leprechaun.
 func (bot *Bot) startup() error {
 	// debug("Initializing clients...")
-	Assets := config.AssetsToTrade
+	Assets := cfg().AssetsToTrade
 	if len(Assets) < 1 {
 		errStr := "Error! You have not specified any assets to trade. Please do so before starting the bot."
 		debug(errStr)
@@ -423,23 +701,29 @@ func (bot *Bot) Shutdown() {
 
 // initClient creates a new client for a specifed asset
 func initClient(asset string) (client Client, err error) {
-	client.name = assetNames[asset]
-	if asset != "XBT" && asset != "XRP" && asset != "ETH" && asset != "LTC" {
+	if !isSupportedAsset(asset) {
 		Logger.Panicf("Error! Could not initialize client. Invalid asset (%s) specified", asset)
 	}
-	if len(config.APIKeyID) == 0 || len(config.APIKeySecret) == 0 {
+	if _, ok := assetNames[asset]; !ok {
+		// Assets added from a new listing are named by their code.
+		assetNames[asset] = asset
+	}
+	client.name = assetNames[asset]
+	if !cfg().Paper.Enabled && (len(cfg().APIKeyID) == 0 || len(cfg().APIKeySecret) == 0) {
 		return client, ErrInvalidAPICredentials
 	}
 	client.asset = asset
 	client.currency = "NGN"
 	client.Pair = client.asset + client.currency // E.g. XBTNGN
 	client.Client = luno.NewClient()
-	client.Client.SetAuth(config.APIKeyID, config.APIKeySecret)
-	if asset == "XRP" {
-		client.minOrderVol = 1
+	if cfg().Paper.Enabled {
+		// Orders and balances are simulated. Prices still come from the exchange.
+		client.Client.SetAuth("paper", "paper")
 	} else {
-		client.minOrderVol = 0.0005
+		client.Client.SetAuth(cfg().APIKeyID, cfg().APIKeySecret)
 	}
+	client.Client.SetHTTPClient(newScheduledClient(asset))
+	client.minOrderVol = GetPairInfo(client.Pair).MinVolume
 	// retrieves balances and account ids
 	_, err = client.AccountID()
 	return
@@ -448,6 +732,7 @@ func initClient(asset string) (client Client, err error) {
 // CompleteShortTrades completes the second part of a long trade. The purchased asset is sold
 // at the recorded trigger price
 func (bot *Bot) CompleteShortTrades(cl *Client) error {
+	defer lockClosing(cl.asset)()
 	ledger := bot.Ledger()
 	defer ledger.Save()
 
@@ -456,6 +741,7 @@ func (bot *Bot) CompleteShortTrades(cl *Client) error {
 	)
 	// Get pending records.
 	pendingRecords, err := ledger.GetRecordsByType(cl.asset, ShortOrder)
+	pendingRecords = withoutClosing(pendingRecords)
 	if cancelled() {
 		return ErrCancelled
 	}
@@ -475,9 +761,18 @@ func (bot *Bot) CompleteShortTrades(cl *Client) error {
 			debugf("Error! (In `bot.CompleteLongTrades`) Could not retrieve current price. Reason: %v", err)
 			return err
 		}
+		// Records whose stop-loss has been reached are repurchased at a loss.
+		var stoppedRecords []Record
+		stoppedRecords, pendingRecords = stopLosses(pendingRecords, currentPrice)
+		for _, rec := range stoppedRecords {
+			notify(EventAlert, rec.Asset, "The price of %s has risen to %s. Short position %s sold at %s will be repurchased at a loss.",
+				cl.name, GetPairInfo(cl.Pair).FormatPrice(currentPrice), rec.ID, GetPairInfo(cl.Pair).FormatPrice(rec.Price))
+		}
+		viablePendingRecords = append(viablePendingRecords, stoppedRecords...)
+		pendingRecords = bot.scaleOut(ledger, pendingRecords, currentPrice)
 		for _, rec := range pendingRecords {
 			// Compare current asset price with the precalculated trigger price.
-			if currentPrice > rec.TriggerPrice {
+			if currentPrice > rec.TriggerPrice && !cl.exiting {
 				// We can't repurchase yet. The repurchase price has to be lower or equal to the trigger price.
 				// The trigger price is calculated when the short-sold asset is first sold.
 				// For Example, if the asset was sold for #100,000 and the profit margin is 3%, the trigger price
@@ -497,19 +792,19 @@ func (bot *Bot) CompleteShortTrades(cl *Client) error {
 			}
 			for n, rec := range viablePendingRecords {
 				debugf("Trying to repurchase %d out of %d short sold %v assets\n", n+1, recLen, rec.Asset)
-				orderID, err := cl.ask(currentPrice, rec.Volume)
+				// A short sold asset is closed by buying it back.
+				ref := beginIntent(OrderIntent{Pair: cl.Pair, Asset: cl.asset, Side: luno.OrderTypeBuy,
+					Price: currentPrice, Volume: rec.Volume, Type: rec.Type, RecordID: rec.ID, ParentID: rec.ParentID})
+				orderID, fillPrice, err := cl.placeOrder(ref, luno.OrderTypeBuy, currentPrice, rec.Volume)
 				if err != nil {
-					debugf("Error! (In `bot.CompleteLongTrades`) There was an error while selling %f %s", rec.Volume, rec.Asset)
+					debugf("Error! (In `bot.CompleteShortTrades`) There was an error while repurchasing %f %s", rec.Volume, rec.Asset)
 				} else {
 					debugf("%d out of %d viable assets with ID: %s bought.\n", n+1, recLen, orderID)
-					debugf("Approx. profit realized is: %f", currentPrice-rec.Price)
-					cl.lockedVolume -= rec.Volume // Subtract this asset from the locked volume for this client
-					// record the sale of the asset
-					err = NewPurchase(cl.asset, orderID, time.Now().Format(timeFormat),
-						rec.Price, rec.Volume, currentPrice, rec.Volume)
-					err = ledger.DeleteRecord(rec.ID)
-					if err != nil {
-						debugf("ERROR! Could not delete record with ID %s from the ledger.", rec.ID)
+					debugf("Approx. profit realized is: %f", (rec.Price-fillPrice)*rec.Volume)
+					cl.lockedBalance -= rec.Price * rec.Volume // Release the balance locked by the short sale
+					// record the repurchase of the asset
+					if bot.closeLedgerRecord(ledger, rec, orderID, fillPrice, rec.Volume) {
+						confirmIntent(ref)
 					}
 
 				}
@@ -525,6 +820,7 @@ func (bot *Bot) CompleteShortTrades(cl *Client) error {
 // CompleteLongTrades completes the second part of a long trade. The purchased asset is sold
 // at the recorded trigger price
 func (bot *Bot) CompleteLongTrades(cl *Client) error {
+	defer lockClosing(cl.asset)()
 	ledger := bot.Ledger()
 	defer ledger.Save()
 
@@ -533,6 +829,7 @@ func (bot *Bot) CompleteLongTrades(cl *Client) error {
 	)
 	// Get pending records.
 	pendingRecords, err := ledger.GetRecordsByType(cl.asset, LongOrder)
+	pendingRecords = withoutClosing(pendingRecords)
 	if err != nil {
 		// TODO: Silently print error and return
 		debug(err)
@@ -548,12 +845,15 @@ func (bot *Bot) CompleteLongTrades(cl *Client) error {
 			debugf("Error! (In `bot.CompleteLongTrades`) Could not retrieve current price. Reason: %v", err)
 			return err
 		}
+		// Long positions are closed by selling, which fills at the bids.
+		currentPrice = cl.sellPrice(currentPrice)
 		if cancelled() {
 			return ErrCancelled
 		}
+		pendingRecords = bot.scaleOut(ledger, pendingRecords, currentPrice)
 		for _, rec := range pendingRecords {
 			// Compare current asset price with the precalculated trigger price.
-			if currentPrice < rec.TriggerPrice {
+			if currentPrice < rec.TriggerPrice && !cl.exiting {
 				// We can't sell the asset yet. The sale price has to be higher or equal to the trigger price.
 				// The trigger price is calculated when the short-sold asset is first sold.
 				// For Example, if the asset was bougth for #100,000 and the profit margin is 3%, the trigger price
@@ -566,27 +866,27 @@ func (bot *Bot) CompleteLongTrades(cl *Client) error {
 		}
 		recLen := len(viablePendingRecords)
 		if recLen > 0 {
-			// If there are viable assets up for repurchase them.
-			debug("Found ", recLen, "short sold records viable for repurchase in the ledger")
+			// If there are viable assets up for sale, sell them.
+			debug("Found ", recLen, "purchased records viable for sale in the ledger")
 
 			for n, rec := range viablePendingRecords {
 				if cancelled() {
 					return ErrCancelled
 				}
-				debugf("Trying to repurchase %d out of %d short sold %v assets\n", n+1, recLen, rec.Asset)
-				orderID, err := cl.bid(currentPrice, rec.Volume)
+				debugf("Trying to sell %d out of %d purchased %v assets\n", n+1, recLen, rec.Asset)
+				// A long position is closed by selling the purchased asset.
+				ref := beginIntent(OrderIntent{Pair: cl.Pair, Asset: cl.asset, Side: luno.OrderTypeSell,
+					Price: currentPrice, Volume: rec.Volume, Type: rec.Type, RecordID: rec.ID, ParentID: rec.ParentID})
+				orderID, fillPrice, err := cl.placeOrder(ref, luno.OrderTypeSell, currentPrice, rec.Volume)
 				if err != nil {
 					debugf("Error! (In `bot.CompleteLongTrades`) There was an error while selling %f %s", rec.Volume, rec.Asset)
 				} else {
-					debugf("%d out of %d viable assets with ID: %s bought.\n", n+1, recLen, orderID)
-					debugf("Approx. profit realized is: %f", currentPrice-rec.Price)
-					// cl.lockedBalance -= rec.Price // Subtract this asset from the locked balance for this client
+					debugf("%d out of %d viable assets with ID: %s sold.\n", n+1, recLen, orderID)
+					debugf("Approx. profit realized is: %f", (fillPrice-rec.Price)*rec.Volume)
+					cl.lockedVolume -= rec.Volume // Release the volume locked by the purchase
 					// record the sale of the asset
-					err = NewSale(cl.asset, orderID, time.Now().Format(timeFormat),
-						rec.Price, rec.Volume, currentPrice, rec.Volume)
-					err = ledger.DeleteRecord(rec.ID)
-					if err != nil {
-						debugf("ERROR! Could not delete record with ID %s from the ledger.", rec.ID)
+					if bot.closeLedgerRecord(ledger, rec, orderID, fillPrice, rec.Volume) {
+						confirmIntent(ref)
 					}
 
 				}
@@ -629,7 +929,10 @@ func (bot *Bot) CompleteLongTrades(cl *Client) error {
 // 	return
 // }
 
+// addRecordToLedger saves a new position. Positions are saved whole. If a take-profit ladder is set
+// they are split into tranches by the trade-completion pass once the first tranche can be closed.
 func (bot *Bot) addRecordToLedger(rec Record) (err error) {
+	journalOpen(rec)
 	ledger := bot.Ledger()
 	defer ledger.Save()
 	err = ledger.AddRecord(rec)
@@ -637,38 +940,35 @@ func (bot *Bot) addRecordToLedger(rec Record) (err error) {
 }
 
 // Emit runs the technical analysis pipeline and returns the
-// signal emited by the analysis plugin
-func (bot *Bot) Emit(cl *Client) (signal SIGNAL, err error) {
-	// TODO:: Explore possibility of caching same hour price data.
-	// Since analysis is done on hourly data, it may be efficient to memoize data when an hour has not elpased
-	// since the price data was last retrieved.
-	retries := 3
+// signal emited by the analysis plugin and its confidence, from 0 to 1.
+func (bot *Bot) Emit(cl *Client) (signal SIGNAL, confidence float64, err error) {
+	// Each asset may use its own plugin and override some of the analysis options.
+	analyzer, shared, opts := bot.resolveAnalyzer(cl.asset)
 	var (
 		candlesticks []OHLC
 		prices       []float64
-		pricesErr    error
 	)
 	// Retrieve historic price data from the exchange.
-	for errCount := 0; errCount < retries; errCount++ {
+	pricesErr := retry(context.Background(), analysisRetryPolicy, func() (err error) {
 		// prices, pricesErr = cl.PreviousPrices(bot.analyzer.PriceDimensions())
-		candlesticks, prices, pricesErr = cl.PreviousTrades(bot.analyzerOptions.AnalysisPeriod,
-			bot.analyzerOptions.Interval)
-		if cancelled() {
-			return SignalWait, ErrCancelled
-		}
-		fmt.Println(pricesErr)
-		if len(prices) > 0 && pricesErr == nil {
-			break
+		candlesticks, prices, err = cl.PreviousTrades(opts.AnalysisPeriod, opts.Interval)
+		if err == nil && (len(prices) == 0 || len(candlesticks) == 0) {
+			err = errNoPrices
 		}
+		return err
+	})
+	if cancelled() {
+		return SignalWait, 0, ErrCancelled
 	}
-	if pricesErr != nil || len(prices) == 0 || len(candlesticks) == 0 {
+	if pricesErr != nil {
 		debug("An error occured while retrieving price data from the exchange. Please check your network connection!", pricesErr.Error())
-		return SignalWait, pricesErr
+		return SignalWait, 0, pricesErr
 	}
+	recordCandles(cl.asset, candlesticks)
 
 	currentPrice, err := cl.CurrentPrice()
 	if err != nil {
-		return SignalWait, errors.New("there was an error while retrieving price data from the exchange")
+		return SignalWait, 0, errors.New("there was an error while retrieving price data from the exchange")
 	}
 	// fmt.Println("CANDLES (OHLC)")
 	// for _, x := range candlesticks {
@@ -685,22 +985,54 @@ func (bot *Bot) Emit(cl *Client) (signal SIGNAL, err error) {
 	// 	prices = reducedPrices
 	// 	log.Println(reducedPrices)
 	// }
+	// The depth of the order book is retrieved before the analysis, like the prices.
+	depth := depthFor(cl, analyzer)
 	if cancelled() {
-		return SignalWait, ErrCancelled
+		return SignalWait, 0, ErrCancelled
+	}
+	signal, confidence, why, err := analyze(analyzer, shared, opts, prices, currentPrice, candlesticks, depth)
+	if err != nil {
+		return SignalWait, 0, err
+	}
+	emitted := signal
+	// The candles of the confirming timeframe are only retrieved for a long or short signal, after the analysis.
+	if signal, err = confirmTimeframes(cl, opts, candlesticks, signal); err != nil {
+		// An unconfirmed signal is not an incomplete analysis. The asset is still worked on.
+		debugf("Leprechaun will not act on the signal for %s. Reason: %v", cl.name, err)
+		explainSignal(why, cl.asset, signal, confidence, fmt.Sprintf("the %v signal was not confirmed: %v", emitted, err))
+		err = nil
+	} else {
+		explainSignal(why, cl.asset, signal, confidence)
+	}
+	recordAnalysis(cl, why, opts, candlesticks, currentPrice, signal, confidence)
+	return signal, confidence, nil
+}
+
+// analyze passes the price data of an asset to `analyzer` and returns its signal, its confidence in it and
+// its explanation. The data is retrieved beforehand, so no request to the exchange is made while the
+// analysis holds `analysisMu`. A plugin that is `shared` by every asset analyzes one asset at a time.
+func analyze(analyzer Analyzer, shared bool, opts *AnalysisOptions, prices []float64, currentPrice float64, candlesticks []OHLC,
+	depth *OrderBookDepth) (signal SIGNAL, confidence float64, why Explanation, err error) {
+	analysisMu.RLock()
+	defer analysisMu.RUnlock()
+	defer lockShared(shared)()
+	// The options carry the pattern sensitivity of the asset.
+	if err = analyzer.SetOptions(opts); err != nil {
+		return SignalWait, 0, why, err
 	}
 	// Pass the price data for the asset to the analysis plugin
-	bot.analyzer.SetClosingPrices(prices)
-	bot.analyzer.SetClosingPrices(prices)
-	bot.analyzer.SetCurrentPrice(currentPrice)
+	analyzer.SetClosingPrices(prices)
+	analyzer.SetCurrentPrice(currentPrice)
 	// Pass the OHLC data for the asset to the analysis plugin
-	bot.analyzer.SetOHLC(candlesticks)
-	fmt.Printf("%#v\n", bot.analyzer)
+	analyzer.SetOHLC(candlesticks)
+	// Pass the depth of the order book to plugins that use it.
+	passDepth(analyzer, depth)
 
 	// Do analysis and Emit the signal.
-	signal, err = bot.analyzer.Emit()
+	signal, confidence, err = emitConfidence(analyzer)
 	if err != nil {
 		debugf("Analysis incomplete, due to error: (%v)", err)
-		return SignalWait, err
+		return SignalWait, 0, why, err
 	}
-	return signal, nil
+	return signal, confidence, explanationOf(analyzer), nil
 }
@@ -0,0 +1,603 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `candlesticks.go` detects common candlestick patterns at the end of a candle chart. Each detected
+*  pattern records the trend of the candles before it and whether it formed at the top or the bottom of
+*  the chart's recent range, since most patterns only mean a reversal at one of the two.
+*  The thresholds used to recognise the shape of a candle are in `patterns.go`.
+ */
+
+import (
+	"math"
+
+	"github.com/michaellormann/leprechaun/indicators"
+)
+
+// PatternLevelBand is the share of the recent range of a chart, at each end, in which a pattern is
+// considered to have formed at the top or the bottom.
+const PatternLevelBand = 0.25
+
+// genericPatternCandles is the number of candles with subsequently higher, or lower, closes that form a
+// generic pattern.
+const genericPatternCandles = 4
+
+// bar returns the prices and volume of the candle for the functions of the indicators package.
+func (candle OHLC) bar() indicators.Candle {
+	return indicators.Candle{Open: candle.Open, High: candle.High, Low: candle.Low, Close: candle.Close,
+		Volume: candle.TotalVolume}
+}
+
+// bodyTop returns the higher of the open and close prices.
+func (candle OHLC) bodyTop() float64 {
+	return candle.bar().BodyTop()
+}
+
+// bodyBottom returns the lower of the open and close prices.
+func (candle OHLC) bodyBottom() float64 {
+	return candle.bar().BodyBottom()
+}
+
+// body returns the size of the candle's real body.
+func (candle OHLC) body() float64 {
+	return candle.bar().Body()
+}
+
+// bodyMiddle returns the price halfway through the candle's real body.
+func (candle OHLC) bodyMiddle() float64 {
+	return candle.bar().BodyMiddle()
+}
+
+// span returns the candle's range, from its low to its high.
+func (candle OHLC) span() float64 {
+	return candle.bar().Span()
+}
+
+// upperShadow returns the length of the wick above the real body.
+func (candle OHLC) upperShadow() float64 {
+	return candle.bar().UpperShadow()
+}
+
+// lowerShadow returns the length of the wick below the real body.
+func (candle OHLC) lowerShadow() float64 {
+	return candle.bar().LowerShadow()
+}
+
+// IsDoji returns true if a candles opening price is virtually the same with its closing price.
+// i.e. its body is no larger than `PatternSensitivity.DojiTolerance` of its range.
+// See `https://www.investopedia.com/terms/d/doji.asp`
+func (candle OHLC) IsDoji() bool {
+	return candle.isDoji(GetPatternSensitivity())
+}
+
+// isDoji is `IsDoji` with the thresholds `s`.
+func (candle OHLC) isDoji(s PatternSensitivity) bool {
+	return candle.body() <= s.DojiTolerance*candle.span()
+}
+
+// IsDragonflyDoji returns true if the candle is a doji that opens and closes at, or near, its high.
+// i.e. A doji with a long lower wick and little or no upper wick.
+func (candle OHLC) IsDragonflyDoji() bool {
+	return candle.isDragonflyDoji(GetPatternSensitivity())
+}
+
+// isDragonflyDoji is `IsDragonflyDoji` with the thresholds `s`.
+func (candle OHLC) isDragonflyDoji(s PatternSensitivity) bool {
+	tolerance := s.DojiTolerance * candle.span()
+	return candle.span() > 0 && candle.isDoji(s) && candle.upperShadow() <= tolerance
+}
+
+// IsGravestoneDoji returns true if the candle is a doji that opens and closes at, or near, its low.
+// i.e. A doji with a long upper wick and little or no lower wick.
+func (candle OHLC) IsGravestoneDoji() bool {
+	return candle.isGravestoneDoji(GetPatternSensitivity())
+}
+
+// isGravestoneDoji is `IsGravestoneDoji` with the thresholds `s`.
+func (candle OHLC) isGravestoneDoji(s PatternSensitivity) bool {
+	tolerance := s.DojiTolerance * candle.span()
+	return candle.span() > 0 && candle.isDoji(s) && candle.lowerShadow() <= tolerance
+}
+
+// IsHammer returns true if the candle has the shape of a hammer.
+// i.e. A black or white candlestick that consists of a small body near the high with little or no upper shadow and a long lower tail.
+// The body is no larger than `PatternSensitivity.BodyRatio` of the range and the lower tail is longer than the body and
+// `PatternSensitivity.WickRatio` times as long as the upper tail.
+// It is a bullish hammer at the bottom of a downtrend and a bearish hanging man at the top of an uptrend.
+// See https://en.wikipedia.org/wiki/Hammer_(candlestick_pattern)
+func (candle OHLC) IsHammer() bool {
+	return candle.isHammer(GetPatternSensitivity())
+}
+
+// isHammer is `IsHammer` with the thresholds `s`.
+func (candle OHLC) isHammer(s PatternSensitivity) bool {
+	lower := candle.lowerShadow()
+	return candle.span() > 0 && candle.body() <= s.BodyRatio*candle.span() &&
+		lower > candle.body() && lower > s.WickRatio*candle.upperShadow()
+}
+
+// IsInvertedHammer returns true if the candle has the shape of an inverted hammer, a hammer upside down.
+// i.e. A small body near the low with little or no lower shadow and a long upper tail.
+// It is a bullish inverted hammer at the bottom of a downtrend and a bearish shooting star at the top of an uptrend.
+// See https://www.investopedia.com/terms/s/shootingstar.asp
+func (candle OHLC) IsInvertedHammer() bool {
+	return candle.isInvertedHammer(GetPatternSensitivity())
+}
+
+// isInvertedHammer is `IsInvertedHammer` with the thresholds `s`.
+func (candle OHLC) isInvertedHammer(s PatternSensitivity) bool {
+	upper := candle.upperShadow()
+	return candle.span() > 0 && candle.body() <= s.BodyRatio*candle.span() &&
+		upper > candle.body() && upper > s.WickRatio*candle.lowerShadow()
+}
+
+// Engulfs checks if a candle engulfs another (i.e. candleTwo). The candle must be larger than candleTwo
+// and cover at least `PatternSensitivity.EngulfingOverlap` of its range.
+func (candle OHLC) Engulfs(candleTwo OHLC) bool {
+	return candle.engulfs(candleTwo, GetPatternSensitivity())
+}
+
+// engulfs is `Engulfs` with the thresholds `s`.
+func (candle OHLC) engulfs(candleTwo OHLC, s PatternSensitivity) bool {
+	if candle.span() <= candleTwo.span() {
+		return false
+	}
+	overlap := math.Min(candle.High, candleTwo.High) - math.Max(candle.Low, candleTwo.Low)
+	return overlap >= s.EngulfingOverlap*candleTwo.span()
+}
+
+// bodyInside reports whether the real body of the candle is smaller than, and lies within, the real body of `outer`.
+func (candle OHLC) bodyInside(outer OHLC) bool {
+	return candle.body() < outer.body() && candle.bodyTop() <= outer.bodyTop() && candle.bodyBottom() >= outer.bodyBottom()
+}
+
+// AllBearish returns true if all candles in the slice are bearish, returns false otherwise
+func (cht CandleChart) AllBearish(candles []OHLC) bool {
+	for _, candle := range candles {
+		if !candle.IsBearish() {
+			return false
+		}
+	}
+	return true
+}
+
+// AllBullish returns true if all candles in the slice are bullish, returns false otherwise.
+func (cht CandleChart) AllBullish(candles []OHLC) bool {
+	for _, candle := range candles {
+		if !candle.IsBullish() {
+			return false
+		}
+	}
+	return true
+}
+
+// CandlestickPattern is a specific pattern for a set of candles.
+// The most recent candles in a candle chart are examined to see if they
+// match any of the patterns described. Basic candles chart patterns are included.
+// See `https://www.investopedia.com/trading/candlestick-charting-what-is-it/`
+type CandlestickPattern uint
+
+type (
+	// BearishCandlestickPattern is a bearish candlestick pattern
+	BearishCandlestickPattern CandlestickPattern
+	// BullishCandlestickPattern is a bullish candlestick pattern
+	BullishCandlestickPattern CandlestickPattern
+)
+
+const (
+	// BullishEngulfingPattern takes place when buyers outpace sellers.
+	// This is reflected in the chart by a long green real body engulfing a small red real body.
+	// With bulls having established some control, the price could head higher.
+	BullishEngulfingPattern BullishCandlestickPattern = iota
+	// BullishMorningStar Consists of a large black body candlestick followed by a small body (red or green) that occurs below the large red body candlestick.
+	// On the following day, a third white body candlestick is formed that closes well into the black body candlestick.
+	// It is considered a major reversal signal when it appears at the bottom
+	BullishMorningStar
+	// MorningDojiStar Consists of a large black body candlestick followed by a Doji that occurred below the preceding candlestick.
+	// On the following day, a third white body candlestick is formed that closes well into the black body candlestick which appeared before the Doji.
+	// It is considered a major reversal signal that is more bullish than the regular morning star pattern because of the existence of the Doji.
+	MorningDojiStar
+	// BullishHarami is the opposite of the upside down bearish harami.
+	// A downtrend is in play, and a small real body (green) occurs inside the large real body (red) of the previous day.
+	// This tells the technician that the trend is pausing. If it is followed by another up day, more upside could be forthcoming.
+	BullishHarami
+	// BullishHaramiCross occurs in a downtrend, where a down candle is followed by a doji.
+	// The doji is within the real body of the prior session.
+	// The implications are the same as the bullish harami.
+	BullishHaramiCross
+	// BullishRisingThree pattern starts out with what is called a "long white day."
+	// Then, on the second, third, and fourth trading sessions, small real bodies move the price lower,
+	// but they still stay within the price range of the long white day (day one in the pattern).
+	// The fifth and last day of the pattern is another long white day.
+	// Even though the pattern shows us that the price is falling for three straight days,
+	// a new low is not seen, and the bull traders prepare for the next move up
+	BullishRisingThree
+	// BullishRisingTwo is similar to the rising three patterns but with two small bearish candles instead of three.
+	BullishRisingTwo
+	// BullishKeyReversal is a key reversal in a downtrend occurs when the price opens below the prior bar's close,
+	// makes a new low, and then closes above the prior bar's high.
+	// This indicates a strong shift to the upside, warning of a potential rally.
+	BullishKeyReversal
+	// BullishGenericPattern is a pattern that is formed by subsequently higher closes of the candles in question.
+	// It is intended for use in the event the common patterns defined above are not detected.
+	BullishGenericPattern
+	// BullishHammer is a hammer at the bottom of the chart. The sellers pushed the price down during the
+	// session but the buyers drove it back up to close near its high. It warns that a downtrend may be ending.
+	BullishHammer
+	// BullishInvertedHammer is an inverted hammer at the bottom of the chart. The buyers pushed the price up
+	// during the session and, although it closed near its low, the selling pressure is weakening.
+	BullishInvertedHammer
+	// BullishDragonflyDoji is a dragonfly doji at the bottom of the chart. The price fell during the session
+	// and recovered to close at its open, near the high, showing the buyers have stepped in.
+	BullishDragonflyDoji
+	// BullishDoji is a doji at the bottom of the chart. The indecision it shows after a fall may precede a reversal.
+	BullishDoji
+)
+
+const (
+	// BearishEngulfingPattern develops in an uptrend when sellers outnumber buyers.
+	// This action is reflected by a long red real body engulfing a small green real body.
+	// The pattern indicates that sellers are back in control and that the price could continue to decline.
+	BearishEngulfingPattern BearishCandlestickPattern = iota
+	// BearishEveningStar is a topping pattern.
+	// It is identified by the last candle in the pattern opening below the previous day's small real body.
+	// The small real body can be either red or green. The last candle closes deep into the real body of the candle two days prior.
+	// The pattern shows a stalling of the buyers and then the sellers taking control. More selling could develop.
+	BearishEveningStar
+	// EveningDojiStar Consists of three candlesticks.
+	// First is a large white body candlestick followed by a Doji that gaps above the white body.
+	// The third candlestick is a black body that closes well into the white body.
+	// When it appears at the top it is considered a reversal signal.
+	// It signals a more bearish trend than the evening star pattern because of the Doji that has appeared between the two bodies.
+	EveningDojiStar
+	// BearishHarami pattern is a small real body (red) completely inside the previous day's real body.
+	// This is not so much a pattern to act on, but it could be one to watch.
+	// The pattern shows indecision on the part of the buyers.
+	// If the price continues higher afterward, all may still be well with the uptrend,
+	// but a down candle following this pattern indicates a further slide.
+	BearishHarami
+	// BearishHaramiCross occurs in an uptrend, where an up candle is followed by a doji—the session where the candlestick has a virtually equal open and close.
+	// The doji is within the real body of the prior session. The implications are the same as the bearish harami
+	BearishHaramiCross
+	// BearishFallingThree pattern starts out with a strong down day.
+	// This is followed by three small real bodies that make upward progress but stay within the range of the first big down day.
+	// The pattern completes when the fifth day makes another large downward move.
+	// It shows that sellers are back in control and that the price could head lower.
+	BearishFallingThree
+	// BearishFallingTwo is the same as BearishFallingthree but has two small bullish bodies between the bearish candles.
+	BearishFallingTwo
+	// BearishKeyReversal is a key reversal in an uptrend and occurs when the price opens above the prior bar's close,
+	// makes a new high, and then closes below the prior bar's low.
+	// It shows a strong shift in momentum which could indicate a pullback is starting.
+	BearishKeyReversal
+	// BearishGenericPattern is a pattern that is formed by subsequently lower closes of the candles in question.
+	// It is intended for use in the event the common patterns defined above are not detected.
+	// Its score should be dependent on the number of candles that form the longest chain.
+	BearishGenericPattern
+	// BearishHangingMan is a hammer at the top of the chart. The sellers pushed the price down during the
+	// session and, although it recovered, the selling pressure warns that an uptrend may be ending.
+	BearishHangingMan
+	// BearishShootingStar is an inverted hammer at the top of the chart. The buyers pushed the price up during
+	// the session but the sellers drove it back down to close near its low.
+	BearishShootingStar
+	// BearishGravestoneDoji is a gravestone doji at the top of the chart. The price rose during the session and
+	// fell back to close at its open, near the low, showing the sellers have stepped in.
+	BearishGravestoneDoji
+	// BearishDoji is a doji at the top of the chart. The indecision it shows after a rise may precede a reversal.
+	BearishDoji
+)
+
+var (
+	bullishPatternNames = [...]string{"bullish engulfing", "morning star", "morning doji star", "bullish harami",
+		"bullish harami cross", "rising three", "rising two", "bullish key reversal", "bullish generic pattern",
+		"hammer", "inverted hammer", "dragonfly doji", "bullish doji"}
+	bearishPatternNames = [...]string{"bearish engulfing", "evening star", "evening doji star", "bearish harami",
+		"bearish harami cross", "falling three", "falling two", "bearish key reversal", "bearish generic pattern",
+		"hanging man", "shooting star", "gravestone doji", "bearish doji"}
+)
+
+func (pattern BullishCandlestickPattern) String() string {
+	if int(pattern) < len(bullishPatternNames) {
+		return bullishPatternNames[pattern]
+	}
+	return "unknown bullish pattern"
+}
+
+func (pattern BearishCandlestickPattern) String() string {
+	if int(pattern) < len(bearishPatternNames) {
+		return bearishPatternNames[pattern]
+	}
+	return "unknown bearish pattern"
+}
+
+// PriceLevel is where a pattern formed within the recent range of a chart.
+type PriceLevel string
+
+const (
+	// LevelTop is the upper end of the recent range of a chart.
+	LevelTop PriceLevel = "Top"
+	// LevelBottom is the lower end of the recent range of a chart.
+	LevelBottom PriceLevel = "Bottom"
+	// LevelMiddle is anywhere in between, or a chart without enough candles to tell.
+	LevelMiddle PriceLevel = "Middle"
+)
+
+// IsTop ...
+func (level PriceLevel) IsTop() bool {
+	return level == LevelTop
+}
+
+// IsBottom ...
+func (level PriceLevel) IsBottom() bool {
+	return level == LevelBottom
+}
+
+// BullishChartPattern is a bullish candlestick pattern detected in the chart
+type BullishChartPattern struct {
+	Pattern         BullishCandlestickPattern
+	PreceedingTrend ChartTrend
+	Level           PriceLevel // Where the pattern formed within the recent range of the chart.
+}
+
+// BearishChartPattern is a bearish candlestick pattern detected in the chart
+type BearishChartPattern struct {
+	Pattern         BearishCandlestickPattern
+	PreceedingTrend ChartTrend
+	Level           PriceLevel // Where the pattern formed within the recent range of the chart.
+}
+
+// precedingTrend returns the trend of the three candles before the candle at index `first`.
+func (cht *CandleChart) precedingTrend(first int) ChartTrend {
+	start := first - 3
+	if start < 0 {
+		start = 0
+	}
+	return cht.DetectTrend(cht.Candles[start:first])
+}
+
+// levelOf returns where the candles from index `first` to the latest candle formed within the range of
+// those candles and the `ContextCandles` candles before them. A pattern formed at the bottom if its low
+// is within `PatternLevelBand` of the range's low, and at the top if its high is within `PatternLevelBand`
+// of the range's high.
+func (cht *CandleChart) levelOf(first int) PriceLevel {
+	start := first - cht.ContextCandles
+	if start < 0 {
+		start = 0
+	}
+	if start == first {
+		return LevelMiddle
+	}
+	low, high := cht.Candles[start].Low, cht.Candles[start].High
+	patternLow, patternHigh := cht.Candles[first].Low, cht.Candles[first].High
+	for ix, candle := range cht.Candles[start:] {
+		low, high = math.Min(low, candle.Low), math.Max(high, candle.High)
+		if start+ix >= first {
+			patternLow, patternHigh = math.Min(patternLow, candle.Low), math.Max(patternHigh, candle.High)
+		}
+	}
+	band := PatternLevelBand * (high - low)
+	if band <= 0 {
+		return LevelMiddle
+	}
+	bottom, top := patternLow <= low+band, patternHigh >= high-band
+	switch {
+	case bottom && top:
+		// The pattern spans most of the range. The trend before it tells which end it formed at.
+		switch cht.precedingTrend(first) {
+		case Bearish:
+			return LevelBottom
+		case Bullish:
+			return LevelTop
+		}
+	case bottom:
+		return LevelBottom
+	case top:
+		return LevelTop
+	}
+	return LevelMiddle
+}
+
+// AddBearishPattern adds a detected bearish pattern to the chart struct as well as the trend
+// of the candles preceeding the detect pattern and the level it formed at. The pattern ends at the latest candle.
+func (cht *CandleChart) AddBearishPattern(earliestCandle OHLC, pattern BearishCandlestickPattern) {
+	cht.addBearish(earliestCandle.ID, pattern)
+}
+
+// AddBullishPattern adds a detected bullish pattern to the chart struct as well as the trend
+// of the candles preceeding the detected pattern and the level it formed at. The pattern ends at the latest candle.
+func (cht *CandleChart) AddBullishPattern(earliestCandle OHLC, pattern BullishCandlestickPattern) {
+	cht.addBullish(earliestCandle.ID, pattern)
+}
+
+func (cht *CandleChart) addBearish(first int, pattern BearishCandlestickPattern) {
+	cht.BearishPatterns = append(cht.BearishPatterns, BearishChartPattern{Pattern: pattern,
+		PreceedingTrend: cht.precedingTrend(first), Level: cht.levelOf(first)})
+}
+
+func (cht *CandleChart) addBullish(first int, pattern BullishCandlestickPattern) {
+	cht.BullishPatterns = append(cht.BullishPatterns, BullishChartPattern{Pattern: pattern,
+		PreceedingTrend: cht.precedingTrend(first), Level: cht.levelOf(first)})
+}
+
+// thresholds returns the thresholds the chart detects patterns with: its `Sensitivity`, or the thresholds
+// set with `SetPatternSensitivity` if it has none.
+func (cht *CandleChart) thresholds() PatternSensitivity {
+	if cht.Sensitivity == (PatternSensitivity{}) {
+		return GetPatternSensitivity()
+	}
+	return cht.Sensitivity.WithDefaults()
+}
+
+// DetectPatterns tries to match the most recent price data to common candlestick patterns.
+// Only the patterns that end at the latest candle and span no more than `MaxPatternCandles` candles
+// are detected. They replace the patterns detected by an earlier call.
+func (cht *CandleChart) DetectPatterns() {
+	cht.BullishPatterns, cht.BearishPatterns = []BullishChartPattern{}, []BearishChartPattern{}
+	count := len(cht.Candles)
+	// fits reports whether a pattern of `size` candles ending at the latest candle can be detected.
+	fits := func(size int) bool {
+		return size <= count && (cht.MaxPatternCandles <= 0 || size <= cht.MaxPatternCandles)
+	}
+	if !fits(1) {
+		return
+	}
+	last := count - 1
+	cht.detectSingleCandlePatterns(last)
+	if fits(2) {
+		cht.detectTwoCandlePatterns(last)
+	}
+	if fits(3) {
+		cht.detectStars(last)
+	}
+	// Check for the rising and falling three (a.k.a 3-method formation) and two patterns.
+	for _, size := range []int{5, 4} {
+		if fits(size) {
+			cht.detectMethods(last-size+1, last, size == 5)
+		}
+	}
+	// In the event no patterns have been detected check for a generic pattern
+	if fits(genericPatternCandles) {
+		first := last - genericPatternCandles + 1
+		higher, lower := true, true
+		for ix := first + 1; ix <= last; ix++ {
+			higher = higher && cht.Candles[ix].Close > cht.Candles[ix-1].Close
+			lower = lower && cht.Candles[ix].Close < cht.Candles[ix-1].Close
+		}
+		if higher && len(cht.BullishPatterns) == 0 {
+			cht.addBullish(first, BullishGenericPattern)
+		}
+		if lower && len(cht.BearishPatterns) == 0 {
+			cht.addBearish(first, BearishGenericPattern)
+		}
+	}
+}
+
+// detectSingleCandlePatterns checks the latest candle for dojis, hammers and shooting stars. These
+// patterns depend on where they formed, so they are only detected at the top or the bottom of the chart.
+func (cht *CandleChart) detectSingleCandlePatterns(last int) {
+	candle := cht.Candles[last]
+	level := cht.levelOf(last)
+	s := cht.thresholds()
+	switch {
+	case candle.isDragonflyDoji(s) && level.IsBottom():
+		cht.addBullish(last, BullishDragonflyDoji)
+	case candle.isGravestoneDoji(s) && level.IsTop():
+		cht.addBearish(last, BearishGravestoneDoji)
+	case candle.isDoji(s):
+		if level.IsBottom() {
+			cht.addBullish(last, BullishDoji)
+		} else if level.IsTop() {
+			cht.addBearish(last, BearishDoji)
+		}
+	case candle.isHammer(s):
+		if level.IsBottom() {
+			cht.addBullish(last, BullishHammer)
+		} else if level.IsTop() {
+			cht.addBearish(last, BearishHangingMan)
+		}
+	case candle.isInvertedHammer(s):
+		if level.IsBottom() {
+			cht.addBullish(last, BullishInvertedHammer)
+		} else if level.IsTop() {
+			cht.addBearish(last, BearishShootingStar)
+		}
+	}
+}
+
+// detectTwoCandlePatterns checks the latest two candles for engulfing, harami and key reversal patterns.
+func (cht *CandleChart) detectTwoCandlePatterns(last int) {
+	previous, candle := cht.Candles[last-1], cht.Candles[last]
+	first := last - 1
+	s := cht.thresholds()
+	// Check for patterns that end in a doji
+	if candle.isDoji(s) && candle.bodyInside(previous) {
+		if previous.IsBearish() {
+			cht.addBullish(first, BullishHaramiCross)
+		} else if previous.IsBullish() {
+			cht.addBearish(first, BearishHaramiCross)
+		}
+	}
+	switch {
+	// Check for patterns that end with a bearish candle, for example the bearish engulfing pattern
+	case candle.IsBearish() && previous.IsBullish():
+		// Check for BearishEngulfingPattern. see https://www.investopedia.com/trading/candlestick-charting-what-is-it/ for more info
+		if candle.engulfs(previous, s) {
+			cht.addBearish(first, BearishEngulfingPattern)
+		}
+		if !candle.isDoji(s) && candle.bodyInside(previous) {
+			cht.addBearish(first, BearishHarami)
+		}
+		if candle.Open > previous.Close && candle.High > previous.High && candle.Close < previous.Low {
+			cht.addBearish(first, BearishKeyReversal)
+		}
+	// Check for patterns that end in a bullish candle
+	case candle.IsBullish() && previous.IsBearish():
+		if candle.engulfs(previous, s) {
+			cht.addBullish(first, BullishEngulfingPattern)
+		}
+		if !candle.isDoji(s) && candle.bodyInside(previous) {
+			cht.addBullish(first, BullishHarami)
+		}
+		if candle.Open < previous.Close && candle.Low < previous.Low && candle.Close > previous.High {
+			cht.addBullish(first, BullishKeyReversal)
+		}
+	}
+}
+
+// detectStars checks the latest three candles for the morning and evening star patterns. The star is a
+// small body, or a doji, beyond the middle of the first candle's body. Crypto markets trade around the
+// clock, so the gaps between the bodies that mark a star on stock charts are not required.
+func (cht *CandleChart) detectStars(last int) {
+	first, star, candle := cht.Candles[last-2], cht.Candles[last-1], cht.Candles[last]
+	s := cht.thresholds()
+	if star.body() > first.body()/2 || candle.body() <= star.body() {
+		return
+	}
+	switch {
+	case first.IsBullish() && candle.IsBearish():
+		// The star sits above the middle of the first candle and the last candle closes deep into it.
+		if star.bodyBottom() >= first.bodyMiddle() && candle.Close < first.bodyMiddle() {
+			if star.isDoji(s) {
+				cht.addBearish(last-2, EveningDojiStar)
+			} else {
+				cht.addBearish(last-2, BearishEveningStar)
+			}
+		}
+	case first.IsBearish() && candle.IsBullish():
+		if star.bodyTop() <= first.bodyMiddle() && candle.Close > first.bodyMiddle() {
+			if star.isDoji(s) {
+				cht.addBullish(last-2, MorningDojiStar)
+			} else {
+				cht.addBullish(last-2, BullishMorningStar)
+			}
+		}
+	}
+}
+
+// detectMethods checks the candles from index `first` to `last` for the rising and falling three patterns,
+// or the rising and falling two patterns if `three` is not set. The candles between the first and the last
+// have small bodies against the first candle's direction and stay within its range. The last candle closes
+// beyond the first.
+func (cht *CandleChart) detectMethods(first, last int, three bool) {
+	opening, closing := cht.Candles[first], cht.Candles[last]
+	middle := cht.Candles[first+1 : last]
+	for _, candle := range middle {
+		if candle.body() >= opening.body() || candle.High > opening.High || candle.Low < opening.Low {
+			return
+		}
+	}
+	switch {
+	case opening.IsBearish() && closing.IsBearish() && cht.AllBullish(middle) && closing.Close < opening.Close:
+		if three {
+			cht.addBearish(first, BearishFallingThree)
+		} else {
+			cht.addBearish(first, BearishFallingTwo)
+		}
+	case opening.IsBullish() && closing.IsBullish() && cht.AllBearish(middle) && closing.Close > opening.Close:
+		if three {
+			cht.addBullish(first, BullishRisingThree)
+		} else {
+			cht.addBullish(first, BullishRisingTwo)
+		}
+	}
+}
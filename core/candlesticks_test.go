@@ -0,0 +1,215 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// bar returns a candle that opens at `open`, moves to `high` and `low` and closes at `close`.
+func bar(open, high, low, close float64) OHLC {
+	return doOHLC(time.Time{}, []float64{open, high, low, close}, 1)
+}
+
+// mirror returns the candles upside down, so a bullish chart becomes a bearish one.
+func mirror(candles []OHLC) (mirrored []OHLC) {
+	for _, c := range candles {
+		mirrored = append(mirrored, bar(200-c.Open, 200-c.Low, 200-c.High, 200-c.Close))
+	}
+	return
+}
+
+var (
+	// downtrend falls by 2 with each candle.
+	downtrend = []OHLC{bar(108, 108.5, 105.5, 106), bar(106, 106.5, 103.5, 104)}
+	// engulfing is a bullish engulfing candle after a downtrend, which also closes above the high of the
+	// candle before it.
+	engulfing = append([]OHLC{bar(110, 110.5, 107.5, 108)}, append(downtrend, bar(104, 104.5, 101.5, 102),
+		bar(101.5, 105.5, 101, 105))...)
+	// risingThree is a long bullish candle, three small bearish candles within its range and a bullish
+	// candle that closes above it.
+	risingThree = []OHLC{bar(100, 111, 99.5, 110), bar(109, 109.5, 107.5, 108), bar(108, 108.5, 106.5, 107),
+		bar(107, 107.5, 105.5, 106), bar(106.5, 113, 106.2, 112.5)}
+)
+
+func TestCandleShapes(t *testing.T) {
+	for _, test := range []struct {
+		name                                                string
+		candle                                              OHLC
+		doji, dragonfly, gravestone, hammer, invertedHammer bool
+	}{
+		{name: "doji", candle: bar(100, 105, 95, 100.2), doji: true},
+		{name: "flat", candle: bar(100, 100, 100, 100), doji: true},
+		{name: "dragonfly doji", candle: bar(100, 100.2, 90, 100.1), doji: true, dragonfly: true, hammer: true},
+		{name: "gravestone doji", candle: bar(100, 110, 99.9, 100.1), doji: true, gravestone: true, invertedHammer: true},
+		{name: "hammer", candle: bar(108, 110, 100, 109.5), hammer: true},
+		{name: "inverted hammer", candle: bar(102, 110, 100, 100.5), invertedHammer: true},
+		{name: "long body", candle: bar(100, 110, 99, 109)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := test.candle
+			for _, shape := range []struct {
+				name      string
+				got, want bool
+			}{
+				{"IsDoji", c.IsDoji(), test.doji},
+				{"IsDragonflyDoji", c.IsDragonflyDoji(), test.dragonfly},
+				{"IsGravestoneDoji", c.IsGravestoneDoji(), test.gravestone},
+				{"IsHammer", c.IsHammer(), test.hammer},
+				{"IsInvertedHammer", c.IsInvertedHammer(), test.invertedHammer},
+			} {
+				if shape.got != shape.want {
+					t.Errorf("%s() = %v, want %v", shape.name, shape.got, shape.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEngulfs(t *testing.T) {
+	small := bar(100, 105, 100, 104)
+	for _, test := range []struct {
+		name    string
+		candle  OHLC
+		overlap float64
+		want    bool
+	}{
+		{"covers", bar(104.5, 106, 95, 96), 1, true},
+		{"partly covers", bar(109, 110, 101, 102), 1, false},
+		{"partly covers with a lower overlap", bar(109, 110, 101, 102), 0.5, true},
+		{"same range", bar(105, 105, 100, 100), 1, false},
+		{"smaller", bar(101, 102, 100, 101.5), 0.5, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := DefaultPatternSensitivity
+			s.EngulfingOverlap = test.overlap
+			if got := test.candle.engulfs(small, s); got != test.want {
+				t.Errorf("engulfs() = %v, want %v", got, test.want)
+			}
+			if test.overlap == DefaultPatternSensitivity.EngulfingOverlap {
+				if got := test.candle.Engulfs(small); got != test.want {
+					t.Errorf("Engulfs() = %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectPatterns(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		candles     []OHLC
+		maxCandles  int
+		sensitivity PatternSensitivity
+		bullish     []BullishCandlestickPattern
+		bearish     []BearishCandlestickPattern
+	}{
+		{name: "empty"},
+		{name: "lone doji", candles: []OHLC{bar(100, 105, 95, 100.2)}},
+		{name: "bullish engulfing", candles: engulfing,
+			bullish: []BullishCandlestickPattern{BullishEngulfingPattern, BullishKeyReversal}},
+		{name: "bearish engulfing", candles: mirror(engulfing),
+			bearish: []BearishCandlestickPattern{BearishEngulfingPattern, BearishKeyReversal}},
+		{name: "doji at the bottom", candles: append(downtrend[:2:2], bar(103.5, 104, 101, 103.6)),
+			bullish: []BullishCandlestickPattern{BullishDoji}},
+		{name: "doji at the top", candles: mirror(append(downtrend[:2:2], bar(103.5, 104, 101, 103.6))),
+			bearish: []BearishCandlestickPattern{BearishDoji}},
+		{name: "hammer at the bottom", candles: append(downtrend[:2:2], bar(103.5, 104, 101, 104)),
+			bullish: []BullishCandlestickPattern{BullishHammer}},
+		{name: "dragonfly doji with the chart's thresholds", candles: append(downtrend[:2:2], bar(103.5, 104, 101, 104)),
+			sensitivity: PatternSensitivity{DojiTolerance: 0.2},
+			bullish:     []BullishCandlestickPattern{BullishDragonflyDoji}},
+		{name: "morning star", candles: []OHLC{bar(110, 110.5, 99.5, 100), bar(99, 99.6, 98, 99.5), bar(100, 108.5, 99.5, 108)},
+			bullish: []BullishCandlestickPattern{BullishMorningStar}},
+		{name: "morning doji star", candles: []OHLC{bar(110, 110.5, 99.5, 100), bar(99, 99.8, 98, 99.05), bar(100, 108.5, 99.5, 108)},
+			bullish: []BullishCandlestickPattern{MorningDojiStar}},
+		{name: "evening star", candles: mirror([]OHLC{bar(110, 110.5, 99.5, 100), bar(99, 99.6, 98, 99.5), bar(100, 108.5, 99.5, 108)}),
+			bearish: []BearishCandlestickPattern{BearishEveningStar}},
+		{name: "rising three", candles: risingThree, bullish: []BullishCandlestickPattern{BullishRisingThree}},
+		{name: "falling three", candles: mirror(risingThree), bearish: []BearishCandlestickPattern{BearishFallingThree}},
+		{name: "rising two", candles: append(risingThree[:1:1], risingThree[2:]...),
+			bullish: []BullishCandlestickPattern{BullishRisingTwo}},
+		{name: "rising three beyond the candles checked", candles: risingThree, maxCandles: 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			chart := NewCandleChart(test.candles)
+			if test.maxCandles > 0 {
+				chart.MaxPatternCandles = test.maxCandles
+			}
+			chart.Sensitivity = test.sensitivity
+			chart.DetectPatterns()
+			var (
+				bullish []BullishCandlestickPattern
+				bearish []BearishCandlestickPattern
+			)
+			for _, p := range chart.BullishPatterns {
+				bullish = append(bullish, p.Pattern)
+			}
+			for _, p := range chart.BearishPatterns {
+				bearish = append(bearish, p.Pattern)
+			}
+			if fmt.Sprint(bullish) != fmt.Sprint(test.bullish) {
+				t.Errorf("got bullish patterns %v, want %v", bullish, test.bullish)
+			}
+			if fmt.Sprint(bearish) != fmt.Sprint(test.bearish) {
+				t.Errorf("got bearish patterns %v, want %v", bearish, test.bearish)
+			}
+		})
+	}
+}
+
+func TestPatternTrendAndLevel(t *testing.T) {
+	chart := NewCandleChart(engulfing)
+	chart.DetectPatterns()
+	if len(chart.BullishPatterns) == 0 {
+		t.Fatal("no bullish pattern was detected")
+	}
+	if got := chart.BullishPatterns[0]; got.PreceedingTrend != Bearish || !got.Level.IsBottom() {
+		t.Errorf("got a pattern after a %s trend at the %s, want one after a bearish trend at the bottom", got.PreceedingTrend, got.Level)
+	}
+}
+
+func TestPatternNames(t *testing.T) {
+	for _, test := range []struct {
+		pattern fmt.Stringer
+		want    string
+	}{
+		{BullishEngulfingPattern, "bullish engulfing"},
+		{BullishDoji, "bullish doji"},
+		{BullishCandlestickPattern(100), "unknown bullish pattern"},
+		{BearishShootingStar, "shooting star"},
+		{BearishCandlestickPattern(100), "unknown bearish pattern"},
+	} {
+		if got := test.pattern.String(); got != test.want {
+			t.Errorf("String() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestSetPatternSensitivity(t *testing.T) {
+	defer SetPatternSensitivity(DefaultPatternSensitivity)
+	for _, test := range []struct {
+		s     PatternSensitivity
+		valid bool
+	}{
+		{PatternSensitivity{}, true},
+		{PatternSensitivity{DojiTolerance: 0.2, WickRatio: 3}, true},
+		{PatternSensitivity{DojiTolerance: 0.5}, false},
+		{PatternSensitivity{BodyRatio: 0.05}, false},
+		{PatternSensitivity{WickRatio: 6}, false},
+		{PatternSensitivity{EngulfingOverlap: 0.4}, false},
+	} {
+		SetPatternSensitivity(DefaultPatternSensitivity)
+		err := SetPatternSensitivity(test.s)
+		if (err == nil) != test.valid {
+			t.Errorf("SetPatternSensitivity(%+v) = %v, want valid %v", test.s, err, test.valid)
+		}
+		want := DefaultPatternSensitivity
+		if test.valid {
+			want = test.s.WithDefaults()
+		}
+		if got := GetPatternSensitivity(); got != want {
+			t.Errorf("after SetPatternSensitivity(%+v) the thresholds are %+v, want %+v", test.s, got, want)
+		}
+	}
+}
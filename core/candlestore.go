@@ -0,0 +1,233 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `candlestore.go` saves the candles retrieved from the exchange in a local database, keyed by pair,
+*  interval and the time each candle began. Only candles whose period is over are saved. When candles are
+*  retrieved again, e.g. after a restart, the saved ones are used and only the missing candles (the gaps)
+*  are retrieved from the exchange and saved in turn. Unlike the trades kept in memory, saved candles
+*  outlive the app, so they can also be read back for charts and statistics. They are kept in an SQLite
+*  file, or in a bbolt file if the ledger is kept in one or the build has no SQLite driver.
+ */
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	luno "github.com/luno/luno-go"
+)
+
+const candlesInit = `
+CREATE TABLE IF NOT EXISTS CANDLES (
+	PAIR TEXT NOT NULL,
+	INTERVAL INTEGER NOT NULL,
+	TIMESTAMP INTEGER NOT NULL,
+	OPEN REAL NOT NULL,
+	HIGH REAL NOT NULL,
+	LOW REAL NOT NULL,
+	CLOSE REAL NOT NULL,
+	VOLUME REAL NOT NULL,
+	PRIMARY KEY (PAIR, INTERVAL, TIMESTAMP)
+);`
+
+// candleStore keeps the saved candles.
+type candleStore interface {
+	// save saves `candles` of `pair` that are `interval` long, replacing those saved before.
+	save(pair string, interval time.Duration, candles []OHLC) error
+	// candles returns the saved candles of `pair` that are `interval` long and began from `from` up to,
+	// but not including, `to`, from the earliest.
+	candles(pair string, interval time.Duration, from, to time.Time) ([]OHLC, error)
+	Close() error
+}
+
+var (
+	candleStoreMu sync.Mutex
+	candleStoreDB candleStore
+	// candleStoreDBPath is the path of the open candle database, so a new one is opened if the storage changes.
+	candleStoreDBPath string
+)
+
+// candleStorePath returns the path of the candle database. Candles are market data, so live and paper
+// trading share it.
+func candleStorePath() string {
+	if boltStores() {
+		return filepath.Join(cfg().DataDir, "candles.bolt")
+	}
+	return filepath.Join(cfg().DataDir, "candles.db")
+}
+
+// openCandleStore returns the candle database, opening and initializing it the first time it is used.
+// The caller must hold `candleStoreMu`.
+func openCandleStore() (candleStore, error) {
+	path := candleStorePath()
+	if candleStoreDB != nil && candleStoreDBPath == path {
+		return candleStoreDB, nil
+	}
+	if candleStoreDB != nil {
+		candleStoreDB.Close()
+		candleStoreDB = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	open := openSQLCandles
+	if boltStores() {
+		open = openBoltCandles
+	}
+	store, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	candleStoreDB, candleStoreDBPath = store, path
+	return store, nil
+}
+
+// SaveCandles saves the candles of `pair` that are `interval` long. A candle that was saved before is replaced.
+func SaveCandles(pair string, interval time.Duration, candles []OHLC) error {
+	if len(candles) == 0 {
+		return nil
+	}
+	candleStoreMu.Lock()
+	defer candleStoreMu.Unlock()
+	store, err := openCandleStore()
+	if err != nil {
+		return err
+	}
+	return store.save(pair, interval, candles)
+}
+
+// StoredCandles returns the saved candles of `pair` that are `interval` long and began from `from` up to,
+// but not including, `to`. They are ordered from the earliest.
+func StoredCandles(pair string, interval time.Duration, from, to time.Time) (candles []OHLC, err error) {
+	candleStoreMu.Lock()
+	defer candleStoreMu.Unlock()
+	store, err := openCandleStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.candles(pair, interval, from, to)
+}
+
+// sqlCandles keeps the candles in an SQLite file.
+type sqlCandles struct {
+	db *sql.DB
+}
+
+// openSQLCandles opens the SQLite candle database at `path`, creating it if it does not exist.
+func openSQLCandles(path string) (candleStore, error) {
+	if !sqliteAvailable {
+		return nil, fmt.Errorf("%w (%q)", ErrStorageUnavailable, SQLiteStorage)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(candlesInit); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlCandles{db: db}, nil
+}
+
+func (s *sqlCandles) save(pair string, interval time.Duration, candles []OHLC) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO CANDLES (PAIR, INTERVAL, TIMESTAMP, OPEN, HIGH, LOW, CLOSE, VOLUME)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, candle := range candles {
+		_, err = stmt.Exec(pair, int64(interval/time.Second), candle.Time.Unix(), candle.Open, candle.High,
+			candle.Low, candle.Close, candle.TotalVolume)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlCandles) candles(pair string, interval time.Duration, from, to time.Time) (candles []OHLC, err error) {
+	rows, err := s.db.Query(`SELECT TIMESTAMP, OPEN, HIGH, LOW, CLOSE, VOLUME FROM CANDLES
+		WHERE PAIR = ? AND INTERVAL = ? AND TIMESTAMP >= ? AND TIMESTAMP < ? ORDER BY TIMESTAMP`,
+		pair, int64(interval/time.Second), from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var timestamp int64
+		var open, high, low, closing, volume float64
+		if err = rows.Scan(&timestamp, &open, &high, &low, &closing, &volume); err != nil {
+			return nil, err
+		}
+		candles = append(candles, NewOHLC(time.Unix(timestamp, 0), interval, open, high, low, closing, volume))
+	}
+	return candles, rows.Err()
+}
+
+func (s *sqlCandles) Close() error {
+	return s.db.Close()
+}
+
+// NewOHLC returns a candle that began at `start` and is `period` long from its prices and traded volume,
+// e.g. to load candles from a database or a file. The trades of the candle are not known, so its prices
+// are its open, high, low and close.
+func NewOHLC(start time.Time, period time.Duration, open, high, low, closing, volume float64) OHLC {
+	candle := doOHLC(start, []float64{open, high, low, closing}, volume)
+	candle.Period = period
+	return candle
+}
+
+// candleGaps returns the timestamps in `timestamps` that have no candle in `stored`.
+func candleGaps(timestamps []luno.Time, stored map[time.Time]OHLC) (gaps []luno.Time) {
+	for _, timestamp := range timestamps {
+		if _, ok := stored[time.Time(timestamp).UTC()]; !ok {
+			gaps = append(gaps, timestamp)
+		}
+	}
+	return
+}
+
+// storedCandles returns the saved candles of the client's pair that began at one of `timestamps`, keyed
+// by their UTC start time. Errors are logged and an empty map is returned, so the candles are retrieved
+// from the exchange instead.
+func (cl *Client) storedCandles(timestamps []luno.Time, interval time.Duration) map[time.Time]OHLC {
+	stored := map[time.Time]OHLC{}
+	if len(timestamps) == 0 {
+		return stored
+	}
+	first, last := time.Time(timestamps[0]), time.Time(timestamps[len(timestamps)-1])
+	candles, err := StoredCandles(cl.Pair, interval, first, last.Add(time.Second))
+	if err != nil {
+		debugf("Could not read the saved candles of %s: %v", cl.name, err)
+		return stored
+	}
+	for _, candle := range candles {
+		stored[candle.Time.UTC()] = candle
+	}
+	return stored
+}
+
+// saveClosedCandles saves the candles whose period is over.
+func (cl *Client) saveClosedCandles(interval time.Duration, candles []OHLC) {
+	now := time.Now()
+	closed := []OHLC{}
+	for _, candle := range candles {
+		if !candle.Time.Add(interval).After(now) {
+			closed = append(closed, candle)
+		}
+	}
+	if err := SaveCandles(cl.Pair, interval, closed); err != nil {
+		debugf("Could not save the candles of %s: %v", cl.name, err)
+	}
+}
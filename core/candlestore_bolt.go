@@ -0,0 +1,105 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `candlestore_bolt.go` keeps the saved candles in a bbolt file, for ledgers kept in bbolt and builds
+*  without the SQLite driver. The candles of each pair and interval are a bucket, keyed by the unix time
+*  each candle began, so the candles of a range of times are read in order with a cursor.
+ */
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltCandles is the bucket of the buckets of candles.
+var boltCandles = []byte("candles")
+
+// boltCandle is a candle as it is saved in a bbolt file.
+type boltCandle struct {
+	Open, High, Low, Close, Volume float64
+}
+
+// boltCandleStore keeps the candles in a bbolt file.
+type boltCandleStore struct {
+	db *bolt.DB
+}
+
+// openBoltCandles opens the bbolt candle database at `path`, creating it if it does not exist.
+func openBoltCandles(path string) (candleStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltCandles)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltCandleStore{db: db}, nil
+}
+
+// candleBucket returns the name of the bucket of the candles of `pair` that are `interval` long.
+func candleBucket(pair string, interval time.Duration) []byte {
+	return []byte(fmt.Sprintf("%s/%d", pair, int64(interval/time.Second)))
+}
+
+// candleKey returns the key of the candle that began at `t`.
+func candleKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.Unix()))
+	return key
+}
+
+func (s *boltCandleStore) save(pair string, interval time.Duration, candles []OHLC) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(boltCandles).CreateBucketIfNotExists(candleBucket(pair, interval))
+		if err != nil {
+			return err
+		}
+		for _, candle := range candles {
+			data, err := json.Marshal(boltCandle{Open: candle.Open, High: candle.High, Low: candle.Low,
+				Close: candle.Close, Volume: candle.TotalVolume})
+			if err != nil {
+				return err
+			}
+			if err = bucket.Put(candleKey(candle.Time), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltCandleStore) candles(pair string, interval time.Duration, from, to time.Time) (candles []OHLC, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltCandles).Bucket(candleBucket(pair, interval))
+		if bucket == nil {
+			return nil
+		}
+		end := candleKey(to)
+		c := bucket.Cursor()
+		for key, data := c.Seek(candleKey(from)); key != nil && bytes.Compare(key, end) < 0; key, data = c.Next() {
+			var candle boltCandle
+			if err := json.Unmarshal(data, &candle); err != nil {
+				return err
+			}
+			start := time.Unix(int64(binary.BigEndian.Uint64(key)), 0)
+			candles = append(candles, NewOHLC(start, interval, candle.Open, candle.High, candle.Low, candle.Close, candle.Volume))
+		}
+		return nil
+	})
+	return
+}
+
+func (s *boltCandleStore) Close() error {
+	return s.db.Close()
+}
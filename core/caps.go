@@ -0,0 +1,95 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `caps.go` holds the exposure caps of individual assets. A cap limits the number of positions an
+*  asset may have open at once, or the fiat locked in its long positions, so the bot does not keep
+*  buying the same falling asset in every round. A global limit caps the positions open across all assets.
+ */
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidExposureCap is returned for a cap with a negative limit.
+	ErrInvalidExposureCap = errors.New("exposure caps can not be negative")
+	// ErrExposureCapReached is returned when a new position would exceed the exposure cap of its asset.
+	ErrExposureCapReached = errors.New("the exposure cap for the asset has been reached")
+	// ErrPositionLimitReached is returned when as many positions are open as `TradeSettings.MaxOpenPositions` allows.
+	ErrPositionLimitReached = errors.New("the maximum number of open positions has been reached")
+)
+
+// ExposureCap limits the open positions of an asset. Zero disables a limit.
+type ExposureCap struct {
+	MaxOpenRecords int     // Number of long, or short, positions that may be open at once.
+	MaxLockedFiat  float64 // Fiat that may be locked in long positions at once.
+}
+
+// IsZero reports whether the cap sets no limit.
+func (c ExposureCap) IsZero() bool {
+	return c.MaxOpenRecords == 0 && c.MaxLockedFiat == 0
+}
+
+// Validate returns `ErrInvalidExposureCap` if a limit is negative.
+func (c ExposureCap) Validate() error {
+	if c.MaxOpenRecords < 0 || c.MaxLockedFiat < 0 {
+		return ErrInvalidExposureCap
+	}
+	return nil
+}
+
+// checkExposureCap returns a non-nil error if opening a position of `cost` on `signal` would take
+// the client's asset over its cap in `config.Trade.ExposureCaps`.
+func (bot *Bot) checkExposureCap(cl *Client, signal SIGNAL, cost float64) error {
+	limit, ok := cfg().Trade.ExposureCaps[cl.asset]
+	if !ok || limit.IsZero() || (signal != SignalLong && signal != SignalShort) {
+		return nil
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	orderType, side := LongOrder, "long"
+	if signal == SignalShort {
+		orderType, side = ShortOrder, "short"
+	}
+	records, err := ledger.GetRecordsByType(cl.asset, orderType)
+	if err != nil {
+		return err
+	}
+	if limit.MaxOpenRecords > 0 && len(records) >= limit.MaxOpenRecords {
+		return fmt.Errorf("%w (%d open %s positions, the cap is %d)", ErrExposureCapReached,
+			len(records), side, limit.MaxOpenRecords)
+	}
+	if limit.MaxLockedFiat <= 0 || signal != SignalLong {
+		return nil
+	}
+	locked := 0.0
+	for _, rec := range records {
+		locked += rec.Cost
+	}
+	if locked+cost > limit.MaxLockedFiat {
+		return fmt.Errorf("%w (%s %.2f would be locked, the cap is %s %.2f)", ErrExposureCapReached,
+			cl.currency, locked+cost, cl.currency, limit.MaxLockedFiat)
+	}
+	return nil
+}
+
+// checkOpenPositions returns an error wrapping `ErrPositionLimitReached` if the positions open across
+// all assets have reached `config.Trade.MaxOpenPositions`.
+func (bot *Bot) checkOpenPositions() error {
+	limit := cfg().Trade.MaxOpenPositions
+	if limit <= 0 {
+		return nil
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	records, err := ledger.AllRecords()
+	if err != nil {
+		return err
+	}
+	if len(records) >= limit {
+		return fmt.Errorf("%w (%d open, the limit is %d)", ErrPositionLimitReached, len(records), limit)
+	}
+	return nil
+}
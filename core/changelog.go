@@ -0,0 +1,183 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `changelog.go` holds the changelog shipped with each release. Changes that alter how Leprechaun
+*  trades must be acknowledged by the user before the bot will start under a new version.
+ */
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Version is the current version of Leprechaun.
+const Version = "0.2.0"
+
+// ErrChangelogNotAcknowledged is returned by `Bot.Run` when the user has not yet reviewed the
+// trading changes introduced since the version they last acknowledged.
+var ErrChangelogNotAcknowledged = errors.New("leprechaun has been updated. Review the changes that affect trading before starting the bot")
+
+// ChangelogEntry describes the changes made in a single release.
+type ChangelogEntry struct {
+	Version string
+	Notes   []string // General changes.
+	Trading []string // Changes in behaviour that affect trading. These must be acknowledged.
+}
+
+// Changelog lists the changes made in each release, newest first.
+var Changelog = []ChangelogEntry{
+	{
+		Version: "0.2.0",
+		Notes: []string{
+			"A risk-free paper trading session for new users.",
+			"Stale open positions are flagged on the stats page.",
+			"Tap an open position on the stats page to see all its details, including fees and the analysis it was opened on.",
+			"Settings are saved safely and a backup is kept. Damaged settings are restored from the backup instead of being reset.",
+			"Read-only observer mode for following a bot running elsewhere.",
+			"Entries can be sized as a fixed fraction of the balance and holdings of a currency, or with the Kelly criterion from its past trades.",
+			"Optional scaling of entry sizes with the analyzer's recent accuracy for each currency.",
+			"Optional scaling of entry sizes with volatility, measured by the Average True Range.",
+			"The analysis of a currency can be skipped while its market is idle, reusing the last signal to save API calls.",
+			"An optional PIN lock for the app. Locking the app does not stop trading.",
+			"An optional budget of exchange requests for each round, shared equally between currencies. Orders are never held back by it.",
+			"Optional JSON events for each currency in each trading round, written to events.jsonl or a socket (see the -events-addr flag).",
+			"/healthz and /readyz endpoints for process supervisors (see the -health-addr flag).",
+			"The analysis period, interval, moving average and trading mode can be changed for individual currencies.",
+			"The number of open positions, and the fiat locked in them, can be capped for each currency.",
+			"An optional limit on the positions open across all currencies. Once it is reached only the open positions are completed.",
+			"An optional daily loss limit that pauses trading for the rest of the day. Trading can be resumed from the main page.",
+			"An optional stop that ends the session once its equity, your fiat and the value of your coins, falls a set percentage below its value at the start.",
+			"The analysis plugin can be retired automatically when its win rate or profit drops below set thresholds.",
+			"An optional kill switch that halts trading of a currency after a sudden price move, until the market calms or trading is resumed from the main page.",
+			"An optional risk manager that limits the exposure to each currency and to the whole portfolio, and stops opening positions after a set drawdown.",
+			"Optional inflation-adjusted view of profits on the stats page, showing real and nominal returns.",
+			"Pairs newly listed by Luno in your currency are offered on the main page and can be watched or traded without a restart.",
+			"An Ichimoku Cloud analysis plugin, \"ichimoku\", for longer-horizon trend signals on hourly candles.",
+			"An \"ensemble\" analysis plugin that lets the other plugins vote on each signal, by majority or with weights, set for each currency in the settings file.",
+			"Analysis plugins can rate their confidence in each signal. Signals below a set confidence can be ignored and entries scaled with it.",
+			"Each currency can be analyzed by its own analysis plugin, chosen with its analyzer overrides.",
+			"The analysis period and the interval between prices can be changed for all currencies on the trade settings page.",
+			"Optional confirmation of signals on 15 or 30 minute candles. A signal is only acted on when the trends of both timeframes agree.",
+			"New \"webhook\" analysis plugin. It trades on buy and sell alerts posted by external charting tools such as TradingView to a local endpoint set in the settings file.",
+			"New \"script\" analysis plugin. It runs your own strategies, written in Starlark, from the strategies folder in the data directory.",
+			"New \"model\" analysis plugin in builds that include a model runtime. It trades on the output of your own machine learning model, and uses Hermes when the model file is missing.",
+			"Analysis plugins are loaded from the plugins folder in the data directory at startup: Go plugins (.so files) and strategies declared in JSON that run a plugin with options of their own.",
+			"The analysis plugin can be chosen on the trade settings page, which shows what each plugin does.",
+			"The log explains each signal: the trend, patterns, indicators and scores or votes behind it.",
+			"Candles whose period is over are kept in memory for a week, so later analyses only retrieve the latest candle from the exchange.",
+			"Closed candles are saved in a local database, so after a restart only the missing candles are retrieved from the exchange.",
+			"Missing candles can be backfilled from CryptoCompare, set as the market data provider in the settings file, instead of being built from the last 100 trades of each period.",
+			"The indicators used by the analysis plugins (SMA, EMA, RSI, ATR, Bollinger Bands, VWAP and candle shapes) are in their own package, for use by third-party plugins.",
+			"New backtest command. It replays saved or imported candles through an analysis plugin, with fees, slippage and minimum order sizes, and prints each trade and the results, without the GUI.",
+			"Candles and trades can be imported into the candle database from CSV and JSON files, including Luno trade exports, with the backtest command's -import flag.",
+			"Backtests report the return against buying and holding, the Sharpe and Sortino ratios, the average holding time and the share of the balance paid in fees, and the backtest command prints them as JSON with -json.",
+			"The backtest command sweeps ranges of profit margins, intervals, analysis periods, trading modes and moving average windows in parallel with the -sweep flags, checks the best configurations on held-out candles and warns of those that look overfitted.",
+			"Walk-forward analysis in the backtest command, with -walk-train and -walk-validate. The best parameters of each training window are traded on the window that follows it, so you can see whether they hold up before trading them live.",
+			"Dry run mode in the general settings. The bot trades with live prices and your balances, but its orders are simulated, and the positions and profits they make are kept apart from real ones.",
+			"Monte Carlo simulations in the backtest command, with -montecarlo. Strategies are backtested on hundreds of price series made up from the history, showing the spread of returns and the chance of ruin of each purchase unit and margin.",
+			"A replay in the stats page steps through a backtest saved with -json, or the last days of live trading, candle by candle on a chart, showing each signal, entry and exit.",
+			"A trade journal in the stats page keeps every executed trade with the signal, confidence, indicator scores and spread behind it. Trades can be searched and annotated with notes.",
+			"Synthetic price series in the backtest command, with -synthetic. Strategies can be tried on trending, mean-reverting, choppy and flash-crash markets that are the same for the same seed.",
+			"The columns of the ledger are typed and indexed, so large ledgers are searched faster. Ledgers of older versions are upgraded when they are opened.",
+			"The records, sales and purchases can be exported to CSV files for Excel and other spreadsheets from the menu of the stats page, optionally between two dates.",
+			"A tax report sums the gains realized in a tax year by asset and by month, matching the coins sold FIFO, LIFO or as traded, and saves it to CSV files.",
+			"The stats page charts the profit of each day, week or month, with a table of the profit of each asset.",
+			"The ledger, trade journal and stats are backed up on a schedule, keeping the latest few backups. Back up now or restore a backup from the stats page.",
+			"Sales, purchases and all time stats are kept in the ledger database instead of JSON files, so every closed position is kept and the all time stats no longer sum prices. Existing files are moved into the ledger on the first run.",
+			"The ledger is checked against the exchange's order and trade history at startup and once a day. Records whose orders never filled, were filled for a different volume or are missing from the exchange are listed on the stats page, where they can be repaired or archived.",
+			"Closed positions are moved to a table of closed records in the ledger instead of being deleted, with the order that closed them. They are included in the exported history.",
+			"The ledger can be kept in PostgreSQL when the bot runs on a server. Set the Storage backend to \"postgres\" and its DSN in the settings file. It can also be kept in a bbolt file, which needs no cgo, by setting the backend to \"bolt\", which also keeps the trade journal and saved candles in bbolt files. Records are not copied when the backend is changed.",
+			"The ledger is opened once and shared, instead of being opened again for every read and write. SQLite ledgers use WAL mode, so reads no longer wait for writes, and a query that hangs gives up after 30 seconds.",
+			"Writes to the ledger that find it locked by another program are tried again a few times before they fail.",
+			"The equity of your account, your fiat and the value of your open positions, is saved to the ledger with each profit snapshot. The stats page charts it over time, and it is exported with the rest of your history.",
+			"The trades you made on Luno before you used Leprechaun can be imported from the export view, so your all time stats include them.",
+			"Run Leprechaun with -verify-ledger to check the ledger for orphan sale IDs, records with no volume, trigger prices that do not match your profit margin and orders recorded twice. Add -repair to fix them.",
+			"The ledger keeps the fees the exchange charged on each order, and the stats and exports show the profit of closed positions after fees.",
+			"Exchange requests that fail because of the network, the exchange's servers or its rate limit are tried again after a growing, randomized wait. Orders are only sent again when the rate limit refused them.",
+			"When the app is closed, Leprechaun waits up to 30 seconds for the orders and ledger writes that are running to finish, then closes the ledger and its logs.",
+			"Settings saved while Leprechaun runs are applied within a minute, once the current trades are complete, without restarting the bot. Changes to your API keys, trading mode, storage and market data take effect the next time it is started.",
+		},
+		Trading: []string{
+			"The currency traded first changes each round, so later currencies are not starved of the exchange's rate limit.",
+			"A currency is paused after 5 failed exchange requests in a row. The pause starts at 5 minutes and doubles, up to an hour, while the requests keep failing.",
+			"Pending orders can be cancelled once they have waited longer than a timeout, which is off by default, and their unfilled volume abandoned or placed again. When an order that was closing a position is cancelled, the part it did not close is held in the ledger again and its profit is corrected.",
+			"Orders are skipped when the spread and expected slippage use up more than half of the profit margin.",
+			"Prices are rounded to the tick size of each pair before orders are placed.",
+			"Candlestick patterns are detected again and note whether they formed at the top or the bottom of the chart. Hammers, hanging men, shooting stars and dojis are recognised.",
+			"Each candle only includes the trades of its own interval. Candles used to include every earlier trade in the analysis period, which skewed their highs, lows and volume.",
+			"Market orders are priced from the order book: buys at the best ask and sells at the best bid. Long positions are closed when the best bid reaches their trigger price.",
+			"Hermes scores the depth of the order book within 1% of the price. Heavy resting bids count towards rising prices and heavy resting asks towards falling prices.",
+			"Hermes and Ichimoku analyze each currency with an instance of their own, and Hermes now keeps the analysis options it is given, so its moving average window and trading mode are no longer reset before each analysis.",
+			"Trigger prices allow for the taker fees of the orders that open and close a position, so the profit margin is what is left after fees.",
+			"Each currency is traded in rounds of its own, so a slow exchange request for one currency no longer delays the others. The requests of all currencies share the exchange's rate limit, and currencies removed from the traded currencies stop trading while Leprechaun runs.",
+		},
+	},
+	{
+		Version: "0.1.0",
+		Notes: []string{
+			"First public release.",
+		},
+	},
+}
+
+// compareVersions compares two dotted version strings. It returns -1 if a is older than b,
+// 1 if it is newer and 0 if they are the same. Missing or invalid parts count as zero.
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// UnreadChangelog returns the changelog entries for releases newer than the version the user last acknowledged.
+func (c *Configuration) UnreadChangelog() []ChangelogEntry {
+	entries := []ChangelogEntry{}
+	for _, entry := range Changelog {
+		if compareVersions(entry.Version, c.AcknowledgedVersion) > 0 && compareVersions(entry.Version, Version) <= 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// oldestVersion is the first release in the changelog. Settings saved by it did not record an acknowledged version.
+func oldestVersion() string {
+	oldest := Version
+	for _, entry := range Changelog {
+		if compareVersions(entry.Version, oldest) < 0 {
+			oldest = entry.Version
+		}
+	}
+	return oldest
+}
+
+// ChangelogPending reports whether there are unacknowledged changes that affect trading.
+func (c *Configuration) ChangelogPending() bool {
+	for _, entry := range c.UnreadChangelog() {
+		if len(entry.Trading) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AcknowledgeChangelog records that the user has reviewed the changes in the current version and saves the settings.
+func (c *Configuration) AcknowledgeChangelog() error {
+	c.AcknowledgedVersion = Version
+	return c.Save()
+}
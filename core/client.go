@@ -9,7 +9,6 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"strconv"
 	"strings"
 	"time"
 
@@ -82,7 +81,9 @@ type Client struct {
 	asset         string
 	currency      string
 	spread        float64 // Bid-Ask spread
+	volume        float64 // Volume traded in the last 24 hours
 	minOrderVol   float64 // Minimum volume that can be traded on the exchange
+	exiting       bool    // Close open positions regardless of their trigger price
 }
 
 // Record holds details of an asset sale or purchase
@@ -115,6 +116,14 @@ type Client struct {
 // `TriggerPrice` specifies the pre-calculated price at whochh the second part of the order is executed.
 // For a long order, this is the price at which to sell the asset and is always higher than the purchase price.
 // For a short order, this is the price at whoch to buy the asset and is always lower than the purchase price.
+//
+// `ParentID` is the order ID of the position a record was split from when a take-profit ladder is in use.
+// It is empty for records that hold a whole position.
+//
+// `ClientRef` is the client reference of the order that opened the record.
+//
+// `RequestedVolume` is the volume the order that opened the record asked for. `Volume` only holds the
+// volume that was filled, so the two differ for orders that were partly filled.
 type Record struct {
 	Asset        string
 	Cost         float64
@@ -127,10 +136,21 @@ type Record struct {
 	Volume       float64
 	Type         OrderType
 	TriggerPrice float64
+	ParentID     string
+	ClientRef    string
+
+	RequestedVolume float64
 
 	// Update legder code first to reflect new struct fields.
+	// LunoAssetFee and LunoFiatFee are the fees the exchange charged on the order that opened the
+	// record, in the asset and in fiat.
 	LunoAssetFee float64
 	LunoFiatFee  float64
+	// Analysis is the analyzer's view of the market when the record was opened, if it was
+	// opened on a signal.
+	Analysis *AnalysisSnapshot
+	// Simulated reports whether the record was opened by a simulated order in a dry run.
+	Simulated bool
 	// PPercent  float64 // Profit Percentage
 }
 
@@ -147,21 +167,20 @@ type reprRecord struct {
 // NewRecord creates a new `Record` object
 func NewRecord(asset string, price float64, timestamp string,
 	volume float64, id string, orderType OrderType) (rec Record) {
+	info := AssetPairInfo(asset)
 	rec.Asset = asset
 	rec.Cost = price * volume
-	rec.Price = price
+	rec.Price = info.RoundPrice(price)
 	rec.ID = id
 	rec.SaleID = ""
 	rec.Sold = false
 	rec.Status = ""
 	rec.Timestamp = timestamp
 	rec.Volume = volume
+	rec.RequestedVolume = volume
 	rec.Type = orderType
-	if rec.Type == LongOrder {
-		rec.TriggerPrice = rec.Price + (rec.Price * config.ProfitMargin)
-	} else if rec.Type == ShortOrder {
-		rec.TriggerPrice = rec.Price - (rec.Price * config.ProfitMargin)
-	}
+	rec.TriggerPrice = info.TriggerPrice(rec.Price, cfg().ProfitMargin, rec.Type)
+	rec.Simulated = simulatedOrder(id)
 	return
 }
 
@@ -175,6 +194,8 @@ func (rec Record) String() string {
 type ProfitEntry struct {
 	Asset          string
 	OrderID        string
+	ParentID       string // ID of the laddered position this entry closes a tranche of, if any.
+	Opened         string // Time the position was opened. Empty for entries saved by older versions.
 	Timestamp      string
 	PurchasePrice  float64
 	PurchaseVolume float64
@@ -183,6 +204,11 @@ type ProfitEntry struct {
 	SaleVolume     float64
 	SaleCost       float64
 	Profit         float64
+	// Fees are the fees charged on the orders that opened and closed the position, in fiat. Entries
+	// saved by older versions have none.
+	Fees      float64
+	NetProfit float64 // Profit less the fees.
+	Tranches  int     // Number of take-profit tranches closed. Counts all tranches in the all time stats.
 }
 type reprProfitEntry struct {
 	Asset      string
@@ -192,11 +218,13 @@ type reprProfitEntry struct {
 	SaleVolume float64
 	SaleCost   float64
 	Profit     float64
+	NetProfit  float64
 }
 
 func (entry *ProfitEntry) String() string {
 	e := reprProfitEntry{Asset: entry.Asset, ID: entry.OrderID, Timestamp: entry.Timestamp, SalePrice: entry.SalePrice,
-		SaleVolume: entry.SaleVolume, SaleCost: entry.SaleCost, Profit: entry.Profit}
+		SaleVolume: entry.SaleVolume, SaleCost: entry.SaleCost, Profit: entry.Profit,
+		NetProfit: entry.NetProfit}
 	return fmt.Sprintf("%+v", e)
 }
 
@@ -209,55 +237,157 @@ type Bot struct {
 	id              int
 	cancel          context.CancelFunc
 	chans           *Channels
-	connectRetries  int
 	analyzer        Analyzer
 	analyzerOptions *AnalysisOptions
+	orders          *OrderTracker
+	risk            *RiskManager
+	equity          *equityTracker
 }
 
-// PurchaseQuote buys an asset using the qoute technique
-func (cl *Client) PurchaseQuote() (rec Record, err error) {
-	// TODO: Make sure quote isn't expired b4 exercising it.
-	// If expired recreate it by using `continue` to go to the topof the loop
-	// break out of the loop.
-	fmt.Println("In Purchase Quote")
-	price, err := cl.CurrentPrice()
-	if err != nil {
+// Order execution methods.
+const (
+	// ExecutionMarket places market orders. They fill at the best prices in the order book.
+	ExecutionMarket = "market"
+	// ExecutionQuote trades through quotes. The price is fixed when the quote is created.
+	ExecutionQuote = "quote"
+)
+
+var (
+	// ErrQuoteExpired is returned when no quote could be exercised before it expired.
+	ErrQuoteExpired = errors.New("the quote expired before it could be exercised")
+	// ErrQuotesDisabled is returned by the quote methods unless `config.Trade.Execution` is `ExecutionQuote`.
+	// Quotes are always disabled while paper trading.
+	ErrQuotesDisabled = errors.New("trading through quotes is disabled")
+	// maxQuoteAttempts is the number of quotes requested for an order before giving up.
+	maxQuoteAttempts = 3
+	// quoteMargin is the least time a quote must have left for it to be exercised.
+	quoteMargin = 2 * time.Second
+)
+
+// placeOrder places an order with the execution method set in `config.Trade.Execution` and returns
+// the price it is expected to fill at. Paper trading always uses market orders.
+func (cl *Client) placeOrder(ref string, side luno.OrderType, price, volume float64) (orderID string, fillPrice float64, err error) {
+	if quotesEnabled() {
+		return cl.quote(ref, side, volume)
+	}
+	// Price the order from the side of the order book that fills it. The ticker price is kept if the book is unavailable.
+	if bookPrice, e := cl.ExecutionPrice(side, volume); e == nil {
+		price = bookPrice
+	} else {
+		debugf("Could not price the %s order from the order book. The ticker price is used. Reason: %v", cl.Pair, e)
+	}
+	if side == luno.OrderTypeBuy {
+		orderID, err = cl.bid(ref, price, volume)
+	} else {
+		orderID, err = cl.ask(ref, price, volume)
+	}
+	return orderID, price, err
+}
+
+// quote buys or sells `volume` of the client's asset through a quote. A quote that expires (or
+// is about to) before it is exercised is discarded and a new one is requested, up to `maxQuoteAttempts` times.
+func (cl *Client) quote(ref string, side luno.OrderType, volume float64) (quoteID string, price float64, err error) {
+	quoteType := "BUY"
+	if side == luno.OrderTypeSell {
+		quoteType = "SELL"
+	}
+	for attempt := 1; attempt <= maxQuoteAttempts; attempt++ {
+		sleep() // Error 429 safety
+		req := luno.CreateQuoteRequest{Type: quoteType, BaseAmount: decimal(volume), Pair: cl.Pair,
+			BaseAccountId: stringToInt(cl.accountID), CounterAccountId: stringToInt(cl.fiatAccountID)}
+		created, e := cl.CreateQuote(ctx, &req)
+		if e != nil {
+			submitIntent(ref, "", e)
+			err = e
+			break
+		}
+		expiry := time.Time(created.ExpiresAt)
+		if time.Until(expiry) < quoteMargin {
+			debugf("Quote %s for %s expires at %s. Requesting a new one...", created.Id, cl.name, expiry.Format(timeFormat))
+			cl.DiscardQuote(ctx, &luno.DiscardQuoteRequest{Id: stringToInt(created.Id)})
+			continue
+		}
+		submitQuote(ref, created.Id)
+		sleep() // Error 429 safety
+		exercised, e := cl.ExerciseQuote(ctx, &luno.ExerciseQuoteRequest{Id: stringToInt(created.Id)})
+		if e != nil {
+			if time.Now().Before(expiry) {
+				// Errors other than those from the exchange leave the quote to be reconciled at startup.
+				submitIntent(ref, created.Id, e)
+				err = e
+				break
+			}
+			debugf("Quote %s for %s expired before it was exercised. Requesting a new one...", created.Id, cl.name)
+			continue
+		}
+		base, counter := exercised.BaseAmount.Float64(), exercised.CounterAmount.Float64()
+		if base <= 0 {
+			confirmIntent(ref)
+			err = fmt.Errorf("quote %s was exercised for no %s", exercised.Id, cl.asset)
+			break
+		}
+		quoteID, price = exercised.Id, counter/base
+		notify(EventTrade, cl.asset, "Quote to %s %.4f %s at %s %s has been exercised.", strings.ToLower(quoteType),
+			base, cl.asset, cl.currency, GetPairInfo(cl.Pair).FormatPrice(price))
 		return
 	}
-	purchaseUnit := config.AdjustedPurchaseUnit - (0.0099 * config.AdjustedPurchaseUnit)
-	volume := purchaseUnit / price
-	trimmedVolume := strconv.FormatFloat(volume, 'f', -1, 64)
-	volume, _ = strconv.ParseFloat(trimmedVolume, 64)
-	fmt.Println("Price:", price, "Purchase unit", purchaseUnit, "Volume", volume)
-	quote := luno.CreateQuoteRequest{Type: "BUY", BaseAmount: decimal(volume), Pair: cl.Pair,
-		BaseAccountId: stringToInt(cl.accountID), CounterAccountId: stringToInt(cl.fiatAccountID)}
-	res, err := cl.CreateQuote(ctx, &quote)
+	if err == nil {
+		// No quote was exercised, so nothing was traded.
+		confirmIntent(ref)
+		err = ErrQuoteExpired
+	}
+	notify(EventError, cl.asset, "Could not %s %.4f %s through a quote. Reason: %v", strings.ToLower(quoteType), volume, cl.asset, err)
+	return "", 0, err
+}
+
+// quotesEnabled reports whether orders may be placed through quotes.
+func quotesEnabled() bool {
+	return cfg().Trade.Execution == ExecutionQuote && !cfg().Paper.Enabled && !dryRun()
+}
+
+// PurchaseQuote buys `volume` of the client's asset through a quote and returns the long position.
+// It returns `ErrQuotesDisabled` unless quotes are the configured execution method.
+func (cl *Client) PurchaseQuote(volume float64) (rec Record, err error) {
+	if !quotesEnabled() {
+		return rec, ErrQuotesDisabled
+	}
+	ref := beginIntent(OrderIntent{Pair: cl.Pair, Asset: cl.asset, Side: luno.OrderTypeBuy,
+		Volume: volume, Type: LongOrder})
+	quoteID, price, err := cl.quote(ref, luno.OrderTypeBuy, volume)
 	if err != nil {
-		fmt.Println("Quote request error: ", err)
 		return
 	}
-	fmt.Println("Quote Created:")
-	fmt.Printf("QQ:: %#v\n", res)
-	fmt.Println("Quote ID:", res.Id)
-	expiry := &res.ExpiresAt
-	fmt.Println("Quote Expiry:", expiry.String())
-	baseAmount, counterAmount := &res.BaseAmount, &res.CounterAmount
-	fmt.Printf("Bought %s for %s\n", baseAmount.String(), counterAmount.String())
-	exerciseQuote := luno.ExerciseQuoteRequest{Id: stringToInt(res.Id)}
-	exercisedQuote, err := cl.ExerciseQuote(ctx, &exerciseQuote)
-	rec = NewRecord(cl.asset, exercisedQuote.CounterAmount.Float64(), time.Now().String(),
-		exercisedQuote.BaseAmount.Float64(), exercisedQuote.Id, LongOrder)
+	cl.lockedVolume += volume
+	rec = NewRecord(cl.asset, price, time.Now().Format(timeFormat), volume, quoteID, LongOrder)
+	rec.ClientRef = ref
 	return
 }
 
-// SellQuote sells an asset using the quote technique.
-func (cl *Client) SellQuote() {
+// SellQuote sells `volume` of the client's asset through a quote and returns the short position.
+// It returns `ErrQuotesDisabled` unless quotes are the configured execution method.
+func (cl *Client) SellQuote(volume float64) (rec Record, err error) {
+	if !quotesEnabled() {
+		return rec, ErrQuotesDisabled
+	}
+	ref := beginIntent(OrderIntent{Pair: cl.Pair, Asset: cl.asset, Side: luno.OrderTypeSell,
+		Volume: volume, Type: ShortOrder})
+	quoteID, price, err := cl.quote(ref, luno.OrderTypeSell, volume)
+	if err != nil {
+		return
+	}
+	cl.lockedBalance += price * volume
+	rec = NewRecord(cl.asset, price, time.Now().Format(timeFormat), volume, quoteID, ShortOrder)
+	rec.ClientRef = ref
 	return
 }
 
 // bid places an order to buys a specified amount of an asset on the exchange
 // It executes immediately.
-func (cl *Client) bid(price float64, volume float64) (orderID string, err error) {
+// bid places a market buy order. `ref` is the client reference of the order's intent.
+func (cl *Client) bid(ref string, price float64, volume float64) (orderID string, err error) {
+	if dryRun() {
+		return cl.simulateOrder(ref, luno.OrderTypeBuy, price, volume), nil
+	}
 	sleep() // Error 429 safety
 	cost := price * volume
 	debugf("Placing bid order for NGN %.2f worth of %s (approx. %.2f %s) on the exchange...\n", cost, cl.name, volume, cl.asset)
@@ -266,17 +396,27 @@ func (cl *Client) bid(price float64, volume float64) (orderID string, err error)
 		BaseAccountId: stringToInt(cl.accountID), CounterAccountId: stringToInt(cl.fiatAccountID),
 		CounterVolume: decimal(cost)}
 	res, err := cl.PostMarketOrder(ctx, &req)
-	orderID = res.OrderId
+	if err == nil {
+		orderID = res.OrderId
+	}
+	submitIntent(ref, orderID, err)
 	if err != nil {
+		notify(EventError, cl.asset, "Could not place bid order for %.4f %s. Reason: %v", volume, cl.asset, err)
 		return
 	}
-	debugf("Bid order for %.4f %s has been placed on the exchange.\n", volume, cl.asset)
+	trackOrder(cl, orderID, luno.OrderTypeBuy, volume)
+	notify(EventTrade, cl.asset, "Bid order for %.4f %s has been placed on the exchange.", volume, cl.asset)
 	return
 
 }
 
 // ask places a bid order on the excahnge to sell `volume` worth of Client.asset in exhange for fiat currency.
-func (cl *Client) ask(price, volume float64) (orderID string, err error) {
+
+// ask places a market sell order. `ref` is the client reference of the order's intent.
+func (cl *Client) ask(ref string, price, volume float64) (orderID string, err error) {
+	if dryRun() {
+		return cl.simulateOrder(ref, luno.OrderTypeSell, price, volume), nil
+	}
 	sleep() // Error 429 safety
 	cost := price * volume
 	//Place ask order on the exchange
@@ -287,12 +427,17 @@ func (cl *Client) ask(price, volume float64) (orderID string, err error) {
 		BaseAccountId: stringToInt(cl.accountID), BaseVolume: decimal(volume),
 		CounterAccountId: stringToInt(cl.fiatAccountID)}
 	res, err := cl.PostMarketOrder(ctx, &req)
+	if err == nil {
+		orderID = res.OrderId
+	}
+	submitIntent(ref, orderID, err)
 	if err != nil {
 		debugf("(in `Client.ask`) %v", err.Error())
+		notify(EventError, cl.asset, "Could not place ask order for %.4f %s. Reason: %v", volume, cl.asset, err)
 		return
 	}
-	orderID = res.OrderId
-	debugf("Ask order for %.4f %s has been placed on the exchange.\n", volume, cl.asset)
+	trackOrder(cl, orderID, luno.OrderTypeSell, volume)
+	notify(EventTrade, cl.asset, "Ask order for %.4f %s has been placed on the exchange.", volume, cl.asset)
 	return
 }
 
@@ -306,7 +451,9 @@ func (cl *Client) GoLong(volume float64) (rec Record, err error) {
 	}
 	ts := time.Now().Format(timeFormat)
 	// Place market bid order.
-	purchaseOrderID, err := cl.bid(price, volume)
+	ref := beginIntent(OrderIntent{Pair: cl.Pair, Asset: cl.asset, Side: luno.OrderTypeBuy,
+		Price: price, Volume: volume, Type: LongOrder})
+	purchaseOrderID, price, err := cl.placeOrder(ref, luno.OrderTypeBuy, price, volume)
 	if err != nil {
 		debugf("An error occured while going long!")
 		return Record{}, err
@@ -315,12 +462,14 @@ func (cl *Client) GoLong(volume float64) (rec Record, err error) {
 	debug("Order ID:", purchaseOrderID)
 	cl.lockedVolume += volume
 
-	return NewRecord(cl.asset, price, ts, volume, purchaseOrderID, LongOrder), nil
+	rec = NewRecord(cl.asset, price, ts, volume, purchaseOrderID, LongOrder)
+	rec.ClientRef = ref
+	return rec, nil
 }
 
 // GoShort sells an asset at a certain price with the aim of repurchasing the same
 // volume of asset sold at a lower price in the future to realize a profit.
-// TODO XXX: Implement stoploss for short sold assets
+// Short positions are repurchased at a loss if the price rises past their stop-loss price (see `Record.StopLossPrice`).
 // TODO: Make short-selling an  option
 func (cl *Client) GoShort(volume float64) (rec Record, err error) {
 	// goShort
@@ -330,7 +479,9 @@ func (cl *Client) GoShort(volume float64) (rec Record, err error) {
 		return Record{}, err
 	}
 	ts := time.Now().Format(timeFormat)
-	saleOrderID, err := cl.ask(price, volume)
+	ref := beginIntent(OrderIntent{Pair: cl.Pair, Asset: cl.asset, Side: luno.OrderTypeSell,
+		Price: price, Volume: volume, Type: ShortOrder})
+	saleOrderID, price, err := cl.placeOrder(ref, luno.OrderTypeSell, price, volume)
 	if err != nil {
 		debugf("An error occured while executing a short order! Reason: %s", err.Error())
 		if strings.Contains(err.Error(), "ErrInsufficientBalance") {
@@ -342,7 +493,9 @@ func (cl *Client) GoShort(volume float64) (rec Record, err error) {
 	cl.lockedBalance += cost
 	debug("Order ID:", saleOrderID)
 
-	return NewRecord(cl.asset, price, ts, volume, saleOrderID, ShortOrder), nil
+	rec = NewRecord(cl.asset, price, ts, volume, saleOrderID, ShortOrder)
+	rec.ClientRef = ref
+	return rec, nil
 }
 
 // Returns a string representation of a Client struct
@@ -372,7 +525,7 @@ func (cl *Client) ConfirmOrder(rec *Record) {
 
 func (cl *Client) retrieveBalances() (err error) {
 	sleep() // Error 429 safety
-	assetBalanceReq := luno.GetBalancesRequest{Assets: []string{cl.asset}}
+	assetBalanceReq := luno.GetBalancesRequest{Assets: []string{cl.asset, cl.currency}}
 	assetBalance, err := cl.GetBalances(ctx, &assetBalanceReq)
 	if err != nil {
 		return err
@@ -395,15 +548,27 @@ func (cl *Client) retrieveBalances() (err error) {
 	return
 }
 
-// CheckBalanceSufficiency determines whether the client has purchasing power
-func (cl *Client) CheckBalanceSufficiency() (canPurchase bool, err error) {
-	// Luno charges a 1% taker fee
-	purchaseUnit := config.AdjustedPurchaseUnit
+// PurchaseUnit returns the amount of fiat to spend on a purchase at `price`. If `config.PurchasePercentage`
+// is set it is a share of the current fiat balance, but never less than the minimum volume the exchange trades.
+func (cl *Client) PurchaseUnit(price float64) float64 {
+	if cfg().PurchasePercentage <= 0 {
+		return cfg().PurchaseUnit
+	}
+	unit := cl.fiatBalance * cfg().PurchasePercentage
+	if min := GetPairInfo(cl.Pair).MinVolume * price; unit < min {
+		unit = min
+	}
+	return unit
+}
+
+// CheckBalanceSufficiency determines whether the client has purchasing power for a purchase of
+// `purchaseUnit`, the purchase unit adjusted for the taker fee.
+func (cl *Client) CheckBalanceSufficiency(purchaseUnit float64) (canPurchase bool, err error) {
 	if cl.fiatBalance <= 0.0 {
 		cl.retrieveBalances()
 	}
 	if cl.fiatBalance < purchaseUnit {
-		// `AdjustedPurchaseUnit` is more than available balance (NGN)
+		// `purchaseUnit` is more than available balance (NGN)
 		canPurchase = false
 		err = ErrInsufficientBalance
 	} else {
@@ -447,16 +612,18 @@ func (cl *Client) UpdateOrderDetails(rec Record) (updated Record, err error) {
 		// return record unchanged
 		return rec, err
 	}
-	if orderDetails.State == luno.OrderStatePending {
+	if orderDetails.State == luno.OrderStatePending && orderDetails.Base.Float64() == 0 {
 		debugf("%v with id %s is still PENDING!", rec.Type, rec.ID)
 		return rec, nil
 	}
 	updated = rec
-	updated.LunoFiatFee = orderDetails.FeeCounter.Float64()
-	updated.Cost = orderDetails.Counter.Float64()
-	updated.Volume = orderDetails.Base.Float64()
-	updated.Price = rec.Cost / rec.Volume
-	updated.LunoAssetFee = orderDetails.FeeBase.Float64()
+	updated.LunoAssetFee, updated.LunoFiatFee = orderDetails.FeeBase.Float64(), orderDetails.FeeCounter.Float64()
+	updated.applyFill(orderDetails.Base.Float64(), orderDetails.Counter.Float64())
+	if orderDetails.State == luno.OrderStatePending {
+		// The order tracker updates the record once the rest of the order is filled or cancelled.
+		debugf("%v with id %s is partly filled (%.6f of %.6f %s).", rec.Type, rec.ID,
+			updated.Volume, updated.RequestedVolume, rec.Asset)
+	}
 	updated.Timestamp = orderDetails.CompletedTimestamp.String()
 	fmt.Println("Record updated from: ")
 	fmt.Printf("%#v\n", rec)
@@ -465,6 +632,36 @@ func (cl *Client) UpdateOrderDetails(rec Record) (updated Record, err error) {
 	return
 }
 
+// applyFill sets the volume and cost of a record to what its order has filled. The price is set to
+// the average price the order was filled at and the trigger price moves with it.
+func (rec *Record) applyFill(filled, counter float64) {
+	if rec.RequestedVolume == 0 {
+		// Records saved by older versions do not hold the requested volume.
+		rec.RequestedVolume = rec.Volume
+	}
+	rec.Volume, rec.Cost = filled, counter
+	if filled > 0 {
+		info := AssetPairInfo(rec.Asset)
+		rec.Price = info.RoundPrice(counter / filled)
+		rec.TriggerPrice = info.TriggerPrice(rec.Price, cfg().ProfitMargin, rec.Type)
+	}
+}
+
+// Fees returns the fees charged on the order that opened the record, in fiat. Fees charged in the asset
+// are valued at the record's price.
+func (rec Record) Fees() float64 {
+	return rec.LunoFiatFee + rec.LunoAssetFee*rec.Price
+}
+
+// closingFee estimates the fee of a market order that closes a position of `asset` at `price` for
+// `volume`, from the taker fee of its pair. Quotes have no fee of their own, as it is in their price.
+func closingFee(asset string, price, volume float64) float64 {
+	if quotesEnabled() {
+		return 0
+	}
+	return AssetPairInfo(asset).TakerFee * price * volume
+}
+
 // CurrentPrice retrieves the ask price for the client's asset.
 func (cl *Client) CurrentPrice() (price float64, err error) {
 	sleep() // Error 429 safety
@@ -475,6 +672,7 @@ func (cl *Client) CurrentPrice() (price float64, err error) {
 	}
 	price = res.Ask.Float64()
 	cl.spread = res.Ask.Float64() - res.Bid.Float64()
+	cl.volume = res.Rolling24HourVolume.Float64()
 	return
 }
 
@@ -519,16 +717,21 @@ func (cl *Client) PreviousTrades(period, interval time.Duration) (ohlcData []OHL
 	// Retrieve past trades from the exchange.
 	// IMPORTANT: Note that LUNO's API only returns at most 100 trades per call, so the data used here
 	// is an incomplete approximation of real life trades and should be used with caution.
+	// Candles saved by earlier analyses are read from the candle database. Only the gaps are retrieved.
+	stored := cl.storedCandles(tradeTimes, interval)
+	// Closed candles missing from the database may be backfilled from a market data provider.
+	for start, candle := range cl.backfillCandles(candleGaps(tradeTimes, stored), interval) {
+		stored[start] = candle
+	}
 	Trades := map[luno.Time][]luno.Trade{}
-	for _, timestamp := range tradeTimes {
+	for _, timestamp := range candleGaps(tradeTimes, stored) {
 		Trades[timestamp] = []luno.Trade{}
-		sleep2() // Error 429 safety
-		req := luno.ListTradesRequest{Pair: cl.Pair, Since: timestamp}
-		res, err := cl.ListTrades(ctx, &req)
+		// The trades of earlier candles are usually cached from the last analysis.
+		trades, err := cl.tradesSince(timestamp, interval)
 		if err != nil {
 			return nil, nil, ErrNetworkFailed
 		}
-		for _, trade := range res.Trades {
+		for _, trade := range trades {
 			for tmstmp := range Trades {
 				if isMinutes {
 					if time.Time(trade.Timestamp).Minute() >= time.Time(tmstmp).Minute() &&
@@ -547,10 +750,17 @@ func (cl *Client) PreviousTrades(period, interval time.Duration) (ohlcData []OHL
 			}
 		}
 	}
-	Prices := []float64{}
-	Volume := 0.0
 	// group timestamps hourly
+	retrieved := []OHLC{}
 	for _, hour := range tradeTimes {
+		if candle, ok := stored[time.Time(hour).UTC()]; ok {
+			closingPrices = append(closingPrices, candle.Close)
+			ohlcData = append(ohlcData, candle)
+			continue
+		}
+		// Each candle only holds the prices and volume of the trades in its own period.
+		Prices := []float64{}
+		Volume := 0.0
 		trades := Trades[hour]
 		reverseSlice(trades) // earliest trades should come first.
 		// add the closing price for each period (hour) to a list.
@@ -563,8 +773,9 @@ func (cl *Client) PreviousTrades(period, interval time.Duration) (ohlcData []OHL
 		// Collate all trade price and volume for each hour into a OHLC (candlestick) struct
 		candle := doOHLC(time.Time(hour), Prices, Volume)
 		ohlcData = append(ohlcData, candle)
-
+		retrieved = append(retrieved, candle)
 	}
+	cl.saveClosedCandles(interval, retrieved)
 	// for i, d := range ohlcData {
 	// 	fmt.Printf("%d - %#v\n", i, d)
 	// }
@@ -654,15 +865,19 @@ func (cl *Client) FeeInfo() (info luno.GetFeeInfoResponse, err error) {
 // TopOrders retrieves the top ask and bid orders on the exchange
 func (cl *Client) TopOrders() (orders map[string]luno.OrderBookEntry) {
 	sleep() // Error 429 safety
+	orders = map[string]luno.OrderBookEntry{}
 	req := luno.GetOrderBookRequest{Pair: cl.Pair}
 	orderBook, err := cl.GetOrderBook(ctx, &req)
 	if err != nil {
 		debug(err)
+		return
+	}
+	if len(orderBook.Asks) > 0 {
+		orders["ask"] = orderBook.Asks[0]
+	}
+	if len(orderBook.Bids) > 0 {
+		orders["bid"] = orderBook.Bids[0]
 	}
-	topAsk := orderBook.Asks[0]
-	topBid := orderBook.Bids[0]
-	orders["ask"] = topAsk
-	orders["bid"] = topBid
 	return
 }
 
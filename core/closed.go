@@ -0,0 +1,128 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `closed.go` keeps the records of closed positions. When a position is closed its record is moved from
+*  the RECORDS table to the CLOSED_RECORDS table of the ledger, with the order that closed it and the
+*  price and volume it was closed at, instead of being deleted. The ledger so keeps the full life of
+*  every position, from the analysis that opened it to the order that closed it, for reports and
+*  exports. Positions closed by older versions were deleted and are not in the table.
+ */
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// closedColumns are the columns of the CLOSED_RECORDS table that follow those of the RECORDS table.
+var closedColumns = []struct {
+	name, kind, zero string
+}{
+	{"CLOSED_AT", "TEXT", "''"},
+	{"CLOSE_ORDER_ID", "TEXT", "''"},
+	{"CLOSE_PRICE", "REAL", "0"},
+	{"CLOSE_VOLUME", "REAL", "0"},
+}
+
+var (
+	closedInit = func() string {
+		columns := []string{}
+		for _, c := range closedColumns {
+			columns = append(columns, fmt.Sprintf("%s %s NOT NULL DEFAULT %s", c.name, c.kind, c.zero))
+		}
+		return strings.TrimSuffix(recordsTable("IF NOT EXISTS CLOSED_RECORDS"), ")") + ", " + strings.Join(columns, ", ") + ")"
+	}()
+	closedIndex  = "CREATE INDEX IF NOT EXISTS CLOSED_RECORDS_ASSET ON CLOSED_RECORDS (ASSET, CLOSED_AT)"
+	closedMove   = moveRecordOp("CLOSED_RECORDS", "CLOSED_AT", "CLOSE_ORDER_ID", "CLOSE_PRICE", "CLOSE_VOLUME")
+	closedSelect = "SELECT " + recordColumnList() + ", CLOSED_AT, CLOSE_ORDER_ID, CLOSE_PRICE, CLOSE_VOLUME FROM CLOSED_RECORDS "
+	closedQuery  = closedSelect + "WHERE ? = '' OR ASSET = ? ORDER BY CLOSED_AT, ID"
+	// closedByOrder selects the record closed by an order.
+	closedByOrder = closedSelect + "WHERE CLOSE_ORDER_ID = ?"
+	// reopenOp copies the record closed by an order back to the RECORDS table, and reopenDelete removes it
+	// from the closed records.
+	reopenOp     = "INSERT INTO RECORDS (" + recordColumnList() + ") SELECT " + recordColumnList() + " FROM CLOSED_RECORDS WHERE CLOSE_ORDER_ID = ?"
+	reopenDelete = "DELETE FROM CLOSED_RECORDS WHERE CLOSE_ORDER_ID = ?"
+)
+
+// ClosedRecord is the record of a closed position and the order that closed it.
+type ClosedRecord struct {
+	Record
+	ClosedAt     string
+	CloseOrderID string
+	// ClosePrice and CloseVolume are the price and volume the position was closed at.
+	ClosePrice, CloseVolume float64
+}
+
+// Closed returns the time the position was closed.
+func (c ClosedRecord) Closed() (time.Time, error) {
+	return time.ParseInLocation(timeFormat, c.ClosedAt, time.Local)
+}
+
+// moveRecordOp returns the statement that copies a record from the RECORDS table to `table`, setting the
+// `extra` columns that follow the record's columns in it. Its arguments are the values of the extra
+// columns, followed by the ID of the record.
+func moveRecordOp(table string, extra ...string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(extra)), ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s, %s) SELECT %s, %s FROM RECORDS WHERE ID = ?", table, recordColumnList(),
+		strings.Join(extra, ", "), recordColumnList(), placeholders)
+}
+
+// CloseRecord moves the record `id` to the closed records, noting the order that closed it at `price`
+// for `volume` at `closedAt`, a time in `timeFormat`. Like `DeleteRecord`, closing a record that is no
+// longer open does nothing.
+func (l *Ledger) CloseRecord(id, orderID, closedAt string, price, volume float64) (err error) {
+	store, c, done, err := l.open()
+	if err != nil {
+		return
+	}
+	defer done()
+	closed := ClosedRecord{Record: Record{ID: id}, ClosedAt: closedAt, CloseOrderID: orderID, ClosePrice: price, CloseVolume: volume}
+	if err = store.CloseRecord(c, closed); err != nil {
+		return
+	}
+	debugf("Moved record %s to the closed records.", id)
+	return
+}
+
+// ReopenRecord moves the record closed by the order `orderID` back to the open records, e.g. when the
+// order was cancelled before it was filled, and returns it as it was closed. It returns sql.ErrNoRows
+// if the order closed no record.
+func (l *Ledger) ReopenRecord(orderID string) (closed ClosedRecord, err error) {
+	store, c, done, err := l.open()
+	if err != nil {
+		return
+	}
+	defer done()
+	if closed, err = store.ReopenRecord(c, orderID); err != nil {
+		return
+	}
+	debugf("Moved record %s back to the open records.", closed.ID)
+	return
+}
+
+// closedScanner scans the columns of a closed record that follow those of the RECORDS table into `rec`.
+type closedScanner struct {
+	rows rowScanner
+	rec  *ClosedRecord
+}
+
+// Scan reads the record's columns into `dest` and the rest into the closed record.
+func (s closedScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append(dest, &s.rec.ClosedAt, &s.rec.CloseOrderID, &s.rec.ClosePrice, &s.rec.CloseVolume)...)
+}
+
+// ClosedRecords returns the closed records of `asset`, from the earliest closed. An empty `asset` returns
+// the closed records of every asset. Simulated records are included and can be told apart by their
+// `Simulated` field.
+func ClosedRecords(asset string) (records []ClosedRecord, err error) {
+	if !ledgerExists() {
+		return nil, nil
+	}
+	store, c, done, err := sharedLedger.open()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return store.ClosedRecords(c, asset)
+}
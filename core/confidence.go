@@ -0,0 +1,82 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `confidence.go` lets analysis plugins rate how sure they are of a signal. A plugin that implements
+*  `AnalyzerV2` emits a confidence between 0 and 1 with each signal. Signals below the confidence set by
+*  the user are not traded, and the size of an entry can be scaled with the confidence of its signal.
+*  Plugins that only implement `Analyzer` are fully confident in every signal.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrLowConfidence is returned for a signal whose confidence is below `ConfidenceSettings.MinConfidence`.
+var ErrLowConfidence = errors.New("the analysis plugin is not confident enough in the signal")
+
+// AnalyzerV2 is implemented by analysis plugins that rate their signals.
+type AnalyzerV2 interface {
+	Analyzer
+	// EmitConfidence returns the signal, like `Emit`, and how confident the plugin is in it, from 0 to 1.
+	EmitConfidence() (SIGNAL, float64, error)
+}
+
+// ConfidenceSettings configures how the confidence of a signal affects trading.
+type ConfidenceSettings struct {
+	// MinConfidence is the lowest confidence, from 0 to 1, a long or short signal needs to be traded.
+	MinConfidence float64
+	// ScaleSize scales the size of each entry with the confidence of its signal.
+	ScaleSize bool
+}
+
+// Validate returns an error if the minimum confidence is not between 0 and 1.
+func (s ConfidenceSettings) Validate() error {
+	if s.MinConfidence < 0 || s.MinConfidence > 1 {
+		return fmt.Errorf("the minimum confidence must be between 0 and 1, not %v", s.MinConfidence)
+	}
+	return nil
+}
+
+// emitConfidence returns the signal of `plugin` and its confidence. Plugins that do not rate their
+// signals are fully confident.
+func emitConfidence(plugin Analyzer) (SIGNAL, float64, error) {
+	if rated, ok := plugin.(AnalyzerV2); ok {
+		signal, confidence, err := rated.EmitConfidence()
+		return signal, math.Max(0, math.Min(confidence, 1)), err
+	}
+	signal, err := plugin.Emit()
+	return signal, 1, err
+}
+
+// checkConfidence returns an error wrapping `ErrLowConfidence` if a long or short signal is less
+// confident than `config.Trade.Confidence.MinConfidence`.
+func checkConfidence(signal SIGNAL, confidence float64) error {
+	minimum := cfg().Trade.Confidence.MinConfidence
+	if (signal == SignalLong || signal == SignalShort) && confidence < minimum {
+		return fmt.Errorf("%w (%.0f%%, at least %.0f%% is needed)", ErrLowConfidence, confidence*100, minimum*100)
+	}
+	return nil
+}
+
+// confidenceVolume scales the volume of an entry with the confidence of its signal, if the user has chosen
+// to. The volume is not scaled below the smallest order the exchange accepts.
+func (bot *Bot) confidenceVolume(cl *Client, signal SIGNAL, volume, confidence float64) float64 {
+	if !cfg().Trade.Confidence.ScaleSize || confidence >= 1 || (signal != SignalLong && signal != SignalShort) {
+		return volume
+	}
+	scaled := volume * confidence
+	if cl.asset == "XRP" {
+		scaled = math.Floor(scaled)
+	}
+	if scaled < cl.minOrderVol {
+		scaled = cl.minOrderVol
+	}
+	if scaled != volume {
+		debugf("The %v signal for %s is %.0f%% confident. The entry is scaled to %.0f%% of its size.",
+			signal, cl.name, confidence*100, scaled/volume*100)
+	}
+	return scaled
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -59,6 +60,88 @@ type TradeSettings struct {
 	AnalysisPlugin struct {
 		Name string
 	}
+	// TakeProfitLadder splits the exit of a position into tranches. Each tranche sells a
+	// percentage of the purchased volume once its own margin has been reached. An empty
+	// ladder disables laddering and the whole position is closed at `ProfitMargin`.
+	TakeProfitLadder []TakeProfitTranche
+	// StaleOrderTimeout is how long (in minutes) an order may remain pending before it is
+	// cancelled. Zero disables the cancellation of stale orders.
+	StaleOrderTimeout int32
+	// RepriceStaleOrders places the unfilled volume of a cancelled or partly filled order again at
+	// the current price. If it is false the unfilled volume is abandoned.
+	RepriceStaleOrders bool
+	// MaxSpreadRatio is the largest share of the profit margin the bid-ask spread and the expected
+	// slippage of an order may use up. Orders are skipped if it is exceeded. Zero disables the check.
+	MaxSpreadRatio float64
+	// VolumeWeightedPrice prices market orders at the average price the order book can fill the whole
+	// order at, instead of the best price on its side of the book.
+	VolumeWeightedPrice bool
+	// DCA splits each long entry into a series of smaller purchases spread over a window of time.
+	DCA DCASettings
+	// Pyramid adds smaller entries to profitable long positions while the trend persists.
+	Pyramid PyramidSettings
+	// Sizing chooses how much fiat is spent on each new entry.
+	Sizing SizingSettings
+	// StreakSizing scales the size of new entries with the analyzer's recent accuracy for each asset.
+	StreakSizing StreakSizingSettings
+	// VolatilitySizing scales the size of new entries down when an asset is volatile and up when it is calm.
+	VolatilitySizing VolatilitySizingSettings
+	// IdleSkip reuses the last signal of an asset while its price and volume have not changed.
+	IdleSkip IdleSkipSettings
+	// Risk holds the limits enforced by the risk manager before positions are opened.
+	Risk RiskSettings
+	// ExposureCaps limits the open positions of an asset, keyed by the asset's code.
+	ExposureCaps map[string]ExposureCap
+	// MaxOpenPositions caps the positions open at once across all assets. Once it is reached the bot
+	// only completes the open positions until some of them are closed. Zero is unlimited.
+	MaxOpenPositions int
+	// DailyLoss pauses trading for the rest of the day once the day's loss exceeds a limit.
+	DailyLoss DailyLossSettings
+	// SessionStop stops the session once its equity falls too far below its value at the start.
+	SessionStop SessionStopSettings
+	// StrategyKill retires the analysis plugin when its win rate or profit drops below set thresholds.
+	StrategyKill StrategyKillSettings
+	// FlashMove halts trading of an asset whose price moves too far within one analysis interval.
+	FlashMove FlashMoveSettings
+	// PatternSensitivity holds the thresholds used by the analyzer to detect candlestick patterns.
+	PatternSensitivity PatternSensitivity
+	// AnalysisPeriod is how many hours of price data are analyzed for each asset. Zero uses the
+	// analysis plugin's default, or 24 hours.
+	AnalysisPeriod int32
+	// AnalysisInterval is the time (in minutes) between the data points analyzed, i.e. the length of
+	// each candle. Zero uses the analysis plugin's default, or an hour.
+	AnalysisInterval int32
+	// AnalyzerOverrides replaces individual analysis options for an asset, keyed by the asset's code.
+	// e.g. a shorter moving average window for XRP or a longer analysis period for XBT.
+	AnalyzerOverrides map[string]AnalyzerOverrides
+	// Ensemble configures how the "ensemble" analysis plugin combines the signals of the other plugins.
+	Ensemble EnsembleSettings
+	// AssetEnsembles replaces the ensemble settings for an asset, keyed by the asset's code.
+	AssetEnsembles map[string]EnsembleSettings
+	// Model configures the "model" analysis plugin, which trades on the output of the user's machine learning model.
+	Model ModelSettings
+	// Timeframes confirms signals on a second, shorter, timeframe.
+	Timeframes TimeframeSettings
+	// Confidence sets the confidence a signal needs to be traded and whether entries are scaled with it.
+	Confidence ConfidenceSettings
+	// ManualApproval asks the user to approve every long or short entry before the order is placed.
+	ManualApproval bool
+	// ApprovalTimeout is how long (in seconds) a trade proposal waits for the user's decision.
+	// Proposals that are not approved in time are rejected.
+	ApprovalTimeout int32
+	// Execution is how orders are placed: `ExecutionMarket` (market orders) or `ExecutionQuote` (quotes).
+	Execution string
+	// ReferencePrice cross-checks the exchange's ticker against a public price source.
+	ReferencePrice ReferencePriceSettings
+	// PairStatus watches the traded pairs for suspensions and delistings.
+	PairStatus PairStatusSettings
+}
+
+// TakeProfitTranche is a single step of a take-profit ladder.
+// e.g. {Percentage: 0.5, Margin: 0.02} sells 50% of a position once the price has moved 2% in our favour.
+type TakeProfitTranche struct {
+	Percentage float64 // Fraction of the position's volume to close in this tranche.
+	Margin     float64 // Profit margin at which the tranche is closed.
 }
 
 // ConfigField represents a single field that can be marked to indicate its value has been changed
@@ -75,32 +158,62 @@ func (field *ConfigField) Update(val ...interface{}) {
 
 // Configuration object holds settings for Leprechaun.
 type Configuration struct {
-	Name                 string
-	SupportedAssets      []string
-	ExitOnInitFailed     bool
-	APIKeyID             string
-	APIKeySecret         string
-	PurchaseUnit         float64
-	AssetsToTrade        []string
-	EmailAddress         string
-	ProfitMargin         float64
-	LedgerDatabase       string
-	SnoozeTimes          []int32
-	SnoozePeriod         int32
-	Verbose              bool
-	Debug                bool
-	AdjustedPurchaseUnit float64
-	Android              bool
-	CurrencyCode         string
-	CurrencyName         string
-	RandomSnooze         bool
-	AppDir               string
-	DataDir              string
-	LogDir               string
-	keyStore             string
-	configFile           string
+	Name                string
+	SupportedAssets     []string
+	ExitOnInitFailed    bool
+	APIKeyID            string
+	APIKeySecret        string
+	PurchaseUnit        float64
+	PurchasePercentage  float64 // Fraction of the fiat balance spent on each purchase. Zero uses `PurchaseUnit`.
+	AssetsToTrade       []string
+	EmailAddress        string
+	ProfitMargin        float64
+	LedgerDatabase      string
+	SnoozeTimes         []int32
+	SnoozePeriod        int32
+	SnapshotInterval    int32  // Minutes between profit snapshots. Zero disables snapshots.
+	WriteStateFile      bool   // Write the bot's state to `StateFile` for observers.
+	StateFile           string // Path of the state file. Defaults to state.json in `DataDir`.
+	StateFileInterval   int32  // Seconds between updates of the state file.
+	StalePositionDays   int32  // Days after which an open position is flagged as stale. Zero disables flagging.
+	StalePositionAlerts bool   // Send an alert for stale positions.
+	AcknowledgedVersion string // Last version whose changelog the user has reviewed.
+	WriteRoundEvents    bool   // Write a JSON line for each asset in each trading round.
+	RoundEventsFile     string // Path of the events file. Defaults to events.jsonl in `DataDir`.
+	RoundEventsAddress  string // Socket the events are sent to instead of the file, e.g. "tcp://127.0.0.1:5170".
+	HealthAddress       string // Address of the /healthz and /readyz endpoints, e.g. "127.0.0.1:8089". Empty disables them.
+	HealthTimeout       int32  // Minutes the trading loop may go without progress before /healthz fails.
+	FairScheduling      bool   // Send the requests of the asset that was served least recently first.
+	RoundCallBudget     int32  // Exchange reads allowed in a round, shared equally between assets. Zero is unlimited.
+	DryRun              bool   // Simulate orders instead of placing them, with live prices and balances.
+	Verbose             bool
+	Debug               bool
+	Android             bool
+	CurrencyCode        string
+	CurrencyName        string
+	RandomSnooze        bool
+	AppDir              string
+	DataDir             string
+	LogDir              string
+	keyStore            string
+	configFile          string
+	restoredFromBackup  bool // The settings file could not be read and the backup was loaded instead.
 	// TradingMode          TradeMode
-	Trade TradeSettings
+	Trade         TradeSettings
+	Notifications NotificationSettings
+	Paper         PaperSettings
+	Inflation     InflationSettings
+	AppLock       AppLockSettings
+	// Webhook is the endpoint alerts from external charting tools are received on.
+	Webhook WebhookSettings
+	// ErrorPause pauses an asset after repeated failed requests to the exchange.
+	ErrorPause ErrorPauseSettings
+	// MarketData is the provider missing candles are backfilled from.
+	MarketData MarketDataSettings
+	// Backup schedules local backups of the ledger and stats.
+	Backup BackupSettings
+	// Storage is the database the ledger is kept in.
+	Storage StorageSettings
 }
 
 // ErrNoSavedSettings is returned by the load settigs function when it can't find any saved settings on file.
@@ -124,13 +237,25 @@ func (c *Configuration) DefaultSettings(appDir string) error {
 		// TODO; EXPORT KEY ID AND SECRET TO ENV VARS FOR SECURITY
 		ExitOnInitFailed: false, APIKeyID: "",
 		APIKeySecret: "", PurchaseUnit: 10000,
-		AssetsToTrade: []string{"XBT", "ETH", "XRP", "LTC"},
-		ProfitMargin:  3 / 100.0,
-		SnoozeTimes:   DefaultSnoozeTimes,
-		RandomSnooze:  true,
-		SnoozePeriod:  5,
-		Verbose:       true,
-		Debug:         false,
+		AssetsToTrade:       []string{"XBT", "ETH", "XRP", "LTC"},
+		ProfitMargin:        3 / 100.0,
+		SnoozeTimes:         DefaultSnoozeTimes,
+		RandomSnooze:        true,
+		SnoozePeriod:        5,
+		SnapshotInterval:    15,
+		StateFileInterval:   30,
+		StalePositionDays:   14,
+		StalePositionAlerts: true,
+		AcknowledgedVersion: Version,
+		HealthTimeout:       15,
+		FairScheduling:      true,
+		ErrorPause:          ErrorPauseSettings{Threshold: 5, Backoff: 5, MaxBackoff: 60},
+		Backup:              DefaultBackup,
+		Paper:               PaperSettings{StartingBalance: DefaultPaperBalance, Rounds: DefaultPaperRounds},
+		Inflation:           InflationSettings{AnnualRate: 0.17},
+		Webhook:             WebhookSettings{Expiry: 15},
+		Verbose:             true,
+		Debug:               false,
 		Trade: TradeSettings{
 			TradingMode: TrendFollowing,
 
@@ -142,6 +267,28 @@ func (c *Configuration) DefaultSettings(appDir string) error {
 
 			Shortsell: false,
 
+			StaleOrderTimeout: 0,
+
+			MaxSpreadRatio:     0.5,
+			PatternSensitivity: DefaultPatternSensitivity,
+			DCA:                DCASettings{Purchases: 4, Window: 240},
+			Pyramid:            PyramidSettings{Rounds: 3, MaxAdds: 2, SizeRatio: 0.5, MaxExposure: 0.5},
+			Sizing:             DefaultSizing,
+			StreakSizing:       StreakSizingSettings{Step: 0.25, MinMultiplier: 0.25, MaxMultiplier: 2},
+			VolatilitySizing:   VolatilitySizingSettings{Period: 14, TargetATR: 0.02, MinMultiplier: 0.5, MaxMultiplier: 1.5},
+			IdleSkip:           IdleSkipSettings{PriceEpsilon: 0.001, VolumeEpsilon: 0.01, MaxSkips: 6},
+			Risk:               RiskSettings{MaxAssetExposure: 0.5, MaxPortfolioExposure: 0.8, MaxDrawdown: 0.2},
+			FlashMove:          FlashMoveSettings{MaxMove: 0.1, CalmRounds: 6},
+			SessionStop:        SessionStopSettings{MaxDrop: 0.15},
+			StrategyKill:       StrategyKillSettings{Window: 20, MinWinRate: 0.4},
+			Ensemble:           EnsembleSettings{Method: EnsembleMajority},
+			Model:              ModelSettings{Window: 20, Threshold: 0.6, Fallback: "hermes"},
+			Timeframes:         TimeframeSettings{Period: 3},
+			ApprovalTimeout:    120,
+			Execution:          ExecutionMarket,
+			ReferencePrice:     ReferencePriceSettings{MaxDeviation: 0.05},
+			PairStatus:         PairStatusSettings{CheckInterval: 60},
+
 			ShortTrade: struct {
 				StopLoss           bool
 				StopLossPercentage float64
@@ -199,6 +346,7 @@ func (c *Configuration) TestConfig(appDir string) error {
 	c.Verbose = true
 	c.Debug = true
 	c.Trade.TradingMode = TrendFollowing
+	c.AcknowledgedVersion = Version
 	c.Trade.AnalysisPlugin = struct {
 		Name string
 	}{Name: "hermes"}
@@ -229,22 +377,101 @@ func (c *Configuration) Save() error {
 			return err
 		}
 	}
-	f, err := os.OpenFile(c.configFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-	defer f.Close()
+	data, err := json.Marshal(c)
 	if err != nil {
+		log.Printf("Json encode error in c.Save() :%v", err)
+		return err
+	}
+	// The settings are written to a temporary file which replaces the settings file once it is
+	// on disk, so a crash during the save can not leave a half-written settings file behind.
+	tmp := c.configFile + ".tmp"
+	if err = writeFileSynced(tmp, append(data, '\n')); err != nil {
 		log.Printf("%v", err)
 		return err
 	}
-	// Create a copy of the `Configuration` object for Saving.
-	conf := c
-	e := json.NewEncoder(f).Encode(conf)
-	if e != nil {
-		log.Printf("Json decode error in c.Save() :%v", e)
+	// Keep the last settings that could be read as a backup.
+	if current, err := ioutil.ReadFile(c.configFile); err == nil && json.Valid(current) {
+		if err = writeFileSynced(c.backupFile(), current); err != nil {
+			log.Printf("Could not back up settings. Reason: %v", err)
+		}
+	}
+	if err = os.Rename(tmp, c.configFile); err != nil {
+		log.Printf("%v", err)
 		return err
 	}
+	syncDir(dir)
 	return nil
 }
 
+// backupFile returns the path of the backup of the settings file.
+func (c *Configuration) backupFile() string {
+	return c.configFile + ".bak"
+}
+
+// RestoredFromBackup reports whether the settings file could not be read when the settings were
+// loaded, and the backup was used instead.
+func (c *Configuration) RestoredFromBackup() bool {
+	return c.restoredFromBackup
+}
+
+// readConfigFile decodes the settings saved at `path`.
+func readConfigFile(path string) (conf *Configuration, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	conf = &Configuration{}
+	if err = json.Unmarshal(data, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// Clone returns a deep copy of the settings that shares no slices or maps with them. The UI and the
+// running bot each keep their own copy, so the settings the user edits never change under the bot.
+func (c *Configuration) Clone() *Configuration {
+	clone := *c
+	clone.SupportedAssets = append([]string(nil), c.SupportedAssets...)
+	clone.AssetsToTrade = append([]string(nil), c.AssetsToTrade...)
+	clone.SnoozeTimes = append([]int32(nil), c.SnoozeTimes...)
+	clone.Trade.TakeProfitLadder = append([]TakeProfitTranche(nil), c.Trade.TakeProfitLadder...)
+	if c.Trade.ExposureCaps != nil {
+		clone.Trade.ExposureCaps = make(map[string]ExposureCap, len(c.Trade.ExposureCaps))
+		for asset, limit := range c.Trade.ExposureCaps {
+			clone.Trade.ExposureCaps[asset] = limit
+		}
+	}
+	if c.Trade.AnalyzerOverrides != nil {
+		clone.Trade.AnalyzerOverrides = make(map[string]AnalyzerOverrides, len(c.Trade.AnalyzerOverrides))
+		for asset, overrides := range c.Trade.AnalyzerOverrides {
+			clone.Trade.AnalyzerOverrides[asset] = overrides
+		}
+	}
+	clone.Trade.Ensemble.Weights = cloneWeights(c.Trade.Ensemble.Weights)
+	if c.Trade.AssetEnsembles != nil {
+		clone.Trade.AssetEnsembles = make(map[string]EnsembleSettings, len(c.Trade.AssetEnsembles))
+		for asset, ensemble := range c.Trade.AssetEnsembles {
+			ensemble.Weights = cloneWeights(ensemble.Weights)
+			clone.Trade.AssetEnsembles[asset] = ensemble
+		}
+	}
+	clone.Notifications.Rules = append([]NotificationRule(nil), c.Notifications.Rules...)
+	clone.Inflation.Index = append([]IndexPoint(nil), c.Inflation.Index...)
+	return &clone
+}
+
+// cloneWeights copies the weights of an ensemble.
+func cloneWeights(weights map[string]float64) map[string]float64 {
+	if weights == nil {
+		return nil
+	}
+	clone := make(map[string]float64, len(weights))
+	for plugin, weight := range weights {
+		clone[plugin] = weight
+	}
+	return clone
+}
+
 // Update the config struct with user defined values and disregard invalid values
 func (c *Configuration) Update(copy *Configuration, isDefault bool) (err error) {
 	if copy.APIKeyID != "" || isDefault {
@@ -256,6 +483,9 @@ func (c *Configuration) Update(copy *Configuration, isDefault bool) (err error)
 	if copy.PurchaseUnit > 0 || isDefault {
 		c.PurchaseUnit = copy.PurchaseUnit
 	}
+	if copy.PurchasePercentage >= 0 && copy.PurchasePercentage <= 1 {
+		c.PurchasePercentage = copy.PurchasePercentage
+	}
 	if copy.ProfitMargin > 0 || isDefault {
 		c.ProfitMargin = copy.ProfitMargin
 	}
@@ -272,12 +502,171 @@ func (c *Configuration) Update(copy *Configuration, isDefault bool) (err error)
 	// }
 
 	c.RandomSnooze, c.SnoozePeriod = copy.RandomSnooze, copy.SnoozePeriod
+	c.SnapshotInterval = copy.SnapshotInterval
+	c.WriteStateFile, c.StateFile, c.StateFileInterval = copy.WriteStateFile, copy.StateFile, copy.StateFileInterval
+	c.StalePositionDays, c.StalePositionAlerts = copy.StalePositionDays, copy.StalePositionAlerts
+	c.AcknowledgedVersion = copy.AcknowledgedVersion
+	c.HealthAddress = copy.HealthAddress
+	c.WriteRoundEvents, c.RoundEventsFile, c.RoundEventsAddress = copy.WriteRoundEvents, copy.RoundEventsFile, copy.RoundEventsAddress
+	if copy.HealthTimeout > 0 {
+		c.HealthTimeout = copy.HealthTimeout
+	}
+	c.FairScheduling = copy.FairScheduling
+	c.DryRun = copy.DryRun
+	if copy.RoundCallBudget >= 0 {
+		c.RoundCallBudget = copy.RoundCallBudget
+	}
+	pause := copy.ErrorPause
+	if pause.Backoff == 0 && pause.MaxBackoff == 0 {
+		// Settings saved before assets could be paused have no backoff.
+		pause.Backoff, pause.MaxBackoff = 5, 60
+	}
+	if pause.Threshold >= 0 && pause.Backoff >= 0 && pause.MaxBackoff >= pause.Backoff {
+		c.ErrorPause = pause
+	}
 	c.RandomSnooze = copy.RandomSnooze
-	c.SupportedAssets = DefaultSupportedAssets
+	c.SupportedAssets = withDefaultAssets(copy.SupportedAssets)
 	c.SnoozeTimes, c.CurrencyName = DefaultSnoozeTimes, DefaultCurrencyName
 	c.CurrencyCode, c.Verbose = DefaultCurrencyCode, copy.Verbose
 	c.keyStore, c.ExitOnInitFailed = copy.keyStore, copy.ExitOnInitFailed
 	c.Trade.TradingMode, c.Trade.AnalysisPlugin = copy.Trade.TradingMode, copy.Trade.AnalysisPlugin
+	c.Trade.TakeProfitLadder = copy.Trade.TakeProfitLadder
+	c.Trade.StaleOrderTimeout, c.Trade.RepriceStaleOrders = copy.Trade.StaleOrderTimeout, copy.Trade.RepriceStaleOrders
+	c.Trade.MaxSpreadRatio, c.Trade.VolumeWeightedPrice = copy.Trade.MaxSpreadRatio, copy.Trade.VolumeWeightedPrice
+	c.Trade.ManualApproval = copy.Trade.ManualApproval
+	switch copy.Trade.Execution {
+	case ExecutionMarket, ExecutionQuote:
+		c.Trade.Execution = copy.Trade.Execution
+	}
+	if copy.Trade.ApprovalTimeout > 0 {
+		c.Trade.ApprovalTimeout = copy.Trade.ApprovalTimeout
+	}
+	if copy.Trade.ShortTrade.StopLossPercentage >= 0 {
+		c.Trade.ShortTrade = copy.Trade.ShortTrade
+	}
+	if copy.Trade.Pyramid.SizeRatio >= 0 && copy.Trade.Pyramid.MaxExposure >= 0 && copy.Trade.Pyramid.MaxExposure <= 1 {
+		c.Trade.Pyramid = copy.Trade.Pyramid
+	}
+	sizer := copy.Trade.Sizing
+	if sizer == (SizingSettings{}) {
+		// Settings saved before the position sizer could be chosen.
+		sizer = DefaultSizing
+	}
+	if sizer.EquityFraction >= 0 && sizer.EquityFraction <= 1 && sizer.KellyFraction >= 0 && sizer.KellyFraction <= 1 &&
+		sizer.KellyMaxFraction >= 0 && sizer.KellyMaxFraction <= 1 && sizer.KellyMinTrades >= 0 {
+		c.Trade.Sizing = sizer
+	}
+	sizing := copy.Trade.StreakSizing
+	if sizing.Step >= 0 && sizing.MinMultiplier > 0 && sizing.MinMultiplier <= 1 && sizing.MaxMultiplier >= 1 {
+		c.Trade.StreakSizing = sizing
+	}
+	if copy.Trade.DailyLoss.Limit >= 0 {
+		c.Trade.DailyLoss = copy.Trade.DailyLoss
+	}
+	if copy.Trade.SessionStop.MaxDrop >= 0 && copy.Trade.SessionStop.MaxDrop < 1 {
+		c.Trade.SessionStop = copy.Trade.SessionStop
+	}
+	kill := copy.Trade.StrategyKill
+	if kill.Window >= 0 && kill.MinWinRate >= 0 && kill.MinWinRate <= 1 {
+		c.Trade.StrategyKill = kill
+	}
+	if copy.Trade.FlashMove.MaxMove > 0 && copy.Trade.FlashMove.CalmRounds >= 0 {
+		c.Trade.FlashMove = copy.Trade.FlashMove
+	}
+	volatility := copy.Trade.VolatilitySizing
+	if volatility.Period > 0 && volatility.TargetATR > 0 && volatility.MinMultiplier > 0 && volatility.MinMultiplier <= 1 && volatility.MaxMultiplier >= 1 {
+		c.Trade.VolatilitySizing = volatility
+	}
+	idle := copy.Trade.IdleSkip
+	if idle.PriceEpsilon >= 0 && idle.PriceEpsilon < 1 && idle.VolumeEpsilon >= 0 && idle.MaxSkips >= 0 {
+		c.Trade.IdleSkip = idle
+	}
+	risk := copy.Trade.Risk
+	if risk.MaxAssetExposure >= 0 && risk.MaxAssetExposure <= 1 && risk.MaxPortfolioExposure >= 0 &&
+		risk.MaxPortfolioExposure <= 1 && risk.MaxDrawdown >= 0 && risk.MaxDrawdown < 1 {
+		c.Trade.Risk = risk
+	}
+	if copy.Trade.ReferencePrice.MaxDeviation >= 0 && copy.Trade.ReferencePrice.MaxDeviation <= 1 {
+		c.Trade.ReferencePrice = copy.Trade.ReferencePrice
+	}
+	if copy.Trade.PairStatus.CheckInterval >= 0 {
+		c.Trade.PairStatus = copy.Trade.PairStatus
+	}
+	if copy.Trade.DCA.Purchases >= 0 && copy.Trade.DCA.Window >= 0 {
+		c.Trade.DCA = copy.Trade.DCA
+	}
+	if copy.Trade.PatternSensitivity.Validate() == nil {
+		c.Trade.PatternSensitivity = copy.Trade.PatternSensitivity.WithDefaults()
+	}
+	if period, interval := copy.Trade.AnalysisPeriod, copy.Trade.AnalysisInterval; period >= 0 && interval >= 0 &&
+		(period == 0 || int64(interval) <= int64(period)*60) {
+		c.Trade.AnalysisPeriod, c.Trade.AnalysisInterval = period, interval
+	}
+	overrides := map[string]AnalyzerOverrides{}
+	for asset, o := range copy.Trade.AnalyzerOverrides {
+		if o.Validate() == nil && !o.IsZero() {
+			overrides[asset] = o
+		}
+	}
+	c.Trade.AnalyzerOverrides = overrides
+	if copy.Trade.Ensemble.Validate() == nil {
+		c.Trade.Ensemble = copy.Trade.Ensemble
+	} else if c.Trade.Ensemble.Method == "" {
+		c.Trade.Ensemble = EnsembleSettings{Method: EnsembleMajority}
+	}
+	ensembles := map[string]EnsembleSettings{}
+	for asset, settings := range copy.Trade.AssetEnsembles {
+		if settings.Validate() == nil {
+			ensembles[asset] = settings
+		}
+	}
+	c.Trade.AssetEnsembles = ensembles
+	if copy.Trade.Model.Validate() == nil {
+		c.Trade.Model = copy.Trade.Model
+	} else if c.Trade.Model.Window == 0 {
+		c.Trade.Model = ModelSettings{Window: 20, Threshold: 0.6, Fallback: "hermes"}
+	}
+	if copy.Trade.Timeframes.Validate() == nil {
+		c.Trade.Timeframes = copy.Trade.Timeframes
+	}
+	if copy.Trade.Confidence.Validate() == nil {
+		c.Trade.Confidence = copy.Trade.Confidence
+	}
+	caps := map[string]ExposureCap{}
+	for asset, limit := range copy.Trade.ExposureCaps {
+		if limit.Validate() == nil && !limit.IsZero() {
+			caps[asset] = limit
+		}
+	}
+	c.Trade.ExposureCaps = caps
+	if copy.Trade.MaxOpenPositions >= 0 {
+		c.Trade.MaxOpenPositions = copy.Trade.MaxOpenPositions
+	}
+	c.Notifications = copy.Notifications
+	c.Paper = copy.Paper
+	if !copy.AppLock.Enabled || copy.AppLock.HasPIN() {
+		c.AppLock = copy.AppLock
+	}
+	if copy.Webhook.Validate() == nil {
+		c.Webhook = copy.Webhook
+	}
+	backup := copy.Backup
+	if backup == (BackupSettings{}) {
+		// Settings saved before the ledger was backed up.
+		backup = DefaultBackup
+	}
+	if backup.Interval > 0 && backup.Keep >= 0 {
+		c.Backup = backup
+	}
+	if copy.MarketData.Validate() == nil {
+		c.MarketData = copy.MarketData
+	}
+	if copy.Storage.Validate() == nil {
+		c.Storage = copy.Storage
+	}
+	if copy.Inflation.AnnualRate >= 0 {
+		c.Inflation = copy.Inflation
+	}
 	if copy.AppDir != "" && !isDefault {
 		c.SetAppDir(filepath.Dir(copy.AppDir))
 	}
@@ -289,26 +678,37 @@ func (c *Configuration) LoadConfig(appDir string) (err error) {
 	if c.AppDir == "" && appDir != "" {
 		c.SetAppDir(appDir)
 	}
-	if !exists(c.configFile) {
+	if !exists(c.configFile) && !exists(c.backupFile()) {
 		// No settings were saved. usually happens the first time the app is run in a new location
 		return ErrNoSavedSettings
 	}
-	f, err := os.OpenFile(c.configFile, os.O_RDWR, 0644)
-	gonfig.GetConf(c.configFile, &c)
-	defer f.Close()
-	if err != nil {
-		return err
+	path := c.configFile
+	conf, err := readConfigFile(path)
+	if err != nil && exists(c.backupFile()) {
+		// The settings file is missing or damaged, e.g. by a crash while it was saved.
+		log.Printf("Could not load settings from %s. Reason: %v. Loading the backup.", path, err)
+		if conf, err = readConfigFile(c.backupFile()); err == nil {
+			path, c.restoredFromBackup = c.backupFile(), true
+		}
 	}
-	// Load filenames into `files`
-	conf := &Configuration{}
-	err = json.NewDecoder(f).Decode(&conf)
 	if err != nil {
 		return err
 	}
+	gonfig.GetConf(path, &c)
 	err = c.Update(conf, false)
 	if err != nil {
 		return err
 	}
+	if c.AcknowledgedVersion == "" {
+		// The settings were saved before versions were acknowledged, so every later change is unread.
+		c.AcknowledgedVersion = oldestVersion()
+	}
+	if c.restoredFromBackup {
+		// Replace the damaged settings file.
+		if err = c.Save(); err != nil {
+			log.Printf("Could not repair the settings file. Reason: %v", err)
+		}
+	}
 	return nil
 
 }
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestClone changes every slice and map of a copy of the settings and checks the original is unchanged.
+func TestClone(t *testing.T) {
+	c := &Configuration{
+		SupportedAssets: []string{"XBT", "ETH"},
+		AssetsToTrade:   []string{"XBT"},
+		SnoozeTimes:     []int32{5, 10},
+	}
+	c.Trade.TakeProfitLadder = []TakeProfitTranche{{Percentage: 0.5, Margin: 0.02}}
+	c.Trade.ExposureCaps = map[string]ExposureCap{"XBT": {}}
+	c.Trade.AnalyzerOverrides = map[string]AnalyzerOverrides{"XBT": {}}
+	c.Trade.Ensemble.Weights = map[string]float64{"hermes": 1}
+	c.Trade.AssetEnsembles = map[string]EnsembleSettings{"XBT": {Weights: map[string]float64{"hermes": 1}}}
+	c.Notifications.Rules = []NotificationRule{{}}
+	c.Inflation.Index = []IndexPoint{{}}
+	want := c.Clone()
+	if !reflect.DeepEqual(want, c) {
+		t.Fatalf("Clone() = %+v, want %+v", want, c)
+	}
+
+	clone := c.Clone()
+	clone.SupportedAssets[0] = "LTC"
+	clone.AssetsToTrade[0] = "LTC"
+	clone.SnoozeTimes[0] = 1
+	clone.Trade.TakeProfitLadder[0].Margin = 0.1
+	clone.Trade.ExposureCaps["ETH"] = ExposureCap{}
+	clone.Trade.AnalyzerOverrides["ETH"] = AnalyzerOverrides{}
+	clone.Trade.Ensemble.Weights["hermes"] = 2
+	clone.Trade.AssetEnsembles["XBT"].Weights["hermes"] = 2
+	clone.Notifications.Rules = append(clone.Notifications.Rules[:0], NotificationRule{Channel: "email"})
+	clone.Inflation.Index[0].Value = 1
+	if !reflect.DeepEqual(want, c) {
+		t.Errorf("changing the copy changed the settings to %+v, want %+v", c, want)
+	}
+}
+
+// TestLoadConfigPendingChangelog loads settings saved by a release before 0.2.0, which did not record an
+// acknowledged version, and checks the trading changes since then must be reviewed.
+func TestLoadConfigPendingChangelog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leprechaun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := &Configuration{}
+	saved.SetAppDir(dir)
+	if err = saved.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c := &Configuration{}
+	if err = c.LoadConfig(dir); err != nil {
+		t.Fatal(err)
+	}
+	if c.AcknowledgedVersion != "0.1.0" {
+		t.Errorf("the acknowledged version is %q, want %q", c.AcknowledgedVersion, "0.1.0")
+	}
+	if !c.ChangelogPending() {
+		t.Error("settings saved before 0.2.0 have no pending changelog")
+	}
+	if err = c.AcknowledgeChangelog(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ChangelogPending() {
+		t.Error("the changelog is still pending after it was acknowledged")
+	}
+}
@@ -0,0 +1,214 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `dca.go` implements the dollar-cost-averaging entry mode. Instead of buying a whole position
+*  at once, the purchase is split into smaller purchases spread over a window of time. The purchases
+*  are held in the ledger as a single position with a blended entry price.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrDCAPlanActive is returned when a new DCA plan is started for an asset that still has one running.
+var ErrDCAPlanActive = errors.New("a DCA plan is already running for this asset")
+
+// DCASettings configures the dollar-cost-averaging entry mode.
+type DCASettings struct {
+	Enabled   bool
+	Purchases int32 // Number of purchases each position is split into.
+	Window    int32 // Minutes over which the purchases are spread.
+}
+
+// DCAPlan is a position being built by a series of purchases.
+type DCAPlan struct {
+	Asset       string
+	TotalVolume float64       // Volume of the whole position.
+	Purchases   int           // Number of purchases in the plan.
+	Done        int           // Number of purchases made so far.
+	Interval    time.Duration // Time between purchases.
+	NextAt      time.Time     // Time of the next purchase.
+	RecordID    string        // ID of the aggregate record in the ledger.
+	Started     time.Time
+}
+
+var (
+	dcaFile = "dca.json"
+	dcaMu   sync.Mutex
+)
+
+// sliceVolume returns the volume of each purchase in the plan.
+func (plan DCAPlan) sliceVolume() float64 {
+	volume := plan.TotalVolume / float64(plan.Purchases)
+	if plan.Asset == "XRP" {
+		// Ripple coin can only be traded in whole units.
+		volume = math.Floor(volume)
+	}
+	return volume
+}
+
+func loadDCAPlans() (plans map[string]DCAPlan) {
+	plans = map[string]DCAPlan{}
+	data, err := ioutil.ReadFile(filepath.Join(dataDir(), dcaFile))
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &plans)
+	return
+}
+
+func saveDCAPlans(plans map[string]DCAPlan) error {
+	if err := os.MkdirAll(dataDir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(plans)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dataDir(), dcaFile), data, 0644)
+}
+
+// DCAPlanFor returns the running DCA plan of an asset, if any.
+func DCAPlanFor(asset string) (plan DCAPlan, ok bool) {
+	dcaMu.Lock()
+	defer dcaMu.Unlock()
+	plan, ok = loadDCAPlans()[asset]
+	return
+}
+
+// cancelDCA stops the running DCA plan of an asset, if any. The purchases already made remain in the ledger.
+func cancelDCA(asset string) (cancelled bool) {
+	dcaMu.Lock()
+	defer dcaMu.Unlock()
+	plans := loadDCAPlans()
+	if _, ok := plans[asset]; !ok {
+		return false
+	}
+	delete(plans, asset)
+	if err := saveDCAPlans(plans); err != nil {
+		debugf("Could not cancel the DCA plan for %s. Reason: %v", asset, err)
+		return false
+	}
+	return true
+}
+
+// StartDCA starts a plan to buy `volume` of the client's asset in `config.Trade.DCA.Purchases` purchases
+// over `config.Trade.DCA.Window` minutes. The first purchase is made at once.
+func (bot *Bot) StartDCA(cl *Client, volume float64) (rec Record, err error) {
+	dcaMu.Lock()
+	plans := loadDCAPlans()
+	if _, ok := plans[cl.asset]; ok {
+		dcaMu.Unlock()
+		return rec, ErrDCAPlanActive
+	}
+	purchases := int(cfg().Trade.DCA.Purchases)
+	if purchases < 1 {
+		purchases = 1
+	}
+	// Every purchase must be at least the minimum volume the exchange trades.
+	if min := GetPairInfo(cl.Pair).MinVolume; min > 0 {
+		if most := int(volume / min); most < purchases {
+			purchases = int(math.Max(1, float64(most)))
+		}
+	}
+	window := time.Duration(cfg().Trade.DCA.Window) * time.Minute
+	plan := DCAPlan{Asset: cl.asset, TotalVolume: volume, Purchases: purchases, Started: time.Now()}
+	plan.Interval = window / time.Duration(purchases)
+	plans[cl.asset] = plan
+	err = saveDCAPlans(plans)
+	dcaMu.Unlock()
+	if err != nil {
+		return
+	}
+	debugf("Leprechaun will buy %.6f %s in %d purchases over %v.", volume, cl.asset, purchases, window)
+	return bot.continueDCA(cl)
+}
+
+// ContinueDCA makes the next purchase of the client's DCA plan if it is due.
+// It returns the updated aggregate record if a purchase was made.
+func (bot *Bot) ContinueDCA(cl *Client) (rec Record, err error) {
+	plan, ok := DCAPlanFor(cl.asset)
+	if !ok || time.Now().Before(plan.NextAt) {
+		return
+	}
+	return bot.continueDCA(cl)
+}
+
+func (bot *Bot) continueDCA(cl *Client) (rec Record, err error) {
+	dcaMu.Lock()
+	defer dcaMu.Unlock()
+	plans := loadDCAPlans()
+	plan, ok := plans[cl.asset]
+	if !ok {
+		return
+	}
+	volume := plan.sliceVolume()
+	if plan.Done == plan.Purchases-1 {
+		// The last purchase picks up whatever was lost to rounding.
+		volume = plan.TotalVolume - volume*float64(plan.Done)
+	}
+	if bot.checkRisk(cl, SignalLong, volume, 0) != nil {
+		// The purchase is tried again next round.
+		return
+	}
+	purchase, err := cl.GoLong(volume)
+	if err != nil {
+		debugf("DCA purchase %d of %d for %s failed. Will try again next round. Reason: %v", plan.Done+1, plan.Purchases, cl.name, err)
+		return
+	}
+	if updated, e := cl.UpdateOrderDetails(purchase); e == nil {
+		purchase = updated
+	}
+	rec, err = bot.mergeDCAPurchase(plan, purchase)
+	if err != nil {
+		return
+	}
+	confirmIntent(purchase.ClientRef)
+	plan.RecordID = rec.ID
+	plan.Done++
+	plan.NextAt = time.Now().Add(plan.Interval)
+	if plan.Done < plan.Purchases {
+		plans[cl.asset] = plan
+		err = saveDCAPlans(plans)
+		return
+	}
+	delete(plans, cl.asset)
+	if err = saveDCAPlans(plans); err != nil {
+		return
+	}
+	notify(EventInfo, cl.asset, "DCA plan complete. Bought %.6f %s in %d purchases at a blended price of %s %s.",
+		rec.Volume, rec.Asset, plan.Purchases, cl.currency, GetPairInfo(cl.Pair).FormatPrice(rec.Price))
+	return
+}
+
+// mergeDCAPurchase adds a purchase to the plan's aggregate record and recomputes its blended entry price.
+// If the aggregate record has already been closed, the purchase starts a new one.
+func (bot *Bot) mergeDCAPurchase(plan DCAPlan, purchase Record) (rec Record, err error) {
+	journalOpen(purchase)
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	if plan.RecordID != "" {
+		rec, err = ledger.GetRecordByID(plan.RecordID)
+	}
+	if plan.RecordID == "" || err != nil {
+		return purchase, ledger.AddRecord(purchase)
+	}
+	info := AssetPairInfo(rec.Asset)
+	rec.Volume += purchase.Volume
+	rec.RequestedVolume += purchase.RequestedVolume
+	rec.Cost += purchase.Cost
+	rec.LunoAssetFee += purchase.LunoAssetFee
+	rec.LunoFiatFee += purchase.LunoFiatFee
+	rec.Price = info.RoundPrice(rec.Cost / rec.Volume)
+	rec.TriggerPrice = info.TriggerPrice(rec.Price, cfg().ProfitMargin, rec.Type)
+	err = ledger.UpdatePosition(rec)
+	return
+}
@@ -0,0 +1,98 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `depth.go` measures the depth of the order book near the current price. Large resting bids below the
+*  price tend to support it and large resting asks above it tend to cap it, so the imbalance between the
+*  volume bid and the volume asked is passed to analysis plugins that want it as another indicator.
+ */
+
+import (
+	luno "github.com/luno/luno-go"
+)
+
+// DepthBand is how far from the middle of the spread, as a fraction of the price, resting orders are counted.
+const DepthBand = 0.01
+
+// OrderBookDepth holds the volume of the resting orders near the current price.
+type OrderBookDepth struct {
+	// Mid is the price halfway between the best bid and the best ask.
+	Mid float64
+	// Band is the fraction of `Mid` within which orders were counted.
+	Band float64
+	// BidVolume is the volume of the bids priced within `Band` below `Mid`.
+	BidVolume float64
+	// AskVolume is the volume of the asks priced within `Band` above `Mid`.
+	AskVolume float64
+}
+
+// Imbalance returns the difference between the bid and ask volumes as a fraction of their sum, from -1
+// (only asks) to 1 (only bids). It is zero when there are no orders near the price.
+func (d OrderBookDepth) Imbalance() float64 {
+	total := d.BidVolume + d.AskVolume
+	if total <= 0 {
+		return 0
+	}
+	return (d.BidVolume - d.AskVolume) / total
+}
+
+// DepthAnalyzer is implemented by analysis plugins that use the depth of the order book.
+type DepthAnalyzer interface {
+	Analyzer
+	// SetOrderBookDepth passes the depth of the order book near the current price to the plugin.
+	SetOrderBookDepth(OrderBookDepth) error
+}
+
+// depthNear sums the volume of the orders in `book` priced within `band` of the middle of the spread.
+func depthNear(book *luno.GetOrderBookResponse, band float64) (depth OrderBookDepth, err error) {
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return depth, ErrOrderBookTooThin
+	}
+	depth.Band = band
+	depth.Mid = (book.Bids[0].Price.Float64() + book.Asks[0].Price.Float64()) / 2
+	for _, bid := range book.Bids {
+		if bid.Price.Float64() < depth.Mid*(1-band) {
+			break
+		}
+		depth.BidVolume += bid.Volume.Float64()
+	}
+	for _, ask := range book.Asks {
+		if ask.Price.Float64() > depth.Mid*(1+band) {
+			break
+		}
+		depth.AskVolume += ask.Volume.Float64()
+	}
+	return
+}
+
+// OrderBookDepth retrieves the order book and returns the volume of the orders within `band` of the current price.
+func (cl *Client) OrderBookDepth(band float64) (depth OrderBookDepth, err error) {
+	sleep() // Error 429 safety
+	req := luno.GetOrderBookRequest{Pair: cl.Pair}
+	book, err := cl.GetOrderBook(ctx, &req)
+	if err != nil {
+		return
+	}
+	return depthNear(book, band)
+}
+
+// depthFor retrieves the depth of the order book if `plugin` uses it. It returns nil if the plugin does
+// not use it or it could not be retrieved.
+func depthFor(cl *Client, plugin Analyzer) *OrderBookDepth {
+	if _, ok := plugin.(DepthAnalyzer); !ok {
+		return nil
+	}
+	depth, err := cl.OrderBookDepth(DepthBand)
+	if err != nil {
+		debugf("The depth of the %s order book could not be retrieved. Reason: %v", cl.Pair, err)
+		return nil
+	}
+	return &depth
+}
+
+// passDepth passes `depth`, retrieved by `depthFor`, to `plugin`.
+func passDepth(plugin Analyzer, depth *OrderBookDepth) {
+	if deep, ok := plugin.(DepthAnalyzer); ok && depth != nil {
+		deep.SetOrderBookDepth(*depth)
+	}
+}
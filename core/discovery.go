@@ -0,0 +1,224 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `discovery.go` loads analysis plugins from the plugins folder in the data directory at startup, so
+*  plugins do not have to be compiled into Leprechaun. The folder may hold:
+*
+*  - Go plugins (.so files) built with `go build -buildmode=plugin` against the same version of
+*    Leprechaun. Each exports `Plugin`, a `core.Analyzer`, and optionally `Info`, a `core.PluginInfo`.
+*    Go plugins are only supported on Linux and macOS.
+*  - Strategies declared in JSON (.json files), which run a registered plugin with options of their
+*    own, e.g. Hermes with a shorter moving average:
+*
+*        {"Name": "hermes-fast", "Version": "1.0", "Description": "Hermes on 10 candles.",
+*         "Base": "hermes", "Options": {"MovingAverageWindow": 10}}
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	goplugin "plugin"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidPluginFile is returned when a file in the plugins folder can not be loaded as a plugin.
+var ErrInvalidPluginFile = errors.New("invalid plugin file")
+
+// PluginInfo describes a plugin loaded from the plugins folder.
+type PluginInfo struct {
+	Name        string
+	Version     string
+	Description string
+	// File is the path of the file the plugin was loaded from.
+	File string
+}
+
+// StrategyManifest declares a strategy that runs a registered plugin with options of its own.
+type StrategyManifest struct {
+	PluginInfo
+	// Base is the name of the registered plugin the strategy runs.
+	Base string
+	// Options replaces the default options of the base plugin. The trading mode is chosen by the user,
+	// so `Options.Mode` and `Options.Plugin` must be empty.
+	Options AnalyzerOverrides
+}
+
+// PluginDir returns the folder plugins are loaded from.
+func (c *Configuration) PluginDir() string {
+	return filepath.Join(c.DataDir, "plugins")
+}
+
+// Discover loads the plugins in `dir` and registers them. Files that can not be loaded, or whose
+// plugin has the name of a registered plugin, are skipped and an error is returned for each.
+// Strategies are loaded after Go plugins, so they may be based on them.
+func (Plg *AnalysisPlugins) Discover(dir string) (errs []error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		// There is no plugins folder.
+		return nil
+	}
+	var libraries, manifests []string
+	for _, file := range files {
+		switch strings.ToLower(filepath.Ext(file.Name())) {
+		case ".so":
+			libraries = append(libraries, filepath.Join(dir, file.Name()))
+		case ".json":
+			manifests = append(manifests, filepath.Join(dir, file.Name()))
+		}
+	}
+	for _, path := range libraries {
+		if err := Plg.register(loadGoPlugin(path)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, path := range manifests {
+		if err := Plg.register(Plg.loadStrategy(path)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+// Discovered returns the plugins loaded from the plugins folder, ordered by name.
+func (Plg *AnalysisPlugins) Discovered() []PluginInfo {
+	discovered := append([]PluginInfo{}, Plg.discovered...)
+	sort.Slice(discovered, func(i, j int) bool { return discovered[i].Name < discovered[j].Name })
+	return discovered
+}
+
+// register registers a plugin loaded from the plugins folder, unless loading it failed or its name is taken.
+func (Plg *AnalysisPlugins) register(analyzer Analyzer, info PluginInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	info.Name = strings.ToLower(info.Name)
+	if _, taken := Plg.plugins[info.Name]; taken {
+		return fmt.Errorf("%w (%s: a plugin named %q is already registered)", ErrInvalidPluginFile, info.File, info.Name)
+	}
+	Plg.Register(info.Name, analyzer)
+	Plg.discovered = append(Plg.discovered, info)
+	return nil
+}
+
+// loadGoPlugin opens the Go plugin at `path` and returns its analyzer and description.
+func loadGoPlugin(path string) (Analyzer, PluginInfo, error) {
+	info := PluginInfo{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), File: path}
+	library, err := goplugin.Open(path)
+	if err != nil {
+		return nil, info, fmt.Errorf("%w (%s: %v)", ErrInvalidPluginFile, path, err)
+	}
+	symbol, err := library.Lookup("Plugin")
+	if err != nil {
+		return nil, info, fmt.Errorf("%w (%s: %v)", ErrInvalidPluginFile, path, err)
+	}
+	analyzer, ok := symbol.(*Analyzer)
+	if !ok || *analyzer == nil {
+		return nil, info, fmt.Errorf("%w (%s: Plugin is not a core.Analyzer)", ErrInvalidPluginFile, path)
+	}
+	if symbol, err := library.Lookup("Info"); err == nil {
+		if exported, ok := symbol.(*PluginInfo); ok {
+			if exported.Name != "" {
+				info.Name = exported.Name
+			}
+			info.Version, info.Description = exported.Version, exported.Description
+		}
+	}
+	if info.Description == "" {
+		info.Description = (*analyzer).Description()
+	}
+	return *analyzer, info, nil
+}
+
+// loadStrategy reads the strategy declared at `path` and returns a plugin that runs it.
+func (Plg *AnalysisPlugins) loadStrategy(path string) (Analyzer, PluginInfo, error) {
+	var manifest StrategyManifest
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &manifest)
+	}
+	manifest.File = path
+	if err != nil {
+		return nil, manifest.PluginInfo, fmt.Errorf("%w (%s: %v)", ErrInvalidPluginFile, path, err)
+	}
+	if manifest.Name == "" {
+		manifest.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	base, ok := Plg.plugins[strings.ToLower(manifest.Base)]
+	if !ok {
+		return nil, manifest.PluginInfo, fmt.Errorf("%w (%s: there is no %q plugin to base the strategy on)",
+			ErrInvalidPluginFile, path, manifest.Base)
+	}
+	if manifest.Options.Mode != "" || manifest.Options.Plugin != "" || manifest.Options.Validate() != nil {
+		return nil, manifest.PluginInfo, fmt.Errorf("%w (%s: invalid options)", ErrInvalidPluginFile, path)
+	}
+	if manifest.Description == "" {
+		manifest.Description = base.Description()
+	}
+	return &declaredStrategy{base: base, options: manifest.Options, description: manifest.Description},
+		manifest.PluginInfo, nil
+}
+
+// declaredStrategy runs a registered plugin with the options declared in a strategy file.
+type declaredStrategy struct {
+	base        Analyzer
+	options     AnalyzerOverrides
+	description string
+}
+
+// Description ...
+func (strategy *declaredStrategy) Description() string {
+	return strategy.description
+}
+
+// DefaultOptions returns the default options of the base plugin, replaced by the declared options.
+func (strategy *declaredStrategy) DefaultOptions() AnalysisOptions {
+	var opts AnalysisOptions
+	if provider, ok := strategy.base.(OptionsProvider); ok {
+		opts = provider.DefaultOptions()
+	}
+	opts.merge(strategy.options.options())
+	return opts
+}
+
+// SetOptions ...
+func (strategy *declaredStrategy) SetOptions(opts *AnalysisOptions) error {
+	return strategy.base.SetOptions(opts)
+}
+
+// SetClosingPrices ...
+func (strategy *declaredStrategy) SetClosingPrices(prices []float64) error {
+	return strategy.base.SetClosingPrices(prices)
+}
+
+// SetCurrentPrice ...
+func (strategy *declaredStrategy) SetCurrentPrice(price float64) error {
+	return strategy.base.SetCurrentPrice(price)
+}
+
+// SetOHLC ...
+func (strategy *declaredStrategy) SetOHLC(candles []OHLC) error {
+	return strategy.base.SetOHLC(candles)
+}
+
+// SetOrderBookDepth passes the depth of the order book to the base plugin if it uses it.
+func (strategy *declaredStrategy) SetOrderBookDepth(depth OrderBookDepth) error {
+	if deep, ok := strategy.base.(DepthAnalyzer); ok {
+		return deep.SetOrderBookDepth(depth)
+	}
+	return nil
+}
+
+// Emit ...
+func (strategy *declaredStrategy) Emit() (SIGNAL, error) {
+	return strategy.base.Emit()
+}
+
+// EmitConfidence returns the signal of the base plugin and its confidence in it.
+func (strategy *declaredStrategy) EmitConfidence() (SIGNAL, float64, error) {
+	return emitConfidence(strategy.base)
+}
@@ -0,0 +1,62 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `dryrun.go` simulates the orders of the live bot. In a dry run the bot trades as usual, against live
+*  prices and with the user's own account, but market orders are filled by a simulator at the price
+*  they were priced at instead of being placed on the exchange. The positions they open are marked as
+*  simulated in the ledger, and their profits are kept in stats of their own, so they never mix with
+*  real positions and stats. Unlike paper trading, the balances are the real ones.
+ */
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	luno "github.com/luno/luno-go"
+)
+
+// dryRunPrefix starts the IDs of simulated orders.
+const dryRunPrefix = "DRYRUN"
+
+// dryRun reports whether orders are simulated. Paper trading simulates the whole account already.
+func dryRun() bool {
+	return cfg() != nil && cfg().DryRun && !cfg().Paper.Enabled
+}
+
+// simulatedOrder reports whether `orderID` is the ID of an order filled by the dry run simulator.
+func simulatedOrder(orderID string) bool {
+	return strings.HasPrefix(orderID, dryRunPrefix)
+}
+
+// simulateOrder fills a market order for `volume` of the client's asset at `price` without placing it on
+// the exchange, and returns its ID. Simulated orders can not be reconciled, so their intents are dropped.
+func (cl *Client) simulateOrder(ref string, side luno.OrderType, price, volume float64) (orderID string) {
+	orderID = fmt.Sprintf("%s%d", dryRunPrefix, time.Now().UnixNano())
+	confirmIntent(ref)
+	kind := "Bid"
+	if side == luno.OrderTypeSell {
+		kind = "Ask"
+	}
+	notify(EventTrade, cl.asset, "%s order for %.4f %s was simulated at %.2f. Dry run is on, so nothing was sent to the exchange.",
+		kind, volume, cl.asset, price)
+	return orderID
+}
+
+// forMode drops the records that were not opened in the current mode: real records in a dry run and
+// simulated records otherwise.
+func forMode(records []Record) []Record {
+	kept := records[:0]
+	for _, rec := range records {
+		if rec.Simulated == dryRun() {
+			kept = append(kept, rec)
+		}
+	}
+	return kept
+}
+
+// GetSimulatedSales returns the positions closed in dry runs, like `GetSales` does for real ones.
+func GetSimulatedSales() ([]*ProfitEntry, error) {
+	return profitEntries(profitSale, true)
+}
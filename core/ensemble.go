@@ -0,0 +1,238 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `ensemble.go` holds the "ensemble" analysis plugin. It runs the other registered plugins on the same
+*  price data and lets them vote on the signal, either one vote each or weighted votes, so the user is
+*  not locked into a single strategy. The vote can be set up differently for each asset.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EnsemblePlugin is the name the ensemble analysis plugin is registered under.
+const EnsemblePlugin = "ensemble"
+
+// Methods the ensemble plugin combines the signals of its members with.
+const (
+	// EnsembleMajority follows the signal emitted by more than half of the members that could analyze the asset.
+	EnsembleMajority = "majority"
+	// EnsembleWeighted follows the signal whose members hold more than half of the weight of the members
+	// that could analyze the asset. The weight of each vote is scaled by the member's confidence in it.
+	EnsembleWeighted = "weighted"
+)
+
+var (
+	// ErrInvalidEnsemble is returned when the ensemble settings are out of range.
+	ErrInvalidEnsemble = errors.New("invalid ensemble settings")
+	// ErrNoEnsembleVotes is returned when none of the ensemble's members could analyze an asset.
+	ErrNoEnsembleVotes = errors.New("none of the ensemble's plugins could analyze the asset")
+)
+
+// EnsembleSettings configures how the ensemble plugin combines the signals of other plugins.
+type EnsembleSettings struct {
+	// Method is `EnsembleMajority` or `EnsembleWeighted`.
+	Method string
+	// Weights holds the weight of each member's vote, keyed by plugin name. Only the plugins listed vote.
+	// If it is empty every other registered plugin, except the webhook and model plugins, votes with a weight of one.
+	Weights map[string]float64
+}
+
+// Validate returns `ErrInvalidEnsemble` if the method is unknown, a weight is negative or the ensemble votes on itself.
+func (s EnsembleSettings) Validate() error {
+	switch s.Method {
+	case EnsembleMajority, EnsembleWeighted:
+	default:
+		return fmt.Errorf("%w (unknown method %q)", ErrInvalidEnsemble, s.Method)
+	}
+	for name, weight := range s.Weights {
+		if weight < 0 || name == "" || strings.ToLower(name) == EnsemblePlugin {
+			return fmt.Errorf("%w (%q may not vote with a weight of %v)", ErrInvalidEnsemble, name, weight)
+		}
+	}
+	return nil
+}
+
+// ensembleSettings returns the ensemble settings of `asset`.
+func ensembleSettings(asset string) EnsembleSettings {
+	if settings, ok := cfg().Trade.AssetEnsembles[asset]; ok {
+		return settings
+	}
+	return cfg().Trade.Ensemble
+}
+
+// ensembleMember is a plugin that votes in the ensemble.
+type ensembleMember struct {
+	name   string
+	plugin Analyzer
+	weight float64
+}
+
+// members returns the plugins that vote, ordered by name. Plugins that are not registered are left out.
+func (s EnsembleSettings) members() (members []ensembleMember) {
+	if len(s.Weights) == 0 {
+		for name, plugin := range PluginHandler.plugins {
+			// The webhook plugin waits unless an alert has arrived and the model plugin may fall back on
+			// another member, so they only vote when they are listed.
+			if name != EnsemblePlugin && name != WebhookPlugin && name != ModelPlugin {
+				members = append(members, ensembleMember{name: name, plugin: plugin, weight: 1})
+			}
+		}
+	}
+	for name, weight := range s.Weights {
+		name = strings.ToLower(name)
+		plugin, ok := PluginHandler.plugins[name]
+		if !ok || name == EnsemblePlugin {
+			debugf("The %s plugin is not registered. It can not vote in the ensemble.", name)
+			continue
+		}
+		if s.Method == EnsembleMajority {
+			weight = 1
+		}
+		members = append(members, ensembleMember{name: name, plugin: plugin, weight: weight})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].name < members[j].name })
+	return
+}
+
+// Ensemble is an analysis plugin that combines the signals of other plugins. Each member is passed the
+// same price data and options, and emits its own signal. Members that fail to analyze the asset, e.g.
+// because they need more candles than the analysis period holds, do not vote. The signal the members
+// agree on is emitted. If they do not agree the ensemble waits.
+type Ensemble struct {
+	options      *AnalysisOptions
+	prices       []float64
+	candles      []OHLC
+	currentPrice float64
+	depth        *OrderBookDepth
+	ballot       []string // Signal of each member that voted in the last vote.
+}
+
+// Description gives a brief summary of what the plugin does and how.
+func (plugin *Ensemble) Description() string {
+	return `"Ensemble runs the other analysis plugins on the same prices and lets them vote on the signal, one vote each
+	or with a weight for each plugin. It only trades when the plugins agree. The plugins and the voting method can be
+	set for each asset."`
+}
+
+// SetOptions ...
+func (plugin *Ensemble) SetOptions(opts *AnalysisOptions) error {
+	plugin.options = opts
+	// The depth of the order book is passed again for each asset.
+	plugin.depth = nil
+	return nil
+}
+
+// SetClosingPrices ...
+func (plugin *Ensemble) SetClosingPrices(prices []float64) error {
+	plugin.prices = prices
+	return nil
+}
+
+// SetCurrentPrice ...
+func (plugin *Ensemble) SetCurrentPrice(price float64) error {
+	plugin.currentPrice = price
+	return nil
+}
+
+// SetOHLC ...
+func (plugin *Ensemble) SetOHLC(candles []OHLC) error {
+	plugin.candles = candles
+	return nil
+}
+
+// SetOrderBookDepth keeps the depth of the order book for the members that use it.
+func (plugin *Ensemble) SetOrderBookDepth(depth OrderBookDepth) error {
+	plugin.depth = &depth
+	return nil
+}
+
+// Emit runs every member on the price data and returns the signal they agree on.
+func (plugin *Ensemble) Emit() (signal SIGNAL, err error) {
+	signal, _, err = plugin.EmitConfidence()
+	return
+}
+
+// EmitConfidence runs every member on the price data and returns the signal they agree on. The confidence
+// is the share of the votes, or of their weight, cast for the signal.
+func (plugin *Ensemble) EmitConfidence() (signal SIGNAL, confidence float64, err error) {
+	asset := ""
+	if plugin.options != nil {
+		asset = plugin.options.Asset
+	}
+	settings := ensembleSettings(asset)
+	votes := map[SIGNAL]float64{}
+	total := 0.0
+	ballot := []string{}
+	for _, member := range settings.members() {
+		memberSignal, memberConfidence, err := plugin.run(PluginHandler.instance(member.plugin, asset))
+		if err != nil {
+			debugf("The %s plugin could not analyze %s and will not vote. Reason: %v", member.name, asset, err)
+			continue
+		}
+		weight := member.weight
+		if settings.Method == EnsembleWeighted {
+			weight *= memberConfidence
+		}
+		votes[memberSignal] += weight
+		total += member.weight
+		ballot = append(ballot, fmt.Sprintf("%s: %s", member.name, memberSignal))
+	}
+	if total == 0 {
+		return SignalWait, 0, ErrNoEnsembleVotes
+	}
+	signal = SignalWait
+	for candidate, weight := range votes {
+		if weight > total/2 {
+			signal, confidence = candidate, weight/total
+		}
+	}
+	if signal == SignalWait {
+		confidence = votes[SignalWait] / total
+	}
+	plugin.ballot = ballot
+	debugf("Ensemble vote for %s (%s): %s. Signal: %s", asset, settings.Method, strings.Join(ballot, ", "), signal)
+	return signal, confidence, nil
+}
+
+// Explain returns the signal each member voted for in the last vote.
+func (plugin *Ensemble) Explain() Explanation {
+	return Explanation{Notes: []string{"votes: " + strings.Join(plugin.ballot, ", ")}}
+}
+
+// run passes the price data to a member and returns its signal and its confidence in it. A member shared by
+// every asset analyzes one asset at a time.
+func (plugin *Ensemble) run(member Analyzer, shared bool) (SIGNAL, float64, error) {
+	defer lockShared(shared)()
+	if deep, ok := member.(DepthAnalyzer); ok && plugin.depth != nil {
+		if err := deep.SetOrderBookDepth(*plugin.depth); err != nil {
+			return SignalWait, 0, err
+		}
+	}
+	return runAnalyzer(member, plugin.options, plugin.prices, plugin.candles, plugin.currentPrice)
+}
+
+// runAnalyzer passes the price data to `plugin` and returns its signal and its confidence in it. It is
+// used by plugins that run other plugins. Each plugin is given its own copy of the options.
+func runAnalyzer(plugin Analyzer, opts *AnalysisOptions, prices []float64, candles []OHLC, currentPrice float64) (SIGNAL, float64, error) {
+	if opts != nil {
+		copied := *opts
+		if err := plugin.SetOptions(&copied); err != nil {
+			return SignalWait, 0, err
+		}
+	}
+	if err := plugin.SetClosingPrices(prices); err != nil {
+		return SignalWait, 0, err
+	}
+	if err := plugin.SetCurrentPrice(currentPrice); err != nil {
+		return SignalWait, 0, err
+	}
+	if err := plugin.SetOHLC(candles); err != nil {
+		return SignalWait, 0, err
+	}
+	return emitConfidence(plugin)
+}
@@ -0,0 +1,126 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `equity.go` tracks the equity of a trading session: the fiat balance and the balance of each traded
+*  asset at its current price. The equity at the start of the session is recorded and the session is
+*  stopped once the equity has fallen by more than the allowed percentage.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrSessionEquityStop is returned by `Bot.Run` when the session was stopped because its equity fell too far.
+var ErrSessionEquityStop = errors.New("the session's equity has fallen below the allowed limit")
+
+// SessionStopSettings configures the equity-based stop of a session.
+type SessionStopSettings struct {
+	Enabled bool
+	// MaxDrop is how much the equity may fall below its value at the start of the session, as a
+	// fraction of it, before the session is stopped.
+	MaxDrop float64
+}
+
+// equityTracker holds the balances and prices used to value a session's equity.
+type equityTracker struct {
+	mu       sync.Mutex
+	fiat     float64
+	balances map[string]float64 // Asset balance of each client.
+	prices   map[string]float64 // Last price seen for each asset.
+	start    float64            // Equity at the start of the session. Zero until it has been recorded.
+	started  time.Time
+}
+
+func newEquityTracker() *equityTracker {
+	return &equityTracker{balances: map[string]float64{}, prices: map[string]float64{}}
+}
+
+// observe notes the balances of a client and the current price of its asset.
+func (e *equityTracker) observe(cl *Client, price float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// All clients share the fiat account, so its balance is only counted once.
+	e.fiat = cl.fiatBalance
+	e.balances[cl.asset] = cl.assetBalance
+	if price > 0 {
+		e.prices[cl.asset] = price
+	}
+}
+
+// value returns the equity at the last seen prices. `ok` is false if an asset with a balance has no price yet.
+func (e *equityTracker) value() (equity float64, ok bool) {
+	equity = e.fiat
+	for asset, balance := range e.balances {
+		price, priced := e.prices[asset]
+		if !priced && balance > 0 {
+			return 0, false
+		}
+		equity += balance * price
+	}
+	return equity, true
+}
+
+// recordStartEquity values the balances of every client at the start of the session. If a balance or
+// price can not be retrieved the equity at the end of the first complete round is used instead.
+func (bot *Bot) recordStartEquity() {
+	bot.equity = newEquityTracker()
+	for i := range bot.clients {
+		cl := &bot.clients[i]
+		if err := cl.retrieveBalances(); err != nil {
+			debugf("Could not retrieve your %s balance to value the session. Reason: %v", cl.name, err)
+			return
+		}
+		price, err := cl.CurrentPrice()
+		if err != nil {
+			debugf("Could not retrieve the price of %s to value the session. Reason: %v", cl.name, err)
+			return
+		}
+		bot.equity.observe(cl, price)
+	}
+	bot.equity.markStart()
+}
+
+// markStart records the current equity as the equity at the start of the session.
+func (e *equityTracker) markStart() {
+	e.mu.Lock()
+	equity, ok := e.value()
+	ok = ok && equity > 0
+	if ok {
+		e.start, e.started = equity, time.Now()
+	}
+	e.mu.Unlock()
+	if ok {
+		debugf("Your equity at the start of this session is %s %.2f.", cfg().CurrencyCode, equity)
+	}
+}
+
+// checkSessionEquity returns an error wrapping `ErrSessionEquityStop` if the equity has fallen below
+// its value at the start of the session by more than `config.Trade.SessionStop.MaxDrop`.
+func (bot *Bot) checkSessionEquity() error {
+	e := bot.equity
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	if e.start == 0 {
+		e.mu.Unlock()
+		e.markStart()
+		return nil
+	}
+	settings := cfg().Trade.SessionStop
+	equity, ok := e.value()
+	start, started := e.start, e.started
+	e.mu.Unlock()
+	if !settings.Enabled || settings.MaxDrop <= 0 || !ok {
+		return nil
+	}
+	if drop := (start - equity) / start; drop >= settings.MaxDrop {
+		return fmt.Errorf("%w (%s %.2f at %s, %s %.2f now, a drop of %.1f%%)", ErrSessionEquityStop, cfg().CurrencyCode,
+			start, started.Format("Jan 2 15:04"), cfg().CurrencyCode, equity, drop*100)
+	}
+	return nil
+}
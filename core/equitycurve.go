@@ -0,0 +1,88 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `equitycurve.go` keeps the equity curve in the EQUITY table of the ledger. Each time the profit
+*  snapshots are taken, the fiat balance and the value of the open positions at the current price are
+*  saved, so the stats page and reports can show how the equity changed over time instead of only the
+*  all time totals. Open short positions count against the equity by what it would cost to buy them
+*  back, so the equity is what the fiat balance would be if every position were closed at that time.
+ */
+
+import (
+	"time"
+)
+
+var (
+	equityInit = `CREATE TABLE IF NOT EXISTS EQUITY (
+	ID INTEGER PRIMARY KEY AUTOINCREMENT,
+	TIME BIGINT NOT NULL,
+	FIAT REAL NOT NULL DEFAULT 0,
+	POSITIONS REAL NOT NULL DEFAULT 0,
+	SIMULATED INTEGER NOT NULL DEFAULT 0
+)`
+	equityIndex  = "CREATE INDEX IF NOT EXISTS EQUITY_TIME ON EQUITY (SIMULATED, TIME)"
+	equityInsert = "INSERT INTO EQUITY (TIME, FIAT, POSITIONS, SIMULATED) VALUES (?, ?, ?, ?)"
+	equitySelect = "SELECT TIME, FIAT, POSITIONS FROM EQUITY WHERE TIME >= ? AND SIMULATED = ? ORDER BY TIME, ID"
+)
+
+// EquityPoint is the equity of the account at a point in time.
+type EquityPoint struct {
+	Time time.Time
+	// Fiat is the fiat balance of the account.
+	Fiat float64
+	// Positions is the value of the open long positions at the current price, less what it would cost
+	// to buy back the open short positions.
+	Positions float64
+}
+
+// Equity returns the fiat balance and the value of the open positions.
+func (p EquityPoint) Equity() float64 {
+	return p.Fiat + p.Positions
+}
+
+// marketValue returns what closing an open record at `price` would add to the fiat balance. It is
+// negative for short positions, which are closed by buying the asset back.
+func marketValue(rec Record, price float64) float64 {
+	if rec.Type == ShortOrder {
+		return -rec.Volume * price
+	}
+	return rec.Volume * price
+}
+
+// recordEquity saves the equity of the account at the time of `snap`. All clients share the fiat
+// account, so its balance is retrieved once.
+func (s *Snapshotter) recordEquity(snap ProfitSnapshot) error {
+	if len(s.clients) == 0 {
+		return nil
+	}
+	cl := s.clients[0]
+	if err := cl.retrieveBalances(); err != nil {
+		return err
+	}
+	return saveEquity(EquityPoint{Time: snap.Time, Fiat: cl.fiatBalance, Positions: snap.Positions})
+}
+
+// saveEquity adds a point to the equity curve. Points taken in a dry run are kept apart from real ones.
+func saveEquity(point EquityPoint) error {
+	store, c, done, err := sharedLedger.open()
+	if err != nil {
+		return err
+	}
+	defer done()
+	return store.AddEquity(c, point, dryRun())
+}
+
+// EquityCurve returns the points of the equity curve of the current trading mode taken since `since`,
+// from the earliest.
+func EquityCurve(since time.Time) ([]EquityPoint, error) {
+	if !ledgerExists() {
+		return nil, nil
+	}
+	store, c, done, err := sharedLedger.open()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return store.EquityCurve(c, since, dryRun())
+}
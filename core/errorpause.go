@@ -0,0 +1,149 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `errorpause.go` pauses an asset whose requests to the exchange keep failing. The failures of each
+*  client are counted as they happen. Once too many fail in a row the asset is skipped for a backoff
+*  window, which doubles every time the asset fails again after a pause, instead of hammering the
+*  exchange every round.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrClientPaused is returned for an asset that is paused after repeated failed requests to the exchange.
+var ErrClientPaused = errors.New("trading is paused after repeated failed requests to the exchange")
+
+// ErrorPauseSettings configures the pausing of assets after repeated failed requests.
+type ErrorPauseSettings struct {
+	// Threshold is the number of failed requests in a row after which an asset is paused. Zero never pauses.
+	Threshold int
+	// Backoff is how long (in minutes) the first pause lasts. Each pause after it, without a successful
+	// request in between, lasts twice as long as the one before, up to `MaxBackoff`.
+	Backoff    int32
+	MaxBackoff int32
+}
+
+// APIPause describes an asset paused after repeated failed requests.
+type APIPause struct {
+	Asset     string
+	Failures  int       // Failed requests in a row.
+	Until     time.Time // When the asset is tried again.
+	LastError string
+}
+
+// apiHealth holds the failed requests of a client.
+type apiHealth struct {
+	failures int
+	backoff  time.Duration // Length of the last pause.
+	until    time.Time
+	lastErr  string
+}
+
+var (
+	apiHealthMu sync.Mutex
+	apiHealths  = map[string]*apiHealth{}
+)
+
+// recordAPIResult counts a failed request of `asset`, or resets the count after a successful one, and
+// pauses the asset once `config.ErrorPause.Threshold` requests have failed in a row.
+func recordAPIResult(asset string, err error) {
+	settings := cfg().ErrorPause
+	apiHealthMu.Lock()
+	health, ok := apiHealths[asset]
+	if !ok {
+		health = &apiHealth{}
+		apiHealths[asset] = health
+	}
+	if err == nil {
+		recovered := health.backoff > 0
+		*health = apiHealth{}
+		apiHealthMu.Unlock()
+		if recovered {
+			notify(EventInfo, asset, "Requests for %s are succeeding again.", assetNames[asset])
+		}
+		return
+	}
+	health.failures++
+	health.lastErr = err.Error()
+	now := time.Now()
+	if settings.Threshold <= 0 || health.failures < settings.Threshold || now.Before(health.until) {
+		apiHealthMu.Unlock()
+		return
+	}
+	maxBackoff := time.Duration(settings.MaxBackoff) * time.Minute
+	if health.backoff == 0 {
+		health.backoff = time.Duration(settings.Backoff) * time.Minute
+	} else {
+		health.backoff *= 2
+	}
+	if maxBackoff > 0 && health.backoff > maxBackoff {
+		health.backoff = maxBackoff
+	}
+	health.until = now.Add(health.backoff)
+	failures, backoff := health.failures, health.backoff
+	apiHealthMu.Unlock()
+	notify(EventAlert, asset, "%d requests for %s failed in a row (last error: %v). Leprechaun will pause %s trading for %v.",
+		failures, assetNames[asset], err, assetNames[asset], backoff)
+}
+
+// checkAPIPause returns an error wrapping `ErrClientPaused` while `asset` is paused.
+func checkAPIPause(asset string) error {
+	apiHealthMu.Lock()
+	defer apiHealthMu.Unlock()
+	if health, ok := apiHealths[asset]; ok && time.Now().Before(health.until) {
+		return fmt.Errorf("%w (until %s)", ErrClientPaused, health.until.Format("15:04"))
+	}
+	return nil
+}
+
+// APIPauses returns the assets that are paused after repeated failed requests, ordered by asset code.
+func APIPauses() (pauses []APIPause) {
+	apiHealthMu.Lock()
+	defer apiHealthMu.Unlock()
+	now := time.Now()
+	for asset, health := range apiHealths {
+		if now.Before(health.until) {
+			pauses = append(pauses, APIPause{Asset: asset, Failures: health.failures, Until: health.until, LastError: health.lastErr})
+		}
+	}
+	sort.Slice(pauses, func(i, j int) bool { return pauses[i].Asset < pauses[j].Asset })
+	return
+}
+
+// RetryAsset ends the pause of an asset so it is tried again in the next round. If its next request
+// fails the asset is paused again, for twice as long.
+func RetryAsset(asset string) {
+	apiHealthMu.Lock()
+	defer apiHealthMu.Unlock()
+	if health, ok := apiHealths[asset]; ok {
+		health.until = time.Time{}
+	}
+}
+
+// failureTransport counts the failed requests of an asset. Requests that fail because of the network,
+// the exchange's servers or its rate limit count as failures. Other error responses, such as a rejected
+// order, are answers from a working exchange.
+type failureTransport struct {
+	asset string
+	next  http.RoundTripper
+}
+
+func (t *failureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		recordAPIResult(t.asset, err)
+	case res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests:
+		recordAPIResult(t.asset, fmt.Errorf("luno: %s", res.Status))
+	default:
+		recordAPIResult(t.asset, nil)
+	}
+	return res, err
+}
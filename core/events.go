@@ -0,0 +1,148 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `events.go` writes one JSON line for each asset in each trading round, with the price, the signal,
+*  the action taken, the balances and how long the round took. The lines are appended to an events
+*  file or sent to a socket, so the bot's activity can be fed to analytics pipelines such as
+*  ELK or Grafana without parsing the human readable log.
+ */
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions reported in round events.
+const (
+	ActionNone    = "none"
+	ActionLong    = "long"
+	ActionShort   = "short"
+	ActionSkipped = "skipped"
+)
+
+// RoundEvent is the structured record of one asset in one trading round.
+type RoundEvent struct {
+	Time         time.Time `json:"time"`
+	Round        int       `json:"round"`
+	Asset        string    `json:"asset"`
+	Pair         string    `json:"pair"`
+	Price        float64   `json:"price,omitempty"`
+	Spread       float64   `json:"spread,omitempty"`
+	Signal       SIGNAL    `json:"signal,omitempty"`
+	SignalReused bool      `json:"signal_reused,omitempty"` // The market was idle and the last signal was used.
+	Confidence   float64   `json:"confidence,omitempty"`    // The analysis plugin's confidence in the signal, from 0 to 1.
+	Action       string    `json:"action"`
+	Volume       float64   `json:"volume,omitempty"`
+	RecordID     string    `json:"record_id,omitempty"`
+	Reason       string    `json:"reason,omitempty"` // Why the asset was skipped, if it was.
+	FiatBalance  float64   `json:"fiat_balance"`
+	AssetBalance float64   `json:"asset_balance"`
+	AnalysisMs   int64     `json:"analysis_ms"`
+	DurationMs   int64     `json:"duration_ms"`
+	started      time.Time
+}
+
+// eventSink writes round events to the socket set in the config or, if there is none, to the events file.
+type eventSink struct {
+	mu   sync.Mutex
+	file *os.File
+	conn net.Conn
+}
+
+var roundEvents eventSink
+
+// RoundEventsPath returns the path of the events file set in the config, or the default path in the data folder.
+func RoundEventsPath() string {
+	if cfg().RoundEventsFile != "" {
+		return cfg().RoundEventsFile
+	}
+	return filepath.Join(dataDir(), "events.jsonl")
+}
+
+// dialEvents connects to `config.RoundEventsAddress`, e.g. "tcp://127.0.0.1:5170", "udp://10.0.0.2:5170"
+// or "unix:///var/run/logstash.sock". An address without a scheme is dialled over TCP.
+func dialEvents(address string) (net.Conn, error) {
+	network := "tcp"
+	if ix := strings.Index(address, "://"); ix > 0 {
+		network, address = address[:ix], address[ix+3:]
+	}
+	return net.DialTimeout(network, address, 5*time.Second)
+}
+
+// newRoundEvent starts the event of a client in a round.
+func newRoundEvent(round int, cl *Client) *RoundEvent {
+	now := time.Now()
+	return &RoundEvent{Time: now, Round: round, Asset: cl.asset, Pair: cl.Pair, Action: ActionNone, started: now}
+}
+
+// skip records why an asset was skipped in the round.
+func (evt *RoundEvent) skip(reason error) {
+	evt.Action = ActionSkipped
+	if reason != nil {
+		evt.Reason = reason.Error()
+	}
+}
+
+// emitRoundEvent completes a round event with the client's balances and writes it. `evt` may be nil.
+func emitRoundEvent(evt *RoundEvent, cl *Client) {
+	if evt == nil || !cfg().WriteRoundEvents {
+		return
+	}
+	evt.FiatBalance, evt.AssetBalance = cl.fiatBalance, cl.assetBalance
+	evt.DurationMs = time.Since(evt.started).Milliseconds()
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	roundEvents.write(append(data, '\n'))
+}
+
+func (s *eventSink) write(line []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if cfg().RoundEventsAddress == "" {
+		if s.file == nil {
+			path := RoundEventsPath()
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if s.file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+				Logger.Printf("Could not open the events file %s. Reason: %v", path, err)
+				return
+			}
+		}
+		s.file.Write(line)
+		return
+	}
+	if s.conn == nil {
+		if s.conn, err = dialEvents(cfg().RoundEventsAddress); err != nil {
+			// Events are dropped until the socket can be reached. It is dialled again next round.
+			debugf("Could not connect to the events socket %s. Reason: %v", cfg().RoundEventsAddress, err)
+			return
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err = s.conn.Write(line); err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// close closes the events file and socket. They are opened again by the next write.
+func (s *eventSink) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
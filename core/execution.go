@@ -0,0 +1,75 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `execution.go` prices market orders from the order book. Buys are priced at the asks and sells at
+*  the bids, instead of the ticker's ask price being used for both sides. If the user wants it, the
+*  price is the average price the order book can fill the whole order at.
+ */
+
+import (
+	luno "github.com/luno/luno-go"
+)
+
+// bookSide returns the entries of the order book that fill an order on `side`.
+// A buy order is filled by the asks and a sell order by the bids.
+func bookSide(book *luno.GetOrderBookResponse, side luno.OrderType) []luno.OrderBookEntry {
+	if side == luno.OrderTypeSell {
+		return book.Bids
+	}
+	return book.Asks
+}
+
+// averageFillPrice walks `entries` and returns the average price at which `volume` would be filled.
+func averageFillPrice(entries []luno.OrderBookEntry, volume float64) (price float64, err error) {
+	if len(entries) == 0 {
+		return 0, ErrOrderBookTooThin
+	}
+	if volume <= 0 {
+		return entries[0].Price.Float64(), nil
+	}
+	remaining, cost := volume, 0.0
+	for _, entry := range entries {
+		filled := entry.Volume.Float64()
+		if filled > remaining {
+			filled = remaining
+		}
+		cost += filled * entry.Price.Float64()
+		remaining -= filled
+		if remaining <= 0 {
+			break
+		}
+	}
+	if remaining > 0 {
+		return 0, ErrOrderBookTooThin
+	}
+	return cost / volume, nil
+}
+
+// ExecutionPrice returns the price a market order for `volume` on `side` is expected to be filled at.
+// It is the best price on the correct side of the order book or, if `config.Trade.VolumeWeightedPrice`
+// is set, the average price of the whole order.
+func (cl *Client) ExecutionPrice(side luno.OrderType, volume float64) (price float64, err error) {
+	sleep() // Error 429 safety
+	req := luno.GetOrderBookRequest{Pair: cl.Pair}
+	book, err := cl.GetOrderBook(ctx, &req)
+	if err != nil {
+		return
+	}
+	if !cfg().Trade.VolumeWeightedPrice {
+		volume = 0
+	}
+	price, err = averageFillPrice(bookSide(book, side), volume)
+	if err != nil {
+		return
+	}
+	return GetPairInfo(cl.Pair).RoundPrice(price), nil
+}
+
+// sellPrice returns the best bid from the ticker price `ask` and the spread of the last call to `Client.CurrentPrice`.
+func (cl *Client) sellPrice(ask float64) float64 {
+	if cl.spread <= 0 || cl.spread >= ask {
+		return ask
+	}
+	return ask - cl.spread
+}
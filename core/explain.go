@@ -0,0 +1,124 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `explain.go` tells the user why a signal was emitted. Analysis plugins that implement `Explainer`
+*  describe the patterns, indicators and scores behind their last signal. The explanation is sent to
+*  the UI after each analysis, so the log can show why the bot went long or short and not just that it did.
+ */
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IndicatorScore is the value and score of a single indicator examined by an analysis plugin.
+type IndicatorScore struct {
+	Indicator string
+	Value     float64 // Zero if the indicator has no single value, e.g. a candlestick pattern.
+	Score     float64
+}
+
+// Explanation describes why an analysis plugin emitted its last signal. Fields a plugin does not use are left empty.
+type Explanation struct {
+	// Trend is the overall trend of the analyzed prices, e.g. "Bullish".
+	Trend string
+	// Patterns are the candlestick and chart patterns detected in the latest candles.
+	Patterns []string
+	// PricePosition is the position of the current price relative to the moving average, e.g. "above".
+	PricePosition string
+	// Scores are the indicators examined and the score each was given.
+	Scores []IndicatorScore
+	// Notes are any other reasons for the signal.
+	Notes []string
+}
+
+// Explainer is implemented by analysis plugins that explain their signals.
+type Explainer interface {
+	// Explain returns the explanation of the signal last emitted by the plugin.
+	Explain() Explanation
+}
+
+// SignalExplanation is sent to the UI after each analysis.
+type SignalExplanation struct {
+	Explanation
+	Asset      string
+	Plugin     string
+	Signal     SIGNAL
+	Confidence float64
+	Time       time.Time
+}
+
+// String returns the explanation as a single line for the log.
+func (e SignalExplanation) String() string {
+	parts := []string{}
+	if e.Trend != "" {
+		parts = append(parts, "trend "+e.Trend)
+	}
+	if e.PricePosition != "" {
+		parts = append(parts, "price "+e.PricePosition+" the moving average")
+	}
+	if len(e.Patterns) > 0 {
+		parts = append(parts, "patterns: "+strings.Join(e.Patterns, ", "))
+	}
+	for _, score := range e.Scores {
+		if score.Value != 0 {
+			parts = append(parts, fmt.Sprintf("%s %.4g (score %.2f)", score.Indicator, score.Value, score.Score))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s (score %.2f)", score.Indicator, score.Score))
+		}
+	}
+	parts = append(parts, e.Notes...)
+	why := "no explanation given"
+	if len(parts) > 0 {
+		why = strings.Join(parts, "; ")
+	}
+	return fmt.Sprintf("%s: %v from %s (%.0f%% confident) because %s", e.Asset, e.Signal, e.Plugin,
+		e.Confidence*100, why)
+}
+
+// Explanation sets the channel through which the bot sends the explanation of each signal to the UI.
+func (c *Channels) Explanation(channel chan SignalExplanation) {
+	c.ExplanationChan = channel
+}
+
+// pluginNameFor returns the name of the analysis plugin used for `asset`.
+func pluginNameFor(asset string) string {
+	if name := strings.ToLower(cfg().Trade.AnalyzerOverrides[asset].Plugin); name != "" {
+		if _, ok := PluginHandler.plugins[name]; ok {
+			return name
+		}
+	}
+	if name := strings.ToLower(cfg().Trade.AnalysisPlugin.Name); name != "" {
+		if _, ok := PluginHandler.plugins[name]; ok {
+			return name
+		}
+	}
+	return strings.ToLower(DefaultAnalysisPlugin)
+}
+
+// explanationOf returns the explanation of the signal last emitted by `plugin`, if it explains its signals.
+// It is taken right after the analysis, while no other asset can be analyzed by the plugin.
+func explanationOf(plugin Analyzer) (explanation Explanation) {
+	if explainer, ok := plugin.(Explainer); ok {
+		explanation = explainer.Explain()
+	}
+	return
+}
+
+// explainSignal sends `why`, the explanation of the signal for `asset` returned by `explanationOf`, to the
+// UI. `note` is added to it, e.g. why a signal was not confirmed. The explanation is dropped if the UI
+// is not ready for it, so the trading loop is never held up.
+func explainSignal(why Explanation, asset string, signal SIGNAL, confidence float64, notes ...string) {
+	if UIChans == nil || UIChans.ExplanationChan == nil {
+		return
+	}
+	explanation := SignalExplanation{Explanation: why, Asset: asset, Plugin: pluginNameFor(asset), Signal: signal,
+		Confidence: confidence, Time: time.Now()}
+	explanation.Notes = append(append([]string{}, why.Notes...), notes...)
+	select {
+	case UIChans.ExplanationChan <- explanation:
+	default:
+	}
+}
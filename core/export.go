@@ -0,0 +1,153 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `export.go` exports the trading history to CSV files that open in spreadsheets such as Excel, so the
+*  user can analyze it in their own way. The open records of the ledger, the closed records, the saved
+*  sales, the saved purchases and the equity curve are each written to a file of their own, optionally
+*  limited to a date range.
+ */
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ExportRange limits an export to the entries from `From` up to, but not including, `To`. A zero time
+// leaves that end of the range open.
+type ExportRange struct {
+	From, To time.Time
+}
+
+// contains reports whether `t` is in the range.
+func (r ExportRange) contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || t.Before(r.To))
+}
+
+// ExportDir returns the folder exports are written to by default.
+func ExportDir() string {
+	return filepath.Join(dataDir(), "exports")
+}
+
+// ExportHistory writes the open and closed records in the ledger, the sales, the purchases and the equity curve in `span` to CSV files in
+// `dir` and returns their paths. Entries whose time can not be read are only exported when the range is
+// open at both ends.
+func ExportHistory(dir string, span ExportRange) (paths []string, err error) {
+	if cfg() == nil {
+		return nil, errors.New("the settings have not been loaded")
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	keep := func(t time.Time, err error) bool {
+		if err != nil {
+			return span.From.IsZero() && span.To.IsZero()
+		}
+		return span.contains(t)
+	}
+	stamp := time.Now().Format("20060102-150405")
+
+	records := [][]string{{"Order ID", "Asset", "Type", "Opened", "Price", "Volume", "Requested volume", "Cost",
+		"Trigger price", "Asset fee", "Fiat fee", "Parent ID", "Client reference", "Status", "Simulated"}}
+	if ledgerExists() {
+		l := &Ledger{databasePath: ledgerPath()}
+		l.loadDatabase()
+		all, e := l.everyRecord()
+		l.Save()
+		if e != nil {
+			return nil, e
+		}
+		for _, rec := range all {
+			if !keep(rec.Time()) {
+				continue
+			}
+			records = append(records, []string{rec.ID, rec.Asset, string(rec.Type), rec.Timestamp, formatFloat(rec.Price),
+				formatFloat(rec.Volume), formatFloat(rec.RequestedVolume), formatFloat(rec.Cost), formatFloat(rec.TriggerPrice),
+				formatFloat(rec.LunoAssetFee), formatFloat(rec.LunoFiatFee), rec.ParentID, rec.ClientRef, rec.Status,
+				strconv.FormatBool(rec.Simulated)})
+		}
+	}
+	profits := func(entries []*ProfitEntry) [][]string {
+		rows := [][]string{{"Order ID", "Asset", "Parent ID", "Opened", "Closed", "Purchase price", "Purchase volume",
+			"Purchase cost", "Sale price", "Sale volume", "Sale cost", "Profit", "Fees", "Net profit"}}
+		for _, entry := range entries {
+			if !keep(entry.Time()) {
+				continue
+			}
+			rows = append(rows, []string{entry.OrderID, entry.Asset, entry.ParentID, entry.Opened, entry.Timestamp,
+				formatFloat(entry.PurchasePrice), formatFloat(entry.PurchaseVolume), formatFloat(entry.PurchaseCost),
+				formatFloat(entry.SalePrice), formatFloat(entry.SaleVolume), formatFloat(entry.SaleCost), formatFloat(entry.Profit),
+				formatFloat(entry.Fees), formatFloat(entry.NetProfit)})
+		}
+		return rows
+	}
+	closed := [][]string{{"Order ID", "Asset", "Type", "Opened", "Closed", "Price", "Volume", "Cost", "Asset fee",
+		"Fiat fee", "Parent ID", "Close order ID", "Close price", "Close volume", "Simulated"}}
+	closedRecords, err := ClosedRecords("")
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range closedRecords {
+		if !keep(rec.Closed()) {
+			continue
+		}
+		closed = append(closed, []string{rec.ID, rec.Asset, string(rec.Type), rec.Timestamp, rec.ClosedAt,
+			formatFloat(rec.Price), formatFloat(rec.Volume), formatFloat(rec.Cost), formatFloat(rec.LunoAssetFee),
+			formatFloat(rec.LunoFiatFee), rec.ParentID, rec.CloseOrderID, formatFloat(rec.ClosePrice),
+			formatFloat(rec.CloseVolume), strconv.FormatBool(rec.Simulated)})
+	}
+	// There are no sales or purchases until a position has been closed.
+	sales, _ := GetSales()
+	purchases, _ := GetPurchases()
+	equity := [][]string{{"Time", "Fiat", "Positions", "Equity"}}
+	points, err := EquityCurve(span.From)
+	if err != nil {
+		return nil, err
+	}
+	for _, point := range points {
+		if !keep(point.Time, nil) {
+			continue
+		}
+		equity = append(equity, []string{point.Time.Format(timeFormat), formatFloat(point.Fiat),
+			formatFloat(point.Positions), formatFloat(point.Equity())})
+	}
+
+	files := []struct {
+		name string
+		rows [][]string
+	}{{"records", records}, {"closed", closed}, {"sales", profits(sales)}, {"purchases", profits(purchases)},
+		{"equity", equity}}
+	for _, f := range files {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s.csv", f.name, stamp))
+		if err = writeCSV(path, f.rows); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// writeCSV writes `rows` to a new CSV file at `path`.
+func writeCSV(path string, rows [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(file)
+	w.WriteAll(rows)
+	if err = w.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// formatFloat formats `f` without losing precision or using an exponent, so spreadsheets read it as a number.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,139 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `flashmove.go` is a kill switch for sudden price moves. If the price of an asset moves more than
+*  a set percentage within one analysis interval, trading of the asset is halted and its DCA plan is
+*  cancelled, since the analysis can not be trusted in such a market. Trading resumes once the price
+*  has stayed calm for a number of rounds, or when the user resumes it.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrFlashMove is returned for an asset whose trading is halted after a flash move.
+var ErrFlashMove = errors.New("trading is halted after a sudden move in the price")
+
+// FlashMoveSettings configures the flash move kill switch.
+type FlashMoveSettings struct {
+	Enabled bool
+	// MaxMove is the largest move of the price within one analysis interval, as a fraction of the
+	// lowest price in the interval, before trading of the asset is halted.
+	MaxMove float64
+	// CalmRounds is the number of rounds in a row the price must move less than half of `MaxMove`
+	// within an interval before trading resumes by itself. Zero leaves it to the user to resume trading.
+	CalmRounds int
+}
+
+// FlashHalt describes an asset whose trading is halted after a flash move.
+type FlashHalt struct {
+	Asset string
+	Since time.Time
+	Move  float64 // The move that halted trading, as a fraction of the price.
+	calm  int     // Rounds in a row the price has been calm.
+}
+
+// priceSample is the price of an asset seen in a round.
+type priceSample struct {
+	at    time.Time
+	price float64
+}
+
+var (
+	flashMu      sync.Mutex
+	flashSamples = map[string][]priceSample{}
+	flashHalts   = map[string]*FlashHalt{}
+)
+
+// priceMove returns the largest move between the prices in `samples` as a fraction of the lowest.
+func priceMove(samples []priceSample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	low, high := math.Inf(1), 0.0
+	for _, s := range samples {
+		low, high = math.Min(low, s.price), math.Max(high, s.price)
+	}
+	if low <= 0 {
+		return 0
+	}
+	return (high - low) / low
+}
+
+// checkFlashMove records the price of the client's asset and halts trading of the asset if the price
+// has moved more than `config.Trade.FlashMove.MaxMove` within one analysis interval. It returns an
+// error wrapping `ErrFlashMove` while trading of the asset is halted.
+func (bot *Bot) checkFlashMove(cl *Client, price float64) error {
+	settings := cfg().Trade.FlashMove
+	if !settings.Enabled || settings.MaxMove <= 0 || price <= 0 {
+		return nil
+	}
+	_, _, opts := bot.resolveAnalyzer(cl.asset)
+	window := opts.Interval
+	now := time.Now()
+	flashMu.Lock()
+	samples := append(flashSamples[cl.asset], priceSample{at: now, price: price})
+	for len(samples) > 1 && now.Sub(samples[0].at) > window {
+		samples = samples[1:]
+	}
+	flashSamples[cl.asset] = samples
+	move := priceMove(samples)
+	halt := flashHalts[cl.asset]
+	if halt == nil {
+		if move <= settings.MaxMove {
+			flashMu.Unlock()
+			return nil
+		}
+		halt = &FlashHalt{Asset: cl.asset, Since: now, Move: move}
+		flashHalts[cl.asset] = halt
+		flashMu.Unlock()
+		notify(EventAlert, cl.asset, "The price of %s moved %.1f%% within %v. Leprechaun has halted %s trading until the market calms or you resume it.",
+			cl.name, move*100, window, cl.name)
+		if cancelDCA(cl.asset) {
+			debugf("The DCA plan for %s was cancelled. Purchases already made remain in the ledger.", cl.name)
+		}
+		return fmt.Errorf("%w (%.1f%% within %v)", ErrFlashMove, move*100, window)
+	}
+	if move < settings.MaxMove/2 {
+		halt.calm++
+	} else {
+		halt.calm = 0
+	}
+	if settings.CalmRounds > 0 && halt.calm >= settings.CalmRounds {
+		delete(flashHalts, cl.asset)
+		flashMu.Unlock()
+		notify(EventInfo, cl.asset, "The %s market has calmed. Leprechaun has resumed %s trading.", cl.name, cl.name)
+		return nil
+	}
+	since := halt.Since
+	flashMu.Unlock()
+	return fmt.Errorf("%w (since %s)", ErrFlashMove, since.Format("15:04"))
+}
+
+// FlashHalts returns the assets whose trading is halted after a flash move, ordered by asset code.
+func FlashHalts() (halts []FlashHalt) {
+	flashMu.Lock()
+	defer flashMu.Unlock()
+	for _, halt := range flashHalts {
+		halts = append(halts, *halt)
+	}
+	sort.Slice(halts, func(i, j int) bool { return halts[i].Asset < halts[j].Asset })
+	return
+}
+
+// ResumeAsset resumes trading of an asset halted after a flash move. The prices seen before
+// are forgotten, so the move that halted trading does not halt it again.
+func ResumeAsset(asset string) {
+	flashMu.Lock()
+	defer flashMu.Unlock()
+	delete(flashHalts, asset)
+	if samples := flashSamples[asset]; len(samples) > 0 {
+		flashSamples[asset] = samples[len(samples)-1:]
+	}
+}
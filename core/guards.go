@@ -0,0 +1,64 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `guards.go` holds pre-trade checks that stop the bot from placing orders under poor market conditions.
+ */
+
+import (
+	"errors"
+	"fmt"
+
+	luno "github.com/luno/luno-go"
+)
+
+// ErrOrderBookTooThin is returned when the order book can not fill an order.
+var ErrOrderBookTooThin = errors.New("the order book is too thin to fill the order")
+
+// ExpectedSlippage walks the order book to estimate the relative difference between the best price
+// and the average price a market order for `volume` would be filled at.
+func (cl *Client) ExpectedSlippage(side luno.OrderType, volume float64) (slippage float64, err error) {
+	sleep() // Error 429 safety
+	req := luno.GetOrderBookRequest{Pair: cl.Pair}
+	book, err := cl.GetOrderBook(ctx, &req)
+	if err != nil {
+		return
+	}
+	entries := bookSide(book, side)
+	average, err := averageFillPrice(entries, volume)
+	if err != nil {
+		return
+	}
+	best := entries[0].Price.Float64()
+	if side == luno.OrderTypeSell {
+		return (best - average) / best, nil
+	}
+	return (average - best) / best, nil
+}
+
+// checkExecution returns a non-nil error if the bid-ask spread or the expected slippage of an order
+// would use up more than `config.Trade.MaxSpreadRatio` of the profit margin. The spread is taken
+// from the last call to `Client.CurrentPrice`.
+func (cl *Client) checkExecution(signal SIGNAL, volume, price float64) error {
+	ratio := cfg().Trade.MaxSpreadRatio
+	if ratio <= 0 || price <= 0 || (signal != SignalLong && signal != SignalShort) {
+		return nil
+	}
+	limit := cfg().ProfitMargin * ratio
+	spread := cl.spread / price
+	if spread > limit {
+		return fmt.Errorf("the bid-ask spread (%.2f%%) exceeds %.2f%% of the price", spread*100, limit*100)
+	}
+	side := luno.OrderTypeBuy
+	if signal == SignalShort {
+		side = luno.OrderTypeSell
+	}
+	slippage, err := cl.ExpectedSlippage(side, volume)
+	if err != nil {
+		return err
+	}
+	if spread+slippage > limit {
+		return fmt.Errorf("the spread and expected slippage (%.2f%%) exceed %.2f%% of the price", (spread+slippage)*100, limit*100)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `health.go` serves the /healthz and /readyz endpoints used by process supervisors such as systemd
+*  or Kubernetes when Leprechaun runs on a server. /healthz fails when the trading loop has stopped
+*  making progress, so a wedged bot can be restarted. /readyz fails when the exchange or the ledger
+*  can not be reached.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLoopWedged is reported by /healthz when the trading loop has not made progress in time.
+	ErrLoopWedged = errors.New("the trading loop has not made progress in time")
+	// ErrBotNotRunning is reported by /readyz when the bot has not been started.
+	ErrBotNotRunning = errors.New("the bot is not running")
+)
+
+// HealthStatus is the body of the responses of the health endpoints.
+type HealthStatus struct {
+	Status    string    `json:"status"`
+	Running   bool      `json:"running"`
+	LastBeat  time.Time `json:"last_beat"`
+	Exchange  string    `json:"exchange"`
+	Ledger    string    `json:"ledger"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+var (
+	healthMu     sync.Mutex
+	loopRunning  bool
+	lastBeat     time.Time
+	exchangeErr  error = ErrBotNotRunning
+	healthServer sync.Once
+)
+
+// heartbeat records that the trading loop is making progress.
+func heartbeat() {
+	healthMu.Lock()
+	lastBeat = time.Now()
+	healthMu.Unlock()
+}
+
+// setLoopRunning records whether the trading loop is running.
+func setLoopRunning(running bool) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	loopRunning = running
+	lastBeat = time.Now()
+	if !running {
+		exchangeErr = ErrBotNotRunning
+	}
+}
+
+// recordExchangeResult records the outcome of the last request made to the exchange by the trading loop.
+func recordExchangeResult(err error) {
+	healthMu.Lock()
+	exchangeErr = err
+	healthMu.Unlock()
+}
+
+// healthTimeout is how long the trading loop may go without a heartbeat. A trade proposal may
+// legitimately hold up the loop for up to `config.Trade.ApprovalTimeout`.
+func healthTimeout() time.Duration {
+	timeout := time.Duration(cfg().HealthTimeout) * time.Minute
+	if timeout <= 0 {
+		timeout = 15 * time.Minute
+	}
+	if cfg().Trade.ManualApproval {
+		timeout += time.Duration(cfg().Trade.ApprovalTimeout) * time.Second
+	}
+	return timeout
+}
+
+// checkLedger returns a non-nil error if the ledger database can not be read.
+func checkLedger() error {
+	if !ledgerExists() {
+		return errors.New("the ledger database does not exist")
+	}
+	_, err := sharedLedger.everyRecord()
+	return err
+}
+
+// health returns the current health of the bot. `ready` includes the checks of the exchange and the ledger.
+func health(ready bool) (status HealthStatus, ok bool) {
+	healthMu.Lock()
+	status = HealthStatus{Running: loopRunning, LastBeat: lastBeat, Exchange: "ok", Ledger: "ok", CheckedAt: time.Now()}
+	exchange := exchangeErr
+	healthMu.Unlock()
+	var err error
+	switch {
+	case status.Running && time.Since(status.LastBeat) > healthTimeout():
+		err = ErrLoopWedged
+	case !ready:
+	case !status.Running:
+		err = ErrBotNotRunning
+	case exchange != nil:
+		err = exchange
+	}
+	if exchange != nil {
+		status.Exchange = exchange.Error()
+	}
+	if ready {
+		if e := checkLedger(); e != nil {
+			status.Ledger = e.Error()
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	if err != nil {
+		status.Status, status.Error = "unavailable", err.Error()
+		return status, false
+	}
+	status.Status = "ok"
+	return status, true
+}
+
+func healthHandler(ready bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, ok := health(ready)
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// ServeHealth starts serving the health endpoints on `config.HealthAddress`. It does nothing if no
+// address is set and the endpoints are only started once, so they outlive restarts of the bot.
+func ServeHealth() {
+	if cfg().HealthAddress == "" {
+		return
+	}
+	healthServer.Do(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/healthz", healthHandler(false))
+		mux.HandleFunc("/readyz", healthHandler(true))
+		addr := cfg().HealthAddress
+		go func() {
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				Logger.Printf("Could not serve the health endpoints on %s. Reason: %v", addr, err)
+			}
+		}()
+		debugf("Serving the health endpoints on %s", addr)
+	})
+}
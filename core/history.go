@@ -0,0 +1,268 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `history.go` imports the trades the user made on the exchange before they used Leprechaun, so the all
+*  time stats of long-time users do not start at zero. The trades of each supported pair are listed from
+*  the exchange and every sale is matched with the earliest purchases it sold (FIFO). The profit of each
+*  sale is saved to the PROFITS table as an imported row, which is counted in the all time stats but is
+*  not a sale of the bot, so it is not listed with them or used to size positions. Only trades made
+*  before the first trade in the ledger are imported, so the bot's own trades are not counted twice.
+*  The history of each asset is imported once. An asset is marked as imported when all of its sales are
+*  saved, so an import that fails partway, e.g. when the connection drops, is resumed from the assets it
+*  did not finish, and the sales it had saved of those are replaced rather than counted twice.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/luno/luno-go"
+)
+
+// historyPageSize is the number of trades listed in each request to the exchange.
+const historyPageSize = 1000
+
+// historyStart is the time the trade history is listed from. The exchange opened after it.
+var historyStart = time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	// ErrHistoryImported is returned when the trade history has already been imported.
+	ErrHistoryImported = errors.New("the trade history has already been imported")
+	// ErrHistoryPaper is returned when the trade history is imported while paper trading.
+	ErrHistoryPaper = errors.New("the trade history can not be imported while paper trading")
+)
+
+// HistoryImport sums the trades of an asset imported from the exchange.
+type HistoryImport struct {
+	Asset string
+	// Trades is the number of trades listed, and Sales the number of sales whose profit was imported.
+	Trades, Sales int
+	// Profit is the profit of the imported sales, less their fees.
+	Profit float64
+	// Unmatched is the volume sold that was not bought on the exchange before, e.g. coins that were
+	// deposited. Its profit is unknown, so it is left out.
+	Unmatched float64
+}
+
+func (h HistoryImport) String() string {
+	s := fmt.Sprintf("%s: %d trades, %d sales imported for a profit of %.2f %s after fees.", h.Asset, h.Trades, h.Sales,
+		h.Profit, cfg().CurrencyCode)
+	if h.Unmatched > 0 {
+		s += fmt.Sprintf(" %.6f %s sold without a purchase on the exchange was left out.", h.Unmatched, h.Asset)
+	}
+	return s
+}
+
+// ImportTradeHistory imports the trades of every supported asset made before the first trade in the
+// ledger into the all time stats, skipping the assets imported before. It returns ErrHistoryImported if
+// every asset has been imported.
+func ImportTradeHistory() (imports []HistoryImport, err error) {
+	if cfg() == nil {
+		return nil, errors.New("the settings have not been loaded")
+	}
+	if cfg().Paper.Enabled {
+		return nil, ErrHistoryPaper
+	}
+	imported, err := importedAssets()
+	if err != nil {
+		return nil, err
+	}
+	pending := []string{}
+	for _, asset := range cfg().SupportedAssets {
+		if !imported[asset] {
+			pending = append(pending, asset)
+		}
+	}
+	if len(pending) == 0 && len(imported) > 0 {
+		return nil, ErrHistoryImported
+	}
+	before, err := ledgerStart()
+	if err != nil {
+		return nil, err
+	}
+	for _, asset := range pending {
+		cl, err := initClient(asset)
+		if err != nil {
+			return imports, fmt.Errorf("could not connect to the exchange to list the %s trades: %w", asset, err)
+		}
+		trades, err := cl.tradeHistory(before)
+		if err != nil {
+			return imports, fmt.Errorf("could not list the %s trades: %w", asset, err)
+		}
+		imp, err := importAsset(asset, trades)
+		if err != nil {
+			return imports, err
+		}
+		debugf("Imported the %s trade history. %s", asset, imp)
+		imports = append(imports, imp)
+	}
+	return imports, nil
+}
+
+// importedAssets returns the assets whose trade history has been imported.
+func importedAssets() (assets map[string]bool, err error) {
+	marks, err := profitEntries(profitHistory, false)
+	if err != nil {
+		return nil, err
+	}
+	assets = map[string]bool{}
+	for _, mark := range marks {
+		assets[mark.Asset] = true
+	}
+	return assets, nil
+}
+
+// importAsset imports the sales of `asset` in `trades` and marks the asset as imported. The sales saved by
+// an import of the asset that failed partway are removed first.
+func importAsset(asset string, trades []luno.Trade) (imp HistoryImport, err error) {
+	saved, err := profitEntries(profitImported, false)
+	if err != nil {
+		return imp, err
+	}
+	for _, entry := range saved {
+		// An entry without an order can not be removed on its own.
+		if entry.Asset != asset || entry.OrderID == "" {
+			continue
+		}
+		if err = deleteProfit(entry.OrderID); err != nil {
+			return imp, fmt.Errorf("could not remove the %s sales of an unfinished import: %w", asset, err)
+		}
+	}
+	if imp, err = importTrades(asset, trades); err != nil {
+		return imp, err
+	}
+	mark := ProfitEntry{Asset: asset, OrderID: "history-" + asset, Timestamp: time.Now().Format(timeFormat)}
+	if err = saveProfit(profitHistory, mark); err != nil {
+		return imp, fmt.Errorf("could not mark the %s trade history as imported: %w", asset, err)
+	}
+	return imp, nil
+}
+
+// ledgerStart returns the time of the first trade in the ledger, or the zero time if it has none.
+func ledgerStart() (start time.Time, err error) {
+	earliest := func(t time.Time, err error) {
+		if err == nil && (start.IsZero() || t.Before(start)) {
+			start = t
+		}
+	}
+	if !ledgerExists() {
+		return
+	}
+	records, err := sharedLedger.everyRecord()
+	if err != nil {
+		return
+	}
+	for _, rec := range records {
+		earliest(rec.Time())
+	}
+	closed, err := ClosedRecords("")
+	if err != nil {
+		return
+	}
+	for _, rec := range closed {
+		earliest(rec.Time())
+	}
+	for _, kind := range []string{profitSale, profitPurchase} {
+		for _, simulated := range []bool{false, true} {
+			entries, e := profitEntries(kind, simulated)
+			if e != nil {
+				return start, e
+			}
+			for _, entry := range entries {
+				earliest(Record{Timestamp: entry.Opened}.Time())
+				earliest(entry.Time())
+			}
+		}
+	}
+	return start, nil
+}
+
+// tradeHistory lists the trades of the client's pair made before `before`, or every trade if it is the
+// zero time, from the earliest.
+func (cl *Client) tradeHistory(before time.Time) (trades []luno.Trade, err error) {
+	req := luno.ListUserTradesRequest{Pair: cl.Pair, Since: luno.Time(historyStart), Limit: historyPageSize}
+	if !before.IsZero() {
+		req.Before = luno.Time(before)
+	}
+	for {
+		sleep() // Error 429 safety
+		res, err := cl.ListUserTrades(ctx, &req)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, res.Trades...)
+		if len(res.Trades) < historyPageSize {
+			break
+		}
+		// The sequence the trades are listed after is included.
+		req.AfterSeq = res.Trades[len(res.Trades)-1].Sequence + 1
+	}
+	sort.SliceStable(trades, func(i, j int) bool { return trades[i].Sequence < trades[j].Sequence })
+	return trades, nil
+}
+
+// historyLot is the part of a purchase that has not been sold yet.
+type historyLot struct {
+	volume, price float64
+	fee           float64 // Fee of the unsold volume, in fiat.
+	opened        time.Time
+}
+
+// importTrades matches the sales in `trades` with the earliest purchases before them and saves the profit
+// of each sale as an imported row.
+func importTrades(asset string, trades []luno.Trade) (imp HistoryImport, err error) {
+	imp.Asset, imp.Trades = asset, len(trades)
+	lots := []historyLot{}
+	for _, t := range trades {
+		base, counter, price := t.Base.Float64(), t.Counter.Float64(), t.Price.Float64()
+		if base <= 0 {
+			continue
+		}
+		fee := t.FeeCounter.Float64() + t.FeeBase.Float64()*price
+		if t.IsBuy {
+			lots = append(lots, historyLot{volume: base, price: price, fee: fee, opened: time.Time(t.Timestamp)})
+			continue
+		}
+		entry := ProfitEntry{Asset: asset, OrderID: t.OrderId, Timestamp: time.Time(t.Timestamp).Local().Format(timeFormat),
+			SalePrice: price}
+		remaining := base
+		for remaining > 1e-12 && len(lots) > 0 {
+			lot := &lots[0]
+			if entry.Opened == "" {
+				entry.Opened = lot.opened.Local().Format(timeFormat)
+			}
+			sold := math.Min(remaining, lot.volume)
+			share := sold / lot.volume
+			entry.PurchaseVolume += sold
+			entry.PurchaseCost += sold * lot.price
+			entry.Fees += lot.fee * share
+			lot.fee -= lot.fee * share
+			lot.volume -= sold
+			remaining -= sold
+			if lot.volume <= 1e-12 {
+				lots = lots[1:]
+			}
+		}
+		matched := base - remaining
+		imp.Unmatched += remaining
+		if matched <= 1e-12 {
+			continue
+		}
+		entry.PurchasePrice = entry.PurchaseCost / entry.PurchaseVolume
+		entry.SaleVolume = matched
+		entry.SaleCost = counter * matched / base
+		entry.Fees += fee * matched / base
+		entry.Profit = entry.SaleCost - entry.PurchaseCost
+		entry.NetProfit = entry.Profit - entry.Fees
+		if err = saveProfit(profitImported, entry); err != nil {
+			return imp, fmt.Errorf("could not save the imported %s sale %s: %w", asset, t.OrderId, err)
+		}
+		imp.Sales++
+		imp.Profit += entry.NetProfit
+	}
+	return imp, nil
+}
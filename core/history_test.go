@@ -0,0 +1,67 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/luno/luno-go"
+)
+
+// historyTrade returns a trade of one coin at `price` made `days` after the history starts.
+func historyTrade(orderID string, buy bool, price float64, days int) luno.Trade {
+	return luno.Trade{OrderId: orderID, IsBuy: buy, Base: decimal(1), Counter: decimal(price), Price: decimal(price),
+		FeeBase: decimal(0), FeeCounter: decimal(0), Timestamp: luno.Time(historyStart.AddDate(0, 0, days))}
+}
+
+// TestImportAssetResumes imports an asset whose previous import saved one of its sales before it failed,
+// and checks each sale is counted once and the asset is marked as imported.
+func TestImportAssetResumes(t *testing.T) {
+	useTempLedger(t)
+	trades := []luno.Trade{historyTrade("buy-1", true, 100, 0), historyTrade("sell-1", false, 120, 1),
+		historyTrade("buy-2", true, 110, 2), historyTrade("sell-2", false, 105, 3)}
+	// The failed import saved the first sale of XBT, and the import of ETH was finished.
+	if err := saveProfit(profitImported, ProfitEntry{Asset: "XBT", OrderID: "sell-1", Profit: 20, NetProfit: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveProfit(profitImported, ProfitEntry{Asset: "ETH", OrderID: "eth-sell", Profit: 5, NetProfit: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveProfit(profitHistory, ProfitEntry{Asset: "ETH", OrderID: "history-ETH"}); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := importedAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !imported["ETH"] || imported["XBT"] {
+		t.Fatalf("the imported assets are %v, want ETH only", imported)
+	}
+
+	imp, err := importAsset("XBT", trades)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imp.Sales != 2 || imp.Profit != 15 {
+		t.Errorf("imported %d sales for %v, want 2 for 15", imp.Sales, imp.Profit)
+	}
+	entries, err := profitEntries(profitImported, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profit := map[string]float64{}
+	for _, entry := range entries {
+		profit[entry.Asset] += entry.NetProfit
+	}
+	if len(entries) != 3 || profit["XBT"] != 15 || profit["ETH"] != 5 {
+		t.Errorf("the imported sales are %d for %v, want each sale of XBT once and the sale of ETH", len(entries), profit)
+	}
+	if imported, _ = importedAssets(); !imported["XBT"] || !imported["ETH"] {
+		t.Errorf("the imported assets are %v, want XBT and ETH", imported)
+	}
+	totals, err := assetTotals("XBT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Profit != 15 {
+		t.Errorf("the all time profit of XBT is %v, want 15", totals.Profit)
+	}
+}
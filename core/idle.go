@@ -0,0 +1,78 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `idle.go` skips the analysis of an asset whose market has not moved since it was last analyzed.
+*  Retrieving the candles takes one request for each of them, so reusing the previous signal while
+*  the price and the traded volume are flat saves most of the API calls made in quiet hours.
+ */
+
+import (
+	"math"
+	"sync"
+)
+
+// IdleSkipSettings configures the reuse of signals while a market is idle.
+type IdleSkipSettings struct {
+	Enabled bool
+	// PriceEpsilon is the largest change in price, as a fraction of the price at the last analysis,
+	// that counts as no change.
+	PriceEpsilon float64
+	// VolumeEpsilon is the largest change in the 24 hour traded volume, as a fraction of the volume
+	// at the last analysis, that counts as no change.
+	VolumeEpsilon float64
+	// MaxSkips is the number of rounds in a row an analysis may be skipped before the asset is
+	// analyzed again regardless. Zero does not limit the number of rounds.
+	MaxSkips int
+}
+
+// idleBaseline holds the market of an asset at its last analysis.
+type idleBaseline struct {
+	price, volume float64
+	signal        SIGNAL
+	confidence    float64
+	skips         int
+}
+
+var (
+	idleBaselines   = map[string]*idleBaseline{}
+	idleBaselinesMu sync.Mutex
+)
+
+// changedBy returns the change from `from` to `to` as a fraction of `from`.
+func changedBy(from, to float64) float64 {
+	if from == 0 {
+		if to == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(to-from) / from
+}
+
+// idleSignal returns the signal of the last analysis of the client's asset, and its confidence, if its
+// price and volume have not changed meaningfully since. `ok` is false if the asset should be analyzed.
+func idleSignal(cl *Client, price float64) (signal SIGNAL, confidence float64, ok bool) {
+	settings := cfg().Trade.IdleSkip
+	if !settings.Enabled {
+		return SignalWait, 0, false
+	}
+	idleBaselinesMu.Lock()
+	defer idleBaselinesMu.Unlock()
+	base := idleBaselines[cl.asset]
+	if base == nil || (settings.MaxSkips > 0 && base.skips >= settings.MaxSkips) {
+		return SignalWait, 0, false
+	}
+	if changedBy(base.price, price) > settings.PriceEpsilon || changedBy(base.volume, cl.volume) > settings.VolumeEpsilon {
+		return SignalWait, 0, false
+	}
+	base.skips++
+	return base.signal, base.confidence, true
+}
+
+// recordIdleBaseline saves the market of the client's asset at the analysis that emitted `signal`.
+func recordIdleBaseline(cl *Client, price float64, signal SIGNAL, confidence float64) {
+	idleBaselinesMu.Lock()
+	idleBaselines[cl.asset] = &idleBaseline{price: price, volume: cl.volume, signal: signal, confidence: confidence}
+	idleBaselinesMu.Unlock()
+}
@@ -0,0 +1,201 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `inflation.go` adjusts the profit of closed positions for inflation in the local currency. In
+*  high-inflation markets a nominal gain in NGN can be a loss in real terms. The adjustment uses a
+*  price (or FX) index supplied by the user or fetched from a URL, or a flat annual inflation rate.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoInflationIndex is returned when neither an index nor an annual rate has been set.
+var ErrNoInflationIndex = errors.New("no inflation index or rate has been set")
+
+// indexDateFormat is the format of the dates of an inflation index, i.e. one value per month.
+const indexDateFormat = "2006-01"
+
+// IndexPoint is the value of a price or FX index in a month, e.g. {"Date": "2021-03", "Value": 385.2}.
+type IndexPoint struct {
+	Date  string
+	Value float64
+}
+
+// InflationSettings configures the inflation-adjusted view of the stats.
+type InflationSettings struct {
+	Enabled bool
+	// AnnualRate is the yearly inflation rate used when there is no index, e.g. 0.17 for 17%.
+	AnnualRate float64
+	// Index holds monthly values of a price or FX index. It takes precedence over `AnnualRate`.
+	Index []IndexPoint
+	// IndexURL is fetched for a JSON list of index points. It takes precedence over `Index`.
+	IndexURL string
+}
+
+var (
+	fetchedIndex     []IndexPoint
+	indexFetchedAt   time.Time
+	fetchedIndexMu   sync.Mutex
+	indexRefreshTime = 24 * time.Hour
+)
+
+// fetchIndex retrieves the index at `config.Inflation.IndexURL`. The index is fetched at most once a day.
+func fetchIndex() ([]IndexPoint, error) {
+	fetchedIndexMu.Lock()
+	defer fetchedIndexMu.Unlock()
+	if len(fetchedIndex) > 0 && time.Since(indexFetchedAt) < indexRefreshTime {
+		return fetchedIndex, nil
+	}
+	client := http.Client{Timeout: 15 * time.Second}
+	res, err := client.Get(cfg().Inflation.IndexURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("inflation index: %s", res.Status)
+	}
+	points := []IndexPoint{}
+	if err = json.NewDecoder(res.Body).Decode(&points); err != nil {
+		return nil, err
+	}
+	fetchedIndex, indexFetchedAt = points, time.Now()
+	return points, nil
+}
+
+// inflationIndex returns the index points to adjust by, sorted by date, or nil if a flat rate is used.
+func inflationIndex() (points []IndexPoint, err error) {
+	settings := cfg().Inflation
+	points = settings.Index
+	if settings.IndexURL != "" {
+		if fetched, e := fetchIndex(); e == nil {
+			points = fetched
+		} else {
+			debugf("Could not fetch the inflation index. Reason: %v", e)
+		}
+	}
+	if len(points) == 0 && settings.AnnualRate == 0 {
+		return nil, ErrNoInflationIndex
+	}
+	sorted := make([]IndexPoint, 0, len(points))
+	for _, p := range points {
+		if _, e := time.Parse(indexDateFormat, p.Date); e == nil && p.Value > 0 {
+			sorted = append(sorted, p)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date < sorted[j].Date })
+	return sorted, nil
+}
+
+// indexAt returns the index value for the month of `t`. Months outside the index use its first or last value.
+func indexAt(points []IndexPoint, t time.Time) float64 {
+	month := t.Format(indexDateFormat)
+	value := points[0].Value
+	for _, p := range points {
+		if p.Date > month {
+			break
+		}
+		value = p.Value
+	}
+	return value
+}
+
+// inflationFactor returns how many units of currency at `to` buy what one unit bought at `from`.
+func inflationFactor(points []IndexPoint, from, to time.Time) float64 {
+	if len(points) > 0 {
+		return indexAt(points, to) / indexAt(points, from)
+	}
+	years := to.Sub(from).Hours() / (24 * 365)
+	return math.Pow(1+cfg().Inflation.AnnualRate, years)
+}
+
+// RealReturn holds the nominal and inflation-adjusted profit of closed positions. Amounts are in today's money.
+type RealReturn struct {
+	Asset          string
+	Positions      int
+	Cost           float64 // Nominal cost of opening the positions.
+	NominalProfit  float64
+	RealProfit     float64
+	NominalPercent float64
+	RealPercent    float64
+}
+
+// realProfit returns the profit of a closed position in today's money, after the currency spent to
+// open it has been adjusted for the inflation while it was held. `short` is true for short positions,
+// which are opened by the sale.
+func realProfit(points []IndexPoint, entry *ProfitEntry, short bool, now time.Time) (cost, real float64) {
+	closed, err := time.ParseInLocation(timeFormat, entry.Timestamp, time.Local)
+	if err != nil {
+		closed = now
+	}
+	opened, err := time.ParseInLocation(timeFormat, entry.Opened, time.Local)
+	if err != nil {
+		// Entries saved by older versions do not hold the opening time.
+		opened = closed
+	}
+	held := inflationFactor(points, opened, closed)
+	if short {
+		cost = entry.SaleCost
+		real = entry.SaleCost*held - entry.PurchaseCost
+	} else {
+		cost = entry.PurchaseCost
+		real = entry.SaleCost - entry.PurchaseCost*held
+	}
+	return cost, real * inflationFactor(points, closed, now)
+}
+
+// InflationAdjustedReturns returns the nominal and real profit of the recent closed positions of each
+// asset, and of all of them together under the asset "ALL".
+func InflationAdjustedReturns() (returns []RealReturn, err error) {
+	points, err := inflationIndex()
+	if err != nil {
+		return
+	}
+	sales, _ := GetSales()
+	purchases, _ := GetPurchases()
+	now := time.Now()
+	byAsset := map[string]*RealReturn{}
+	total := &RealReturn{Asset: "ALL"}
+	add := func(entry *ProfitEntry, short bool) {
+		ret, ok := byAsset[entry.Asset]
+		if !ok {
+			ret = &RealReturn{Asset: entry.Asset}
+			byAsset[entry.Asset] = ret
+		}
+		cost, real := realProfit(points, entry, short, now)
+		for _, r := range []*RealReturn{ret, total} {
+			r.Positions++
+			r.Cost += cost
+			r.NominalProfit += entry.Profit
+			r.RealProfit += real
+		}
+	}
+	for _, entry := range sales {
+		add(entry, false)
+	}
+	for _, entry := range purchases {
+		add(entry, true)
+	}
+	for _, asset := range cfg().SupportedAssets {
+		if ret, ok := byAsset[asset]; ok {
+			returns = append(returns, *ret)
+		}
+	}
+	returns = append(returns, *total)
+	for i := range returns {
+		if returns[i].Cost > 0 {
+			returns[i].NominalPercent = returns[i].NominalProfit / returns[i].Cost * 100
+			returns[i].RealPercent = returns[i].RealProfit / returns[i].Cost * 100
+		}
+	}
+	return
+}
@@ -0,0 +1,333 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `intents.go` makes order placement idempotent. Every order gets a client reference that is saved
+*  to file before the order is submitted. The reference is only confirmed once the order has been
+*  written to the ledger, so orders placed just before a crash are found and recorded at startup.
+ */
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	luno "github.com/luno/luno-go"
+)
+
+var (
+	// orderIntents is the journal of orders that have not been confirmed in the ledger.
+	orderIntents *IntentJournal
+	// intentMatchWindow is how far apart the creation times of an intent and an exchange order may be.
+	intentMatchWindow = 2 * time.Minute
+	// intentMatchTolerance is the relative difference allowed between the value of an intent and an exchange order.
+	intentMatchTolerance = 0.05
+)
+
+// OrderIntent holds the details of an order before it is submitted to the exchange.
+type OrderIntent struct {
+	Ref      string // Client order reference.
+	Pair     string
+	Asset    string
+	Side     luno.OrderType
+	Price    float64
+	Volume   float64
+	Type     OrderType // Type of the record opened by the order.
+	RecordID string    // ID of the ledger record closed by the order. Empty for orders that open a position.
+	ParentID string
+	OrderID  string // Exchange order ID, known once the exchange has accepted the order.
+	Quote    bool   // The order is placed through a quote and `OrderID` holds the quote ID.
+	Created  time.Time
+}
+
+// IntentJournal saves unconfirmed order intents to file.
+type IntentJournal struct {
+	mu      sync.Mutex
+	intents map[string]*OrderIntent
+	path    string
+}
+
+// NewIntentJournal creates a journal that saves intents to `path`. Previously saved intents are loaded.
+func NewIntentJournal(path string) *IntentJournal {
+	j := &IntentJournal{intents: map[string]*OrderIntent{}, path: path}
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		if err = json.NewDecoder(f).Decode(&j.intents); err != nil {
+			debugf("Could not load unconfirmed orders. Reason: %v", err)
+		}
+	}
+	if j.intents == nil {
+		j.intents = map[string]*OrderIntent{}
+	}
+	return j
+}
+
+// newClientRef returns a random client order reference.
+func newClientRef() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "LEP-" + time.Now().Format("20060102150405.000000")
+	}
+	return "LEP-" + hex.EncodeToString(b)
+}
+
+// Begin saves an intent before its order is submitted and returns its client reference.
+func (j *IntentJournal) Begin(intent OrderIntent) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	intent.Ref = newClientRef()
+	intent.Created = time.Now()
+	j.intents[intent.Ref] = &intent
+	j.save()
+	return intent.Ref
+}
+
+// Submitted stores the exchange order ID of an intent.
+func (j *IntentJournal) Submitted(ref, orderID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if intent, ok := j.intents[ref]; ok {
+		intent.OrderID = orderID
+		j.save()
+	}
+}
+
+// SubmittedQuote stores the ID of the quote an intent is being traded through.
+func (j *IntentJournal) SubmittedQuote(ref, quoteID string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if intent, ok := j.intents[ref]; ok {
+		intent.OrderID, intent.Quote = quoteID, true
+		j.save()
+	}
+}
+
+// Confirm removes an intent whose order has been recorded in the ledger, or was never placed.
+func (j *IntentJournal) Confirm(ref string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.intents[ref]; ok {
+		delete(j.intents, ref)
+		j.save()
+	}
+}
+
+// Unconfirmed returns copies of the unconfirmed intents for a pair.
+func (j *IntentJournal) Unconfirmed(pair string) (intents []OrderIntent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, intent := range j.intents {
+		if intent.Pair == pair {
+			intents = append(intents, *intent)
+		}
+	}
+	return
+}
+
+// save writes the journal to file. The caller must hold j.mu.
+func (j *IntentJournal) save() {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		debugf("Could not save unconfirmed orders. Reason: %v", err)
+		return
+	}
+	data, err := json.Marshal(j.intents)
+	if err == nil {
+		err = replaceFileSynced(j.path, data)
+	}
+	if err != nil {
+		debugf("Could not save unconfirmed orders. Reason: %v", err)
+	}
+}
+
+// beginIntent records an intent in the running bot's journal, if any.
+func beginIntent(intent OrderIntent) string {
+	if orderIntents == nil {
+		return ""
+	}
+	return orderIntents.Begin(intent)
+}
+
+// submitIntent stores the outcome of submitting an order. Orders rejected by the exchange are
+// dropped from the journal; any other error (e.g. a timeout) leaves the intent to be reconciled
+// at startup, since the order may still have reached the exchange.
+func submitIntent(ref, orderID string, err error) {
+	if orderIntents == nil || ref == "" {
+		return
+	}
+	if err != nil {
+		// The luno client prefixes every error response from the exchange with "luno:".
+		if strings.HasPrefix(err.Error(), "luno:") {
+			orderIntents.Confirm(ref)
+		}
+		return
+	}
+	orderIntents.Submitted(ref, orderID)
+}
+
+// submitQuote stores the ID of the quote an intent is being traded through.
+func submitQuote(ref, quoteID string) {
+	if orderIntents != nil && ref != "" {
+		orderIntents.SubmittedQuote(ref, quoteID)
+	}
+}
+
+// confirmIntent marks an intent as recorded in the ledger.
+func confirmIntent(ref string) {
+	if orderIntents != nil && ref != "" {
+		orderIntents.Confirm(ref)
+	}
+}
+
+// ReconcileIntents finds the exchange orders of unconfirmed intents for a client and records
+// them in the ledger. Intents without a matching order were never placed and are dropped.
+// Intents that can not be checked yet are kept for the next startup.
+func (bot *Bot) ReconcileIntents(cl *Client) {
+	if orderIntents == nil {
+		return
+	}
+	for _, intent := range orderIntents.Unconfirmed(cl.Pair) {
+		order, found, err := cl.findIntentOrder(intent)
+		if err != nil {
+			debugf("Could not reconcile order %s for %s. Reason: %v", intent.Ref, cl.Pair, err)
+			continue
+		}
+		if !found {
+			debugf("Order %s for %s never reached the exchange.", intent.Ref, cl.Pair)
+			orderIntents.Confirm(intent.Ref)
+			continue
+		}
+		if order.State == luno.OrderStatePending {
+			// Try again at the next startup once the order has settled.
+			continue
+		}
+		if err = bot.recordIntent(cl, intent, order); err != nil {
+			debugf("Could not record order %s for %s. Reason: %v", order.OrderId, cl.Pair, err)
+			continue
+		}
+		orderIntents.Confirm(intent.Ref)
+	}
+}
+
+// findIntentOrder looks up the exchange order of an intent.
+func (cl *Client) findIntentOrder(intent OrderIntent) (order luno.Order, found bool, err error) {
+	if intent.Quote && intent.OrderID != "" {
+		return cl.quoteOrder(intent.OrderID)
+	}
+	if intent.OrderID != "" {
+		details, err := cl.CheckOrder(intent.OrderID)
+		if err != nil {
+			return order, false, err
+		}
+		return luno.Order(details), true, nil
+	}
+	if time.Since(intent.Created) < intentMatchWindow {
+		// The order may not be listed yet.
+		return order, false, errors.New("the order is too recent to reconcile")
+	}
+	sleep() // Error 429 safety
+	req := luno.ListOrdersRequest{Pair: cl.Pair,
+		CreatedBefore: intent.Created.Add(intentMatchWindow).UnixNano() / int64(time.Millisecond)}
+	res, err := cl.ListOrders(ctx, &req)
+	if err != nil {
+		return
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	best := math.Inf(1)
+	for _, o := range res.Orders {
+		created := time.Time(o.CreationTimestamp)
+		if created.Before(intent.Created.Add(-intentMatchWindow)) || created.After(intent.Created.Add(intentMatchWindow)) {
+			continue
+		}
+		if !sameSide(o.Type, intent.Side) || orderRecorded(ledger, o.OrderId) {
+			continue
+		}
+		value := intent.Price * intent.Volume
+		diff := math.Abs(o.Counter.Float64()-value) / value
+		if o.Counter.Float64() == 0 {
+			diff = math.Abs(o.LimitVolume.Float64()-intent.Volume) / intent.Volume
+		}
+		if diff <= intentMatchTolerance && diff < best {
+			best, order, found = diff, o, true
+		}
+	}
+	return
+}
+
+// quoteOrder returns an exercised quote as an order. Quotes that were not exercised are not found.
+func (cl *Client) quoteOrder(quoteID string) (order luno.Order, found bool, err error) {
+	sleep() // Error 429 safety
+	res, err := cl.GetQuote(ctx, &luno.GetQuoteRequest{Id: stringToInt(quoteID)})
+	if err != nil || !res.Exercised {
+		return
+	}
+	order = luno.Order{OrderId: res.Id, Pair: res.Pair, State: luno.OrderStateComplete, Base: res.BaseAmount,
+		Counter: res.CounterAmount, CreationTimestamp: res.CreatedAt, CompletedTimestamp: res.CreatedAt}
+	return order, true, nil
+}
+
+// recordIntent writes a reconciled order to the ledger.
+func (bot *Bot) recordIntent(cl *Client, intent OrderIntent, order luno.Order) error {
+	volume, counter := order.Base.Float64(), order.Counter.Float64()
+	if volume == 0 {
+		// The order was not filled.
+		return nil
+	}
+	price := counter / volume
+	ts := time.Time(order.CompletedTimestamp).Format(timeFormat)
+	if intent.RecordID == "" {
+		rec := NewRecord(cl.asset, price, ts, volume, order.OrderId, intent.Type)
+		rec.Cost = counter
+		rec.LunoAssetFee, rec.LunoFiatFee = order.FeeBase.Float64(), order.FeeCounter.Float64()
+		debugf("Recording order %s for %s placed before Leprechaun stopped.", order.OrderId, cl.Pair)
+		return bot.addRecordToLedger(rec)
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	rec, err := ledger.GetRecordByID(intent.RecordID)
+	if err == sql.ErrNoRows {
+		// The position was closed before Leprechaun stopped.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	debugf("Closing record %s with order %s placed before Leprechaun stopped.", rec.ID, order.OrderId)
+	journalClose(rec, order.OrderId, price, volume)
+	fees := rec.Fees() + order.FeeCounter.Float64() + order.FeeBase.Float64()*price
+	if rec.Type == LongOrder {
+		err = NewSale(cl.asset, order.OrderId, rec.ParentID, rec.Timestamp, ts, rec.Price, rec.Volume, price, volume, fees)
+	} else {
+		err = NewPurchase(cl.asset, order.OrderId, rec.ParentID, rec.Timestamp, ts, rec.Price, rec.Volume, price, volume, fees)
+	}
+	if err != nil {
+		return err
+	}
+	return ledger.CloseRecord(rec.ID, order.OrderId, ts, price, volume)
+}
+
+// sameSide returns true if an order type listed by the exchange is on the same side as `side`.
+func sameSide(listed, side luno.OrderType) bool {
+	if side == luno.OrderTypeBuy {
+		return listed == luno.OrderTypeBuy || listed == luno.OrderTypeBid
+	}
+	return listed == luno.OrderTypeSell || listed == luno.OrderTypeAsk
+}
+
+// orderRecorded returns true if an order is already held in the ledger, whole or as take-profit tranches.
+func orderRecorded(ledger *Ledger, orderID string) bool {
+	if _, err := ledger.GetRecordByID(orderID); err == nil {
+		return true
+	}
+	children, err := ledger.GetChildRecords(orderID)
+	return err == nil && len(children) > 0
+}
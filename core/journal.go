@@ -0,0 +1,312 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `journal.go` keeps a journal of every executed trade. Each order that opens or closes a position is
+*  saved with the context it was placed in: the signal and the plugin's confidence in it, the scores of
+*  the indicators behind it and the bid-ask spread at the time. Unlike the ledger, which forgets a
+*  position once it is closed, the journal keeps every trade, and the user can annotate each with notes
+*  to review later. Paper trades have a journal of their own.
+*  The journal is kept in an SQLite file next to the ledger, or in a bbolt file if the ledger is kept in one
+*  or the build has no SQLite driver.
+ */
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const journalInit = `
+CREATE TABLE IF NOT EXISTS JOURNAL (
+	ID INTEGER PRIMARY KEY AUTOINCREMENT,
+	TIME INTEGER NOT NULL,
+	ASSET TEXT NOT NULL,
+	ORDER_ID TEXT NOT NULL UNIQUE,
+	POSITION_ID TEXT NOT NULL,
+	ACTION TEXT NOT NULL,
+	TYPE TEXT NOT NULL,
+	PRICE REAL NOT NULL,
+	VOLUME REAL NOT NULL,
+	PROFIT REAL NOT NULL DEFAULT 0,
+	SIGNAL TEXT NOT NULL DEFAULT '',
+	CONFIDENCE REAL NOT NULL DEFAULT 0,
+	SPREAD REAL NOT NULL DEFAULT 0,
+	SCORES TEXT NOT NULL DEFAULT '',
+	SIMULATED INTEGER NOT NULL DEFAULT 0,
+	NOTES TEXT NOT NULL DEFAULT ''
+);`
+
+const journalColumns = "ID, TIME, ASSET, ORDER_ID, POSITION_ID, ACTION, TYPE, PRICE, VOLUME, PROFIT, SIGNAL, CONFIDENCE, SPREAD, SCORES, SIMULATED, NOTES"
+
+// Actions of the trades in the journal.
+const (
+	JournalOpen  = "open"
+	JournalClose = "close"
+)
+
+// ErrNoJournalEntry is returned when a journal entry to annotate does not exist.
+var ErrNoJournalEntry = errors.New("no such journal entry")
+
+// JournalEntry is an executed trade and the context it was placed in.
+type JournalEntry struct {
+	ID   int64
+	Time time.Time
+	// Asset is the code of the traded asset, e.g. "XBT".
+	Asset string
+	// OrderID is the ID of the order, and PositionID that of the position it opened or closed.
+	OrderID, PositionID string
+	// Action is `JournalOpen` or `JournalClose`.
+	Action string
+	// Type is the type of the position the order opened or closed.
+	Type          OrderType
+	Price, Volume float64
+	// Profit is the fiat profit of a closed position. It is zero for orders that opened a position.
+	Profit float64
+	// Signal and Confidence are those of the last analysis of the asset before the order was placed.
+	Signal     SIGNAL
+	Confidence float64
+	// Spread is the bid-ask spread at the time of that analysis.
+	Spread float64
+	// Scores are the indicators behind the signal, if the plugin explains its signals.
+	Scores []IndicatorScore
+	// Simulated reports whether the order was filled by the dry run simulator.
+	Simulated bool
+	// Notes are the user's annotations.
+	Notes string
+}
+
+// journalStore keeps the journal of a trading mode.
+type journalStore interface {
+	// add saves `entry`, unless an entry of its order was saved before.
+	add(entry JournalEntry) error
+	// entries returns the entries whose asset, order or position ID, signal or notes contain `query`,
+	// which is in lower case, from the latest.
+	entries(query string) ([]JournalEntry, error)
+	// annotate replaces the notes of the entry `id`, or returns ErrNoJournalEntry if there is none.
+	annotate(id int64, notes string) error
+	// copyTo writes a consistent copy of the journal to `dest`, e.g. for a backup.
+	copyTo(dest string) error
+	Close() error
+}
+
+var (
+	journalMu sync.Mutex
+	journalDB journalStore
+	// journalDBPath is the path of the open journal, so a new one is opened when paper trading is toggled.
+	journalDBPath string
+)
+
+// journalPath returns the path of the journal of the current trading mode.
+func journalPath() string {
+	if boltStores() {
+		return filepath.Join(dataDir(), "journal.bolt")
+	}
+	return filepath.Join(dataDir(), "journal.db")
+}
+
+// openJournal returns the journal of the current trading mode, opening and initializing it the first
+// time it is used. The caller must hold `journalMu`.
+func openJournal() (journalStore, error) {
+	if cfg() == nil {
+		return nil, errors.New("the settings have not been loaded")
+	}
+	path := journalPath()
+	if journalDB != nil && journalDBPath == path {
+		return journalDB, nil
+	}
+	closeJournal()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	open := openSQLJournal
+	if boltStores() {
+		open = openBoltJournal
+	}
+	store, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	journalDB, journalDBPath = store, path
+	return store, nil
+}
+
+// closeJournal closes the open journal, if any. It is opened again when it is next used. The caller must
+// hold `journalMu`.
+func closeJournal() {
+	if journalDB != nil {
+		journalDB.Close()
+		journalDB = nil
+	}
+}
+
+// copyJournal writes a consistent copy of the journal of the current trading mode to `dest`.
+func copyJournal(dest string) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	store, err := openJournal()
+	if err != nil {
+		return err
+	}
+	return store.copyTo(dest)
+}
+
+// journalTrade saves an executed order in the journal with `snap`, or the last analysis of its asset if
+// it is nil. An order that is journaled again, e.g. by the reconciliation of an order placed before a
+// restart, is saved once. Failures are only logged, as the journal must never hold up trading.
+func journalTrade(entry JournalEntry, snap *AnalysisSnapshot) {
+	if snap == nil {
+		snap = analysisOf(entry.Asset)
+	}
+	if snap != nil {
+		entry.Signal, entry.Confidence, entry.Spread, entry.Scores = snap.Signal, snap.Confidence, snap.Spread, snap.Scores
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Simulated = simulatedOrder(entry.OrderID)
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	store, err := openJournal()
+	if err != nil {
+		debugf("Could not open the trade journal: %v", err)
+		return
+	}
+	if err = store.add(entry); err != nil {
+		debugf("Could not save order %s in the trade journal: %v", entry.OrderID, err)
+	}
+}
+
+// journalOpen saves the order that opened `rec` in the journal.
+func journalOpen(rec Record) {
+	t, err := rec.Time()
+	if err != nil {
+		t = time.Now()
+	}
+	journalTrade(JournalEntry{Time: t, Asset: rec.Asset, OrderID: rec.ID, PositionID: rec.ID, Action: JournalOpen,
+		Type: rec.Type, Price: rec.Price, Volume: rec.Volume}, rec.Analysis)
+}
+
+// journalClose saves the order `orderID` that closed `rec` for `volume` at `price` in the journal.
+func journalClose(rec Record, orderID string, price, volume float64) {
+	profit := price*volume - rec.Price*rec.Volume
+	if rec.Type == ShortOrder {
+		profit = -profit
+	}
+	journalTrade(JournalEntry{Asset: rec.Asset, OrderID: orderID, PositionID: rec.ID, Action: JournalClose,
+		Type: rec.Type, Price: price, Volume: volume, Profit: profit}, nil)
+}
+
+// JournalEntries returns the trades in the journal whose asset, order or position ID, signal or notes
+// contain `query`, ignoring case, from the latest. An empty query returns every trade.
+func JournalEntries(query string) (entries []JournalEntry, err error) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	store, err := openJournal()
+	if err != nil {
+		return nil, err
+	}
+	return store.entries(strings.ToLower(strings.TrimSpace(query)))
+}
+
+// AnnotateJournal replaces the notes of the journal entry `id`.
+func AnnotateJournal(id int64, notes string) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	store, err := openJournal()
+	if err != nil {
+		return err
+	}
+	return store.annotate(id, notes)
+}
+
+// sqlJournal keeps the journal in an SQLite file.
+type sqlJournal struct {
+	db *sql.DB
+}
+
+// openSQLJournal opens the SQLite journal at `path`, creating it if it does not exist.
+func openSQLJournal(path string) (journalStore, error) {
+	if !sqliteAvailable {
+		return nil, fmt.Errorf("%w (%q)", ErrStorageUnavailable, SQLiteStorage)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(journalInit); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlJournal{db: db}, nil
+}
+
+func (j *sqlJournal) add(entry JournalEntry) error {
+	scores := ""
+	if len(entry.Scores) > 0 {
+		if data, err := json.Marshal(entry.Scores); err == nil {
+			scores = string(data)
+		}
+	}
+	_, err := j.db.Exec(`INSERT OR IGNORE INTO JOURNAL (TIME, ASSET, ORDER_ID, POSITION_ID, ACTION, TYPE, PRICE, VOLUME,
+		PROFIT, SIGNAL, CONFIDENCE, SPREAD, SCORES, SIMULATED) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Time.Unix(), entry.Asset, entry.OrderID, entry.PositionID, entry.Action, string(entry.Type), entry.Price,
+		entry.Volume, entry.Profit, string(entry.Signal), entry.Confidence, entry.Spread, scores, entry.Simulated)
+	return err
+}
+
+func (j *sqlJournal) entries(query string) (entries []JournalEntry, err error) {
+	like := "%" + query + "%"
+	rows, err := j.db.Query(`SELECT `+journalColumns+` FROM JOURNAL WHERE lower(ASSET) LIKE ? OR lower(ORDER_ID) LIKE ?
+		OR lower(POSITION_ID) LIKE ? OR lower(SIGNAL) LIKE ? OR lower(NOTES) LIKE ? ORDER BY TIME DESC, ID DESC`,
+		like, like, like, like, like)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			entry                     JournalEntry
+			timestamp                 int64
+			orderType, signal, scores string
+		)
+		if err = rows.Scan(&entry.ID, &timestamp, &entry.Asset, &entry.OrderID, &entry.PositionID, &entry.Action, &orderType,
+			&entry.Price, &entry.Volume, &entry.Profit, &signal, &entry.Confidence, &entry.Spread, &scores, &entry.Simulated,
+			&entry.Notes); err != nil {
+			return nil, err
+		}
+		entry.Time, entry.Type, entry.Signal = time.Unix(timestamp, 0), OrderType(orderType), SIGNAL(signal)
+		if scores != "" {
+			// The scores are informational. An entry is still usable without them.
+			json.Unmarshal([]byte(scores), &entry.Scores)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (j *sqlJournal) annotate(id int64, notes string) error {
+	res, err := j.db.Exec("UPDATE JOURNAL SET NOTES = ? WHERE ID = ?", notes, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNoJournalEntry
+	}
+	return nil
+}
+
+func (j *sqlJournal) copyTo(dest string) error {
+	_, err := j.db.Exec("VACUUM INTO ?", dest)
+	return err
+}
+
+func (j *sqlJournal) Close() error {
+	return j.db.Close()
+}
@@ -0,0 +1,136 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `journal_bolt.go` keeps the trade journal in a bbolt file, for ledgers kept in bbolt and builds without
+*  the SQLite driver. The entries are JSON keyed by their IDs, which count up in the order they were added,
+*  and a second bucket maps each order to its entry, so an order is journaled once.
+ */
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of a bbolt journal.
+var (
+	boltJournal       = []byte("journal")
+	boltJournalOrders = []byte("orders")
+)
+
+// boltJournalStore keeps the journal in a bbolt file.
+type boltJournalStore struct {
+	db *bolt.DB
+}
+
+// openBoltJournal opens the bbolt journal at `path`, creating it if it does not exist.
+func openBoltJournal(path string) (journalStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltJournal, boltJournalOrders} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltJournalStore{db: db}, nil
+}
+
+// journalKey returns the key of the entry `id`.
+func journalKey(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+func (j *boltJournalStore) add(entry JournalEntry) error {
+	return j.db.Update(func(tx *bolt.Tx) error {
+		orders := tx.Bucket(boltJournalOrders)
+		if orders.Get([]byte(entry.OrderID)) != nil {
+			return nil
+		}
+		journal := tx.Bucket(boltJournal)
+		id, err := journal.NextSequence()
+		if err != nil {
+			return err
+		}
+		// Times are kept to the second, as in the SQLite journal.
+		entry.ID, entry.Time = int64(id), time.Unix(entry.Time.Unix(), 0)
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err = journal.Put(journalKey(entry.ID), data); err != nil {
+			return err
+		}
+		return orders.Put([]byte(entry.OrderID), journalKey(entry.ID))
+	})
+}
+
+func (j *boltJournalStore) entries(query string) (entries []JournalEntry, err error) {
+	err = j.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltJournal).ForEach(func(_, data []byte) error {
+			var entry JournalEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			for _, field := range []string{entry.Asset, entry.OrderID, entry.PositionID, string(entry.Signal), entry.Notes} {
+				if strings.Contains(strings.ToLower(field), query) {
+					entries = append(entries, entry)
+					break
+				}
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(entries, func(i, k int) bool {
+		if !entries[i].Time.Equal(entries[k].Time) {
+			return entries[i].Time.After(entries[k].Time)
+		}
+		return entries[i].ID > entries[k].ID
+	})
+	return
+}
+
+func (j *boltJournalStore) annotate(id int64, notes string) error {
+	return j.db.Update(func(tx *bolt.Tx) error {
+		journal := tx.Bucket(boltJournal)
+		data := journal.Get(journalKey(id))
+		if data == nil {
+			return ErrNoJournalEntry
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		entry.Notes = notes
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return journal.Put(journalKey(id), data)
+	})
+}
+
+func (j *boltJournalStore) copyTo(dest string) error {
+	return j.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(dest, 0644)
+	})
+}
+
+func (j *boltJournalStore) Close() error {
+	return j.db.Close()
+}
@@ -4,349 +4,399 @@ package core
 *  @author: Michael Lormann
  */
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"os"
-	"path/filepath"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"database/sql"
-	// go-sqlite3 is imported for its side-effect of loading the sqlite3 driver.
-	_ "github.com/mattn/go-sqlite3"
 )
 
-// Ledger object stores records of purchased assets in a sql database.
+// Ledger object stores records of purchased assets in the storage backend chosen in the settings.
+// Every handle of a ledger uses the same long-lived storage, so handles are cheap and may be used by
+// several goroutines at once.
 type Ledger struct {
+	// databasePath is the path of the ledger. If it is empty, the ledger of the current trading mode is used.
 	databasePath string
-	db           *sql.DB
-	isOpen       bool
+	// ctx is the context the queries of the ledger run in. If it is nil, they run in the bot's context.
+	ctx context.Context
+}
+
+// sharedLedger is the ledger handle returned by `bot.Ledger`.
+var sharedLedger = &Ledger{}
+
+// ledgerTimeout bounds each query of the ledger, so a locked or unreachable database can not hold up
+// trading for good.
+const ledgerTimeout = 30 * time.Second
+
+// recordColumns lists the columns of the RECORDS table in the order they are scanned by `scanRows`,
+// with their types and the values NULLs left by older versions are read as.
+var recordColumns = []struct {
+	name, kind, zero string
+}{
+	{"ASSET", "TEXT", "''"},
+	{"COST", "REAL", "0"},
+	{"ID", "TEXT", "''"},
+	{"PRICE", "REAL", "0"},
+	{"SALE_ID", "TEXT", "''"},
+	{"SOLD", "INTEGER", "0"},
+	{"STATUS", "TEXT", "''"},
+	{"TIMESTAMP", "TEXT", "''"},
+	{"VOLUME", "REAL", "0"},
+	{"TYPE", "TEXT", "''"},
+	{"TRIGGER_PRICE", "REAL", "0"},
+	{"PARENT_ID", "TEXT", "''"},
+	{"REQUESTED_VOLUME", "REAL", "0"},
+	{"CLIENT_REF", "TEXT", "''"},
+	{"ASSET_FEE", "REAL", "0"},
+	{"FIAT_FEE", "REAL", "0"},
+	{"ANALYSIS", "TEXT", "''"},
+	{"SIMULATED", "INTEGER", "0"},
+}
+
+// recordsTable returns the statement that creates a table of records named `name` with typed columns.
+func recordsTable(name string) string {
+	columns := []string{}
+	for _, c := range recordColumns {
+		columns = append(columns, fmt.Sprintf("%s %s NOT NULL DEFAULT %s", c.name, c.kind, c.zero))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(columns, ", "))
+}
+
+// recordColumnList returns the names of the columns of the RECORDS table, separated by commas.
+func recordColumnList() string {
+	names := []string{}
+	for _, c := range recordColumns {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, ", ")
 }
 
 // SQLITE operations.
 var (
-	sqlDatabaseName        = "Leprechaun.Ledger"
-	databaseInit    string = "CREATE TABLE RECORDS (ASSET, COST, ID, PRICE, SALE_ID, SOLD, STATUS, TIMESTAMP, VOLUME, TYPE, TRIGGER_PRICE)"
-	recordInsert           = "INSERT INTO RECORDS VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
-	idSearch        string = "SELECT * FROM RECORDS WHERE ID = ?"
-	// abs(PRICE) + abs(PRICE) * `margin` adjusts the price by profit margin provided.
-	// E.g. to adjust a price of 2_000_000 by a 1% margin, we have 2_000_000 + 2_000_000 * 0.01 =
-	// giving an adjusted price of 2_020_000
-	viableRecordSearch = "SELECT * FROM RECORDS WHERE ASSET = ? AND abs(PRICE) + abs(PRICE) * ? < ?"
-	getAllRecordsOp    = "SELECT * FROM RECORDS"
-	typeSearchOp       = "SELECT * FROM RECORDS WHERE ASSET = ? AND TYPE = ?"
-	deleteRecordOp     = "DELETE FROM RECORDS WHERE ID = ?"
+	sqlDatabaseName = "Leprechaun.Ledger"
+	databaseInit    = recordsTable("RECORDS")
+	// ledgerIndexes speed up looking records up by ID and by asset and type, which is done every round.
+	ledgerIndexes = []string{
+		"CREATE INDEX IF NOT EXISTS RECORDS_ID ON RECORDS (ID)",
+		"CREATE INDEX IF NOT EXISTS RECORDS_ASSET_TYPE ON RECORDS (ASSET, TYPE)",
+	}
+	recordInsert     = "INSERT INTO RECORDS (" + recordColumnList() + ") VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	tableInfoOp      = "PRAGMA table_info(RECORDS)"
+	recordSelect     = "SELECT " + recordColumnList() + " FROM RECORDS"
+	idSearch         = recordSelect + " WHERE ID = ?"
+	deleteRecordOp   = "DELETE FROM RECORDS WHERE ID = ?"
+	updateVolumeOp   = "UPDATE RECORDS SET VOLUME = ?, COST = ? WHERE ID = ?"
+	updatePositionOp = "UPDATE RECORDS SET PRICE = ?, VOLUME = ?, COST = ?, TRIGGER_PRICE = ?, REQUESTED_VOLUME = ?, ASSET_FEE = ?, FIAT_FEE = ? WHERE ID = ?"
 )
 
-// Ledger returns a new ledger handle
+// ledgerMigrations lists columns that were added to the RECORDS table after its first release.
+// Ledgers created by older versions of Leprechaun are upgraded on load.
+var ledgerMigrations = []struct {
+	column, definition string
+}{
+	{"PARENT_ID", "ALTER TABLE RECORDS ADD COLUMN PARENT_ID DEFAULT ''"},
+	{"REQUESTED_VOLUME", "ALTER TABLE RECORDS ADD COLUMN REQUESTED_VOLUME DEFAULT 0"},
+	{"CLIENT_REF", "ALTER TABLE RECORDS ADD COLUMN CLIENT_REF DEFAULT ''"},
+	{"ASSET_FEE", "ALTER TABLE RECORDS ADD COLUMN ASSET_FEE DEFAULT 0"},
+	{"FIAT_FEE", "ALTER TABLE RECORDS ADD COLUMN FIAT_FEE DEFAULT 0"},
+	{"ANALYSIS", "ALTER TABLE RECORDS ADD COLUMN ANALYSIS DEFAULT ''"},
+	{"SIMULATED", "ALTER TABLE RECORDS ADD COLUMN SIMULATED DEFAULT 0"},
+}
+
+// Ledger returns the handle of the ledger of the current trading mode. The handle is shared, and stays
+// open while Leprechaun runs.
 func (bot *Bot) Ledger() (l *Ledger) {
-	l = &Ledger{databasePath: config.LedgerDatabase}
-	l.loadDatabase()
-	return
+	sharedLedger.loadDatabase()
+	return sharedLedger
+}
+
+// WithContext returns a handle of the ledger whose queries are cancelled with `c`.
+func (l *Ledger) WithContext(c context.Context) *Ledger {
+	return &Ledger{databasePath: l.databasePath, ctx: c}
+}
+
+// open returns the storage of the ledger and a context that bounds its queries. `done` must be called
+// once the queries are over.
+func (l *Ledger) open() (store Storage, c context.Context, done context.CancelFunc, err error) {
+	path := l.databasePath
+	if path == "" {
+		path = ledgerPath()
+	}
+	if store, err = sharedStorage(path); err != nil {
+		return nil, nil, nil, err
+	}
+	parent := l.ctx
+	if parent == nil {
+		parent = ctx
+	}
+	// The transaction is counted until `done` is called, so Leprechaun does not exit in the middle of it.
+	end := beginOperation()
+	c, cancel := context.WithTimeout(parent, ledgerTimeout)
+	done = func() {
+		cancel()
+		end()
+	}
+	return store, c, done, nil
 }
 
 // ViableRecords checks the database for any records whose prices are lower
 // (beyond a certain `margin`) than the value of `price`.
 func (l *Ledger) ViableRecords(asset string, price float64) (records []Record, err error) {
 	// TODO:: Include margin test in viable records check
-	if !l.isOpen {
-		l.loadDatabase()
-	}
-	tx, err := l.db.Begin()
-	if err != nil {
-		return
-	}
-	stmt, err := l.db.Prepare(viableRecordSearch)
-	if err != nil {
-		return
-	}
-	defer stmt.Close()
-	margin := config.ProfitMargin
-	rows, err := stmt.Query(asset, margin, price)
+	store, c, done, err := l.open()
 	if err != nil {
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		rec := Record{}
-		err = scanRows(rows, rec)
-		if err != nil {
-			return
+	defer done()
+	open, err := store.Records(c, RecordFilter{Asset: asset})
+	for _, rec := range open {
+		// abs(PRICE) + abs(PRICE) * `margin` adjusts the price by profit margin provided.
+		// E.g. to adjust a price of 2_000_000 by a 1% margin, we have 2_000_000 + 2_000_000 * 0.01 =
+		// giving an adjusted price of 2_020_000
+		if math.Abs(rec.Price)+math.Abs(rec.Price)*cfg().ProfitMargin < price {
+			records = append(records, rec)
 		}
-		records = append(records, rec)
 	}
-	tx.Commit()
 	return
 }
 
-func scanRows(rows *sql.Rows, rec Record) (err error) {
-	err = rows.Scan(&rec.Asset, &rec.Cost, &rec.ID, &rec.Price, &rec.SaleID, &rec.Sold, &rec.Status, &rec.Timestamp, &rec.Volume, &rec.Type, &rec.TriggerPrice)
-	return err
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-// GetRecordByID returns a record from the database with the `id` provided.
-func (l *Ledger) GetRecordByID(id string) (rec Record, err error) {
-	rec = Record{}
-	if !l.isOpen {
-		l.loadDatabase()
+// scanRows reads a row selected with `recordSelect` into `rec`.
+func scanRows(rows rowScanner, rec *Record) (err error) {
+	var analysis string
+	err = rows.Scan(&rec.Asset, &rec.Cost, &rec.ID, &rec.Price, &rec.SaleID, &rec.Sold, &rec.Status, &rec.Timestamp, &rec.Volume, &rec.Type, &rec.TriggerPrice, &rec.ParentID, &rec.RequestedVolume,
+		&rec.ClientRef, &rec.LunoAssetFee, &rec.LunoFiatFee, &analysis, &rec.Simulated)
+	if err != nil || analysis == "" {
+		return err
 	}
-	tx, err := l.db.Begin()
-	if err != nil {
-		return
+	rec.Analysis = &AnalysisSnapshot{}
+	if json.Unmarshal([]byte(analysis), rec.Analysis) != nil {
+		// The snapshot is informational. A record is still usable without it.
+		rec.Analysis = nil
 	}
-	stmt, err := l.db.Prepare(idSearch)
+	return nil
+}
+
+// encodeAnalysis returns the analyzer snapshot of a record as saved in the ledger.
+func encodeAnalysis(rec Record) string {
+	if rec.Analysis == nil {
+		return ""
+	}
+	data, err := json.Marshal(rec.Analysis)
 	if err != nil {
-		return
+		return ""
 	}
-	defer stmt.Close()
-	err = stmt.QueryRow(id).Scan(&rec.Asset, &rec.Cost, &rec.ID, &rec.Price, &rec.SaleID, &rec.Sold, &rec.Status, &rec.Timestamp, &rec.Volume, &rec.Type, &rec.TriggerPrice)
+	return string(data)
+}
+
+// GetRecordByID returns a record from the database with the `id` provided.
+func (l *Ledger) GetRecordByID(id string) (rec Record, err error) {
+	store, c, done, err := l.open()
 	if err != nil {
 		return
 	}
-	tx.Commit()
-	debugf("%#v\n", rec)
-
-	return
+	defer done()
+	return store.Record(c, id)
 }
 
 // DeleteRecord removes the record with the provided `ID` from the ledger.
 func (l *Ledger) DeleteRecord(id string) (err error) {
-	if !l.isOpen {
-		l.loadDatabase()
-	}
-	tx, err := l.db.Begin()
-	if err != nil {
-		return
-	}
-	stmt, err := l.db.Prepare(deleteRecordOp)
-	defer stmt.Close()
+	store, c, done, err := l.open()
 	if err != nil {
 		return
 	}
-	res, err := stmt.Exec(id)
-	if err != nil {
+	defer done()
+	if err = store.DeleteRecord(c, id); err != nil {
 		return
 	}
-	log.Printf("delete op: %v for record with id %s", res, id)
-	tx.Commit()
+	log.Printf("delete op for record with id %s", id)
 	return
 }
 
-// GetRecordsByType retrieves records in the ledger by order type
-func (l *Ledger) GetRecordsByType(asset string, orderType OrderType) (records []Record, err error) {
-	if !l.isOpen {
-		l.loadDatabase()
-	}
-	tx, err := l.db.Begin()
+// UpdateVolume changes the volume and cost of the record with the provided `ID`, e.g. after
+// its order was cancelled before it was completely filled.
+func (l *Ledger) UpdateVolume(id string, volume, cost float64) (err error) {
+	store, c, done, err := l.open()
 	if err != nil {
 		return
 	}
-	stmt, err := l.db.Prepare(typeSearchOp)
-	if err != nil {
-		return records, nil
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(asset, orderType)
+	defer done()
+	return store.UpdateVolume(c, id, volume, cost)
+}
+
+// UpdatePosition saves the price, volume, requested volume, cost, trigger price and fees of a record,
+// e.g. after more of its asset was bought at a different price.
+func (l *Ledger) UpdatePosition(rec Record) (err error) {
+	store, c, done, err := l.open()
 	if err != nil {
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		rec := Record{}
-		err = scanRows(rows, rec)
-		if err != nil {
-			return
-		}
-		records = append(records, rec)
-	}
-	tx.Commit()
-	return
+	defer done()
+	return store.UpdatePosition(c, rec)
 }
 
-// AllRecords returns all purchase records stored in the ledger.
+// GetRecordsByType retrieves records in the ledger by order type. Like `AllRecords`, it only returns
+// the records of the current mode.
+func (l *Ledger) GetRecordsByType(asset string, orderType OrderType) (records []Record, err error) {
+	records, err = l.records(RecordFilter{Asset: asset, Type: orderType})
+	return forMode(records), err
+}
+
+// AllRecords returns the records stored in the ledger that were opened in the current mode: simulated
+// records in a dry run and real records otherwise.
 func (l *Ledger) AllRecords() (records []Record, err error) {
-	if !l.isOpen {
-		l.loadDatabase()
-	}
-	tx, err := l.db.Begin()
-	if err != nil {
-		return
-	}
-	stmt, err := l.db.Prepare(getAllRecordsOp)
-	if err != nil {
-		return
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query()
+	records, err = l.everyRecord()
+	return forMode(records), err
+}
+
+// everyRecord returns every record stored in the ledger, simulated or not.
+func (l *Ledger) everyRecord() (records []Record, err error) {
+	return l.records(RecordFilter{})
+}
+
+// records returns the records that match `filter`, simulated or not.
+func (l *Ledger) records(filter RecordFilter) (records []Record, err error) {
+	store, c, done, err := l.open()
 	if err != nil {
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		rec := Record{}
-		err = scanRows(rows, rec)
-		if err != nil {
-			return
-		}
-		records = append(records, rec)
-	}
-	tx.Commit()
-	return
+	defer done()
+	return store.Records(c, filter)
 }
 
 // AddRecord adds a `Record` to the database.
 func (l *Ledger) AddRecord(rec Record) (err error) {
-	if !l.isOpen {
-		l.loadDatabase()
-	}
-	debug("New Record: ", fmt.Sprintf("%+v", rec))
-	tx, err := l.db.Begin()
-	if err != nil {
-		return
-	}
-	stmt, err := tx.Prepare(recordInsert)
+	store, c, done, err := l.open()
 	if err != nil {
 		return
 	}
-	defer stmt.Close()
-	_, err = stmt.Exec(rec.Asset, rec.Cost, rec.ID, rec.Price, rec.SaleID, rec.Sold, rec.Status, rec.Timestamp, rec.Volume, rec.Type, rec.Timestamp)
-	if err != nil {
+	defer done()
+	debug("New Record: ", fmt.Sprintf("%+v", rec))
+	if err = store.AddRecord(c, rec); err != nil {
 		// log.Fatal(err)
 		debugf("Fatal error! could not add new record with id %s to the ledger. Check the luno order book for your order's details", rec.ID)
 		return err
 	}
-	tx.Commit()
 	return
 }
 
-// Save closese the database. Must be called by any external user of the ledger.
+// Save releases the handle. The storage of the ledger is shared by every handle, and stays open until
+// Leprechaun exits or a backup is restored, so there is nothing to close.
 func (l *Ledger) Save() (err error) {
-	if !l.isOpen {
-		l.db.Close()
-	}
-	l.isOpen = false
 	return
 }
 
+// loadDatabase opens the storage of the ledger if no handle has opened it yet.
 func (l *Ledger) loadDatabase() {
-	dataDir := filepath.Dir(l.databasePath)
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		// log.Println("Data folder already exists.")
+	path := l.databasePath
+	if path == "" {
+		path = ledgerPath()
 	}
-	// first check if ledger db already exists
-	alreadyExists := exists(l.databasePath)
-
-	// open the database
-	db, err := sql.Open("sqlite3", l.databasePath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	if !alreadyExists {
-		// We are just creating a new ledger
-		_, err = db.Exec(databaseInit)
-		if err != nil {
-			Logger.Fatal("Could not initialize ledger database", err)
-		}
+	if _, err := sharedStorage(path); err != nil {
+		Logger.Fatal("Could not open the ledger database", err)
 	}
-	l.db = db
-	l.isOpen = true
-	return
 }
 
-// NewSale saves a sale's profits to record
-func NewSale(asset, orderID, timestamp string, purchasePrice, purchaseVolume, salePrice, saleVolume float64) error {
-	entry := ProfitEntry{Asset: asset, OrderID: orderID, Timestamp: timestamp, PurchasePrice: purchasePrice, PurchaseVolume: purchaseVolume,
-		SalePrice: salePrice, SaleVolume: saleVolume}
-	// Collate all sales into a single all-time record
-	entry.PurchaseCost = entry.PurchasePrice * entry.PurchaseVolume
-	entry.SaleCost = entry.SalePrice * entry.SaleVolume
-	entry.Profit = entry.SaleCost - entry.PurchaseCost
-	debugf("Profit made from sale of %f %s is %f\n", entry.SaleVolume, assetNames[entry.Asset], entry.Profit)
-
-	if !exists(config.DataDir) {
-		os.MkdirAll(config.DataDir, 0755)
-	}
-
-	stats := fmt.Sprintf("%s-stats.json", strings.ToLower(assetNames[asset]))
-	stats = filepath.Join(config.DataDir, stats)
-	statsFile, err := os.OpenFile(stats, os.O_RDWR|os.O_CREATE, 0644)
+// migrateDatabase adds any columns in `ledgerMigrations` that are missing from the RECORDS table, then
+// gives its columns types if it was created without them.
+func migrateDatabase(db *sql.DB) error {
+	rows, err := db.Query(tableInfoOp)
 	if err != nil {
-		debug("Error! Could not open stats file!")
 		return err
 	}
-	defer statsFile.Close()
-
-	// Read previous stats from file
-	previousEntry := ProfitEntry{}
-	err = json.NewDecoder(statsFile).Decode(&previousEntry)
-	if err != nil && err != io.EOF {
-		debug("Error! Json Decode Err", err)
-		return err
-	}
-	err = statsFile.Truncate(0)
-	if err != nil {
-		debug("Error! Could not truncate stats file", err)
-		return err
-
+	columns := map[string]bool{}
+	typed := true
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     interface{}
+		)
+		if err = rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		columns[strings.ToUpper(name)] = true
+		typed = typed && colType != ""
 	}
-	if _, err := statsFile.Seek(0, 0); err != nil {
-		debug("Seek Error:", err)
-		return err
+	rows.Close()
+	for _, m := range ledgerMigrations {
+		if columns[m.column] {
+			continue
+		}
+		if _, err = db.Exec(m.definition); err != nil {
+			return err
+		}
+		log.Printf("ledger: added column %s to the RECORDS table", m.column)
 	}
-	newEntry := entry
-	newEntry.Profit += previousEntry.Profit
-	newEntry.PurchaseCost += previousEntry.PurchaseCost
-	newEntry.PurchasePrice += previousEntry.PurchasePrice
-	newEntry.PurchaseVolume += previousEntry.PurchaseVolume
-	newEntry.SaleCost += previousEntry.SaleCost
-	newEntry.SalePrice += previousEntry.SalePrice
-	newEntry.SaleVolume += previousEntry.SaleVolume
-	err = json.NewEncoder(statsFile).Encode(newEntry)
-	if err != nil {
-		debug("Json Encode error", err)
+	if typed {
+		return nil
 	}
+	return typeColumns(db)
+}
 
-	// Sales record section
-	sales := filepath.Join(config.DataDir, "sales.json")
-	salesFile, err := os.OpenFile(sales, os.O_RDWR|os.O_CREATE, 0644)
+// typeColumns copies the records of a RECORDS table created without column types into a typed one.
+// SQLite can not change the type of a column, so the table is rebuilt. NULLs are read as zero values.
+func typeColumns(db *sql.DB) error {
+	values := []string{}
+	for _, c := range recordColumns {
+		values = append(values, fmt.Sprintf("ifnull(%s, %s)", c.name, c.zero))
+	}
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	defer salesFile.Close()
-	salesRecordStack := &ProfitRecordStack{} // We only want to save `maxRecordsToSave` records at most
-	// Read previous records from file
-	err = json.NewDecoder(salesFile).Decode(&salesRecordStack.records)
-	if err != nil && err != io.EOF {
-		return err
+	for _, op := range []string{
+		recordsTable("TYPED_RECORDS"),
+		fmt.Sprintf("INSERT INTO TYPED_RECORDS (%s) SELECT %s FROM RECORDS", recordColumnList(), strings.Join(values, ", ")),
+		"DROP TABLE RECORDS",
+		"ALTER TABLE TYPED_RECORDS RENAME TO RECORDS",
+	} {
+		if _, err = tx.Exec(op); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
-	salesFile.Truncate(0)
-	_, err = salesFile.Seek(0, 0)
-	// Add the latest `ProfitEntry` to the stack
-	salesRecordStack.appendRecord(&entry)
-	// save the sale record to file
-	err = json.NewEncoder(salesFile).Encode(&salesRecordStack.records)
-	if err != nil {
-		debug("Json sale encode error", err)
+	if err = tx.Commit(); err != nil {
+		return err
 	}
+	log.Printf("ledger: gave the columns of the RECORDS table their types")
 	return nil
 }
 
-// GetSales returns historical records that have been saved to file.
-func GetSales() (records []*ProfitEntry, err error) {
-	salesFileLoc := filepath.Join(config.DataDir, "sales.json")
-	salesFile, err := os.OpenFile(salesFileLoc, os.O_RDONLY, 0644)
-	if err != nil {
-		return nil, err
-	}
-	defer salesFile.Close()
-	err = json.NewDecoder(salesFile).Decode(&records)
-	if err != nil && err != io.EOF {
-		return nil, err
+// GetChildRecords returns the open tranches of a laddered position. `parentID` must not be empty.
+func (l *Ledger) GetChildRecords(parentID string) (records []Record, err error) {
+	return l.records(RecordFilter{ParentID: parentID})
+}
+
+// NewSale saves the profit of a sale that closed a long position to the ledger. `fees` are the fees of
+// the purchase and the sale, in fiat.
+func NewSale(asset, orderID, parentID, opened, timestamp string, purchasePrice, purchaseVolume, salePrice, saleVolume, fees float64) error {
+	entry := ProfitEntry{Asset: asset, OrderID: orderID, ParentID: parentID, Opened: opened, Timestamp: timestamp, PurchasePrice: purchasePrice, PurchaseVolume: purchaseVolume,
+		SalePrice: salePrice, SaleVolume: saleVolume, Fees: fees}
+	if parentID != "" {
+		entry.Tranches = 1
 	}
-	return
+	entry.PurchaseCost = entry.PurchasePrice * entry.PurchaseVolume
+	entry.SaleCost = entry.SalePrice * entry.SaleVolume
+	entry.Profit = entry.SaleCost - entry.PurchaseCost
+	entry.NetProfit = entry.Profit - entry.Fees
+	debugf("Profit made from sale of %f %s is %f (%f after fees)\n", entry.SaleVolume, assetNames[entry.Asset], entry.Profit, entry.NetProfit)
+	return saveProfit(profitSale, entry)
+}
 
+// GetSales returns the sales that closed long positions, from the earliest.
+func GetSales() (records []*ProfitEntry, err error) {
+	return profitEntries(profitSale, false)
 }
 
 // AssetStats holds all time stats for an asset
@@ -357,18 +407,16 @@ type AssetStats struct {
 	AllTimeSalesCost      string
 	AllTimePurchasesCost  string
 	AllTimeProfit         string
+	AllTimeFees           string
+	AllTimeNetProfit      string
+	AllTimeTrancheExits   string
 }
 
 // GetStats returns the statistics for a given asset
 func GetStats(asset string) (string, error) {
 	d := AssetStats{}
-
-	statsFile := fmt.Sprintf("%s-stats.json", strings.ToLower(assetNames[asset]))
-	statsFile = filepath.Join(config.DataDir, statsFile)
-	entryFile, err := os.OpenFile(statsFile, os.O_RDONLY, 0644)
-	stats := ProfitEntry{}
-	err = json.NewDecoder(entryFile).Decode(&stats)
-	if err != nil && err != io.EOF {
+	stats, err := assetTotals(asset)
+	if err != nil {
 		return "", err
 	}
 	d.Asset = " " + assetNames[asset] + "\n"
@@ -380,119 +428,38 @@ func GetStats(asset string) (string, error) {
 	d.AllTimeSalesVolume = fmt.Sprintf(" %s %s\n", strconv.FormatFloat(stats.SaleVolume, 'f', 2, 64),
 		stats.Asset)
 	d.AllTimePurchasesCost = fmt.Sprintf(" %s %s\n", strconv.FormatFloat(stats.PurchaseCost, 'f', 2, 64),
-		config.CurrencyName)
+		cfg().CurrencyName)
 	d.AllTimeSalesCost = fmt.Sprintf(" %s %s\n", strconv.FormatFloat(stats.SaleCost, 'f', 2, 64),
-		config.CurrencyName)
-	d.AllTimeProfit = fmt.Sprintf(" %s %s\n", strconv.FormatFloat(stats.Profit, 'f', 2, 64), config.CurrencyName)
+		cfg().CurrencyName)
+	d.AllTimeProfit = fmt.Sprintf(" %s %s\n", strconv.FormatFloat(stats.Profit, 'f', 2, 64), cfg().CurrencyName)
+	d.AllTimeFees = fmt.Sprintf(" %s %s\n", strconv.FormatFloat(stats.Fees, 'f', 2, 64), cfg().CurrencyName)
+	d.AllTimeNetProfit = fmt.Sprintf(" %s %s\n", strconv.FormatFloat(stats.NetProfit, 'f', 2, 64), cfg().CurrencyName)
+	d.AllTimeTrancheExits = fmt.Sprintf(" %d\n", stats.Tranches)
 	s := fmt.Sprintf("%+v\n", d)
 	s = strings.TrimPrefix(strings.TrimSuffix(strings.TrimSpace(s), "}"), "{")
 	return s, nil
 
 }
 
-// NewPurchase adds a new (re)purchase record to file an calculates the profit made therein.
-// Only `maxRecordsToSave` most recent records are saved to file. (see the `recordStack.append` function)
-// func NewPurchase(purchase Record) error {
-func NewPurchase(asset, orderID, timestamp string, salePrice, saleVolume, purchasePrice, purchaseVolume float64) error {
-	entry := ProfitEntry{Asset: asset, OrderID: orderID, Timestamp: timestamp, PurchasePrice: purchasePrice, PurchaseVolume: purchaseVolume,
-		SalePrice: salePrice, SaleVolume: saleVolume}
-	// Collate all sales into a single all-time record
+// NewPurchase saves the profit of a purchase that bought back a short position to the ledger. `fees` are
+// the fees of the sale and the purchase, in fiat.
+func NewPurchase(asset, orderID, parentID, opened, timestamp string, salePrice, saleVolume, purchasePrice, purchaseVolume, fees float64) error {
+	entry := ProfitEntry{Asset: asset, OrderID: orderID, ParentID: parentID, Opened: opened, Timestamp: timestamp, PurchasePrice: purchasePrice, PurchaseVolume: purchaseVolume,
+		SalePrice: salePrice, SaleVolume: saleVolume, Fees: fees}
+	if parentID != "" {
+		entry.Tranches = 1
+	}
 	entry.PurchaseCost = entry.PurchasePrice * entry.PurchaseVolume
 	entry.SaleCost = entry.SalePrice * entry.SaleVolume
-	entry.Profit = entry.PurchaseCost - entry.SaleCost // Note. This is the reverse of the sale profit calculation.
-	debugf("Profit made from sale of %f %s is %f\n", entry.SaleVolume, assetNames[entry.Asset], entry.Profit)
-
-	if !exists(config.DataDir) {
-		os.MkdirAll(config.DataDir, 0755)
-	}
-
-	stats := fmt.Sprintf("%s-stats.json", strings.ToLower(assetNames[asset]))
-	stats = filepath.Join(config.DataDir, stats)
-	statsFile, err := os.OpenFile(stats, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		debug("Error! Could not open stats file!")
-		return err
-	}
-	defer statsFile.Close()
-
-	// Read previous stats from file
-	previousEntry := ProfitEntry{}
-	err = json.NewDecoder(statsFile).Decode(&previousEntry)
-	if err != nil && err != io.EOF {
-		debug("Error! Json Decode Err", err)
-		return err
-	}
-	err = statsFile.Truncate(0)
-	if err != nil {
-		debug("Error! Could not truncate stats file", err)
-		return err
-
-	}
-	if _, err := statsFile.Seek(0, 0); err != nil {
-		debug("Seek Error:", err)
-		return err
-	}
-	newEntry := entry
-	newEntry.Profit += previousEntry.Profit
-	newEntry.PurchaseCost += previousEntry.PurchaseCost
-	newEntry.PurchasePrice += previousEntry.PurchasePrice
-	newEntry.PurchaseVolume += previousEntry.PurchaseVolume
-	newEntry.SaleCost += previousEntry.SaleCost
-	newEntry.SalePrice += previousEntry.SalePrice
-	newEntry.SaleVolume += previousEntry.SaleVolume
-	err = json.NewEncoder(statsFile).Encode(newEntry)
-	if err != nil {
-		debug("Json Encode error", err)
-	}
-
-	// purchase record section
-	purchasesFileLoc := filepath.Join(config.DataDir, "purchases.json")
-	stack := &ProfitRecordStack{}
-	purchasesFile, err := os.OpenFile(purchasesFileLoc, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return err
-	}
-	defer purchasesFile.Close()
-	// First read the records from file into the stack
-	err = json.NewDecoder(purchasesFile).Decode(&stack.records)
-	if err != nil && err != io.EOF {
-		return err
-	}
-	if err == io.EOF {
-		// There was no previous entry in the file
-		stack = &ProfitRecordStack{}
-	}
-	purchasesFile.Truncate(0)
-	_, err = purchasesFile.Seek(0, 0)
-	if err != nil {
-		return err
-	}
-	stack.appendRecord(&entry)
-	err = json.NewEncoder(purchasesFile).Encode(stack.records)
-	if err != nil {
-		return err
-	}
-	return nil
-
+	entry.Profit = entry.SaleCost - entry.PurchaseCost // The asset was sold before it was repurchased. A loss is negative.
+	entry.NetProfit = entry.Profit - entry.Fees
+	debugf("Profit made from sale of %f %s is %f (%f after fees)\n", entry.SaleVolume, assetNames[entry.Asset], entry.Profit, entry.NetProfit)
+	return saveProfit(profitPurchase, entry)
 }
 
-// GetPurchases returns a list of past asset purchases made by leprechaun.
+// GetPurchases returns the purchases that bought back short positions, from the earliest.
 func GetPurchases() ([]*ProfitEntry, error) {
-	purchasesFileLoc := filepath.Join(config.DataDir, "purchases.json")
-	stack := new(ProfitRecordStack)
-	purchases := stack.records
-	purchasesFile, err := os.OpenFile(purchasesFileLoc, os.O_RDONLY, 0644)
-	if err != nil {
-		return nil, err
-	}
-	defer purchasesFile.Close()
-	// Read the records from file
-	err = json.NewDecoder(purchasesFile).Decode(&purchases)
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
-	return purchases, nil
-
+	return profitEntries(profitPurchase, false)
 }
 
 var (
@@ -504,11 +471,6 @@ type RecordStack struct {
 	records []Record
 }
 
-// ProfitRecordStack holds a FIFO stack of at most `maxRecordsToSave` `ProfitEntry` elements.
-type ProfitRecordStack struct {
-	records []*ProfitEntry
-}
-
 // appendRecord appends a value of type T to a FIFO stack (actually a slice),
 //  with a max capacity of `maxRecordsToSave`
 // If the stacked is filled, it's first value is popped. Note, the slice
@@ -521,12 +483,3 @@ func (st *RecordStack) appendRecord(rec Record) {
 	}
 	st.records = append(st.records, rec)
 }
-
-func (stack *ProfitRecordStack) appendRecord(entry *ProfitEntry) {
-	l := len(stack.records)
-	if l >= maxRecordsToSave {
-		x := l - maxRecordsToSave
-		stack.records = stack.records[x+1 : l] // pop the first element
-	}
-	stack.records = append(stack.records, entry)
-}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// benchmarkAssets is the number of assets the records of a benchmark ledger are spread over.
+const benchmarkAssets = 10
+
+// seedLedger adds `n` open records to the SQLite ledger in one transaction, so large ledgers are quick to set up.
+func seedLedger(b *testing.B, n int) {
+	store, err := sharedStorage(ledgerPath())
+	if err != nil {
+		b.Fatal(err)
+	}
+	tx, err := store.(*sqlStorage).db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	insert, err := tx.Prepare(recordInsert)
+	if err != nil {
+		b.Fatal(err)
+	}
+	now := time.Now().Format(timeFormat)
+	for i := 0; i < n; i++ {
+		rec := Record{Asset: fmt.Sprintf("A%d", i%benchmarkAssets), ID: fmt.Sprintf("order-%d", i), Price: float64(100 + i%50),
+			Volume: 1, Cost: float64(100 + i%50), Type: LongOrder, Timestamp: now}
+		if _, err = insert.Exec(rec.Asset, rec.Cost, rec.ID, rec.Price, rec.SaleID, rec.Sold, rec.Status, rec.Timestamp,
+			rec.Volume, rec.Type, rec.TriggerPrice, rec.ParentID, rec.RequestedVolume, rec.ClientRef, rec.LunoAssetFee,
+			rec.LunoFiatFee, encodeAnalysis(rec), rec.Simulated); err != nil {
+			b.Fatal(err)
+		}
+	}
+	insert.Close()
+	if err = tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkLedger inserts and queries records in SQLite ledgers that already hold 10^4 and 10^5 records.
+func BenchmarkLedger(b *testing.B) {
+	for _, size := range []int{10000, 100000} {
+		b.Run(fmt.Sprintf("%d records", size), func(b *testing.B) {
+			useTempLedger(b)
+			seedLedger(b, size)
+			ledger := &Ledger{databasePath: ledgerPath()}
+			b.Run("AddRecord", func(b *testing.B) {
+				now := time.Now().Format(timeFormat)
+				for i := 0; i < b.N; i++ {
+					rec := Record{Asset: "A0", ID: fmt.Sprintf("new-%d-%d", b.N, i), Price: 100, Volume: 1, Cost: 100,
+						Type: LongOrder, Timestamp: now}
+					if err := ledger.AddRecord(rec); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("GetRecordByID", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := ledger.GetRecordByID(fmt.Sprintf("order-%d", i%size)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("GetRecordsByType", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					records, err := ledger.GetRecordsByType(fmt.Sprintf("A%d", i%benchmarkAssets), LongOrder)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if len(records) < size/benchmarkAssets {
+						b.Fatalf("got %d records, want at least %d", len(records), size/benchmarkAssets)
+					}
+				}
+			})
+			b.Run("ViableRecords", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := ledger.ViableRecords(fmt.Sprintf("A%d", i%benchmarkAssets), 120); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
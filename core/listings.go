@@ -0,0 +1,223 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `listings.go` discovers the pairs the exchange lists in the user's currency after Leprechaun first
+*  saw its markets. Each new listing is offered to the user once. An accepted asset is added to the
+*  watchlist, the assets that can be picked for trading, and if the user wants it traded, the running
+*  bot starts trading it in its next round without a restart.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownListing is returned when a listing that was not offered to the user is accepted or dismissed.
+var ErrUnknownListing = errors.New("the exchange has not listed this pair since Leprechaun last checked")
+
+// Listing is a pair newly listed by the exchange in the user's currency.
+type Listing struct {
+	Asset    string
+	Currency string
+	Pair     string
+	Listed   time.Time // When Leprechaun first saw the pair.
+}
+
+// listingState is saved to `listingsFile` so listings are only offered once.
+type listingState struct {
+	Seen    map[string]time.Time // Every pair in the user's currency seen on the exchange.
+	Pending []Listing            // Listings the user has not answered yet.
+}
+
+var (
+	listingsFile = "listings.json"
+	listingsMu   sync.Mutex
+	listings     *listingState
+)
+
+// loadListings reads the saved listings once. Listings are kept outside the paper trading folder
+// since the exchange lists the same pairs in both modes.
+func loadListings() *listingState {
+	if listings != nil {
+		return listings
+	}
+	listings = &listingState{Seen: map[string]time.Time{}}
+	data, err := ioutil.ReadFile(filepath.Join(cfg().DataDir, listingsFile))
+	if err != nil {
+		return listings
+	}
+	json.Unmarshal(data, listings)
+	if listings.Seen == nil {
+		listings.Seen = map[string]time.Time{}
+	}
+	return listings
+}
+
+func saveListings(state *listingState) error {
+	if err := os.MkdirAll(cfg().DataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(cfg().DataDir, listingsFile), data, 0644)
+}
+
+// isSupportedAsset reports whether `asset` is on the watchlist.
+func isSupportedAsset(asset string) bool {
+	for _, supported := range cfg().SupportedAssets {
+		if supported == asset {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverListings offers the pairs in `listed` that are quoted in the user's currency and were not
+// seen before. The pairs listed the first time the exchange is checked are only remembered, since
+// they were not newly listed.
+func discoverListings(listed map[string]string) {
+	currency := cfg().CurrencyCode
+	listingsMu.Lock()
+	state := loadListings()
+	firstCheck := len(state.Seen) == 0
+	now := time.Now()
+	found := []Listing{}
+	for pair := range listed {
+		if !strings.HasSuffix(pair, currency) || len(pair) == len(currency) {
+			continue
+		}
+		if _, seen := state.Seen[pair]; seen {
+			continue
+		}
+		state.Seen[pair] = now
+		asset := strings.TrimSuffix(pair, currency)
+		if firstCheck || isSupportedAsset(asset) {
+			continue
+		}
+		listing := Listing{Asset: asset, Currency: currency, Pair: pair, Listed: now}
+		state.Pending = append(state.Pending, listing)
+		found = append(found, listing)
+	}
+	var err error
+	if firstCheck || len(found) > 0 {
+		err = saveListings(state)
+	}
+	listingsMu.Unlock()
+	if err != nil {
+		debugf("Could not save the pairs listed on the exchange. Reason: %v", err)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Pair < found[j].Pair })
+	for _, listing := range found {
+		notify(EventInfo, listing.Asset, "Luno has listed %s/%s. You can add %s to your watchlist from the main page.",
+			listing.Asset, listing.Currency, listing.Asset)
+	}
+}
+
+// NewListings returns the newly listed pairs the user has not answered yet, oldest first.
+func NewListings() []Listing {
+	listingsMu.Lock()
+	defer listingsMu.Unlock()
+	if cfg() == nil {
+		return nil
+	}
+	return append([]Listing{}, loadListings().Pending...)
+}
+
+// answerListing removes the listing of `pair` from the pending listings.
+func answerListing(pair string) (listing Listing, err error) {
+	listingsMu.Lock()
+	defer listingsMu.Unlock()
+	state := loadListings()
+	for ix, pending := range state.Pending {
+		if pending.Pair == pair {
+			state.Pending = append(state.Pending[:ix:ix], state.Pending[ix+1:]...)
+			return pending, saveListings(state)
+		}
+	}
+	return listing, ErrUnknownListing
+}
+
+// DismissListing stops offering the listing of `pair`. It is not offered again.
+func DismissListing(pair string) error {
+	_, err := answerListing(pair)
+	return err
+}
+
+// AcceptListing adds the asset of a newly listed pair to the watchlist and, if `trade` is set, to the
+// assets traded. A running bot starts trading the asset in its next round. The settings are saved.
+func AcceptListing(pair string, trade bool) (asset string, err error) {
+	listing, err := answerListing(pair)
+	if err != nil {
+		return
+	}
+	asset = listing.Asset
+	configMu.Lock()
+	next := cfg().Clone()
+	next.AddAsset(asset, trade)
+	publishConfig(next)
+	configMu.Unlock()
+	return asset, next.Save()
+}
+
+// AddAsset adds `asset` to the watchlist of the settings and, if `trade` is set, to the assets traded.
+func (c *Configuration) AddAsset(asset string, trade bool) {
+	supported, traded := false, !trade
+	for _, ast := range c.SupportedAssets {
+		supported = supported || ast == asset
+	}
+	for _, ast := range c.AssetsToTrade {
+		traded = traded || ast == asset
+	}
+	if !supported {
+		c.SupportedAssets = append(append([]string{}, c.SupportedAssets...), asset)
+	}
+	if !traded {
+		c.AssetsToTrade = append(append([]string{}, c.AssetsToTrade...), asset)
+	}
+}
+
+// withDefaultAssets returns the default assets followed by the other assets in `assets`, without duplicates.
+func withDefaultAssets(assets []string) []string {
+	merged := append([]string{}, DefaultSupportedAssets...)
+	for _, asset := range assets {
+		known := asset == ""
+		for _, ast := range merged {
+			known = known || ast == asset
+		}
+		if !known {
+			merged = append(merged, asset)
+		}
+	}
+	return merged
+}
+
+// startNewClients initializes a client for each asset added to the traded assets while the bot was running.
+func (bot *Bot) startNewClients() {
+	for _, asset := range cfg().AssetsToTrade {
+		running := false
+		for _, cl := range bot.clients {
+			running = running || cl.asset == asset
+		}
+		if running {
+			continue
+		}
+		client, err := initClient(asset)
+		if err != nil {
+			debugf("Could not start trading %s. Leprechaun will try again next round. Reason: %v", asset, err)
+			continue
+		}
+		bot.clients = append(bot.clients, client)
+		bot.orders.addClient(&bot.clients[len(bot.clients)-1])
+		notify(EventInfo, asset, "Leprechaun has started trading %s.", client.name)
+	}
+}
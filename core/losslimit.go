@@ -0,0 +1,192 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `losslimit.go` holds the daily loss limit. The realized and unrealized profit of each calendar day
+*  is tracked and, once the day's loss exceeds the limit set by the user, Leprechaun stops opening
+*  positions until the next day or until the user re-enables trading. Open positions are still
+*  closed while trading is paused. The state of the day is saved, so restarting does not reset it.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDailyLossLimit is returned while trading is paused because the day's loss exceeded the limit.
+var ErrDailyLossLimit = errors.New("the daily loss limit has been reached")
+
+// DailyLossSettings configures the daily loss limit.
+type DailyLossSettings struct {
+	Enabled bool
+	Limit   float64 // Loss in fiat currency after which trading is paused for the rest of the day.
+}
+
+// dailyLoss is the profit and loss of the current day.
+type dailyLoss struct {
+	Date string
+	// Baselines holds the unrealized profit of each open position when it was first seen in the day.
+	// Only the change from the baseline counts towards the day's profit.
+	Baselines map[string]float64
+	// ClosedBaselines is the sum of the baselines of the positions closed in the day. Their realized profit
+	// includes what they had gained before the day started.
+	ClosedBaselines float64
+	Prices          map[string]float64 // Last price seen for each asset.
+	Profit          float64            // Realized and unrealized profit of the day. A loss is negative.
+	// Floor is the profit at which trading is paused. It is lowered when the user re-enables trading.
+	Floor  float64
+	Paused bool
+}
+
+var (
+	dailyLossFile = "dailyloss.json"
+	dailyLossMu   sync.Mutex
+	// savedDailyLoss is the last state saved to `dailyLossPath`, so the UI can poll it without reading the file.
+	savedDailyLoss dailyLoss
+	dailyLossPath  string
+)
+
+func loadDailyLoss() (day dailyLoss) {
+	path := filepath.Join(dataDir(), dailyLossFile)
+	if path == dailyLossPath {
+		day = savedDailyLoss
+	} else if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, &day)
+		savedDailyLoss, dailyLossPath = day, path
+	}
+	today := time.Now().Format("2006-01-02")
+	if day.Date != today {
+		// A new day starts with a clean slate.
+		day = dailyLoss{Date: today, Floor: -cfg().Trade.DailyLoss.Limit}
+	}
+	if day.Baselines == nil {
+		day.Baselines = map[string]float64{}
+	}
+	if day.Prices == nil {
+		day.Prices = map[string]float64{}
+	}
+	return
+}
+
+func saveDailyLoss(day dailyLoss) error {
+	if err := os.MkdirAll(dataDir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(day)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dataDir(), dailyLossFile)
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	savedDailyLoss, dailyLossPath = day, path
+	return nil
+}
+
+// profitClosedOn returns the profit of the positions closed on `date`.
+func profitClosedOn(date string) (profit float64) {
+	sales, _ := GetSales()
+	purchases, _ := GetPurchases()
+	for _, entry := range append(sales, purchases...) {
+		if strings.HasPrefix(entry.Timestamp, date) {
+			profit += entry.Profit
+		}
+	}
+	return
+}
+
+// updateDailyLoss updates the day's profit with the current price of the client's asset and pauses
+// trading if the day's loss has exceeded `config.Trade.DailyLoss.Limit`.
+func (bot *Bot) updateDailyLoss(cl *Client, price float64) {
+	settings := cfg().Trade.DailyLoss
+	if !settings.Enabled || settings.Limit <= 0 {
+		return
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	records, err := ledger.AllRecords()
+	if err != nil {
+		debugf("Could not update the daily loss. Reason: %v", err)
+		return
+	}
+	dailyLossMu.Lock()
+	defer dailyLossMu.Unlock()
+	day := loadDailyLoss()
+	day.Prices[cl.asset] = price
+	open := map[string]bool{}
+	unrealized := 0.0
+	for _, rec := range records {
+		last, ok := day.Prices[rec.Asset]
+		if !ok {
+			continue
+		}
+		open[rec.ID] = true
+		profit := unrealizedProfit(rec, last)
+		baseline, seen := day.Baselines[rec.ID]
+		if !seen {
+			baseline = profit
+			day.Baselines[rec.ID] = baseline
+		}
+		unrealized += profit - baseline
+	}
+	for id, baseline := range day.Baselines {
+		if !open[id] {
+			day.ClosedBaselines += baseline
+			delete(day.Baselines, id)
+		}
+	}
+	day.Profit = profitClosedOn(day.Date) - day.ClosedBaselines + unrealized
+	if !day.Paused && day.Profit <= day.Floor {
+		day.Paused = true
+		notify(EventAlert, cl.asset, "Today's loss of %s %.2f exceeds your daily loss limit of %s %.2f. Leprechaun will not open new positions until tomorrow or until you resume trading.",
+			cl.currency, -day.Profit, cl.currency, settings.Limit)
+	}
+	if err = saveDailyLoss(day); err != nil {
+		debugf("Could not save the daily loss. Reason: %v", err)
+	}
+}
+
+// checkDailyLoss returns `ErrDailyLossLimit` while trading is paused by the daily loss limit.
+func checkDailyLoss() error {
+	if !cfg().Trade.DailyLoss.Enabled {
+		return nil
+	}
+	dailyLossMu.Lock()
+	defer dailyLossMu.Unlock()
+	if loadDailyLoss().Paused {
+		return ErrDailyLossLimit
+	}
+	return nil
+}
+
+// DailyLossStatus returns the profit of the current day and whether trading is paused by the daily loss limit.
+func DailyLossStatus() (profit float64, paused bool) {
+	if !cfg().Trade.DailyLoss.Enabled {
+		return 0, false
+	}
+	dailyLossMu.Lock()
+	defer dailyLossMu.Unlock()
+	day := loadDailyLoss()
+	return day.Profit, day.Paused
+}
+
+// ResumeTrading re-enables trading after it was paused by the daily loss limit. Trading is paused
+// again if the day's loss grows by another `config.Trade.DailyLoss.Limit`.
+func ResumeTrading() error {
+	dailyLossMu.Lock()
+	defer dailyLossMu.Unlock()
+	day := loadDailyLoss()
+	if !day.Paused {
+		return nil
+	}
+	day.Paused = false
+	day.Floor = day.Profit - cfg().Trade.DailyLoss.Limit
+	return saveDailyLoss(day)
+}
@@ -0,0 +1,205 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `marketdata.go` backfills candles from an external market data provider. Luno only returns the last
+*  100 trades since a given time, so the candles built from its trades are an approximation. If the user
+*  chooses a provider, the candles missing from the candle database are retrieved from it instead, in a
+*  single request, and only the latest candle, whose period is not over, is built from Luno's trades.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	luno "github.com/luno/luno-go"
+)
+
+// CryptoCompareProvider is the name of the CryptoCompare market data provider.
+const CryptoCompareProvider = "cryptocompare"
+
+// ErrNoProviderCandles is returned when the market data provider has no candles for an asset.
+var ErrNoProviderCandles = errors.New("the market data provider has no candles for this asset")
+
+// MarketDataSettings configures the provider candles are backfilled from.
+type MarketDataSettings struct {
+	// Provider is the name of the market data provider. If it is empty all candles are built from the exchange's trades.
+	Provider string
+	// APIKey is passed to providers that need one, or that allow more requests with one.
+	APIKey string
+}
+
+// Validate returns an error if the provider is not registered.
+func (s MarketDataSettings) Validate() error {
+	if _, ok := candleProviders[strings.ToLower(s.Provider)]; s.Provider != "" && !ok {
+		return fmt.Errorf("unknown market data provider %q", s.Provider)
+	}
+	return nil
+}
+
+// CandleProvider provides historic candles for assets.
+type CandleProvider interface {
+	Name() string
+	// Candles returns the candles of `asset` in `currency` that began from `from` up to, but not
+	// including, `to`, ordered from the earliest. `unit` is time.Minute or time.Hour.
+	Candles(asset, currency string, unit time.Duration, from, to time.Time) ([]OHLC, error)
+}
+
+// candleProviders holds the market data providers that can be chosen, keyed by name.
+var candleProviders = map[string]CandleProvider{
+	CryptoCompareProvider: cryptoCompareProvider{},
+}
+
+// RegisterCandleProvider adds a market data provider that can be chosen in the settings.
+func RegisterCandleProvider(name string, provider CandleProvider) {
+	if provider != nil {
+		candleProviders[strings.ToLower(name)] = provider
+	}
+}
+
+// candleProvider returns the provider chosen by the user, if there is one.
+func candleProvider() (provider CandleProvider, ok bool) {
+	provider, ok = candleProviders[strings.ToLower(cfg().MarketData.Provider)]
+	return
+}
+
+// cryptoCompareProvider retrieves candles from the public CryptoCompare API.
+type cryptoCompareProvider struct{}
+
+// cryptoCompareSymbols maps the asset codes used by Luno to CryptoCompare symbols, where they differ.
+var cryptoCompareSymbols = map[string]string{
+	"XBT": "BTC",
+}
+
+// cryptoCompareLimit is the largest number of candles CryptoCompare returns per request.
+const cryptoCompareLimit = 2000
+
+func (cryptoCompareProvider) Name() string { return "CryptoCompare" }
+
+func (cryptoCompareProvider) Candles(asset, currency string, unit time.Duration, from, to time.Time) (candles []OHLC, err error) {
+	symbol, ok := cryptoCompareSymbols[asset]
+	if !ok {
+		symbol = asset
+	}
+	endpoint := "https://min-api.cryptocompare.com/data/v2/histohour?"
+	if unit < time.Hour {
+		unit = time.Minute
+		endpoint = "https://min-api.cryptocompare.com/data/v2/histominute?"
+	} else {
+		unit = time.Hour
+	}
+	// The candle that began at `toTs` is the last one returned, after `limit` earlier candles.
+	last := to.Add(-unit).Truncate(unit)
+	limit := int(last.Sub(from.Truncate(unit)) / unit)
+	if limit < 1 {
+		limit = 1
+	} else if limit > cryptoCompareLimit {
+		limit = cryptoCompareLimit
+	}
+	query := url.Values{"fsym": {symbol}, "tsym": {strings.ToUpper(currency)},
+		"limit": {strconv.Itoa(limit)}, "toTs": {strconv.FormatInt(last.Unix(), 10)}}
+	if cfg().MarketData.APIKey != "" {
+		query.Set("api_key", cfg().MarketData.APIKey)
+	}
+	client := http.Client{Timeout: 15 * time.Second}
+	res, err := client.Get(endpoint + query.Encode())
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cryptocompare: %s", res.Status)
+	}
+	body := struct {
+		Response string
+		Message  string
+		Data     struct {
+			Data []struct {
+				Time                   int64
+				Open, High, Low, Close float64
+				VolumeFrom             float64
+			}
+		}
+	}{}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return
+	}
+	if body.Response != "Success" {
+		return nil, fmt.Errorf("cryptocompare: %s", body.Message)
+	}
+	for _, point := range body.Data.Data {
+		start := time.Unix(point.Time, 0)
+		// Periods without trades are returned with zero prices.
+		if start.Before(from) || !start.Before(to) || point.Open <= 0 || point.Close <= 0 {
+			continue
+		}
+		candles = append(candles, NewOHLC(start, unit, point.Open, point.High, point.Low, point.Close, point.VolumeFrom))
+	}
+	if len(candles) == 0 {
+		return nil, ErrNoProviderCandles
+	}
+	return candles, nil
+}
+
+// mergeCandles combines consecutive candles, ordered from the earliest, into one candle that began at `start`.
+func mergeCandles(start time.Time, period time.Duration, candles []OHLC) OHLC {
+	high, low, volume := candles[0].High, candles[0].Low, 0.0
+	for _, candle := range candles {
+		high, low = Max64([]float64{high, candle.High}), Min64([]float64{low, candle.Low})
+		volume += candle.TotalVolume
+	}
+	return NewOHLC(start, period, candles[0].Open, high, low, candles[len(candles)-1].Close, volume)
+}
+
+// backfillCandles retrieves the closed candles that began at `gaps` from the market data provider chosen
+// by the user and saves them. The candles are keyed by their UTC start time. Gaps the provider could not
+// fill are left out, so they are built from the exchange's trades.
+func (cl *Client) backfillCandles(gaps []luno.Time, interval time.Duration) map[time.Time]OHLC {
+	filled := map[time.Time]OHLC{}
+	provider, ok := candleProvider()
+	now := time.Now()
+	closed := []time.Time{}
+	for _, gap := range gaps {
+		if start := time.Time(gap); !start.Add(interval).After(now) {
+			closed = append(closed, start)
+		}
+	}
+	if !ok || len(closed) == 0 {
+		return filled
+	}
+	unit := time.Hour
+	if interval%time.Hour != 0 {
+		unit = time.Minute
+	}
+	base, err := provider.Candles(cl.asset, cl.currency, unit, closed[0], closed[len(closed)-1].Add(interval))
+	if err != nil {
+		debugf("Could not retrieve the candles of %s from %s. They will be built from the exchange's trades. Reason: %v",
+			cl.name, provider.Name(), err)
+		return filled
+	}
+	candles := []OHLC{}
+	for _, start := range closed {
+		within := []OHLC{}
+		for _, candle := range base {
+			if !candle.Time.Before(start) && candle.Time.Before(start.Add(interval)) {
+				within = append(within, candle)
+			}
+		}
+		// A candle is only backfilled if the provider has data for its whole period.
+		if len(within) == 0 || time.Duration(len(within))*unit < interval {
+			continue
+		}
+		candle := mergeCandles(start, interval, within)
+		filled[start.UTC()] = candle
+		candles = append(candles, candle)
+	}
+	debugf("%d of %d missing candles of %s were retrieved from %s.", len(candles), len(gaps), cl.name, provider.Name())
+	cl.saveClosedCandles(interval, candles)
+	return filled
+}
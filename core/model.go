@@ -0,0 +1,286 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `model.go` holds the "model" analysis plugin. It feeds normalized candles and indicators of an asset
+*  to a machine learning model trained by the user, e.g. an ONNX model, and turns the probabilities
+*  the model outputs into signals. Models are run by the pure Go ONNX runtime in `onnx.go`, unless a build
+*  registers another runtime with `RegisterModelRuntime`. Without a model file the plugin falls back to
+*  another plugin chosen by the user.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelPlugin is the name the model inference plugin is registered under.
+const ModelPlugin = "model"
+
+// ModelFeaturesPerCandle is the number of features computed for each candle fed to a model.
+const ModelFeaturesPerCandle = 5
+
+var (
+	// ErrNoModel is returned when the model file is not set or does not exist.
+	ErrNoModel = errors.New("the model file could not be found")
+	// ErrNoModelRuntime is returned when Leprechaun was built without a runtime for models.
+	ErrNoModelRuntime = errors.New("leprechaun was built without a runtime for models")
+	// ErrModelOutput is returned when a model outputs something other than signal probabilities.
+	ErrModelOutput = errors.New("the model did not output signal probabilities")
+)
+
+// ModelSettings configures the model inference plugin.
+type ModelSettings struct {
+	// Path is the path of the model file. Relative paths are in the data directory.
+	Path string
+	// Window is the number of latest candles fed to the model.
+	Window int
+	// Threshold is the probability, from 0.5 to 1, a long or short signal needs.
+	Threshold float64
+	// Fallback is the plugin used when the model can not be run. Empty waits instead.
+	Fallback string
+}
+
+// Validate returns an error if the window or threshold are out of range or the model falls back on itself.
+func (s ModelSettings) Validate() error {
+	if s.Window <= 0 {
+		return fmt.Errorf("the model needs at least one candle, not %d", s.Window)
+	}
+	if s.Threshold < 0.5 || s.Threshold > 1 {
+		return fmt.Errorf("the model threshold must be between 0.5 and 1, not %v", s.Threshold)
+	}
+	if strings.ToLower(s.Fallback) == ModelPlugin {
+		return errors.New("the model plugin can not fall back on itself")
+	}
+	return nil
+}
+
+// path returns the absolute path of the model file.
+func (s ModelSettings) path() string {
+	if s.Path == "" || filepath.IsAbs(s.Path) {
+		return s.Path
+	}
+	return filepath.Join(cfg().DataDir, s.Path)
+}
+
+// Model is a loaded machine learning model.
+type Model interface {
+	// Run returns the output of the model for `features`. The output is either the probabilities of a
+	// wait, long and short signal, in that order, or the single probability that the price rises.
+	Run(features []float32) ([]float32, error)
+}
+
+// ModelLoader loads the model file at `path`.
+type ModelLoader func(path string) (Model, error)
+
+var (
+	modelMu       sync.Mutex
+	modelLoader   ModelLoader
+	loadedModel   Model
+	loadedPath    string
+	loadedModTime time.Time
+)
+
+// RegisterModelRuntime sets the function models are loaded with, in place of the pure Go ONNX runtime. It
+// is called by builds that include another inference runtime, e.g. from the init function of a package
+// that wraps the ONNX runtime.
+func RegisterModelRuntime(loader ModelLoader) {
+	modelMu.Lock()
+	modelLoader, loadedModel, loadedPath = loader, nil, ""
+	modelMu.Unlock()
+	registerModelPlugin()
+}
+
+// ModelRuntimeAvailable reports whether this build includes a runtime that can run models.
+func ModelRuntimeAvailable() bool {
+	modelMu.Lock()
+	defer modelMu.Unlock()
+	return modelLoader != nil
+}
+
+// registerModelPlugin makes the model plugin available once a runtime has been registered.
+func registerModelPlugin() {
+	if PluginHandler == nil || !ModelRuntimeAvailable() {
+		return
+	}
+	if _, err := PluginHandler.Describe(ModelPlugin); err != nil {
+		PluginHandler.RegisterFactory(ModelPlugin, func() Analyzer { return &ModelAnalyzer{} })
+	}
+}
+
+// loadModel returns the model at `path`. The model is loaded again when the file changes.
+func loadModel(path string) (Model, error) {
+	modelMu.Lock()
+	defer modelMu.Unlock()
+	if modelLoader == nil {
+		return nil, ErrNoModelRuntime
+	}
+	info, err := os.Stat(path)
+	if path == "" || err != nil {
+		return nil, fmt.Errorf("%w (%q)", ErrNoModel, path)
+	}
+	if loadedModel != nil && loadedPath == path && loadedModTime.Equal(info.ModTime()) {
+		return loadedModel, nil
+	}
+	model, err := modelLoader(path)
+	if err != nil {
+		return nil, err
+	}
+	loadedModel, loadedPath, loadedModTime = model, path, info.ModTime()
+	debugf("Loaded the model %s", path)
+	return model, nil
+}
+
+// modelFeatures returns the features of the latest `window` candles and the current price. Prices are
+// relative to the latest close and volumes to the average volume, so a model trained on one asset
+// can be used on another. For each candle the features are its open, high, low and close relative to
+// the latest close and its volume relative to the average volume. They are followed by the position of
+// the current price in the Bollinger Bands, its distance from the VWAP and the ATR, relative to the price.
+func modelFeatures(candles []OHLC, prices []float64, currentPrice float64, window int) ([]float32, error) {
+	if len(candles) < window {
+		return nil, fmt.Errorf("%w (%d candles, the model needs %d)", ErrNotEnoughPrices, len(candles), window)
+	}
+	candles = candles[len(candles)-window:]
+	last := candles[len(candles)-1].Close
+	if last <= 0 {
+		return nil, fmt.Errorf("%w (the latest close is %v)", ErrNotEnoughPrices, last)
+	}
+	if currentPrice <= 0 {
+		currentPrice = last
+	}
+	volume := 0.0
+	for _, candle := range candles {
+		volume += candle.TotalVolume
+	}
+	volume /= float64(len(candles))
+	features := make([]float32, 0, window*ModelFeaturesPerCandle+3)
+	for _, candle := range candles {
+		relativeVolume := 0.0
+		if volume > 0 {
+			relativeVolume = candle.TotalVolume / volume
+		}
+		features = append(features, float32(candle.Open/last-1), float32(candle.High/last-1),
+			float32(candle.Low/last-1), float32(candle.Close/last-1), float32(relativeVolume))
+	}
+	position := 0.0
+	if bands, err := BB(prices, 20, 2); err == nil && bands.Upper > bands.Lower {
+		position = (currentPrice - bands.Middle) / (bands.Upper - bands.Lower)
+	}
+	distance := 0.0
+	if vwap, err := VWAP(candles); err == nil && vwap > 0 {
+		distance = currentPrice/vwap - 1
+	}
+	atr := averageTrueRange(candles, int(math.Min(14, float64(window-1)))) / currentPrice
+	return append(features, float32(position), float32(distance), float32(atr)), nil
+}
+
+// modelSignal returns the signal of the model output and its probability. A signal is only returned if
+// its probability reaches `threshold`.
+func modelSignal(output []float32, threshold float64) (SIGNAL, float64, error) {
+	var wait, long, short float64
+	switch len(output) {
+	case 1:
+		long = float64(output[0])
+		short = 1 - long
+	case 3:
+		wait, long, short = float64(output[0]), float64(output[1]), float64(output[2])
+	default:
+		return SignalWait, 0, fmt.Errorf("%w (%d outputs)", ErrModelOutput, len(output))
+	}
+	switch {
+	case long >= threshold && long > short:
+		return SignalLong, long, nil
+	case short >= threshold && short > long:
+		return SignalShort, short, nil
+	}
+	return SignalWait, math.Max(wait, 1-math.Max(long, short)), nil
+}
+
+// ModelAnalyzer is an analysis plugin that emits the signals of a machine learning model.
+type ModelAnalyzer struct {
+	options      *AnalysisOptions
+	prices       []float64
+	candles      []OHLC
+	currentPrice float64
+}
+
+// Description gives a brief summary of what the plugin does and how.
+func (plugin *ModelAnalyzer) Description() string {
+	return `"Model feeds the latest candles and a few indicators of an asset to your own machine learning model, e.g. an
+	ONNX model, and trades on the probabilities it outputs. Small networks of fully connected layers are supported. When
+	the model can not be run another plugin is used instead."`
+}
+
+// SetOptions ...
+func (plugin *ModelAnalyzer) SetOptions(opts *AnalysisOptions) error {
+	plugin.options = opts
+	return nil
+}
+
+// SetClosingPrices ...
+func (plugin *ModelAnalyzer) SetClosingPrices(prices []float64) error {
+	plugin.prices = prices
+	return nil
+}
+
+// SetCurrentPrice ...
+func (plugin *ModelAnalyzer) SetCurrentPrice(price float64) error {
+	plugin.currentPrice = price
+	return nil
+}
+
+// SetOHLC ...
+func (plugin *ModelAnalyzer) SetOHLC(candles []OHLC) error {
+	plugin.candles = candles
+	return nil
+}
+
+// Emit runs the model on the price data and returns its signal.
+func (plugin *ModelAnalyzer) Emit() (signal SIGNAL, err error) {
+	signal, _, err = plugin.EmitConfidence()
+	return
+}
+
+// EmitConfidence runs the model on the price data and returns its signal and the probability of it.
+// If the model is missing or there is no runtime for it, the fallback plugin is run instead.
+func (plugin *ModelAnalyzer) EmitConfidence() (SIGNAL, float64, error) {
+	settings := cfg().Trade.Model
+	model, err := loadModel(settings.path())
+	if errors.Is(err, ErrNoModel) || errors.Is(err, ErrNoModelRuntime) {
+		return plugin.fallback(settings.Fallback, err)
+	}
+	if err != nil {
+		return SignalWait, 0, err
+	}
+	features, err := modelFeatures(plugin.candles, plugin.prices, plugin.currentPrice, settings.Window)
+	if err != nil {
+		return SignalWait, 0, err
+	}
+	output, err := model.Run(features)
+	if err != nil {
+		return SignalWait, 0, err
+	}
+	return modelSignal(output, settings.Threshold)
+}
+
+// fallback runs the plugin named `name` on the price data because the model could not be run.
+func (plugin *ModelAnalyzer) fallback(name string, reason error) (SIGNAL, float64, error) {
+	fallback, ok := PluginHandler.plugins[strings.ToLower(name)]
+	if !ok || name == "" || strings.ToLower(name) == ModelPlugin {
+		return SignalWait, 0, reason
+	}
+	debugf("The model could not be run, the %s plugin is used instead. Reason: %v", name, reason)
+	asset := ""
+	if plugin.options != nil {
+		asset = plugin.options.Asset
+	}
+	fallback, shared := PluginHandler.instance(fallback, asset)
+	defer lockShared(shared)()
+	return runAnalyzer(fallback, plugin.options, plugin.prices, plugin.candles, plugin.currentPrice)
+}
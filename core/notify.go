@@ -0,0 +1,347 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `notify.go` routes notifications about the bot's activities to the channels chosen by the user.
+*  Notifications sent through the network, e.g. to Telegram, are queued and sent by a goroutine of their
+*  own, so a slow channel never holds up trading.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType classifies a notification.
+type EventType string
+
+const (
+	// EventError is sent when something has gone wrong.
+	EventError EventType = "ERROR"
+	// EventTrade is sent whenever an order is placed on the exchange.
+	EventTrade EventType = "TRADE"
+	// EventAlert is sent for conditions that need the user's attention but are not errors.
+	EventAlert EventType = "ALERT"
+	// EventInfo is sent for general information about the bot's activities.
+	EventInfo EventType = "INFO"
+)
+
+// Delivery specifies when a notification is sent through a channel.
+type Delivery string
+
+const (
+	// DeliverImmediately sends the notification as soon as the event occurs.
+	DeliverImmediately Delivery = "IMMEDIATE"
+	// DeliverDigest collects notifications and sends them once a day.
+	DeliverDigest Delivery = "DIGEST"
+)
+
+// Notification channel names.
+const (
+	NotifyUI       = "ui"
+	NotifyTelegram = "telegram"
+	NotifyEmail    = "email"
+)
+
+// ErrNotifierNotConfigured is returned by a notifier that is missing its settings.
+var ErrNotifierNotConfigured = errors.New("the notification channel has not been configured")
+
+// Event is a single notification.
+type Event struct {
+	Type    EventType
+	Asset   string
+	Message string
+	Time    time.Time
+}
+
+func (e Event) String() string {
+	if e.Asset != "" {
+		return fmt.Sprintf("%s [%s] %s: %s", e.Time.Format(timeFormat), e.Type, e.Asset, e.Message)
+	}
+	return fmt.Sprintf("%s [%s] %s", e.Time.Format(timeFormat), e.Type, e.Message)
+}
+
+// Notifier delivers notifications through a single channel, e.g. email.
+// Custom notifiers can be added with `RegisterNotifier`.
+type Notifier interface {
+	// Name returns the unique name of the channel used in notification rules.
+	Name() string
+	// Notify sends one or more events through the channel.
+	Notify(events []Event) error
+}
+
+// NotificationRule routes events of a type to a channel.
+type NotificationRule struct {
+	Event    EventType
+	Channel  string
+	Delivery Delivery
+}
+
+// NotificationSettings holds the user's notification rules and the settings of each channel.
+type NotificationSettings struct {
+	Rules    []NotificationRule
+	Telegram struct {
+		BotToken string
+		ChatID   string
+	}
+	SMTP struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+	}
+}
+
+// DefaultNotificationRules sends errors to Telegram immediately, trades to a daily email digest,
+// and everything else to the UI only.
+var DefaultNotificationRules = []NotificationRule{
+	{Event: EventError, Channel: NotifyUI, Delivery: DeliverImmediately},
+	{Event: EventError, Channel: NotifyTelegram, Delivery: DeliverImmediately},
+	{Event: EventTrade, Channel: NotifyUI, Delivery: DeliverImmediately},
+	{Event: EventTrade, Channel: NotifyEmail, Delivery: DeliverDigest},
+	{Event: EventAlert, Channel: NotifyUI, Delivery: DeliverImmediately},
+	{Event: EventInfo, Channel: NotifyUI, Delivery: DeliverImmediately},
+}
+
+var (
+	// notifications is the package wide notification router.
+	notifications = NewNotificationRouter()
+	// digestInterval is how often digests are sent.
+	digestInterval = 24 * time.Hour
+)
+
+// notificationQueueSize is the number of immediate notifications that may wait to be sent. Notifications
+// sent while the queue is full are dropped.
+const notificationQueueSize = 64
+
+// delivery is a notification waiting to be sent through a channel.
+type delivery struct {
+	notifier Notifier
+	events   []Event
+}
+
+// NotificationRouter sends events to notifiers according to the user's rules.
+type NotificationRouter struct {
+	mu         sync.Mutex
+	notifiers  map[string]Notifier
+	rules      []NotificationRule
+	digests    map[string][]Event
+	lastDigest time.Time
+	queue      chan delivery
+	start      sync.Once
+}
+
+// NewNotificationRouter creates a router with the built-in UI notifier registered.
+func NewNotificationRouter() *NotificationRouter {
+	r := &NotificationRouter{
+		notifiers:  map[string]Notifier{},
+		rules:      DefaultNotificationRules,
+		digests:    map[string][]Event{},
+		lastDigest: time.Now(),
+		queue:      make(chan delivery, notificationQueueSize),
+	}
+	r.Register(uiNotifier{})
+	return r
+}
+
+// RegisterNotifier makes a custom notification channel available to notification rules.
+func RegisterNotifier(n Notifier) {
+	notifications.Register(n)
+}
+
+// Register adds a notifier to the router. A notifier with the same name is replaced.
+func (r *NotificationRouter) Register(n Notifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifiers[strings.ToLower(n.Name())] = n
+}
+
+// Unregister removes the notifier `name` from the router.
+func (r *NotificationRouter) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.notifiers, strings.ToLower(name))
+}
+
+// Configure applies the user's notification settings. Telegram and email are removed once their
+// settings are cleared.
+func (r *NotificationRouter) Configure(settings NotificationSettings) {
+	if settings.Telegram.BotToken != "" && settings.Telegram.ChatID != "" {
+		r.Register(&telegramNotifier{token: settings.Telegram.BotToken, chatID: settings.Telegram.ChatID})
+	} else {
+		r.Unregister(NotifyTelegram)
+	}
+	if settings.SMTP.Host != "" {
+		r.Register(&emailNotifier{settings: settings})
+	} else {
+		r.Unregister(NotifyEmail)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(settings.Rules) > 0 {
+		r.rules = settings.Rules
+	} else {
+		r.rules = DefaultNotificationRules
+	}
+}
+
+// Notify routes an event to every channel with a matching rule. It does not wait for the event to be
+// sent, apart from the UI, which shows it at once.
+func (r *NotificationRouter) Notify(evt Event) {
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	r.mu.Lock()
+	immediate := []Notifier{}
+	for _, rule := range r.rules {
+		if rule.Event != evt.Type {
+			continue
+		}
+		channel := strings.ToLower(rule.Channel)
+		n, ok := r.notifiers[channel]
+		if !ok {
+			continue
+		}
+		switch rule.Delivery {
+		case DeliverDigest:
+			r.digests[channel] = append(r.digests[channel], evt)
+		default:
+			immediate = append(immediate, n)
+		}
+	}
+	r.mu.Unlock()
+	for _, n := range immediate {
+		if _, ok := n.(uiNotifier); ok {
+			n.Notify([]Event{evt})
+			continue
+		}
+		r.send(n, []Event{evt})
+	}
+}
+
+// send queues `events` to be sent through `n`.
+func (r *NotificationRouter) send(n Notifier, events []Event) {
+	r.start.Do(func() { go r.deliver() })
+	select {
+	case r.queue <- delivery{notifier: n, events: events}:
+	default:
+		Logger.Printf("Dropped a notification for %s as too many are waiting to be sent.", n.Name())
+	}
+}
+
+// deliver sends the queued notifications one at a time.
+func (r *NotificationRouter) deliver() {
+	for d := range r.queue {
+		if err := d.notifier.Notify(d.events); err != nil {
+			Logger.Printf("Could not send notification through %s. Reason: %v", d.notifier.Name(), err)
+		}
+	}
+}
+
+// FlushDigests sends the collected digests if they are due, or right away if `force` is true.
+func (r *NotificationRouter) FlushDigests(force bool) {
+	r.mu.Lock()
+	if !force && time.Since(r.lastDigest) < digestInterval {
+		r.mu.Unlock()
+		return
+	}
+	digests := r.digests
+	r.digests = map[string][]Event{}
+	r.lastDigest = time.Now()
+	r.mu.Unlock()
+	for channel, events := range digests {
+		if len(events) == 0 {
+			continue
+		}
+		r.mu.Lock()
+		n, ok := r.notifiers[channel]
+		r.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if err := n.Notify(events); err != nil {
+			Logger.Printf("Could not send %s digest. Reason: %v", n.Name(), err)
+		}
+	}
+}
+
+// notify sends a notification through the package wide router.
+func notify(kind EventType, asset, format string, v ...interface{}) {
+	notifications.Notify(Event{Type: kind, Asset: asset, Message: fmt.Sprintf(format, v...), Time: time.Now()})
+}
+
+// uiNotifier shows notifications in the UI's activity log.
+type uiNotifier struct{}
+
+func (uiNotifier) Name() string { return NotifyUI }
+
+func (uiNotifier) Notify(events []Event) error {
+	for _, evt := range events {
+		debugf("[%s] %s", evt.Type, evt.Message)
+	}
+	return nil
+}
+
+// telegramNotifier sends notifications to a Telegram chat through the bot API.
+type telegramNotifier struct {
+	token, chatID string
+}
+
+func (t *telegramNotifier) Name() string { return NotifyTelegram }
+
+func (t *telegramNotifier) Notify(events []Event) error {
+	if t.token == "" || t.chatID == "" {
+		return ErrNotifierNotConfigured
+	}
+	lines := []string{}
+	for _, evt := range events {
+		lines = append(lines, evt.String())
+	}
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", t.token)
+	client := http.Client{Timeout: 15 * time.Second}
+	res, err := client.PostForm(endpoint, url.Values{"chat_id": {t.chatID}, "text": {strings.Join(lines, "\n")}})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("telegram: %s", res.Status)
+	}
+	return nil
+}
+
+// emailNotifier sends notifications to the user's email address.
+type emailNotifier struct {
+	settings NotificationSettings
+}
+
+func (e *emailNotifier) Name() string { return NotifyEmail }
+
+func (e *emailNotifier) Notify(events []Event) error {
+	smtpCfg := e.settings.SMTP
+	if smtpCfg.Host == "" || cfg().EmailAddress == "" {
+		return ErrNotifierNotConfigured
+	}
+	subject := "Leprechaun notification"
+	if len(events) > 1 {
+		subject = fmt.Sprintf("Leprechaun digest (%d events)", len(events))
+	}
+	body := strings.Builder{}
+	fmt.Fprintf(&body, "To: %s\r\nSubject: %s\r\n\r\n", cfg().EmailAddress, subject)
+	for _, evt := range events {
+		body.WriteString(evt.String() + "\r\n")
+	}
+	addr := fmt.Sprintf("%s:%d", smtpCfg.Host, smtpCfg.Port)
+	auth := smtp.PlainAuth("", smtpCfg.Username, smtpCfg.Password, smtpCfg.Host)
+	sender := smtpCfg.Username
+	if sender == "" {
+		sender = cfg().EmailAddress
+	}
+	return smtp.SendMail(addr, auth, sender, []string{cfg().EmailAddress}, []byte(body.String()))
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+// slowNotifier takes `delay` to send each notification, like a channel behind a slow network.
+type slowNotifier struct {
+	delay time.Duration
+	sent  chan []Event
+}
+
+func (n *slowNotifier) Name() string { return "slow" }
+
+func (n *slowNotifier) Notify(events []Event) error {
+	time.Sleep(n.delay)
+	n.sent <- events
+	return nil
+}
+
+func TestNotifyDoesNotWait(t *testing.T) {
+	r := NewNotificationRouter()
+	n := &slowNotifier{delay: time.Second, sent: make(chan []Event, 1)}
+	r.Register(n)
+	r.Configure(NotificationSettings{Rules: []NotificationRule{{Event: EventError, Channel: "slow", Delivery: DeliverImmediately}}})
+	started := time.Now()
+	r.Notify(Event{Type: EventError, Message: "failed"})
+	if waited := time.Since(started); waited >= n.delay {
+		t.Errorf("Notify waited %s for the notification to be sent", waited)
+	}
+	select {
+	case events := <-n.sent:
+		if len(events) != 1 || events[0].Message != "failed" {
+			t.Errorf("sent %v, want the event", events)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the notification was not sent")
+	}
+}
+
+func TestConfigureRemovesDisabledChannels(t *testing.T) {
+	r := NewNotificationRouter()
+	settings := NotificationSettings{}
+	settings.Telegram.BotToken, settings.Telegram.ChatID = "token", "chat"
+	settings.SMTP.Host = "smtp.example.com"
+	r.Configure(settings)
+	for _, name := range []string{NotifyTelegram, NotifyEmail} {
+		if _, ok := r.notifiers[name]; !ok {
+			t.Fatalf("%s was not registered", name)
+		}
+	}
+	r.Configure(NotificationSettings{})
+	for _, name := range []string{NotifyTelegram, NotifyEmail} {
+		if _, ok := r.notifiers[name]; ok {
+			t.Errorf("%s is still registered after its settings were cleared", name)
+		}
+	}
+	if _, ok := r.notifiers[NotifyUI]; !ok {
+		t.Error("the UI was unregistered")
+	}
+}
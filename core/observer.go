@@ -0,0 +1,167 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `observer.go` writes the state of a running bot to a file that can be opened by the UI in
+*  observer mode, e.g. when the bot runs headless on a server.
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrStateFileCorrupt is returned when the checksum of a state file does not match its contents.
+	ErrStateFileCorrupt = errors.New("the state file is corrupt or incomplete")
+
+	// stateFileVersion is incremented whenever the layout of `BotState` changes.
+	stateFileVersion = 1
+	// maxStateLogs is the number of recent log lines kept in the state file.
+	maxStateLogs = 200
+
+	recentLogs   []string
+	recentLogsMu sync.Mutex
+)
+
+// BotState is a read-only view of a running bot.
+type BotState struct {
+	Version   int
+	Updated   time.Time
+	Running   bool
+	Assets    []string
+	Positions []Record          // Open records in the ledger.
+	Stats     map[string]string // All time stats of each asset, as returned by `GetStats`.
+	Sales     []*ProfitEntry    // Recent sales.
+	Purchases []*ProfitEntry    // Recent purchases.
+	Snapshot  *ProfitSnapshot   // Latest profit snapshot, if any.
+	Logs      []string          // Recent log lines, oldest first.
+}
+
+// stateEnvelope wraps the state with a checksum so readers can tell a complete file from a torn one.
+type stateEnvelope struct {
+	Checksum string
+	State    json.RawMessage
+}
+
+// recordLog keeps a log line for the state file.
+func recordLog(line string) {
+	recentLogsMu.Lock()
+	defer recentLogsMu.Unlock()
+	recentLogs = append(recentLogs, line)
+	if len(recentLogs) > maxStateLogs {
+		recentLogs = recentLogs[len(recentLogs)-maxStateLogs:]
+	}
+}
+
+// StateFilePath returns the path of the state file set in the config, or the default path in the data folder.
+func StateFilePath() string {
+	if cfg().StateFile != "" {
+		return cfg().StateFile
+	}
+	return filepath.Join(dataDir(), "state.json")
+}
+
+// collectState gathers the current state of the bot.
+func (bot *Bot) collectState(running bool) (state BotState) {
+	state.Version = stateFileVersion
+	state.Updated = time.Now()
+	state.Running = running
+	state.Assets = cfg().AssetsToTrade
+	state.Stats = map[string]string{}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	if records, err := ledger.AllRecords(); err == nil {
+		state.Positions = records
+	}
+	for _, asset := range cfg().AssetsToTrade {
+		if stats, err := GetStats(asset); err == nil {
+			state.Stats[asset] = stats
+		}
+	}
+	// Only the latest entries are shared, so the state stays small however long the bot has traded.
+	sales, _ := GetSales()
+	purchases, _ := GetPurchases()
+	state.Sales, state.Purchases = latestEntries(sales, maxRecordsToSave), latestEntries(purchases, maxRecordsToSave)
+	if snapshots, err := GetSnapshots(time.Now().Add(-24 * time.Hour)); err == nil && len(snapshots) > 0 {
+		state.Snapshot = &snapshots[len(snapshots)-1]
+	}
+	recentLogsMu.Lock()
+	state.Logs = append([]string{}, recentLogs...)
+	recentLogsMu.Unlock()
+	return
+}
+
+// WriteStateFile writes a state to `path`. The file is replaced atomically so readers never see a partial write.
+func WriteStateFile(path string, state BotState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	envelope, err := json.Marshal(stateEnvelope{Checksum: hex.EncodeToString(sum[:]), State: data})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, envelope, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadStateFile reads a state file written by a running bot and verifies its checksum.
+func ReadStateFile(path string) (state BotState, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	envelope := stateEnvelope{}
+	if err = json.Unmarshal(data, &envelope); err != nil {
+		return state, ErrStateFileCorrupt
+	}
+	sum := sha256.Sum256(envelope.State)
+	if hex.EncodeToString(sum[:]) != envelope.Checksum {
+		return state, ErrStateFileCorrupt
+	}
+	err = json.Unmarshal(envelope.State, &state)
+	return
+}
+
+// runStateWriter writes the state file every `config.StateFileInterval` seconds until `stop` is closed.
+// A final state marked as not running is written on exit.
+func (bot *Bot) runStateWriter(stop chan struct{}) {
+	if !cfg().WriteStateFile {
+		return
+	}
+	interval := time.Duration(cfg().StateFileInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	path := StateFilePath()
+	go func() {
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			if err := WriteStateFile(path, bot.collectState(true)); err != nil {
+				Logger.Printf("Could not write state file. Reason: %v", err)
+			}
+			select {
+			case <-stop:
+				WriteStateFile(path, bot.collectState(false))
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+}
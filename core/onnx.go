@@ -0,0 +1,633 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `onnx.go` is the model runtime Leprechaun ships with. It reads ONNX model files in pure Go, without
+*  cgo or native libraries, and runs the small networks usually trained to output signal probabilities:
+*  fully connected layers (Gemm, MatMul and Add), the common activations and Softmax. The model gets one
+*  row of features at a time. Models that use other operators are rejected when they are loaded. A build
+*  that needs them can register another runtime, e.g. one that wraps the ONNX runtime, with
+*  `RegisterModelRuntime`.
+ */
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// ErrModelFormat is returned when a model file is not an ONNX model Leprechaun can run.
+var ErrModelFormat = errors.New("the model is not an ONNX model Leprechaun can run")
+
+// ONNX tensor data types read by the runtime.
+const (
+	onnxFloat  = 1
+	onnxInt64  = 7
+	onnxDouble = 11
+)
+
+// onnxOperators holds the number of inputs each supported operator needs.
+var onnxOperators = map[string]int{
+	"Identity": 1, "Dropout": 1, "Flatten": 1, "Reshape": 2,
+	"MatMul": 2, "Gemm": 2, "Add": 2, "Sub": 2, "Mul": 2, "Div": 2,
+	"Relu": 1, "LeakyRelu": 1, "Sigmoid": 1, "Tanh": 1, "Softmax": 1,
+}
+
+func init() {
+	// The runtime is always available. A build may replace it with `RegisterModelRuntime`.
+	modelLoader = LoadONNXModel
+}
+
+// onnxTensor is a tensor of the model, with its values in row-major order.
+type onnxTensor struct {
+	dims []int
+	data []float32
+}
+
+// matrix returns the tensor as a matrix. The last dimension is the columns, and the others the rows.
+func (t onnxTensor) matrix() (rows, cols int) {
+	if len(t.dims) == 0 {
+		return 1, 1
+	}
+	if cols = t.dims[len(t.dims)-1]; cols == 0 {
+		return 0, 0
+	}
+	return len(t.data) / cols, cols
+}
+
+// onnxNode is a single operation of the model's graph.
+type onnxNode struct {
+	op      string
+	inputs  []string
+	outputs []string
+	floats  map[string]float32
+	ints    map[string]int64
+}
+
+// float returns the float attribute `name`, or `fallback` if the node does not set it.
+func (n onnxNode) float(name string, fallback float32) float32 {
+	if f, ok := n.floats[name]; ok {
+		return f
+	}
+	return fallback
+}
+
+// ONNXModel is an ONNX model loaded by the pure Go runtime.
+type ONNXModel struct {
+	nodes   []onnxNode
+	weights map[string]onnxTensor
+	input   string
+	output  string
+}
+
+// LoadONNXModel reads the ONNX model at `path`.
+func LoadONNXModel(path string) (Model, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	model, err := ParseONNXModel(data)
+	if err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// ParseONNXModel reads an ONNX model from the serialized model `data`. It returns an error wrapping
+// ErrModelFormat if the model can not be read or uses an operator the runtime does not support.
+func ParseONNXModel(data []byte) (*ONNXModel, error) {
+	fields, err := protoFields(data)
+	if err != nil {
+		return nil, err
+	}
+	model := &ONNXModel{weights: map[string]onnxTensor{}}
+	var inputs, outputs []string
+	found := false
+	for _, f := range fields {
+		if f.num != 7 || f.wire != 2 {
+			continue
+		}
+		// ModelProto.graph
+		found = true
+		if inputs, outputs, err = model.readGraph(f.bytes); err != nil {
+			return nil, err
+		}
+	}
+	if !found || len(model.nodes) == 0 || len(outputs) == 0 {
+		return nil, fmt.Errorf("%w (the model has no graph)", ErrModelFormat)
+	}
+	for _, name := range inputs {
+		// Older models list their weights among the inputs as well.
+		if _, ok := model.weights[name]; !ok {
+			model.input = name
+			break
+		}
+	}
+	if model.input == "" {
+		return nil, fmt.Errorf("%w (the model has no input)", ErrModelFormat)
+	}
+	model.output = outputs[0]
+	return model, model.check()
+}
+
+// readGraph reads the nodes and weights of a GraphProto and returns the names of its inputs and outputs.
+func (m *ONNXModel) readGraph(data []byte) (inputs, outputs []string, err error) {
+	fields, err := protoFields(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range fields {
+		if f.wire != 2 {
+			continue
+		}
+		switch f.num {
+		case 1: // node
+			node, err := readNode(f.bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			if node.op == "Constant" {
+				// Constants are weights computed once.
+				if len(node.outputs) == 1 {
+					if t, ok := node.constant(); ok {
+						m.weights[node.outputs[0]] = t
+						continue
+					}
+				}
+				return nil, nil, fmt.Errorf("%w (a constant holds no tensor)", ErrModelFormat)
+			}
+			m.nodes = append(m.nodes, node.onnxNode)
+		case 5: // initializer
+			name, t, err := readTensor(f.bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			m.weights[name] = t
+		case 11, 12: // input, output
+			name := ""
+			if vf, err := protoFields(f.bytes); err == nil {
+				for _, v := range vf {
+					if v.num == 1 && v.wire == 2 {
+						name = string(v.bytes)
+					}
+				}
+			}
+			if f.num == 11 {
+				inputs = append(inputs, name)
+			} else {
+				outputs = append(outputs, name)
+			}
+		}
+	}
+	return inputs, outputs, nil
+}
+
+// check returns an error if a node uses an unsupported operator or a value that is not computed before it.
+func (m *ONNXModel) check() error {
+	known := map[string]bool{m.input: true}
+	for name := range m.weights {
+		known[name] = true
+	}
+	for _, node := range m.nodes {
+		needs, ok := onnxOperators[node.op]
+		if !ok {
+			return fmt.Errorf("%w (the model uses the %s operator)", ErrModelFormat, node.op)
+		}
+		if len(node.inputs) < needs || len(node.outputs) == 0 {
+			return fmt.Errorf("%w (a %s node is missing its inputs or output)", ErrModelFormat, node.op)
+		}
+		for _, input := range node.inputs {
+			if input != "" && !known[input] {
+				return fmt.Errorf("%w (%s is used before it is computed)", ErrModelFormat, input)
+			}
+		}
+		known[node.outputs[0]] = true
+	}
+	if !known[m.output] {
+		return fmt.Errorf("%w (the output %s is never computed)", ErrModelFormat, m.output)
+	}
+	return nil
+}
+
+// Run returns the output of the model for one row of `features`.
+func (m *ONNXModel) Run(features []float32) ([]float32, error) {
+	values := map[string]onnxTensor{m.input: {dims: []int{1, len(features)}, data: append([]float32{}, features...)}}
+	value := func(name string) (onnxTensor, bool) {
+		if t, ok := values[name]; ok {
+			return t, true
+		}
+		t, ok := m.weights[name]
+		return t, ok
+	}
+	for _, node := range m.nodes {
+		in := make([]onnxTensor, len(node.inputs))
+		for i, name := range node.inputs {
+			if name != "" {
+				in[i], _ = value(name)
+			}
+		}
+		out, err := node.run(in)
+		if err != nil {
+			return nil, fmt.Errorf("could not run the %s node of the model: %w", node.op, err)
+		}
+		values[node.outputs[0]] = out
+	}
+	out, _ := value(m.output)
+	return out.data, nil
+}
+
+// run computes the output of the node from its inputs.
+func (n onnxNode) run(in []onnxTensor) (onnxTensor, error) {
+	x := in[0]
+	switch n.op {
+	case "Identity", "Dropout":
+		return x, nil
+	case "Flatten":
+		return onnxTensor{dims: []int{1, len(x.data)}, data: x.data}, nil
+	case "Reshape":
+		return reshape(x, in[1])
+	case "MatMul":
+		return matMul(x, in[1], false, false)
+	case "Gemm":
+		y, err := matMul(x, in[1], n.ints["transA"] != 0, n.ints["transB"] != 0)
+		if err != nil {
+			return y, err
+		}
+		alpha, beta := n.float("alpha", 1), n.float("beta", 1)
+		for i := range y.data {
+			y.data[i] *= alpha
+		}
+		if len(in) < 3 || len(in[2].data) == 0 {
+			return y, nil
+		}
+		c := onnxTensor{dims: in[2].dims, data: make([]float32, len(in[2].data))}
+		for i, v := range in[2].data {
+			c.data[i] = beta * v
+		}
+		return broadcast(y, c, func(a, b float32) float32 { return a + b })
+	case "Add":
+		return broadcast(x, in[1], func(a, b float32) float32 { return a + b })
+	case "Sub":
+		return broadcast(x, in[1], func(a, b float32) float32 { return a - b })
+	case "Mul":
+		return broadcast(x, in[1], func(a, b float32) float32 { return a * b })
+	case "Div":
+		return broadcast(x, in[1], func(a, b float32) float32 { return a / b })
+	case "Relu":
+		return apply(x, func(v float32) float32 { return float32(math.Max(float64(v), 0)) }), nil
+	case "LeakyRelu":
+		alpha := n.float("alpha", 0.01)
+		return apply(x, func(v float32) float32 {
+			if v < 0 {
+				return alpha * v
+			}
+			return v
+		}), nil
+	case "Sigmoid":
+		return apply(x, func(v float32) float32 { return float32(1 / (1 + math.Exp(-float64(v)))) }), nil
+	case "Tanh":
+		return apply(x, func(v float32) float32 { return float32(math.Tanh(float64(v))) }), nil
+	case "Softmax":
+		return softmax(x), nil
+	}
+	return onnxTensor{}, fmt.Errorf("%w (the model uses the %s operator)", ErrModelFormat, n.op)
+}
+
+// apply returns a tensor holding `f` of each value of `x`.
+func apply(x onnxTensor, f func(float32) float32) onnxTensor {
+	y := onnxTensor{dims: x.dims, data: make([]float32, len(x.data))}
+	for i, v := range x.data {
+		y.data[i] = f(v)
+	}
+	return y
+}
+
+// matMul multiplies the matrices `a` and `b`, either of which may be transposed. A vector `b` is a column.
+func matMul(a, b onnxTensor, transA, transB bool) (onnxTensor, error) {
+	m, k := a.matrix()
+	bk, n := b.matrix()
+	if len(b.dims) == 1 {
+		bk, n = n, 1
+	}
+	at := func(i, j int) float32 { return a.data[i*k+j] }
+	if transA {
+		m, k = k, m
+		at = func(i, j int) float32 { return a.data[j*m+i] }
+	}
+	bt := func(i, j int) float32 { return b.data[i*n+j] }
+	if transB {
+		bk, n = n, bk
+		bt = func(i, j int) float32 { return b.data[j*bk+i] }
+	}
+	if k != bk {
+		return onnxTensor{}, fmt.Errorf("can not multiply a %dx%d matrix by a %dx%d matrix", m, k, bk, n)
+	}
+	y := onnxTensor{dims: []int{m, n}, data: make([]float32, m*n)}
+	for i := 0; i < m; i++ {
+		for j := 0; j < n; j++ {
+			var sum float32
+			for l := 0; l < k; l++ {
+				sum += at(i, l) * bt(l, j)
+			}
+			y.data[i*n+j] = sum
+		}
+	}
+	return y, nil
+}
+
+// broadcast combines `a` and `b` value by value with `f`. The smaller tensor is repeated along the larger
+// if it is a single value or a row as wide as the larger tensor's rows.
+func broadcast(a, b onnxTensor, f func(a, b float32) float32) (onnxTensor, error) {
+	swapped := len(b.data) > len(a.data)
+	large, small := a, b
+	if swapped {
+		large, small = b, a
+	}
+	_, cols := large.matrix()
+	if len(small.data) == 0 || (len(small.data) != len(large.data) && len(small.data) != 1 && len(small.data) != cols) {
+		return onnxTensor{}, fmt.Errorf("can not broadcast %v values over %v", small.dims, large.dims)
+	}
+	y := onnxTensor{dims: large.dims, data: make([]float32, len(large.data))}
+	for i, v := range large.data {
+		w := small.data[i%len(small.data)]
+		if swapped {
+			v, w = w, v
+		}
+		y.data[i] = f(v, w)
+	}
+	return y, nil
+}
+
+// softmax returns the softmax of each row of `x`.
+func softmax(x onnxTensor) onnxTensor {
+	y := onnxTensor{dims: x.dims, data: make([]float32, len(x.data))}
+	rows, cols := x.matrix()
+	for r := 0; r < rows; r++ {
+		row := x.data[r*cols : (r+1)*cols]
+		peak := math.Inf(-1)
+		for _, v := range row {
+			peak = math.Max(peak, float64(v))
+		}
+		sum := 0.0
+		for i, v := range row {
+			e := math.Exp(float64(v) - peak)
+			y.data[r*cols+i] = float32(e)
+			sum += e
+		}
+		for i := range row {
+			y.data[r*cols+i] /= float32(sum)
+		}
+	}
+	return y
+}
+
+// reshape returns `x` with the dimensions held in `shape`. A zero keeps the dimension of `x` and one
+// dimension may be -1, which takes the size left over.
+func reshape(x, shape onnxTensor) (onnxTensor, error) {
+	dims := make([]int, len(shape.data))
+	size, unknown := 1, -1
+	for i, v := range shape.data {
+		switch {
+		case v == 0 && i < len(x.dims):
+			dims[i] = x.dims[i]
+		case v == -1 && unknown < 0:
+			unknown = i
+			continue
+		case v < 0:
+			return onnxTensor{}, fmt.Errorf("invalid shape %v", shape.data)
+		default:
+			dims[i] = int(v)
+		}
+		size *= dims[i]
+	}
+	if unknown >= 0 && size > 0 {
+		dims[unknown] = len(x.data) / size
+		size *= dims[unknown]
+	}
+	if size != len(x.data) {
+		return onnxTensor{}, fmt.Errorf("can not reshape %d values to %v", len(x.data), dims)
+	}
+	return onnxTensor{dims: dims, data: x.data}, nil
+}
+
+// onnxNodeProto is a node as it is read from the model, with the tensor of a Constant.
+type onnxNodeProto struct {
+	onnxNode
+	value []byte
+}
+
+// constant returns the tensor of a Constant node.
+func (n onnxNodeProto) constant() (onnxTensor, bool) {
+	if n.value == nil {
+		return onnxTensor{}, false
+	}
+	_, t, err := readTensor(n.value)
+	return t, err == nil
+}
+
+// readNode reads a NodeProto.
+func readNode(data []byte) (node onnxNodeProto, err error) {
+	fields, err := protoFields(data)
+	if err != nil {
+		return
+	}
+	node.floats, node.ints = map[string]float32{}, map[string]int64{}
+	for _, f := range fields {
+		if f.wire != 2 {
+			continue
+		}
+		switch f.num {
+		case 1:
+			node.inputs = append(node.inputs, string(f.bytes))
+		case 2:
+			node.outputs = append(node.outputs, string(f.bytes))
+		case 4:
+			node.op = string(f.bytes)
+		case 5:
+			if domain := string(f.bytes); domain != "" && domain != "ai.onnx" {
+				return node, fmt.Errorf("%w (the model uses operators of the %s domain)", ErrModelFormat, domain)
+			}
+		case 7:
+			if err = node.readAttribute(f.bytes); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// readAttribute reads an AttributeProto of the node. Only float, int and tensor attributes are kept.
+func (n *onnxNodeProto) readAttribute(data []byte) error {
+	fields, err := protoFields(data)
+	if err != nil {
+		return err
+	}
+	var name string
+	for _, f := range fields {
+		if f.num == 1 && f.wire == 2 {
+			name = string(f.bytes)
+		}
+	}
+	for _, f := range fields {
+		switch {
+		case f.num == 2 && f.wire == 5:
+			n.floats[name] = math.Float32frombits(uint32(f.varint))
+		case f.num == 3 && f.wire == 0:
+			n.ints[name] = int64(f.varint)
+		case f.num == 5 && f.wire == 2:
+			n.value = f.bytes
+		}
+	}
+	return nil
+}
+
+// readTensor reads a TensorProto and returns its name and values.
+func readTensor(data []byte) (name string, t onnxTensor, err error) {
+	fields, err := protoFields(data)
+	if err != nil {
+		return
+	}
+	dataType := int64(onnxFloat)
+	var raw []byte
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			for _, d := range f.ints() {
+				t.dims = append(t.dims, int(d))
+			}
+		case 2:
+			dataType = int64(f.varint)
+		case 4:
+			t.data = append(t.data, f.floats()...)
+		case 7:
+			for _, v := range f.ints() {
+				t.data = append(t.data, float32(v))
+			}
+		case 8:
+			name = string(f.bytes)
+		case 9:
+			raw = f.bytes
+		case 10:
+			for _, v := range f.doubles() {
+				t.data = append(t.data, float32(v))
+			}
+		case 13, 14:
+			return name, t, fmt.Errorf("%w (the weights of %s are kept in another file)", ErrModelFormat, name)
+		}
+	}
+	if raw != nil {
+		t.data = t.data[:0]
+		switch dataType {
+		case onnxFloat:
+			for ; len(raw) >= 4; raw = raw[4:] {
+				t.data = append(t.data, math.Float32frombits(binary.LittleEndian.Uint32(raw)))
+			}
+		case onnxDouble:
+			for ; len(raw) >= 8; raw = raw[8:] {
+				t.data = append(t.data, float32(math.Float64frombits(binary.LittleEndian.Uint64(raw))))
+			}
+		case onnxInt64:
+			for ; len(raw) >= 8; raw = raw[8:] {
+				t.data = append(t.data, float32(int64(binary.LittleEndian.Uint64(raw))))
+			}
+		}
+	}
+	if dataType != onnxFloat && dataType != onnxDouble && dataType != onnxInt64 {
+		return name, t, fmt.Errorf("%w (%s holds values of type %d)", ErrModelFormat, name, dataType)
+	}
+	size := 1
+	for _, d := range t.dims {
+		size *= d
+	}
+	if size != len(t.data) {
+		return name, t, fmt.Errorf("%w (%s holds %d values, not %d)", ErrModelFormat, name, len(t.data), size)
+	}
+	return name, t, nil
+}
+
+// protoField is a field of a protocol buffers message. Fixed-size and varint values are held in `varint`.
+type protoField struct {
+	num    int
+	wire   int
+	varint uint64
+	bytes  []byte
+}
+
+// protoFields splits a serialized protocol buffers message into its fields.
+func protoFields(msg []byte) (fields []protoField, err error) {
+	truncated := fmt.Errorf("%w (the file is truncated or damaged)", ErrModelFormat)
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, truncated
+		}
+		msg = msg[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case 0:
+			if f.varint, n = binary.Uvarint(msg); n <= 0 {
+				return nil, truncated
+			}
+			msg = msg[n:]
+		case 1:
+			if len(msg) < 8 {
+				return nil, truncated
+			}
+			f.varint, msg = binary.LittleEndian.Uint64(msg), msg[8:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return nil, truncated
+			}
+			f.bytes, msg = msg[n:n+int(size)], msg[n+int(size):]
+		case 5:
+			if len(msg) < 4 {
+				return nil, truncated
+			}
+			f.varint, msg = uint64(binary.LittleEndian.Uint32(msg)), msg[4:]
+		default:
+			return nil, truncated
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// ints returns the integers of a repeated integer field, which may be packed.
+func (f protoField) ints() (values []int64) {
+	if f.wire != 2 {
+		return []int64{int64(f.varint)}
+	}
+	for b := f.bytes; len(b) > 0; {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			break
+		}
+		values, b = append(values, int64(v)), b[n:]
+	}
+	return values
+}
+
+// floats returns the values of a repeated float field, which may be packed.
+func (f protoField) floats() (values []float32) {
+	if f.wire != 2 {
+		return []float32{math.Float32frombits(uint32(f.varint))}
+	}
+	for b := f.bytes; len(b) >= 4; b = b[4:] {
+		values = append(values, math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	return values
+}
+
+// doubles returns the values of a repeated double field, which may be packed.
+func (f protoField) doubles() (values []float64) {
+	if f.wire != 2 {
+		return []float64{math.Float64frombits(f.varint)}
+	}
+	for b := f.bytes; len(b) >= 8; b = b[8:] {
+		values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	}
+	return values
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// protoMessage builds a serialized protocol buffers message, as an ONNX exporter writes it.
+type protoMessage []byte
+
+func (m protoMessage) uvarint(v uint64) protoMessage {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(m, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+func (m protoMessage) key(num, wire int) protoMessage {
+	return m.uvarint(uint64(num<<3 | wire))
+}
+
+func (m protoMessage) varint(num int, v int64) protoMessage {
+	return m.key(num, 0).uvarint(uint64(v))
+}
+
+func (m protoMessage) bytes(num int, b []byte) protoMessage {
+	return append(m.key(num, 2).uvarint(uint64(len(b))), b...)
+}
+
+func (m protoMessage) str(num int, s string) protoMessage {
+	return m.bytes(num, []byte(s))
+}
+
+func (m protoMessage) float(num int, f float32) protoMessage {
+	return append(m.key(num, 5), float32Bytes(f)...)
+}
+
+// float32Bytes returns `f` as it is serialized.
+func float32Bytes(f float32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, math.Float32bits(f))
+	return b
+}
+
+// tensorProto returns a float TensorProto named `name`. Its values are packed, or kept as raw data if `raw` is set.
+func tensorProto(name string, dims []int64, values []float32, raw bool) []byte {
+	var m protoMessage
+	for _, d := range dims {
+		m = m.varint(1, d)
+	}
+	m = m.varint(2, onnxFloat)
+	var data []byte
+	for _, v := range values {
+		data = append(data, float32Bytes(v)...)
+	}
+	if raw {
+		return m.str(8, name).bytes(9, data)
+	}
+	return m.bytes(4, data).str(8, name)
+}
+
+// nodeProto returns a NodeProto. Attributes are given as names and values, which are floats or ints.
+func nodeProto(op string, inputs, outputs []string, attributes ...interface{}) []byte {
+	var m protoMessage
+	for _, in := range inputs {
+		m = m.str(1, in)
+	}
+	for _, out := range outputs {
+		m = m.str(2, out)
+	}
+	m = m.str(4, op)
+	for i := 0; i+1 < len(attributes); i += 2 {
+		a := protoMessage{}.str(1, attributes[i].(string))
+		switch v := attributes[i+1].(type) {
+		case float32:
+			a = a.float(2, v).varint(20, 1)
+		case int:
+			a = a.varint(3, int64(v)).varint(20, 2)
+		}
+		m = m.bytes(7, a)
+	}
+	return m
+}
+
+// modelProto returns a ModelProto whose graph runs `nodes` on the input "x" and outputs "y".
+func modelProto(weights [][]byte, nodes ...[]byte) []byte {
+	var graph protoMessage
+	for _, node := range nodes {
+		graph = graph.bytes(1, node)
+	}
+	graph = graph.str(2, "test")
+	for _, w := range weights {
+		graph = graph.bytes(5, w)
+	}
+	graph = graph.bytes(11, protoMessage{}.str(1, "x")).bytes(12, protoMessage{}.str(1, "y"))
+	return protoMessage{}.varint(1, 7).str(2, "leprechaun").bytes(7, graph)
+}
+
+func TestONNXModel(t *testing.T) {
+	w := tensorProto("w", []int64{2, 3}, []float32{1, 0, -1, 0.5, 2, 0}, false)
+	b := tensorProto("b", []int64{3}, []float32{0, 1, 2}, true)
+	for _, test := range []struct {
+		name     string
+		model    []byte
+		features []float32
+		want     []float32
+	}{
+		{"gemm", modelProto([][]byte{w, b}, nodeProto("Gemm", []string{"x", "w", "b"}, []string{"y"})),
+			[]float32{2, 4}, []float32{4, 9, 0}},
+		{"gemm with transposed weights", modelProto([][]byte{tensorProto("w", []int64{3, 2}, []float32{1, 0.5, 0, 2, -1, 0}, false), b},
+			nodeProto("Gemm", []string{"x", "w", "b"}, []string{"y"}, "transB", 1, "alpha", float32(0.5), "beta", float32(2))),
+			[]float32{2, 4}, []float32{2, 6, 3}},
+		{"matmul, add and relu", modelProto([][]byte{w, b},
+			nodeProto("MatMul", []string{"x", "w"}, []string{"h"}),
+			nodeProto("Add", []string{"h", "b"}, []string{"z"}),
+			nodeProto("Relu", []string{"z"}, []string{"y"})),
+			[]float32{2, 4}, []float32{4, 9, 0}},
+		{"leaky relu", modelProto(nil, nodeProto("LeakyRelu", []string{"x"}, []string{"y"}, "alpha", float32(0.1))),
+			[]float32{-2, 3}, []float32{-0.2, 3}},
+		{"sigmoid", modelProto(nil, nodeProto("Sigmoid", []string{"x"}, []string{"y"})),
+			[]float32{0, float32(math.Log(3))}, []float32{0.5, 0.75}},
+		{"softmax", modelProto(nil, nodeProto("Softmax", []string{"x"}, []string{"y"})),
+			[]float32{0, float32(math.Log(3))}, []float32{0.25, 0.75}},
+		{"scale and shift", modelProto([][]byte{tensorProto("s", nil, []float32{2}, false)},
+			nodeProto("Mul", []string{"x", "s"}, []string{"m"}),
+			nodeProto("Sub", []string{"m", "s"}, []string{"y"})),
+			[]float32{1, 3}, []float32{0, 4}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			model, err := ParseONNXModel(test.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := model.Run(test.features)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("Run() = %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if math.Abs(float64(got[i]-test.want[i])) > 1e-5 {
+					t.Fatalf("Run() = %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestONNXModelErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		model []byte
+	}{
+		{"empty", nil},
+		{"truncated", modelProto(nil, nodeProto("Relu", []string{"x"}, []string{"y"}))[:10]},
+		{"unsupported operator", modelProto(nil, nodeProto("Conv", []string{"x"}, []string{"y"}))},
+		{"missing weights", modelProto(nil, nodeProto("MatMul", []string{"x", "w"}, []string{"y"}))},
+		{"output never computed", modelProto(nil, nodeProto("Relu", []string{"x"}, []string{"z"}))},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseONNXModel(test.model); !errors.Is(err, ErrModelFormat) {
+				t.Errorf("ParseONNXModel() returned %v, want ErrModelFormat", err)
+			}
+		})
+	}
+}
+
+// TestModelAnalyzer loads a tiny model from the data folder and trades on its output through the model plugin.
+func TestModelAnalyzer(t *testing.T) {
+	useTempLedger(t)
+	const window = 2
+	features := window*ModelFeaturesPerCandle + 3
+	// The hidden unit sums the features, and the model is confident of a long signal when it is positive.
+	w1 := make([]float32, features)
+	for i := range w1 {
+		w1[i] = 1
+	}
+	model := modelProto([][]byte{
+		tensorProto("w1", []int64{1, int64(features)}, w1, true),
+		tensorProto("b1", []int64{1}, []float32{0}, false),
+		tensorProto("w2", []int64{1, 3}, []float32{0, 4, -4}, false),
+	},
+		nodeProto("Gemm", []string{"x", "w1", "b1"}, []string{"h"}, "transB", 1),
+		nodeProto("Relu", []string{"h"}, []string{"r"}),
+		nodeProto("MatMul", []string{"r", "w2"}, []string{"z"}),
+		nodeProto("Softmax", []string{"z"}, []string{"y"}),
+	)
+	if err := ioutil.WriteFile(filepath.Join(cfg().DataDir, "tiny.onnx"), model, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := cfg().Clone()
+	c.Trade.Model = ModelSettings{Path: "tiny.onnx", Window: window, Threshold: 0.9}
+	publishConfig(c)
+	if !ModelRuntimeAvailable() {
+		t.Fatal("no model runtime is available")
+	}
+
+	plugin := &ModelAnalyzer{}
+	plugin.SetOHLC([]OHLC{bar(100, 101, 99, 100), bar(100, 102, 99.5, 101)})
+	plugin.SetClosingPrices([]float64{100, 101})
+	plugin.SetCurrentPrice(101)
+	signal, confidence, err := plugin.EmitConfidence()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signal != SignalLong || confidence < 0.9 {
+		t.Errorf("EmitConfidence() = %v, %v, want a long signal with a confidence of at least 0.9", signal, confidence)
+	}
+}
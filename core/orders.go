@@ -0,0 +1,586 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `orders.go` holds the order tracker. The tracker owns every order Leprechaun places on the
+*  exchange and follows it until it is either complete or cancelled.
+ */
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	luno "github.com/luno/luno-go"
+)
+
+// OrderState is the lifecycle state of an order placed by Leprechaun.
+type OrderState string
+
+const (
+	// OrderPending is an order that has been placed but not filled at all.
+	OrderPending OrderState = "PENDING"
+	// OrderPartiallyFilled is an order that has been partly filled and is still in the order book.
+	OrderPartiallyFilled OrderState = "PARTIALLY_FILLED"
+	// OrderComplete is an order that has been completely filled.
+	OrderComplete OrderState = "COMPLETE"
+	// OrderCancelled is an order that was removed from the order book before it was completely filled.
+	OrderCancelled OrderState = "CANCELLED"
+)
+
+// orderTransitions lists the states an order may move to from each state.
+var orderTransitions = map[OrderState][]OrderState{
+	OrderPending:         {OrderPartiallyFilled, OrderComplete, OrderCancelled},
+	OrderPartiallyFilled: {OrderPartiallyFilled, OrderComplete, OrderCancelled},
+	OrderComplete:        {},
+	OrderCancelled:       {},
+}
+
+// IsFinal returns true if an order in this state will not change anymore.
+func (s OrderState) IsFinal() bool {
+	return s == OrderComplete || s == OrderCancelled
+}
+
+// CanTransition returns true if an order may move from state `s` to state `next`.
+func (s OrderState) CanTransition(next OrderState) bool {
+	for _, state := range orderTransitions[s] {
+		if state == next {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrUnknownOrder is returned when the tracker is asked about an order it does not own.
+	ErrUnknownOrder = errors.New("the order is not tracked by leprechaun")
+	// ErrInvalidOrderTransition is returned for an illegal change of an order's state.
+	ErrInvalidOrderTransition = errors.New("invalid order state transition")
+)
+
+var (
+	// orderTracker is the tracker used by the running bot.
+	orderTracker *OrderTracker
+
+	// trackerInterval is how often the tracker checks its orders.
+	trackerInterval = 15 * time.Second
+	// trackerMinBackoff and trackerMaxBackoff bound the delay between updates of a single order.
+	trackerMinBackoff = 10 * time.Second
+	trackerMaxBackoff = 10 * time.Minute
+	// trackerRetention is how long finished orders are kept on file.
+	trackerRetention = 7 * 24 * time.Hour
+	// partialFillTolerance is the share of an order's requested volume that may go unfilled before the
+	// order counts as partly filled. Market buys are placed for an amount of fiat, so the volume they
+	// fill drifts slightly from the requested volume as the price moves.
+	partialFillTolerance = 0.02
+)
+
+// closingLocks holds a mutex for each asset, which is held while its positions are closed: by the trade
+// completion of the asset while it picks records and places the orders that close them, and by the order
+// tracker while it opens the rest of a record again and places the order that closes it. So a record that
+// is opened again can not be closed twice.
+var closingLocks sync.Map
+
+// lockClosing holds the closing mutex of `asset`. The returned func releases it.
+func lockClosing(asset string) (unlock func()) {
+	mu, _ := closingLocks.LoadOrStore(asset, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// TrackedOrder holds the state of a single order placed on the exchange.
+type TrackedOrder struct {
+	ID              string
+	Pair            string
+	Asset           string
+	Side            luno.OrderType // BUY or SELL
+	State           OrderState
+	RequestedVolume float64 // Volume of the asset Leprechaun asked for.
+	FilledVolume    float64 // Volume of the asset that has been traded so far.
+	Counter         float64 // Fiat value of the filled volume.
+	FeeBase         float64
+	FeeCounter      float64
+	Placed          time.Time
+	Updated         time.Time
+	Attempts        int       // Consecutive failed attempts to update the order.
+	NextCheck       time.Time // Earliest time the order will be checked again.
+}
+
+// OrderTracker owns every order placed by leprechaun, follows each one through its
+// lifecycle and saves their state to file so they are not forgotten across restarts.
+type OrderTracker struct {
+	mu      sync.Mutex
+	orders  map[string]*TrackedOrder
+	clients map[string]*Client // Clients used to check orders, keyed by pair.
+	path    string
+	stop    chan struct{}
+	running bool
+}
+
+// NewOrderTracker creates an order tracker that saves its state to `path`.
+// Previously saved orders are loaded from the file.
+func NewOrderTracker(path string) *OrderTracker {
+	t := &OrderTracker{
+		orders:  map[string]*TrackedOrder{},
+		clients: map[string]*Client{},
+		path:    path,
+	}
+	if err := t.load(); err != nil && !os.IsNotExist(err) {
+		debugf("Could not load saved orders. Reason: %v", err)
+	}
+	if t.orders == nil {
+		t.orders = map[string]*TrackedOrder{}
+	}
+	return t
+}
+
+// Track adds a newly placed order to the tracker.
+func (t *OrderTracker) Track(cl *Client, orderID string, side luno.OrderType, volume float64) {
+	if orderID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.orders[orderID] = &TrackedOrder{
+		ID: orderID, Pair: cl.Pair, Asset: cl.asset, Side: side, State: OrderPending,
+		RequestedVolume: volume, Placed: now, Updated: now, NextCheck: now,
+	}
+	t.save()
+}
+
+// addClient follows the orders in the pair of a client started while the tracker is running.
+func (t *OrderTracker) addClient(cl *Client) {
+	t.mu.Lock()
+	t.clients[cl.Pair] = cl
+	t.mu.Unlock()
+}
+
+// Order returns a copy of a tracked order.
+func (t *OrderTracker) Order(orderID string) (order TrackedOrder, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o, ok := t.orders[orderID]
+	if !ok {
+		return order, ErrUnknownOrder
+	}
+	return *o, nil
+}
+
+// Orders returns copies of all tracked orders in the given states. If no state is given
+// all orders are returned.
+func (t *OrderTracker) Orders(states ...OrderState) (orders []TrackedOrder) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, o := range t.orders {
+		if len(states) == 0 {
+			orders = append(orders, *o)
+			continue
+		}
+		for _, s := range states {
+			if o.State == s {
+				orders = append(orders, *o)
+				break
+			}
+		}
+	}
+	return
+}
+
+// SetState moves an order to a new state, e.g. after it was stopped by the user.
+func (t *OrderTracker) SetState(orderID string, state OrderState) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o, ok := t.orders[orderID]
+	if !ok {
+		return ErrUnknownOrder
+	}
+	if err := o.transition(state); err != nil {
+		return err
+	}
+	t.save()
+	return nil
+}
+
+// Run starts the tracker goroutine. Orders for the pairs of `clients` are checked until Stop is called.
+func (t *OrderTracker) Run(clients []*Client) {
+	t.mu.Lock()
+	if t.running {
+		t.mu.Unlock()
+		return
+	}
+	for _, cl := range clients {
+		t.clients[cl.Pair] = cl
+	}
+	t.stop = make(chan struct{})
+	t.running = true
+	t.mu.Unlock()
+
+	go func() {
+		tick := time.NewTicker(trackerInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-tick.C:
+				t.update()
+				t.cancelStale()
+			}
+		}
+	}()
+}
+
+// Stop stops the tracker goroutine and saves the state of all orders.
+func (t *OrderTracker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.running {
+		return
+	}
+	close(t.stop)
+	t.running = false
+	t.save()
+}
+
+// update checks every unfinished order that is due for a check.
+func (t *OrderTracker) update() {
+	now := time.Now()
+	for _, o := range t.Orders(OrderPending, OrderPartiallyFilled) {
+		if now.Before(o.NextCheck) {
+			continue
+		}
+		t.mu.Lock()
+		cl, ok := t.clients[o.Pair]
+		t.mu.Unlock()
+		if !ok {
+			continue
+		}
+		details, err := cl.CheckOrder(o.ID)
+		t.mu.Lock()
+		order := t.orders[o.ID]
+		if err != nil {
+			// Back off exponentially before trying this order again.
+			order.Attempts++
+			order.NextCheck = now.Add(backoff(order.Attempts))
+			debugf("Could not update order %s (attempt %d). Reason: %v", o.ID, order.Attempts, err)
+		} else {
+			order.Attempts = 0
+			order.NextCheck = now.Add(trackerMinBackoff)
+			order.apply(details)
+		}
+		finished := order.State.IsFinal()
+		updated := *order
+		t.save()
+		t.mu.Unlock()
+		if finished {
+			finish(cl, updated)
+		}
+	}
+}
+
+// cancelStale stops orders that have been pending for longer than `config.Trade.StaleOrderTimeout`.
+// The unfilled volume of a cancelled order is either placed again at the current price or
+// abandoned, depending on `config.Trade.RepriceStaleOrders`.
+func (t *OrderTracker) cancelStale() {
+	if cfg() == nil || cfg().Trade.StaleOrderTimeout <= 0 {
+		return
+	}
+	timeout := time.Duration(cfg().Trade.StaleOrderTimeout) * time.Minute
+	for _, o := range t.Orders(OrderPending, OrderPartiallyFilled) {
+		if time.Since(o.Placed) < timeout {
+			continue
+		}
+		t.mu.Lock()
+		cl, ok := t.clients[o.Pair]
+		t.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if !cl.StopPendingOrder(o.ID) {
+			debugf("Could not cancel stale order %s for %s.", o.ID, o.Pair)
+			continue
+		}
+		if err := t.SetState(o.ID, OrderCancelled); err != nil {
+			debugf("Order %s: %v", o.ID, err)
+		}
+		t.repriceStale(cl, o, timeout)
+	}
+}
+
+// repriceStale brings the ledger in line with the stale order `o`, which has been cancelled, and places
+// its unfilled volume again if `config.Trade.RepriceStaleOrders` is set.
+func (t *OrderTracker) repriceStale(cl *Client, o TrackedOrder, timeout time.Duration) {
+	// The record opened again is closed by the new order before the asset can close it.
+	defer lockClosing(o.Asset)()
+	unfilled := o.RequestedVolume - o.FilledVolume
+	opened := reflectFill(o)
+	rest, reopened := reflectClose(o)
+	if !cfg().Trade.RepriceStaleOrders || unfilled < cl.minOrderVol {
+		notify(EventAlert, o.Asset, "Cancelled order %s after %s. %.6f %s was abandoned.%s",
+			o.ID, timeout, unfilled, o.Asset, reopenedNote(rest, reopened))
+		return
+	}
+	notify(EventAlert, o.Asset, "Cancelled order %s after %s. Placing %.6f %s again at the current price.",
+		o.ID, timeout, unfilled, o.Asset)
+	if err := reprice(cl, o, unfilled, opened, rest, reopened); err != nil {
+		debugf("Could not re-price order %s. Reason: %v", o.ID, err)
+	}
+}
+
+// reflectFill updates the ledger record opened by a finished order to hold only the volume that
+// was filled, at the price it was filled at, with the fees it was charged. Records of orders that were not filled at all are removed.
+// It returns true if the order opened a position held in the ledger.
+func reflectFill(o TrackedOrder) (opened bool) {
+	if bot == nil {
+		return
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	rec, err := ledger.GetRecordByID(o.ID)
+	if err != nil {
+		// The order did not open a position, or the position has been closed already.
+		return
+	}
+	opened = true
+	switch {
+	case o.FilledVolume == 0:
+		err = ledger.DeleteRecord(rec.ID)
+		debugf("Removed record %s from the ledger as its order was not filled.", rec.ID)
+	case o.FilledVolume != rec.Volume || o.FeeBase != rec.LunoAssetFee || o.FeeCounter != rec.LunoFiatFee:
+		rec.LunoAssetFee, rec.LunoFiatFee = o.FeeBase, o.FeeCounter
+		rec.applyFill(o.FilledVolume, o.Counter)
+		err = ledger.UpdatePosition(rec)
+		debugf("Record %s now holds the %.6f of %.6f %s that was filled.",
+			rec.ID, rec.Volume, rec.RequestedVolume, o.Asset)
+	}
+	if err != nil {
+		debugf("Could not update record %s. Reason: %v", rec.ID, err)
+	}
+	return
+}
+
+// reflectClose brings the ledger in line with a finished order that was to close a position but did not
+// fill all of its volume. The record was closed, and the profit of the sale saved, when the order was
+// placed. The part of the position that was filled stays closed with the profit it made at the price it
+// was filled at, and the rest is opened again. It returns the record of the part that is open again.
+func reflectClose(o TrackedOrder) (rest Record, reopened bool) {
+	if bot == nil || o.RequestedVolume <= 0 || o.RequestedVolume-o.FilledVolume <= o.RequestedVolume*partialFillTolerance {
+		return
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	closed, err := ledger.ReopenRecord(o.ID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			debugf("Could not open the record closed by order %s again. Reason: %v", o.ID, err)
+		}
+		// The order did not close a position.
+		return
+	}
+	if err = deleteProfit(o.ID); err != nil {
+		debugf("Could not remove the profit of order %s. Reason: %v", o.ID, err)
+	}
+	rest, reopened = closed.Record, true
+	if o.FilledVolume == 0 {
+		debugf("Record %s is open again as order %s was not filled.", rest.ID, o.ID)
+		return
+	}
+	// The filled part is closed again on its own, with the share of the fees of the order that opened it.
+	share := o.FilledVolume / o.RequestedVolume
+	filled := rest
+	filled.Volume, filled.Cost = rest.Volume*share, rest.Cost*share
+	filled.LunoAssetFee, filled.LunoFiatFee = rest.LunoAssetFee*share, rest.LunoFiatFee*share
+	price := o.Counter / o.FilledVolume
+	fees := filled.Fees() + o.FeeCounter + o.FeeBase*price
+	if err = ledger.UpdatePosition(filled); err == nil {
+		if rest.Type == LongOrder {
+			err = NewSale(rest.Asset, o.ID, rest.ParentID, rest.Timestamp, closed.ClosedAt, rest.Price, filled.Volume, price, o.FilledVolume, fees)
+		} else {
+			err = NewPurchase(rest.Asset, o.ID, rest.ParentID, rest.Timestamp, closed.ClosedAt, rest.Price, filled.Volume, price, o.FilledVolume, fees)
+		}
+	}
+	if err == nil {
+		err = ledger.CloseRecord(rest.ID, o.ID, closed.ClosedAt, price, o.FilledVolume)
+	}
+	if err != nil {
+		debugf("Could not close the filled part of record %s. Reason: %v", rest.ID, err)
+		return
+	}
+	rest.Volume, rest.Cost = rest.Volume-filled.Volume, rest.Cost-filled.Cost
+	rest.LunoAssetFee, rest.LunoFiatFee = rest.LunoAssetFee-filled.LunoAssetFee, rest.LunoFiatFee-filled.LunoFiatFee
+	if err = ledger.AddRecord(rest); err != nil {
+		debugf("Could not open the rest of record %s again. Reason: %v", rest.ID, err)
+		return rest, false
+	}
+	debugf("Record %s holds the %.6f %s that order %s did not close.", rest.ID, rest.Volume, rest.Asset, o.ID)
+	return
+}
+
+// reopenedNote tells the user that the rest of a position is held in the ledger again, if it is.
+func reopenedNote(rest Record, reopened bool) string {
+	if !reopened {
+		return ""
+	}
+	return fmt.Sprintf(" Record %s holds the rest of the position again.", rest.ID)
+}
+
+// finish brings the ledger in line with an order that the exchange has just completed or cancelled.
+// The unfilled volume of a partly filled order is either placed again at the current price or
+// abandoned, depending on `config.Trade.RepriceStaleOrders`.
+func finish(cl *Client, o TrackedOrder) {
+	// The record opened again is closed by the new order before the asset can close it.
+	defer lockClosing(o.Asset)()
+	opened := reflectFill(o)
+	rest, reopened := reflectClose(o)
+	unfilled := o.RequestedVolume - o.FilledVolume
+	if o.FilledVolume == 0 || unfilled <= o.RequestedVolume*partialFillTolerance || unfilled < cl.minOrderVol {
+		return
+	}
+	if cfg() == nil || !cfg().Trade.RepriceStaleOrders {
+		notify(EventAlert, o.Asset, "Order %s was only partly filled. %.6f %s was abandoned.%s", o.ID, unfilled, o.Asset,
+			reopenedNote(rest, reopened))
+		return
+	}
+	notify(EventAlert, o.Asset, "Order %s was only partly filled. Placing the remaining %.6f %s at the current price.",
+		o.ID, unfilled, o.Asset)
+	if err := reprice(cl, o, unfilled, opened, rest, reopened); err != nil {
+		debugf("Could not place the rest of order %s. Reason: %v", o.ID, err)
+	}
+}
+
+// reprice places the unfilled volume of a cancelled order again at the current price.
+// If the cancelled order opened a position, the new order is added to the ledger as a new record. If it
+// was to close a position, the new order closes `rest`, the record of the part it did not close.
+func reprice(cl *Client, o TrackedOrder, volume float64, opened bool, rest Record, reopened bool) (err error) {
+	price, err := cl.CurrentPrice()
+	if err != nil {
+		return
+	}
+	orderType := LongOrder
+	if o.Side != luno.OrderTypeBuy {
+		orderType = ShortOrder
+	}
+	intent := OrderIntent{Pair: cl.Pair, Asset: cl.asset, Side: o.Side, Price: price, Volume: volume, Type: orderType}
+	if reopened {
+		intent.RecordID, intent.ParentID = rest.ID, rest.ParentID
+	}
+	ref := beginIntent(intent)
+	var orderID string
+	if o.Side == luno.OrderTypeBuy {
+		orderID, err = cl.bid(ref, price, volume)
+	} else {
+		orderID, err = cl.ask(ref, price, volume)
+	}
+	if err != nil {
+		return
+	}
+	if reopened {
+		ledger := bot.Ledger()
+		defer ledger.Save()
+		bot.closeLedgerRecord(ledger, rest, orderID, price, volume)
+	}
+	if !opened {
+		// The cancelled order was to close a position. There is nothing to add to the ledger.
+		confirmIntent(ref)
+		return
+	}
+	rec := NewRecord(cl.asset, price, time.Now().Format(timeFormat), volume, orderID, orderType)
+	if err = bot.addRecordToLedger(rec); err != nil {
+		if !retryLater(PendingOperation{Kind: OpAddRecord, Record: rec}, err) {
+			return
+		}
+		err = nil
+	}
+	confirmIntent(ref)
+	return
+}
+
+// apply updates an order with the details returned by the exchange.
+func (o *TrackedOrder) apply(details luno.GetOrderResponse) {
+	o.FilledVolume = details.Base.Float64()
+	o.Counter = details.Counter.Float64()
+	o.FeeBase = details.FeeBase.Float64()
+	o.FeeCounter = details.FeeCounter.Float64()
+
+	next := o.State
+	switch details.State {
+	case luno.OrderStatePending:
+		if o.FilledVolume > 0 {
+			next = OrderPartiallyFilled
+		}
+	case luno.OrderStateComplete:
+		// Luno marks stopped orders as complete. An order that was not filled
+		// at all was cancelled.
+		if o.FilledVolume == 0 && o.RequestedVolume > 0 {
+			next = OrderCancelled
+		} else {
+			next = OrderComplete
+		}
+	}
+	if next == o.State && next != OrderPartiallyFilled {
+		return
+	}
+	if err := o.transition(next); err != nil {
+		debugf("Order %s: %v (%s -> %s)", o.ID, err, o.State, next)
+	}
+}
+
+func (o *TrackedOrder) transition(next OrderState) error {
+	if !o.State.CanTransition(next) {
+		return ErrInvalidOrderTransition
+	}
+	if o.State != next {
+		debugf("Order %s for %s is now %s", o.ID, o.Pair, next)
+	}
+	o.State = next
+	o.Updated = time.Now()
+	return nil
+}
+
+// backoff returns the delay before the next update of an order after `attempts` failed updates.
+func backoff(attempts int) time.Duration {
+	return trackerRetryPolicy.delay(attempts + 1)
+}
+
+// save writes all orders to file. Finished orders older than `trackerRetention` are dropped.
+// The caller must hold t.mu.
+func (t *OrderTracker) save() {
+	for id, o := range t.orders {
+		if o.State.IsFinal() && time.Since(o.Updated) > trackerRetention {
+			delete(t.orders, id)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		debugf("Could not save orders. Reason: %v", err)
+		return
+	}
+	data, err := json.Marshal(t.orders)
+	if err == nil {
+		err = replaceFileSynced(t.path, data)
+	}
+	if err != nil {
+		debugf("Could not save orders. Reason: %v", err)
+	}
+}
+
+func (t *OrderTracker) load() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(&t.orders)
+}
+
+// trackOrder hands an order to the running bot's order tracker, if any.
+func trackOrder(cl *Client, orderID string, side luno.OrderType, volume float64) {
+	if orderTracker != nil {
+		orderTracker.Track(cl, orderID, side, volume)
+	}
+}
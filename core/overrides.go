@@ -0,0 +1,178 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `overrides.go` resolves the analysis options used for each asset. Options are layered: the global
+*  defaults come first, then the defaults of the analysis plugin, then the analysis window the user has
+*  set for every asset, then the overrides the user has set for the asset, e.g. a shorter moving average for XRP or a longer analysis period for XBT. An asset
+*  may also be analyzed by its own plugin.
+ */
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidAnalyzerOverrides is returned when the analyzer overrides of an asset are out of range.
+var ErrInvalidAnalyzerOverrides = errors.New("invalid analyzer overrides")
+
+// Trading modes as they are written in the analyzer overrides.
+const (
+	ModeTrendFollowing = "trend_following"
+	ModeContrarian     = "contrarian"
+)
+
+// AnalyzerOverrides replaces individual analysis options for a single asset.
+// Fields left at their zero value are not overridden.
+type AnalyzerOverrides struct {
+	// AnalysisPeriod is how many hours of price data are analyzed.
+	AnalysisPeriod int32
+	// Interval is the time (in minutes) between each data point.
+	Interval int32
+	// Mode is the trading mode used for the asset: `ModeTrendFollowing` or `ModeContrarian`.
+	Mode string
+	// MovingAverageWindow is the number of data points averaged by the moving average.
+	MovingAverageWindow int
+	// Patterns overrides individual candlestick pattern thresholds.
+	Patterns PatternSensitivity
+	// Plugin is the name of the analysis plugin used for the asset instead of the one chosen for all assets.
+	Plugin string
+}
+
+// OptionsProvider is implemented by analysis plugins that have their own default options.
+// Only the non-zero fields of the returned options replace the global defaults. The trading mode
+// is always chosen by the user and is not taken from the plugin.
+type OptionsProvider interface {
+	DefaultOptions() AnalysisOptions
+}
+
+// IsZero reports whether no option is overridden.
+func (o AnalyzerOverrides) IsZero() bool {
+	return o == AnalyzerOverrides{}
+}
+
+// Validate returns `ErrInvalidAnalyzerOverrides` if any of the overridden options is out of range.
+func (o AnalyzerOverrides) Validate() error {
+	if o.AnalysisPeriod < 0 || o.Interval < 0 || o.MovingAverageWindow < 0 {
+		return ErrInvalidAnalyzerOverrides
+	}
+	if o.AnalysisPeriod > 0 && o.Interval > 0 && time.Duration(o.Interval)*time.Minute > time.Duration(o.AnalysisPeriod)*time.Hour {
+		// A single data point can not span more than the whole analysis period.
+		return ErrInvalidAnalyzerOverrides
+	}
+	switch o.Mode {
+	case "", ModeTrendFollowing, ModeContrarian:
+	default:
+		return ErrInvalidAnalyzerOverrides
+	}
+	if o.Plugin != "" && PluginHandler != nil {
+		if _, ok := PluginHandler.plugins[strings.ToLower(o.Plugin)]; !ok {
+			return ErrInvalidAnalyzerOverrides
+		}
+	}
+	return o.Patterns.Validate()
+}
+
+// pick returns `value` if it is set and `fallback` otherwise.
+func pick(value, fallback float64) float64 {
+	if value != 0 {
+		return value
+	}
+	return fallback
+}
+
+// globalAnalysisOptions returns the analysis options used for every asset without overrides.
+func globalAnalysisOptions() AnalysisOptions {
+	opts := AnalysisOptions{
+		AnalysisPeriod:      H24, // 24 Hours
+		Interval:            H1,  // Hourly interval
+		Mode:                cfg().Trade.TradingMode,
+		MovingAverageWindow: 20,
+		Patterns:            cfg().Trade.PatternSensitivity.WithDefaults()}
+	opts.SecondaryInterval, opts.SecondaryPeriod = secondaryTimeframe()
+	return opts
+}
+
+// analyzerFor returns the analysis plugin used for `asset`: the plugin chosen in its overrides, if it is
+// registered, or else the plugin of the bot. Plugins registered with a factory have an instance for each
+// asset. `shared` reports whether the plugin is shared by every asset instead.
+func (bot *Bot) analyzerFor(asset string) (analyzer Analyzer, shared bool) {
+	if name := strings.ToLower(cfg().Trade.AnalyzerOverrides[asset].Plugin); name != "" {
+		if plugin, ok := PluginHandler.plugins[name]; ok {
+			return PluginHandler.instance(plugin, asset)
+		}
+	}
+	return PluginHandler.instance(bot.analyzer, asset)
+}
+
+// resolveAnalyzer returns the analysis plugin used for `asset`, like `analyzerFor`, and its options. It
+// holds `analysisMu` for reading, so the plugin and the settings can not be replaced while they are read.
+func (bot *Bot) resolveAnalyzer(asset string) (analyzer Analyzer, shared bool, opts *AnalysisOptions) {
+	analysisMu.RLock()
+	defer analysisMu.RUnlock()
+	analyzer, shared = bot.analyzerFor(asset)
+	return analyzer, shared, ResolveAnalysisOptions(analyzer, asset)
+}
+
+// ResolveAnalysisOptions returns the analysis options for `asset`. The global defaults are replaced
+// by the defaults of `plugin`, if it has any, those by the analysis period and interval the user has set
+// for every asset, and those by the overrides the user has set for the asset.
+func ResolveAnalysisOptions(plugin Analyzer, asset string) *AnalysisOptions {
+	opts := globalAnalysisOptions()
+	opts.Asset = asset
+	if provider, ok := plugin.(OptionsProvider); ok {
+		opts.merge(provider.DefaultOptions())
+	}
+	opts.merge(AnalysisOptions{
+		AnalysisPeriod: time.Duration(cfg().Trade.AnalysisPeriod) * time.Hour,
+		Interval:       time.Duration(cfg().Trade.AnalysisInterval) * time.Minute,
+	})
+	if overrides, ok := cfg().Trade.AnalyzerOverrides[asset]; ok {
+		overrides.Apply(&opts)
+	}
+	return &opts
+}
+
+// Apply replaces the fields of `opts` that are overridden, including the trading mode.
+func (o AnalyzerOverrides) Apply(opts *AnalysisOptions) {
+	opts.merge(o.options())
+	switch o.Mode {
+	case ModeTrendFollowing:
+		opts.Mode = TrendFollowing
+	case ModeContrarian:
+		opts.Mode = Contrarian
+	}
+}
+
+// options converts the overrides to analysis options. The trading mode is left out as its zero value is a valid mode.
+func (o AnalyzerOverrides) options() AnalysisOptions {
+	return AnalysisOptions{
+		AnalysisPeriod:      time.Duration(o.AnalysisPeriod) * time.Hour,
+		Interval:            time.Duration(o.Interval) * time.Minute,
+		MovingAverageWindow: o.MovingAverageWindow,
+		Patterns:            o.Patterns,
+	}
+}
+
+// merge replaces the options with the non-zero fields of `layer`, except for the trading mode.
+func (opts *AnalysisOptions) merge(layer AnalysisOptions) {
+	if layer.AnalysisPeriod > 0 {
+		opts.AnalysisPeriod = layer.AnalysisPeriod
+	}
+	if layer.Interval > 0 {
+		opts.Interval = layer.Interval
+	}
+	if layer.MovingAverageWindow > 0 {
+		opts.MovingAverageWindow = layer.MovingAverageWindow
+	}
+	if layer.SecondaryInterval > 0 && layer.SecondaryPeriod > 0 {
+		opts.SecondaryInterval, opts.SecondaryPeriod = layer.SecondaryInterval, layer.SecondaryPeriod
+	}
+	opts.Patterns = PatternSensitivity{
+		DojiTolerance:    pick(layer.Patterns.DojiTolerance, opts.Patterns.DojiTolerance),
+		BodyRatio:        pick(layer.Patterns.BodyRatio, opts.Patterns.BodyRatio),
+		WickRatio:        pick(layer.Patterns.WickRatio, opts.Patterns.WickRatio),
+		EngulfingOverlap: pick(layer.Patterns.EngulfingOverlap, opts.Patterns.EngulfingOverlap),
+	}
+}
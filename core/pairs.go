@@ -0,0 +1,107 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `pairs.go` holds price and volume formatting metadata for each currency pair traded by Leprechaun.
+ */
+
+import (
+	"math"
+	"strconv"
+	"sync"
+)
+
+// PairInfo describes how prices and volumes are quoted for a currency pair on the exchange.
+// Prices on NGN pairs are large integers for Bitcoin and Ethereum but small decimals for Ripple coin.
+type PairInfo struct {
+	Pair        string
+	PriceScale  int     // Number of decimal places in a price.
+	TickSize    float64 // Smallest price increment accepted by the exchange.
+	VolumeScale int     // Number of decimal places in a volume.
+	MinVolume   float64 // Minimum volume that can be traded on the exchange.
+	TakerFee    float64 // Fee charged on market orders, as a fraction of their value. Zero until it is fetched.
+}
+
+// pairInfo holds the metadata for the pairs supported by Leprechaun.
+var pairInfo = map[string]PairInfo{
+	"XBTNGN": {Pair: "XBTNGN", PriceScale: 0, TickSize: 1, VolumeScale: 6, MinVolume: 0.0005},
+	"ETHNGN": {Pair: "ETHNGN", PriceScale: 0, TickSize: 1, VolumeScale: 6, MinVolume: 0.0005},
+	"LTCNGN": {Pair: "LTCNGN", PriceScale: 0, TickSize: 1, VolumeScale: 6, MinVolume: 0.0005},
+	"XRPNGN": {Pair: "XRPNGN", PriceScale: 2, TickSize: 0.01, VolumeScale: 0, MinVolume: 1},
+}
+
+var (
+	// takerFees holds the taker fee of each pair, as last fetched from the exchange.
+	takerFees   = map[string]float64{}
+	takerFeesMu sync.RWMutex
+)
+
+// setTakerFee saves the taker fee of a pair, so trigger prices are set net of it.
+func setTakerFee(pair string, fee float64) {
+	takerFeesMu.Lock()
+	defer takerFeesMu.Unlock()
+	takerFees[pair] = fee
+}
+
+// GetPairInfo returns the metadata for a currency pair. Unknown pairs are quoted to two decimal places.
+func GetPairInfo(pair string) PairInfo {
+	info, ok := pairInfo[pair]
+	if !ok {
+		info = PairInfo{Pair: pair, PriceScale: 2, TickSize: 0.01, VolumeScale: 6, MinVolume: 0.0005}
+	}
+	takerFeesMu.RLock()
+	info.TakerFee = takerFees[pair]
+	takerFeesMu.RUnlock()
+	return info
+}
+
+// AssetPairInfo returns the metadata for the pair of an asset traded against the Naira.
+func AssetPairInfo(asset string) PairInfo {
+	return GetPairInfo(asset + "NGN")
+}
+
+// RoundPrice rounds a price to the nearest valid tick.
+func (p PairInfo) RoundPrice(price float64) float64 {
+	return toScale(math.Round(price/p.TickSize)*p.TickSize, p.PriceScale)
+}
+
+// TriggerPrice returns the trigger price of an order placed at `price` with the given profit margin.
+// Long triggers are rounded up and short triggers rounded down to a valid tick, so a trigger never
+// sits between ticks and the profit margin is never reduced by rounding. The margin is net of the taker
+// fees charged on the orders that open and close the position.
+func (p PairInfo) TriggerPrice(price, margin float64, orderType OrderType) float64 {
+	fee := p.TakerFee
+	switch orderType {
+	case LongOrder:
+		// The sale must bring in the cost of the purchase and its fee, the fee of the sale and the margin.
+		trigger := price * (1 + margin + fee) / (1 - fee)
+		return toScale(math.Ceil(trigger/p.TickSize-1e-9)*p.TickSize, p.PriceScale)
+	case ShortOrder:
+		// The repurchase and its fee must cost no more than the sale brought in, less the margin.
+		trigger := price * (1 - margin - fee) / (1 + fee)
+		return toScale(math.Floor(trigger/p.TickSize+1e-9)*p.TickSize, p.PriceScale)
+	}
+	return p.RoundPrice(price)
+}
+
+// RoundVolume truncates a volume to the number of decimal places accepted by the exchange.
+func (p PairInfo) RoundVolume(volume float64) float64 {
+	scale := math.Pow10(p.VolumeScale)
+	return math.Floor(volume*scale+1e-9) / scale
+}
+
+// FormatPrice returns a price as a string with the pair's number of decimal places.
+func (p PairInfo) FormatPrice(price float64) string {
+	return strconv.FormatFloat(p.RoundPrice(price), 'f', p.PriceScale, 64)
+}
+
+// FormatVolume returns a volume as a string with the pair's number of decimal places.
+func (p PairInfo) FormatVolume(volume float64) string {
+	return strconv.FormatFloat(p.RoundVolume(volume), 'f', p.VolumeScale, 64)
+}
+
+// toScale removes floating point noise left after multiplying by the tick size.
+func toScale(value float64, places int) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(value, 'f', places, 64), 64)
+	return v
+}
@@ -0,0 +1,171 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `pairstatus.go` watches the status of the traded pairs on the exchange. When a pair is suspended or
+*  delisted no new positions are opened in it, open positions are closed if the user wants that, and
+*  the user is alerted once, instead of every round failing with an error from the exchange.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Pair statuses reported by the exchange. `PairDelisted` is set by Leprechaun when the exchange
+// no longer lists a pair.
+const (
+	PairActive   = "ACTIVE"
+	PairPostOnly = "POSTONLY"
+	PairDisabled = "DISABLED"
+	PairDelisted = "DELISTED"
+)
+
+var (
+	// ErrPairSuspended is returned when trading in a pair has been suspended by the exchange.
+	ErrPairSuspended = errors.New("trading in this pair has been suspended by the exchange")
+	// ErrPairDelisted is returned when the exchange no longer lists a pair.
+	ErrPairDelisted = errors.New("this pair is no longer listed on the exchange")
+)
+
+// PairStatusSettings configures the pair status watcher.
+type PairStatusSettings struct {
+	// CheckInterval is how often (in minutes) the status of the traded pairs is checked. Zero disables the watcher.
+	CheckInterval int32
+	// ExitPositions closes the open positions in a pair once it is suspended or delisted.
+	// Otherwise they are held until trading resumes.
+	ExitPositions bool
+}
+
+// tickersEndpoint lists the tickers, and status, of every pair on the exchange.
+var tickersEndpoint = "https://api.luno.com/api/1/tickers"
+
+var (
+	pairStatuses   = map[string]string{}
+	pairsCheckedAt time.Time
+	pairStatusMu   sync.Mutex
+)
+
+// fetchPairStatuses retrieves the status of every pair listed on the exchange.
+func fetchPairStatuses() (statuses map[string]string, err error) {
+	client := http.Client{Timeout: 15 * time.Second}
+	res, err := client.Get(tickersEndpoint)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("luno: %s", res.Status)
+	}
+	var body struct {
+		Tickers []struct {
+			Pair   string `json:"pair"`
+			Status string `json:"status"`
+		} `json:"tickers"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return
+	}
+	if len(body.Tickers) == 0 {
+		// An empty list is more likely a glitch than every pair being delisted at once.
+		return nil, errors.New("luno: the exchange returned no tickers")
+	}
+	statuses = map[string]string{}
+	for _, ticker := range body.Tickers {
+		statuses[ticker.Pair] = ticker.Status
+	}
+	return
+}
+
+// PairStatus returns the last known status of `pair`. Pairs that have not been checked yet are assumed to be active.
+func PairStatus(pair string) string {
+	pairStatusMu.Lock()
+	defer pairStatusMu.Unlock()
+	if status, ok := pairStatuses[pair]; ok {
+		return status
+	}
+	return PairActive
+}
+
+// refreshPairStatuses checks the status of the traded pairs if `config.Trade.PairStatus.CheckInterval`
+// has passed since the last check, and alerts the user when the status of a pair changes. Pairs newly
+// listed in the user's currency are offered to the user.
+func refreshPairStatuses(clients []Client) {
+	interval := time.Duration(cfg().Trade.PairStatus.CheckInterval) * time.Minute
+	pairStatusMu.Lock()
+	due := time.Since(pairsCheckedAt) >= interval
+	pairStatusMu.Unlock()
+	if interval <= 0 || !due {
+		return
+	}
+	listed, err := fetchPairStatuses()
+	if err != nil {
+		// The check is skipped rather than stopping the bot. Orders in a suspended pair will still fail safely.
+		debugf("Could not check the status of the traded pairs. Reason: %v", err)
+		return
+	}
+	discoverListings(listed)
+	pairStatusMu.Lock()
+	defer pairStatusMu.Unlock()
+	pairsCheckedAt = time.Now()
+	for _, cl := range clients {
+		status, ok := listed[cl.Pair]
+		if !ok {
+			status = PairDelisted
+		}
+		previous, known := pairStatuses[cl.Pair]
+		pairStatuses[cl.Pair] = status
+		if !known {
+			previous = PairActive
+		}
+		if status == previous {
+			continue
+		}
+		switch status {
+		case PairActive:
+			notify(EventInfo, cl.asset, "Trading in %s has resumed on the exchange. Leprechaun will trade %s again.", cl.Pair, cl.name)
+		case PairDelisted:
+			notify(EventAlert, cl.asset, "%s is no longer listed on the exchange. Leprechaun will not open new %s positions. %s",
+				cl.Pair, cl.name, pairExitMessage())
+		default:
+			notify(EventAlert, cl.asset, "Trading in %s has been suspended by the exchange (status: %s). Leprechaun will not open new %s positions. %s",
+				cl.Pair, status, cl.name, pairExitMessage())
+		}
+	}
+}
+
+func pairExitMessage() string {
+	if cfg().Trade.PairStatus.ExitPositions {
+		return "Open positions will be closed if the exchange accepts the orders."
+	}
+	return "Open positions will be held until trading resumes."
+}
+
+// checkPairStatus returns `ErrPairSuspended` or `ErrPairDelisted` if the client's pair can not be traded.
+func (cl *Client) checkPairStatus() error {
+	switch PairStatus(cl.Pair) {
+	case PairActive:
+		return nil
+	case PairDelisted:
+		return ErrPairDelisted
+	default:
+		return ErrPairSuspended
+	}
+}
+
+// exitPair closes the open positions in the client's pair at the current price, whatever their trigger
+// price. It is used when the pair has been suspended or delisted and the user has chosen to exit.
+func (bot *Bot) exitPair(cl *Client) {
+	cl.exiting = true
+	defer func() { cl.exiting = false }()
+	if err := bot.CompleteLongTrades(cl); err != nil {
+		debugf("Could not close the open %s long positions. Reason: %v", cl.name, err)
+	}
+	if err := bot.CompleteShortTrades(cl); err != nil {
+		debugf("Could not close the open %s short positions. Reason: %v", cl.name, err)
+	}
+}
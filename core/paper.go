@@ -0,0 +1,361 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `paper.go` holds the paper trading engine. In paper mode the bot trades against live prices
+*  from the exchange, but orders and balances are simulated locally, so new users can try
+*  Leprechaun without risking any money.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPaperSessionComplete is returned by `Bot.Run` when a paper trading session has run all its rounds.
+	ErrPaperSessionComplete = errors.New("the paper trading session is complete")
+
+	// DefaultPaperBalance is the fiat balance a new paper account starts with.
+	DefaultPaperBalance = 500000.0
+	// DefaultPaperRounds is the number of trading rounds in a guided paper trading session.
+	DefaultPaperRounds int32 = 5
+	// paperTakerFee is the taker fee charged on simulated market orders.
+	paperTakerFee = 0.001
+
+	paper   *paperExchange
+	paperMu sync.Mutex
+)
+
+// PaperSettings configures paper trading.
+type PaperSettings struct {
+	Enabled         bool
+	StartingBalance float64 // Fiat balance of a new paper account.
+	Rounds          int32   // Number of trading rounds before the session stops. Zero runs until stopped.
+}
+
+// dataDir returns the folder trading data is saved in. Paper trading data is kept apart from live trading data.
+func dataDir() string {
+	if cfg().Paper.Enabled {
+		return filepath.Join(cfg().DataDir, "paper")
+	}
+	return cfg().DataDir
+}
+
+// ledgerPath returns the path of the ledger database for the current trading mode.
+func ledgerPath() (path string) {
+	path = cfg().LedgerDatabase
+	if cfg().Paper.Enabled {
+		path = filepath.Join(dataDir(), filepath.Base(cfg().LedgerDatabase))
+	}
+	if _, backend, err := storageBackend(); err == nil && backend.Local && backend.Extension != "" {
+		path = strings.TrimSuffix(path, filepath.Ext(path)) + backend.Extension
+	}
+	return path
+}
+
+// paperOrder is a simulated order.
+type paperOrder struct {
+	ID         string
+	Pair       string
+	Type       string
+	Base       float64
+	Counter    float64
+	FeeBase    float64
+	FeeCounter float64
+	Created    time.Time
+}
+
+// paperExchange simulates the private part of the exchange API.
+type paperExchange struct {
+	mu       sync.Mutex
+	Balances map[string]float64
+	Orders   []*paperOrder
+	NextID   int64
+	path     string
+}
+
+// paperAccount returns the paper exchange, loading it from file or opening a new account.
+func paperAccount() *paperExchange {
+	paperMu.Lock()
+	defer paperMu.Unlock()
+	path := filepath.Join(dataDir(), "paper-account.json")
+	if paper != nil && paper.path == path {
+		return paper
+	}
+	paper = &paperExchange{path: path}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, paper)
+	}
+	if paper.Balances == nil {
+		balance := cfg().Paper.StartingBalance
+		if balance <= 0 {
+			balance = DefaultPaperBalance
+		}
+		paper.Balances = map[string]float64{"NGN": balance}
+		paper.save()
+	}
+	return paper
+}
+
+// ResetPaperAccount discards the paper account, its ledger and stats so the next session starts afresh.
+func ResetPaperAccount() error {
+	paperMu.Lock()
+	paper = nil
+	paperMu.Unlock()
+	return os.RemoveAll(filepath.Join(cfg().DataDir, "paper"))
+}
+
+func (p *paperExchange) save() {
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	ioutil.WriteFile(p.path, data, 0644)
+}
+
+// paperTransport answers private API calls from the paper exchange and sends public calls
+// (prices, order books and trades) to the live exchange.
+type paperTransport struct {
+	live http.RoundTripper
+}
+
+func (t *paperTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := strings.TrimPrefix(req.URL.Path, "/api/1/")
+	switch {
+	case path == "ticker", path == "tickers", path == "orderbook", path == "orderbook_top", path == "trades":
+		return t.live.RoundTrip(req)
+	case path == "balance":
+		return paperResponse(req, http.StatusOK, paperAccount().balances())
+	case path == "fee_info":
+		return paperResponse(req, http.StatusOK, map[string]string{
+			"maker_fee": "0", "taker_fee": strconv.FormatFloat(paperTakerFee, 'f', -1, 64), "thirty_day_volume": "0"})
+	case path == "marketorder":
+		return t.marketOrder(req)
+	case strings.HasPrefix(path, "orders/"):
+		order, ok := paperAccount().order(strings.TrimPrefix(path, "orders/"))
+		if !ok {
+			return paperError(req, http.StatusNotFound, "ErrOrderNotFound", "Order not found")
+		}
+		return paperResponse(req, http.StatusOK, order)
+	case path == "listorders":
+		return paperResponse(req, http.StatusOK, map[string]interface{}{"orders": paperAccount().orders(req.URL.Query().Get("pair"))})
+	case path == "stoporder":
+		// Simulated market orders are filled at once, so there is never anything to stop.
+		return paperResponse(req, http.StatusOK, map[string]bool{"success": false})
+	}
+	return paperError(req, http.StatusBadRequest, "ErrNotSupportedInPaperMode",
+		fmt.Sprintf("%s is not available in paper trading mode", path))
+}
+
+// marketOrder fills a simulated market order at the live bid or ask price.
+func (t *paperTransport) marketOrder(req *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return paperError(req, http.StatusBadRequest, "ErrInvalidArguments", err.Error())
+	}
+	pair := form.Get("pair")
+	ask, bid, err := t.livePrices(req, pair)
+	if err != nil {
+		return nil, err
+	}
+	p := paperAccount()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	base, counter := pair[:3], pair[3:]
+	order := &paperOrder{Pair: pair, Type: form.Get("type"), Created: time.Now()}
+	switch order.Type {
+	case "BUY":
+		spend, _ := strconv.ParseFloat(form.Get("counter_volume"), 64)
+		if spend <= 0 || spend > p.Balances[counter] {
+			return paperError(req, http.StatusBadRequest, "ErrInsufficientBalance", "Insufficient balance")
+		}
+		order.Counter = spend
+		order.Base = spend / ask
+		order.FeeBase = order.Base * paperTakerFee
+		p.Balances[counter] -= spend
+		p.Balances[base] += order.Base - order.FeeBase
+	case "SELL":
+		volume, _ := strconv.ParseFloat(form.Get("base_volume"), 64)
+		if volume <= 0 || volume > p.Balances[base] {
+			return paperError(req, http.StatusBadRequest, "ErrInsufficientBalance", "Insufficient balance")
+		}
+		order.Base = volume
+		order.Counter = volume * bid
+		order.FeeCounter = order.Counter * paperTakerFee
+		p.Balances[base] -= volume
+		p.Balances[counter] += order.Counter - order.FeeCounter
+	default:
+		return paperError(req, http.StatusBadRequest, "ErrInvalidArguments", "Invalid order type")
+	}
+	p.NextID++
+	order.ID = fmt.Sprintf("PAPER%d", p.NextID)
+	p.Orders = append(p.Orders, order)
+	p.save()
+	return paperResponse(req, http.StatusOK, map[string]string{"order_id": order.ID})
+}
+
+// livePrices returns the current ask and bid prices of a pair from the live exchange.
+func (t *paperTransport) livePrices(orig *http.Request, pair string) (ask, bid float64, err error) {
+	u := *orig.URL
+	u.Path = "/api/1/ticker"
+	u.RawQuery = url.Values{"pair": {pair}}.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return
+	}
+	res, err := t.live.RoundTrip(req.WithContext(orig.Context()))
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	ticker := struct {
+		Ask, Bid string
+	}{}
+	if err = json.NewDecoder(res.Body).Decode(&ticker); err != nil {
+		return
+	}
+	ask, _ = strconv.ParseFloat(ticker.Ask, 64)
+	bid, _ = strconv.ParseFloat(ticker.Bid, 64)
+	if ask <= 0 || bid <= 0 {
+		err = fmt.Errorf("no live prices for %s", pair)
+	}
+	return
+}
+
+// balances returns the paper balances in the layout of the balance API.
+func (p *paperExchange) balances() map[string]interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	assets := []string{"NGN"}
+	for _, asset := range cfg().SupportedAssets {
+		assets = append(assets, asset)
+	}
+	accounts := []map[string]string{}
+	for i, asset := range assets {
+		accounts = append(accounts, map[string]string{
+			"account_id": strconv.Itoa(1000 + i), "asset": asset, "name": "Paper " + asset,
+			"balance": strconv.FormatFloat(p.Balances[asset], 'f', -1, 64), "reserved": "0", "unconfirmed": "0",
+		})
+	}
+	return map[string]interface{}{"balance": accounts}
+}
+
+func (o *paperOrder) json() map[string]interface{} {
+	ms := o.Created.UnixNano() / int64(time.Millisecond)
+	return map[string]interface{}{
+		"order_id": o.ID, "pair": o.Pair, "type": o.Type, "state": "COMPLETE",
+		"base": ftoa(o.Base), "counter": ftoa(o.Counter), "fee_base": ftoa(o.FeeBase), "fee_counter": ftoa(o.FeeCounter),
+		"limit_price": "0", "limit_volume": ftoa(o.Base),
+		"creation_timestamp": ms, "completed_timestamp": ms, "expiration_timestamp": 0,
+	}
+}
+
+func (p *paperExchange) order(id string) (map[string]interface{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, o := range p.Orders {
+		if o.ID == id {
+			return o.json(), true
+		}
+	}
+	return nil, false
+}
+
+func (p *paperExchange) orders(pair string) (orders []map[string]interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.Orders) - 1; i >= 0; i-- {
+		if pair == "" || p.Orders[i].Pair == pair {
+			orders = append(orders, p.Orders[i].json())
+		}
+	}
+	return
+}
+
+func ftoa(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func paperResponse(req *http.Request, status int, v interface{}) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: status, Status: fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Header:  http.Header{"Content-Type": {"application/json"}},
+		Body:    ioutil.NopCloser(bytes.NewReader(data)),
+		Request: req, ContentLength: int64(len(data)),
+	}, nil
+}
+
+func paperError(req *http.Request, status int, code, message string) (*http.Response, error) {
+	return paperResponse(req, status, map[string]string{"error_code": code, "error": message})
+}
+
+// PaperSummary describes the results of the paper trading session.
+func PaperSummary() string {
+	p := paperAccount()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	start := cfg().Paper.StartingBalance
+	if start <= 0 {
+		start = DefaultPaperBalance
+	}
+	lines := []string{fmt.Sprintf("Paper account started with %s %.2f.", cfg().CurrencyCode, start)}
+	assets := []string{}
+	for asset := range p.Balances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	for _, asset := range assets {
+		lines = append(lines, fmt.Sprintf("Balance: %.6f %s", p.Balances[asset], asset))
+	}
+	realized := 0.0
+	for _, asset := range cfg().AssetsToTrade {
+		realized += realizedProfit(asset)
+	}
+	lines = append(lines, fmt.Sprintf("Orders placed: %d. Realized profit: %s %.2f", len(p.Orders), cfg().CurrencyCode, realized))
+	return strings.Join(lines, "\n")
+}
+
+// StartPaperTrading switches to paper trading for a guided session of `rounds` trading rounds.
+func (c *Configuration) StartPaperTrading(rounds int32) error {
+	c.Paper.Enabled = true
+	if c.Paper.StartingBalance <= 0 {
+		c.Paper.StartingBalance = DefaultPaperBalance
+	}
+	c.Paper.Rounds = rounds
+	return c.Save()
+}
+
+// GoLive switches from paper trading to live trading with the user's API keys.
+func (c *Configuration) GoLive(apiKeyID, apiKeySecret string) error {
+	if apiKeyID == "" || apiKeySecret == "" {
+		return ErrInvalidAPICredentials
+	}
+	c.Paper.Enabled = false
+	c.APIKeyID, c.APIKeySecret = apiKeyID, apiKeySecret
+	return c.Save()
+}
@@ -0,0 +1,95 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `patterns.go` holds the thresholds used to detect candlestick patterns. Markets differ in how
+*  noisy their candles are, e.g. NGN pairs trade thinner than USD pairs, so the thresholds can be tuned.
+*  The thresholds set here are used by every chart that has none of its own. Plugins give the chart of
+*  each asset the thresholds set for it, so assets analyzed at the same time do not share them.
+ */
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrInvalidPatternSensitivity is returned when a pattern sensitivity setting is out of range.
+var ErrInvalidPatternSensitivity = errors.New("invalid candlestick pattern sensitivity")
+
+// PatternSensitivity holds the thresholds used for candlestick pattern detection.
+// Zero values are replaced by the defaults.
+type PatternSensitivity struct {
+	// DojiTolerance is the largest size of a candle's body, as a fraction of its range (high - low),
+	// for the candle to count as a doji. Valid values are between 0.01 and 0.3.
+	DojiTolerance float64
+	// BodyRatio is the largest size of a hammer's body as a fraction of its range. Valid values are between 0.1 and 0.5.
+	BodyRatio float64
+	// WickRatio is how many times longer than the upper wick the lower wick of a hammer must be.
+	// Valid values are between 1 and 5.
+	WickRatio float64
+	// EngulfingOverlap is the fraction of the range of a candle that the next candle must cover to engulf it.
+	// 1 requires the candle to be engulfed completely. Valid values are between 0.5 and 1.
+	EngulfingOverlap float64
+}
+
+// DefaultPatternSensitivity holds the default pattern detection thresholds.
+var DefaultPatternSensitivity = PatternSensitivity{
+	DojiTolerance:    0.1,
+	BodyRatio:        0.35,
+	WickRatio:        2,
+	EngulfingOverlap: 1,
+}
+
+var (
+	patternSensitivity   = DefaultPatternSensitivity
+	patternSensitivityMu sync.RWMutex
+)
+
+// WithDefaults returns a copy of the settings with unset values replaced by the defaults.
+func (s PatternSensitivity) WithDefaults() PatternSensitivity {
+	if s.DojiTolerance == 0 {
+		s.DojiTolerance = DefaultPatternSensitivity.DojiTolerance
+	}
+	if s.BodyRatio == 0 {
+		s.BodyRatio = DefaultPatternSensitivity.BodyRatio
+	}
+	if s.WickRatio == 0 {
+		s.WickRatio = DefaultPatternSensitivity.WickRatio
+	}
+	if s.EngulfingOverlap == 0 {
+		s.EngulfingOverlap = DefaultPatternSensitivity.EngulfingOverlap
+	}
+	return s
+}
+
+// Validate returns `ErrInvalidPatternSensitivity` if any of the settings is out of range.
+func (s PatternSensitivity) Validate() error {
+	s = s.WithDefaults()
+	switch {
+	case s.DojiTolerance < 0.01 || s.DojiTolerance > 0.3,
+		s.BodyRatio < 0.1 || s.BodyRatio > 0.5,
+		s.WickRatio < 1 || s.WickRatio > 5,
+		s.EngulfingOverlap < 0.5 || s.EngulfingOverlap > 1:
+		return ErrInvalidPatternSensitivity
+	}
+	return nil
+}
+
+// SetPatternSensitivity sets the thresholds used for candlestick pattern detection.
+// Invalid settings are rejected and the current thresholds are kept.
+func SetPatternSensitivity(s PatternSensitivity) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	patternSensitivityMu.Lock()
+	patternSensitivity = s.WithDefaults()
+	patternSensitivityMu.Unlock()
+	return nil
+}
+
+// GetPatternSensitivity returns the thresholds currently used for candlestick pattern detection.
+func GetPatternSensitivity() PatternSensitivity {
+	patternSensitivityMu.RLock()
+	defer patternSensitivityMu.RUnlock()
+	return patternSensitivity
+}
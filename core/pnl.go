@@ -0,0 +1,150 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `pnl.go` sums the profit of the trades in the journal by day, week or month, for each asset. Unlike
+*  the all-time stats, this shows how the profit changes over time, and unlike the saved sales and
+*  purchases the journal keeps every closed position. Weeks start on Monday. The periods are in the
+*  local time zone.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ProfitPeriod is the length of the periods profits are summed over.
+type ProfitPeriod string
+
+// Lengths of the periods profits can be summed over.
+const (
+	PeriodDay   ProfitPeriod = "day"
+	PeriodWeek  ProfitPeriod = "week"
+	PeriodMonth ProfitPeriod = "month"
+)
+
+// periodStarts maps each period to a function that returns the local midnight the period of a time starts at.
+var periodStarts = map[ProfitPeriod]func(t time.Time) time.Time{
+	PeriodDay: startOfDay,
+	PeriodWeek: func(t time.Time) time.Time {
+		// Weekday counts from Sunday, and weeks start on Monday.
+		day := startOfDay(t)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	},
+	PeriodMonth: func(t time.Time) time.Time {
+		y, m, _ := t.In(time.Local).Date()
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.Local)
+	},
+}
+
+// startOfDay returns the local midnight the day of `t` starts at.
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// ErrInvalidPeriod is returned when profits are summed over an unknown period.
+var ErrInvalidPeriod = errors.New("invalid profit period")
+
+// PeriodProfit is the profit of the positions of an asset closed in a period.
+type PeriodProfit struct {
+	Asset string
+	// Start is the local midnight the period starts at. It ends where the next period starts.
+	Start  time.Time
+	Period ProfitPeriod
+	// Trades is the number of positions closed in the period, and Wins the number closed at a profit.
+	Trades, Wins int
+	Profit       float64
+	// Volume is the volume of the asset sold or bought back to close the positions.
+	Volume float64
+}
+
+// End returns the time the period ends at.
+func (p PeriodProfit) End() time.Time {
+	switch p.Period {
+	case PeriodWeek:
+		return p.Start.AddDate(0, 0, 7)
+	case PeriodMonth:
+		return p.Start.AddDate(0, 1, 0)
+	}
+	return p.Start.AddDate(0, 0, 1)
+}
+
+// Label returns a short name of the period, such as "2020-09-14" or "Sep 2020".
+func (p PeriodProfit) Label() string {
+	switch p.Period {
+	case PeriodWeek:
+		return "Week of " + p.Start.Format("2006-01-02")
+	case PeriodMonth:
+		return p.Start.Format("Jan 2006")
+	}
+	return p.Start.Format("2006-01-02")
+}
+
+// ProfitByPeriod sums the profit of the positions closed from `from` up to, but not including, `to` by
+// `period` and asset, from the earliest period. An empty `asset` sums every asset, each on its own. A
+// zero time leaves that end of the range open. Periods in which no position was closed are left out.
+func ProfitByPeriod(asset string, period ProfitPeriod, from, to time.Time) (profits []PeriodProfit, err error) {
+	start, ok := periodStarts[period]
+	if !ok {
+		return nil, fmt.Errorf("%w (%q, use %q, %q or %q)", ErrInvalidPeriod, period, PeriodDay, PeriodWeek, PeriodMonth)
+	}
+	journalMu.Lock()
+	store, err := openJournal()
+	var entries []JournalEntry
+	if err == nil {
+		entries, err = store.entries("")
+	}
+	journalMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for _, entry := range entries {
+		if entry.Action != JournalClose || asset != "" && entry.Asset != asset ||
+			!from.IsZero() && entry.Time.Unix() < from.Unix() || !to.IsZero() && entry.Time.Unix() >= to.Unix() {
+			continue
+		}
+		p := PeriodProfit{Asset: entry.Asset, Start: start(entry.Time), Period: period}
+		key := fmt.Sprintf("%s|%d", p.Asset, p.Start.Unix())
+		i, ok := index[key]
+		if !ok {
+			i = len(profits)
+			index[key] = i
+			profits = append(profits, p)
+		}
+		profits[i].Trades++
+		if entry.Profit > 0 {
+			profits[i].Wins++
+		}
+		profits[i].Profit += entry.Profit
+		profits[i].Volume += entry.Volume
+	}
+	sort.Slice(profits, func(i, j int) bool {
+		if !profits[i].Start.Equal(profits[j].Start) {
+			return profits[i].Start.Before(profits[j].Start)
+		}
+		return profits[i].Asset < profits[j].Asset
+	})
+	return profits, nil
+}
+
+// TotalByPeriod sums `profits` of every asset by period, keeping the order of the periods. The volumes of
+// different assets do not add up, so the totals have none.
+func TotalByPeriod(profits []PeriodProfit) (totals []PeriodProfit) {
+	index := map[int64]int{}
+	for _, p := range profits {
+		i, ok := index[p.Start.Unix()]
+		if !ok {
+			i = len(totals)
+			index[p.Start.Unix()] = i
+			totals = append(totals, PeriodProfit{Asset: "All", Start: p.Start, Period: p.Period})
+		}
+		totals[i].Trades += p.Trades
+		totals[i].Wins += p.Wins
+		totals[i].Profit += p.Profit
+	}
+	return totals
+}
@@ -0,0 +1,122 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `positions.go` keeps an eye on the age of open positions in the ledger. Positions whose trigger
+*  price is never reached lock up capital and are flagged as stale.
+ */
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTimestamp is returned when the timestamp of a record can not be read.
+var ErrInvalidTimestamp = errors.New("invalid record timestamp")
+
+var (
+	// staleAlerts holds the last time an alert was sent for each stale record.
+	staleAlerts   = map[string]time.Time{}
+	staleAlertsMu sync.Mutex
+	// staleAlertInterval is how often an alert is repeated for the same stale record.
+	staleAlertInterval = 24 * time.Hour
+)
+
+// Time returns the time at which the record's order was placed. Records hold either a
+// client-side timestamp or the completion time reported by the exchange.
+func (rec Record) Time() (t time.Time, err error) {
+	ts := rec.Timestamp
+	if i := strings.Index(ts, " m="); i > 0 {
+		// Strip the monotonic clock reading.
+		ts = ts[:i]
+	}
+	for _, layout := range []string{timeFormat, "2006-01-02 15:04:05.999999999 -0700 MST", time.RFC3339} {
+		if layout == timeFormat {
+			t, err = time.ParseInLocation(layout, ts, time.Local)
+		} else {
+			t, err = time.Parse(layout, ts)
+		}
+		if err == nil {
+			return
+		}
+	}
+	return t, ErrInvalidTimestamp
+}
+
+// Time returns the time at which the entry's position was closed.
+func (e ProfitEntry) Time() (time.Time, error) {
+	return Record{Timestamp: e.Timestamp}.Time()
+}
+
+// Age returns how long the record has been open. Records with an unreadable timestamp have an age of zero.
+func (rec Record) Age() time.Duration {
+	t, err := rec.Time()
+	if err != nil {
+		return 0
+	}
+	return time.Since(t)
+}
+
+// AgeInDays returns the number of whole days the record has been open.
+func (rec Record) AgeInDays() int {
+	return int(rec.Age() / (24 * time.Hour))
+}
+
+// IsStale returns true if the record has been open longer than `config.StalePositionDays`.
+func (rec Record) IsStale() bool {
+	if cfg().StalePositionDays <= 0 {
+		return false
+	}
+	return rec.AgeInDays() >= int(cfg().StalePositionDays)
+}
+
+// OpenPositions returns all records in the ledger.
+func OpenPositions() (records []Record, err error) {
+	if cfg() == nil || !ledgerExists() {
+		// Nothing has been traded yet.
+		return
+	}
+	l := &Ledger{databasePath: ledgerPath()}
+	l.loadDatabase()
+	defer l.Save()
+	return l.AllRecords()
+}
+
+// StaleRecords returns the records in the ledger that have been open longer than `config.StalePositionDays`.
+func (l *Ledger) StaleRecords() (records []Record, err error) {
+	all, err := l.AllRecords()
+	if err != nil {
+		return
+	}
+	for _, rec := range all {
+		if rec.IsStale() {
+			records = append(records, rec)
+		}
+	}
+	return
+}
+
+// alertStalePositions sends an alert for every stale record of an asset. Each record is alerted at most once a day.
+func (bot *Bot) alertStalePositions(asset string) {
+	if !cfg().StalePositionAlerts || cfg().StalePositionDays <= 0 {
+		return
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	records, err := ledger.StaleRecords()
+	if err != nil {
+		return
+	}
+	staleAlertsMu.Lock()
+	defer staleAlertsMu.Unlock()
+	for _, rec := range records {
+		if rec.Asset != asset || time.Since(staleAlerts[rec.ID]) < staleAlertInterval {
+			continue
+		}
+		staleAlerts[rec.ID] = time.Now()
+		notify(EventAlert, rec.Asset, "%v position %s (%.6f %s at %.2f) has been open for %d days. Trigger price: %.2f",
+			rec.Type, rec.ID, rec.Volume, rec.Asset, rec.Price, rec.AgeInDays(), rec.TriggerPrice)
+	}
+}
@@ -0,0 +1,181 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `positionsizer.go` decides how much fiat is spent on each new entry. The sizer is chosen by name
+*  in the settings. Leprechaun ships three: a fixed amount (the purchase unit or a percentage of the
+*  fiat balance), a fixed fraction of the equity held in an asset, and the Kelly criterion applied to
+*  the win rate of the asset's past trades in the stats files. Other sizers can be registered.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Names of the position sizers shipped with Leprechaun.
+const (
+	SizerFixedAmount   = "fixed_amount"
+	SizerFixedFraction = "fixed_fraction"
+	SizerKelly         = "kelly"
+)
+
+// ErrSizerRegistered is returned when a position sizer is registered under a name that is already taken.
+var ErrSizerRegistered = errors.New("a position sizer with this name is already registered")
+
+// PositionSizer decides the size of new entries.
+type PositionSizer interface {
+	// Name is the name the sizer is chosen by in `SizingSettings.Sizer`.
+	Name() string
+	// Size returns the fiat to spend on an entry in the client's asset at `price`.
+	Size(cl *Client, price float64) float64
+}
+
+// SizingSettings configures the position sizer.
+type SizingSettings struct {
+	// Sizer is the name of the position sizer used. An empty or unknown name uses `SizerFixedAmount`.
+	Sizer string
+	// EquityFraction is the share of the equity held in an asset, its fiat balance and the value
+	// of its asset balance, spent on each entry by `SizerFixedFraction`.
+	EquityFraction float64
+	// KellyFraction scales the Kelly criterion down to reduce the risk of an overestimated edge,
+	// e.g. 0.5 for half Kelly.
+	KellyFraction float64
+	// KellyMaxFraction is the largest share of the equity `SizerKelly` spends on an entry.
+	KellyMaxFraction float64
+	// KellyMinTrades is the number of closed trades of an asset needed before the Kelly criterion is
+	// used. Until then the fixed amount is spent.
+	KellyMinTrades int
+}
+
+// DefaultSizing spends the fixed amount on each entry.
+var DefaultSizing = SizingSettings{Sizer: SizerFixedAmount, EquityFraction: 0.05, KellyFraction: 0.5,
+	KellyMaxFraction: 0.2, KellyMinTrades: 20}
+
+var (
+	positionSizers = map[string]PositionSizer{
+		SizerFixedAmount:   fixedAmountSizer{},
+		SizerFixedFraction: fixedFractionSizer{},
+		SizerKelly:         kellySizer{},
+	}
+	positionSizersMu sync.Mutex
+)
+
+// RegisterPositionSizer makes a position sizer available by its name.
+func RegisterPositionSizer(sizer PositionSizer) error {
+	positionSizersMu.Lock()
+	defer positionSizersMu.Unlock()
+	name := strings.ToLower(sizer.Name())
+	if _, ok := positionSizers[name]; ok {
+		return fmt.Errorf("%w (%s)", ErrSizerRegistered, name)
+	}
+	positionSizers[name] = sizer
+	return nil
+}
+
+// positionSizer returns the position sizer named in the settings.
+func positionSizer() PositionSizer {
+	positionSizersMu.Lock()
+	defer positionSizersMu.Unlock()
+	if sizer, ok := positionSizers[strings.ToLower(cfg().Trade.Sizing.Sizer)]; ok {
+		return sizer
+	}
+	return positionSizers[SizerFixedAmount]
+}
+
+// equity returns the fiat balance and the value of the asset balance of a client at `price`.
+func (cl *Client) equity(price float64) float64 {
+	return cl.fiatBalance + cl.assetBalance*price
+}
+
+// atLeastMinOrder raises `size` to the cost of the smallest order the exchange accepts for the client's pair.
+func (cl *Client) atLeastMinOrder(size, price float64) float64 {
+	return math.Max(size, GetPairInfo(cl.Pair).MinVolume*price)
+}
+
+// fixedAmountSizer spends the purchase unit, or a percentage of the fiat balance, on each entry.
+type fixedAmountSizer struct{}
+
+func (fixedAmountSizer) Name() string { return SizerFixedAmount }
+
+func (fixedAmountSizer) Size(cl *Client, price float64) float64 {
+	return cl.PurchaseUnit(price)
+}
+
+// fixedFractionSizer spends a fixed fraction of the equity held in an asset on each entry.
+type fixedFractionSizer struct{}
+
+func (fixedFractionSizer) Name() string { return SizerFixedFraction }
+
+func (fixedFractionSizer) Size(cl *Client, price float64) float64 {
+	fraction := cfg().Trade.Sizing.EquityFraction
+	if fraction <= 0 {
+		return cl.PurchaseUnit(price)
+	}
+	return cl.atLeastMinOrder(cl.equity(price)*fraction, price)
+}
+
+// tradeRecord counts the closed trades of an asset in the stats files.
+type tradeRecord struct {
+	wins, losses        int
+	totalWin, totalLoss float64
+}
+
+// closedTrades returns the outcome of the trades of `asset` kept in the sales and purchases files.
+func closedTrades(asset string) (record tradeRecord) {
+	sales, _ := GetSales()
+	purchases, _ := GetPurchases()
+	for _, entry := range append(sales, purchases...) {
+		if entry == nil || entry.Asset != asset {
+			continue
+		}
+		if entry.Profit > 0 {
+			record.wins++
+			record.totalWin += entry.Profit
+		} else {
+			record.losses++
+			record.totalLoss -= entry.Profit
+		}
+	}
+	return
+}
+
+// kelly returns the fraction of the equity the Kelly criterion stakes on a trade. It is zero if the
+// trades show no edge.
+func (record tradeRecord) kelly() float64 {
+	trades := record.wins + record.losses
+	if trades == 0 || record.wins == 0 {
+		return 0
+	}
+	winRate := float64(record.wins) / float64(trades)
+	if record.losses == 0 || record.totalLoss == 0 {
+		return winRate
+	}
+	// The payoff ratio is the average win over the average loss.
+	payoff := (record.totalWin / float64(record.wins)) / (record.totalLoss / float64(record.losses))
+	return math.Max(winRate-(1-winRate)/payoff, 0)
+}
+
+// kellySizer stakes the share of the equity given by the Kelly criterion for the asset's past trades.
+type kellySizer struct{}
+
+func (kellySizer) Name() string { return SizerKelly }
+
+func (kellySizer) Size(cl *Client, price float64) float64 {
+	settings := cfg().Trade.Sizing
+	record := closedTrades(cl.asset)
+	if record.wins+record.losses < settings.KellyMinTrades {
+		return cl.PurchaseUnit(price)
+	}
+	fraction := record.kelly() * settings.KellyFraction
+	if settings.KellyMaxFraction > 0 {
+		fraction = math.Min(fraction, settings.KellyMaxFraction)
+	}
+	if fraction == 0 {
+		debugf("The past %s trades show no edge. Leprechaun will only spend the smallest amount the exchange accepts.", cl.name)
+	}
+	return cl.atLeastMinOrder(cl.equity(price)*fraction, price)
+}
@@ -0,0 +1,72 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `pricecache.go` caches the trades retrieved for each candle. A candle is retrieved with one request
+*  to the exchange, so analyzing a day of hourly candles takes about 24 requests per asset. Once a
+*  candle's period is over its trades do not change, so they are kept and reused by later analyses
+*  within the cache's lifetime and by retries after an error, and only the latest candle is retrieved again.
+ */
+
+import (
+	"sync"
+	"time"
+
+	luno "github.com/luno/luno-go"
+)
+
+// tradesCacheAge is how long the trades of a candle are kept after the candle began.
+const tradesCacheAge = 7 * 24 * time.Hour
+
+// tradesKey identifies the trades retrieved for a candle.
+type tradesKey struct {
+	pair  string
+	since time.Time
+}
+
+var (
+	tradesCacheMu sync.Mutex
+	tradesCache   = map[tradesKey][]luno.Trade{}
+)
+
+// cachedTrades returns the trades of `pair` since `since` that were kept, if there are any.
+func cachedTrades(pair string, since time.Time) (trades []luno.Trade, ok bool) {
+	tradesCacheMu.Lock()
+	defer tradesCacheMu.Unlock()
+	trades, ok = tradesCache[tradesKey{pair, since}]
+	return
+}
+
+// keepTrades keeps the trades of a candle that began at `since` and is `interval` long, if its period is
+// over. The trades of candles older than `tradesCacheAge` are dropped.
+func keepTrades(pair string, since time.Time, interval time.Duration, trades []luno.Trade) {
+	now := time.Now()
+	if since.Add(interval).After(now) {
+		// The candle is still open, so more trades may come in.
+		return
+	}
+	tradesCacheMu.Lock()
+	defer tradesCacheMu.Unlock()
+	for key := range tradesCache {
+		if now.Sub(key.since) > tradesCacheAge {
+			delete(tradesCache, key)
+		}
+	}
+	tradesCache[tradesKey{pair, since}] = trades
+}
+
+// tradesSince returns the trades of the pair since `since`, for a candle `interval` long. The trades of
+// candles whose period is over are only retrieved from the exchange once.
+func (cl *Client) tradesSince(since luno.Time, interval time.Duration) ([]luno.Trade, error) {
+	if trades, ok := cachedTrades(cl.Pair, time.Time(since)); ok {
+		return trades, nil
+	}
+	sleep2() // Error 429 safety
+	req := luno.ListTradesRequest{Pair: cl.Pair, Since: since}
+	res, err := cl.ListTrades(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	keepTrades(cl.Pair, time.Time(since), interval, res.Trades)
+	return res.Trades, nil
+}
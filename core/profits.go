@@ -0,0 +1,314 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `profits.go` keeps the profits of closed positions in the PROFITS table of the ledger database. Each
+*  sale that closes a long position and each purchase that closes a short one is a row, and the all
+*  time stats of an asset are summed from its rows, so every entry is kept and no running totals can
+*  drift. Older versions kept the latest entries and the running totals in JSON files. They are moved
+*  into the table the first time the ledger is opened, and renamed so they are not read again.
+ */
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of the rows in the PROFITS table.
+const (
+	// profitSale closes a long position.
+	profitSale = "sale"
+	// profitPurchase buys back a short position.
+	profitPurchase = "purchase"
+	// profitCarried holds the part of the all time stats of an asset that older versions had summed but
+	// no longer kept the entries of. It is counted in the stats, but is not a sale or a purchase.
+	profitCarried = "carried"
+	// profitImported is the profit of a sale made on the exchange before the user used Leprechaun. It is
+	// counted in the stats like a carried row. See `ImportTradeHistory`.
+	profitImported = "imported"
+	// profitHistory marks an asset whose trade history has been imported. Its values are zero, so it adds
+	// nothing to the stats.
+	profitHistory = "history"
+)
+
+const profitsInit = `
+CREATE TABLE PROFITS (
+	ID INTEGER PRIMARY KEY AUTOINCREMENT,
+	KIND TEXT NOT NULL,
+	ASSET TEXT NOT NULL,
+	ORDER_ID TEXT NOT NULL DEFAULT '',
+	PARENT_ID TEXT NOT NULL DEFAULT '',
+	OPENED TEXT NOT NULL DEFAULT '',
+	TIMESTAMP TEXT NOT NULL DEFAULT '',
+	PURCHASE_PRICE REAL NOT NULL DEFAULT 0,
+	PURCHASE_VOLUME REAL NOT NULL DEFAULT 0,
+	PURCHASE_COST REAL NOT NULL DEFAULT 0,
+	SALE_PRICE REAL NOT NULL DEFAULT 0,
+	SALE_VOLUME REAL NOT NULL DEFAULT 0,
+	SALE_COST REAL NOT NULL DEFAULT 0,
+	PROFIT REAL NOT NULL DEFAULT 0,
+	TRANCHES INTEGER NOT NULL DEFAULT 0,
+	SIMULATED INTEGER NOT NULL DEFAULT 0,
+	FEES REAL NOT NULL DEFAULT 0
+);
+CREATE INDEX PROFITS_KIND ON PROFITS (KIND, SIMULATED);
+CREATE INDEX PROFITS_ASSET ON PROFITS (ASSET, SIMULATED);`
+
+var (
+	profitColumns = "ASSET, ORDER_ID, PARENT_ID, OPENED, TIMESTAMP, PURCHASE_PRICE, PURCHASE_VOLUME, PURCHASE_COST, " +
+		"SALE_PRICE, SALE_VOLUME, SALE_COST, PROFIT, TRANCHES, FEES"
+	profitInsert = "INSERT INTO PROFITS (KIND, SIMULATED, " + profitColumns +
+		") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	profitDelete = "DELETE FROM PROFITS WHERE ORDER_ID = ?"
+	profitSelect = "SELECT " + profitColumns + " FROM PROFITS WHERE KIND = ? AND SIMULATED = ? ORDER BY ID"
+	// profitTotals sums the all time stats of an asset. The prices are averages weighted by volume.
+	profitTotals = `SELECT coalesce(sum(PURCHASE_VOLUME), 0), coalesce(sum(PURCHASE_COST), 0), coalesce(sum(SALE_VOLUME), 0),
+		coalesce(sum(SALE_COST), 0), coalesce(sum(PROFIT), 0), coalesce(sum(TRANCHES), 0), coalesce(sum(FEES), 0)
+		FROM PROFITS WHERE ASSET = ? AND SIMULATED = 0`
+	// profitMigrations add the columns of the PROFITS table that older versions did not have.
+	profitMigrations = []string{
+		"ALTER TABLE PROFITS ADD COLUMN FEES REAL NOT NULL DEFAULT 0",
+	}
+)
+
+// initProfits creates the PROFITS table if the SQLite ledger `db` at `path` has none, and moves the
+// profits older versions saved in JSON files next to it into the table. Tables created by older versions
+// get the columns they are missing.
+func initProfits(db *sql.DB, path string) error {
+	var tables int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'PROFITS'").Scan(&tables); err != nil {
+		return err
+	}
+	if tables > 0 {
+		return migrateProfitColumns(db)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(profitsInit); err != nil {
+		tx.Rollback()
+		return err
+	}
+	dir := filepath.Dir(path)
+	migrated := []string{}
+	for _, m := range []struct {
+		dir       string
+		simulated bool
+	}{{dir, false}, {filepath.Join(dir, "dryrun"), true}} {
+		files, err := migrateProfits(tx, m.dir, m.simulated)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not move the profits in %s into the ledger: %w", m.dir, err)
+		}
+		migrated = append(migrated, files...)
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	for _, file := range migrated {
+		// The files are kept, renamed, in case the user downgrades.
+		if err = os.Rename(file, file+".migrated"); err != nil {
+			log.Printf("ledger: could not rename %s: %v", file, err)
+		}
+	}
+	if len(migrated) > 0 {
+		log.Printf("ledger: moved the profits in %s into the PROFITS table", strings.Join(migrated, ", "))
+	}
+	return nil
+}
+
+// migrateProfitColumns runs the `profitMigrations` that add columns missing from the PROFITS table of an
+// SQLite ledger. SQLite can not add a column only if it does not exist, so the columns are read first.
+func migrateProfitColumns(db *sql.DB) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info('PROFITS')")
+	if err != nil {
+		return err
+	}
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		columns[strings.ToUpper(name)] = true
+	}
+	rows.Close()
+	for _, op := range profitMigrations {
+		column := strings.Fields(strings.SplitN(op, "ADD COLUMN ", 2)[1])[0]
+		if columns[column] {
+			continue
+		}
+		if _, err = db.Exec(op); err != nil {
+			return err
+		}
+		log.Printf("ledger: added column %s to the PROFITS table", column)
+	}
+	return nil
+}
+
+// migrateProfits inserts the sales, purchases and all time stats saved in the JSON files in `dir` into
+// the PROFITS table and returns the paths of the files it read. Older versions kept only the latest
+// sales and purchases, so the part of the stats of each asset that the saved entries do not add up to
+// is inserted as a carried row.
+func migrateProfits(tx *sql.Tx, dir string, simulated bool) (files []string, err error) {
+	// read decodes the JSON file `name` in `dir` into `v`. It reports false if there is no such file. A
+	// damaged file is skipped and left as it is, so it does not keep the ledger from opening.
+	read := func(name string, v interface{}) (bool, error) {
+		path := filepath.Join(dir, name)
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		if err = json.NewDecoder(f).Decode(v); err != nil && err != io.EOF {
+			log.Printf("ledger: could not read %s, so its profits were not moved into the ledger: %v", path, err)
+			return false, nil
+		}
+		files = append(files, path)
+		return true, nil
+	}
+	saved := map[string]ProfitEntry{} // The sums of the saved entries of each asset.
+	for _, kind := range []string{profitSale, profitPurchase} {
+		entries := []*ProfitEntry{}
+		if _, err = read(kind+"s.json", &entries); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry == nil {
+				continue
+			}
+			if err = insertProfit(tx, kind, *entry, simulated); err != nil {
+				return nil, err
+			}
+			sum := saved[entry.Asset]
+			sum.PurchaseVolume += entry.PurchaseVolume
+			sum.PurchaseCost += entry.PurchaseCost
+			sum.SaleVolume += entry.SaleVolume
+			sum.SaleCost += entry.SaleCost
+			sum.Profit += entry.Profit
+			sum.Tranches += entry.Tranches
+			saved[entry.Asset] = sum
+		}
+	}
+	for asset, name := range assetNames {
+		stats := ProfitEntry{}
+		found, err := read(fmt.Sprintf("%s-stats.json", strings.ToLower(name)), &stats)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		sum := saved[asset]
+		carried := ProfitEntry{Asset: asset, PurchaseVolume: stats.PurchaseVolume - sum.PurchaseVolume,
+			PurchaseCost: stats.PurchaseCost - sum.PurchaseCost, SaleVolume: stats.SaleVolume - sum.SaleVolume,
+			SaleCost: stats.SaleCost - sum.SaleCost, Profit: stats.Profit - sum.Profit, Tranches: stats.Tranches - sum.Tranches}
+		if carried.Tranches == 0 && math.Abs(carried.PurchaseVolume)+math.Abs(carried.PurchaseCost)+math.Abs(carried.SaleVolume)+
+			math.Abs(carried.SaleCost)+math.Abs(carried.Profit) < 1e-6 {
+			// The saved entries add up to the stats, give or take rounding.
+			continue
+		}
+		if err = insertProfit(tx, profitCarried, carried, simulated); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// profitArgs returns the arguments of `profitInsert` that add `entry` as a row of `kind`.
+func profitArgs(kind string, entry ProfitEntry, simulated bool) []interface{} {
+	return []interface{}{kind, simulated, entry.Asset, entry.OrderID, entry.ParentID, entry.Opened, entry.Timestamp,
+		entry.PurchasePrice, entry.PurchaseVolume, entry.PurchaseCost, entry.SalePrice, entry.SaleVolume, entry.SaleCost,
+		entry.Profit, entry.Tranches, entry.Fees}
+}
+
+// insertProfit adds `entry` to the PROFITS table of an SQLite ledger as a row of `kind`.
+func insertProfit(db execer, kind string, entry ProfitEntry, simulated bool) error {
+	_, err := db.Exec(profitInsert, profitArgs(kind, entry, simulated)...)
+	return err
+}
+
+// saveProfit adds the profit of a closed position to the ledger. Entries of simulated orders are kept
+// apart from real ones.
+func saveProfit(kind string, entry ProfitEntry) error {
+	store, c, done, err := sharedLedger.open()
+	if err != nil {
+		return err
+	}
+	defer done()
+	return store.AddProfit(c, kind, entry, simulatedOrder(entry.OrderID))
+}
+
+// deleteProfit removes the profit entries of the order `orderID`, e.g. when the order did not close the
+// position it was recorded for.
+func deleteProfit(orderID string) error {
+	store, c, done, err := sharedLedger.open()
+	if err != nil {
+		return err
+	}
+	defer done()
+	return store.DeleteProfit(c, orderID)
+}
+
+// profitEntries returns the entries of `kind` in the ledger, from the earliest.
+func profitEntries(kind string, simulated bool) (entries []*ProfitEntry, err error) {
+	if !ledgerExists() {
+		// Nothing has been traded yet.
+		return nil, nil
+	}
+	store, c, done, err := sharedLedger.open()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	return store.Profits(c, kind, simulated)
+}
+
+// assetTotals returns the all time stats of the real trades of `asset`. Its prices are the average
+// prices the asset was bought and sold at.
+func assetTotals(asset string) (totals ProfitEntry, err error) {
+	totals.Asset = asset
+	if !ledgerExists() {
+		return totals, nil
+	}
+	store, c, done, err := sharedLedger.open()
+	if err != nil {
+		return totals, err
+	}
+	defer done()
+	if totals, err = store.ProfitTotals(c, asset); err != nil {
+		return totals, err
+	}
+	if totals.PurchaseVolume > 0 {
+		totals.PurchasePrice = totals.PurchaseCost / totals.PurchaseVolume
+	}
+	if totals.SaleVolume > 0 {
+		totals.SalePrice = totals.SaleCost / totals.SaleVolume
+	}
+	return totals, nil
+}
+
+// latestEntries returns the last `n` of `entries`.
+func latestEntries(entries []*ProfitEntry, n int) []*ProfitEntry {
+	if len(entries) > n {
+		return entries[len(entries)-n:]
+	}
+	return entries
+}
@@ -0,0 +1,201 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `pyramid.go` adds to winning positions. While a long position is in profit and the analyzer keeps
+*  emitting the same signal round after round, smaller entries are added to the position, up to a
+*  limit and within the exposure allowed for the asset.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// ErrPyramidLimitReached is returned when a position already holds the maximum number of additional entries.
+	ErrPyramidLimitReached = errors.New("the position already holds the maximum number of additional entries")
+	// ErrExposureLimitReached is returned when an entry would take the exposure to an asset over its limit.
+	ErrExposureLimitReached = errors.New("the entry would exceed the exposure limit for this asset")
+)
+
+// PyramidSettings configures pyramiding.
+type PyramidSettings struct {
+	Enabled     bool
+	Rounds      int32   // Number of consecutive rounds the signal must persist for before each addition.
+	MaxAdds     int32   // Largest number of additional entries per position.
+	SizeRatio   float64 // Size of each additional entry as a fraction of a regular entry.
+	MaxExposure float64 // Largest fraction of the fiat account value the open positions of an asset may hold.
+}
+
+// pyramid tracks the additional entries of the position being pyramided for an asset.
+type pyramid struct {
+	Base string   // ID of the position's first entry.
+	Adds []string // IDs of the additional entries.
+}
+
+// signalStreak counts how many consecutive rounds the analyzer has emitted the same signal for an asset.
+type signalStreak struct {
+	signal SIGNAL
+	count  int
+}
+
+var (
+	pyramidFile = "pyramid.json"
+	pyramidMu   sync.Mutex
+
+	signalStreaks   = map[string]signalStreak{}
+	signalStreaksMu sync.Mutex
+)
+
+// recordSignal notes the signal emitted for an asset in this round and returns the number of
+// consecutive rounds it has been emitted.
+func recordSignal(asset string, signal SIGNAL) int {
+	signalStreaksMu.Lock()
+	defer signalStreaksMu.Unlock()
+	streak := signalStreaks[asset]
+	if streak.signal != signal {
+		streak = signalStreak{signal: signal}
+	}
+	streak.count++
+	signalStreaks[asset] = streak
+	return streak.count
+}
+
+func loadPyramids() (pyramids map[string]pyramid) {
+	pyramids = map[string]pyramid{}
+	data, err := ioutil.ReadFile(filepath.Join(dataDir(), pyramidFile))
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &pyramids)
+	return
+}
+
+func savePyramids(pyramids map[string]pyramid) error {
+	if err := os.MkdirAll(dataDir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(pyramids)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dataDir(), pyramidFile), data, 0644)
+}
+
+// pyramidBase returns the open long position of an asset that new long signals add to.
+// It returns false if pyramiding is disabled or there is no open position to add to.
+func (bot *Bot) pyramidBase(asset string) (base Record, ok bool) {
+	if !cfg().Trade.Pyramid.Enabled {
+		return
+	}
+	if _, building := DCAPlanFor(asset); building {
+		return
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	records, err := ledger.GetRecordsByType(asset, LongOrder)
+	if err != nil || len(records) == 0 {
+		return
+	}
+	pyramidMu.Lock()
+	current := loadPyramids()[asset]
+	pyramidMu.Unlock()
+	for _, rec := range records {
+		if rec.ID == current.Base {
+			return rec, true
+		}
+	}
+	// Start a new pyramid on the oldest open position.
+	base = records[0]
+	for _, rec := range records[1:] {
+		if rec.Age() > base.Age() {
+			base = rec
+		}
+	}
+	return base, true
+}
+
+// Pyramid adds a smaller entry to the open position `base` if it is in profit at `price` and the
+// signal has persisted for `config.Trade.Pyramid.Rounds` rounds. `volume` is the volume of a regular entry.
+func (bot *Bot) Pyramid(cl *Client, base Record, price, volume float64, streak int) (rec Record, err error) {
+	settings := cfg().Trade.Pyramid
+	if price <= base.Price {
+		debugf("The %s position is not in profit. Leprechaun will not add to it.", cl.name)
+		return
+	}
+	rounds := int(math.Max(1, float64(settings.Rounds)))
+	if streak%rounds != 0 {
+		// Each addition needs the signal to persist for another `rounds` rounds.
+		debugf("The %s trend has persisted for %d of %d rounds. Leprechaun will wait before adding to the position.",
+			cl.name, streak%rounds, rounds)
+		return
+	}
+	pyramidMu.Lock()
+	defer pyramidMu.Unlock()
+	pyramids := loadPyramids()
+	current := pyramids[cl.asset]
+	if current.Base != base.ID {
+		current = pyramid{Base: base.ID}
+	}
+	if len(current.Adds) >= int(settings.MaxAdds) {
+		return rec, ErrPyramidLimitReached
+	}
+	addVolume := volume * settings.SizeRatio
+	if cl.asset == "XRP" {
+		addVolume = math.Floor(addVolume)
+	}
+	if addVolume < GetPairInfo(cl.Pair).MinVolume {
+		addVolume = GetPairInfo(cl.Pair).MinVolume
+	}
+	if err = bot.checkExposure(cl, addVolume*price); err != nil {
+		return
+	}
+	rec, err = cl.GoLong(addVolume)
+	if err != nil {
+		return
+	}
+	if updated, e := cl.UpdateOrderDetails(rec); e == nil {
+		rec = updated
+	}
+	if err = bot.addRecordToLedger(rec); err != nil {
+		return
+	}
+	confirmIntent(rec.ClientRef)
+	current.Adds = append(current.Adds, rec.ID)
+	pyramids[cl.asset] = current
+	if err = savePyramids(pyramids); err != nil {
+		return
+	}
+	notify(EventInfo, cl.asset, "Added %.6f %s to the position opened at %s (addition %d of %d).",
+		rec.Volume, cl.asset, GetPairInfo(cl.Pair).FormatPrice(base.Price), len(current.Adds), settings.MaxAdds)
+	return
+}
+
+// checkExposure returns `ErrExposureLimitReached` if buying `cost` more of the client's asset would take the cost
+// of its open positions over `config.Trade.Pyramid.MaxExposure` of the fiat account value.
+func (bot *Bot) checkExposure(cl *Client, cost float64) error {
+	limit := cfg().Trade.Pyramid.MaxExposure
+	if limit <= 0 {
+		return nil
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	records, err := ledger.GetRecordsByType(cl.asset, LongOrder)
+	if err != nil {
+		return err
+	}
+	exposure := 0.0
+	for _, rec := range records {
+		exposure += rec.Cost
+	}
+	if exposure+cost > limit*(cl.fiatBalance+exposure) {
+		return ErrExposureLimitReached
+	}
+	return nil
+}
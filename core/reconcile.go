@@ -0,0 +1,139 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `reconcile.go` compares the orders on the exchange with the ledger at startup. Orders that were
+*  placed but never recorded, and records whose orders were cancelled while Leprechaun was not running,
+*  are reported to the user. Records of orders that were cancelled before they were filled are removed.
+ */
+
+import (
+	"time"
+
+	luno "github.com/luno/luno-go"
+)
+
+// Kinds of discrepancies found between the exchange and the ledger.
+const (
+	// DiscrepancyUnrecorded is a filled order on the exchange that Leprechaun has no record of.
+	DiscrepancyUnrecorded = "UNRECORDED"
+	// DiscrepancyUntracked is an open order on the exchange that Leprechaun is not following.
+	DiscrepancyUntracked = "UNTRACKED"
+	// DiscrepancyCancelled is a ledger record whose order was cancelled before it was filled.
+	DiscrepancyCancelled = "CANCELLED"
+)
+
+// Discrepancy is a difference between an order on the exchange and the ledger.
+type Discrepancy struct {
+	Kind    string
+	Asset   string
+	OrderID string
+	Message string
+}
+
+// reconcileWindow is how far back the order history is compared with the ledger. It matches how
+// long the order tracker remembers orders, so older orders can not be told apart from manual ones.
+var reconcileWindow = trackerRetention
+
+// ReconcileOrders compares the client's open orders and recent order history with the ledger.
+// It must run after `ReconcileIntents`, so orders of unconfirmed intents have been recorded.
+func (bot *Bot) ReconcileOrders(cl *Client) (found []Discrepancy) {
+	sleep() // Error 429 safety
+	req := luno.ListOrdersRequest{Pair: cl.Pair, CreatedBefore: time.Now().UnixNano() / int64(time.Millisecond)}
+	res, err := cl.ListOrders(ctx, &req)
+	if err != nil {
+		debugf("Could not compare the %s orders on the exchange with the ledger. Reason: %v", cl.Pair, err)
+		return
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+
+	known := knownOrderIDs(cl)
+	recorded := map[string]bool{}
+	// Records of both modes are compared, as the exchange's orders may have been placed outside a dry run.
+	if records, err := ledger.everyRecord(); err == nil {
+		for _, rec := range records {
+			recorded[rec.ID] = rec.Asset == cl.asset
+		}
+	}
+	for _, o := range res.Orders {
+		if time.Since(time.Time(o.CreationTimestamp)) > reconcileWindow {
+			continue
+		}
+		inLedger := recorded[o.OrderId]
+		_, isKnown := known[o.OrderId]
+		switch {
+		case o.State == luno.OrderStatePending:
+			if orderTracker != nil {
+				if _, err := orderTracker.Order(o.OrderId); err == nil {
+					continue
+				}
+			}
+			if inLedger || isKnown {
+				// Follow the order again, e.g. after the tracker's file was lost.
+				trackOrder(cl, o.OrderId, sideOf(o.Type), o.LimitVolume.Float64())
+				continue
+			}
+			found = append(found, Discrepancy{Kind: DiscrepancyUntracked, Asset: cl.asset, OrderID: o.OrderId,
+				Message: "it is open on the exchange but was not placed by Leprechaun"})
+		case inLedger && o.Base.Float64() == 0:
+			reflectFill(TrackedOrder{ID: o.OrderId, Asset: cl.asset})
+			found = append(found, Discrepancy{Kind: DiscrepancyCancelled, Asset: cl.asset, OrderID: o.OrderId,
+				Message: "it was cancelled before it was filled. Its record has been removed from the ledger"})
+		case !inLedger && !isKnown && o.Base.Float64() > 0:
+			found = append(found, Discrepancy{Kind: DiscrepancyUnrecorded, Asset: cl.asset, OrderID: o.OrderId,
+				Message: "it was filled on the exchange but is not in the ledger. It may have been placed manually"})
+		}
+	}
+	for _, d := range found {
+		notify(EventAlert, d.Asset, "Order %s for %s: %s.", d.OrderID, cl.Pair, d.Message)
+	}
+	if len(found) > 0 {
+		debugf("Found %d discrepancies between the %s orders on the exchange and the ledger.", len(found), cl.Pair)
+	}
+	return
+}
+
+// knownOrderIDs returns the IDs of the orders for the client's asset that Leprechaun placed or recorded.
+func knownOrderIDs(cl *Client) map[string]struct{} {
+	known := map[string]struct{}{}
+	if orderTracker != nil {
+		for _, o := range orderTracker.Orders() {
+			if o.Asset == cl.asset {
+				known[o.ID] = struct{}{}
+			}
+		}
+	}
+	sales, _ := GetSales()
+	purchases, _ := GetPurchases()
+	for _, entry := range append(sales, purchases...) {
+		if entry.Asset == cl.asset {
+			known[entry.OrderID] = struct{}{}
+		}
+	}
+	if retryQueue != nil {
+		// Orders whose ledger writes are waiting to be retried.
+		for _, op := range retryQueue.Pending() {
+			if op.Record.Asset == cl.asset {
+				known[op.Record.ID] = struct{}{}
+				if op.OrderID != "" {
+					known[op.OrderID] = struct{}{}
+				}
+			}
+		}
+	}
+	if orderIntents != nil {
+		for _, intent := range orderIntents.Unconfirmed(cl.Pair) {
+			known[intent.OrderID] = struct{}{}
+		}
+	}
+	return known
+}
+
+// sideOf returns the side of an order type listed by the exchange.
+func sideOf(listed luno.OrderType) luno.OrderType {
+	if sameSide(listed, luno.OrderTypeBuy) {
+		return luno.OrderTypeBuy
+	}
+	return luno.OrderTypeSell
+}
@@ -0,0 +1,100 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `records.go` keeps a snapshot of the analysis behind each position, so the details of a record can
+*  show why it was opened, and looks up single records for the UI.
+ */
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LunoOrderURL is the page of an order in the Luno web UI. `%s` is replaced by the order ID.
+var LunoOrderURL = "https://www.luno.com/wallet/orders/%s"
+
+// AnalysisSnapshot holds the analysis of an asset at the time a position was opened.
+type AnalysisSnapshot struct {
+	Time                time.Time
+	Signal              SIGNAL
+	Price               float64 // Ask price passed to the analyzer.
+	AnalysisPeriod      time.Duration
+	Interval            time.Duration
+	MovingAverageWindow int
+	Candles             int
+	// Open, High, Low and Close summarize the candles over the analysis period.
+	Open, High, Low, Close float64
+	ATR                    float64 // Average True Range over the volatility sizing period, if there were enough candles.
+	// Confidence is the analysis plugin's confidence in the signal, from 0 to 1.
+	Confidence float64
+	// Spread is the bid-ask spread at the time of the analysis.
+	Spread float64
+	// Scores are the indicators the plugin examined and the score each was given, if it explains its signals.
+	Scores []IndicatorScore `json:",omitempty"`
+}
+
+var (
+	// lastAnalysis holds the snapshot of the last analysis of each asset.
+	lastAnalysis   = map[string]AnalysisSnapshot{}
+	lastAnalysisMu sync.Mutex
+)
+
+// recordAnalysis keeps a snapshot of the analysis of an asset, with the scores of `why`, the plugin's
+// explanation of the signal. It is attached to any position opened on the signal.
+func recordAnalysis(cl *Client, why Explanation, opts *AnalysisOptions, candles []OHLC, price float64, signal SIGNAL, confidence float64) {
+	asset := cl.asset
+	snap := AnalysisSnapshot{Time: time.Now(), Signal: signal, Price: price, Candles: len(candles),
+		Confidence: confidence, Spread: cl.spread, Scores: why.Scores}
+	if opts != nil {
+		snap.AnalysisPeriod, snap.Interval, snap.MovingAverageWindow = opts.AnalysisPeriod, opts.Interval, opts.MovingAverageWindow
+	}
+	if len(candles) > 0 {
+		snap.Open, snap.Close = candles[0].Open, candles[len(candles)-1].Close
+		snap.High, snap.Low = candles[0].High, candles[0].Low
+		for _, c := range candles[1:] {
+			if c.High > snap.High {
+				snap.High = c.High
+			}
+			if c.Low < snap.Low {
+				snap.Low = c.Low
+			}
+		}
+	}
+	snap.ATR = averageTrueRange(candles, cfg().Trade.VolatilitySizing.Period)
+	lastAnalysisMu.Lock()
+	lastAnalysis[asset] = snap
+	lastAnalysisMu.Unlock()
+}
+
+// analysisOf returns the snapshot of the last analysis of an asset, or nil if it has not been analyzed.
+func analysisOf(asset string) *AnalysisSnapshot {
+	lastAnalysisMu.Lock()
+	defer lastAnalysisMu.Unlock()
+	snap, ok := lastAnalysis[asset]
+	if !ok {
+		return nil
+	}
+	return &snap
+}
+
+// GetRecord returns the record in the ledger with the order ID `id`.
+func GetRecord(id string) (rec Record, err error) {
+	if cfg() == nil || !ledgerExists() {
+		return rec, fmt.Errorf("there is no record with id %s", id)
+	}
+	l := &Ledger{databasePath: ledgerPath()}
+	l.loadDatabase()
+	defer l.Save()
+	return l.GetRecordByID(id)
+}
+
+// OrderURL returns the page of the order that opened the record in the Luno web UI.
+// Paper trades and simulated orders are not on the exchange and have no page.
+func (rec Record) OrderURL() string {
+	if rec.ID == "" || cfg().Paper.Enabled || rec.Simulated {
+		return ""
+	}
+	return fmt.Sprintf(LunoOrderURL, rec.ID)
+}
@@ -0,0 +1,118 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `reference.go` cross-checks the exchange's ticker against a second, public price source. If the two
+*  prices are too far apart the ticker may have printed a glitched or manipulated price, and trading
+*  in the asset is paused until they agree again.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoReferencePrice is returned when the reference source has no price for an asset.
+	ErrNoReferencePrice = errors.New("the reference source has no price for this asset")
+	// ErrPriceDeviation is returned when the exchange's price is too far from the reference price.
+	ErrPriceDeviation = errors.New("the exchange price deviates too far from the reference price")
+)
+
+// ReferencePriceSettings configures the cross-check of the exchange's ticker.
+type ReferencePriceSettings struct {
+	Enabled bool
+	// MaxDeviation is the largest difference between the exchange price and the reference
+	// price, as a fraction of the reference price, at which Leprechaun will still trade.
+	MaxDeviation float64
+}
+
+// PriceSource provides reference prices for assets.
+type PriceSource interface {
+	Name() string
+	// Price returns the price of `asset` in `currency`.
+	Price(asset, currency string) (float64, error)
+}
+
+// referenceSource is the price source the exchange's ticker is checked against.
+var referenceSource PriceSource = coinGeckoSource{}
+
+// SetReferenceSource replaces the source of reference prices.
+func SetReferenceSource(source PriceSource) {
+	if source != nil {
+		referenceSource = source
+	}
+}
+
+// coinGeckoSource fetches reference prices from the public CoinGecko API.
+type coinGeckoSource struct{}
+
+// coinGeckoIDs maps the asset codes used by Luno to CoinGecko coin IDs.
+var coinGeckoIDs = map[string]string{
+	"XBT": "bitcoin",
+	"ETH": "ethereum",
+	"XRP": "ripple",
+	"LTC": "litecoin",
+	"BCH": "bitcoin-cash",
+}
+
+func (coinGeckoSource) Name() string { return "CoinGecko" }
+
+func (coinGeckoSource) Price(asset, currency string) (price float64, err error) {
+	id, ok := coinGeckoIDs[asset]
+	if !ok {
+		return 0, ErrNoReferencePrice
+	}
+	currency = strings.ToLower(currency)
+	endpoint := "https://api.coingecko.com/api/v3/simple/price?" +
+		url.Values{"ids": {id}, "vs_currencies": {currency}}.Encode()
+	client := http.Client{Timeout: 15 * time.Second}
+	res, err := client.Get(endpoint)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("coingecko: %s", res.Status)
+	}
+	prices := map[string]map[string]float64{}
+	if err = json.NewDecoder(res.Body).Decode(&prices); err != nil {
+		return
+	}
+	price, ok = prices[id][currency]
+	if !ok || price <= 0 {
+		return 0, ErrNoReferencePrice
+	}
+	return
+}
+
+// checkReferencePrice compares `price` from the exchange's ticker with the reference price of the
+// client's asset. It returns `ErrPriceDeviation` if they differ by more than
+// `config.Trade.ReferencePrice.MaxDeviation`. If the reference price can not be retrieved the
+// check is skipped, so an outage of the reference source does not stop the bot.
+func (cl *Client) checkReferencePrice(price float64) error {
+	settings := cfg().Trade.ReferencePrice
+	if !settings.Enabled || settings.MaxDeviation <= 0 || price <= 0 {
+		return nil
+	}
+	reference, err := referenceSource.Price(cl.asset, cl.currency)
+	if err != nil {
+		debugf("Could not retrieve the reference price of %s from %s. The price check will be skipped. Reason: %v",
+			cl.name, referenceSource.Name(), err)
+		return nil
+	}
+	deviation := math.Abs(price-reference) / reference
+	if deviation > settings.MaxDeviation {
+		notify(EventAlert, cl.asset, "The %s price on the exchange (%s %s) is %.2f%% away from the %s price (%s %s). Trading in %s is paused until they agree.",
+			cl.name, cl.currency, GetPairInfo(cl.Pair).FormatPrice(price), deviation*100, referenceSource.Name(),
+			cl.currency, GetPairInfo(cl.Pair).FormatPrice(reference), cl.asset)
+		return ErrPriceDeviation
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `reload.go` applies the settings the user saves while the bot runs. The UI sends them over the config
+*  channel instead of changing the settings of the running bot, and the trading loop applies them at its
+*  next safe point, when no asset is being analyzed or placing an order, without stopping the clients.
+*  The settings in use are never changed in place. A changed copy replaces them, so the goroutines that
+*  read them without locks never see a half-applied update.
+*  The profit margin, snooze period, assets to trade, analysis plugin and the other trade settings take
+*  effect then. The settings that choose the account and the ledger, i.e. the API keys, dry run, paper
+*  trading, the storage and the market data source, are saved but only take effect the next time the bot
+*  is started.
+ */
+
+import (
+	"strings"
+)
+
+// Config sets the channel through which the UI sends the settings saved while the bot runs.
+func (c *Channels) Config(channel chan *Configuration) {
+	c.ConfigChan = channel
+}
+
+// applyConfigChanges applies the settings waiting on the config channel, if there are any.
+func (bot *Bot) applyConfigChanges() {
+	if UIChans == nil || UIChans.ConfigChan == nil {
+		return
+	}
+	for {
+		select {
+		case update := <-UIChans.ConfigChan:
+			bot.applyConfig(update)
+		default:
+			return
+		}
+	}
+}
+
+// applyConfig replaces the settings of the running bot with `update` and saves them.
+func (bot *Bot) applyConfig(update *Configuration) {
+	if update == nil {
+		return
+	}
+	orderMu.Lock()
+	defer orderMu.Unlock()
+	analysisMu.Lock()
+	defer analysisMu.Unlock()
+	configMu.Lock()
+	// The goroutines of the bot keep reading the old settings until the new ones are published.
+	current := cfg()
+	next := current.Clone()
+	if err := next.Update(update, false); err != nil {
+		configMu.Unlock()
+		debugf("Could not apply the new settings. Reason: %v", err)
+		return
+	}
+	// The session keeps the account and the ledger it was started with.
+	deferred := next.APIKeyID != current.APIKeyID || next.APIKeySecret != current.APIKeySecret ||
+		next.DryRun != current.DryRun || next.Paper != current.Paper || next.Storage != current.Storage ||
+		next.MarketData != current.MarketData
+	next.APIKeyID, next.APIKeySecret, next.DryRun, next.Paper = current.APIKeyID, current.APIKeySecret, current.DryRun, current.Paper
+	next.Storage, next.MarketData = current.Storage, current.MarketData
+	publishConfig(next)
+	configMu.Unlock()
+	if err := update.Save(); err != nil {
+		debugf("Could not save the new settings. Reason: %v", err)
+	}
+	if !strings.EqualFold(current.Trade.AnalysisPlugin.Name, next.Trade.AnalysisPlugin.Name) {
+		bot.analyzer = PluginHandler.Default
+		if analyzer, ok := PluginHandler.plugins[strings.ToLower(next.Trade.AnalysisPlugin.Name)]; ok {
+			bot.SetAnalysisPlugin(analyzer)
+		}
+		bot.analyzerOptions = ResolveAnalysisOptions(bot.analyzer, "")
+		// The new plugin's record starts afresh.
+		strategy.reset(next.Trade.AnalysisPlugin.Name)
+	}
+	// Instances created for each asset under the old settings are not reused.
+	PluginHandler.resetInstances()
+	notifications.Configure(next.Notifications)
+	debug("Your new settings have been applied.")
+	if deferred {
+		debug("The changes to your API keys, trading mode, storage and market data will take effect the next time Leprechaun is started.")
+	}
+}
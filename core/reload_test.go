@@ -0,0 +1,58 @@
+package core
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestApplyConfig applies settings saved while the assets read the settings in use, as they do between
+// safe points. Run it with -race.
+func TestApplyConfig(t *testing.T) {
+	useTempLedger(t)
+	start := cfg().Clone()
+	start.APIKeyID, start.SnoozePeriod, start.SnoozeTimes = "key", 5, []int32{5}
+	publishConfig(start)
+
+	var (
+		readers sync.WaitGroup
+		done    = make(chan struct{})
+	)
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snoozeMinutes()
+			}
+		}()
+	}
+	bot := &Bot{}
+	for i := int32(1); i <= 20; i++ {
+		update := start.Clone()
+		update.SetAppDir(filepath.Join(start.DataDir, "app"))
+		update.APIKeyID, update.RandomSnooze, update.SnoozePeriod = "new key", i%2 == 0, 10+i
+		bot.applyConfig(update)
+	}
+	close(done)
+	readers.Wait()
+
+	got := cfg()
+	if got == start {
+		t.Fatal("the settings in use were not replaced")
+	}
+	if got.SnoozePeriod != 30 || !got.RandomSnooze {
+		t.Errorf("the settings in use snooze for %d minutes (random: %v), want the last settings applied", got.SnoozePeriod, got.RandomSnooze)
+	}
+	if got.APIKeyID != "key" {
+		t.Errorf("the API key in use is %q, want the key the session was started with", got.APIKeyID)
+	}
+	if start.SnoozePeriod != 5 || start.APIKeyID != "key" {
+		t.Error("applying new settings changed the settings that were in use")
+	}
+}
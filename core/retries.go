@@ -0,0 +1,292 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `retries.go` holds a durable queue of ledger writes that failed after their trade had already
+*  happened on the exchange, e.g. a new position or the profit of a sale that could not be saved.
+*  Failed writes are saved to file and retried in the background until they succeed, so trades are
+*  not lost from the ledger because of a transient error.
+ */
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Kinds of ledger operations that can be retried.
+const (
+	// OpAddRecord adds a new position to the ledger.
+	OpAddRecord = "ADD_RECORD"
+	// OpSale records the profit of closing a long position.
+	OpSale = "SALE"
+	// OpPurchase records the profit of closing a short position.
+	OpPurchase = "PURCHASE"
+	// OpDeleteRecord moves a closed position from the ledger to the closed records.
+	OpDeleteRecord = "DELETE_RECORD"
+)
+
+var (
+	// retryQueue is the queue used by the running bot.
+	retryQueue *RetryQueue
+
+	// retryInterval is how often the queue tries to drain.
+	retryInterval = 30 * time.Second
+	// retryAlertAttempts is the number of failed attempts after which the user is alerted.
+	retryAlertAttempts = 10
+)
+
+// PendingOperation is a ledger write that has not succeeded yet.
+type PendingOperation struct {
+	ID        string
+	Kind      string
+	Record    Record // Position added, closed or removed by the operation.
+	OrderID   string // Order that closed the position. Only set for sales and purchases.
+	Timestamp string // Time the position was closed.
+	Price     float64
+	Volume    float64
+	Fees      float64 // Fees of the orders that opened and closed the position, in fiat.
+	Attempts  int
+	LastError string
+	Created   time.Time
+	NextTry   time.Time
+}
+
+// RetryQueue saves failed ledger operations to file and retries them until they succeed.
+type RetryQueue struct {
+	mu      sync.Mutex
+	ops     map[string]*PendingOperation
+	path    string
+	stop    chan struct{}
+	running bool
+}
+
+// NewRetryQueue creates a queue that saves its operations to `path`. Previously saved operations are loaded.
+func NewRetryQueue(path string) *RetryQueue {
+	q := &RetryQueue{ops: map[string]*PendingOperation{}, path: path}
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		if err = json.NewDecoder(f).Decode(&q.ops); err != nil {
+			debugf("Could not load failed ledger operations. Reason: %v", err)
+		}
+	}
+	if q.ops == nil {
+		q.ops = map[string]*PendingOperation{}
+	}
+	return q
+}
+
+// Enqueue saves a failed operation so it is retried later.
+func (q *RetryQueue) Enqueue(op PendingOperation, reason error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	op.ID = newClientRef()
+	op.Created = time.Now()
+	op.Attempts = 1
+	op.LastError = reason.Error()
+	op.NextTry = op.Created.Add(backoff(op.Attempts))
+	q.ops[op.ID] = &op
+	q.save()
+}
+
+// Pending returns copies of the operations that have not succeeded yet.
+func (q *RetryQueue) Pending() (ops []PendingOperation) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, op := range q.ops {
+		ops = append(ops, *op)
+	}
+	return
+}
+
+// Closing reports whether the position `recordID` has been closed on the exchange but not yet removed from the ledger.
+func (q *RetryQueue) Closing(recordID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, op := range q.ops {
+		if op.Kind == OpDeleteRecord && op.Record.ID == recordID {
+			return true
+		}
+	}
+	return false
+}
+
+// Run starts a goroutine that retries the queued operations. It returns immediately.
+func (q *RetryQueue) Run() {
+	q.mu.Lock()
+	if q.running {
+		q.mu.Unlock()
+		return
+	}
+	q.stop = make(chan struct{})
+	q.running = true
+	q.mu.Unlock()
+
+	go func() {
+		tick := time.NewTicker(retryInterval)
+		defer tick.Stop()
+		for {
+			q.drain()
+			select {
+			case <-q.stop:
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the retry goroutine. Operations that have not succeeded are kept on file.
+func (q *RetryQueue) Stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.running {
+		return
+	}
+	close(q.stop)
+	q.running = false
+	q.save()
+}
+
+// drain retries every operation that is due.
+func (q *RetryQueue) drain() {
+	now := time.Now()
+	for _, op := range q.Pending() {
+		if now.Before(op.NextTry) {
+			continue
+		}
+		err := op.apply()
+		q.mu.Lock()
+		queued, ok := q.ops[op.ID]
+		if !ok {
+			q.mu.Unlock()
+			continue
+		}
+		if err == nil {
+			delete(q.ops, op.ID)
+			q.save()
+			q.mu.Unlock()
+			debugf("Saved %s of %s to the ledger after %d failed attempts.", op.Kind, op.Record.ID, op.Attempts)
+			continue
+		}
+		queued.Attempts++
+		queued.LastError = err.Error()
+		queued.NextTry = now.Add(backoff(queued.Attempts))
+		attempts := queued.Attempts
+		q.save()
+		q.mu.Unlock()
+		if attempts == retryAlertAttempts {
+			notify(EventError, op.Record.Asset, "Leprechaun has failed %d times to save %s of %s to the ledger. It will keep trying. Reason: %v",
+				attempts, op.Kind, op.Record.ID, err)
+		}
+	}
+}
+
+// apply performs the operation on the ledger.
+func (op PendingOperation) apply() (err error) {
+	rec := op.Record
+	switch op.Kind {
+	case OpAddRecord:
+		ledger := bot.Ledger()
+		defer ledger.Save()
+		if _, e := ledger.GetRecordByID(rec.ID); e == nil {
+			// An earlier attempt succeeded before the error was reported.
+			return nil
+		}
+		return ledger.AddRecord(rec)
+	case OpSale:
+		return NewSale(rec.Asset, op.OrderID, rec.ParentID, rec.Timestamp, op.Timestamp, rec.Price, rec.Volume, op.Price, op.Volume, op.Fees)
+	case OpPurchase:
+		return NewPurchase(rec.Asset, op.OrderID, rec.ParentID, rec.Timestamp, op.Timestamp, rec.Price, rec.Volume, op.Price, op.Volume, op.Fees)
+	case OpDeleteRecord:
+		ledger := bot.Ledger()
+		defer ledger.Save()
+		if _, e := ledger.GetRecordByID(rec.ID); e == sql.ErrNoRows {
+			return nil
+		}
+		if err = ledger.CloseRecord(rec.ID, op.OrderID, op.Timestamp, op.Price, op.Volume); err == nil {
+			bot.closeTranche(ledger, rec)
+		}
+		return
+	}
+	return fmt.Errorf("unknown ledger operation %q", op.Kind)
+}
+
+// save writes the queue to file. The caller must hold q.mu.
+func (q *RetryQueue) save() {
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		debugf("Could not save failed ledger operations. Reason: %v", err)
+		return
+	}
+	data, err := json.Marshal(q.ops)
+	if err == nil {
+		err = replaceFileSynced(q.path, data)
+	}
+	if err != nil {
+		debugf("Could not save failed ledger operations. Reason: %v", err)
+	}
+}
+
+// retryLater queues a failed ledger operation in the running bot's queue and alerts the user.
+// It returns false if there is no queue, in which case the caller must handle the error.
+func retryLater(op PendingOperation, reason error) bool {
+	if retryQueue == nil {
+		return false
+	}
+	retryQueue.Enqueue(op, reason)
+	notify(EventAlert, op.Record.Asset, "Could not save %s of %s to the ledger. Leprechaun will keep trying in the background. Reason: %v",
+		op.Kind, op.Record.ID, reason)
+	return true
+}
+
+// withoutClosing drops the positions that have already been closed but are still waiting to be removed
+// from the ledger, so they are not closed a second time.
+func withoutClosing(records []Record) []Record {
+	if retryQueue == nil {
+		return records
+	}
+	open := records[:0]
+	for _, rec := range records {
+		if !retryQueue.Closing(rec.ID) {
+			open = append(open, rec)
+		}
+	}
+	return open
+}
+
+// closeLedgerRecord records the profit of a closed position and moves it to the closed records. Writes
+// that fail are queued for retry. It returns false if a write failed and could not be queued. The fee of
+// the order that closed the position is estimated from the taker fee, as the order has just been placed.
+func (bot *Bot) closeLedgerRecord(ledger *Ledger, rec Record, orderID string, price, volume float64) bool {
+	op := PendingOperation{Record: rec, OrderID: orderID, Timestamp: time.Now().Format(timeFormat), Price: price, Volume: volume,
+		Fees: rec.Fees() + closingFee(rec.Asset, price, volume)}
+	journalClose(rec, orderID, price, volume)
+	var err error
+	if rec.Type == LongOrder {
+		op.Kind = OpSale
+		err = NewSale(rec.Asset, orderID, rec.ParentID, rec.Timestamp, op.Timestamp, rec.Price, rec.Volume, price, volume, op.Fees)
+	} else {
+		op.Kind = OpPurchase
+		err = NewPurchase(rec.Asset, orderID, rec.ParentID, rec.Timestamp, op.Timestamp, rec.Price, rec.Volume, price, volume, op.Fees)
+	}
+	saved := true
+	if err != nil && !retryLater(op, err) {
+		debugf("ERROR! Could not record the profit of closing %s. Reason: %v", rec.ID, err)
+		saved = false
+	}
+	if err = ledger.CloseRecord(rec.ID, orderID, op.Timestamp, price, volume); err != nil {
+		op.Kind = OpDeleteRecord
+		if !retryLater(op, err) {
+			debugf("ERROR! Could not move record with ID %s to the closed records.", rec.ID)
+			return false
+		}
+		return saved
+	}
+	bot.closeTranche(ledger, rec)
+	return saved
+}
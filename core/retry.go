@@ -0,0 +1,184 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `retry.go` tries operations again when they fail for a passing reason, such as a dropped connection
+*  or the exchange's rate limit. The wait before each attempt is longer than the one before (exponential
+*  backoff), and a random part of it is added or taken away (jitter) so the assets that failed together
+*  do not all try again at the same time. Errors that another attempt will not fix, such as a rejected
+*  order or invalid API keys, are returned at once.
+ */
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// errRateLimited is the error of a request refused by the exchange's rate limit.
+	errRateLimited = errors.New("luno: too many requests")
+	// errServerFailed is the error of a request the exchange's servers could not answer.
+	errServerFailed = errors.New("luno: server error")
+	// errNoPrices is returned when the exchange returns no price data for an analysis.
+	errNoPrices = errors.New("the exchange returned no price data")
+)
+
+// RetryPolicy sets how an operation is tried again.
+type RetryPolicy struct {
+	// InitialDelay is the wait before the second attempt. Each wait after it is `Multiplier` times as
+	// long as the one before, up to `MaxDelay`.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	// Jitter is the part of each wait, from 0 to 1, that is random.
+	Jitter float64
+	// MaxAttempts is the most times the operation is tried, and MaxElapsed the longest time spent trying
+	// it. Zero is unlimited.
+	MaxAttempts int
+	MaxElapsed  time.Duration
+	// Retryable reports whether an error may pass if the operation is tried again. If it is nil every
+	// error is tried again.
+	Retryable func(error) bool
+}
+
+var (
+	// exchangeRetryPolicy is used for each request to the exchange.
+	exchangeRetryPolicy = RetryPolicy{InitialDelay: 500 * time.Millisecond, MaxDelay: 8 * time.Second, Multiplier: 2,
+		Jitter: 0.2, MaxAttempts: 4, MaxElapsed: 20 * time.Second, Retryable: retryableExchangeError}
+	// analysisRetryPolicy is used to retrieve the price data of an analysis.
+	analysisRetryPolicy = RetryPolicy{InitialDelay: 2 * time.Second, MaxDelay: 10 * time.Second, Multiplier: 2,
+		Jitter: 0.2, MaxAttempts: 3, Retryable: func(err error) bool { return err == errNoPrices || retryableExchangeError(err) }}
+	// trackerRetryPolicy spaces the updates of an order, and the retries of a ledger write, that keep failing.
+	trackerRetryPolicy = RetryPolicy{InitialDelay: trackerMinBackoff, MaxDelay: trackerMaxBackoff, Multiplier: 2, Jitter: 0.1}
+)
+
+// connectRetryPolicy is used to connect to the exchange when the bot starts. It tries until the bot
+// connects, unless the settings ask Leprechaun to exit when it can not.
+func connectRetryPolicy() RetryPolicy {
+	return RetryPolicy{InitialDelay: 10 * time.Second, MaxDelay: 5 * time.Minute, Multiplier: 2, Jitter: 0.2,
+		Retryable: func(err error) bool {
+			switch err {
+			case ErrInvalidAPICredentials, ErrAPIKeyRevoked, ErrCancelled:
+				return false
+			}
+			return !cfg().ExitOnInitFailed
+		}}
+}
+
+// delay returns the wait after attempt number `attempt` fails.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay)
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < float64(p.MaxDelay)); i++ {
+		delay *= p.Multiplier
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// retryable reports whether `err` is worth another attempt. The bot being stopped never is.
+func (p RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, ErrCancelled) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// retry runs `op` until it succeeds, fails with an error `policy` does not retry, or the attempts or time
+// allowed by `policy` run out, and returns its last error. It stops waiting if `c` is done or the user
+// stops the bot.
+func retry(c context.Context, policy RetryPolicy, op func() error) (err error) {
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		if err = op(); err == nil || !policy.retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+		wait := policy.delay(attempt)
+		if policy.MaxElapsed > 0 && time.Since(started)+wait > policy.MaxElapsed {
+			return err
+		}
+		if e := snoozeFor(c, wait); e != nil {
+			return e
+		}
+	}
+}
+
+// retryableExchangeError reports whether a request to the exchange that failed with `err` may succeed if
+// it is sent again. Errors from the network and the exchange's rate limit and servers pass. An error the
+// exchange answered with, such as a rejected order, does not.
+func retryableExchangeError(err error) bool {
+	var netErr net.Error
+	switch {
+	case err == errRateLimited, err == errServerFailed, err == ErrNetworkFailed, err == ErrConnectionTimeout:
+		return true
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return true
+	}
+	// The exchange client reports the exchange's answers as text. Only its rate limit and server errors pass.
+	msg := err.Error()
+	return strings.Contains(msg, "too many requests") || strings.Contains(msg, "error decoding response (5")
+}
+
+// retryTransport sends a request to the exchange again when it fails for a passing reason. Reads are
+// tried again after network errors, server errors and the rate limit. Other requests place or cancel
+// orders and are only tried again after the rate limit, which refuses them before they are processed.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := exchangeRetryPolicy
+	policy.Retryable = func(err error) bool {
+		return err == errRateLimited || (req.Method == http.MethodGet && retryableExchangeError(err))
+	}
+	var (
+		res     *http.Response
+		attempt int
+	)
+	err := retry(req.Context(), policy, func() (err error) {
+		attempt++
+		if res != nil {
+			// The failed response is dropped before the request is sent again.
+			res.Body.Close()
+			res = nil
+		}
+		send := req
+		if attempt > 1 && req.Body != nil {
+			if req.GetBody == nil {
+				return errors.New("the request can not be sent again")
+			}
+			send = req.Clone(req.Context())
+			if send.Body, err = req.GetBody(); err != nil {
+				return err
+			}
+		}
+		if res, err = t.next.RoundTrip(send); err != nil {
+			return err
+		}
+		switch {
+		case res.StatusCode == http.StatusTooManyRequests:
+			return errRateLimited
+		case res.StatusCode >= http.StatusInternalServerError:
+			return errServerFailed
+		}
+		return nil
+	})
+	if res != nil {
+		// The last response is returned even if it is an error, so the exchange client can read it.
+		return res, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,139 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `risk.go` holds the risk manager. It is consulted before every order that opens or adds to a
+*  position and vetoes the order if it would take the open exposure of an asset, or of the whole
+*  portfolio, over its limit, or if the account has lost more than the allowed drawdown since the
+*  trading session started. Orders that close positions are never vetoed.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrAssetExposureLimit is returned when an order would take the open exposure of an asset over its limit.
+	ErrAssetExposureLimit = errors.New("the order would exceed the exposure limit for the asset")
+	// ErrPortfolioExposureLimit is returned when an order would take the open exposure of all assets over its limit.
+	ErrPortfolioExposureLimit = errors.New("the order would exceed the exposure limit for the portfolio")
+	// ErrMaxDrawdown is returned when the account has lost more than the allowed drawdown since the session started.
+	ErrMaxDrawdown = errors.New("the maximum drawdown for the session has been reached")
+)
+
+// RiskSettings configures the risk manager. Limits are fractions of the account value. Zero disables a limit.
+type RiskSettings struct {
+	Enabled bool
+	// MaxAssetExposure limits the cost of the open long positions of each asset.
+	MaxAssetExposure float64
+	// MaxPortfolioExposure limits the cost of the open long positions of all assets together.
+	MaxPortfolioExposure float64
+	// MaxDrawdown is how much the account value may fall below its value at the start of the session.
+	MaxDrawdown float64
+}
+
+// RiskManager enforces `config.Trade.Risk` for a trading session.
+type RiskManager struct {
+	mu sync.Mutex
+	// prices holds the last price seen for each asset. Open positions are valued at these prices.
+	prices     map[string]float64
+	startValue float64
+}
+
+// NewRiskManager creates a risk manager for a new trading session. The session's starting value is
+// taken the first time the manager is consulted.
+func NewRiskManager() *RiskManager {
+	return &RiskManager{prices: map[string]float64{}}
+}
+
+// exposure returns the cost and the value at the last seen prices of the open long positions of each asset.
+func (r *RiskManager) exposure(ledger *Ledger) (cost, value map[string]float64, err error) {
+	records, err := ledger.AllRecords()
+	if err != nil {
+		return
+	}
+	cost, value = map[string]float64{}, map[string]float64{}
+	for _, rec := range records {
+		if rec.Type != LongOrder {
+			continue
+		}
+		cost[rec.Asset] += rec.Cost
+		if price, ok := r.prices[rec.Asset]; ok {
+			value[rec.Asset] += rec.Volume * price
+		} else {
+			value[rec.Asset] += rec.Cost
+		}
+	}
+	return
+}
+
+// Check returns a non-nil error if opening a position of `volume` in the client's asset would break a
+// risk limit. `price` is the current price of the asset. If it is zero, the last price seen is used.
+// Only long and short signals are checked.
+func (r *RiskManager) Check(ledger *Ledger, cl *Client, signal SIGNAL, volume, price float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if price > 0 {
+		r.prices[cl.asset] = price
+	}
+	cost := volume * r.prices[cl.asset]
+	settings := cfg().Trade.Risk
+	if !settings.Enabled || (signal != SignalLong && signal != SignalShort) {
+		return nil
+	}
+	costs, values, err := r.exposure(ledger)
+	if err != nil {
+		return err
+	}
+	invested, worth := 0.0, 0.0
+	for asset := range costs {
+		invested += costs[asset]
+		worth += values[asset]
+	}
+	// All clients share the fiat account, so its balance is only counted once.
+	accountValue := cl.fiatBalance + worth
+	if r.startValue == 0 {
+		r.startValue = accountValue
+	}
+	if settings.MaxDrawdown > 0 && r.startValue > 0 {
+		drawdown := (r.startValue - accountValue) / r.startValue
+		if drawdown >= settings.MaxDrawdown {
+			return fmt.Errorf("%w (the account is down %.1f%% since the session started)", ErrMaxDrawdown, drawdown*100)
+		}
+	}
+	if signal != SignalLong || accountValue <= 0 {
+		return nil
+	}
+	if limit := settings.MaxAssetExposure; limit > 0 && costs[cl.asset]+cost > limit*accountValue {
+		return fmt.Errorf("%w (%.1f%% of the account value, the limit is %.1f%%)", ErrAssetExposureLimit,
+			(costs[cl.asset]+cost)/accountValue*100, limit*100)
+	}
+	if limit := settings.MaxPortfolioExposure; limit > 0 && invested+cost > limit*accountValue {
+		return fmt.Errorf("%w (%.1f%% of the account value, the limit is %.1f%%)", ErrPortfolioExposureLimit,
+			(invested+cost)/accountValue*100, limit*100)
+	}
+	return nil
+}
+
+// checkRisk consults the daily loss limit and the session's risk manager before an order is placed
+// and logs the reason for a veto.
+func (bot *Bot) checkRisk(cl *Client, signal SIGNAL, volume, price float64) error {
+	if signal == SignalLong || signal == SignalShort {
+		if err := checkDailyLoss(); err != nil {
+			debugf("Leprechaun will not open a %s position. Reason: %v", cl.name, err)
+			return err
+		}
+	}
+	if bot.risk == nil {
+		return nil
+	}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	err := bot.risk.Check(ledger, cl, signal, volume, price)
+	if err != nil {
+		debugf("The risk manager vetoed the %v signal for %s. Reason: %v", signal, cl.name, err)
+	}
+	return err
+}
@@ -0,0 +1,194 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `scheduler.go` shares the exchange's rate limit fairly between assets. Each asset is traded by its
+*  own goroutine, so every request to the exchange waits for a slot of the shared rate limiter. With
+*  fair scheduling the slots go to the waiting assets in turn, so no asset is left waiting behind the
+*  requests of another, and the reads an asset may make in its turn can be capped at an equal share of
+*  a per-round budget. Orders are never held back by the budget.
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCallBudgetUsed is returned for exchange reads made after an asset has used up its share of the round's budget.
+var ErrCallBudgetUsed = errors.New("the asset has used up its share of the API calls for this round")
+
+// requestInterval is the least time between two requests to the exchange, by all assets together.
+// Luno allows 300 requests a minute.
+const requestInterval = 250 * time.Millisecond
+
+// fairScheduler counts the reads each asset makes in its turn.
+type fairScheduler struct {
+	mu    sync.Mutex
+	calls map[string]int // Reads made by each asset in its turn. Calls made outside an asset's turn are not counted.
+	share int            // Reads each asset may make in its turn. Zero is unlimited.
+}
+
+var scheduler = &fairScheduler{calls: map[string]int{}}
+
+// setClients shares the round's budget between `n` clients.
+func (s *fairScheduler) setClients(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.share = 0
+	if cfg().RoundCallBudget > 0 && n > 0 {
+		s.share = int(cfg().RoundCallBudget) / n
+		if s.share == 0 {
+			s.share = 1
+		}
+	}
+}
+
+// startTurn starts counting the reads of `asset`.
+func (s *fairScheduler) startTurn(asset string) {
+	s.mu.Lock()
+	s.calls[asset] = 0
+	s.mu.Unlock()
+}
+
+// endTurn stops counting the reads of `asset` until its next turn starts.
+func (s *fairScheduler) endTurn(asset string) {
+	s.mu.Lock()
+	delete(s.calls, asset)
+	s.mu.Unlock()
+}
+
+// allow reports whether `asset` may make another read.
+func (s *fairScheduler) allow(asset string) bool {
+	s.mu.Lock()
+	calls, active := s.calls[asset]
+	if s.share == 0 || !active {
+		s.mu.Unlock()
+		return true
+	}
+	if calls >= s.share {
+		s.mu.Unlock()
+		return false
+	}
+	s.calls[asset] = calls + 1
+	usedUp, share := calls+1 == s.share, s.share
+	s.mu.Unlock()
+	if usedUp {
+		debugf("%s has used all %d API calls it is allowed in this round. Its remaining work waits for the next round.",
+			assetNames[asset], share)
+	}
+	return true
+}
+
+// rateWaiter is a request waiting for a slot of the rate limiter.
+type rateWaiter struct {
+	asset string
+	ready chan struct{}
+}
+
+// rateLimiter spaces the requests of all assets `requestInterval` apart.
+type rateLimiter struct {
+	mu      sync.Mutex
+	waiting []*rateWaiter
+	served  map[string]time.Time // Time each asset was last given a slot.
+	running bool                 // Whether slots are being handed out.
+}
+
+var limiter = &rateLimiter{served: map[string]time.Time{}}
+
+// wait blocks until `asset` may send a request, or `c` is done.
+func (l *rateLimiter) wait(c context.Context, asset string) error {
+	w := &rateWaiter{asset: asset, ready: make(chan struct{}, 1)}
+	l.mu.Lock()
+	l.waiting = append(l.waiting, w)
+	if !l.running {
+		l.running = true
+		go l.serve()
+	}
+	l.mu.Unlock()
+	select {
+	case <-w.ready:
+		return nil
+	case <-c.Done():
+		l.mu.Lock()
+		for i, waiter := range l.waiting {
+			if waiter == w {
+				l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+				break
+			}
+		}
+		l.mu.Unlock()
+		return c.Err()
+	}
+}
+
+// serve hands out a slot every `requestInterval` until no request is waiting. With fair scheduling the
+// slot goes to the asset that was served least recently, otherwise to the request that has waited longest.
+func (l *rateLimiter) serve() {
+	for {
+		l.mu.Lock()
+		if len(l.waiting) == 0 {
+			l.running = false
+			l.mu.Unlock()
+			return
+		}
+		next := 0
+		if cfg().FairScheduling {
+			for i, w := range l.waiting {
+				if l.served[w.asset].Before(l.served[l.waiting[next].asset]) {
+					next = i
+				}
+			}
+		}
+		w := l.waiting[next]
+		l.waiting = append(l.waiting[:next], l.waiting[next+1:]...)
+		l.served[w.asset] = time.Now()
+		l.mu.Unlock()
+		w.ready <- struct{}{}
+		time.Sleep(requestInterval)
+	}
+}
+
+// limitTransport waits for a slot of the shared rate limiter before each request.
+type limitTransport struct {
+	asset string
+	next  http.RoundTripper
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := limiter.wait(req.Context(), t.asset); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// budgetTransport refuses the reads of an asset that has used up its share of the round's budget.
+// Requests other than GETs place or cancel orders and are always sent.
+type budgetTransport struct {
+	asset string
+	next  http.RoundTripper
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet && !scheduler.allow(t.asset) {
+		return nil, fmt.Errorf("%w (%s)", ErrCallBudgetUsed, t.asset)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// newScheduledClient returns the HTTP client used by the exchange client of `asset`. In paper trading
+// mode its requests are answered by the paper exchange.
+func newScheduledClient(asset string) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if cfg().Paper.Enabled {
+		transport = &paperTransport{live: http.DefaultTransport}
+	}
+	transport = &limitTransport{asset: asset, next: transport}
+	transport = &retryTransport{next: transport}
+	transport = &failureTransport{asset: asset, next: transport}
+	transport = &budgetTransport{asset: asset, next: transport}
+	return &http.Client{Transport: &drainTransport{next: transport}, Timeout: 30 * time.Second}
+}
@@ -0,0 +1,280 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `script.go` holds the "script" analysis plugin. It runs strategies written by the user in Starlark,
+*  a small dialect of Python, from the strategies folder in the data directory, so new strategies can
+*  be tried without rebuilding Leprechaun. A script defines an `emit` function that returns "long",
+*  "short" or "wait", optionally with its confidence in the signal:
+*
+*      def emit():
+*          if price < bollinger(20, 2).lower and trend() == "bullish":
+*              return "long", 0.8
+*          return "wait"
+*
+*  The script is given the asset, the trading mode, the current price, the closing prices and the
+*  candles, and a few indicators computed by Leprechaun. Scripts are read again for every analysis,
+*  so changes take effect in the next trading round.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/michaellormann/leprechaun/indicators"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// ScriptPlugin is the name the scripted strategy plugin is registered under.
+const ScriptPlugin = "script"
+
+// DefaultScript is the script used for assets that do not have a script of their own.
+const DefaultScript = "strategy.star"
+
+var (
+	// ErrNoScript is returned when there is no strategy script for an asset.
+	ErrNoScript = errors.New("there is no strategy script for the asset")
+	// ErrScriptResult is returned when a strategy script returns something other than a signal.
+	ErrScriptResult = errors.New("the strategy script did not return a signal")
+)
+
+// scriptDir returns the folder strategy scripts are read from.
+func scriptDir() string {
+	return filepath.Join(cfg().DataDir, "strategies")
+}
+
+// scriptFile returns the path of the strategy script for `asset`. An asset's own script, e.g. XBT.star,
+// is preferred to `DefaultScript`.
+func scriptFile(asset string) (string, error) {
+	names := []string{DefaultScript}
+	if asset != "" {
+		names = append([]string{asset + ".star"}, names...)
+	}
+	for _, name := range names {
+		path := filepath.Join(scriptDir(), name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w (%s has no %s.star or %s)", ErrNoScript, scriptDir(), asset, DefaultScript)
+}
+
+// Script is an analysis plugin that runs a strategy script written by the user.
+type Script struct {
+	options      *AnalysisOptions
+	prices       []float64
+	candles      []OHLC
+	currentPrice float64
+}
+
+// Description gives a brief summary of what the plugin does and how.
+func (plugin *Script) Description() string {
+	return `"Script runs your own strategy, written in Starlark (a small dialect of Python), from the strategies folder
+	in the data directory. The script is given the prices, candles and a few indicators of the asset and returns long,
+	short or wait. Each asset may have a script of its own. Changes take effect in the next trading round."`
+}
+
+// SetOptions ...
+func (plugin *Script) SetOptions(opts *AnalysisOptions) error {
+	plugin.options = opts
+	return nil
+}
+
+// SetClosingPrices ...
+func (plugin *Script) SetClosingPrices(prices []float64) error {
+	plugin.prices = prices
+	return nil
+}
+
+// SetCurrentPrice ...
+func (plugin *Script) SetCurrentPrice(price float64) error {
+	plugin.currentPrice = price
+	return nil
+}
+
+// SetOHLC ...
+func (plugin *Script) SetOHLC(candles []OHLC) error {
+	plugin.candles = candles
+	return nil
+}
+
+// Emit runs the strategy script of the asset and returns its signal.
+func (plugin *Script) Emit() (signal SIGNAL, err error) {
+	signal, _, err = plugin.EmitConfidence()
+	return
+}
+
+// EmitConfidence runs the strategy script of the asset and returns its signal and its confidence in it.
+// Scripts that only return a signal are fully confident.
+func (plugin *Script) EmitConfidence() (signal SIGNAL, confidence float64, err error) {
+	asset := ""
+	if plugin.options != nil {
+		asset = plugin.options.Asset
+	}
+	path, err := scriptFile(asset)
+	if err != nil {
+		return SignalWait, 0, err
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return SignalWait, 0, err
+	}
+	thread := &starlark.Thread{
+		Name:  filepath.Base(path),
+		Print: func(_ *starlark.Thread, msg string) { debugf("[%s] %s", filepath.Base(path), msg) },
+	}
+	globals, err := starlark.ExecFile(thread, path, src, plugin.predeclared())
+	if err != nil {
+		return SignalWait, 0, err
+	}
+	emit, ok := globals["emit"]
+	if !ok {
+		return SignalWait, 0, fmt.Errorf("%s does not define an emit function", filepath.Base(path))
+	}
+	result, err := starlark.Call(thread, emit, nil, nil)
+	if err != nil {
+		return SignalWait, 0, err
+	}
+	return scriptSignal(result)
+}
+
+// scriptSignal converts the value returned by a script's `emit` function to a signal and its confidence.
+func scriptSignal(result starlark.Value) (signal SIGNAL, confidence float64, err error) {
+	confidence = 1
+	if tuple, ok := result.(starlark.Tuple); ok {
+		if len(tuple) != 2 {
+			return SignalWait, 0, fmt.Errorf("%w (%s)", ErrScriptResult, result)
+		}
+		if confidence, ok = starlark.AsFloat(tuple[1]); !ok {
+			return SignalWait, 0, fmt.Errorf("%w (the confidence %s is not a number)", ErrScriptResult, tuple[1])
+		}
+		result = tuple[0]
+	}
+	if result == starlark.None {
+		return SignalWait, confidence, nil
+	}
+	name, ok := starlark.AsString(result)
+	if !ok {
+		return SignalWait, 0, fmt.Errorf("%w (%s)", ErrScriptResult, result)
+	}
+	switch strings.ToLower(name) {
+	case "long", "buy":
+		return SignalLong, confidence, nil
+	case "short", "sell":
+		return SignalShort, confidence, nil
+	case "wait", "":
+		return SignalWait, confidence, nil
+	}
+	return SignalWait, 0, fmt.Errorf("%w (unknown signal %q)", ErrScriptResult, name)
+}
+
+// predeclared returns the values and functions available to a strategy script.
+func (plugin *Script) predeclared() starlark.StringDict {
+	asset, mode := "", "contrarian"
+	if plugin.options != nil {
+		asset = plugin.options.Asset
+		if plugin.options.Mode == TrendFollowing {
+			mode = "trend"
+		}
+	}
+	prices := make([]starlark.Value, len(plugin.prices))
+	for i, price := range plugin.prices {
+		prices[i] = starlark.Float(price)
+	}
+	candles := make([]starlark.Value, len(plugin.candles))
+	for i, candle := range plugin.candles {
+		candles[i] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"open":   starlark.Float(candle.Open),
+			"high":   starlark.Float(candle.High),
+			"low":    starlark.Float(candle.Low),
+			"close":  starlark.Float(candle.Close),
+			"volume": starlark.Float(candle.TotalVolume),
+		})
+	}
+	return starlark.StringDict{
+		"asset":     starlark.String(asset),
+		"mode":      starlark.String(mode),
+		"price":     starlark.Float(plugin.currentPrice),
+		"prices":    starlark.NewList(prices),
+		"candles":   starlark.NewList(candles),
+		"sma":       starlark.NewBuiltin("sma", plugin.scriptSMA),
+		"bollinger": starlark.NewBuiltin("bollinger", plugin.scriptBollinger),
+		"vwap":      starlark.NewBuiltin("vwap", plugin.scriptVWAP),
+		"atr":       starlark.NewBuiltin("atr", plugin.scriptATR),
+		"trend":     starlark.NewBuiltin("trend", plugin.scriptTrend),
+	}
+}
+
+// scriptSMA returns the simple moving average of the latest `window` closing prices: sma(window).
+func (plugin *Script) scriptSMA(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var window int
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &window); err != nil {
+		return nil, err
+	}
+	sma, err := indicators.SMA(plugin.prices, window)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.Float(sma), nil
+}
+
+// scriptBollinger returns the Bollinger Bands of the closing prices: bollinger(window, deviations).
+func (plugin *Script) scriptBollinger(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		window     int
+		deviations float64
+	)
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &window, &deviations); err != nil {
+		return nil, err
+	}
+	bands, err := BB(plugin.prices, window, deviations)
+	if err != nil {
+		return nil, err
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"lower":  starlark.Float(bands.Lower),
+		"middle": starlark.Float(bands.Middle),
+		"upper":  starlark.Float(bands.Upper),
+	}), nil
+}
+
+// scriptVWAP returns the volume weighted average price of the candles: vwap().
+func (plugin *Script) scriptVWAP(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	vwap, err := VWAP(plugin.candles)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.Float(vwap), nil
+}
+
+// scriptATR returns the average true range of the candles: atr(period).
+func (plugin *Script) scriptATR(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var period int
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &period); err != nil {
+		return nil, err
+	}
+	return starlark.Float(averageTrueRange(plugin.candles, period)), nil
+}
+
+// scriptTrend returns the trend of the candles, "bullish", "bearish" or "indifferent": trend().
+func (plugin *Script) scriptTrend(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	trend := CandleChart{}.DetectTrend(plugin.candles)
+	switch {
+	case trend.IsBullish():
+		return starlark.String("bullish"), nil
+	case trend.IsBearish():
+		return starlark.String("bearish"), nil
+	}
+	return starlark.String("indifferent"), nil
+}
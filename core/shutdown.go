@@ -0,0 +1,89 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `shutdown.go` lets Leprechaun exit without cutting off an order or a write to the ledger. Requests to
+*  the exchange and ledger transactions are counted while they run. When the app exits the trading loop
+*  is told to stop, and `Shutdown` waits, up to a timeout, for the loop to return and the running
+*  operations to finish before it closes the ledger's database. The app closes its log files after it.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long Leprechaun waits for running operations to finish when it exits.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ErrShutdownTimeout is returned by `Shutdown` when operations were still running after its timeout.
+var ErrShutdownTimeout = errors.New("leprechaun exited before every running operation had finished")
+
+var (
+	// inflight is the number of exchange requests and ledger transactions that are running.
+	inflight int32
+	// stopping is set once the user has stopped the bot, so every goroutine of the trading loop sees it.
+	stopping int32
+)
+
+// beginOperation counts an operation that must finish before Leprechaun exits. The returned func ends it.
+func beginOperation() (end func()) {
+	atomic.AddInt32(&inflight, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { atomic.AddInt32(&inflight, -1) })
+	}
+}
+
+// requestStop tells the trading loop to stop.
+func requestStop() {
+	atomic.StoreInt32(&stopping, 1)
+}
+
+// clearStop lets a new trading session run after the last one was stopped.
+func clearStop() {
+	atomic.StoreInt32(&stopping, 0)
+}
+
+// stopRequested reports whether the trading loop has been told to stop.
+func stopRequested() bool {
+	return atomic.LoadInt32(&stopping) == 1
+}
+
+// Shutdown stops the trading loop and waits up to `timeout` for it to return and for the exchange
+// requests and ledger transactions that are running to finish. Then it closes the ledger. It returns
+// ErrShutdownTimeout if operations were still running when the timeout passed.
+func Shutdown(timeout time.Duration) (err error) {
+	requestStop()
+	deadline := time.Now().Add(timeout)
+	for {
+		healthMu.Lock()
+		running := loopRunning
+		healthMu.Unlock()
+		active := atomic.LoadInt32(&inflight)
+		if !running && active == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("%w (%d operation(s) running)", ErrShutdownTimeout, active)
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	closeLedgers()
+	return err
+}
+
+// drainTransport counts each request to the exchange, with its retries, until its response is returned.
+type drainTransport struct {
+	next http.RoundTripper
+}
+
+func (t *drainTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	defer beginOperation()()
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,107 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `sizing.go` scales the size of new positions with the analyzer's recent accuracy for an asset.
+*  Every long or short signal is checked against the price in the next round. Entries grow after
+*  consecutive confirmed signals and shrink after consecutive wrong ones, within set bounds and the
+*  exposure allowed for the asset.
+ */
+
+import (
+	"math"
+	"sync"
+)
+
+// StreakSizingSettings configures the scaling of position sizes by signal accuracy.
+type StreakSizingSettings struct {
+	Enabled bool
+	// Step is how much the size of an entry changes, as a fraction of a regular entry, for each
+	// consecutive confirmed (or wrong) signal.
+	Step float64
+	// MinMultiplier and MaxMultiplier bound the size of an entry as a multiple of a regular entry.
+	MinMultiplier float64
+	MaxMultiplier float64
+}
+
+// signalOutcome holds the last long or short signal emitted for an asset and the analyzer's accuracy streak.
+type signalOutcome struct {
+	signal SIGNAL
+	price  float64 // Price of the asset when the signal was emitted.
+	// accuracy counts consecutive confirmed signals when positive and consecutive wrong signals when negative.
+	accuracy int
+}
+
+var (
+	signalOutcomes   = map[string]signalOutcome{}
+	signalOutcomesMu sync.Mutex
+)
+
+// recordOutcome checks the last long or short signal for an asset against the current price, notes
+// the signal emitted in this round and returns the analyzer's accuracy streak for the asset.
+// A long signal is confirmed if the price has risen since and a short signal if it has fallen.
+func recordOutcome(asset string, signal SIGNAL, price float64) int {
+	signalOutcomesMu.Lock()
+	defer signalOutcomesMu.Unlock()
+	outcome := signalOutcomes[asset]
+	if outcome.price > 0 && price != outcome.price {
+		confirmed := (outcome.signal == SignalLong) == (price > outcome.price)
+		recordStrategyOutcome(confirmed)
+		switch {
+		case confirmed && outcome.accuracy >= 0:
+			outcome.accuracy++
+		case confirmed:
+			outcome.accuracy = 1
+		case outcome.accuracy <= 0:
+			outcome.accuracy--
+		default:
+			outcome.accuracy = -1
+		}
+	}
+	outcome.signal, outcome.price = signal, 0
+	if signal == SignalLong || signal == SignalShort {
+		outcome.price = price
+	}
+	signalOutcomes[asset] = outcome
+	return outcome.accuracy
+}
+
+// streakMultiplier returns the size of an entry as a multiple of a regular entry for an accuracy streak.
+func streakMultiplier(accuracy int) float64 {
+	settings := cfg().Trade.StreakSizing
+	multiplier := 1 + settings.Step*float64(accuracy)
+	return math.Min(math.Max(multiplier, settings.MinMultiplier), settings.MaxMultiplier)
+}
+
+// canScaleUp reports whether the balance and the exposure limit for the client's asset allow an entry of `volume`.
+func (bot *Bot) canScaleUp(cl *Client, signal SIGNAL, volume, price float64) bool {
+	if signal == SignalShort {
+		return cl.assetBalance-cl.lockedVolume >= volume
+	}
+	return cl.fiatBalance-cl.lockedBalance >= volume*price && bot.checkExposure(cl, volume*price) == nil
+}
+
+// streakVolume scales the volume of a new entry by the analyzer's accuracy streak for the client's asset.
+// Larger entries are only placed if the balance and the exposure limit for the asset allow it.
+func (bot *Bot) streakVolume(cl *Client, signal SIGNAL, volume, price float64, accuracy int) float64 {
+	if !cfg().Trade.StreakSizing.Enabled || (signal != SignalLong && signal != SignalShort) {
+		return volume
+	}
+	multiplier := streakMultiplier(accuracy)
+	scaled := volume * multiplier
+	if cl.asset == "XRP" {
+		scaled = math.Floor(scaled)
+	}
+	if scaled < cl.minOrderVol {
+		scaled = cl.minOrderVol
+	}
+	if scaled > volume && !bot.canScaleUp(cl, signal, scaled, price) {
+		debugf("Leprechaun will not increase the size of the %s entry. It would exceed your balance or the exposure limit.", cl.name)
+		return volume
+	}
+	if scaled != volume {
+		debugf("The analyzer's accuracy streak for %s is %d. The entry is scaled to %.0f%% of its regular size.",
+			cl.name, accuracy, scaled/volume*100)
+	}
+	return scaled
+}
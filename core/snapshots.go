@@ -0,0 +1,189 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `snapshots.go` saves the realized and unrealized profit of the bot at a regular interval
+*  so the profit can be charted between trades. The equity of the account is saved to the ledger
+*  at the same time.
+ */
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// snapshotsFile is the name of the file snapshots are saved to in the data folder.
+	snapshotsFile = "snapshots.json"
+	// maxSnapshots is the number of snapshots kept on file. At the default interval
+	// of 15 minutes this is about 90 days.
+	maxSnapshots = 8640
+	// snapshotMu guards the snapshots file.
+	snapshotMu sync.Mutex
+)
+
+// ProfitSnapshot holds the profit of the bot at a point in time.
+type ProfitSnapshot struct {
+	Time       time.Time
+	Realized   float64            // All time profit of closed trades.
+	Unrealized float64            // Profit of open positions if they were closed at the current price.
+	Total      float64            // Realized + Unrealized.
+	Assets     map[string]float64 // Unrealized profit of each asset.
+	// Positions is the value of the open positions at the current price. See `EquityPoint`.
+	Positions float64
+}
+
+// Snapshotter takes profit snapshots at the start of each interval, e.g. at :00, :15, :30
+// and :45 for an interval of 15 minutes.
+type Snapshotter struct {
+	interval time.Duration
+	clients  []*Client
+	stop     chan struct{}
+}
+
+// NewSnapshotter creates a snapshotter for the assets of `clients`.
+func NewSnapshotter(interval time.Duration, clients []*Client) *Snapshotter {
+	return &Snapshotter{interval: interval, clients: clients, stop: make(chan struct{})}
+}
+
+// Run starts taking snapshots until Stop is called.
+func (s *Snapshotter) Run() {
+	if s.interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			next := time.Now().Truncate(s.interval).Add(s.interval)
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+				snap, err := s.Take()
+				if err != nil {
+					debugf("Could not take profit snapshot. Reason: %v", err)
+					continue
+				}
+				if err = saveSnapshot(snap); err != nil {
+					debugf("Could not save profit snapshot. Reason: %v", err)
+				}
+				if err = s.recordEquity(snap); err != nil {
+					debugf("Could not save the equity of your account. Reason: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops taking snapshots.
+func (s *Snapshotter) Stop() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+// Take returns a snapshot of the current profit.
+func (s *Snapshotter) Take() (snap ProfitSnapshot, err error) {
+	snap.Time = time.Now().Truncate(time.Second)
+	snap.Assets = map[string]float64{}
+	ledger := bot.Ledger()
+	defer ledger.Save()
+	for _, cl := range s.clients {
+		snap.Realized += realizedProfit(cl.asset)
+		price, err := cl.CurrentPrice()
+		if err != nil {
+			return snap, err
+		}
+		unrealized := 0.0
+		for _, orderType := range []OrderType{LongOrder, ShortOrder} {
+			records, err := ledger.GetRecordsByType(cl.asset, orderType)
+			if err != nil {
+				continue
+			}
+			for _, rec := range records {
+				unrealized += unrealizedProfit(rec, price)
+				snap.Positions += marketValue(rec, price)
+			}
+		}
+		snap.Assets[cl.asset] = unrealized
+		snap.Unrealized += unrealized
+	}
+	snap.Total = snap.Realized + snap.Unrealized
+	return
+}
+
+// unrealizedProfit returns the profit of an open record if it were closed at `price`.
+func unrealizedProfit(rec Record, price float64) float64 {
+	if rec.Type == ShortOrder {
+		return (rec.Price - price) * rec.Volume
+	}
+	return (price - rec.Price) * rec.Volume
+}
+
+// realizedProfit returns the all time profit of an asset.
+func realizedProfit(asset string) float64 {
+	totals, err := assetTotals(asset)
+	if err != nil {
+		return 0
+	}
+	return totals.Profit
+}
+
+// saveSnapshot adds a snapshot to file. Only the latest `maxSnapshots` snapshots are kept.
+func saveSnapshot(snap ProfitSnapshot) error {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	snapshots, err := loadSnapshots()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	snapshots = append(snapshots, snap)
+	if len(snapshots) > maxSnapshots {
+		snapshots = snapshots[len(snapshots)-maxSnapshots:]
+	}
+	if !exists(dataDir()) {
+		os.MkdirAll(dataDir(), 0755)
+	}
+	f, err := os.OpenFile(filepath.Join(dataDir(), snapshotsFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(snapshots)
+}
+
+func loadSnapshots() (snapshots []ProfitSnapshot, err error) {
+	f, err := os.Open(filepath.Join(dataDir(), snapshotsFile))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	err = json.NewDecoder(f).Decode(&snapshots)
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// GetSnapshots returns the profit snapshots taken since `since`, oldest first.
+func GetSnapshots(since time.Time) (snapshots []ProfitSnapshot, err error) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	all, err := loadSnapshots()
+	if err != nil {
+		return
+	}
+	for _, snap := range all {
+		if !snap.Time.Before(since) {
+			snapshots = append(snapshots, snap)
+		}
+	}
+	return
+}
@@ -0,0 +1,29 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `stoploss.go` closes short trades at a loss when the price moves too far against them.
+ */
+
+// StopLossPrice returns the price at which a short sold record is repurchased at a loss,
+// i.e. `config.Trade.ShortTrade.StopLossPercentage` above the price it was sold at.
+// It returns zero if the stop-loss for short trades is disabled.
+func (rec Record) StopLossPrice() float64 {
+	settings := cfg().Trade.ShortTrade
+	if rec.Type != ShortOrder || !settings.StopLoss || settings.StopLossPercentage <= 0 {
+		return 0
+	}
+	return rec.Price * (1 + settings.StopLossPercentage)
+}
+
+// stopLosses separates the short sold records whose stop-loss price has been reached at `price` from the rest.
+func stopLosses(records []Record, price float64) (stopped, open []Record) {
+	for _, rec := range records {
+		if stop := rec.StopLossPrice(); stop > 0 && price >= stop {
+			stopped = append(stopped, rec)
+			continue
+		}
+		open = append(open, rec)
+	}
+	return
+}
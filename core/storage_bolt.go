@@ -0,0 +1,429 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `storage_bolt.go` keeps the ledger in a bbolt file. bbolt is written in Go, so builds without cgo, such
+*  as the Android app, can keep a ledger without the SQLite driver. Each table of the SQL ledger is a
+*  bucket whose values are JSON, keyed by the order they were added in. The open records of a ledger are
+*  few, so they are looked up by scanning their bucket. The file is kept next to where the SQLite ledger
+*  would be, with the `.bolt` extension.
+ */
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of a bbolt ledger.
+var (
+	boltRecords = []byte("records")
+	boltClosed  = []byte("closed")
+	boltArchive = []byte("archive")
+	boltProfits = []byte("profits")
+	boltEquity  = []byte("equity")
+)
+
+// boltArchived is an archived record as it is saved in a bbolt ledger.
+type boltArchived struct {
+	Record
+	ArchivedAt string
+	Reason     string
+}
+
+// boltProfit is a profit entry as it is saved in a bbolt ledger.
+type boltProfit struct {
+	Kind      string
+	Simulated bool
+	Entry     ProfitEntry
+}
+
+// boltEquityPoint is a point of the equity curve as it is saved in a bbolt ledger.
+type boltEquityPoint struct {
+	Time      int64
+	Fiat      float64
+	Positions float64
+	Simulated bool
+}
+
+// boltStorage keeps the ledger in a bbolt file.
+type boltStorage struct {
+	db *bolt.DB
+}
+
+// openBoltStorage opens the bbolt ledger at `path`, creating it if it does not exist.
+func openBoltStorage(path, _ string) (Storage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// The timeout keeps a second Leprechaun from waiting for good for the lock on the file.
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltRecords, boltClosed, boltArchive, boltProfits, boltEquity} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not initialize the ledger: %w", err)
+	}
+	return &boltStorage{db: db}, nil
+}
+
+// copyTo writes a consistent copy of the ledger to `dest`, e.g. for a backup.
+func (s *boltStorage) copyTo(dest string) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(dest, 0644)
+	})
+}
+
+// view runs `read` in a read-only transaction, unless `c` is done.
+func (s *boltStorage) view(c context.Context, read func(tx *bolt.Tx) error) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return s.db.View(read)
+}
+
+// update runs `write` in a read-write transaction, unless `c` is done. bbolt lets one transaction write
+// at a time, so writes take turns.
+func (s *boltStorage) update(c context.Context, write func(tx *bolt.Tx) error) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return s.db.Update(write)
+}
+
+// put adds `value` to `bucket` under the next key, so the values of a bucket are kept in the order they were added.
+func put(bucket *bolt.Bucket, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return bucket.Put(key, data)
+}
+
+// eachRecord calls `fn` with the key of each open record and the record, until it returns an error.
+func eachRecord(tx *bolt.Tx, fn func(key []byte, rec Record) error) error {
+	return tx.Bucket(boltRecords).ForEach(func(key, data []byte) error {
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		return fn(key, rec)
+	})
+}
+
+// recordKeys returns the keys of the open records with the ID `id`.
+func recordKeys(tx *bolt.Tx, id string) (keys [][]byte, err error) {
+	err = eachRecord(tx, func(key []byte, rec Record) error {
+		if rec.ID == id {
+			keys = append(keys, append([]byte{}, key...))
+		}
+		return nil
+	})
+	return
+}
+
+func (s *boltStorage) AddRecord(c context.Context, rec Record) error {
+	return s.update(c, func(tx *bolt.Tx) error {
+		return put(tx.Bucket(boltRecords), rec)
+	})
+}
+
+func (s *boltStorage) Record(c context.Context, id string) (rec Record, err error) {
+	err = s.view(c, func(tx *bolt.Tx) error {
+		found := false
+		err := eachRecord(tx, func(_ []byte, r Record) error {
+			if !found && r.ID == id {
+				rec, found = r, true
+			}
+			return nil
+		})
+		if err == nil && !found {
+			err = sql.ErrNoRows
+		}
+		return err
+	})
+	return
+}
+
+func (s *boltStorage) Records(c context.Context, filter RecordFilter) (records []Record, err error) {
+	err = s.view(c, func(tx *bolt.Tx) error {
+		return eachRecord(tx, func(_ []byte, rec Record) error {
+			if (filter.Asset == "" || rec.Asset == filter.Asset) && (filter.Type == "" || rec.Type == filter.Type) &&
+				(filter.ParentID == "" || rec.ParentID == filter.ParentID) {
+				records = append(records, rec)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (s *boltStorage) DeleteRecord(c context.Context, id string) error {
+	return s.update(c, func(tx *bolt.Tx) error {
+		keys, err := recordKeys(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = tx.Bucket(boltRecords).Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// changeRecords calls `change` on each open record with the ID `id` and saves the changed record.
+func (s *boltStorage) changeRecords(c context.Context, id string, change func(rec *Record)) error {
+	return s.update(c, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltRecords)
+		keys, err := recordKeys(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			var rec Record
+			if err = json.Unmarshal(bucket.Get(key), &rec); err != nil {
+				return err
+			}
+			change(&rec)
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err = bucket.Put(key, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStorage) UpdateVolume(c context.Context, id string, volume, cost float64) error {
+	return s.changeRecords(c, id, func(rec *Record) {
+		rec.Volume, rec.Cost = volume, cost
+	})
+}
+
+func (s *boltStorage) UpdatePosition(c context.Context, update Record) error {
+	return s.changeRecords(c, update.ID, func(rec *Record) {
+		rec.Price, rec.Volume, rec.Cost, rec.TriggerPrice = update.Price, update.Volume, update.Cost, update.TriggerPrice
+		rec.RequestedVolume, rec.LunoAssetFee, rec.LunoFiatFee = update.RequestedVolume, update.LunoAssetFee, update.LunoFiatFee
+	})
+}
+
+// moveRecord moves each open record with the ID `id` to `bucket`, as the value returned by `moved`, in one transaction.
+func (s *boltStorage) moveRecord(c context.Context, bucket []byte, id string, moved func(rec Record) interface{}) error {
+	return s.update(c, func(tx *bolt.Tx) error {
+		records := tx.Bucket(boltRecords)
+		keys, err := recordKeys(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			var rec Record
+			if err = json.Unmarshal(records.Get(key), &rec); err != nil {
+				return err
+			}
+			if err = put(tx.Bucket(bucket), moved(rec)); err != nil {
+				return err
+			}
+			if err = records.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStorage) CloseRecord(c context.Context, closed ClosedRecord) error {
+	return s.moveRecord(c, boltClosed, closed.ID, func(rec Record) interface{} {
+		moved := closed
+		moved.Record = rec
+		return moved
+	})
+}
+
+func (s *boltStorage) ClosedRecords(c context.Context, asset string) (records []ClosedRecord, err error) {
+	err = s.view(c, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltClosed).ForEach(func(_, data []byte) error {
+			var closed ClosedRecord
+			if err := json.Unmarshal(data, &closed); err != nil {
+				return err
+			}
+			if asset == "" || closed.Asset == asset {
+				records = append(records, closed)
+			}
+			return nil
+		})
+	})
+	// The SQL ledger returns them in the same order.
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].ClosedAt != records[j].ClosedAt {
+			return records[i].ClosedAt < records[j].ClosedAt
+		}
+		return records[i].ID < records[j].ID
+	})
+	return
+}
+
+func (s *boltStorage) ReopenRecord(c context.Context, orderID string) (closed ClosedRecord, err error) {
+	err = s.update(c, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltClosed)
+		var key []byte
+		err := bucket.ForEach(func(k, data []byte) error {
+			if key != nil {
+				return nil
+			}
+			var rec ClosedRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			if rec.CloseOrderID == orderID {
+				closed, key = rec, append([]byte{}, k...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			return sql.ErrNoRows
+		}
+		if err = put(tx.Bucket(boltRecords), closed.Record); err != nil {
+			return err
+		}
+		return bucket.Delete(key)
+	})
+	return
+}
+
+func (s *boltStorage) ArchiveRecord(c context.Context, id, archivedAt, reason string) error {
+	return s.moveRecord(c, boltArchive, id, func(rec Record) interface{} {
+		return boltArchived{Record: rec, ArchivedAt: archivedAt, Reason: reason}
+	})
+}
+
+func (s *boltStorage) AddProfit(c context.Context, kind string, entry ProfitEntry, simulated bool) error {
+	return s.update(c, func(tx *bolt.Tx) error {
+		return put(tx.Bucket(boltProfits), boltProfit{Kind: kind, Simulated: simulated, Entry: entry})
+	})
+}
+
+func (s *boltStorage) DeleteProfit(c context.Context, orderID string) error {
+	return s.update(c, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltProfits)
+		var keys [][]byte
+		err := bucket.ForEach(func(key, data []byte) error {
+			var profit boltProfit
+			if err := json.Unmarshal(data, &profit); err != nil {
+				return err
+			}
+			if profit.Entry.OrderID == orderID {
+				keys = append(keys, append([]byte{}, key...))
+			}
+			return nil
+		})
+		for _, key := range keys {
+			if err == nil {
+				err = bucket.Delete(key)
+			}
+		}
+		return err
+	})
+}
+
+// eachProfit calls `fn` with each profit entry, from the earliest, until it returns an error.
+func (s *boltStorage) eachProfit(c context.Context, fn func(profit boltProfit)) error {
+	return s.view(c, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltProfits).ForEach(func(_, data []byte) error {
+			var profit boltProfit
+			if err := json.Unmarshal(data, &profit); err != nil {
+				return err
+			}
+			fn(profit)
+			return nil
+		})
+	})
+}
+
+func (s *boltStorage) Profits(c context.Context, kind string, simulated bool) (entries []*ProfitEntry, err error) {
+	err = s.eachProfit(c, func(profit boltProfit) {
+		if profit.Kind == kind && profit.Simulated == simulated {
+			entry := profit.Entry
+			entry.NetProfit = entry.Profit - entry.Fees
+			entries = append(entries, &entry)
+		}
+	})
+	return
+}
+
+func (s *boltStorage) ProfitTotals(c context.Context, asset string) (totals ProfitEntry, err error) {
+	totals.Asset = asset
+	err = s.eachProfit(c, func(profit boltProfit) {
+		entry := profit.Entry
+		if profit.Simulated || entry.Asset != asset {
+			return
+		}
+		totals.PurchaseVolume += entry.PurchaseVolume
+		totals.PurchaseCost += entry.PurchaseCost
+		totals.SaleVolume += entry.SaleVolume
+		totals.SaleCost += entry.SaleCost
+		totals.Profit += entry.Profit
+		totals.Tranches += entry.Tranches
+		totals.Fees += entry.Fees
+	})
+	totals.NetProfit = totals.Profit - totals.Fees
+	return
+}
+
+func (s *boltStorage) AddEquity(c context.Context, point EquityPoint, simulated bool) error {
+	return s.update(c, func(tx *bolt.Tx) error {
+		return put(tx.Bucket(boltEquity), boltEquityPoint{Time: point.Time.Unix(), Fiat: point.Fiat,
+			Positions: point.Positions, Simulated: simulated})
+	})
+}
+
+func (s *boltStorage) EquityCurve(c context.Context, since time.Time, simulated bool) (points []EquityPoint, err error) {
+	err = s.view(c, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltEquity).ForEach(func(_, data []byte) error {
+			var point boltEquityPoint
+			if err := json.Unmarshal(data, &point); err != nil {
+				return err
+			}
+			if point.Simulated == simulated && point.Time >= since.Unix() {
+				points = append(points, EquityPoint{Time: time.Unix(point.Time, 0), Fiat: point.Fiat, Positions: point.Positions})
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return
+}
+
+func (s *boltStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,408 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `storage_sql.go` keeps the ledger in an SQL database, either an SQLite file or a PostgreSQL server. Both
+*  have the same tables, and the statements are written for SQLite. They are rewritten for PostgreSQL,
+*  which numbers its placeholders, stores REAL columns in single precision and counts IDs with serials.
+*  SQLite ledgers are opened in WAL mode, so reads do not wait for writes, and writes wait for each
+*  other instead of failing while the database is locked. A write that still finds the database busy,
+*  e.g. because another program has it open, is tried again a few times before it fails.
+ */
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	// The PostgreSQL driver registers itself as "postgres".
+	_ "github.com/lib/pq"
+)
+
+// sqlDialect describes how an SQL database differs from SQLite.
+type sqlDialect struct {
+	// numbered is true if placeholders are numbered, e.g. $1, instead of ?.
+	numbered bool
+	// boolInts is true if booleans must be passed to integer columns as 0 or 1.
+	boolInts bool
+	// ddl rewrites a statement that creates a table or an index.
+	ddl *strings.Replacer
+}
+
+var (
+	sqliteDialect   = sqlDialect{ddl: strings.NewReplacer()}
+	postgresDialect = sqlDialect{numbered: true, boolInts: true, ddl: strings.NewReplacer(
+		" REAL ", " DOUBLE PRECISION ",
+		"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+		"CREATE TABLE PROFITS", "CREATE TABLE IF NOT EXISTS PROFITS",
+		"CREATE INDEX PROFITS", "CREATE INDEX IF NOT EXISTS PROFITS",
+		"ADD COLUMN", "ADD COLUMN IF NOT EXISTS",
+	)}
+)
+
+// rebind rewrites the placeholders of `query` for the database.
+func (d sqlDialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// args converts the arguments of a statement to the types the database accepts.
+func (d sqlDialect) args(args []interface{}) []interface{} {
+	if !d.boolInts {
+		return args
+	}
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		converted[i] = arg
+		if b, ok := arg.(bool); ok {
+			converted[i] = 0
+			if b {
+				converted[i] = 1
+			}
+		}
+	}
+	return converted
+}
+
+// ledgerTables lists the statements that create the tables and indexes of a ledger, apart from the
+// RECORDS table, which older SQLite ledgers may have to be upgraded to first, and the PROFITS table.
+func ledgerTables() []string {
+	return append(append([]string{}, ledgerIndexes...), closedInit, closedIndex, archiveInit, equityInit, equityIndex)
+}
+
+// sqliteOptions opens SQLite ledgers in WAL mode, and makes a write wait up to five seconds for a lock.
+const sqliteOptions = "?_journal_mode=WAL&_busy_timeout=5000"
+
+// writeRetryPolicy tries a write that finds the database busy up to four times.
+var writeRetryPolicy = RetryPolicy{InitialDelay: 250 * time.Millisecond, MaxDelay: 2 * time.Second, Multiplier: 2,
+	Jitter: 0.2, MaxAttempts: 4, Retryable: busy}
+
+// busyMessage reports whether the message of `err` says the database is locked, as SQLite's does.
+func busyMessage(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked") ||
+		strings.Contains(msg, "SQLITE_BUSY") || strings.Contains(msg, "SQLITE_LOCKED")
+}
+
+// retryWrite runs `write`, trying it again after a longer wait each time it finds the database busy,
+// until `writeRetryPolicy` gives up or `c` is done.
+func retryWrite(c context.Context, write func() error) error {
+	return retry(c, writeRetryPolicy, write)
+}
+
+// sqlStorage keeps the ledger in an SQL database.
+type sqlStorage struct {
+	db      *sql.DB
+	dialect sqlDialect
+	// writeMu makes the writes of the ledger take turns, as SQLite allows one writer at a time.
+	writeMu sync.Mutex
+}
+
+// openSQLiteStorage opens the SQLite ledger at `path`, creating it if it does not exist, and upgrades
+// ledgers created by older versions.
+func openSQLiteStorage(path, _ string) (Storage, error) {
+	if !sqliteAvailable {
+		return nil, fmt.Errorf("%w (%q)", ErrStorageUnavailable, SQLiteStorage)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	alreadyExists := exists(path)
+	db, err := sql.Open("sqlite3", path+sqliteOptions)
+	if err != nil {
+		return nil, err
+	}
+	if !alreadyExists {
+		// We are just creating a new ledger
+		if _, err = db.Exec(databaseInit); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("could not initialize the ledger: %w", err)
+		}
+	} else if err = migrateDatabase(db); err != nil {
+		// Upgrade ledgers created by older versions.
+		db.Close()
+		return nil, fmt.Errorf("could not upgrade the ledger: %w", err)
+	}
+	for _, op := range ledgerTables() {
+		if _, err = db.Exec(op); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if err = initProfits(db, path); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not add the profits to the ledger: %w", err)
+	}
+	return &sqlStorage{db: db, dialect: sqliteDialect}, nil
+}
+
+// openPostgresStorage opens the ledger in the PostgreSQL database at `dsn`, creating its tables if they
+// do not exist.
+func openPostgresStorage(_, dsn string) (Storage, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	ops := append([]string{recordsTable("IF NOT EXISTS RECORDS")}, ledgerTables()...)
+	// The driver may not run more than one statement at a time.
+	for _, op := range append(append(ops, strings.Split(profitsInit, ";")...), profitMigrations...) {
+		if _, err = db.Exec(postgresDialect.ddl.Replace(op)); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("could not create the tables of the ledger: %w", err)
+		}
+	}
+	return &sqlStorage{db: db, dialect: postgresDialect}, nil
+}
+
+// exec runs a statement written for SQLite that writes to the ledger.
+func (s *sqlStorage) exec(c context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	err = retryWrite(c, func() (e error) {
+		res, e = s.db.ExecContext(c, s.dialect.rebind(query), s.dialect.args(args)...)
+		return
+	})
+	return
+}
+
+// query runs a query written for SQLite.
+func (s *sqlStorage) query(c context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.QueryContext(c, s.dialect.rebind(query), s.dialect.args(args)...)
+}
+
+// queryRecords returns every record selected by `query`, which must select the columns of `recordSelect`.
+func (s *sqlStorage) queryRecords(c context.Context, query string, args ...interface{}) (records []Record, err error) {
+	rows, err := s.query(c, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rec Record
+		if err = scanRows(rows, &rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+func (s *sqlStorage) AddRecord(c context.Context, rec Record) error {
+	_, err := s.exec(c, recordInsert, rec.Asset, rec.Cost, rec.ID, rec.Price, rec.SaleID, rec.Sold, rec.Status, rec.Timestamp,
+		rec.Volume, rec.Type, rec.TriggerPrice, rec.ParentID, rec.RequestedVolume, rec.ClientRef, rec.LunoAssetFee,
+		rec.LunoFiatFee, encodeAnalysis(rec), rec.Simulated)
+	return err
+}
+
+func (s *sqlStorage) Record(c context.Context, id string) (rec Record, err error) {
+	err = scanRows(s.db.QueryRowContext(c, s.dialect.rebind(idSearch), id), &rec)
+	return
+}
+
+func (s *sqlStorage) Records(c context.Context, filter RecordFilter) ([]Record, error) {
+	conditions, args := []string{}, []interface{}{}
+	for _, f := range []struct{ column, value string }{
+		{"ASSET", filter.Asset}, {"TYPE", string(filter.Type)}, {"PARENT_ID", filter.ParentID},
+	} {
+		if f.value != "" {
+			conditions = append(conditions, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	query := recordSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return s.queryRecords(c, query, args...)
+}
+
+func (s *sqlStorage) DeleteRecord(c context.Context, id string) error {
+	_, err := s.exec(c, deleteRecordOp, id)
+	return err
+}
+
+func (s *sqlStorage) UpdateVolume(c context.Context, id string, volume, cost float64) error {
+	_, err := s.exec(c, updateVolumeOp, volume, cost, id)
+	return err
+}
+
+func (s *sqlStorage) UpdatePosition(c context.Context, rec Record) error {
+	_, err := s.exec(c, updatePositionOp, rec.Price, rec.Volume, rec.Cost, rec.TriggerPrice, rec.RequestedVolume,
+		rec.LunoAssetFee, rec.LunoFiatFee, rec.ID)
+	return err
+}
+
+// moveRecord runs `move`, a statement returned by `moveRecordOp`, for the record `id` with `args`, then
+// removes the record from the RECORDS table in the same transaction.
+func (s *sqlStorage) moveRecord(c context.Context, move, id string, args ...interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return retryWrite(c, func() error {
+		return s.moveRecordTx(c, move, id, args...)
+	})
+}
+
+// moveRecordTx runs the transaction of `moveRecord`.
+func (s *sqlStorage) moveRecordTx(c context.Context, move, id string, args ...interface{}) (err error) {
+	tx, err := s.db.BeginTx(c, nil)
+	if err != nil {
+		return
+	}
+	if _, err = tx.ExecContext(c, s.dialect.rebind(move), s.dialect.args(append(args, id))...); err != nil {
+		tx.Rollback()
+		return
+	}
+	if _, err = tx.ExecContext(c, s.dialect.rebind(deleteRecordOp), id); err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStorage) CloseRecord(c context.Context, closed ClosedRecord) error {
+	return s.moveRecord(c, closedMove, closed.ID, closed.ClosedAt, closed.CloseOrderID, closed.ClosePrice, closed.CloseVolume)
+}
+
+func (s *sqlStorage) ClosedRecords(c context.Context, asset string) (records []ClosedRecord, err error) {
+	rows, err := s.query(c, closedQuery, asset, asset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var closed ClosedRecord
+		if err = scanRows(closedScanner{rows: rows, rec: &closed}, &closed.Record); err != nil {
+			return nil, err
+		}
+		records = append(records, closed)
+	}
+	return records, rows.Err()
+}
+
+func (s *sqlStorage) ReopenRecord(c context.Context, orderID string) (closed ClosedRecord, err error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	err = retryWrite(c, func() (e error) {
+		closed, e = s.reopenRecordTx(c, orderID)
+		return
+	})
+	return
+}
+
+// reopenRecordTx runs the transaction of `ReopenRecord`.
+func (s *sqlStorage) reopenRecordTx(c context.Context, orderID string) (closed ClosedRecord, err error) {
+	tx, err := s.db.BeginTx(c, nil)
+	if err != nil {
+		return
+	}
+	row := tx.QueryRowContext(c, s.dialect.rebind(closedByOrder), orderID)
+	if err = scanRows(closedScanner{rows: row, rec: &closed}, &closed.Record); err != nil {
+		tx.Rollback()
+		return
+	}
+	for _, op := range []string{reopenOp, reopenDelete} {
+		if _, err = tx.ExecContext(c, s.dialect.rebind(op), orderID); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+	err = tx.Commit()
+	return
+}
+
+func (s *sqlStorage) ArchiveRecord(c context.Context, id, archivedAt, reason string) error {
+	return s.moveRecord(c, archiveMove, id, archivedAt, reason)
+}
+
+func (s *sqlStorage) AddProfit(c context.Context, kind string, entry ProfitEntry, simulated bool) error {
+	_, err := s.exec(c, profitInsert, profitArgs(kind, entry, simulated)...)
+	return err
+}
+
+func (s *sqlStorage) DeleteProfit(c context.Context, orderID string) error {
+	_, err := s.exec(c, profitDelete, orderID)
+	return err
+}
+
+func (s *sqlStorage) Profits(c context.Context, kind string, simulated bool) (entries []*ProfitEntry, err error) {
+	rows, err := s.query(c, profitSelect, kind, simulated)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry := &ProfitEntry{}
+		if err = rows.Scan(&entry.Asset, &entry.OrderID, &entry.ParentID, &entry.Opened, &entry.Timestamp,
+			&entry.PurchasePrice, &entry.PurchaseVolume, &entry.PurchaseCost, &entry.SalePrice, &entry.SaleVolume,
+			&entry.SaleCost, &entry.Profit, &entry.Tranches, &entry.Fees); err != nil {
+			return nil, err
+		}
+		entry.NetProfit = entry.Profit - entry.Fees
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlStorage) ProfitTotals(c context.Context, asset string) (totals ProfitEntry, err error) {
+	totals.Asset = asset
+	err = s.db.QueryRowContext(c, s.dialect.rebind(profitTotals), asset).Scan(&totals.PurchaseVolume, &totals.PurchaseCost,
+		&totals.SaleVolume, &totals.SaleCost, &totals.Profit, &totals.Tranches, &totals.Fees)
+	totals.NetProfit = totals.Profit - totals.Fees
+	return
+}
+
+func (s *sqlStorage) AddEquity(c context.Context, point EquityPoint, simulated bool) error {
+	_, err := s.exec(c, equityInsert, point.Time.Unix(), point.Fiat, point.Positions, simulated)
+	return err
+}
+
+func (s *sqlStorage) EquityCurve(c context.Context, since time.Time, simulated bool) (points []EquityPoint, err error) {
+	rows, err := s.query(c, equitySelect, since.Unix(), simulated)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			point EquityPoint
+			unix  int64
+		)
+		if err = rows.Scan(&unix, &point.Fiat, &point.Positions); err != nil {
+			return nil, err
+		}
+		point.Time = time.Unix(unix, 0)
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+// copyTo writes a consistent copy of an SQLite ledger to `dest`, e.g. for a backup. Ledgers kept on a
+// server are backed up by the server.
+func (s *sqlStorage) copyTo(dest string) error {
+	_, err := s.db.Exec("VACUUM INTO ?", dest)
+	return err
+}
+
+func (s *sqlStorage) Close() error {
+	return s.db.Close()
+}
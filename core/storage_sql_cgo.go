@@ -0,0 +1,28 @@
+//go:build cgo
+// +build cgo
+
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `storage_sql_cgo.go` loads the SQLite driver and reads its error codes. The driver is only built with cgo.
+ */
+
+import (
+	"errors"
+
+	// go-sqlite3 registers itself as the "sqlite3" driver.
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteAvailable is true if this build can open SQLite databases.
+const sqliteAvailable = true
+
+// busy reports whether `err` is SQLite failing to lock the database.
+func busy(err error) bool {
+	var e sqlite3.Error
+	if errors.As(err, &e) {
+		return e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked
+	}
+	return busyMessage(err)
+}
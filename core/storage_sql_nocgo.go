@@ -0,0 +1,19 @@
+//go:build !cgo
+// +build !cgo
+
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `storage_sql_nocgo.go` is used by builds without cgo, e.g. for Android, which do not include the SQLite
+*  driver. Their ledger, trade journal and saved candles are kept in bbolt files instead.
+ */
+
+// sqliteAvailable is true if this build can open SQLite databases.
+const sqliteAvailable = false
+
+// busy reports whether `err` is the database failing to be locked. Without the SQLite driver its error
+// codes can not be read, so the message is matched instead.
+func busy(err error) bool {
+	return busyMessage(err)
+}
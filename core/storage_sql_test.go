@@ -0,0 +1,296 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTempLedger points the settings at a new data folder, so the test gets an empty SQLite ledger.
+func useTempLedger(tb testing.TB) {
+	dir, err := ioutil.TempDir("", "leprechaun")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	savedConfig, savedLogger := cfg(), Logger
+	publishConfig(&Configuration{DataDir: dir, LedgerDatabase: filepath.Join(dir, "ledger.db")})
+	Logger = log.New(ioutil.Discard, "", 0)
+	tb.Cleanup(func() {
+		closeLedgers()
+		journalMu.Lock()
+		closeJournal()
+		journalMu.Unlock()
+		candleStoreMu.Lock()
+		if candleStoreDB != nil {
+			candleStoreDB.Close()
+			candleStoreDB = nil
+		}
+		candleStoreMu.Unlock()
+		publishConfig(savedConfig)
+		Logger = savedLogger
+		os.RemoveAll(dir)
+	})
+}
+
+// useBackend keeps the ledger in the storage backend named `backend`.
+func useBackend(backend string) {
+	c := cfg().Clone()
+	c.Storage.Backend = backend
+	publishConfig(c)
+}
+
+func TestBusy(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		busy bool
+	}{
+		{nil, false},
+		{errors.New("database is locked"), true},
+		{fmt.Errorf("could not add the record: %w", errors.New("database table is locked")), true},
+		{errors.New("SQLITE_BUSY: the database file is locked"), true},
+		{errors.New("no such table: RECORDS"), false},
+	} {
+		if got := busy(test.err); got != test.busy {
+			t.Errorf("busy(%v) = %v, want %v", test.err, got, test.busy)
+		}
+	}
+}
+
+// TestLedgerStress has several clients complete trades at the same time through the shared ledger
+// handle while others read it, as the goroutines of the assets do.
+func TestLedgerStress(t *testing.T) {
+	useTempLedger(t)
+	ledgerStress(t)
+}
+
+// TestBoltLedgerStress runs the same trades against a bbolt ledger.
+func TestBoltLedgerStress(t *testing.T) {
+	useTempLedger(t)
+	useBackend(BoltStorage)
+	if filepath.Ext(ledgerPath()) != ".bolt" {
+		t.Fatalf("the bbolt ledger is kept in %s", ledgerPath())
+	}
+	ledgerStress(t)
+}
+
+func ledgerStress(t *testing.T) {
+	const (
+		clients = 8
+		trades  = 25
+		readers = 4
+	)
+	var (
+		writers sync.WaitGroup
+		reads   sync.WaitGroup
+		errs    = make(chan error, clients*trades+readers)
+		done    = make(chan struct{})
+	)
+	for r := 0; r < readers; r++ {
+		reads.Add(1)
+		go func() {
+			defer reads.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := sharedLedger.AllRecords(); err != nil {
+					errs <- fmt.Errorf("reading the records: %w", err)
+					return
+				}
+				if _, err := GetSales(); err != nil {
+					errs <- fmt.Errorf("reading the sales: %w", err)
+					return
+				}
+			}
+		}()
+	}
+	for c := 0; c < clients; c++ {
+		writers.Add(1)
+		go func(c int) {
+			defer writers.Done()
+			asset := fmt.Sprintf("A%d", c)
+			for i := 0; i < trades; i++ {
+				id := fmt.Sprintf("%s-%d", asset, i)
+				now := time.Now().Format(timeFormat)
+				rec := Record{Asset: asset, ID: id, Price: 100, Volume: 1, Cost: 100, Type: LongOrder, Timestamp: now}
+				if err := sharedLedger.AddRecord(rec); err != nil {
+					errs <- fmt.Errorf("adding %s: %w", id, err)
+					return
+				}
+				rec.Price, rec.Cost = 101, 101
+				if err := sharedLedger.UpdatePosition(rec); err != nil {
+					errs <- fmt.Errorf("updating %s: %w", id, err)
+					return
+				}
+				if err := sharedLedger.CloseRecord(id, "sale-"+id, now, 110, 1); err != nil {
+					errs <- fmt.Errorf("closing %s: %w", id, err)
+					return
+				}
+				if err := NewSale(asset, "sale-"+id, "", now, now, 101, 1, 110, 1, 0.5); err != nil {
+					errs <- fmt.Errorf("saving the sale of %s: %w", id, err)
+					return
+				}
+			}
+		}(c)
+	}
+	writers.Wait()
+	close(done)
+	reads.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	open, err := sharedLedger.everyRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 0 {
+		t.Errorf("%d records are still open, want 0", len(open))
+	}
+	closed, err := ClosedRecords("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != clients*trades {
+		t.Errorf("got %d closed records, want %d", len(closed), clients*trades)
+	}
+	sales, err := GetSales()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sales) != clients*trades {
+		t.Errorf("got %d sales, want %d", len(sales), clients*trades)
+	}
+}
+
+// TestReopenRecord undoes the close of a record, as when the order that closed it is cancelled, in each
+// local backend.
+func TestReopenRecord(t *testing.T) {
+	for _, backend := range []string{SQLiteStorage, BoltStorage} {
+		t.Run(backend, func(t *testing.T) {
+			useTempLedger(t)
+			useBackend(backend)
+			now := time.Now().Format(timeFormat)
+			rec := Record{Asset: "XBT", ID: "buy-1", Price: 100, Volume: 2, Cost: 200, Type: LongOrder, Timestamp: now}
+			if err := sharedLedger.AddRecord(rec); err != nil {
+				t.Fatal(err)
+			}
+			if err := sharedLedger.CloseRecord(rec.ID, "sell-1", now, 110, 2); err != nil {
+				t.Fatal(err)
+			}
+			if err := NewSale("XBT", "sell-1", "", now, now, 100, 2, 110, 2, 0); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sharedLedger.ReopenRecord("sell-2"); err != sql.ErrNoRows {
+				t.Errorf("reopening the record of an order that closed none returned %v, want sql.ErrNoRows", err)
+			}
+			closed, err := sharedLedger.ReopenRecord("sell-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if closed.ID != rec.ID || closed.ClosePrice != 110 || closed.Volume != rec.Volume {
+				t.Errorf("reopened %+v, want record %s closed at 110", closed, rec.ID)
+			}
+			if err = deleteProfit("sell-1"); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := sharedLedger.GetRecordByID(rec.ID); err != nil || got.Volume != rec.Volume {
+				t.Errorf("the record is %+v (%v), want it open for %v", got, err, rec.Volume)
+			}
+			if records, _ := ClosedRecords(""); len(records) != 0 {
+				t.Errorf("%d records are still closed, want 0", len(records))
+			}
+			if sales, _ := GetSales(); len(sales) != 0 {
+				t.Errorf("%d sales are left, want 0", len(sales))
+			}
+		})
+	}
+}
+
+// TestLocalStores keeps a trade in the journal, candles and a backup of the ledger in each local backend
+// this build can open.
+func TestLocalStores(t *testing.T) {
+	backends := []string{BoltStorage}
+	if sqliteAvailable {
+		backends = append(backends, SQLiteStorage)
+	}
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			useTempLedger(t)
+			useBackend(backend)
+			now := time.Now()
+			rec := Record{Asset: "XBT", ID: "buy-1", Price: 100, Volume: 2, Cost: 200, Type: LongOrder, Timestamp: now.Format(timeFormat)}
+			if err := sharedLedger.AddRecord(rec); err != nil {
+				t.Fatal(err)
+			}
+			journalOpen(rec)
+			journalOpen(rec)
+			journalClose(rec, "sell-1", 110, 2)
+			entries, err := JournalEntries("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 || entries[0].OrderID != "sell-1" || entries[0].Profit != 20 {
+				t.Fatalf("the journal holds %+v, want the close of buy-1 for a profit of 20 and its open", entries)
+			}
+			if err = AnnotateJournal(entries[0].ID, "Took profit"); err != nil {
+				t.Fatal(err)
+			}
+			if err = AnnotateJournal(entries[0].ID+10, "missing"); !errors.Is(err, ErrNoJournalEntry) {
+				t.Errorf("annotating a missing entry returned %v, want ErrNoJournalEntry", err)
+			}
+			if entries, _ = JournalEntries(" PROFIT"); len(entries) != 1 || entries[0].Notes != "Took profit" {
+				t.Errorf("searching the notes returned %+v, want the annotated close", entries)
+			}
+			profits, err := ProfitByPeriod("XBT", PeriodDay, time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(profits) != 1 || profits[0].Trades != 1 || profits[0].Wins != 1 || profits[0].Profit != 20 ||
+				!profits[0].Start.Equal(startOfDay(now)) {
+				t.Errorf("ProfitByPeriod() = %+v, want one winning trade of 20 today", profits)
+			}
+
+			start := time.Unix(1600000000, 0)
+			candles := []OHLC{NewOHLC(start, time.Hour, 1, 2, 1, 2, 5), NewOHLC(start.Add(time.Hour), time.Hour, 2, 3, 2, 3, 5),
+				NewOHLC(start.Add(2*time.Hour), time.Hour, 3, 4, 3, 4, 5)}
+			if err = SaveCandles("XBTZAR", time.Hour, candles); err != nil {
+				t.Fatal(err)
+			}
+			if err = SaveCandles("XBTZAR", time.Hour, []OHLC{NewOHLC(start.Add(time.Hour), time.Hour, 2, 3, 1, 2.5, 6)}); err != nil {
+				t.Fatal(err)
+			}
+			stored, err := StoredCandles("XBTZAR", time.Hour, start.Add(time.Hour), start.Add(3*time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored) != 2 || !stored[0].Time.Equal(start.Add(time.Hour)) || stored[0].Close != 2.5 || stored[1].Close != 4 {
+				t.Errorf("StoredCandles() = %+v, want the replaced second candle and the third", stored)
+			}
+			if stored, _ = StoredCandles("XBTZAR", time.Minute, start, start.Add(3*time.Hour)); len(stored) != 0 {
+				t.Errorf("%d candles of another interval were read, want 0", len(stored))
+			}
+
+			backup, err := BackupLedger()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{filepath.Base(journalPath()), filepath.Base(ledgerPath())}
+			sort.Strings(want)
+			if fmt.Sprint(backup.Files) != fmt.Sprint(want) {
+				t.Errorf("the backup holds %v, want %v", backup.Files, want)
+			}
+		})
+	}
+}
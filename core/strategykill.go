@@ -0,0 +1,145 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `strategykill.go` retires an analysis plugin that stops performing. The outcome of every long or
+*  short signal is kept in a rolling window. If the win rate in the window, or the profit of the
+*  positions closed while the plugin was active, drops below the user's thresholds the bot switches
+*  to a fallback plugin or, if there is none, stops opening positions until it is restarted.
+ */
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StrategyKillSettings configures when the active analysis plugin is retired.
+type StrategyKillSettings struct {
+	Enabled bool
+	// Window is the number of most recent signal outcomes the win rate is measured over. The win rate
+	// is not checked until the window is full.
+	Window int
+	// MinWinRate is the lowest share of confirmed signals in the window the plugin may have.
+	MinWinRate float64
+	// MinProfit is the lowest profit, in fiat, of the positions closed while the plugin was active.
+	// It is only checked if `CheckProfit` is set.
+	MinProfit   float64
+	CheckProfit bool
+	// Fallback is the name of the plugin switched to. If it is empty or not registered, the bot only
+	// waits and completes the positions it has already opened.
+	Fallback string
+}
+
+// strategyState holds the rolling performance of the active analysis plugin.
+type strategyState struct {
+	mu       sync.Mutex
+	plugin   string    // Name of the active plugin.
+	outcomes []bool    // Most recent signal outcomes. True for confirmed signals.
+	since    time.Time // When the active plugin started trading.
+	retired  bool      // The plugin was retired and no fallback was available, so the bot only waits.
+}
+
+var strategy = &strategyState{}
+
+// reset starts measuring the performance of the plugin named `plugin`.
+func (s *strategyState) reset(plugin string) {
+	if plugin == "" {
+		plugin = DefaultAnalysisPlugin
+	}
+	plugin = strings.ToLower(plugin)
+	s.mu.Lock()
+	s.plugin, s.outcomes, s.since, s.retired = plugin, nil, time.Now(), false
+	s.mu.Unlock()
+}
+
+// recordStrategyOutcome adds the outcome of a signal to the rolling window of the active plugin.
+func recordStrategyOutcome(confirmed bool) {
+	window := cfg().Trade.StrategyKill.Window
+	if window <= 0 {
+		return
+	}
+	strategy.mu.Lock()
+	strategy.outcomes = append(strategy.outcomes, confirmed)
+	if len(strategy.outcomes) > window {
+		strategy.outcomes = strategy.outcomes[len(strategy.outcomes)-window:]
+	}
+	strategy.mu.Unlock()
+}
+
+// profitClosedSince returns the profit of the positions closed since `since`, and how many there were.
+func profitClosedSince(since time.Time) (profit float64, closed int) {
+	sales, _ := GetSales()
+	purchases, _ := GetPurchases()
+	for _, entry := range append(sales, purchases...) {
+		if t, err := (Record{Timestamp: entry.Timestamp}).Time(); err == nil && !t.Before(since) {
+			profit += entry.Profit
+			closed++
+		}
+	}
+	return
+}
+
+// strategyEvidence returns why the active plugin should be retired, or an empty string if it is performing.
+func strategyEvidence(settings StrategyKillSettings) string {
+	strategy.mu.Lock()
+	outcomes, since := strategy.outcomes, strategy.since
+	strategy.mu.Unlock()
+	evidence := []string{}
+	if settings.Window > 0 && len(outcomes) >= settings.Window {
+		wins := 0
+		for _, confirmed := range outcomes {
+			if confirmed {
+				wins++
+			}
+		}
+		if rate := float64(wins) / float64(len(outcomes)); rate < settings.MinWinRate {
+			evidence = append(evidence, fmt.Sprintf("%d of the last %d signals were right, a win rate of %.0f%% (minimum %.0f%%)",
+				wins, len(outcomes), rate*100, settings.MinWinRate*100))
+		}
+	}
+	if settings.CheckProfit {
+		if profit, closed := profitClosedSince(since); closed > 0 && profit < settings.MinProfit {
+			evidence = append(evidence, fmt.Sprintf("the %d positions closed since %s made %s %.2f (minimum %s %.2f)",
+				closed, since.Format("Jan 2 15:04"), cfg().CurrencyCode, profit, cfg().CurrencyCode, settings.MinProfit))
+		}
+	}
+	return strings.Join(evidence, " and ")
+}
+
+// checkStrategy retires the active analysis plugin if it is underperforming. It returns true while
+// the bot may only wait because no fallback plugin was available.
+func (bot *Bot) checkStrategy() (waitOnly bool) {
+	settings := cfg().Trade.StrategyKill
+	if !settings.Enabled {
+		return false
+	}
+	strategy.mu.Lock()
+	retired, active := strategy.retired, strategy.plugin
+	strategy.mu.Unlock()
+	if retired {
+		return true
+	}
+	evidence := strategyEvidence(settings)
+	if evidence == "" {
+		return false
+	}
+	name := strings.ToLower(settings.Fallback)
+	if fallback, ok := PluginHandler.plugins[name]; ok && name != active {
+		// The plugin is not replaced while an asset resolves it.
+		analysisMu.Lock()
+		bot.SetAnalysisPlugin(fallback)
+		analysisMu.Unlock()
+		strategy.reset(name)
+		notify(EventAlert, "", "The %s plugin is underperforming: %s. Leprechaun has switched to the %s plugin.",
+			active, evidence, name)
+		return false
+	}
+	strategy.mu.Lock()
+	strategy.retired = true
+	strategy.mu.Unlock()
+	notify(EventAlert, "", "The %s plugin is underperforming: %s. Leprechaun will not open new positions until it is restarted.",
+		active, evidence)
+	return true
+}
@@ -0,0 +1,180 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+ */
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// ErrInvalidTakeProfitLadder is returned when the tranches of a take-profit ladder
+// do not add up to a whole position or have invalid margins.
+var ErrInvalidTakeProfitLadder = errors.New("the take-profit ladder is invalid. tranche percentages must be positive and add up to at most 100%")
+
+// ValidateLadder checks that a take-profit ladder can be applied to a position.
+func ValidateLadder(ladder []TakeProfitTranche) error {
+	total := 0.0
+	for _, tranche := range ladder {
+		if tranche.Percentage <= 0 || tranche.Margin <= 0 {
+			return ErrInvalidTakeProfitLadder
+		}
+		total += tranche.Percentage
+	}
+	if total > 1.0+1e-9 {
+		return ErrInvalidTakeProfitLadder
+	}
+	return nil
+}
+
+// triggerReached returns true if a record can be closed at `price`.
+func triggerReached(rec Record, price float64) bool {
+	if rec.Type == ShortOrder {
+		return price <= rec.TriggerPrice
+	}
+	return price >= rec.TriggerPrice
+}
+
+// scaleOut applies the take-profit ladder to the open records of the trade-completion pass. A whole
+// position is split into its tranches once the price reaches the trigger of any of them, and the
+// tranches replace it in the ledger. Whole positions whose tranches can not be closed yet are held
+// back, so they are not closed at the position's own trigger price. Positions still being bought by
+// a DCA plan are left whole.
+func (bot *Bot) scaleOut(ledger *Ledger, records []Record, price float64) (viable []Record) {
+	ladder := cfg().Trade.TakeProfitLadder
+	if len(ladder) == 0 || ValidateLadder(ladder) != nil {
+		return records
+	}
+	for _, rec := range records {
+		if rec.ParentID != "" {
+			viable = append(viable, rec)
+			continue
+		}
+		if plan, ok := DCAPlanFor(rec.Asset); ok && plan.RecordID == rec.ID {
+			viable = append(viable, rec)
+			continue
+		}
+		children := ladderRecord(rec, ladder)
+		reached := false
+		for _, child := range children {
+			reached = reached || triggerReached(child, price)
+		}
+		if !reached {
+			continue
+		}
+		if err := splitRecord(ledger, rec, children); err != nil {
+			debugf("Could not split record %s into take-profit tranches. Reason: %v", rec.ID, err)
+			continue
+		}
+		debugf("%v position %s has been split into %d take-profit tranches.", rec.Type, rec.ID, len(children))
+		viable = append(viable, children...)
+	}
+	return
+}
+
+// splitRecord replaces a record in the ledger with its tranches.
+func splitRecord(ledger *Ledger, rec Record, children []Record) (err error) {
+	for n, child := range children {
+		if err = ledger.AddRecord(child); err != nil {
+			// Undo the tranches added so far so the position is not held twice.
+			for _, added := range children[:n] {
+				ledger.DeleteRecord(added.ID)
+			}
+			return
+		}
+	}
+	return ledger.DeleteRecord(rec.ID)
+}
+
+// closeTranche reports the blended result of a laddered position once its last tranche has been closed.
+func (bot *Bot) closeTranche(ledger *Ledger, rec Record) {
+	if rec.ParentID == "" {
+		return
+	}
+	open, err := ledger.GetChildRecords(rec.ParentID)
+	if err != nil || len(open) > 0 {
+		return
+	}
+	total, err := PositionProfit(rec.ParentID)
+	if err != nil {
+		return
+	}
+	exitPrice := total.SalePrice
+	if rec.Type == ShortOrder {
+		exitPrice = total.PurchasePrice
+	}
+	notify(EventTrade, rec.Asset, "%v position %s has been closed. Blended exit price: %s. Total profit: %.2f",
+		rec.Type, rec.ParentID, AssetPairInfo(rec.Asset).FormatPrice(exitPrice), total.Profit)
+}
+
+// ladderRecord splits a position into child records, one for each tranche of the ladder.
+// Each child holds its share of the position's volume and its own trigger price. Whatever volume
+// is not covered by the ladder (or is lost to rounding) is added to the last tranche, so the
+// whole position is always closed. Assets that can only be traded in whole units (i.e. Ripple coin)
+// are split into whole units. If the ladder is invalid the position is returned unchanged.
+func ladderRecord(rec Record, ladder []TakeProfitTranche) (children []Record) {
+	if err := ValidateLadder(ladder); err != nil || len(ladder) == 0 {
+		debugf("Could not apply the take-profit ladder to record %s. Reason: %v", rec.ID, err)
+		return []Record{rec}
+	}
+	wholeUnits := rec.Asset == "XRP"
+	remaining := rec.Volume
+	for n, tranche := range ladder {
+		volume := rec.Volume * tranche.Percentage
+		if wholeUnits {
+			volume = math.Floor(volume)
+		}
+		if n == len(ladder)-1 || volume > remaining {
+			volume = remaining
+		}
+		if volume <= 0 {
+			continue
+		}
+		remaining -= volume
+		child := rec
+		child.ID = fmt.Sprintf("%s-TP%d", rec.ID, n+1)
+		child.ParentID = rec.ID
+		child.Volume, child.RequestedVolume = volume, volume
+		child.Cost = rec.Price * volume
+		child.TriggerPrice = AssetPairInfo(rec.Asset).TriggerPrice(rec.Price, tranche.Margin, rec.Type)
+		children = append(children, child)
+	}
+	return
+}
+
+// PositionProfit sums the profit entries of every closed tranche of a laddered position.
+// The returned entry holds the blended sale (or repurchase) price of the closed tranches.
+func PositionProfit(parentID string) (total ProfitEntry, err error) {
+	sales, err := GetSales()
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	purchases, err := GetPurchases()
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+	total.OrderID, total.ParentID = parentID, parentID
+	for _, entry := range append(sales, purchases...) {
+		if entry.ParentID != parentID {
+			continue
+		}
+		total.Asset = entry.Asset
+		total.PurchaseVolume += entry.PurchaseVolume
+		total.PurchaseCost += entry.PurchaseCost
+		total.SaleVolume += entry.SaleVolume
+		total.SaleCost += entry.SaleCost
+		total.Profit += entry.Profit
+		total.Timestamp = entry.Timestamp
+	}
+	if total.PurchaseVolume > 0 {
+		total.PurchasePrice = total.PurchaseCost / total.PurchaseVolume
+	}
+	if total.SaleVolume > 0 {
+		total.SalePrice = total.SaleCost / total.SaleVolume
+	}
+	return
+}
@@ -0,0 +1,317 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `tax.go` computes the gains realized in a tax year from the saved sales and purchases. Each sale
+*  disposes of coins, and its cost basis is the cost of the coins it is matched with: the oldest held
+*  first (FIFO), the newest first (LIFO), or those of the position it closed, as they were traded. The
+*  gains of short positions are realized when they are bought back and are always matched as traded.
+*  The report sums the gains by asset and by month, and is written to CSV files that spreadsheets can
+*  print or turn into a PDF. It is an aid for filing, not tax advice.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ways the coins sold are matched with the coins bought, to find their cost basis.
+const (
+	// LotFIFO matches the coins sold with the oldest coins held.
+	LotFIFO = "fifo"
+	// LotLIFO matches the coins sold with the newest coins held.
+	LotLIFO = "lifo"
+	// LotAsTraded matches the coins sold with those of the position the sale closed.
+	LotAsTraded = "as-traded"
+)
+
+// ErrInvalidTaxReport is returned when the settings of a tax report are out of range.
+var ErrInvalidTaxReport = errors.New("invalid tax report settings")
+
+// TaxOptions holds the settings of a tax report.
+type TaxOptions struct {
+	// Year is the year the tax year starts in.
+	Year int
+	// StartMonth is the month the tax year starts in. Zero starts it in January.
+	StartMonth time.Month
+	// Method is `LotFIFO`, the default, `LotLIFO` or `LotAsTraded`.
+	Method string
+	// Location is the time zone the dates are in. Nil uses the local time zone.
+	Location *time.Location
+}
+
+// Disposal is a sale, or the buy back of a short position, that realized a gain or a loss.
+type Disposal struct {
+	Asset string
+	Time  time.Time
+	// Acquired is the time the oldest of the coins it was matched with was bought, or the short was opened.
+	Acquired  time.Time
+	Volume    float64
+	Proceeds  float64
+	CostBasis float64
+	Gain      float64
+	Short     bool
+	OrderID   string
+}
+
+// TaxSummary sums the disposals of an asset in a month, or in the whole tax year if `Month` is zero.
+type TaxSummary struct {
+	Asset     string
+	Month     time.Month
+	Disposals int
+	Proceeds  float64
+	CostBasis float64
+	Gain      float64
+}
+
+// TaxReport holds the gains realized in a tax year.
+type TaxReport struct {
+	From, To  time.Time
+	Method    string
+	Disposals []Disposal
+	// Summaries sum the disposals by asset and month, followed by the total of each asset for the year.
+	Summaries []TaxSummary
+	Total     TaxSummary
+}
+
+// String summarizes the gains of each asset in a line.
+func (r TaxReport) String() string {
+	lines := []string{fmt.Sprintf("Realized gains from %s to %s (%s):", r.From.Format("2006-01-02"),
+		r.To.AddDate(0, 0, -1).Format("2006-01-02"), r.Method)}
+	for _, s := range r.Summaries {
+		if s.Month == 0 {
+			lines = append(lines, fmt.Sprintf("%s: %d disposals, proceeds %.2f, cost %.2f, gain %.2f", s.Asset,
+				s.Disposals, s.Proceeds, s.CostBasis, s.Gain))
+		}
+	}
+	lines = append(lines, fmt.Sprintf("Total: %d disposals, proceeds %.2f, cost %.2f, gain %.2f", r.Total.Disposals,
+		r.Total.Proceeds, r.Total.CostBasis, r.Total.Gain))
+	return strings.Join(lines, "\n")
+}
+
+// lot is coins bought at the same time and price that have not all been matched with sales.
+type lot struct {
+	time          time.Time
+	volume, price float64
+}
+
+// NewTaxReport computes the gains realized in the tax year set in `opts` from the saved sales and
+// purchases and the positions open in the ledger. Coins bought before the tax year are matched too.
+func NewTaxReport(opts TaxOptions) (report TaxReport, err error) {
+	if opts.Method == "" {
+		opts.Method = LotFIFO
+	}
+	if opts.StartMonth == 0 {
+		opts.StartMonth = time.January
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.Method != LotFIFO && opts.Method != LotLIFO && opts.Method != LotAsTraded {
+		return report, fmt.Errorf("%w (unknown lot matching %q)", ErrInvalidTaxReport, opts.Method)
+	}
+	if opts.Year < 2000 || opts.StartMonth < time.January || opts.StartMonth > time.December {
+		return report, fmt.Errorf("%w (year %d starting in month %d)", ErrInvalidTaxReport, opts.Year, opts.StartMonth)
+	}
+	report.Method = opts.Method
+	report.From = time.Date(opts.Year, opts.StartMonth, 1, 0, 0, 0, 0, opts.Location)
+	report.To = report.From.AddDate(1, 0, 0)
+	sales, _ := GetSales()
+	purchases, _ := GetPurchases()
+	if len(sales)+len(purchases) == 0 {
+		return report, errors.New("there are no sales or purchases saved yet")
+	}
+
+	var held []Record
+	if ledgerExists() {
+		l := &Ledger{databasePath: ledgerPath()}
+		l.loadDatabase()
+		held, _ = l.AllRecords()
+		l.Save()
+	}
+	disposals := matchLots(sales, held, opts.Method)
+	for _, entry := range purchases {
+		closed, err := entry.Time()
+		if err != nil {
+			continue
+		}
+		opened, err := Record{Timestamp: entry.Opened}.Time()
+		if err != nil {
+			opened = closed
+		}
+		disposals = append(disposals, Disposal{Asset: entry.Asset, Time: closed, Acquired: opened, Volume: entry.SaleVolume,
+			Proceeds: entry.SaleCost, CostBasis: entry.PurchaseCost, Gain: entry.SaleCost - entry.PurchaseCost, Short: true,
+			OrderID: entry.OrderID})
+	}
+	for _, d := range disposals {
+		if !d.Time.Before(report.From) && d.Time.Before(report.To) {
+			report.Disposals = append(report.Disposals, d)
+		}
+	}
+	sort.SliceStable(report.Disposals, func(i, j int) bool { return report.Disposals[i].Time.Before(report.Disposals[j].Time) })
+	report.summarize(opts.Location)
+	return report, nil
+}
+
+// matchLots returns the disposals of `sales`, whose cost bases are those of the coins they are matched
+// with by `method`. The coins are those bought by the positions sold and by the long positions still
+// open in `held`. A sale is only matched with coins bought before it.
+func matchLots(sales []*ProfitEntry, held []Record, method string) (disposals []Disposal) {
+	type sale struct {
+		entry        *ProfitEntry
+		time, bought time.Time
+	}
+	events := []sale{}
+	// lots[asset] holds the coins bought of the asset, ordered from the oldest.
+	lots := map[string][]*lot{}
+	for _, entry := range sales {
+		sold, err := entry.Time()
+		if err != nil {
+			continue
+		}
+		bought, err := Record{Timestamp: entry.Opened}.Time()
+		if err != nil {
+			bought = sold
+		}
+		events = append(events, sale{entry, sold, bought})
+		lots[entry.Asset] = append(lots[entry.Asset], &lot{bought, entry.PurchaseVolume, entry.PurchasePrice})
+	}
+	for _, rec := range held {
+		if bought, err := rec.Time(); err == nil && rec.Type == LongOrder {
+			lots[rec.Asset] = append(lots[rec.Asset], &lot{bought, rec.Volume, rec.Price})
+		}
+	}
+	for _, l := range lots {
+		sort.SliceStable(l, func(i, j int) bool { return l[i].time.Before(l[j].time) })
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].time.Before(events[j].time) })
+	for _, e := range events {
+		entry := e.entry
+		disposal := Disposal{Asset: entry.Asset, Time: e.time, Acquired: e.bought, Volume: entry.SaleVolume,
+			Proceeds: entry.SaleCost, OrderID: entry.OrderID}
+		if method == LotAsTraded {
+			disposal.CostBasis = entry.PurchaseCost
+			disposal.Gain = disposal.Proceeds - disposal.CostBasis
+			disposals = append(disposals, disposal)
+			continue
+		}
+		// next returns the lot the next coins sold are matched with, or nil if none is left.
+		next := func() *lot {
+			var found *lot
+			for _, l := range lots[entry.Asset] {
+				if l.volume <= 1e-12 || l.time.After(e.time) {
+					continue
+				}
+				if found == nil || method == LotLIFO {
+					found = l
+				}
+				if method == LotFIFO {
+					break
+				}
+			}
+			return found
+		}
+		remaining := entry.SaleVolume
+		disposal.Acquired = e.time
+		for l := next(); remaining > 1e-12 && l != nil; l = next() {
+			matched := l.volume
+			if matched > remaining {
+				matched = remaining
+			}
+			disposal.CostBasis += matched * l.price
+			if l.time.Before(disposal.Acquired) {
+				disposal.Acquired = l.time
+			}
+			l.volume -= matched
+			remaining -= matched
+		}
+		if remaining > 1e-12 {
+			// More was sold than was bought, e.g. coins held before Leprechaun. They are costed at the
+			// price of the position that was sold.
+			disposal.CostBasis += remaining * entry.PurchasePrice
+		}
+		disposal.Gain = disposal.Proceeds - disposal.CostBasis
+		disposals = append(disposals, disposal)
+	}
+	return
+}
+
+// summarize sums the disposals of the report by asset and month, and in total.
+func (r *TaxReport) summarize(loc *time.Location) {
+	monthly := map[string]map[time.Month]*TaxSummary{}
+	assets := []string{}
+	r.Total = TaxSummary{Asset: "All"}
+	add := func(s *TaxSummary, d Disposal) {
+		s.Disposals++
+		s.Proceeds += d.Proceeds
+		s.CostBasis += d.CostBasis
+		s.Gain += d.Gain
+	}
+	for _, d := range r.Disposals {
+		if monthly[d.Asset] == nil {
+			monthly[d.Asset] = map[time.Month]*TaxSummary{}
+			assets = append(assets, d.Asset)
+		}
+		month := d.Time.In(loc).Month()
+		if monthly[d.Asset][month] == nil {
+			monthly[d.Asset][month] = &TaxSummary{Asset: d.Asset, Month: month}
+		}
+		add(monthly[d.Asset][month], d)
+		add(&r.Total, d)
+	}
+	sort.Strings(assets)
+	r.Summaries = nil
+	for _, asset := range assets {
+		year := TaxSummary{Asset: asset}
+		// Months are listed in the order of the tax year.
+		for m := 0; m < 12; m++ {
+			month := time.Month((int(r.From.Month())-1+m)%12 + 1)
+			if s := monthly[asset][month]; s != nil {
+				r.Summaries = append(r.Summaries, *s)
+				year.Disposals += s.Disposals
+				year.Proceeds += s.Proceeds
+				year.CostBasis += s.CostBasis
+				year.Gain += s.Gain
+			}
+		}
+		r.Summaries = append(r.Summaries, year)
+	}
+}
+
+// WriteCSV writes the disposals and the summaries of the report to two CSV files in `dir` and returns their paths.
+func (r TaxReport) WriteCSV(dir string) (paths []string, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("tax-%s-%s", r.From.Format("2006-01"), r.Method)
+	disposals := [][]string{{"Date", "Asset", "Order ID", "Acquired", "Volume", "Proceeds", "Cost basis", "Gain", "Short"}}
+	for _, d := range r.Disposals {
+		disposals = append(disposals, []string{d.Time.Format("2006-01-02 15:04:05"), d.Asset, d.OrderID,
+			d.Acquired.Format("2006-01-02 15:04:05"), formatFloat(d.Volume), formatFloat(d.Proceeds),
+			formatFloat(d.CostBasis), formatFloat(d.Gain), fmt.Sprint(d.Short)})
+	}
+	summary := [][]string{{"Asset", "Month", "Disposals", "Proceeds", "Cost basis", "Gain"}}
+	for _, s := range append(r.Summaries, r.Total) {
+		month := "Year"
+		if s.Month != 0 {
+			month = s.Month.String()
+		}
+		summary = append(summary, []string{s.Asset, month, fmt.Sprint(s.Disposals), formatFloat(s.Proceeds),
+			formatFloat(s.CostBasis), formatFloat(s.Gain)})
+	}
+	for _, f := range []struct {
+		path string
+		rows [][]string
+	}{{filepath.Join(dir, name+"-disposals.csv"), disposals}, {filepath.Join(dir, name+"-summary.csv"), summary}} {
+		if err = writeCSV(f.path, f.rows); err != nil {
+			return paths, err
+		}
+		paths = append(paths, f.path)
+	}
+	return paths, nil
+}
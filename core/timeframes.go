@@ -0,0 +1,61 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `timeframes.go` confirms a signal on a second timeframe. Besides the candles the analysis plugin is
+*  given, a shorter series of candles, e.g. 15 minute candles, is retrieved and a long or short signal is
+*  only acted on when the trends of both series agree. Each candle is one request to the exchange, so
+*  the second series covers a few hours by default.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeframesDisagree is returned when the trend of the confirming timeframe differs from the trend of the analyzed candles.
+var ErrTimeframesDisagree = errors.New("the trends of the two timeframes do not agree")
+
+// TimeframeSettings configures the confirmation of signals on a second timeframe.
+type TimeframeSettings struct {
+	// Interval is the length (in minutes) of the candles of the confirming timeframe. Zero disables the confirmation.
+	Interval int32
+	// Period is how many hours of candles of the confirming timeframe are retrieved.
+	Period int32
+}
+
+// Validate returns an error if the confirming timeframe can not hold a single candle.
+func (s TimeframeSettings) Validate() error {
+	if s.Interval < 0 || s.Period < 0 || (s.Interval > 0 && (s.Period == 0 || int64(s.Interval) > int64(s.Period)*60)) {
+		return fmt.Errorf("invalid confirming timeframe (%d minute candles over %d hours)", s.Interval, s.Period)
+	}
+	return nil
+}
+
+// confirmTimeframes returns the signal if the trend of the candles of the confirming timeframe set in `opts`
+// agrees with the trend of `candles`. Otherwise it returns `SignalWait` and an error explaining why.
+func confirmTimeframes(cl *Client, opts *AnalysisOptions, candles []OHLC, signal SIGNAL) (SIGNAL, error) {
+	if opts.SecondaryInterval <= 0 || (signal != SignalLong && signal != SignalShort) {
+		return signal, nil
+	}
+	secondary, _, err := cl.PreviousTrades(opts.SecondaryPeriod, opts.SecondaryInterval)
+	if err != nil || len(secondary) == 0 {
+		return SignalWait, fmt.Errorf("the %v candles could not be retrieved: %v", opts.SecondaryInterval, err)
+	}
+	chart := CandleChart{}
+	primaryTrend, secondaryTrend := chart.DetectTrend(candles), chart.DetectTrend(secondary)
+	if primaryTrend.IsIndifferent() || primaryTrend != secondaryTrend {
+		return SignalWait, fmt.Errorf("%w (%v candles: %s, %v candles: %s)", ErrTimeframesDisagree,
+			opts.Interval, primaryTrend, opts.SecondaryInterval, secondaryTrend)
+	}
+	debugf("The %v and %v candles of %s are both %s. The %v signal is confirmed.", opts.Interval,
+		opts.SecondaryInterval, cl.name, primaryTrend, signal)
+	return signal, nil
+}
+
+// secondaryTimeframe returns the interval and period of the confirming timeframe set by the user.
+func secondaryTimeframe() (interval, period time.Duration) {
+	settings := cfg().Trade.Timeframes
+	return time.Duration(settings.Interval) * time.Minute, time.Duration(settings.Period) * time.Hour
+}
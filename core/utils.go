@@ -5,9 +5,11 @@ package core
  */
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -26,6 +28,12 @@ type Channels struct {
 	PurchaseChan chan struct{}
 	// SaleChan channel notifies the UI that a sale has been made so it can update its displayed records.
 	SaleChan chan struct{}
+	// ProposalChan sends trade proposals to the UI for the user to approve or reject.
+	ProposalChan chan *TradeProposal
+	// ExplanationChan sends the reasons for each signal to the UI.
+	ExplanationChan chan SignalExplanation
+	// ConfigChan delivers the settings the user saves while the bot runs.
+	ConfigChan chan *Configuration
 }
 
 // Log sets the log channel
@@ -58,17 +66,25 @@ func (c *Channels) Sale(channel chan struct{}) {
 	c.SaleChan = channel
 }
 
+// Proposal sets the channel through which the bot asks the UI to approve trades.
+func (c *Channels) Proposal(channel chan *TradeProposal) {
+	c.ProposalChan = channel
+}
+
 // TODO: After testing debug should be changed to bot.log() function
 func debug(v ...interface{}) {
 	// write to stdout
 	// log.Println(v...)
 
 	// Send log message to UI over channel
-	if config.Verbose && config.Debug {
+	if cfg().Verbose && cfg().Debug {
 		time := time.Now().Format("15:04:05")
 		logChannel <- time + " " + fmt.Sprint(v...)
 	}
 
+	// keep the message for observers
+	recordLog(time.Now().Format("15:04:05") + " " + fmt.Sprint(v...))
+
 	// write to the log file
 	Logger.Print(v...)
 }
@@ -78,29 +94,22 @@ func debugf(format string, v ...interface{}) {
 	// log.Printf(format, v...)
 
 	// Send log message to UI over channel
-	if config.Verbose && config.Debug {
+	if cfg().Verbose && cfg().Debug {
 		time := time.Now().Format("15:04:05")
 		logChannel <- time + " " + fmt.Sprintf(format, v...)
 	}
 
+	// keep the message for observers
+	recordLog(time.Now().Format("15:04:05") + " " + fmt.Sprintf(format, v...))
+
 	// write to log file
 	Logger.Printf(format, v...)
 }
 
 // Snooze pauses Leprechaun's main loop for some time between each trading round
 func Snooze() error {
-	var minutes int32
-	if config.RandomSnooze {
-		snoozeIntervals := config.SnoozeTimes
-		rand.Seed(time.Now().Unix())
-		rand.Shuffle(len(snoozeIntervals), func(i int, j int) {
-			snoozeIntervals[i], snoozeIntervals[j] = snoozeIntervals[j], snoozeIntervals[i]
-		})
-		minutes = snoozeIntervals[rand.Intn(len(snoozeIntervals))]
-	} else {
-		minutes = config.SnoozePeriod
-	}
-	if config.Debug {
+	minutes := snoozeMinutes()
+	if cfg().Debug {
 		debug("snoozing...")
 	}
 	err := snooze(minutes)
@@ -111,37 +120,55 @@ func Snooze() error {
 	return nil
 }
 
-func snooze(mins int32) error {
-	minutes := time.Duration(mins)
+// snoozeMinutes returns the minutes to wait between two trading rounds.
+func snoozeMinutes() (minutes int32) {
+	if cfg().RandomSnooze {
+		// The intervals are shuffled in a copy, as every traded asset snoozes on its own.
+		snoozeIntervals := append([]int32{}, cfg().SnoozeTimes...)
+		rand.Seed(time.Now().Unix())
+		rand.Shuffle(len(snoozeIntervals), func(i int, j int) {
+			snoozeIntervals[i], snoozeIntervals[j] = snoozeIntervals[j], snoozeIntervals[i]
+		})
+		minutes = snoozeIntervals[rand.Intn(len(snoozeIntervals))]
+	} else {
+		minutes = cfg().SnoozePeriod
+	}
+	return
+}
+
+// snoozeFor waits for `d` unless `c` is done or the user stops the bot first.
+func snoozeFor(c context.Context, d time.Duration) error {
 	tick := time.NewTicker(6 * time.Second)
 	defer tick.Stop()
-	snoozeEnd := time.NewTimer(minutes * time.Minute)
+	snoozeEnd := time.NewTimer(d)
 	defer snoozeEnd.Stop()
 	for {
 		select {
 		case <-tick.C:
 			// check if user has stopped the bot every 6 seconds
+			heartbeat()
 			if cancelled() {
 				return ErrCancelled
 			}
+		case <-c.Done():
+			return c.Err()
 		case <-snoozeEnd.C:
-			// Snooze period has elapsed.
 			return nil
-		default:
-			time.Sleep(2)
 		}
 	}
 }
-func snoozeSeconds(seconds int32) error {
-	secs := time.Duration(seconds)
+
+func snooze(mins int32) error {
+	minutes := time.Duration(mins)
 	tick := time.NewTicker(6 * time.Second)
 	defer tick.Stop()
-	snoozeEnd := time.NewTimer(secs * time.Second)
+	snoozeEnd := time.NewTimer(minutes * time.Minute)
 	defer snoozeEnd.Stop()
 	for {
 		select {
 		case <-tick.C:
 			// check if user has stopped the bot every 6 seconds
+			heartbeat()
 			if cancelled() {
 				return ErrCancelled
 			}
@@ -167,3 +194,43 @@ func exists(path string) bool {
 	return true
 
 }
+
+// writeFileSynced writes `data` to the file at `path` and flushes it to disk before returning.
+func writeFileSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replaceFileSynced replaces the file at `path` with `data`. It is written to a temporary file which is
+// renamed once it is on disk, so a crash can not leave the file half-written.
+func replaceFileSynced(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := writeFileSynced(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// syncDir flushes the entries of a folder to disk, e.g. after a file in it was renamed.
+// Some platforms can not sync folders, so errors are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
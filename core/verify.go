@@ -0,0 +1,192 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `verify.go` checks that the open records of the ledger are consistent, without asking the exchange.
+*  Unlike the audit, which compares records with their orders, it finds records that could not have
+*  been written by a healthy bot: sale IDs left on records that are still open, records that hold no
+*  volume, trigger prices that do not match the profit margin and orders recorded more than once. Each
+*  problem can be repaired. Records are archived rather than deleted where the repair removes them.
+ */
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Kinds of the problems found by `VerifyLedger`.
+const (
+	// ProblemOrphanSale is an open record that holds the ID of a sale order. Records are closed, not
+	// marked sold, so the sale was either not recorded or did not close the record.
+	ProblemOrphanSale = "orphan sale"
+	// ProblemZeroVolume is an open record that holds no volume.
+	ProblemZeroVolume = "zero volume"
+	// ProblemTriggerPrice is an open record whose trigger price does not match the profit margin.
+	ProblemTriggerPrice = "trigger price"
+	// ProblemDuplicateID is an order recorded more than once, or both open and closed.
+	ProblemDuplicateID = "duplicate order"
+)
+
+// maxTakerFee is the largest taker fee a trigger price is expected to allow for. Trigger prices set net
+// of any lower fee are consistent with the margin.
+const maxTakerFee = 0.01
+
+// LedgerProblem is an inconsistency in the ledger found by `VerifyLedger`.
+type LedgerProblem struct {
+	Kind     string
+	Asset    string
+	RecordID string
+	Message  string
+	// Repaired reports whether the problem was repaired, and RepairError why it could not be.
+	Repaired    bool
+	RepairError error
+}
+
+func (p LedgerProblem) String() string {
+	s := fmt.Sprintf("%s %s record %s: %s.", p.Kind, p.Asset, p.RecordID, p.Message)
+	switch {
+	case p.Repaired:
+		s += " Repaired."
+	case p.RepairError != nil:
+		s += fmt.Sprintf(" Could not repair it: %v.", p.RepairError)
+	}
+	return s
+}
+
+// VerifyLedger checks the open records of the ledger and returns the problems it finds. If `repair` is
+// true each problem is repaired as well. Orphan sale IDs are removed from records that were not closed
+// by the sale, and records that were are archived. Records with no volume are archived. Trigger prices
+// are set from the record's price and the profit margin. The records of an order recorded more than once
+// are merged into one, and open records that have also been closed are archived. Repairs should not be
+// made while the bot is trading.
+func VerifyLedger(repair bool) (problems []LedgerProblem, err error) {
+	if cfg() == nil {
+		return nil, fmt.Errorf("the settings have not been loaded")
+	}
+	if !ledgerExists() {
+		return nil, nil
+	}
+	ledger := sharedLedger
+	records, err := ledger.everyRecord()
+	if err != nil {
+		return nil, err
+	}
+	closed, err := ClosedRecords("")
+	if err != nil {
+		return nil, err
+	}
+	closedIDs, closingOrders := map[string]bool{}, map[string]bool{}
+	for _, rec := range closed {
+		closedIDs[rec.ID] = true
+		closingOrders[rec.CloseOrderID] = true
+	}
+	for _, kind := range []string{profitSale, profitPurchase} {
+		for _, simulated := range []bool{false, true} {
+			entries, e := profitEntries(kind, simulated)
+			if e != nil {
+				return nil, e
+			}
+			for _, entry := range entries {
+				closingOrders[entry.OrderID] = true
+			}
+		}
+	}
+	count := map[string]int{}
+	for _, rec := range records {
+		count[rec.ID]++
+	}
+	seen := map[string]bool{}
+	for _, rec := range records {
+		if seen[rec.ID] {
+			// Each duplicated order is reported once.
+			continue
+		}
+		seen[rec.ID] = true
+		problem := LedgerProblem{Asset: rec.Asset, RecordID: rec.ID}
+		var fix func() error
+		switch {
+		case count[rec.ID] > 1:
+			problem.Kind = ProblemDuplicateID
+			problem.Message = fmt.Sprintf("the order is recorded %d times", count[rec.ID])
+			fix = func() error { return ledger.replaceRecord(rec) }
+		case closedIDs[rec.ID]:
+			problem.Kind = ProblemDuplicateID
+			problem.Message = "the position is open and has been closed"
+			fix = func() error { return ledger.archiveRecord(rec.ID, problem.Kind+": "+problem.Message) }
+		case rec.SaleID != "" && closingOrders[rec.SaleID]:
+			problem.Kind = ProblemOrphanSale
+			problem.Message = fmt.Sprintf("the position was closed by sale %s but is still open", rec.SaleID)
+			fix = func() error { return ledger.archiveRecord(rec.ID, problem.Kind+": "+problem.Message) }
+		case rec.SaleID != "" || rec.Sold:
+			problem.Kind = ProblemOrphanSale
+			problem.Message = fmt.Sprintf("the record is marked sold by order %q, which is not in the ledger", rec.SaleID)
+			fix = func() error {
+				rec.SaleID, rec.Sold = "", false
+				return ledger.replaceRecord(rec)
+			}
+		case rec.Volume <= 0:
+			problem.Kind = ProblemZeroVolume
+			problem.Message = fmt.Sprintf("the record holds %f %s", rec.Volume, rec.Asset)
+			fix = func() error { return ledger.archiveRecord(rec.ID, problem.Kind+": "+problem.Message) }
+		case !triggerMatchesMargin(rec):
+			info := AssetPairInfo(rec.Asset)
+			expected := info.TriggerPrice(rec.Price, cfg().ProfitMargin, rec.Type)
+			problem.Kind = ProblemTriggerPrice
+			problem.Message = fmt.Sprintf("the trigger price is %s, but a margin of %.2f%% on %s sets it at %s",
+				info.FormatPrice(rec.TriggerPrice), cfg().ProfitMargin*100, info.FormatPrice(rec.Price), info.FormatPrice(expected))
+			fix = func() error {
+				rec.TriggerPrice = expected
+				return ledger.UpdatePosition(rec)
+			}
+		default:
+			continue
+		}
+		if repair {
+			problem.RepairError = fix()
+			problem.Repaired = problem.RepairError == nil
+		}
+		problems = append(problems, problem)
+	}
+	return problems, nil
+}
+
+// triggerMatchesMargin reports whether the trigger price of `rec` is the one the profit margin sets, net
+// of a taker fee of up to `maxTakerFee`. The tranches of laddered positions have margins of their own and
+// are not checked.
+func triggerMatchesMargin(rec Record) bool {
+	if rec.ParentID != "" || rec.Price <= 0 {
+		return true
+	}
+	info := AssetPairInfo(rec.Asset)
+	info.TakerFee = 0
+	low := info.TriggerPrice(rec.Price, cfg().ProfitMargin, rec.Type)
+	info.TakerFee = maxTakerFee
+	high := info.TriggerPrice(rec.Price, cfg().ProfitMargin, rec.Type)
+	low, high = math.Min(low, high), math.Max(low, high)
+	tolerance := info.TickSize / 2
+	return rec.TriggerPrice >= low-tolerance && rec.TriggerPrice <= high+tolerance
+}
+
+// replaceRecord replaces every open record with the ID of `rec` by `rec`.
+func (l *Ledger) replaceRecord(rec Record) error {
+	if err := l.DeleteRecord(rec.ID); err != nil {
+		return err
+	}
+	if err := l.AddRecord(rec); err != nil {
+		return fmt.Errorf("record %s was removed but could not be added again: %w", rec.ID, err)
+	}
+	return nil
+}
+
+// VerifyReport returns `problems` as lines of text.
+func VerifyReport(problems []LedgerProblem) string {
+	if len(problems) == 0 {
+		return "The ledger is consistent."
+	}
+	lines := []string{fmt.Sprintf("Found %d problem(s) in the ledger:", len(problems))}
+	for _, p := range problems {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
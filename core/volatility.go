@@ -0,0 +1,93 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `volatility.go` scales the size of new positions with the volatility of an asset. Volatility is
+*  measured by the Average True Range (ATR) of the candles retrieved for the analysis. Entries are
+*  smaller when the ATR is high and larger when it is low, within set bounds and the exposure
+*  allowed for the asset.
+ */
+
+import (
+	"math"
+	"sync"
+
+	"github.com/michaellormann/leprechaun/indicators"
+)
+
+// VolatilitySizingSettings configures the scaling of position sizes by volatility.
+type VolatilitySizingSettings struct {
+	Enabled bool
+	// Period is the number of candles the ATR is averaged over.
+	Period int
+	// TargetATR is the ATR, as a fraction of the price, at which entries have their regular size.
+	TargetATR float64
+	// MinMultiplier and MaxMultiplier bound the size of an entry as a multiple of a regular entry.
+	MinMultiplier float64
+	MaxMultiplier float64
+}
+
+var (
+	// recentCandles holds the candles of the last analysis of each asset.
+	recentCandles   = map[string][]OHLC{}
+	recentCandlesMu sync.Mutex
+)
+
+// recordCandles keeps the candles retrieved for the analysis of an asset.
+func recordCandles(asset string, candles []OHLC) {
+	recentCandlesMu.Lock()
+	recentCandles[asset] = candles
+	recentCandlesMu.Unlock()
+}
+
+// averageTrueRange returns the ATR of `candles` over `period` candles, using Wilder's smoothing.
+// It returns zero if there are not enough candles.
+func averageTrueRange(candles []OHLC, period int) float64 {
+	atr, err := indicators.ATR(indicatorCandles(candles), period)
+	if err != nil {
+		return 0
+	}
+	return atr
+}
+
+// volatilityMultiplier returns the size of an entry as a multiple of a regular entry for an ATR
+// of `atrRatio`, the ATR as a fraction of the price.
+func volatilityMultiplier(atrRatio float64) float64 {
+	settings := cfg().Trade.VolatilitySizing
+	if atrRatio <= 0 || settings.TargetATR <= 0 {
+		return 1
+	}
+	multiplier := settings.TargetATR / atrRatio
+	return math.Min(math.Max(multiplier, settings.MinMultiplier), settings.MaxMultiplier)
+}
+
+// volatilityVolume scales the volume of a new entry by the volatility of the client's asset.
+// Larger entries are only placed if the balance and the exposure limit for the asset allow it.
+func (bot *Bot) volatilityVolume(cl *Client, signal SIGNAL, volume, price float64) float64 {
+	settings := cfg().Trade.VolatilitySizing
+	if !settings.Enabled || price <= 0 || (signal != SignalLong && signal != SignalShort) {
+		return volume
+	}
+	recentCandlesMu.Lock()
+	atr := averageTrueRange(recentCandles[cl.asset], settings.Period)
+	recentCandlesMu.Unlock()
+	if atr == 0 {
+		return volume
+	}
+	scaled := volume * volatilityMultiplier(atr/price)
+	if cl.asset == "XRP" {
+		scaled = math.Floor(scaled)
+	}
+	if scaled < cl.minOrderVol {
+		scaled = cl.minOrderVol
+	}
+	if scaled > volume && !bot.canScaleUp(cl, signal, scaled, price) {
+		debugf("Leprechaun will not increase the size of the %s entry. It would exceed your balance or the exposure limit.", cl.name)
+		return volume
+	}
+	if scaled != volume {
+		debugf("The ATR of %s is %.2f%% of the price. The entry is scaled to %.0f%% of its size.",
+			cl.name, atr/price*100, scaled/volume*100)
+	}
+	return scaled
+}
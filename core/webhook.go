@@ -0,0 +1,213 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `webhook.go` holds the "webhook" analysis plugin. It listens on a local HTTP endpoint for alerts sent
+*  by external charting tools such as TradingView, and turns them into long and short signals for the
+*  pairs they name. Leprechaun then handles the execution: sizing, risk checks, orders and exits.
+ */
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookPlugin is the name the webhook analysis plugin is registered under.
+const WebhookPlugin = "webhook"
+
+var (
+	// ErrWebhookSecret is returned for an alert that does not carry the secret set by the user.
+	ErrWebhookSecret = errors.New("the alert does not carry the webhook secret")
+	// ErrUnknownAlert is returned for an alert whose action or pair is not understood.
+	ErrUnknownAlert = errors.New("the alert could not be understood")
+)
+
+// WebhookSettings configures the endpoint external alerts are received on.
+type WebhookSettings struct {
+	// Address is the address the endpoint listens on, e.g. "127.0.0.1:8090". Empty disables it.
+	Address string
+	// Secret must be included in every alert. Alerts without it are rejected.
+	Secret string
+	// Expiry is the number of minutes an alert is acted on after it is received. Zero never expires alerts.
+	Expiry int32
+}
+
+// Validate returns an error if the endpoint is enabled without a secret or the expiry is negative.
+func (s WebhookSettings) Validate() error {
+	if s.Address != "" && s.Secret == "" {
+		return errors.New("the webhook endpoint needs a secret")
+	}
+	if s.Expiry < 0 {
+		return fmt.Errorf("alerts can not expire after %d minutes", s.Expiry)
+	}
+	return nil
+}
+
+// WebhookAlert is the body of an alert, e.g. {"secret": "...", "ticker": "{{ticker}}", "action": "buy"}
+// as set in the message of a TradingView alert.
+type WebhookAlert struct {
+	Secret string `json:"secret"`
+	// Ticker is the pair the alert is for, e.g. "XBTNGN" or "LUNO:XBTNGN".
+	Ticker string `json:"ticker"`
+	// Action is "buy" or "long" to go long, and "sell" or "short" to go short.
+	Action string `json:"action"`
+}
+
+// signal returns the pair and the signal of the alert.
+func (alert WebhookAlert) signal() (pair string, signal SIGNAL, err error) {
+	pair = strings.ToUpper(strings.TrimSpace(alert.Ticker))
+	if ix := strings.LastIndex(pair, ":"); ix >= 0 {
+		// Drop the exchange prefix.
+		pair = pair[ix+1:]
+	}
+	switch strings.ToLower(strings.TrimSpace(alert.Action)) {
+	case "buy", "long":
+		signal = SignalLong
+	case "sell", "short":
+		signal = SignalShort
+	default:
+		return "", SignalWait, fmt.Errorf("%w (unknown action %q)", ErrUnknownAlert, alert.Action)
+	}
+	if pair == "" {
+		return "", SignalWait, fmt.Errorf("%w (no ticker)", ErrUnknownAlert)
+	}
+	return
+}
+
+// receivedAlert is an alert waiting to be acted on.
+type receivedAlert struct {
+	signal   SIGNAL
+	received time.Time
+}
+
+var (
+	alertsMu      sync.Mutex
+	alerts        = map[string]receivedAlert{}
+	webhookServer sync.Once
+)
+
+// receiveAlert reads an alert from `body` and keeps its signal for its pair. A newer alert for a pair
+// replaces the one before it.
+func receiveAlert(body io.Reader, secret string) (pair string, signal SIGNAL, err error) {
+	var alert WebhookAlert
+	if err = json.NewDecoder(io.LimitReader(body, 1<<16)).Decode(&alert); err != nil {
+		return "", SignalWait, fmt.Errorf("%w (%v)", ErrUnknownAlert, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(alert.Secret), []byte(secret)) != 1 {
+		return "", SignalWait, ErrWebhookSecret
+	}
+	if pair, signal, err = alert.signal(); err != nil {
+		return
+	}
+	alertsMu.Lock()
+	alerts[pair] = receivedAlert{signal: signal, received: time.Now()}
+	alertsMu.Unlock()
+	return
+}
+
+// takeAlert returns the signal of the alert for `pair` and forgets it, so each alert is only acted on
+// once. Alerts older than `expiry` are dropped.
+func takeAlert(pair string, expiry time.Duration) SIGNAL {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+	alert, ok := alerts[pair]
+	if !ok {
+		return SignalWait
+	}
+	delete(alerts, pair)
+	if expiry > 0 && time.Since(alert.received) > expiry {
+		debugf("The %v alert for %s expired before it could be acted on.", alert.signal, pair)
+		return SignalWait
+	}
+	return alert.signal
+}
+
+func webhookHandler(secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "alerts must be posted", http.StatusMethodNotAllowed)
+			return
+		}
+		pair, signal, err := receiveAlert(r.Body, secret)
+		switch {
+		case errors.Is(err, ErrWebhookSecret):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		debugf("Received a %v alert for %s.", signal, pair)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// ServeWebhook starts listening for alerts on `config.Webhook.Address`. It does nothing if no address
+// is set and the endpoint is only started once, so it outlives restarts of the bot.
+func ServeWebhook() {
+	settings := cfg().Webhook
+	if settings.Address == "" || settings.Validate() != nil {
+		return
+	}
+	webhookServer.Do(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/webhook", webhookHandler(settings.Secret))
+		go func() {
+			if err := http.ListenAndServe(settings.Address, mux); err != nil {
+				Logger.Printf("Could not listen for alerts on %s. Reason: %v", settings.Address, err)
+			}
+		}()
+		debugf("Listening for alerts on %s/webhook", settings.Address)
+	})
+}
+
+// Webhook is an analysis plugin that emits the signals of alerts received from external charting tools.
+// It does not analyze prices itself. An asset is only traded when an alert for its pair has arrived
+// since it was last analyzed.
+type Webhook struct {
+	asset string
+}
+
+// Description gives a brief summary of what the plugin does and how.
+func (plugin *Webhook) Description() string {
+	return `"Webhook trades on alerts sent by external charting tools such as TradingView. Each alert names a pair and
+	an action, buy or sell, and is acted on once, the next time the pair is analyzed. Leprechaun still sizes the trade,
+	checks the risk limits and closes the position."`
+}
+
+// SetOptions ...
+func (plugin *Webhook) SetOptions(opts *AnalysisOptions) error {
+	plugin.asset = opts.Asset
+	return nil
+}
+
+// SetClosingPrices ...
+func (plugin *Webhook) SetClosingPrices(prices []float64) error {
+	return nil
+}
+
+// SetCurrentPrice ...
+func (plugin *Webhook) SetCurrentPrice(price float64) error {
+	return nil
+}
+
+// SetOHLC ...
+func (plugin *Webhook) SetOHLC(candles []OHLC) error {
+	return nil
+}
+
+// Emit returns the signal of the latest alert received for the pair of the asset, or SignalWait if there is none.
+func (plugin *Webhook) Emit() (SIGNAL, error) {
+	if plugin.asset == "" {
+		return SignalWait, nil
+	}
+	pair := plugin.asset + cfg().CurrencyCode
+	return takeAlert(pair, time.Duration(cfg().Webhook.Expiry)*time.Minute), nil
+}
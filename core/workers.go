@@ -0,0 +1,178 @@
+package core
+
+/* This file is part of Leprechaun.
+*  @author: Michael Lormann
+*  `workers.go` supervises the goroutines that trade each asset. Every client is traded in rounds of
+*  its own, so a slow request for one asset does not hold back the others. The first goroutine to fail
+*  stops all of them, as an errgroup would, and each goroutine can be stopped on its own when its asset
+*  is no longer traded. The requests of all the goroutines share the rate limiter in `scheduler.go`.
+ */
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// supervisionInterval is the time between the checks that are made for all assets together, e.g. of
+// the session's equity and the assets to trade.
+const supervisionInterval = time.Minute
+
+// clientGroup runs a goroutine for each traded client.
+type clientGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	err      error                         // First error returned by a goroutine.
+	workers  map[string]context.CancelFunc // Cancels the goroutine of each running asset.
+	finished map[string]bool               // Assets whose goroutine has finished its work.
+}
+
+func newClientGroup() *clientGroup {
+	c, cancel := context.WithCancel(context.Background())
+	return &clientGroup{ctx: c, cancel: cancel, workers: map[string]context.CancelFunc{}, finished: map[string]bool{}}
+}
+
+// start runs `work` for `asset` in a new goroutine, unless one is running or has finished. `work` is
+// given a context that is done when the asset or the whole group is stopped. A nil return marks the
+// asset's work finished, and any other error except the context's stops the group.
+func (g *clientGroup) start(asset string, work func(c context.Context) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, running := g.workers[asset]; running || g.finished[asset] || g.ctx.Err() != nil {
+		return
+	}
+	c, cancel := context.WithCancel(g.ctx)
+	g.workers[asset] = cancel
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		err := work(c)
+		cancel()
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		delete(g.workers, asset)
+		switch {
+		case err == nil:
+			g.finished[asset] = true
+		case err == context.Canceled:
+			// The asset or the group was stopped.
+		case g.err == nil:
+			g.err = err
+			g.cancel()
+		}
+	}()
+}
+
+// stop stops the goroutine of `asset`. The other assets are traded on.
+func (g *clientGroup) stop(asset string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if cancel, running := g.workers[asset]; running {
+		cancel()
+	}
+}
+
+// running returns the number of running goroutines.
+func (g *clientGroup) running() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.workers)
+}
+
+// done is closed when the group is stopped.
+func (g *clientGroup) done() <-chan struct{} {
+	return g.ctx.Done()
+}
+
+// wait stops the group, waits for every goroutine to return and returns the first error.
+func (g *clientGroup) wait() error {
+	g.cancel()
+	g.wg.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// failure returns the first error returned by a goroutine, or nil.
+func (g *clientGroup) failure() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// superviseClients starts a goroutine for each client whose asset is traded and stops the goroutines
+// of the assets removed from `config.AssetsToTrade`.
+func (bot *Bot) superviseClients(group *clientGroup) {
+	traded := map[string]bool{}
+	for _, asset := range cfg().AssetsToTrade {
+		traded[asset] = true
+	}
+	for i := range bot.clients {
+		// Each goroutine works on a copy of its client, as the clients may be moved when more are added.
+		cl := bot.clients[i]
+		if !traded[cl.asset] {
+			group.stop(cl.asset)
+			continue
+		}
+		group.start(cl.asset, func(c context.Context) error {
+			return bot.tradeClient(c, cl, group)
+		})
+	}
+	scheduler.setClients(group.running())
+}
+
+// waitSupervision waits for `supervisionInterval`, unless the group is stopped or the user stops the bot.
+func waitSupervision(group *clientGroup) error {
+	select {
+	case <-group.done():
+		return group.failure()
+	default:
+	}
+	err := snoozeFor(group.ctx, supervisionInterval)
+	if err == context.Canceled {
+		return group.failure()
+	}
+	return err
+}
+
+var (
+	// orderMu is held while an asset checks the limits on new positions and places its order.
+	orderMu sync.Mutex
+	// analysisMu is held for reading while an asset is analyzed, and for writing while the settings of the
+	// running bot are replaced. Assets analyzed by instances of their own are analyzed at the same time.
+	analysisMu sync.RWMutex
+	// sharedAnalysisMu is held while a plugin shared by every asset analyzes one of them.
+	sharedAnalysisMu sync.Mutex
+)
+
+// lockShared holds `sharedAnalysisMu` if `shared` is true, i.e. the plugin about to analyze an asset is
+// shared by every asset. The returned func releases it.
+func lockShared(shared bool) (unlock func()) {
+	if !shared {
+		return func() {}
+	}
+	sharedAnalysisMu.Lock()
+	return sharedAnalysisMu.Unlock
+}
+
+var (
+	smallUnitsMu sync.Mutex
+	// smallUnits holds the assets whose purchase unit can not buy the minimum order volume.
+	smallUnits = map[string]bool{}
+)
+
+// markPurchaseUnit records whether the purchase unit of `asset` is too small to trade, and reports
+// whether it is too small for all `clients` traded assets.
+func markPurchaseUnit(asset string, small bool, clients int) (all bool) {
+	smallUnitsMu.Lock()
+	defer smallUnitsMu.Unlock()
+	if small {
+		smallUnits[asset] = true
+	} else {
+		delete(smallUnits, asset)
+	}
+	return len(smallUnits) >= clients
+}
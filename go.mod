@@ -14,8 +14,11 @@ require (
 	github.com/ghodss/yaml v1.0.0 // indirect
 	github.com/jrick/logrotate v1.0.0
 	github.com/kr/pretty v0.1.0 // indirect
+	github.com/lib/pq v1.9.0
 	github.com/luno/luno-go v0.0.15
 	github.com/mattn/go-sqlite3 v1.14.4
+	go.etcd.io/bbolt v1.3.5
+	go.starlark.net v0.0.0-20200306205701-8dd3e2ee1dd5
 	golang.org/x/exp v0.0.0-20200924195034-c827fd4f18b9
 	golang.org/x/sys v0.0.0-20200923182605-d9f96fdee20d // indirect
 	golang.org/x/text v0.3.2 // indirect
@@ -0,0 +1,89 @@
+package indicators
+
+import (
+	"fmt"
+	"math"
+)
+
+// Candle holds the prices and traded volume of one period of a price chart.
+type Candle struct {
+	Open, High, Low, Close float64
+	Volume                 float64
+}
+
+// BodyTop returns the higher of the open and close prices.
+func (candle Candle) BodyTop() float64 {
+	return math.Max(candle.Open, candle.Close)
+}
+
+// BodyBottom returns the lower of the open and close prices.
+func (candle Candle) BodyBottom() float64 {
+	return math.Min(candle.Open, candle.Close)
+}
+
+// Body returns the size of the candle's real body.
+func (candle Candle) Body() float64 {
+	return math.Abs(candle.Close - candle.Open)
+}
+
+// BodyMiddle returns the price halfway through the candle's real body.
+func (candle Candle) BodyMiddle() float64 {
+	return (candle.Open + candle.Close) / 2
+}
+
+// Span returns the candle's range, from its low to its high.
+func (candle Candle) Span() float64 {
+	return candle.High - candle.Low
+}
+
+// UpperShadow returns the length of the wick above the real body.
+func (candle Candle) UpperShadow() float64 {
+	return candle.High - candle.BodyTop()
+}
+
+// LowerShadow returns the length of the wick below the real body.
+func (candle Candle) LowerShadow() float64 {
+	return candle.BodyBottom() - candle.Low
+}
+
+// TypicalPrice returns the average of the candle's high, low and close.
+func (candle Candle) TypicalPrice() float64 {
+	return (candle.High + candle.Low + candle.Close) / 3
+}
+
+// TrueRange returns the largest of the candle's range and its distance from `previousClose`, the close
+// of the candle before it.
+func (candle Candle) TrueRange(previousClose float64) float64 {
+	return math.Max(candle.Span(), math.Max(math.Abs(candle.High-previousClose), math.Abs(candle.Low-previousClose)))
+}
+
+// ATR returns the Average True Range of the candles over `period` candles, using Wilder's smoothing.
+// The first candle only provides the close the second one's true range is measured from.
+func ATR(candles []Candle, period int) (float64, error) {
+	if period <= 0 || len(candles) < period+1 {
+		return 0, fmt.Errorf("%w (%d candles, the ATR needs %d)", ErrNotEnoughPrices, len(candles), period+1)
+	}
+	atr := 0.0
+	for i := 1; i <= period; i++ {
+		atr += candles[i].TrueRange(candles[i-1].Close)
+	}
+	atr /= float64(period)
+	for i := period + 1; i < len(candles); i++ {
+		atr = (atr*float64(period-1) + candles[i].TrueRange(candles[i-1].Close)) / float64(period)
+	}
+	return atr, nil
+}
+
+// VWAP calculates the volume weighted average price of the candles. Each candle is priced at its typical
+// price and weighted by the volume traded in it.
+func VWAP(candles []Candle) (float64, error) {
+	var value, volume float64
+	for _, candle := range candles {
+		value += candle.TypicalPrice() * candle.Volume
+		volume += candle.Volume
+	}
+	if volume <= 0 {
+		return 0, fmt.Errorf("%w (no volume was traded in %d candles)", ErrNotEnoughPrices, len(candles))
+	}
+	return value / volume, nil
+}
@@ -0,0 +1,77 @@
+package indicators
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCandleShape(t *testing.T) {
+	candle := Candle{Open: 10, High: 15, Low: 5, Close: 12}
+	for _, test := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"BodyTop", candle.BodyTop(), 12},
+		{"BodyBottom", candle.BodyBottom(), 10},
+		{"Body", candle.Body(), 2},
+		{"BodyMiddle", candle.BodyMiddle(), 11},
+		{"Span", candle.Span(), 10},
+		{"UpperShadow", candle.UpperShadow(), 3},
+		{"LowerShadow", candle.LowerShadow(), 5},
+		{"TypicalPrice", candle.TypicalPrice(), 32.0 / 3},
+		{"TrueRange after a gap", candle.TrueRange(20), 15},
+		{"TrueRange", candle.TrueRange(11), 10},
+	} {
+		if !near(test.got, test.want) {
+			t.Errorf("%s() = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestATR(t *testing.T) {
+	candles := []Candle{{Close: 10}, {High: 12, Low: 9, Close: 11}, {High: 13, Low: 11, Close: 12}, {High: 16, Low: 12, Close: 15}}
+	for _, test := range []struct {
+		name   string
+		period int
+		want   float64
+		err    error
+	}{
+		{"smoothed", 2, 3.25, nil},
+		{"every candle", 3, 3, nil},
+		{"too few candles", 4, 0, ErrNotEnoughPrices},
+		{"no period", 0, 0, ErrNotEnoughPrices},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ATR(candles, test.period)
+			if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("got the error %v, want %v", err, test.err)
+			}
+			if !near(got, test.want) {
+				t.Errorf("ATR() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		candles []Candle
+		want    float64
+		err     error
+	}{
+		{"weighted", []Candle{{High: 10, Low: 10, Close: 10, Volume: 1}, {High: 20, Low: 20, Close: 20, Volume: 3}}, 17.5, nil},
+		{"no volume", []Candle{{High: 10, Low: 10, Close: 10}}, 0, ErrNotEnoughPrices},
+		{"no candles", nil, 0, ErrNotEnoughPrices},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := VWAP(test.candles)
+			if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("got the error %v, want %v", err, test.err)
+			}
+			if !near(got, test.want) {
+				t.Errorf("VWAP() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Package indicators holds the technical indicators used by Leprechaun's analysis plugins: moving averages,
+// the Relative Strength Index, the Average True Range, Bollinger Bands, the volume weighted average price
+// and the measurements of a candle's shape. It does not depend on the rest of Leprechaun, so third-party
+// plugins can use it on their own price data.
+//
+// Price series are ordered from the oldest price to the latest. Indicators that need more prices than
+// they are given return an error wrapping `ErrNotEnoughPrices`.
+package indicators
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrNotEnoughPrices is returned when there are too few prices to compute an indicator.
+var ErrNotEnoughPrices = errors.New("not enough prices to compute the indicator")
+
+// SMA returns the simple moving average of the latest `window` prices.
+func SMA(prices []float64, window int) (float64, error) {
+	if window <= 0 || len(prices) < window {
+		return 0, fmt.Errorf("%w (%d prices, the average needs %d)", ErrNotEnoughPrices, len(prices), window)
+	}
+	sum := 0.0
+	for _, price := range prices[len(prices)-window:] {
+		sum += price
+	}
+	return sum / float64(window), nil
+}
+
+// EMA returns the exponential moving average of the prices over `period` prices. The average starts from
+// the simple moving average of the first `period` prices, and every later price is weighted by
+// 2 / (period + 1).
+func EMA(prices []float64, period int) (float64, error) {
+	if period <= 0 || len(prices) < period {
+		return 0, fmt.Errorf("%w (%d prices, the average needs %d)", ErrNotEnoughPrices, len(prices), period)
+	}
+	ema, _ := SMA(prices[:period], period)
+	weight := 2 / float64(period+1)
+	for _, price := range prices[period:] {
+		ema += (price - ema) * weight
+	}
+	return ema, nil
+}
+
+// RSI computes the Relative Strength Index of the closing prices over `period` price changes. The
+// average gains and losses are smoothed with Wilder's method, so every price contributes.
+// The result ranges from 0 to 100.
+func RSI(prices []float64, period int) (float64, error) {
+	if period <= 0 || len(prices) <= period {
+		return 0, fmt.Errorf("%w (%d prices, the RSI needs more than %d)", ErrNotEnoughPrices, len(prices), period)
+	}
+	var avgGain, avgLoss float64
+	for i := 1; i <= period; i++ {
+		if change := prices[i] - prices[i-1]; change > 0 {
+			avgGain += change
+		} else {
+			avgLoss -= change
+		}
+	}
+	avgGain /= float64(period)
+	avgLoss /= float64(period)
+	for i := period + 1; i < len(prices); i++ {
+		gain, loss := 0.0, 0.0
+		if change := prices[i] - prices[i-1]; change > 0 {
+			gain = change
+		} else {
+			loss = -change
+		}
+		avgGain = (avgGain*float64(period-1) + gain) / float64(period)
+		avgLoss = (avgLoss*float64(period-1) + loss) / float64(period)
+	}
+	if avgLoss == 0 {
+		if avgGain == 0 {
+			// The price has not moved at all.
+			return 50, nil
+		}
+		return 100, nil
+	}
+	return 100 - 100/(1+avgGain/avgLoss), nil
+}
+
+// BollingerBands are the bands drawn a number of standard deviations above and below the simple moving
+// average of a price series.
+type BollingerBands struct {
+	Lower, Middle, Upper float64
+}
+
+// Width returns the distance between the upper and lower bands as a fraction of the middle band.
+func (bands BollingerBands) Width() float64 {
+	if bands.Middle == 0 {
+		return 0
+	}
+	return (bands.Upper - bands.Lower) / bands.Middle
+}
+
+// Bollinger calculates the Bollinger Bands of the latest `window` prices. The bands are `deviations`
+// standard deviations away from the simple moving average of the window.
+func Bollinger(prices []float64, window int, deviations float64) (bands BollingerBands, err error) {
+	if window <= 1 || len(prices) < window {
+		return bands, fmt.Errorf("%w (%d prices, the bands need %d)", ErrNotEnoughPrices, len(prices), window)
+	}
+	bands.Middle, _ = SMA(prices, window)
+	variance := 0.0
+	for _, price := range prices[len(prices)-window:] {
+		variance += (price - bands.Middle) * (price - bands.Middle)
+	}
+	spread := deviations * math.Sqrt(variance/float64(window))
+	bands.Lower, bands.Upper = bands.Middle-spread, bands.Middle+spread
+	return
+}
@@ -0,0 +1,93 @@
+package indicators
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// near reports whether `got` is `want`, give or take rounding.
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+func TestMovingAverages(t *testing.T) {
+	prices := []float64{1, 2, 3, 4, 5}
+	for _, test := range []struct {
+		name    string
+		average func([]float64, int) (float64, error)
+		prices  []float64
+		window  int
+		want    float64
+		err     error
+	}{
+		{"SMA of the latest prices", SMA, prices, 3, 4, nil},
+		{"SMA of every price", SMA, prices, 5, 3, nil},
+		{"SMA of too few prices", SMA, prices, 6, 0, ErrNotEnoughPrices},
+		{"SMA without a window", SMA, prices, 0, 0, ErrNotEnoughPrices},
+		{"EMA", EMA, prices, 3, 4, nil},
+		{"EMA of every price", EMA, prices, 5, 3, nil},
+		{"EMA of a flat price", EMA, []float64{2, 2, 2, 2}, 2, 2, nil},
+		{"EMA of too few prices", EMA, prices[:2], 3, 0, ErrNotEnoughPrices},
+		{"EMA without a period", EMA, prices, -1, 0, ErrNotEnoughPrices},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.average(test.prices, test.window)
+			if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("got the error %v, want %v", err, test.err)
+			}
+			if !near(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRSI(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		prices []float64
+		period int
+		want   float64
+		err    error
+	}{
+		{"rising", []float64{1, 2, 3, 4, 5}, 3, 100, nil},
+		{"falling", []float64{5, 4, 3, 2, 1}, 3, 0, nil},
+		{"flat", []float64{3, 3, 3, 3}, 2, 50, nil},
+		{"smoothed", []float64{1, 2, 1, 2, 1}, 2, 37.5, nil},
+		{"as many prices as the period", []float64{1, 2, 3}, 3, 0, ErrNotEnoughPrices},
+		{"no period", []float64{1, 2, 3}, 0, 0, ErrNotEnoughPrices},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := RSI(test.prices, test.period)
+			if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("got the error %v, want %v", err, test.err)
+			}
+			if !near(got, test.want) {
+				t.Errorf("RSI() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	prices := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	bands, err := Bollinger(prices, len(prices), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(bands.Lower, 1) || !near(bands.Middle, 5) || !near(bands.Upper, 9) {
+		t.Errorf("Bollinger() = %+v, want {Lower:1 Middle:5 Upper:9}", bands)
+	}
+	if !near(bands.Width(), 1.6) {
+		t.Errorf("Width() = %v, want 1.6", bands.Width())
+	}
+	if width := (BollingerBands{}).Width(); width != 0 {
+		t.Errorf("the width of bands around 0 is %v, want 0", width)
+	}
+	for _, window := range []int{1, len(prices) + 1} {
+		if _, err = Bollinger(prices, window, 2); !errors.Is(err, ErrNotEnoughPrices) {
+			t.Errorf("Bollinger() with a window of %d returned the error %v, want ErrNotEnoughPrices", window, err)
+		}
+	}
+}
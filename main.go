@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"runtime"
 
@@ -68,6 +69,12 @@ func newApp(test bool) *App {
 // TODO:: Update android support library (javac, etc) to use notify and other android extensions
 
 func main() {
+	observe := flag.String("observe", "", "open the state file of a bot running elsewhere in read-only observer mode")
+	healthAddr := flag.String("health-addr", "", "serve the /healthz and /readyz endpoints on this address, e.g. 127.0.0.1:8089")
+	eventsAddr := flag.String("events-addr", "", "send a JSON event for each asset in each trading round to this socket, e.g. tcp://127.0.0.1:5170")
+	verifyLedger := flag.Bool("verify-ledger", false, "check the ledger for inconsistent records, print what is found and exit")
+	repairLedger := flag.Bool("repair", false, "with -verify-ledger, repair the records that are found")
+	flag.Parse()
 	myApp := newApp(true)
 
 	d, err := app.DataDir()
@@ -87,15 +94,39 @@ func main() {
 
 	// load user settings from file
 	myApp.LoadConfig()
+	if *healthAddr != "" {
+		myApp.config.HealthAddress = *healthAddr
+	}
+	if *eventsAddr != "" {
+		myApp.config.WriteRoundEvents, myApp.config.RoundEventsAddress = true, *eventsAddr
+	}
+	if *verifyLedger {
+		leprechaun.SetConfig(myApp.config)
+		problems, err := leprechaun.VerifyLedger(*repairLedger)
+		if err != nil {
+			log.Fatalf("Could not verify the ledger: %v", err)
+		}
+		fmt.Println(leprechaun.VerifyReport(problems))
+		return
+	}
+	myApp.LoadPlugins()
 
 	theme := myApp.Theme()
 	myApp.win = ui.CreateWindow(theme, myApp.config)
 	myApp.win.InitBackends(myApp.logBackends)
+	if *observe != "" {
+		myApp.win.Observe(*observe)
+	}
 
 	go func() {
-		if err := myApp.win.Loop(); err != nil {
-			// TODO (michael): Send shutdown signal
-			log.Fatal(err)
+		loopErr := myApp.win.Loop()
+		// Let the orders and ledger writes that are running finish before the logs and the ledger are closed.
+		if err := leprechaun.Shutdown(leprechaun.DefaultShutdownTimeout); err != nil {
+			log.Println(err)
+		}
+		myApp.CloseLogFiles()
+		if loopErr != nil {
+			log.Fatal(loopErr)
 		}
 		os.Exit(0)
 	}()
@@ -206,6 +237,17 @@ func (a *App) LoadConfig() {
 
 }
 
+// LoadPlugins registers the analysis plugins found in the plugins folder. Plugins that can not be
+// loaded are logged and skipped.
+func (a *App) LoadPlugins() {
+	for _, err := range leprechaun.PluginHandler.Discover(a.config.PluginDir()) {
+		if startupLog, ok := a.logBackends["startup"]; ok {
+			startupLog.Println(err)
+		}
+		log.Println(err)
+	}
+}
+
 // Errorf writes a formatted error message to the startup log file
 // and stderr.
 func (a *App) Errorf(format string, args ...interface{}) {
@@ -0,0 +1,46 @@
+package material
+
+import (
+	"fmt"
+
+	"gioui.org/layout"
+)
+
+var (
+	analysisPeriodField   *Editor
+	analysisIntervalField *Editor
+	analysisWindowHeader  *widgetHeader
+)
+
+// analysisWindowSetup creates the analysis period and interval fields from the saved settings.
+func (win *Window) analysisWindowSetup() {
+	analysisWindowHeader = win.newWidgetHeader("How much price data is analyzed and the length of each candle. Leave a field empty to use the analysis plugin's default.", "analysis window")
+	analysisPeriodField = win.newTextField("Analysis period (hours)", "Plugin default", formatOverride(int64(win.cfg.Trade.AnalysisPeriod)))
+	analysisIntervalField = win.newTextField("Interval between prices (minutes)", "Plugin default", formatOverride(int64(win.cfg.Trade.AnalysisInterval)))
+}
+
+// readAnalysisWindow returns the analysis period (in hours) and interval (in minutes) entered by the user.
+// Empty fields use the analysis plugin's defaults.
+func readAnalysisWindow() (period, interval int32, err error) {
+	hours, err := parseOverride(analysisPeriodField)
+	if err != nil {
+		return 0, 0, err
+	}
+	minutes, err := parseOverride(analysisIntervalField)
+	if err != nil {
+		return 0, 0, err
+	}
+	if hours > 0 && minutes > hours*60 {
+		return 0, 0, fmt.Errorf("the interval between prices can not be longer than the analysis period")
+	}
+	return int32(hours), int32(minutes), nil
+}
+
+// layoutAnalysisWindow lays out the analysis period and interval fields.
+func (win *Window) layoutAnalysisWindow(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(analysisWindowHeader.Layout),
+		layout.Rigid(analysisPeriodField.Layout),
+		layout.Rigid(analysisIntervalField.Layout),
+	)
+}
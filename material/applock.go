@@ -0,0 +1,154 @@
+package material
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// The app lock hides the UI behind a PIN. Biometric unlocking is not available as the Android
+// build has no bindings for the platform's biometric APIs.
+var (
+	appLocked      bool
+	unlockPINInput = &widget.Editor{SingleLine: true, Submit: true, Mask: '•'}
+	unlockBtn      = new(widget.Clickable)
+	unlockError    string
+	failedUnlocks  int
+	unlockBlocked  time.Time // Unlocking is refused until this time after too many wrong PINs.
+
+	appLockSwitch  *widget.Bool
+	appLockPINEdit *Editor
+	appLockHeader  *widgetHeader
+	lockAppBtn     = new(widget.Clickable)
+)
+
+// maxFailedUnlocks is the number of wrong PINs after which unlocking is blocked for `unlockBlockTime`.
+const (
+	maxFailedUnlocks = 5
+	unlockBlockTime  = 30 * time.Second
+)
+
+// appLockSetup creates the app lock settings widgets from the saved settings.
+func (win *Window) appLockSetup() {
+	appLockSwitch = &widget.Bool{Value: win.cfg.AppLock.Enabled}
+	appLockPINEdit = win.newTextField("New PIN", "4 to 8 digits. Leave empty to keep the current PIN.", "")
+	appLockPINEdit.Editor.Mask = '•'
+	appLockHeader = win.newWidgetHeader("Lock Leprechaun with a PIN when it starts or goes to the background. Trading is not interrupted.", "app lock")
+}
+
+// readAppLock returns the app lock settings entered by the user.
+func readAppLock(saved leper.AppLockSettings) (settings leper.AppLockSettings, err error) {
+	settings = saved
+	settings.Enabled = appLockSwitch.Value
+	if pin := strings.TrimSpace(appLockPINEdit.Editor.Text()); pin != "" {
+		if err = settings.SetPIN(pin); err != nil {
+			return saved, err
+		}
+		appLockPINEdit.Editor.SetText("")
+	}
+	if settings.Enabled && !settings.HasPIN() {
+		return saved, fmt.Errorf("set a PIN to lock the app")
+	}
+	return settings, nil
+}
+
+// lockApp locks the UI if the app lock is enabled.
+func (win *Window) lockApp() {
+	if win.cfg.AppLock.Enabled && win.cfg.AppLock.HasPIN() {
+		appLocked = true
+		unlockPINInput.SetText("")
+		unlockError = ""
+	}
+}
+
+// tryUnlock unlocks the UI if the entered PIN is correct.
+func (win *Window) tryUnlock() {
+	if time.Now().Before(unlockBlocked) {
+		unlockError = fmt.Sprintf("Too many wrong PINs. Try again in %v.", time.Until(unlockBlocked).Round(time.Second))
+		return
+	}
+	pin := unlockPINInput.Text()
+	unlockPINInput.SetText("")
+	if win.cfg.AppLock.CheckPIN(pin) {
+		appLocked, unlockError, failedUnlocks = false, "", 0
+		return
+	}
+	failedUnlocks++
+	unlockError = "Wrong PIN."
+	if failedUnlocks >= maxFailedUnlocks {
+		failedUnlocks = 0
+		unlockBlocked = time.Now().Add(unlockBlockTime)
+		unlockError = fmt.Sprintf("Too many wrong PINs. Try again in %v.", unlockBlockTime)
+	}
+}
+
+// layoutLockScreen lays out the lock screen. Nothing else is laid out while the app is locked.
+func (win *Window) layoutLockScreen(gtx layout.Context) layout.Dimensions {
+	for _, e := range unlockPINInput.Events() {
+		if _, ok := e.(widget.SubmitEvent); ok {
+			win.tryUnlock()
+		}
+	}
+	for unlockBtn.Clicked() {
+		win.tryUnlock()
+	}
+	return layout.Center.Layout(gtx, func(gtx C) D {
+		gtx.Constraints.Max.X = gtx.Px(unit.Dp(300))
+		return layout.Flex{Axis: layout.Vertical, Alignment: layout.Middle}.Layout(gtx,
+			layout.Rigid(func(gtx C) D {
+				lbl := material.H4(win.theme, "Leprechaun is locked")
+				lbl.Alignment = text.Middle
+				return pad.Layout(gtx, lbl.Layout)
+			}),
+			layout.Rigid(func(gtx C) D {
+				border := widget.Border{Color: win.theme.Color.Hint, CornerRadius: unit.Dp(5), Width: unit.Px(1)}
+				return pad.Layout(gtx, func(gtx C) D {
+					return border.Layout(gtx, func(gtx C) D {
+						return pad.Layout(gtx, material.Editor(win.theme, unlockPINInput, "PIN").Layout)
+					})
+				})
+			}),
+			layout.Rigid(func(gtx C) D {
+				if unlockError == "" {
+					return D{}
+				}
+				return win.errorLabel(unlockError).Layout(gtx)
+			}),
+			layout.Rigid(func(gtx C) D {
+				return pad.Layout(gtx, material.Button(win.theme, unlockBtn, "Unlock").Layout)
+			}),
+		)
+	})
+}
+
+// layoutAppLockSettings lays out the app lock switch, the PIN field and a button to lock the app now.
+func (win *Window) layoutAppLockSettings(gtx C) D {
+	for lockAppBtn.Clicked() {
+		win.lockApp()
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, appLockSwitch).Layout)
+				}),
+				layout.Rigid(appLockHeader.Layout),
+			)
+		}),
+		layout.Rigid(appLockPINEdit.Layout),
+		layout.Rigid(func(gtx C) D {
+			if !win.cfg.AppLock.Enabled || !win.cfg.AppLock.HasPIN() {
+				return D{}
+			}
+			return pad.Layout(gtx, material.Button(win.theme, lockAppBtn, "Lock now").Layout)
+		}),
+	)
+}
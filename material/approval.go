@@ -0,0 +1,82 @@
+package material
+
+import (
+	"fmt"
+	"time"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	// pendingProposal is the trade waiting for the user's approval, if any.
+	pendingProposal *leper.TradeProposal
+	approveTradeBtn = new(widget.Clickable)
+	rejectTradeBtn  = new(widget.Clickable)
+)
+
+// handleTradeProposal shows a trade proposal from the bot on the main page.
+func (win *Window) handleTradeProposal(proposal *leper.TradeProposal) {
+	if pendingProposal != nil {
+		// The bot only waits for one proposal at a time.
+		pendingProposal.Reject()
+	}
+	pendingProposal = proposal
+	win.env.redraw()
+	// Clear the proposal from the screen once it expires.
+	time.AfterFunc(time.Until(proposal.Expires), win.env.redraw)
+}
+
+func (win *Window) handleApprovalEvents() {
+	for approveTradeBtn.Clicked() {
+		if pendingProposal != nil {
+			pendingProposal.Approve()
+			pendingProposal = nil
+		}
+	}
+	for rejectTradeBtn.Clicked() {
+		if pendingProposal != nil {
+			pendingProposal.Reject()
+			pendingProposal = nil
+		}
+	}
+	if pendingProposal != nil && (pendingProposal.Expired() || win.botState == Stopped) {
+		pendingProposal = nil
+	}
+}
+
+// layoutTradeProposal lays out the pending trade proposal with buttons to approve or reject it.
+func (win *Window) layoutTradeProposal(gtx layout.Context) layout.Dimensions {
+	win.handleApprovalEvents()
+	if pendingProposal == nil {
+		return layout.Dimensions{}
+	}
+	p := pendingProposal
+	txt := fmt.Sprintf("Leprechaun wants to %v %.6f %s at %s %s (%s %.2f). Expires in %v.",
+		p.Signal, p.Volume, p.Asset, win.cfg.CurrencyCode, leper.AssetPairInfo(p.Asset).FormatPrice(p.Price),
+		win.cfg.CurrencyCode, p.Cost, time.Until(p.Expires).Round(time.Second))
+	border := widget.Border{Color: ColorBlue, CornerRadius: unit.Dp(5), Width: unit.Px(2)}
+	return pad.Layout(gtx, func(gtx C) D {
+		return border.Layout(gtx, func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+					layout.Rigid(material.Body1(win.theme, txt).Layout),
+					layout.Rigid(func(gtx C) D {
+						return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceEvenly}.Layout(gtx,
+							layout.Rigid(material.Button(win.theme, approveTradeBtn, "Approve").Layout),
+							layout.Rigid(func(gtx C) D {
+								btn := material.Button(win.theme, rejectTradeBtn, "Reject")
+								btn.Background = ColorDanger
+								return btn.Layout(gtx)
+							}),
+						)
+					}),
+				)
+			})
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package material
+
+import (
+	"fmt"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// issueRow is a record flagged by the ledger audit in the ledger issues list of the stats page.
+type issueRow struct {
+	issue      leper.LedgerIssue
+	repairBtn  *widget.Clickable
+	archiveBtn *widget.Clickable
+}
+
+var (
+	issuesCpbl       *Collapsible
+	issueRows        []issueRow
+	issuesList       = &layout.List{Axis: layout.Vertical}
+	issuesRefreshBtn = new(widget.Clickable)
+	issuesStatus     string
+)
+
+// issuesSetup creates the widgets of the ledger issues list of the stats page.
+func (win *Window) issuesSetup() {
+	issuesCpbl = win.newCollapsible()
+	win.loadLedgerIssues()
+}
+
+// loadLedgerIssues lists the records the latest audit of the ledger flagged.
+func (win *Window) loadLedgerIssues() {
+	issues, err := leper.LedgerIssues()
+	if err != nil {
+		issuesStatus = fmt.Sprintf("Could not read the ledger issues. Reason: %v", err)
+		return
+	}
+	issueRows = []issueRow{}
+	for _, issue := range issues {
+		issueRows = append(issueRows, issueRow{issue: issue, repairBtn: new(widget.Clickable), archiveBtn: new(widget.Clickable)})
+	}
+}
+
+// resolveIssue repairs or archives the record of `issue` and reloads the lists it is shown in.
+func (win *Window) resolveIssue(issue leper.LedgerIssue, archive bool) {
+	var err error
+	if archive {
+		err = leper.ArchiveRecord(issue.RecordID)
+	} else {
+		err = leper.RepairRecord(issue.RecordID)
+	}
+	if err != nil {
+		issuesStatus = fmt.Sprintf("Could not fix record %s. Reason: %v", issue.RecordID, err)
+		return
+	}
+	if archive {
+		issuesStatus = fmt.Sprintf("Archived record %s.", issue.RecordID)
+	} else {
+		issuesStatus = fmt.Sprintf("Repaired record %s.", issue.RecordID)
+	}
+	win.loadLedgerIssues()
+	win.loadPositions()
+	win.loadStats()
+}
+
+// layoutLedgerIssues lays out the records that do not match the exchange, each with buttons that repair
+// it to match its order or archive it.
+func (win *Window) layoutLedgerIssues(gtx C) D {
+	for issuesRefreshBtn.Clicked() {
+		issuesStatus = ""
+		win.loadLedgerIssues()
+	}
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, material.Button(win.theme, issuesRefreshBtn, "Refresh").Layout)
+		}),
+	}
+	if issuesStatus != "" {
+		children = append(children, layout.Rigid(material.Caption(win.theme, issuesStatus).Layout))
+	}
+	children = append(children, layout.Rigid(func(gtx C) D {
+		if len(issueRows) == 0 {
+			return material.Label(win.theme, unit.Dp(11), "The ledger matches the exchange.").Layout(gtx)
+		}
+		gtx.Constraints.Max.Y = gtx.Constraints.Max.X / 2
+		return issuesList.Layout(gtx, len(issueRows), func(gtx C, i int) D {
+			row := issueRows[i]
+			for row.repairBtn.Clicked() {
+				win.resolveIssue(row.issue, false)
+			}
+			for row.archiveBtn.Clicked() {
+				win.resolveIssue(row.issue, true)
+			}
+			buttons := []layout.FlexChild{
+				layout.Flexed(1, material.Body2(win.theme, fmt.Sprintf("%s %s record %s: %s.", row.issue.Kind,
+					row.issue.Asset, row.issue.RecordID, row.issue.Message)).Layout),
+			}
+			if row.issue.Kind != leper.IssueMissing {
+				buttons = append(buttons, layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Button(win.theme, row.repairBtn, "Repair").Layout)
+				}))
+			}
+			buttons = append(buttons, layout.Rigid(func(gtx C) D {
+				btn := material.Button(win.theme, row.archiveBtn, "Archive")
+				btn.Background = ColorDanger
+				return pad.Layout(gtx, btn.Layout)
+			}))
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx, buttons...)
+		})
+	}))
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+}
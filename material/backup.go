@@ -0,0 +1,184 @@
+package material
+
+import (
+	"fmt"
+	"strings"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// backupRow is a backup in the backup list of the stats page.
+type backupRow struct {
+	backup leper.Backup
+	btn    *widget.Clickable // Asks to restore the backup.
+}
+
+var (
+	backupSwitch         *widget.Bool
+	backupHeader         *widgetHeader
+	backupIntervalFloat  *widget.Float
+	backupIntervalHeader *widgetHeader
+	backupKeepFloat      *widget.Float
+	backupKeepHeader     *widgetHeader
+
+	backupCpbl       *Collapsible
+	backupRows       []backupRow
+	backupList       = &layout.List{Axis: layout.Vertical}
+	backupNowBtn     = new(widget.Clickable)
+	backupConfirmBtn = new(widget.Clickable)
+	backupCancelBtn  = new(widget.Clickable)
+	backupStatus     string
+	pendingRestore   string // The name of the backup the user is asked to confirm restoring. Empty when none is.
+)
+
+// backupSettingsSetup creates the widgets of the scheduled backups from the saved settings.
+func (win *Window) backupSettingsSetup() {
+	backupSwitch = &widget.Bool{Value: win.cfg.Backup.Enabled}
+	backupHeader = win.newWidgetHeader("Back up the ledger, the trade journal and your stats while the bot runs, "+
+		"so your open positions are not lost if the database is damaged.", "backups")
+	backupIntervalFloat = &widget.Float{Value: float32(win.cfg.Backup.Interval)}
+	backupIntervalHeader = win.newWidgetHeader("Hours between backups:", "backup interval")
+	backupKeepFloat = &widget.Float{Value: float32(win.cfg.Backup.Keep)}
+	backupKeepHeader = win.newWidgetHeader("Number of backups to keep. The oldest are deleted:", "backups kept")
+}
+
+// layoutBackupSettings lays out the schedule of the backups.
+func (win *Window) layoutBackupSettings(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, backupSwitch).Layout)
+				}),
+				layout.Rigid(backupHeader.Layout),
+			)
+		}),
+		layout.Rigid(win.sliderSetting(backupIntervalHeader, backupIntervalFloat, 1, 168, "%.0f hours")),
+		layout.Rigid(win.sliderSetting(backupKeepHeader, backupKeepFloat, 1, 30, "%.0f")),
+	)
+}
+
+// readBackupSettings returns the schedule of the backups set on the settings page.
+func readBackupSettings() leper.BackupSettings {
+	return leper.BackupSettings{
+		Enabled:  backupSwitch.Value,
+		Interval: int32(backupIntervalFloat.Value),
+		Keep:     int32(backupKeepFloat.Value),
+	}
+}
+
+// backupSetup creates the widgets of the backup list of the stats page.
+func (win *Window) backupSetup() {
+	backupCpbl = win.newCollapsible()
+	win.loadBackups()
+}
+
+// loadBackups lists the backups, from the latest.
+func (win *Window) loadBackups() {
+	backups, err := leper.Backups()
+	if err != nil {
+		backupStatus = fmt.Sprintf("Could not list the backups. Reason: %v", err)
+		return
+	}
+	backupRows = []backupRow{}
+	for _, backup := range backups {
+		backupRows = append(backupRows, backupRow{backup: backup, btn: new(widget.Clickable)})
+	}
+}
+
+// restoreBackup replaces the ledger and stats with those of the backup `name` and reloads the stats page.
+func (win *Window) restoreBackup(name string) {
+	if win.botState != Stopped {
+		backupStatus = "Stop the bot before restoring a backup."
+		return
+	}
+	undo, err := leper.RestoreBackup(name)
+	if err != nil {
+		backupStatus = fmt.Sprintf("Could not restore the backup. Reason: %v", err)
+		return
+	}
+	backupStatus = fmt.Sprintf("Restored the backup of %s.", name)
+	if undo.Name != "" {
+		backupStatus += fmt.Sprintf(" The ledger you had before was backed up as %s.", undo.Name)
+	}
+	win.loadBackups()
+	win.loadPurchasesList()
+	win.loadSalesList()
+	win.loadPositions()
+	win.loadStats()
+	win.loadJournal()
+	win.loadProfitByPeriod()
+	win.loadEquityCurve()
+	win.loadLedgerIssues()
+}
+
+// layoutBackups lays out the button that backs up the ledger now and the backups that can be restored.
+func (win *Window) layoutBackups(gtx C) D {
+	for backupNowBtn.Clicked() {
+		backup, err := leper.BackupLedger()
+		if err != nil {
+			backupStatus = fmt.Sprintf("Could not back up the ledger. Reason: %v", err)
+			break
+		}
+		backupStatus = "Backed up to " + backup.Path
+		win.loadBackups()
+	}
+	for backupConfirmBtn.Clicked() {
+		win.restoreBackup(pendingRestore)
+		pendingRestore = ""
+	}
+	for backupCancelBtn.Clicked() {
+		pendingRestore = ""
+	}
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, material.Button(win.theme, backupNowBtn, "Backup now").Layout)
+		}),
+	}
+	if pendingRestore != "" {
+		children = append(children,
+			layout.Rigid(material.Body1(win.theme, fmt.Sprintf("Restore the backup of %s? It replaces your ledger, "+
+				"trade journal and stats. They are backed up first, so this can be undone.", pendingRestore)).Layout),
+			layout.Rigid(func(gtx C) D {
+				return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+					layout.Rigid(func(gtx C) D {
+						return pad.Layout(gtx, material.Button(win.theme, backupCancelBtn, "Cancel").Layout)
+					}),
+					layout.Rigid(func(gtx C) D {
+						btn := material.Button(win.theme, backupConfirmBtn, "Restore")
+						btn.Background = ColorDanger
+						return pad.Layout(gtx, btn.Layout)
+					}),
+				)
+			}),
+		)
+	}
+	if backupStatus != "" {
+		children = append(children, layout.Rigid(material.Caption(win.theme, backupStatus).Layout))
+	}
+	children = append(children, layout.Rigid(func(gtx C) D {
+		if len(backupRows) == 0 {
+			return material.Label(win.theme, unit.Dp(11), "No backups yet.").Layout(gtx)
+		}
+		gtx.Constraints.Max.Y = gtx.Constraints.Max.X / 2
+		return backupList.Layout(gtx, len(backupRows), func(gtx C, i int) D {
+			row := backupRows[i]
+			for row.btn.Clicked() {
+				pendingRestore = row.backup.Name
+			}
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(1, material.Body2(win.theme, fmt.Sprintf("%s  (%s)",
+					row.backup.Time.Format("2006-01-02 15:04"), strings.Join(row.backup.Files, ", "))).Layout),
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Button(win.theme, row.btn, "Restore").Layout)
+				}),
+			)
+		})
+	}))
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+}
@@ -0,0 +1,98 @@
+package material
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+)
+
+// assetCapFields holds the widgets used to edit the exposure cap of a single asset. Empty fields are not capped.
+type assetCapFields struct {
+	asset   string
+	records *Editor
+	fiat    *Editor
+}
+
+var (
+	exposureCapFields  []*assetCapFields
+	exposureCapsList   = &layout.List{Axis: layout.Vertical}
+	exposureCapsHeader *widgetHeader
+	// maxOpenPositionsField caps the positions open across all currencies.
+	maxOpenPositionsField *Editor
+)
+
+// exposureCapsSetup creates the exposure cap fields of each supported asset from the saved settings.
+func (win *Window) exposureCapsSetup() {
+	exposureCapsHeader = win.newWidgetHeader("Limit the open positions of individual currencies. Leave a field empty for no limit.", "exposure caps")
+	maxOpenPositionsField = win.newTextField("Maximum open positions across all currencies", "No limit",
+		formatOverride(int64(win.cfg.Trade.MaxOpenPositions)))
+	exposureCapFields = make([]*assetCapFields, len(win.cfg.SupportedAssets))
+	for ix, assetCode := range win.cfg.SupportedAssets {
+		saved := win.cfg.Trade.ExposureCaps[assetCode]
+		fiat := ""
+		if saved.MaxLockedFiat > 0 {
+			fiat = strconv.FormatFloat(saved.MaxLockedFiat, 'f', -1, 64)
+		}
+		exposureCapFields[ix] = &assetCapFields{
+			asset:   assetCode,
+			records: win.newTextField("Maximum open positions", "No limit", formatOverride(int64(saved.MaxOpenRecords))),
+			fiat:    win.newTextField(fmt.Sprintf("Maximum %s locked in open positions", win.cfg.CurrencyCode), "No limit", fiat),
+		}
+	}
+}
+
+// readExposureCaps returns the exposure caps entered by the user, keyed by asset code.
+func readExposureCaps() (map[string]leper.ExposureCap, error) {
+	caps := map[string]leper.ExposureCap{}
+	for _, fields := range exposureCapFields {
+		records, err := parseOverride(fields.records)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", assetNames[fields.asset], err)
+		}
+		limit := leper.ExposureCap{MaxOpenRecords: int(records)}
+		if txt := strings.TrimSpace(fields.fiat.Editor.Text()); txt != "" {
+			if limit.MaxLockedFiat, err = strconv.ParseFloat(txt, 64); err != nil {
+				return nil, fmt.Errorf("%s: invalid value for the locked amount", assetNames[fields.asset])
+			}
+		}
+		if err = limit.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", assetNames[fields.asset], err)
+		}
+		if !limit.IsZero() {
+			caps[fields.asset] = limit
+		}
+	}
+	return caps, nil
+}
+
+// readMaxOpenPositions returns the limit on the positions open across all currencies entered by the user.
+func readMaxOpenPositions() (int, error) {
+	limit, err := parseOverride(maxOpenPositionsField)
+	return int(limit), err
+}
+
+// layoutExposureCaps lays out the exposure cap fields of each supported asset.
+func (win *Window) layoutExposureCaps(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(exposureCapsHeader.Layout),
+		layout.Rigid(maxOpenPositionsField.Layout),
+		layout.Rigid(func(gtx C) D {
+			return exposureCapsList.Layout(gtx, len(exposureCapFields), func(gtx C, i int) D {
+				fields := exposureCapFields[i]
+				return layout.UniformInset(unit.Dp(5)).Layout(gtx, func(gtx C) D {
+					return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+						layout.Rigid(material.Body1(win.theme, assetNames[fields.asset]).Layout),
+						layout.Rigid(fields.records.Layout),
+						layout.Rigid(fields.fiat.Layout),
+					)
+				})
+			})
+		}),
+	)
+}
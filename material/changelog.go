@@ -0,0 +1,90 @@
+package material
+
+import (
+	"fmt"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	changelogList     = &layout.List{Axis: layout.Vertical}
+	acknowledgeBtn    = new(widget.Clickable)
+	changelogErrorTxt string
+)
+
+const changelogPendingText = `Leprechaun has been updated to v%s. Some changes affect how Leprechaun trades. Please read them carefully.
+
+The bot can not be started until you have acknowledged these changes.`
+
+func (win *Window) handleChangelogEvents() {
+	for acknowledgeBtn.Clicked() {
+		if err := win.cfg.AcknowledgeChangelog(); err != nil {
+			changelogErrorTxt = fmt.Sprintf("Could not save your acknowledgment. Reason: %v", err)
+			continue
+		}
+		changelogErrorTxt = ""
+	}
+}
+
+func (win *Window) layoutChangelogWindow(gtx layout.Context) layout.Dimensions {
+	win.handleChangelogEvents()
+	pending := win.cfg.ChangelogPending()
+	entries := leper.Changelog
+	if pending {
+		// Only show what is new since the last acknowledged version.
+		entries = win.cfg.UnreadChangelog()
+	}
+	body := func(txt string) layout.Widget {
+		return func(gtx C) D {
+			return material.Body1(win.theme, txt).Layout(gtx)
+		}
+	}
+	warning := func(txt string) layout.Widget {
+		return func(gtx C) D {
+			lbl := material.Body2(win.theme, txt)
+			lbl.Color = ColorDanger
+			return lbl.Layout(gtx)
+		}
+	}
+	widgets := []layout.Widget{
+		func(gtx C) D {
+			lbl := material.H5(win.theme, "What's New")
+			lbl.Color = ColorBlue
+			return lbl.Layout(gtx)
+		},
+	}
+	if pending {
+		widgets = append(widgets, body(fmt.Sprintf(changelogPendingText, leper.Version)))
+	}
+	for _, entry := range entries {
+		version := "v" + entry.Version
+		widgets = append(widgets, func(gtx C) D {
+			lbl := material.H6(win.theme, version)
+			lbl.Color = ColorBlue
+			return lbl.Layout(gtx)
+		})
+		if len(entry.Trading) > 0 {
+			widgets = append(widgets, warning("Changes that affect trading:"))
+			for _, note := range entry.Trading {
+				widgets = append(widgets, warning("• "+note))
+			}
+		}
+		for _, note := range entry.Notes {
+			widgets = append(widgets, body("• "+note))
+		}
+	}
+	if pending {
+		widgets = append(widgets, material.Button(win.theme, acknowledgeBtn, "I have read these changes").Layout)
+	}
+	if changelogErrorTxt != "" {
+		widgets = append(widgets, warning(changelogErrorTxt))
+	}
+	return changelogList.Layout(gtx, len(widgets), func(gtx C, i int) D {
+		return layout.UniformInset(unit.Dp(8)).Layout(gtx, widgets[i])
+	})
+}
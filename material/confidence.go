@@ -0,0 +1,37 @@
+package material
+
+import (
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	minConfidenceFloat     *widget.Float
+	confidenceSizingSwitch *widget.Bool
+	minConfidenceHeader    *widgetHeader
+	confidenceSizingHeader *widgetHeader
+)
+
+// confidenceSetup creates the signal confidence widgets from the saved settings.
+func (win *Window) confidenceSetup() {
+	minConfidenceFloat = &widget.Float{Value: float32(win.cfg.Trade.Confidence.MinConfidence * 100)}
+	confidenceSizingSwitch = &widget.Bool{Value: win.cfg.Trade.Confidence.ScaleSize}
+	minConfidenceHeader = win.newWidgetHeader("Lowest confidence of the analysis plugin a signal needs to be traded:", "minimum confidence")
+	confidenceSizingHeader = win.newWidgetHeader("Make entries smaller when the analysis plugin is less confident in their signal.", "confidence sizing")
+}
+
+// layoutConfidenceSettings lays out the minimum confidence of a signal and the confidence sizing switch.
+func (win *Window) layoutConfidenceSettings(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(win.sliderSetting(minConfidenceHeader, minConfidenceFloat, 0, 100, "%.0f%%")),
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, confidenceSizingSwitch).Layout)
+				}),
+				layout.Rigid(confidenceSizingHeader.Layout),
+			)
+		}),
+	)
+}
@@ -0,0 +1,37 @@
+package material
+
+import (
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	sessionStopSwitch      *widget.Bool
+	sessionStopFloat       *widget.Float
+	sessionStopHeader      *widgetHeader
+	sessionStopLimitHeader *widgetHeader
+)
+
+// sessionStopSetup creates the equity stop widgets from the saved settings.
+func (win *Window) sessionStopSetup() {
+	sessionStopSwitch = &widget.Bool{Value: win.cfg.Trade.SessionStop.Enabled}
+	sessionStopFloat = &widget.Float{Value: float32(win.cfg.Trade.SessionStop.MaxDrop * 100)}
+	sessionStopHeader = win.newWidgetHeader("Stop trading when your equity, your fiat and the value of your coins, falls below its value at the start of the session.", "equity stop")
+	sessionStopLimitHeader = win.newWidgetHeader("Largest fall in equity allowed in a session:", "equity stop limit")
+}
+
+// layoutSessionStopSettings lays out the equity stop and its limit.
+func (win *Window) layoutSessionStopSettings(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, sessionStopSwitch).Layout)
+				}),
+				layout.Rigid(sessionStopHeader.Layout),
+			)
+		}),
+		layout.Rigid(win.sliderSetting(sessionStopLimitHeader, sessionStopFloat, 1, 50, "%.0f%%")),
+	)
+}
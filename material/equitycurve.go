@@ -0,0 +1,147 @@
+package material
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"time"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// equitySpans are the periods the equity curve can be shown over, keyed by the value of their radio
+// button. A zero span shows the whole curve.
+var equitySpans = map[string]time.Duration{
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
+var (
+	equityCpbl       *Collapsible
+	equitySpanEnum   = new(widget.Enum)
+	equitySpan       string // The span the points shown were loaded for.
+	equityPoints     []leper.EquityPoint
+	equityStatus     string
+	equityRefreshBtn = new(widget.Clickable)
+)
+
+// equitySetup creates the widgets of the equity curve of the stats page.
+func (win *Window) equitySetup() {
+	equityCpbl = win.newCollapsible()
+	equitySpanEnum.Value = "month"
+	win.loadEquityCurve()
+}
+
+// loadEquityCurve loads the equity of the account over the selected span.
+func (win *Window) loadEquityCurve() {
+	equitySpan = equitySpanEnum.Value
+	since := time.Time{}
+	if span := equitySpans[equitySpan]; span > 0 {
+		since = time.Now().Add(-span)
+	}
+	points, err := leper.EquityCurve(since)
+	if err != nil {
+		equityStatus = fmt.Sprintf("Could not read the equity curve. Reason: %v", err)
+		return
+	}
+	equityStatus = ""
+	equityPoints = points
+}
+
+// layoutEquityCurve lays out the span picker, a chart of the equity over the span and the latest equity.
+func (win *Window) layoutEquityCurve(gtx C) D {
+	for equityRefreshBtn.Clicked() {
+		win.loadEquityCurve()
+	}
+	if equitySpanEnum.Value != equitySpan {
+		win.loadEquityCurve()
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(material.RadioButton(win.theme, equitySpanEnum, "week", "7 days").Layout),
+				layout.Rigid(material.RadioButton(win.theme, equitySpanEnum, "month", "30 days").Layout),
+				layout.Rigid(material.RadioButton(win.theme, equitySpanEnum, "all", "All").Layout),
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Button(win.theme, equityRefreshBtn, "Refresh").Layout)
+				}),
+			)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if equityStatus != "" {
+				return material.Caption(win.theme, equityStatus).Layout(gtx)
+			}
+			if len(equityPoints) == 0 {
+				return material.Label(win.theme, unit.Dp(11), "No equity has been recorded yet. It is saved each time the profit snapshots are taken.").Layout(gtx)
+			}
+			return pad.Layout(gtx, win.layoutEquityChart)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if len(equityPoints) == 0 {
+				return D{}
+			}
+			first, last := equityPoints[0], equityPoints[len(equityPoints)-1]
+			lbl := material.Body2(win.theme, fmt.Sprintf("Equity on %s: %.2f %s (%.2f in fiat, %.2f in open positions). Change over the period: %+.2f %s.",
+				last.Time.Format("Jan 2 15:04"), last.Equity(), win.cfg.CurrencyCode, last.Fiat, last.Positions,
+				last.Equity()-first.Equity(), win.cfg.CurrencyCode))
+			if last.Equity() < first.Equity() {
+				lbl.Color = ColorDanger
+			}
+			return lbl.Layout(gtx)
+		}),
+	)
+}
+
+// layoutEquityChart draws the equity over the span as columns from the bottom of the chart, the
+// earliest on the left. Points are spaced by the time they were taken at, and each is drawn until the next.
+func (win *Window) layoutEquityChart(gtx C) D {
+	width := gtx.Constraints.Max.X
+	height := width / 4
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, p := range equityPoints {
+		low, high = math.Min(low, p.Equity()), math.Max(high, p.Equity())
+	}
+	// Leave a margin below the lowest equity, so it is not drawn as nothing.
+	margin := (high - low) / 10
+	if margin == 0 {
+		margin = math.Max(math.Abs(high)/10, 1)
+	}
+	low -= margin
+	y := func(equity float64) float32 {
+		return float32((high-equity)/(high-low)) * float32(height)
+	}
+	rect := func(col color.RGBA, x0, y0, x1, y1 float32) {
+		paint.ColorOp{Color: col}.Add(gtx.Ops)
+		paint.PaintOp{Rect: f32.Rectangle{Min: f32.Point{X: x0, Y: y0}, Max: f32.Point{X: x1, Y: y1}}}.Add(gtx.Ops)
+	}
+	rect(ColorSurface, 0, 0, float32(width), float32(height))
+	start, end := equityPoints[0].Time, equityPoints[len(equityPoints)-1].Time
+	duration := end.Sub(start).Seconds()
+	x := func(t time.Time) float32 {
+		if duration <= 0 {
+			return 0
+		}
+		return float32(t.Sub(start).Seconds()/duration) * float32(width-1)
+	}
+	col := ColorGreen
+	if equityPoints[len(equityPoints)-1].Equity() < equityPoints[0].Equity() {
+		col = ColorDanger
+	}
+	for i, p := range equityPoints {
+		x0, x1 := x(p.Time), float32(width)
+		if i+1 < len(equityPoints) {
+			x1 = x(equityPoints[i+1].Time)
+		}
+		rect(col, x0, y(p.Equity()), float32(math.Max(float64(x1), float64(x0+1))), float32(height))
+	}
+	return D{Size: image.Point{X: width, Y: height}}
+}
@@ -0,0 +1,63 @@
+package material
+
+import (
+	"fmt"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	errorPauseFloat  *widget.Float
+	errorPauseHeader *widgetHeader
+	retryAssetBtns   = map[string]*widget.Clickable{}
+)
+
+// errorPauseSetup creates the widgets of the pause after failed requests from the saved settings.
+func (win *Window) errorPauseSetup() {
+	errorPauseFloat = &widget.Float{Value: float32(win.cfg.ErrorPause.Threshold)}
+	errorPauseHeader = win.newWidgetHeader("Pause a currency after this many failed exchange requests in a row (0 to never pause):", "pause after errors")
+}
+
+// layoutErrorPauseSettings lays out the number of failed requests after which a currency is paused.
+func (win *Window) layoutErrorPauseSettings(gtx C) D {
+	return win.sliderSetting(errorPauseHeader, errorPauseFloat, 0, 20, "%.0f")(gtx)
+}
+
+// layoutAPIPauses shows a message with a button to retry each currency paused after repeated failed requests.
+func (win *Window) layoutAPIPauses(gtx layout.Context) layout.Dimensions {
+	pauses := leper.APIPauses()
+	if len(pauses) == 0 {
+		return layout.Dimensions{}
+	}
+	children := []layout.FlexChild{}
+	for _, pause := range pauses {
+		pause := pause
+		btn, ok := retryAssetBtns[pause.Asset]
+		if !ok {
+			btn = new(widget.Clickable)
+			retryAssetBtns[pause.Asset] = btn
+		}
+		for btn.Clicked() {
+			leper.RetryAsset(pause.Asset)
+		}
+		txt := fmt.Sprintf("%s trading is paused until %s after %d failed requests. Last error: %s", assetNames[pause.Asset],
+			pause.Until.Format("15:04"), pause.Failures, pause.LastError)
+		children = append(children,
+			layout.Rigid(material.Body1(win.theme, txt).Layout),
+			layout.Rigid(material.Button(win.theme, btn, "Retry "+assetNames[pause.Asset]+" now").Layout),
+		)
+	}
+	border := widget.Border{Color: ColorDanger, CornerRadius: unit.Dp(5), Width: unit.Px(2)}
+	return pad.Layout(gtx, func(gtx C) D {
+		return border.Layout(gtx, func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+			})
+		})
+	})
+}
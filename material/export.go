@@ -0,0 +1,173 @@
+package material
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// exportDateFormat is the format of the dates of the export range.
+const exportDateFormat = "2006-01-02"
+
+var (
+	exportHistoryBtn     = new(widget.Clickable) // Opens the export view from the overflow menu of the stats page.
+	exportHistoryClicked = false
+	exportFromEdit       *Editor
+	exportToEdit         *Editor
+	exportBtn            = new(widget.Clickable)
+	exportStatus         string
+	exportList           = &layout.List{Axis: layout.Vertical}
+	taxYearEdit          *Editor
+	taxMethodEnum        = new(widget.Enum)
+	taxReportBtn         = new(widget.Clickable)
+	importHistoryBtn     = new(widget.Clickable)
+	importingHistory     bool
+	// importHistoryDone delivers the outcome of an import of the trade history to the UI.
+	importHistoryDone = make(chan string, 1)
+)
+
+// exportSetup creates the date fields of the export view.
+func (win *Window) exportSetup() {
+	exportFromEdit = win.newEditor("From", "YYYY-MM-DD, empty for the first entry")
+	exportToEdit = win.newEditor("To", "YYYY-MM-DD, empty for today")
+	taxYearEdit = win.newEditor("Tax year", "The year it starts in")
+	taxYearEdit.Editor.SetText(strconv.Itoa(time.Now().Year() - 1))
+	taxMethodEnum.Value = leper.LotFIFO
+}
+
+// exportRange reads the range of the export from the date fields. The last day is included.
+func exportRange() (span leper.ExportRange, err error) {
+	if from := strings.TrimSpace(exportFromEdit.Editor.Text()); from != "" {
+		if span.From, err = time.ParseInLocation(exportDateFormat, from, time.Local); err != nil {
+			return span, fmt.Errorf("%q is not a date like 2020-12-31", from)
+		}
+	}
+	if to := strings.TrimSpace(exportToEdit.Editor.Text()); to != "" {
+		if span.To, err = time.ParseInLocation(exportDateFormat, to, time.Local); err != nil {
+			return span, fmt.Errorf("%q is not a date like 2020-12-31", to)
+		}
+		span.To = span.To.AddDate(0, 0, 1)
+	}
+	if !span.From.IsZero() && !span.To.IsZero() && !span.From.Before(span.To) {
+		return span, fmt.Errorf("the range starts after it ends")
+	}
+	return span, nil
+}
+
+// importHistory imports the trade history from the exchange in the background, as it can take a while.
+func (win *Window) importHistory() {
+	importingHistory = true
+	exportStatus = "Importing your trade history..."
+	go func() {
+		imports, err := leper.ImportTradeHistory()
+		lines := []string{}
+		for _, imp := range imports {
+			lines = append(lines, imp.String())
+		}
+		if err != nil {
+			lines = append(lines, "Could not import the trade history. Reason: "+err.Error())
+		}
+		importHistoryDone <- strings.Join(lines, "\n")
+		win.window.Invalidate()
+	}()
+}
+
+// layoutExportView lays out the date range and the button that exports the history to CSV files, the
+// settings of the tax report and the button that imports the trade history.
+func (win *Window) layoutExportView(gtx C) D {
+	select {
+	case status := <-importHistoryDone:
+		importingHistory = false
+		exportStatus = status
+		win.loadStats()
+	default:
+	}
+	for importHistoryBtn.Clicked() {
+		if !importingHistory {
+			win.importHistory()
+		}
+	}
+	for exportBtn.Clicked() {
+		span, err := exportRange()
+		if err != nil {
+			exportStatus = "Could not export the history. Reason: " + err.Error()
+			break
+		}
+		paths, err := leper.ExportHistory(leper.ExportDir(), span)
+		if err != nil {
+			exportStatus = "Could not export the history. Reason: " + err.Error()
+			break
+		}
+		exportStatus = "Exported to:\n" + strings.Join(paths, "\n")
+	}
+	for taxReportBtn.Clicked() {
+		year, err := strconv.Atoi(strings.TrimSpace(taxYearEdit.Editor.Text()))
+		if err != nil {
+			exportStatus = fmt.Sprintf("%q is not a year like 2020", taxYearEdit.Editor.Text())
+			break
+		}
+		report, err := leper.NewTaxReport(leper.TaxOptions{Year: year, Method: taxMethodEnum.Value})
+		if err != nil {
+			exportStatus = "Could not compute the tax report. Reason: " + err.Error()
+			break
+		}
+		paths, err := report.WriteCSV(leper.ExportDir())
+		if err != nil {
+			exportStatus = "Could not save the tax report. Reason: " + err.Error()
+			break
+		}
+		exportStatus = report.String() + "\n\nSaved to:\n" + strings.Join(paths, "\n")
+	}
+	widgets := []layout.Widget{
+		func(gtx C) D {
+			return pad.Layout(gtx, material.H6(win.theme, "Export history").Layout)
+		},
+		material.Body2(win.theme, "The open and closed records in the ledger, your sales, your purchases and your equity curve are each saved to a CSV "+
+			"file that opens in Excel and other spreadsheets. Leave a date empty to export everything from the start "+
+			"or up to today.").Layout,
+		exportFromEdit.Layout,
+		exportToEdit.Layout,
+		func(gtx C) D {
+			return pad.Layout(gtx, material.Button(win.theme, exportBtn, "Export to CSV").Layout)
+		},
+		func(gtx C) D {
+			return pad.Layout(gtx, material.H6(win.theme, "Tax report").Layout)
+		},
+		material.Body2(win.theme, "Sums the gains and losses realized in a tax year by asset and by month. The cost of "+
+			"the coins sold is that of the oldest coins held (FIFO), the newest (LIFO) or the position that was closed. "+
+			"This is an aid for filing, not tax advice.").Layout,
+		taxYearEdit.Layout,
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(material.RadioButton(win.theme, taxMethodEnum, leper.LotFIFO, "FIFO").Layout),
+				layout.Rigid(material.RadioButton(win.theme, taxMethodEnum, leper.LotLIFO, "LIFO").Layout),
+				layout.Rigid(material.RadioButton(win.theme, taxMethodEnum, leper.LotAsTraded, "As traded").Layout),
+			)
+		},
+		func(gtx C) D {
+			return pad.Layout(gtx, material.Button(win.theme, taxReportBtn, "Tax report").Layout)
+		},
+		func(gtx C) D {
+			return pad.Layout(gtx, material.H6(win.theme, "Import trade history").Layout)
+		},
+		material.Body2(win.theme, "Adds the profit of the trades you made on Luno before you used Leprechaun to your all "+
+			"time stats. Each sale is matched with the earliest coins you bought before it. This can only be done once.").Layout,
+		func(gtx C) D {
+			return pad.Layout(gtx, material.Button(win.theme, importHistoryBtn, "Import from Luno").Layout)
+		},
+	}
+	if exportStatus != "" {
+		widgets = append(widgets, material.Caption(win.theme, exportStatus).Layout)
+	}
+	return exportList.Layout(gtx, len(widgets), func(gtx C, i int) D {
+		return layout.UniformInset(unit.Dp(5)).Layout(gtx, widgets[i])
+	})
+}
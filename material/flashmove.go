@@ -0,0 +1,77 @@
+package material
+
+import (
+	"fmt"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	flashMoveSwitch      *widget.Bool
+	flashMoveFloat       *widget.Float
+	flashMoveHeader      *widgetHeader
+	flashMoveLimitHeader *widgetHeader
+	resumeAssetBtns      = map[string]*widget.Clickable{}
+)
+
+// flashMoveSetup creates the flash move kill switch widgets from the saved settings.
+func (win *Window) flashMoveSetup() {
+	flashMoveSwitch = &widget.Bool{Value: win.cfg.Trade.FlashMove.Enabled}
+	flashMoveFloat = &widget.Float{Value: float32(win.cfg.Trade.FlashMove.MaxMove * 100)}
+	flashMoveHeader = win.newWidgetHeader("Halt trading of a currency when its price jumps or crashes within one analysis interval.", "flash move kill switch")
+	flashMoveLimitHeader = win.newWidgetHeader("Largest price move allowed within one analysis interval:", "flash move limit")
+}
+
+// layoutFlashMoveSettings lays out the flash move kill switch and its limit.
+func (win *Window) layoutFlashMoveSettings(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, flashMoveSwitch).Layout)
+				}),
+				layout.Rigid(flashMoveHeader.Layout),
+			)
+		}),
+		layout.Rigid(win.sliderSetting(flashMoveLimitHeader, flashMoveFloat, 1, 50, "%.0f%%")),
+	)
+}
+
+// layoutFlashHalts shows a message with a button to resume trading for each currency halted after a flash move.
+func (win *Window) layoutFlashHalts(gtx layout.Context) layout.Dimensions {
+	halts := leper.FlashHalts()
+	if len(halts) == 0 {
+		return layout.Dimensions{}
+	}
+	children := []layout.FlexChild{}
+	for _, halt := range halts {
+		halt := halt
+		btn, ok := resumeAssetBtns[halt.Asset]
+		if !ok {
+			btn = new(widget.Clickable)
+			resumeAssetBtns[halt.Asset] = btn
+		}
+		for btn.Clicked() {
+			leper.ResumeAsset(halt.Asset)
+		}
+		txt := fmt.Sprintf("%s trading is halted. The price moved %.1f%% at %s.", assetNames[halt.Asset], halt.Move*100,
+			halt.Since.Format("15:04"))
+		children = append(children,
+			layout.Rigid(material.Body1(win.theme, txt).Layout),
+			layout.Rigid(material.Button(win.theme, btn, "Resume "+assetNames[halt.Asset]+" trading").Layout),
+		)
+	}
+	border := widget.Border{Color: ColorDanger, CornerRadius: unit.Dp(5), Width: unit.Px(2)}
+	return pad.Layout(gtx, func(gtx C) D {
+		return border.Layout(gtx, func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+			})
+		})
+	})
+}
@@ -52,3 +52,9 @@ var ResetIcon *widget.Icon = func() *widget.Icon {
 	icon, _ := widget.NewIcon(icons.ActionRestore)
 	return icon
 }()
+
+// NewsIcon ...
+var NewsIcon *widget.Icon = func() *widget.Icon {
+	icon, _ := widget.NewIcon(icons.ActionAnnouncement)
+	return icon
+}()
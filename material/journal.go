@@ -0,0 +1,192 @@
+package material
+
+import (
+	"fmt"
+	"strings"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// journalRow is a trade in the journal list of the stats page.
+type journalRow struct {
+	entry leper.JournalEntry
+	btn   *widget.Clickable // Opens the details of the trade.
+	label material.LabelStyle
+}
+
+var (
+	journalCpbl        *Collapsible
+	journalRows        []journalRow
+	journalList        = &layout.List{Axis: layout.Vertical}
+	journalSearchEdit  *Editor
+	journalSearchBtn   = new(widget.Clickable)
+	journalStatus      string
+	selectedJournal    *leper.JournalEntry // The trade whose details are shown. Nil when the stats page is shown.
+	journalNotesEditor = &widget.Editor{}
+	journalSaveBtn     = new(widget.Clickable)
+	journalBackBtn     = new(widget.Clickable)
+	journalDetailList  = &layout.List{Axis: layout.Vertical}
+)
+
+// journalSetup creates the widgets of the trade journal.
+func (win *Window) journalSetup() {
+	journalCpbl = win.newCollapsible()
+	journalSearchEdit = win.newEditor("Search", "Asset, order ID, signal or notes")
+	win.loadJournal()
+}
+
+// loadJournal shows the trades in the journal that match the search.
+func (win *Window) loadJournal() {
+	entries, err := leper.JournalEntries(journalSearchEdit.Editor.Text())
+	if err != nil {
+		journalStatus = fmt.Sprintf("Could not load the journal. Reason: %v", err)
+		return
+	}
+	journalStatus = ""
+	journalRows = []journalRow{}
+	for _, entry := range entries {
+		txt := fmt.Sprintf("%s  %s %v %.6f %s @ %.2f", entry.Time.Local().Format("2006-01-02 15:04"), entry.Action,
+			entry.Type, entry.Volume, entry.Asset, entry.Price)
+		if entry.Action == leper.JournalClose {
+			txt += fmt.Sprintf(", profit %.2f", entry.Profit)
+		}
+		if entry.Notes != "" {
+			txt += " *"
+		}
+		row := journalRow{entry: entry, btn: new(widget.Clickable), label: material.Label(win.theme, unit.Dp(13), txt)}
+		if entry.Action == leper.JournalClose && entry.Profit < 0 {
+			row.label.Color = ColorDanger
+		}
+		journalRows = append(journalRows, row)
+	}
+}
+
+// openJournalEntry shows the details of a trade and its notes.
+func openJournalEntry(entry leper.JournalEntry) {
+	selectedJournal = &entry
+	journalNotesEditor.SetText(entry.Notes)
+	journalStatus = ""
+}
+
+// layoutJournal lays out the search field and the trades in the journal.
+func (win *Window) layoutJournal(gtx C) D {
+	for journalSearchBtn.Clicked() {
+		win.loadJournal()
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.End}.Layout(gtx,
+				layout.Flexed(1, journalSearchEdit.Layout),
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Button(win.theme, journalSearchBtn, "Search").Layout)
+				}),
+			)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if journalStatus != "" {
+				return material.Caption(win.theme, journalStatus).Layout(gtx)
+			}
+			if len(journalRows) == 0 {
+				return material.Label(win.theme, unit.Dp(11), "No trades in the journal.").Layout(gtx)
+			}
+			gtx.Constraints.Max.Y = gtx.Constraints.Max.X / 2
+			return journalList.Layout(gtx, len(journalRows), func(gtx C, i int) D {
+				row := journalRows[i]
+				for row.btn.Clicked() {
+					openJournalEntry(row.entry)
+				}
+				return material.Clickable(gtx, row.btn, row.label.Layout)
+			})
+		}),
+	)
+}
+
+// layoutJournalEntry lays out the context of the selected trade and the editor of its notes.
+func (win *Window) layoutJournalEntry(gtx C) D {
+	for journalBackBtn.Clicked() {
+		selectedJournal = nil
+		win.loadJournal()
+	}
+	if selectedJournal == nil {
+		return win.layoutStatsWindow(gtx)
+	}
+	entry := selectedJournal
+	for journalSaveBtn.Clicked() {
+		notes := strings.TrimSpace(journalNotesEditor.Text())
+		if err := leper.AnnotateJournal(entry.ID, notes); err != nil {
+			journalStatus = fmt.Sprintf("Could not save the notes. Reason: %v", err)
+		} else {
+			entry.Notes, journalStatus = notes, "Notes saved."
+		}
+	}
+	fields := []recordField{
+		{"Time", entry.Time.Local().Format("2006-01-02 15:04:05")},
+		{"Action", fmt.Sprintf("%s %v", entry.Action, entry.Type)},
+		{"Order ID", entry.OrderID},
+		{"Position ID", entry.PositionID},
+		{"Price", fmt.Sprintf("%.2f %s", entry.Price, win.cfg.CurrencyCode)},
+		{"Volume", fmt.Sprintf("%.6f %s", entry.Volume, entry.Asset)},
+	}
+	if entry.Action == leper.JournalClose {
+		fields = append(fields, recordField{"Profit", fmt.Sprintf("%.2f %s", entry.Profit, win.cfg.CurrencyCode)})
+	}
+	if entry.Simulated {
+		fields = append(fields, recordField{"Dry run", "Simulated order"})
+	}
+	fields = append(fields,
+		recordField{"Signal", string(entry.Signal)},
+		recordField{"Confidence", fmt.Sprintf("%.0f%%", entry.Confidence*100)},
+		recordField{"Spread", fmt.Sprintf("%.2f %s", entry.Spread, win.cfg.CurrencyCode)},
+	)
+	for _, score := range entry.Scores {
+		fields = append(fields, recordField{score.Indicator, fmt.Sprintf("%.4g (score %.2f)", score.Value, score.Score)})
+	}
+	widgets := []layout.Widget{
+		func(gtx C) D {
+			return pad.Layout(gtx, material.H6(win.theme, fmt.Sprintf("%s trade journal", entry.Asset)).Layout)
+		},
+	}
+	for _, f := range fields {
+		f := f
+		widgets = append(widgets, func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Flexed(0.4, material.Body2(win.theme, f.name).Layout),
+				layout.Flexed(0.6, material.Body1(win.theme, f.value).Layout),
+			)
+		})
+	}
+	widgets = append(widgets,
+		func(gtx C) D {
+			return pad.Layout(gtx, material.H6(win.theme, "Notes").Layout)
+		},
+		func(gtx C) D {
+			border := widget.Border{Color: win.theme.Color.Hint, CornerRadius: unit.Dp(4), Width: unit.Px(1)}
+			return border.Layout(gtx, func(gtx C) D {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layout.UniformInset(unit.Dp(6)).Layout(gtx,
+					material.Editor(win.theme, journalNotesEditor, "What went right or wrong with this trade?").Layout)
+			})
+		},
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Button(win.theme, journalBackBtn, "Back").Layout)
+				}),
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Button(win.theme, journalSaveBtn, "Save notes").Layout)
+				}),
+			)
+		},
+	)
+	if journalStatus != "" {
+		widgets = append(widgets, material.Caption(win.theme, journalStatus).Layout)
+	}
+	return journalDetailList.Layout(gtx, len(widgets), func(gtx C, i int) D {
+		return layout.UniformInset(unit.Dp(5)).Layout(gtx, widgets[i])
+	})
+}
@@ -60,10 +60,42 @@ var (
 	applySettingsButton           *widget.Clickable
 	purchaseUnitEdit              *Editor
 	profitMarginFloat             *widget.Float
+	purchasePercentFloat          *widget.Float
+	dojiToleranceFloat            *widget.Float
+	bodyRatioFloat                *widget.Float
+	wickRatioFloat                *widget.Float
+	engulfingOverlapFloat         *widget.Float
 	tradeModeGroup                *widget.Enum
+	executionGroup                *widget.Enum
 	snooozePeriodFloat            *widget.Float
 	randomSnoozeSwitch            *widget.Bool
 	displayLogSwitch              *widget.Bool
+	stalePositionDaysFloat        *widget.Float
+	stalePositionAlertsSwitch     *widget.Bool
+	inflationSwitch               *widget.Bool
+	inflationRateFloat            *widget.Float
+	fairSchedulingSwitch          *widget.Bool
+	dryRunSwitch                  *widget.Bool
+	roundCallBudgetFloat          *widget.Float
+	dcaSwitch                     *widget.Bool
+	pyramidSwitch                 *widget.Bool
+	streakSizingSwitch            *widget.Bool
+	volatilitySizingSwitch        *widget.Bool
+	idleSkipSwitch                *widget.Bool
+	strategyKillSwitch            *widget.Bool
+	minWinRateFloat               *widget.Float
+	idleSkipEpsilonFloat          *widget.Float
+	riskSwitch                    *widget.Bool
+	assetExposureFloat            *widget.Float
+	portfolioExposureFloat        *widget.Float
+	maxDrawdownFloat              *widget.Float
+	approvalSwitch                *widget.Bool
+	referencePriceSwitch          *widget.Bool
+	referenceDeviationFloat       *widget.Float
+	pairExitSwitch                *widget.Bool
+	volumeWeightedSwitch          *widget.Bool
+	dcaPurchasesFloat             *widget.Float
+	dcaWindowFloat                *widget.Float
 	recieveLogtoEmailWeeklySwitch *widget.Bool
 	apiSettingsBtn                = &widget.Clickable{}
 	generalSettingsBtn            = &widget.Clickable{}
@@ -111,6 +143,12 @@ var (
 	salesCpbl              *Collapsible
 	historyList1           = &layout.List{Axis: layout.Vertical}
 	historyList2           = &layout.List{Axis: layout.Vertical}
+	positionsCpbl          *Collapsible
+	positionsList          = &layout.List{Axis: layout.Vertical}
+	realReturnsCpbl        *Collapsible
+	hasRealReturns         = false
+	realReturnsStats       = material.LabelStyle{}
+	openPositions          = []positionRow{}
 	bitcoinStats           = material.LabelStyle{}
 	litecoinStats          = material.LabelStyle{}
 	rippleStats            = material.LabelStyle{}
@@ -127,7 +165,31 @@ var (
 // configure window headers
 var (
 	profitMarginHeader, randomSnoozeheader, snoozePeriodHeader *widgetHeader
+	purchasePercentHeader                                      *widgetHeader
+	patternSensitivityHeader, dojiToleranceHeader              *widgetHeader
+	bodyRatioHeader, wickRatioHeader, engulfingOverlapHeader   *widgetHeader
+	dcaHeader, dcaPurchasesHeader, dcaWindowHeader             *widgetHeader
+	pyramidHeader                                              *widgetHeader
+	streakSizingHeader                                         *widgetHeader
+	volatilitySizingHeader                                     *widgetHeader
+	idleSkipHeader, idleSkipEpsilonHeader                      *widgetHeader
+	strategyKillHeader, minWinRateHeader                       *widgetHeader
+	riskHeader, assetExposureHeader                            *widgetHeader
+	portfolioExposureHeader, maxDrawdownHeader                 *widgetHeader
+	approvalHeader                                             *widgetHeader
+	referencePriceHeader                                       *widgetHeader
+	pairExitHeader                                             *widgetHeader
+	volumeWeightedHeader                                       *widgetHeader
+	referenceDeviationHeader                                   *widgetHeader
 	displayLogHeader, tradeModesHeader                         *widgetHeader
+	executionHeader                                            *widgetHeader
+	stalePositionHeader, stalePositionAlertsHeader             *widgetHeader
+	inflationHeader, inflationRateHeader                       *widgetHeader
+	fairSchedulingHeader, roundCallBudgetHeader                *widgetHeader
+	dryRunHeader                                               *widgetHeader
+
+	dismissRestoredBtn      = new(widget.Clickable)
+	restoredNoticeDismissed bool
 )
 
 var (
@@ -155,15 +217,74 @@ func (win *Window) initWidgets() {
 	win.statsPageSetup()
 
 	profitMarginHeader = win.newWidgetHeader("Set the minimum profit percentage at which to sell assets in the ledger:", "Profit margin")
+	purchasePercentHeader = win.newWidgetHeader("Or spend this percentage of your balance on each purchase (0 uses the amount above):", "purchase percentage")
+	dcaHeader = win.newWidgetHeader("Spread each purchase over time (dollar-cost averaging).", "dca")
+	dcaPurchasesHeader = win.newWidgetHeader("Number of smaller purchases each position is split into:", "dca purchases")
+	dcaWindowHeader = win.newWidgetHeader("Spread the purchases over:", "dca window")
+	referencePriceHeader = win.newWidgetHeader("Check Luno's prices against a second price source and pause trading if they disagree.", "price check")
+	referenceDeviationHeader = win.newWidgetHeader("Largest difference between Luno's price and the reference price:", "price deviation")
+	pairExitHeader = win.newWidgetHeader("Close my open positions when Luno suspends or delists a pair.", "exit suspended pairs")
+	approvalHeader = win.newWidgetHeader("Ask for my approval before Leprechaun opens a position.", "manual approval")
+	pyramidHeader = win.newWidgetHeader("Add smaller entries to winning positions while the trend persists (pyramiding).", "pyramiding")
+	streakSizingHeader = win.newWidgetHeader("Make entries larger after the analyzer's signals have been right and smaller after they have been wrong.", "streak sizing")
+	strategyKillHeader = win.newWidgetHeader("Stop opening positions when the analysis is often wrong. Restart Leprechaun to trade again.", "retire strategy")
+	minWinRateHeader = win.newWidgetHeader(fmt.Sprintf("Lowest share of the last %d signals that must be right:", win.cfg.Trade.StrategyKill.Window), "minimum win rate")
+	idleSkipHeader = win.newWidgetHeader("Skip the analysis of a currency while its price and volume have not changed, to save data in quiet hours.", "idle markets")
+	idleSkipEpsilonHeader = win.newWidgetHeader("Largest price change that counts as no change:", "idle price change")
+	volatilitySizingHeader = win.newWidgetHeader("Make entries smaller when a currency's price swings a lot and larger when it is calm.", "volatility sizing")
+	riskHeader = win.newWidgetHeader("Check every new position against the risk limits below.", "risk manager")
+	assetExposureHeader = win.newWidgetHeader("Maximum share of the account value held in open positions of one currency:", "asset exposure")
+	portfolioExposureHeader = win.newWidgetHeader("Maximum share of the account value held in open positions of all currencies:", "portfolio exposure")
+	maxDrawdownHeader = win.newWidgetHeader("Stop opening positions when the account has lost this much since the session started:", "maximum drawdown")
+	patternSensitivityHeader = win.newWidgetHeader("Advanced: candlestick pattern sensitivity. Tune these if patterns are detected too often or too rarely in your market.", "pattern sensitivity")
+	dojiToleranceHeader = win.newWidgetHeader("Doji tolerance: largest body of a doji, as a share of the candle's range:", "doji tolerance")
+	bodyRatioHeader = win.newWidgetHeader("Largest body of a hammer, as a share of the candle's range:", "body ratio")
+	wickRatioHeader = win.newWidgetHeader("How many times longer than the upper wick the lower wick of a hammer must be:", "wick ratio")
+	engulfingOverlapHeader = win.newWidgetHeader("Share of a candle's range the next candle must cover to engulf it:", "engulfing overlap")
 	randomSnoozeheader = win.newWidgetHeader("Let Leprechaun choose snooze periods randomly", "random snooze")
 	snoozePeriodHeader = win.newWidgetHeader("Choose how long you want Leprechaun to snooze between each trading round:", "snooze interval")
 	displayLogHeader = win.newWidgetHeader("Display Leprechaun's activity log on the screen.", "display log")
+	volumeWeightedHeader = win.newWidgetHeader("Price market orders at the average price of the whole order, not the best price in the order book.", "volume-weighted price")
+	executionHeader = win.newWidgetHeader("How Leprechaun places orders. Quotes fix the price before trading.", "order execution")
 	tradeModesHeader = win.newWidgetHeader("Trading mode (see help section for more info)", "trade mode")
+	analyzerOverridesHeader = win.newWidgetHeader("Advanced: change the analysis of individual currencies. Leave a field empty to use the default.", "currency analysis")
+	stalePositionHeader = win.newWidgetHeader("Flag open positions as stale after this many days (0 to disable):", "stale positions")
+	stalePositionAlertsHeader = win.newWidgetHeader("Send an alert for stale positions.", "stale position alerts")
+	inflationHeader = win.newWidgetHeader("Show profits adjusted for inflation on the stats page.", "real returns")
+	inflationRateHeader = win.newWidgetHeader("Yearly inflation rate, used when no inflation index has been set:", "inflation rate")
+	dryRunHeader = win.newWidgetHeader("Trade with live prices and your balances, but simulate the orders instead of placing them. "+
+		"Simulated positions and profits are kept apart from real ones.", "dry run")
+	fairSchedulingHeader = win.newWidgetHeader("Send the exchange requests of each currency in turn, so no currency waits behind the requests of another.", "fair scheduling")
+	roundCallBudgetHeader = win.newWidgetHeader("Exchange requests allowed in each round, shared equally between currencies (0 for no limit):", "API call budget")
 
 	tradeSettingsMenuItem = win.newMenuItem("Trade Settings")
 	generalSettingsMenuItem = win.newMenuItem("General Settings")
+	win.initOnboardingWidgets()
+
+}
 
+// layoutSettingsRestored tells the user the settings file was damaged and the backup was loaded, until dismissed.
+func (win *Window) layoutSettingsRestored(gtx layout.Context) layout.Dimensions {
+	for dismissRestoredBtn.Clicked() {
+		restoredNoticeDismissed = true
+	}
+	if restoredNoticeDismissed || !win.cfg.RestoredFromBackup() {
+		return layout.Dimensions{}
+	}
+	txt := "Your settings file was damaged, so the last backup of your settings was loaded. Check your settings before you start trading."
+	border := widget.Border{Color: ColorDanger, CornerRadius: unit.Dp(5), Width: unit.Px(2)}
+	return pad.Layout(gtx, func(gtx C) D {
+		return border.Layout(gtx, func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+					layout.Rigid(material.Body1(win.theme, txt).Layout),
+					layout.Rigid(material.Button(win.theme, dismissRestoredBtn, "Dismiss").Layout),
+				)
+			})
+		})
+	})
 }
+
 func (win *Window) layoutMainWindow(gtx layout.Context) layout.Dimensions {
 	// Main window section, holds the log view
 	padding := layout.UniformInset(unit.Dp(2))
@@ -173,6 +294,18 @@ func (win *Window) layoutMainWindow(gtx layout.Context) layout.Dimensions {
 			txt.Alignment = text.Middle
 			return txt.Layout(gtx)
 		}),
+		// Pending trade proposal
+		layout.Rigid(win.layoutTradeProposal),
+		// Trading paused by the daily loss limit
+		layout.Rigid(win.layoutTradingPaused),
+		// Currencies halted after a flash move
+		layout.Rigid(win.layoutFlashHalts),
+		// Currencies paused after failed requests
+		layout.Rigid(win.layoutAPIPauses),
+		// Settings restored from the backup
+		layout.Rigid(win.layoutSettingsRestored),
+		// Pair newly listed by the exchange
+		layout.Rigid(win.layoutNewListing),
 		// Main Text Box
 		layout.Flexed(1, func(gtx C) D {
 			border := widget.Border{Color: win.theme.Color.Primary, CornerRadius: unit.Dp(5), Width: unit.Px(2)}
@@ -209,6 +342,7 @@ func (win *Window) configurePageSetup() {
 				selected = false
 			}
 		}
+		registerAsset(assetCode)
 		assetChecks[ix] = new(assetCheckField)
 		assetChecks[ix].asset = assetNames[assetCode]
 		assetChecks[ix].check = &widget.Bool{Value: selected}
@@ -216,9 +350,41 @@ func (win *Window) configurePageSetup() {
 	purchaseUnitEdit = win.newRequiredTextField(fmt.Sprintf("Specify how much crypto in %s Leprechaun should purchase in each trading round:", win.cfg.CurrencyName),
 		fmt.Sprintf("Purchase unit(%s)", win.cfg.CurrencyCode), strconv.FormatFloat(win.cfg.PurchaseUnit, 'f', -1, 64))
 	profitMarginFloat = &widget.Float{Value: float32(win.cfg.ProfitMargin * 100)}
+	purchasePercentFloat = &widget.Float{Value: float32(win.cfg.PurchasePercentage * 100)}
+	patterns := win.cfg.Trade.PatternSensitivity.WithDefaults()
+	dojiToleranceFloat = &widget.Float{Value: float32(patterns.DojiTolerance * 100)}
+	bodyRatioFloat = &widget.Float{Value: float32(patterns.BodyRatio * 100)}
+	wickRatioFloat = &widget.Float{Value: float32(patterns.WickRatio)}
+	engulfingOverlapFloat = &widget.Float{Value: float32(patterns.EngulfingOverlap * 100)}
 	snooozePeriodFloat = &widget.Float{Value: float32(win.cfg.SnoozePeriod)}
 	randomSnoozeSwitch = &widget.Bool{Value: win.cfg.RandomSnooze}
 	displayLogSwitch = &widget.Bool{Value: win.cfg.Verbose}
+	stalePositionDaysFloat = &widget.Float{Value: float32(win.cfg.StalePositionDays)}
+	stalePositionAlertsSwitch = &widget.Bool{Value: win.cfg.StalePositionAlerts}
+	inflationSwitch = &widget.Bool{Value: win.cfg.Inflation.Enabled}
+	inflationRateFloat = &widget.Float{Value: float32(win.cfg.Inflation.AnnualRate * 100)}
+	fairSchedulingSwitch = &widget.Bool{Value: win.cfg.FairScheduling}
+	dryRunSwitch = &widget.Bool{Value: win.cfg.DryRun}
+	roundCallBudgetFloat = &widget.Float{Value: float32(win.cfg.RoundCallBudget)}
+	dcaSwitch = &widget.Bool{Value: win.cfg.Trade.DCA.Enabled}
+	pyramidSwitch = &widget.Bool{Value: win.cfg.Trade.Pyramid.Enabled}
+	streakSizingSwitch = &widget.Bool{Value: win.cfg.Trade.StreakSizing.Enabled}
+	volatilitySizingSwitch = &widget.Bool{Value: win.cfg.Trade.VolatilitySizing.Enabled}
+	idleSkipSwitch = &widget.Bool{Value: win.cfg.Trade.IdleSkip.Enabled}
+	strategyKillSwitch = &widget.Bool{Value: win.cfg.Trade.StrategyKill.Enabled}
+	minWinRateFloat = &widget.Float{Value: float32(win.cfg.Trade.StrategyKill.MinWinRate * 100)}
+	idleSkipEpsilonFloat = &widget.Float{Value: float32(win.cfg.Trade.IdleSkip.PriceEpsilon * 100)}
+	riskSwitch = &widget.Bool{Value: win.cfg.Trade.Risk.Enabled}
+	assetExposureFloat = &widget.Float{Value: float32(win.cfg.Trade.Risk.MaxAssetExposure * 100)}
+	portfolioExposureFloat = &widget.Float{Value: float32(win.cfg.Trade.Risk.MaxPortfolioExposure * 100)}
+	maxDrawdownFloat = &widget.Float{Value: float32(win.cfg.Trade.Risk.MaxDrawdown * 100)}
+	approvalSwitch = &widget.Bool{Value: win.cfg.Trade.ManualApproval}
+	referencePriceSwitch = &widget.Bool{Value: win.cfg.Trade.ReferencePrice.Enabled}
+	pairExitSwitch = &widget.Bool{Value: win.cfg.Trade.PairStatus.ExitPositions}
+	volumeWeightedSwitch = &widget.Bool{Value: win.cfg.Trade.VolumeWeightedPrice}
+	referenceDeviationFloat = &widget.Float{Value: float32(win.cfg.Trade.ReferencePrice.MaxDeviation * 100)}
+	dcaPurchasesFloat = &widget.Float{Value: float32(win.cfg.Trade.DCA.Purchases)}
+	dcaWindowFloat = &widget.Float{Value: float32(win.cfg.Trade.DCA.Window) / 60}
 	tradeModeGroup = new(widget.Enum)
 	switch win.cfg.Trade.TradingMode {
 	case leper.TrendFollowing:
@@ -226,6 +392,25 @@ func (win *Window) configurePageSetup() {
 	case leper.Contrarian:
 		tradeModeGroup.Value = "contrarian"
 	}
+	executionGroup = &widget.Enum{Value: win.cfg.Trade.Execution}
+	if executionGroup.Value == "" {
+		executionGroup.Value = leper.ExecutionMarket
+	}
+	win.analysisWindowSetup()
+	win.timeframesSetup()
+	win.modelSetup()
+	win.analysisPluginSetup()
+	win.discoveredPluginsSetup()
+	win.analyzerOverridesSetup()
+	win.dailyLossSetup()
+	win.flashMoveSetup()
+	win.sessionStopSetup()
+	win.positionSizerSetup()
+	win.confidenceSetup()
+	win.errorPauseSetup()
+	win.backupSettingsSetup()
+	win.exposureCapsSetup()
+	win.appLockSetup()
 	applySettingsButton = &widget.Clickable{}
 
 	defaultSettingsRestored = false
@@ -304,6 +489,75 @@ func (win *Window) initGeneralSettingsWidgets(gtx layout.Context) {
 				layout.Rigid(displayLogHeader.Layout),
 			)
 		},
+		// Stale positions
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(stalePositionHeader.Layout),
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, func(gtx C) D {
+						return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+							layout.Flexed(1, material.Slider(win.theme, stalePositionDaysFloat, 0.0, 90.0).Layout),
+							layout.Rigid(func(gtx C) D {
+								return pad.Layout(gtx,
+									material.Body1(win.theme, fmt.Sprintf("%d days", int32(stalePositionDaysFloat.Value))).Layout,
+								)
+							}),
+						)
+					})
+				}),
+				layout.Rigid(func(gtx C) D {
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+						layout.Rigid(func(gtx C) D {
+							return pad.Layout(gtx, material.Switch(win.theme, stalePositionAlertsSwitch).Layout)
+						}),
+						layout.Rigid(stalePositionAlertsHeader.Layout),
+					)
+				}),
+			)
+		},
+		// App lock
+		win.layoutAppLockSettings,
+		// Inflation-adjusted returns
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+						layout.Rigid(func(gtx C) D {
+							return pad.Layout(gtx, material.Switch(win.theme, inflationSwitch).Layout)
+						}),
+						layout.Rigid(inflationHeader.Layout),
+					)
+				}),
+				layout.Rigid(win.sliderSetting(inflationRateHeader, inflationRateFloat, 0.0, 100.0, "%.0f%%")),
+			)
+		},
+		// Fair scheduling
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+						layout.Rigid(func(gtx C) D {
+							return pad.Layout(gtx, material.Switch(win.theme, fairSchedulingSwitch).Layout)
+						}),
+						layout.Rigid(fairSchedulingHeader.Layout),
+					)
+				}),
+				layout.Rigid(win.sliderSetting(roundCallBudgetHeader, roundCallBudgetFloat, 0.0, 600.0, "%.0f")),
+			)
+		},
+		// Pause after failed requests
+		win.layoutErrorPauseSettings,
+		// Scheduled backups
+		win.layoutBackupSettings,
+		// Dry run
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, dryRunSwitch).Layout)
+				}),
+				layout.Rigid(dryRunHeader.Layout),
+			)
+		},
 	}
 }
 
@@ -338,6 +592,24 @@ func (win *Window) initTradeSettingsWidgets(gtx layout.Context) {
 		func(gtx C) D {
 			return purchaseUnitEdit.Layout(gtx)
 		},
+		// Purchase percentage slider
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return purchasePercentHeader.Layout(gtx)
+				}),
+				layout.Rigid(func(gtx C) D {
+					return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+						layout.Flexed(1, material.Slider(win.theme, purchasePercentFloat, 0.0, 100.0).Layout),
+						layout.Rigid(func(gtx C) D {
+							return layout.UniformInset(unit.Dp(8)).Layout(gtx,
+								material.Body1(win.theme, fmt.Sprintf("%.0f%s", purchasePercentFloat.Value, "%")).Layout,
+							)
+						}),
+					)
+				}),
+			)
+		},
 		// Profit percentage margin slider
 		func(gtx C) D {
 			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
@@ -356,6 +628,123 @@ func (win *Window) initTradeSettingsWidgets(gtx layout.Context) {
 				}),
 			)
 		},
+		// Dollar-cost averaging
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, dcaSwitch).Layout)
+				}),
+				layout.Rigid(dcaHeader.Layout),
+			)
+		},
+		win.sliderSetting(dcaPurchasesHeader, dcaPurchasesFloat, 2, 12, "%.0f"),
+		win.sliderSetting(dcaWindowHeader, dcaWindowFloat, 1, 48, "%.0f hours"),
+		// Pyramiding
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, pyramidSwitch).Layout)
+				}),
+				layout.Rigid(pyramidHeader.Layout),
+			)
+		},
+		// Position sizing
+		win.layoutPositionSizerSettings,
+		// Streak sizing
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, streakSizingSwitch).Layout)
+				}),
+				layout.Rigid(streakSizingHeader.Layout),
+			)
+		},
+		// Volatility sizing
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, volatilitySizingSwitch).Layout)
+				}),
+				layout.Rigid(volatilitySizingHeader.Layout),
+			)
+		},
+		// Signal confidence
+		win.layoutConfidenceSettings,
+		// Idle markets
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, idleSkipSwitch).Layout)
+				}),
+				layout.Rigid(idleSkipHeader.Layout),
+			)
+		},
+		win.sliderSetting(idleSkipEpsilonHeader, idleSkipEpsilonFloat, 0, 1, "%.2f%%"),
+		// Strategy kill criteria
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, strategyKillSwitch).Layout)
+				}),
+				layout.Rigid(strategyKillHeader.Layout),
+			)
+		},
+		win.sliderSetting(minWinRateHeader, minWinRateFloat, 0, 100, "%.0f%%"),
+		// Risk manager
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, riskSwitch).Layout)
+				}),
+				layout.Rigid(riskHeader.Layout),
+			)
+		},
+		win.sliderSetting(assetExposureHeader, assetExposureFloat, 0, 100, "%.0f%%"),
+		win.sliderSetting(portfolioExposureHeader, portfolioExposureFloat, 0, 100, "%.0f%%"),
+		win.sliderSetting(maxDrawdownHeader, maxDrawdownFloat, 0, 50, "%.0f%%"),
+		// Daily loss limit
+		win.layoutDailyLossSettings,
+		// Equity stop for the session
+		win.layoutSessionStopSettings,
+		win.layoutFlashMoveSettings,
+		// Exposure caps of individual currencies
+		win.layoutExposureCaps,
+		// Manual trade approval
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, approvalSwitch).Layout)
+				}),
+				layout.Rigid(approvalHeader.Layout),
+			)
+		},
+		// Reference price check
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, referencePriceSwitch).Layout)
+				}),
+				layout.Rigid(referencePriceHeader.Layout),
+			)
+		},
+		win.sliderSetting(referenceDeviationHeader, referenceDeviationFloat, 1, 20, "%.0f%%"),
+		// Suspended and delisted pairs
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, pairExitSwitch).Layout)
+				}),
+				layout.Rigid(pairExitHeader.Layout),
+			)
+		},
+		// Advanced: candlestick pattern sensitivity
+		func(gtx C) D {
+			return patternSensitivityHeader.Layout(gtx)
+		},
+		win.sliderSetting(dojiToleranceHeader, dojiToleranceFloat, 1, 30, "%.0f%%"),
+		win.sliderSetting(bodyRatioHeader, bodyRatioFloat, 10, 50, "%.0f%%"),
+		win.sliderSetting(wickRatioHeader, wickRatioFloat, 1, 5, "%.1fx"),
+		win.sliderSetting(engulfingOverlapHeader, engulfingOverlapFloat, 50, 100, "%.0f%%"),
 		// Trade mode options
 		func(gtx C) D {
 			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
@@ -370,6 +759,38 @@ func (win *Window) initTradeSettingsWidgets(gtx layout.Context) {
 				}),
 			)
 		},
+		// Analysis plugin
+		win.layoutAnalysisPlugin,
+		// Analysis period and interval
+		win.layoutAnalysisWindow,
+		// Confirmation on a second timeframe
+		win.layoutTimeframeSettings,
+		// Machine learning model
+		win.layoutModelSettings,
+		// Plugins loaded from the plugins folder
+		win.layoutDiscoveredPlugins,
+		// Order execution options
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(executionHeader.Layout),
+				layout.Rigid(func(gtx C) D {
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+						layout.Rigid(material.RadioButton(win.theme, executionGroup, leper.ExecutionMarket, "Market Orders").Layout),
+						layout.Rigid(material.RadioButton(win.theme, executionGroup, leper.ExecutionQuote, "Quotes").Layout),
+					)
+				}),
+			)
+		},
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, volumeWeightedSwitch).Layout)
+				}),
+				layout.Rigid(volumeWeightedHeader.Layout),
+			)
+		},
+		// Per-currency analyzer overrides
+		win.layoutAnalyzerOverrides,
 	}
 }
 
@@ -482,6 +903,16 @@ func (win *Window) statsPageSetup() {
 	rippleCpbl = win.newCollapsible()
 	litecoinCpbl = win.newCollapsible()
 	bitcoinCpbl = win.newCollapsible()
+	positionsCpbl = win.newCollapsible()
+	realReturnsCpbl = win.newCollapsible()
+	win.replaySetup()
+	win.journalSetup()
+	win.pnlSetup()
+	win.equitySetup()
+	win.backupSetup()
+	win.issuesSetup()
+	win.exportSetup()
+	win.loadPositions()
 	win.loadPurchasesList()
 	win.loadSalesList()
 	win.loadStats()
@@ -492,6 +923,15 @@ func (win *Window) layoutStatsWindow(gtx layout.Context) layout.Dimensions {
 	if modalOpened {
 		return win.layoutLedgerView(gtx)
 	}
+	if selectedRecord != nil {
+		return win.layoutRecordDetail(gtx)
+	}
+	if replayOpen {
+		return win.layoutReplay(gtx)
+	}
+	if selectedJournal != nil {
+		return win.layoutJournalEntry(gtx)
+	}
 	collapsibles := []layout.FlexChild{
 		// History collapsible
 		layout.Rigid(func(gtx C) D {
@@ -558,6 +998,90 @@ func (win *Window) layoutStatsWindow(gtx layout.Context) layout.Dimensions {
 					)
 				})
 		}),
+		// Open positions Collapsible
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				gtx.Constraints.Max.Y = gtx.Constraints.Max.X / 2
+				return positionsCpbl.Layout(gtx, func(gtx C) D {
+					return material.H6(win.theme, fmt.Sprintf("Open Positions (%d)", len(openPositions))).Layout(gtx)
+				}, func(gtx C) D {
+					if len(openPositions) > 0 {
+						return positionsList.Layout(gtx, len(openPositions), func(gtx C, i int) D {
+							for openPositions[i].btn.Clicked() {
+								win.openRecordDetail(openPositions[i].id)
+							}
+							return openPositions[i].Layout(gtx)
+						})
+					}
+					return material.Label(win.theme, unit.Dp(11), "No open positions.").Layout(gtx)
+				})
+			})
+		}),
+		// Trade journal Collapsible
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return journalCpbl.Layout(gtx, func(gtx C) D {
+					return material.H6(win.theme, fmt.Sprintf("Trade Journal (%d)", len(journalRows))).Layout(gtx)
+				}, win.layoutJournal)
+			})
+		}),
+		// Profit by period Collapsible
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return pnlCpbl.Layout(gtx, func(gtx C) D {
+					return material.H6(win.theme, "Profit by Period").Layout(gtx)
+				}, win.layoutProfitByPeriod)
+			})
+		}),
+		// Equity curve Collapsible
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return equityCpbl.Layout(gtx, func(gtx C) D {
+					return material.H6(win.theme, "Equity Curve").Layout(gtx)
+				}, win.layoutEquityCurve)
+			})
+		}),
+		// Inflation-adjusted returns Collapsible
+		layout.Rigid(func(gtx C) D {
+			if !win.cfg.Inflation.Enabled {
+				return D{}
+			}
+			return pad.Layout(gtx, func(gtx C) D {
+				gtx.Constraints.Max.Y = gtx.Constraints.Max.X / 2
+				return realReturnsCpbl.Layout(gtx, func(gtx C) D {
+					return material.H6(win.theme, "Real vs Nominal Returns").Layout(gtx)
+				}, func(gtx C) D {
+					if hasRealReturns {
+						return realReturnsStats.Layout(gtx)
+					}
+					return material.Label(win.theme, unit.Dp(11), "No closed positions yet.").Layout(gtx)
+				})
+			})
+		}),
+		// Replay Collapsible
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return replayCpbl.Layout(gtx, func(gtx C) D {
+					return material.H6(win.theme, "Replay").Layout(gtx)
+				}, win.layoutReplayOpeners)
+			})
+		}),
+		// Ledger Issues Collapsible
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return issuesCpbl.Layout(gtx, func(gtx C) D {
+					return material.H6(win.theme, fmt.Sprintf("Ledger Issues (%d)", len(issueRows))).Layout(gtx)
+				}, win.layoutLedgerIssues)
+			})
+		}),
+		// Backups Collapsible
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return backupCpbl.Layout(gtx, func(gtx C) D {
+					return material.H6(win.theme, fmt.Sprintf("Backups (%d)", len(backupRows))).Layout(gtx)
+				}, win.layoutBackups)
+			})
+		}),
 		// Bitcoin Stats Collapsible
 		layout.Rigid(func(gtx C) D {
 			return pad.Layout(gtx, func(gtx C) D {
@@ -659,6 +1183,25 @@ func (win *Window) layoutAboutWindow(gtx layout.Context) layout.Dimensions {
 	)
 }
 
+// sliderSetting lays out a slider with its header and current value.
+func (win *Window) sliderSetting(header *widgetHeader, value *widget.Float, min, max float32, format string) layout.Widget {
+	return func(gtx C) D {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(header.Layout),
+			layout.Rigid(func(gtx C) D {
+				return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+					layout.Flexed(1, material.Slider(win.theme, value, min, max).Layout),
+					layout.Rigid(func(gtx C) D {
+						return layout.UniformInset(unit.Dp(8)).Layout(gtx,
+							material.Body1(win.theme, fmt.Sprintf(format, value.Value)).Layout,
+						)
+					}),
+				)
+			}),
+		)
+	}
+}
+
 func rigidInset(w layout.Widget) layout.FlexChild {
 	return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 		return layout.UniformInset(unit.Sp(5)).Layout(gtx, w)
@@ -704,7 +1247,7 @@ func float32dp(x float32, dp int) float32 {
 }
 
 func getVersion() string {
-	return fmt.Sprintf("%d.%d.%d", verMajor, verMinor, verPatch)
+	return leper.Version
 }
 
 // loadPurchasesList retrieves Leprechaun's past purchases for display in the stats window
@@ -713,6 +1256,11 @@ func (win *Window) loadPurchasesList() {
 	if err != nil {
 		return
 	}
+	win.setPurchasesList(purchases)
+}
+
+// setPurchasesList shows `purchases` in the stats window.
+func (win *Window) setPurchasesList(purchases []*leper.ProfitEntry) {
 	historicalPurchaseList = []material.LabelStyle{}
 	for ix, rec := range purchases {
 		s := rec.String()
@@ -724,11 +1272,74 @@ func (win *Window) loadPurchasesList() {
 	return
 }
 
+// positionRow shows an open position with a badge giving its age.
+type positionRow struct {
+	id    string
+	btn   *widget.Clickable // Opens the details of the record.
+	label material.LabelStyle
+	badge material.LabelStyle
+	stale bool
+}
+
+func (r positionRow) Layout(gtx C) D {
+	return material.Clickable(gtx, r.btn, func(gtx C) D {
+		return r.layoutRow(gtx)
+	})
+}
+
+func (r positionRow) layoutRow(gtx C) D {
+	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+		layout.Flexed(1, r.label.Layout),
+		layout.Rigid(func(gtx C) D {
+			return layout.Inset{Left: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
+				if r.stale {
+					border := widget.Border{Color: ColorDanger, CornerRadius: unit.Dp(4), Width: unit.Px(1)}
+					return border.Layout(gtx, func(gtx C) D {
+						return layout.UniformInset(unit.Dp(2)).Layout(gtx, r.badge.Layout)
+					})
+				}
+				return r.badge.Layout(gtx)
+			})
+		}),
+	)
+}
+
+// loadPositions retrieves the open positions in the ledger for display in the stats window.
+// Positions that have been open longer than the configured number of days are badged as stale.
+func (win *Window) loadPositions() {
+	records, err := leper.OpenPositions()
+	if err != nil {
+		return
+	}
+	win.setPositions(records)
+}
+
+// setPositions shows `records` in the open positions list of the stats window.
+func (win *Window) setPositions(records []leper.Record) {
+	openPositions = []positionRow{}
+	for _, rec := range records {
+		row := positionRow{id: rec.ID, btn: new(widget.Clickable), stale: rec.IsStale()}
+		row.label = material.Label(win.theme, unit.Dp(13), fmt.Sprintf("%v %.6f %s @ %.2f (trigger %.2f)",
+			rec.Type, rec.Volume, rec.Asset, rec.Price, rec.TriggerPrice))
+		row.badge = material.Caption(win.theme, fmt.Sprintf("%dd", rec.AgeInDays()))
+		if row.stale {
+			row.badge.Text = fmt.Sprintf("STALE %dd", rec.AgeInDays())
+			row.badge.Color = ColorDanger
+		}
+		openPositions = append(openPositions, row)
+	}
+}
+
 func (win *Window) loadSalesList() {
 	sales, err := leper.GetSales()
 	if err != nil {
 		return
 	}
+	win.setSalesList(sales)
+}
+
+// setSalesList shows `sales` in the stats window.
+func (win *Window) setSalesList(sales []*leper.ProfitEntry) {
 	historicalSaleList = []material.LabelStyle{}
 	for ix, rec := range sales {
 		s := rec.String()
@@ -746,21 +1357,45 @@ func (win *Window) loadStats() {
 		if e != nil {
 			return
 		}
-		switch ast {
-		case "XBT":
-			hasBitcoinStats = true
-			bitcoinStats = win.newStatsLabel(s)
-		case "XRP":
-			hasRippleStats = true
-			rippleStats = win.newStatsLabel(s)
-		case "ETH":
-			hasEthereumStats = true
-			ethereumStats = win.newStatsLabel(s)
-		case "LTC":
-			hasLitecoinStats = true
-			litecoinStats = win.newStatsLabel(s)
-		}
+		win.setStats(ast, s)
+	}
+	win.loadRealReturns()
+}
+
+// loadRealReturns shows the nominal and inflation-adjusted profit of closed positions in the stats window.
+func (win *Window) loadRealReturns() {
+	hasRealReturns = false
+	if !win.cfg.Inflation.Enabled {
+		return
+	}
+	returns, err := leper.InflationAdjustedReturns()
+	if err != nil || len(returns) == 0 || returns[len(returns)-1].Positions == 0 {
+		return
+	}
+	lines := []string{}
+	for _, r := range returns {
+		lines = append(lines, fmt.Sprintf("%s: nominal %.2f %s (%.1f%%), real %.2f %s (%.1f%%)", r.Asset,
+			r.NominalProfit, win.cfg.CurrencyCode, r.NominalPercent, r.RealProfit, win.cfg.CurrencyCode, r.RealPercent))
+	}
+	hasRealReturns = true
+	realReturnsStats = win.newStatsLabel(strings.Join(lines, "\n"))
+}
 
+// setStats shows the stats of an asset in the stats window.
+func (win *Window) setStats(asset, s string) {
+	switch asset {
+	case "XBT":
+		hasBitcoinStats = true
+		bitcoinStats = win.newStatsLabel(s)
+	case "XRP":
+		hasRippleStats = true
+		rippleStats = win.newStatsLabel(s)
+	case "ETH":
+		hasEthereumStats = true
+		ethereumStats = win.newStatsLabel(s)
+	case "LTC":
+		hasLitecoinStats = true
+		litecoinStats = win.newStatsLabel(s)
 	}
 }
 
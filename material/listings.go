@@ -0,0 +1,107 @@
+package material
+
+import (
+	"fmt"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	watchListingBtn   = new(widget.Clickable)
+	tradeListingBtn   = new(widget.Clickable)
+	dismissListingBtn = new(widget.Clickable)
+	listingErr        string
+)
+
+// registerAsset names an asset that Leprechaun has no name for, such as one added from a new listing, by its code.
+func registerAsset(code string) {
+	if _, ok := assetNames[code]; !ok {
+		assetNames[code] = code
+		assetCodes[code] = code
+	}
+}
+
+// acceptListing adds the asset of `listing` to the watchlist, and to the traded assets if `trade` is set,
+// and adds it to the assets on the settings page.
+func (win *Window) acceptListing(listing leper.Listing, trade bool) {
+	asset, err := leper.AcceptListing(listing.Pair, trade)
+	if asset == "" {
+		listingErr = err.Error()
+		return
+	}
+	// The settings page saves the UI's copy of the settings, so it must list the asset too.
+	win.cfg.AddAsset(asset, trade)
+	registerAsset(asset)
+	listed := false
+	for _, c := range assetChecks {
+		listed = listed || c.asset == assetNames[asset]
+	}
+	if !listed {
+		assetChecks = append(assetChecks, &assetCheckField{asset: assetNames[asset], check: &widget.Bool{Value: trade}})
+	}
+	listingErr = ""
+	if err != nil {
+		listingErr = fmt.Sprintf("%s was added, but your settings could not be saved: %v", asset, err)
+	}
+}
+
+// layoutNewListing offers the oldest pair newly listed by the exchange, with buttons to watch it,
+// trade it or dismiss it. Other listings are offered once it is answered.
+func (win *Window) layoutNewListing(gtx layout.Context) layout.Dimensions {
+	pending := leper.NewListings()
+	if len(pending) == 0 && listingErr == "" {
+		return layout.Dimensions{}
+	}
+	children := []layout.FlexChild{}
+	if len(pending) > 0 {
+		listing := pending[0]
+		for watchListingBtn.Clicked() {
+			win.acceptListing(listing, false)
+		}
+		for tradeListingBtn.Clicked() {
+			win.acceptListing(listing, true)
+		}
+		for dismissListingBtn.Clicked() {
+			if err := leper.DismissListing(listing.Pair); err != nil {
+				listingErr = err.Error()
+			}
+		}
+		txt := fmt.Sprintf("Luno listed %s/%s — add to watchlist?", listing.Asset, listing.Currency)
+		children = append(children,
+			layout.Rigid(material.Body1(win.theme, txt).Layout),
+			layout.Rigid(func(gtx C) D {
+				return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceEvenly}.Layout(gtx,
+					layout.Rigid(material.Button(win.theme, watchListingBtn, "Watch").Layout),
+					layout.Rigid(material.Button(win.theme, tradeListingBtn, "Trade "+listing.Asset).Layout),
+					layout.Rigid(material.Button(win.theme, dismissListingBtn, "Dismiss").Layout),
+				)
+			}),
+		)
+	}
+	if listingErr != "" {
+		children = append(children, layout.Rigid(func(gtx C) D {
+			lbl := material.Body2(win.theme, listingErr)
+			lbl.Color = ColorDanger
+			return lbl.Layout(gtx)
+		}))
+		if len(pending) == 0 {
+			for dismissListingBtn.Clicked() {
+				listingErr = ""
+			}
+			children = append(children, layout.Rigid(material.Button(win.theme, dismissListingBtn, "Dismiss").Layout))
+		}
+	}
+	border := widget.Border{Color: ColorBlue, CornerRadius: unit.Dp(5), Width: unit.Px(2)}
+	return pad.Layout(gtx, func(gtx C) D {
+		return border.Layout(gtx, func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+			})
+		})
+	})
+}
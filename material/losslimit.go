@@ -0,0 +1,87 @@
+package material
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	dailyLossSwitch    *widget.Bool
+	dailyLossLimitEdit *Editor
+	dailyLossHeader    *widgetHeader
+	resumeTradingBtn   = new(widget.Clickable)
+)
+
+// dailyLossSetup creates the daily loss limit widgets from the saved settings.
+func (win *Window) dailyLossSetup() {
+	dailyLossSwitch = &widget.Bool{Value: win.cfg.Trade.DailyLoss.Enabled}
+	dailyLossLimitEdit = win.newTextField(fmt.Sprintf("Daily loss limit (%s)", win.cfg.CurrencyCode), "e.g. 20000",
+		strconv.FormatFloat(win.cfg.Trade.DailyLoss.Limit, 'f', -1, 64))
+	dailyLossHeader = win.newWidgetHeader("Stop opening positions for the rest of the day when the day's loss exceeds the limit below.", "daily loss limit")
+}
+
+// readDailyLoss returns the daily loss limit entered by the user.
+func readDailyLoss() (settings leper.DailyLossSettings, err error) {
+	settings.Enabled = dailyLossSwitch.Value
+	txt := strings.TrimSpace(dailyLossLimitEdit.Editor.Text())
+	if txt == "" {
+		if settings.Enabled {
+			return settings, fmt.Errorf("specify a daily loss limit")
+		}
+		return settings, nil
+	}
+	settings.Limit, err = strconv.ParseFloat(txt, 64)
+	if err != nil || settings.Limit < 0 {
+		return settings, fmt.Errorf("invalid value for the daily loss limit")
+	}
+	return settings, nil
+}
+
+// layoutDailyLossSettings lays out the daily loss limit switch and amount.
+func (win *Window) layoutDailyLossSettings(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return pad.Layout(gtx, material.Switch(win.theme, dailyLossSwitch).Layout)
+				}),
+				layout.Rigid(dailyLossHeader.Layout),
+			)
+		}),
+		layout.Rigid(dailyLossLimitEdit.Layout),
+	)
+}
+
+// layoutTradingPaused shows a message with a button to resume trading while the daily loss limit has paused it.
+func (win *Window) layoutTradingPaused(gtx layout.Context) layout.Dimensions {
+	for resumeTradingBtn.Clicked() {
+		if err := leper.ResumeTrading(); err != nil {
+			leper.Logger.Printf("Could not resume trading. Reason: %v", err)
+		}
+	}
+	profit, paused := leper.DailyLossStatus()
+	if !paused {
+		return layout.Dimensions{}
+	}
+	txt := fmt.Sprintf("Trading is paused. Today's loss of %s %.2f exceeds your daily loss limit of %s %.2f. Leprechaun will not open new positions until tomorrow.",
+		win.cfg.CurrencyCode, -profit, win.cfg.CurrencyCode, win.cfg.Trade.DailyLoss.Limit)
+	border := widget.Border{Color: ColorDanger, CornerRadius: unit.Dp(5), Width: unit.Px(2)}
+	return pad.Layout(gtx, func(gtx C) D {
+		return border.Layout(gtx, func(gtx C) D {
+			return pad.Layout(gtx, func(gtx C) D {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+					layout.Rigid(material.Body1(win.theme, txt).Layout),
+					layout.Rigid(material.Button(win.theme, resumeTradingBtn, "Resume trading").Layout),
+				)
+			})
+		})
+	})
+}
@@ -0,0 +1,42 @@
+package material
+
+import (
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	leper "github.com/michaellormann/leprechaun/core"
+)
+
+var (
+	modelPathField       *Editor
+	modelThresholdFloat  *widget.Float
+	modelHeader          *widgetHeader
+	modelThresholdHeader *widgetHeader
+)
+
+// modelSetup creates the model plugin widgets from the saved settings.
+func (win *Window) modelSetup() {
+	settings := win.cfg.Trade.Model
+	modelHeader = win.newWidgetHeader("The machine learning model used by the model plugin. Relative paths are in the data directory. Without a model the fallback plugin is used.", "model plugin")
+	modelPathField = win.newTextField("Model file", "e.g. model.onnx", settings.Path)
+	modelThresholdFloat = &widget.Float{Value: float32(settings.Threshold * 100)}
+	modelThresholdHeader = win.newWidgetHeader("The probability the model must give a long or short signal before it is traded.", "model threshold")
+}
+
+// readModelPath returns the model file entered by the user.
+func readModelPath() string {
+	return strings.TrimSpace(modelPathField.Editor.Text())
+}
+
+// layoutModelSettings lays out the model file and threshold. They are hidden in builds without a model runtime.
+func (win *Window) layoutModelSettings(gtx C) D {
+	if !leper.ModelRuntimeAvailable() {
+		return D{}
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(modelHeader.Layout),
+		layout.Rigid(modelPathField.Layout),
+		layout.Rigid(win.sliderSetting(modelThresholdHeader, modelThresholdFloat, 50, 100, "%.0f%%")),
+	)
+}
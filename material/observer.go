@@ -0,0 +1,75 @@
+package material
+
+import (
+	"fmt"
+	"time"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+)
+
+var (
+	// observerStateChannel delivers the latest state read from the observed state file.
+	observerStateChannel = make(chan leper.BotState, 1)
+	// observerErrorChannel delivers errors met while reading the observed state file.
+	observerErrorChannel = make(chan error, 1)
+	// observerPollInterval is how often the observed state file is read.
+	observerPollInterval = 5 * time.Second
+)
+
+// Observe opens the UI in read-only observer mode. Positions, stats and logs are read from
+// the state file at `path`, written by a bot running elsewhere, and the bot can not be started.
+func (win *Window) Observe(path string) {
+	win.observing = path
+	go func() {
+		var last time.Time
+		for {
+			state, err := leper.ReadStateFile(path)
+			if err != nil {
+				// The state file may be in the middle of being replaced. Try again at the next poll.
+				select {
+				case observerErrorChannel <- err:
+				default:
+				}
+			} else if state.Updated.After(last) {
+				last = state.Updated
+				observerStateChannel <- state
+			}
+			time.Sleep(observerPollInterval)
+		}
+	}()
+}
+
+// applyObservedState shows a state read from the observed state file.
+func (win *Window) applyObservedState(state leper.BotState) {
+	status := "stopped"
+	if state.Running {
+		status = "running"
+	}
+	logViewContents = []material.LabelStyle{
+		material.Label(win.theme, unit.Sp(14), fmt.Sprintf("Observing %s (read-only)", win.observing)),
+		material.Label(win.theme, unit.Sp(14), fmt.Sprintf("Bot is %s. Last updated %s.", status,
+			state.Updated.Format("2006-01-02 15:04:05"))),
+	}
+	if state.Snapshot != nil {
+		logViewContents = append(logViewContents, material.Label(win.theme, unit.Sp(14),
+			fmt.Sprintf("Realized profit: %.2f | Unrealized profit: %.2f", state.Snapshot.Realized, state.Snapshot.Unrealized)))
+	}
+	logViewContents = append(logViewContents, material.Label(win.theme, unit.Sp(14),
+		fmt.Sprintf("%d open position(s):", len(state.Positions))))
+	for _, rec := range state.Positions {
+		logViewContents = append(logViewContents, win.newPurchaseLabel(rec.String()))
+	}
+	for _, line := range state.Logs {
+		logViewContents = append(logViewContents, material.Label(win.theme, unit.Sp(14), line))
+	}
+	win.setPositions(state.Positions)
+	win.setPurchasesList(state.Purchases)
+	win.setSalesList(state.Sales)
+	for asset, stats := range state.Stats {
+		win.setStats(asset, stats)
+	}
+	win.env.redraw()
+}
@@ -0,0 +1,158 @@
+package material
+
+import (
+	"fmt"
+	"strings"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// Steps of the risk-free onboarding flow.
+const (
+	onboardIntro = iota
+	onboardRunning
+	onboardSummary
+	onboardLive
+)
+
+var (
+	onboardStep       = onboardIntro
+	onboardList       = &layout.List{Axis: layout.Vertical}
+	startPaperBtn     = new(widget.Clickable)
+	restartPaperBtn   = new(widget.Clickable)
+	goLiveBtn         = new(widget.Clickable)
+	onboardKeyID      *Editor
+	onboardKeySecret  *Editor
+	onboardSummaryTxt string
+	onboardErrorTxt   string
+)
+
+const onboardIntroText = `Not sure yet? Try Leprechaun risk-free.
+
+Leprechaun will trade with a paper account holding %s %.0f. Prices come live from Luno, but no real orders are placed and no API keys are needed.
+
+The session runs %d trading rounds. You can follow along on the Leprechaun page. When it is over you will see how your paper account did, and you can switch to live trading with your own Luno API keys.`
+
+const onboardRunningText = `Paper trading is running. Follow the trades on the Leprechaun page.
+
+You will be brought back here when the session is over.`
+
+const onboardLiveText = `You are now set up for live trading. Review your trade settings, then press the start button on the Leprechaun page.
+
+Leprechaun will now place real orders on your Luno account.`
+
+func (win *Window) initOnboardingWidgets() {
+	onboardKeyID = win.newTextField("API Key ID", "Your Luno API Key ID", "")
+	onboardKeySecret = win.newTextField("API Key Secret", "Your Luno API Key Secret", "")
+}
+
+// handlePaperSessionStopped moves the onboarding flow on when the bot stops during a paper trading session.
+func (win *Window) handlePaperSessionStopped() {
+	if onboardStep != onboardRunning {
+		return
+	}
+	onboardSummaryTxt = leper.PaperSummary()
+	onboardStep = onboardSummary
+	win.env.redraw()
+}
+
+func (win *Window) handleOnboardingEvents() {
+	for startPaperBtn.Clicked() {
+		if win.botState != Stopped {
+			onboardErrorTxt = "Please stop Leprechaun before starting a paper trading session."
+			continue
+		}
+		if err := win.cfg.StartPaperTrading(leper.DefaultPaperRounds); err != nil {
+			onboardErrorTxt = fmt.Sprintf("Could not start paper trading. Reason: %v", err)
+			continue
+		}
+		leper.SetConfig(win.cfg)
+		onboardErrorTxt = ""
+		onboardStep = onboardRunning
+		win.handleStartStop(false)
+	}
+	for restartPaperBtn.Clicked() {
+		if err := leper.ResetPaperAccount(); err != nil {
+			onboardErrorTxt = fmt.Sprintf("Could not reset the paper account. Reason: %v", err)
+			continue
+		}
+		onboardErrorTxt = ""
+		onboardStep = onboardIntro
+	}
+	for goLiveBtn.Clicked() {
+		keyID := strings.TrimSpace(onboardKeyID.Editor.Text())
+		keySecret := strings.TrimSpace(onboardKeySecret.Editor.Text())
+		if err := win.cfg.GoLive(keyID, keySecret); err != nil {
+			onboardErrorTxt = "Please provide a valid Luno API Key ID and Secret."
+			continue
+		}
+		leper.SetConfig(win.cfg)
+		// Keep the trade settings page in step with the new keys.
+		for _, editor := range apiConfigFields {
+			switch editor.Name {
+			case "Luno API Key ID":
+				editor.Editor.SetText(keyID)
+			case "Luno API Key Secret":
+				editor.Editor.SetText(keySecret)
+			}
+		}
+		onboardErrorTxt = ""
+		onboardStep = onboardLive
+	}
+}
+
+func (win *Window) layoutOnboardingWindow(gtx layout.Context) layout.Dimensions {
+	win.handleOnboardingEvents()
+	body := func(txt string) layout.Widget {
+		return func(gtx C) D {
+			return material.Body1(win.theme, txt).Layout(gtx)
+		}
+	}
+	widgets := []layout.Widget{
+		func(gtx C) D {
+			lbl := material.H5(win.theme, "Try Leprechaun Risk-Free")
+			lbl.Color = ColorBlue
+			return lbl.Layout(gtx)
+		},
+	}
+	switch onboardStep {
+	case onboardIntro:
+		balance := win.cfg.Paper.StartingBalance
+		if balance <= 0 {
+			balance = leper.DefaultPaperBalance
+		}
+		widgets = append(widgets,
+			body(fmt.Sprintf(onboardIntroText, win.cfg.CurrencyCode, balance, leper.DefaultPaperRounds)),
+			material.Button(win.theme, startPaperBtn, "Start paper trading").Layout,
+		)
+	case onboardRunning:
+		widgets = append(widgets, body(onboardRunningText))
+	case onboardSummary:
+		widgets = append(widgets,
+			body("Your paper trading session is over."),
+			body(onboardSummaryTxt),
+			body("Ready for the real thing? Enter your Luno API keys to switch to live trading."),
+			onboardKeyID.Layout,
+			onboardKeySecret.Layout,
+			material.Button(win.theme, goLiveBtn, "Switch to live trading").Layout,
+			material.Button(win.theme, restartPaperBtn, "Start a new paper session").Layout,
+		)
+	case onboardLive:
+		widgets = append(widgets, body(onboardLiveText))
+	}
+	if onboardErrorTxt != "" {
+		widgets = append(widgets, func(gtx C) D {
+			lbl := material.Body2(win.theme, onboardErrorTxt)
+			lbl.Color = ColorDanger
+			return lbl.Layout(gtx)
+		})
+	}
+	return onboardList.Layout(gtx, len(widgets), func(gtx C, i int) D {
+		return layout.UniformInset(unit.Dp(8)).Layout(gtx, widgets[i])
+	})
+}
@@ -0,0 +1,147 @@
+package material
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// assetOverrideFields holds the widgets used to edit the analyzer overrides of a single asset.
+// Empty fields are not overridden.
+type assetOverrideFields struct {
+	asset    string
+	period   *Editor
+	interval *Editor
+	window   *Editor
+	mode     *widget.Enum
+	plugin   *widget.Enum
+	// patterns are only edited in the settings file. They are kept when the settings are saved.
+	patterns leper.PatternSensitivity
+}
+
+var (
+	analyzerOverrideFields  []*assetOverrideFields
+	analyzerOverridesList   = &layout.List{Axis: layout.Vertical}
+	analyzerOverridesHeader *widgetHeader
+)
+
+func formatOverride(value int64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+// analyzerOverridesSetup creates the override fields of each supported asset from the saved settings.
+func (win *Window) analyzerOverridesSetup() {
+	analyzerOverrideFields = make([]*assetOverrideFields, len(win.cfg.SupportedAssets))
+	for ix, assetCode := range win.cfg.SupportedAssets {
+		saved := win.cfg.Trade.AnalyzerOverrides[assetCode]
+		analyzerOverrideFields[ix] = &assetOverrideFields{
+			asset:    assetCode,
+			period:   win.newTextField("Analysis period (hours)", "Default", formatOverride(int64(saved.AnalysisPeriod))),
+			interval: win.newTextField("Interval between prices (minutes)", "Default", formatOverride(int64(saved.Interval))),
+			window:   win.newTextField("Moving average window (prices)", "Default", formatOverride(int64(saved.MovingAverageWindow))),
+			mode:     &widget.Enum{Value: saved.Mode},
+			plugin:   &widget.Enum{Value: saved.Plugin},
+			patterns: saved.Patterns,
+		}
+	}
+}
+
+// parseOverride reads a whole number from an override field. An empty field is not overridden.
+func parseOverride(e *Editor) (int64, error) {
+	txt := strings.TrimSpace(e.Editor.Text())
+	if txt == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(txt, 10, 32)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s must be a whole number", strings.ToLower(e.Name))
+	}
+	return value, nil
+}
+
+// readAnalyzerOverrides returns the analyzer overrides entered by the user, keyed by asset code.
+func readAnalyzerOverrides() (map[string]leper.AnalyzerOverrides, error) {
+	overrides := map[string]leper.AnalyzerOverrides{}
+	for _, fields := range analyzerOverrideFields {
+		period, err := parseOverride(fields.period)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", assetNames[fields.asset], err)
+		}
+		interval, err := parseOverride(fields.interval)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", assetNames[fields.asset], err)
+		}
+		window, err := parseOverride(fields.window)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", assetNames[fields.asset], err)
+		}
+		o := leper.AnalyzerOverrides{
+			AnalysisPeriod:      int32(period),
+			Interval:            int32(interval),
+			Mode:                fields.mode.Value,
+			MovingAverageWindow: int(window),
+			Patterns:            fields.patterns,
+			Plugin:              fields.plugin.Value,
+		}
+		if err = o.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", assetNames[fields.asset], err)
+		}
+		if !o.IsZero() {
+			overrides[fields.asset] = o
+		}
+	}
+	return overrides, nil
+}
+
+// layoutPluginChoice lays out a radio button for each registered analysis plugin and one to use the default plugin.
+func (win *Window) layoutPluginChoice(gtx C, choice *widget.Enum) D {
+	buttons := []layout.FlexChild{
+		layout.Rigid(material.RadioButton(win.theme, choice, "", "Default Plugin").Layout),
+	}
+	if leper.PluginHandler != nil {
+		for _, name := range leper.PluginHandler.Names() {
+			buttons = append(buttons, layout.Rigid(material.RadioButton(win.theme, choice, name, strings.Title(name)).Layout))
+		}
+	}
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, buttons...)
+}
+
+// layoutAnalyzerOverrides lays out the analyzer override fields of each supported asset.
+func (win *Window) layoutAnalyzerOverrides(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(analyzerOverridesHeader.Layout),
+		layout.Rigid(func(gtx C) D {
+			return analyzerOverridesList.Layout(gtx, len(analyzerOverrideFields), func(gtx C, i int) D {
+				fields := analyzerOverrideFields[i]
+				return layout.UniformInset(unit.Dp(5)).Layout(gtx, func(gtx C) D {
+					return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+						layout.Rigid(material.Body1(win.theme, assetNames[fields.asset]).Layout),
+						layout.Rigid(fields.period.Layout),
+						layout.Rigid(fields.interval.Layout),
+						layout.Rigid(fields.window.Layout),
+						layout.Rigid(func(gtx C) D {
+							return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+								layout.Rigid(material.RadioButton(win.theme, fields.mode, "", "Default Mode").Layout),
+								layout.Rigid(material.RadioButton(win.theme, fields.mode, leper.ModeTrendFollowing, "Trend Following").Layout),
+								layout.Rigid(material.RadioButton(win.theme, fields.mode, leper.ModeContrarian, "Contrarian").Layout),
+							)
+						}),
+						layout.Rigid(func(gtx C) D {
+							return win.layoutPluginChoice(gtx, fields.plugin)
+						}),
+					)
+				})
+			})
+		}),
+	)
+}
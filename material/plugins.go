@@ -0,0 +1,90 @@
+package material
+
+import (
+	"fmt"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	leper "github.com/michaellormann/leprechaun/core"
+)
+
+var (
+	analysisPluginGroup     *widget.Enum
+	analysisPluginHeader    *widgetHeader
+	analysisPluginList      = &layout.List{Axis: layout.Horizontal}
+	analysisPlugins         []leper.PluginDescription
+	discoveredPluginsHeader *widgetHeader
+	discoveredPluginsList   = &layout.List{Axis: layout.Vertical}
+	discoveredPlugins       []leper.PluginInfo
+)
+
+// analysisPluginSetup creates the analysis plugin picker from the registered plugins and the saved settings.
+func (win *Window) analysisPluginSetup() {
+	analysisPluginHeader = win.newWidgetHeader("The analysis plugin that decides when to trade. A plugin chosen for a currency below is used for it instead. Takes effect when the bot is started.", "analysis plugin")
+	analysisPluginGroup = &widget.Enum{Value: strings.ToLower(win.cfg.Trade.AnalysisPlugin.Name)}
+	if leper.PluginHandler == nil {
+		return
+	}
+	analysisPlugins = leper.PluginHandler.List()
+	if _, err := leper.PluginHandler.Describe(analysisPluginGroup.Value); err != nil {
+		analysisPluginGroup.Value = strings.ToLower(leper.DefaultAnalysisPlugin)
+	}
+}
+
+// layoutAnalysisPlugin lays out a radio button for each registered plugin and the description of the chosen one.
+func (win *Window) layoutAnalysisPlugin(gtx C) D {
+	description := ""
+	for _, plugin := range analysisPlugins {
+		if plugin.Name == analysisPluginGroup.Value {
+			description = plugin.Description
+		}
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(analysisPluginHeader.Layout),
+		layout.Rigid(func(gtx C) D {
+			return analysisPluginList.Layout(gtx, len(analysisPlugins), func(gtx C, i int) D {
+				name := analysisPlugins[i].Name
+				return material.RadioButton(win.theme, analysisPluginGroup, name, strings.Title(name)).Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			return layout.UniformInset(unit.Dp(5)).Layout(gtx, material.Caption(win.theme, description).Layout)
+		}),
+	)
+}
+
+// discoveredPluginsSetup lists the plugins loaded from the plugins folder.
+func (win *Window) discoveredPluginsSetup() {
+	discoveredPluginsHeader = win.newWidgetHeader(fmt.Sprintf("Plugins and strategies loaded from %s when Leprechaun started. They can be chosen for each currency.", win.cfg.PluginDir()), "installed plugins")
+	if leper.PluginHandler != nil {
+		discoveredPlugins = leper.PluginHandler.Discovered()
+	}
+}
+
+// layoutDiscoveredPlugins lays out the name, version and description of each plugin loaded from the plugins folder.
+func (win *Window) layoutDiscoveredPlugins(gtx C) D {
+	if len(discoveredPlugins) == 0 {
+		return D{}
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(discoveredPluginsHeader.Layout),
+		layout.Rigid(func(gtx C) D {
+			return discoveredPluginsList.Layout(gtx, len(discoveredPlugins), func(gtx C, i int) D {
+				info := discoveredPlugins[i]
+				title := info.Name
+				if info.Version != "" {
+					title += " " + info.Version
+				}
+				return layout.UniformInset(unit.Dp(5)).Layout(gtx, func(gtx C) D {
+					return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+						layout.Rigid(material.Body1(win.theme, title).Layout),
+						layout.Rigid(material.Caption(win.theme, info.Description).Layout),
+					)
+				})
+			})
+		}),
+	)
+}
@@ -0,0 +1,125 @@
+package material
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"time"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// pnlBars is the number of periods on the profit chart, the latest last.
+const pnlBars = 30
+
+var (
+	pnlCpbl       *Collapsible
+	pnlPeriodEnum = new(widget.Enum)
+	pnlPeriod     leper.ProfitPeriod // The period the profits shown are summed over.
+	pnlProfits    []leper.PeriodProfit
+	pnlTotals     []leper.PeriodProfit
+	pnlStatus     string
+	pnlList       = &layout.List{Axis: layout.Vertical}
+)
+
+// pnlSetup creates the widgets of the profit by period table.
+func (win *Window) pnlSetup() {
+	pnlCpbl = win.newCollapsible()
+	pnlPeriodEnum.Value = string(leper.PeriodWeek)
+	win.loadProfitByPeriod()
+}
+
+// loadProfitByPeriod sums the profits of every asset by the selected period.
+func (win *Window) loadProfitByPeriod() {
+	pnlPeriod = leper.ProfitPeriod(pnlPeriodEnum.Value)
+	profits, err := leper.ProfitByPeriod("", pnlPeriod, time.Time{}, time.Time{})
+	if err != nil {
+		pnlStatus = fmt.Sprintf("Could not sum the profits. Reason: %v", err)
+		return
+	}
+	pnlStatus = ""
+	pnlProfits, pnlTotals = profits, leper.TotalByPeriod(profits)
+}
+
+// layoutProfitByPeriod lays out the period picker, a chart of the total profit of each period and a
+// table of the profit of each asset, from the latest period.
+func (win *Window) layoutProfitByPeriod(gtx C) D {
+	if leper.ProfitPeriod(pnlPeriodEnum.Value) != pnlPeriod {
+		win.loadProfitByPeriod()
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(material.RadioButton(win.theme, pnlPeriodEnum, string(leper.PeriodDay), "Daily").Layout),
+				layout.Rigid(material.RadioButton(win.theme, pnlPeriodEnum, string(leper.PeriodWeek), "Weekly").Layout),
+				layout.Rigid(material.RadioButton(win.theme, pnlPeriodEnum, string(leper.PeriodMonth), "Monthly").Layout),
+			)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if pnlStatus != "" {
+				return material.Caption(win.theme, pnlStatus).Layout(gtx)
+			}
+			if len(pnlTotals) == 0 {
+				return material.Label(win.theme, unit.Dp(11), "No closed positions yet.").Layout(gtx)
+			}
+			return pad.Layout(gtx, win.layoutProfitChart)
+		}),
+		layout.Rigid(func(gtx C) D {
+			gtx.Constraints.Max.Y = gtx.Constraints.Max.X / 2
+			return pnlList.Layout(gtx, len(pnlProfits), func(gtx C, i int) D {
+				p := pnlProfits[len(pnlProfits)-1-i]
+				lbl := material.Label(win.theme, unit.Dp(13), fmt.Sprintf("%s  %s: %.2f %s, %d of %d trades won",
+					p.Label(), p.Asset, p.Profit, win.cfg.CurrencyCode, p.Wins, p.Trades))
+				if p.Profit < 0 {
+					lbl.Color = ColorDanger
+				}
+				return lbl.Layout(gtx)
+			})
+		}),
+	)
+}
+
+// layoutProfitChart draws the total profit of the latest periods as bars above or below the zero line.
+func (win *Window) layoutProfitChart(gtx C) D {
+	width := gtx.Constraints.Max.X
+	height := width / 4
+	totals := pnlTotals
+	if len(totals) > pnlBars {
+		totals = totals[len(totals)-pnlBars:]
+	}
+	low, high := 0.0, 0.0
+	for _, p := range totals {
+		low, high = math.Min(low, p.Profit), math.Max(high, p.Profit)
+	}
+	if high <= low {
+		high = low + 1
+	}
+	y := func(profit float64) float32 {
+		return float32((high-profit)/(high-low)) * float32(height)
+	}
+	rect := func(col color.RGBA, x0, y0, x1, y1 float32) {
+		paint.ColorOp{Color: col}.Add(gtx.Ops)
+		paint.PaintOp{Rect: f32.Rectangle{Min: f32.Point{X: x0, Y: y0}, Max: f32.Point{X: x1, Y: y1}}}.Add(gtx.Ops)
+	}
+	rect(ColorSurface, 0, 0, float32(width), float32(height))
+	slot := float32(width) / pnlBars
+	zero := y(0)
+	for i, p := range totals {
+		x := float32(i) * slot
+		top, bottom, col := y(p.Profit), zero, ColorGreen
+		if p.Profit < 0 {
+			top, bottom, col = zero, y(p.Profit), ColorDanger
+		}
+		rect(col, x+slot*0.2, top, x+slot*0.8, bottom)
+	}
+	rect(win.theme.Color.Hint, 0, zero-0.5, float32(width), zero+0.5)
+	return D{Size: image.Point{X: width, Y: height}}
+}
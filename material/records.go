@@ -0,0 +1,172 @@
+package material
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"github.com/atotto/clipboard"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// recordField is a labelled value shown on the record detail page.
+type recordField struct {
+	name, value string
+}
+
+var (
+	selectedRecord     *leper.Record // The record whose details are shown. Nil when the stats page is shown.
+	recordFields       []recordField
+	recordAnalysis     []recordField
+	recordDetailStatus string
+	recordDetailList   = &layout.List{Axis: layout.Vertical}
+	recordBackBtn      = new(widget.Clickable)
+	copyOrderIDBtn     = new(widget.Clickable)
+	openOrderBtn       = new(widget.Clickable)
+)
+
+// openRecordDetail loads the record with the order ID `id` from the ledger and shows its details.
+func (win *Window) openRecordDetail(id string) {
+	rec, err := leper.GetRecord(id)
+	if err != nil {
+		recordDetailStatus = fmt.Sprintf("Could not load the record %s. Reason: %v", id, err)
+		rec = leper.Record{ID: id}
+	} else {
+		recordDetailStatus = ""
+	}
+	selectedRecord = &rec
+	recordFields = []recordField{
+		{"Order ID", rec.ID},
+		{"Client reference", rec.ClientRef},
+		{"Asset", rec.Asset},
+		{"Type", fmt.Sprintf("%v", rec.Type)},
+		{"Status", rec.Status},
+		{"Opened", rec.Timestamp},
+		{"Age", fmt.Sprintf("%d days", rec.AgeInDays())},
+		{"Price", fmt.Sprintf("%.2f %s", rec.Price, win.cfg.CurrencyCode)},
+		{"Volume", fmt.Sprintf("%.6f %s", rec.Volume, rec.Asset)},
+		{"Requested volume", fmt.Sprintf("%.6f %s", rec.RequestedVolume, rec.Asset)},
+		{"Cost", fmt.Sprintf("%.2f %s", rec.Cost, win.cfg.CurrencyCode)},
+		{"Trigger price", fmt.Sprintf("%.2f %s", rec.TriggerPrice, win.cfg.CurrencyCode)},
+		{"Stop-loss price", fmt.Sprintf("%.2f %s", rec.StopLossPrice(), win.cfg.CurrencyCode)},
+		{"Fee", fmt.Sprintf("%.8f %s, %.2f %s", rec.LunoAssetFee, rec.Asset, rec.LunoFiatFee, win.cfg.CurrencyCode)},
+		{"Parent position", rec.ParentID},
+		{"Sale ID", rec.SaleID},
+		{"Sold", fmt.Sprintf("%v", rec.Sold)},
+	}
+	recordAnalysis = nil
+	if snap := rec.Analysis; snap != nil {
+		recordAnalysis = []recordField{
+			{"Analyzed", snap.Time.Format("2006-01-02 15:04:05")},
+			{"Signal", string(snap.Signal)},
+			{"Confidence", fmt.Sprintf("%.0f%%", snap.Confidence*100)},
+			{"Spread", fmt.Sprintf("%.2f", snap.Spread)},
+			{"Ask price", fmt.Sprintf("%.2f", snap.Price)},
+			{"Period", fmt.Sprintf("%v in %v candles (%d)", snap.AnalysisPeriod, snap.Interval, snap.Candles)},
+			{"Moving average window", fmt.Sprintf("%d", snap.MovingAverageWindow)},
+			{"Open / Close", fmt.Sprintf("%.2f / %.2f", snap.Open, snap.Close)},
+			{"High / Low", fmt.Sprintf("%.2f / %.2f", snap.High, snap.Low)},
+			{"ATR", fmt.Sprintf("%.2f", snap.ATR)},
+		}
+	}
+}
+
+// closeRecordDetail returns to the stats page.
+func closeRecordDetail() {
+	selectedRecord, recordFields, recordAnalysis = nil, nil, nil
+}
+
+// openURL opens `url` in the default browser. It is not supported on android.
+func openURL(url string) error {
+	switch runtime.GOOS {
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "linux":
+		return exec.Command("xdg-open", url).Start()
+	}
+	return fmt.Errorf("opening links is not supported on %s", runtime.GOOS)
+}
+
+// layoutRecordDetail lays out every field of the selected record and the analysis it was opened on.
+func (win *Window) layoutRecordDetail(gtx C) D {
+	rec := selectedRecord
+	for recordBackBtn.Clicked() {
+		closeRecordDetail()
+	}
+	for copyOrderIDBtn.Clicked() {
+		if err := clipboard.WriteAll(rec.ID); err != nil {
+			recordDetailStatus = "Could not copy the order ID."
+		} else {
+			recordDetailStatus = "Order ID copied."
+		}
+	}
+	for openOrderBtn.Clicked() {
+		url := rec.OrderURL()
+		if err := openURL(url); err != nil {
+			// Fall back to the clipboard so the link can be pasted into a browser.
+			clipboard.WriteAll(url)
+			recordDetailStatus = "The link to the order was copied."
+		}
+	}
+	if selectedRecord == nil {
+		return win.layoutStatsWindow(gtx)
+	}
+	field := func(f recordField) layout.Widget {
+		return func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Flexed(0.4, material.Body2(win.theme, f.name).Layout),
+				layout.Flexed(0.6, material.Body1(win.theme, f.value).Layout),
+			)
+		}
+	}
+	widgets := []layout.Widget{
+		func(gtx C) D {
+			return pad.Layout(gtx, material.H6(win.theme, fmt.Sprintf("%v %s", rec.Type, rec.Asset)).Layout)
+		},
+	}
+	for _, f := range recordFields {
+		widgets = append(widgets, field(f))
+	}
+	widgets = append(widgets, func(gtx C) D {
+		return pad.Layout(gtx, material.H6(win.theme, "Analysis").Layout)
+	})
+	if len(recordAnalysis) == 0 {
+		widgets = append(widgets, material.Caption(win.theme, "No analysis was saved with this record.").Layout)
+	}
+	for _, f := range recordAnalysis {
+		widgets = append(widgets, field(f))
+	}
+	widgets = append(widgets, func(gtx C) D {
+		return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+			layout.Rigid(func(gtx C) D {
+				return pad.Layout(gtx, material.Button(win.theme, recordBackBtn, "Back").Layout)
+			}),
+			layout.Rigid(func(gtx C) D {
+				if rec.ID == "" {
+					return D{}
+				}
+				return pad.Layout(gtx, material.Button(win.theme, copyOrderIDBtn, "Copy order ID").Layout)
+			}),
+			layout.Rigid(func(gtx C) D {
+				if rec.OrderURL() == "" {
+					return D{}
+				}
+				return pad.Layout(gtx, material.Button(win.theme, openOrderBtn, "Open in Luno").Layout)
+			}),
+		)
+	})
+	if recordDetailStatus != "" {
+		widgets = append(widgets, material.Caption(win.theme, recordDetailStatus).Layout)
+	}
+	return recordDetailList.Layout(gtx, len(widgets), func(gtx C, i int) D {
+		return layout.UniformInset(unit.Dp(5)).Layout(gtx, widgets[i])
+	})
+}
@@ -0,0 +1,291 @@
+package material
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/michaellormann/leprechaun/backtest"
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+const (
+	// replaySessionLength is how far back the replay of a live session starts.
+	replaySessionLength = 72 * time.Hour
+	// replayCandles is the number of candles shown on the replay chart, the current one last.
+	replayCandles = 60
+)
+
+// replaySessionButton opens the replay of the last live session of an asset.
+type replaySessionButton struct {
+	asset string
+	btn   *widget.Clickable
+}
+
+var (
+	replayOpen         bool // Whether the replay page is shown instead of the stats page.
+	currentReplay      backtest.Replay
+	replayCursor       int // Index of the current candle of the replay.
+	replayStatus       string
+	replayCpbl         *Collapsible
+	replaySessionBtns  []replaySessionButton
+	replayFileEdit     *Editor
+	replayLoadBtn      = new(widget.Clickable)
+	replayPrevBtn      = new(widget.Clickable)
+	replayNextBtn      = new(widget.Clickable)
+	replayNextEventBtn = new(widget.Clickable)
+	replayBackBtn      = new(widget.Clickable)
+	replayList         = &layout.List{Axis: layout.Vertical}
+)
+
+// replaySetup creates the widgets that open replays.
+func (win *Window) replaySetup() {
+	replayCpbl = win.newCollapsible()
+	replayFileEdit = win.newEditor("Backtest result", "Path of a result saved with the backtest command's -json flag")
+	replaySessionBtns = nil
+	for _, asset := range win.cfg.AssetsToTrade {
+		replaySessionBtns = append(replaySessionBtns, replaySessionButton{asset: asset, btn: new(widget.Clickable)})
+	}
+}
+
+// openSessionReplay shows the replay of the live trading of `asset` over the last few days.
+func (win *Window) openSessionReplay(asset string) {
+	var plugin leper.Analyzer
+	if p, err := leper.PluginHandler.Plugin(win.cfg.Trade.AnalysisPlugin.Name); err == nil {
+		plugin = p
+	}
+	interval := leper.ResolveAnalysisOptions(plugin, asset).Interval
+	to := time.Now()
+	replay, err := backtest.SessionReplay(asset, win.cfg.CurrencyCode, interval, to.Add(-replaySessionLength), to)
+	if err != nil {
+		replayStatus = fmt.Sprintf("Could not replay %s. Reason: %v", asset, err)
+		return
+	}
+	openReplay(replay)
+}
+
+// openResultReplay shows the replay of the backtest result saved at `path`.
+func openResultReplay(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		replayStatus = fmt.Sprintf("Could not open %s. Reason: %v", path, err)
+		return
+	}
+	defer file.Close()
+	result, err := backtest.LoadResult(file)
+	if err != nil {
+		replayStatus = fmt.Sprintf("Could not load %s. Reason: %v", path, err)
+		return
+	}
+	openReplay(backtest.ResultReplay(result))
+}
+
+// openReplay shows `replay` from its first decision.
+func openReplay(replay backtest.Replay) {
+	currentReplay, replayOpen, replayStatus = replay, true, ""
+	replayCursor = replay.NextEvent(-1)
+	if replayCursor < 0 {
+		replayCursor = 0
+		replayStatus = "Nothing was decided in this period."
+	}
+}
+
+// closeReplay returns to the stats page.
+func closeReplay() {
+	replayOpen, currentReplay = false, backtest.Replay{}
+}
+
+// layoutReplayOpeners lays out the buttons that open the replays of past sessions and backtests.
+func (win *Window) layoutReplayOpeners(gtx C) D {
+	for _, b := range replaySessionBtns {
+		for b.btn.Clicked() {
+			win.openSessionReplay(b.asset)
+		}
+	}
+	for replayLoadBtn.Clicked() {
+		if path := strings.TrimSpace(replayFileEdit.Editor.Text()); path != "" {
+			openResultReplay(path)
+		}
+	}
+	sessions := []layout.FlexChild{}
+	for _, b := range replaySessionBtns {
+		b := b
+		sessions = append(sessions, layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, material.Button(win.theme, b.btn, b.asset).Layout)
+		}))
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(material.Body2(win.theme, fmt.Sprintf("Replay the last %d hours of live trading:",
+			int(replaySessionLength.Hours()))).Layout),
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, sessions...)
+		}),
+		layout.Rigid(replayFileEdit.Layout),
+		layout.Rigid(func(gtx C) D {
+			return pad.Layout(gtx, material.Button(win.theme, replayLoadBtn, "Replay backtest").Layout)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if replayStatus == "" || replayOpen {
+				return D{}
+			}
+			return material.Caption(win.theme, replayStatus).Layout(gtx)
+		}),
+	)
+}
+
+// layoutReplay lays out the chart of the open replay, the decisions taken on the current candle and the
+// buttons that step through them.
+func (win *Window) layoutReplay(gtx C) D {
+	for replayBackBtn.Clicked() {
+		closeReplay()
+	}
+	if !replayOpen {
+		return win.layoutStatsWindow(gtx)
+	}
+	for replayPrevBtn.Clicked() {
+		if replayCursor > 0 {
+			replayCursor--
+		}
+	}
+	for replayNextBtn.Clicked() {
+		if replayCursor < len(currentReplay.Candles)-1 {
+			replayCursor++
+		}
+	}
+	for replayNextEventBtn.Clicked() {
+		if next := currentReplay.NextEvent(replayCursor); next >= 0 {
+			replayCursor, replayStatus = next, ""
+		} else {
+			replayStatus = "There are no more decisions in this replay."
+		}
+	}
+	candle := currentReplay.Candles[replayCursor]
+	widgets := []layout.Widget{
+		func(gtx C) D {
+			return pad.Layout(gtx, material.H6(win.theme, currentReplay.Title).Layout)
+		},
+		win.layoutReplayChart,
+		material.Body2(win.theme, fmt.Sprintf("Candle %d of %d, %s. Open %.2f, high %.2f, low %.2f, close %.2f",
+			replayCursor+1, len(currentReplay.Candles), candle.Time.Local().Format("2006-01-02 15:04"),
+			candle.Open, candle.High, candle.Low, candle.Close)).Layout,
+	}
+	events := currentReplay.EventsOf(replayCursor)
+	if len(events) == 0 {
+		widgets = append(widgets, material.Caption(win.theme, "Nothing was decided on this candle.").Layout)
+	}
+	for _, event := range events {
+		lbl := material.Body1(win.theme, fmt.Sprintf("%s  %s", event.Time.Local().Format("15:04:05"), event.Detail))
+		lbl.Color = replayEventColor(event)
+		widgets = append(widgets, lbl.Layout)
+	}
+	widgets = append(widgets, func(gtx C) D {
+		return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+			layout.Rigid(func(gtx C) D {
+				return pad.Layout(gtx, material.Button(win.theme, replayBackBtn, "Back").Layout)
+			}),
+			layout.Rigid(func(gtx C) D {
+				return pad.Layout(gtx, material.Button(win.theme, replayPrevBtn, "Previous").Layout)
+			}),
+			layout.Rigid(func(gtx C) D {
+				return pad.Layout(gtx, material.Button(win.theme, replayNextBtn, "Next").Layout)
+			}),
+			layout.Rigid(func(gtx C) D {
+				return pad.Layout(gtx, material.Button(win.theme, replayNextEventBtn, "Next decision").Layout)
+			}),
+		)
+	})
+	if replayStatus != "" {
+		widgets = append(widgets, material.Caption(win.theme, replayStatus).Layout)
+	}
+	return replayList.Layout(gtx, len(widgets), func(gtx C, i int) D {
+		return layout.UniformInset(unit.Dp(5)).Layout(gtx, widgets[i])
+	})
+}
+
+// replayEventColor returns the color an event is drawn in: entries in blue, exits in green or red as
+// they made a profit or a loss, and signals in gray.
+func replayEventColor(event backtest.ReplayEvent) color.RGBA {
+	switch event.Kind {
+	case backtest.EventEntry:
+		return ColorBlue
+	case backtest.EventExit:
+		if event.Profit < 0 {
+			return ColorDanger
+		}
+		return ColorGreen
+	}
+	return ColorGray
+}
+
+// layoutReplayChart draws the candles up to the current one, with a marker at the price of each entry
+// and exit and one above each candle a signal was emitted on. The current candle is highlighted.
+func (win *Window) layoutReplayChart(gtx C) D {
+	width := gtx.Constraints.Max.X
+	height := width / 2
+	first := replayCursor - replayCandles + 1
+	if first < 0 {
+		first = 0
+	}
+	candles := currentReplay.Candles[first : replayCursor+1]
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, c := range candles {
+		low, high = math.Min(low, c.Low), math.Max(high, c.High)
+	}
+	if high <= low {
+		high, low = high+1, low-1
+	}
+	// A margin at the top leaves room for the signal markers.
+	margin := float32(height) / 10
+	y := func(price float64) float32 {
+		return margin + float32((high-price)/(high-low))*(float32(height)-2*margin)
+	}
+	rect := func(col color.RGBA, x0, y0, x1, y1 float32) {
+		paint.ColorOp{Color: col}.Add(gtx.Ops)
+		paint.PaintOp{Rect: f32.Rectangle{Min: f32.Point{X: x0, Y: y0}, Max: f32.Point{X: x1, Y: y1}}}.Add(gtx.Ops)
+	}
+	rect(ColorSurface, 0, 0, float32(width), float32(height))
+	slot := float32(width) / replayCandles
+	body := slot * 0.6
+	for i, c := range candles {
+		x := float32(i) * slot
+		if first+i == replayCursor {
+			rect(win.theme.Color.Hint, x, 0, x+slot, float32(height))
+		}
+		col := ColorGreen
+		if c.Close < c.Open {
+			col = ColorDanger
+		}
+		center := x + slot/2
+		rect(col, center-0.5, y(c.High), center+0.5, y(c.Low))
+		top, bottom := y(math.Max(c.Open, c.Close)), y(math.Min(c.Open, c.Close))
+		if bottom-top < 1 {
+			bottom = top + 1
+		}
+		rect(col, center-body/2, top, center+body/2, bottom)
+		for _, event := range currentReplay.EventsOf(first + i) {
+			size := body
+			if size < 4 {
+				size = 4
+			}
+			marker := y(c.Close)
+			if event.Kind == backtest.EventSignal {
+				marker = margin / 2
+			} else if event.Price > 0 {
+				marker = y(math.Min(math.Max(event.Price, low), high))
+			}
+			rect(replayEventColor(event), center-size/2, marker-size/2, center+size/2, marker+size/2)
+		}
+	}
+	return D{Size: image.Point{X: width, Y: height}}
+}
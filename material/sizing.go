@@ -0,0 +1,57 @@
+package material
+
+import (
+	leper "github.com/michaellormann/leprechaun/core"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	sizerGroup                                                             *widget.Enum
+	equityFractionFloat, kellyFractionFloat, kellyMaxFloat                 *widget.Float
+	sizerHeader, equityFractionHeader, kellyFractionHeader, kellyMaxHeader *widgetHeader
+)
+
+// positionSizerSetup creates the position sizer widgets from the saved settings.
+func (win *Window) positionSizerSetup() {
+	sizing := win.cfg.Trade.Sizing
+	sizerGroup = &widget.Enum{Value: sizing.Sizer}
+	if sizerGroup.Value == "" {
+		sizerGroup.Value = leper.SizerFixedAmount
+	}
+	equityFractionFloat = &widget.Float{Value: float32(sizing.EquityFraction * 100)}
+	kellyFractionFloat = &widget.Float{Value: float32(sizing.KellyFraction * 100)}
+	kellyMaxFloat = &widget.Float{Value: float32(sizing.KellyMaxFraction * 100)}
+	sizerHeader = win.newWidgetHeader("How much Leprechaun spends on each entry. Kelly sizing uses the win rate of each currency's past trades.", "position sizing")
+	equityFractionHeader = win.newWidgetHeader("Share of the balance and holdings of a currency spent on each entry (fixed fraction):", "equity fraction")
+	kellyFractionHeader = win.newWidgetHeader("Share of the Kelly stake spent on each entry (50% is half Kelly):", "Kelly fraction")
+	kellyMaxHeader = win.newWidgetHeader("Largest share of the balance and holdings of a currency Kelly sizing may spend on an entry:", "Kelly limit")
+}
+
+// layoutPositionSizerSettings lays out the choice of position sizer and its options.
+func (win *Window) layoutPositionSizerSettings(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(sizerHeader.Layout),
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(material.RadioButton(win.theme, sizerGroup, leper.SizerFixedAmount, "Fixed Amount").Layout),
+				layout.Rigid(material.RadioButton(win.theme, sizerGroup, leper.SizerFixedFraction, "Fixed Fraction").Layout),
+				layout.Rigid(material.RadioButton(win.theme, sizerGroup, leper.SizerKelly, "Kelly").Layout),
+			)
+		}),
+		layout.Rigid(win.sliderSetting(equityFractionHeader, equityFractionFloat, 1, 50, "%.0f%%")),
+		layout.Rigid(win.sliderSetting(kellyFractionHeader, kellyFractionFloat, 10, 100, "%.0f%%")),
+		layout.Rigid(win.sliderSetting(kellyMaxHeader, kellyMaxFloat, 1, 50, "%.0f%%")),
+	)
+}
+
+// readPositionSizer returns the position sizer settings chosen by the user.
+func readPositionSizer(saved leper.SizingSettings) leper.SizingSettings {
+	saved.Sizer = sizerGroup.Value
+	saved.EquityFraction = float64dp(float64(equityFractionFloat.Value/100), 3)
+	saved.KellyFraction = float64dp(float64(kellyFractionFloat.Value/100), 3)
+	saved.KellyMaxFraction = float64dp(float64(kellyMaxFloat.Value/100), 3)
+	return saved
+}
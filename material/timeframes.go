@@ -0,0 +1,52 @@
+package material
+
+import (
+	"strconv"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+var (
+	timeframeGroup        *widget.Enum
+	timeframePeriodFloat  *widget.Float
+	timeframeHeader       *widgetHeader
+	timeframePeriodHeader *widgetHeader
+)
+
+// timeframesSetup creates the confirming timeframe widgets from the saved settings.
+func (win *Window) timeframesSetup() {
+	settings := win.cfg.Trade.Timeframes
+	timeframeGroup = &widget.Enum{}
+	if settings.Interval > 0 {
+		timeframeGroup.Value = strconv.Itoa(int(settings.Interval))
+	}
+	timeframePeriodFloat = &widget.Float{Value: float32(settings.Period)}
+	if timeframePeriodFloat.Value < 1 {
+		timeframePeriodFloat.Value = 3
+	}
+	timeframeHeader = win.newWidgetHeader("Only act on a signal when the trend of shorter candles agrees with the trend of the analyzed candles.", "timeframe confirmation")
+	timeframePeriodHeader = win.newWidgetHeader("Hours of shorter candles retrieved. Each candle is one request to the exchange.", "confirming period")
+}
+
+// readTimeframes returns the confirming candle length (in minutes) and period (in hours) chosen by the user.
+func readTimeframes() (interval, period int32) {
+	minutes, _ := strconv.Atoi(timeframeGroup.Value)
+	return int32(minutes), int32(timeframePeriodFloat.Value + 0.5)
+}
+
+// layoutTimeframeSettings lays out the choice of confirming timeframe and its period.
+func (win *Window) layoutTimeframeSettings(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(timeframeHeader.Layout),
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(material.RadioButton(win.theme, timeframeGroup, "", "Off").Layout),
+				layout.Rigid(material.RadioButton(win.theme, timeframeGroup, "15", "15 Minutes").Layout),
+				layout.Rigid(material.RadioButton(win.theme, timeframeGroup, "30", "30 Minutes").Layout),
+			)
+		}),
+		layout.Rigid(win.sliderSetting(timeframePeriodHeader, timeframePeriodFloat, 1, 12, "%.0f hours")),
+	)
+}
@@ -28,13 +28,6 @@ import (
 	// "git.sr.ht/~whereswaldon/niotify"
 )
 
-var (
-	// Version info
-	verMajor = 0
-	verMinor = 2
-	verPatch = 0
-)
-
 // var (
 // FGServiceClass is the foreground service helper class implemented in Java.
 // FGServiceClass = "com/github/michaellormann/leprechaun/ForegroundService"
@@ -53,8 +46,12 @@ var (
 	botStoppedChannel    = make(chan struct{})
 	purchaseAlertChannel = make(chan struct{}, 1)
 	saleAlertChannel     = make(chan struct{}, 1)
-	createModalChannel   = make(chan string)
-	closeModalChannel    = make(chan struct{})
+	proposalChannel      = make(chan *leper.TradeProposal, 1)
+	explanationChannel   = make(chan leper.SignalExplanation, 1)
+	// Settings saved while the bot runs are sent to it over configChannel.
+	configChannel      = make(chan *leper.Configuration, 1)
+	createModalChannel = make(chan string)
+	closeModalChannel  = make(chan struct{})
 
 	logMessagesCount = 0
 )
@@ -126,6 +123,7 @@ type Window struct {
 	cfg          *leper.Configuration
 	botState     uint
 	gtx          layout.Context
+	observing    string // Path of the state file shown in observer mode, if any.
 
 	// JNI
 	// jenv JNIEnv
@@ -166,6 +164,7 @@ func CreateWindow(th *material.Theme, cfg *leper.Configuration) *Window {
 	// win.theme.Color.Text = ColorBlue
 	leper.SetConfig(cfg)
 	win.initWidgets()
+	win.lockApp()
 	return win
 }
 
@@ -238,6 +237,9 @@ func (win *Window) createPages() {
 				if viewLedgerClicked {
 					return win.layoutLedgerView(gtx)
 				}
+				if exportHistoryClicked {
+					return win.layoutExportView(gtx)
+				}
 				return win.layoutStatsWindow(gtx)
 			},
 			Overflow: []materials.OverflowAction{
@@ -245,8 +247,28 @@ func (win *Window) createPages() {
 					Name: "View ledger",
 					Tag:  viewLedgerBtn,
 				},
+				{
+					Name: "Export history",
+					Tag:  exportHistoryBtn,
+				},
 			},
 		},
+		// Onboarding Page
+		{
+			NavItem: materials.NavItem{
+				Name: "Try Risk-Free",
+				Icon: PlusIcon,
+			},
+			layout: win.layoutOnboardingWindow,
+		},
+		// Changelog Page
+		{
+			NavItem: materials.NavItem{
+				Name: "What's New",
+				Icon: NewsIcon,
+			},
+			layout: win.layoutChangelogWindow,
+		},
 		// About Page
 		{
 			NavItem: materials.NavItem{
@@ -258,6 +280,14 @@ func (win *Window) createPages() {
 	}
 }
 
+// stopBot sends the bot the signal to stop, unless a signal is already waiting for it.
+func stopBot() {
+	select {
+	case cancelChannel <- struct{}{}:
+	default:
+	}
+}
+
 // Loop runs the main UI update loop
 func (win *Window) Loop() error {
 	var ops op.Ops
@@ -276,19 +306,36 @@ func (win *Window) Loop() error {
 		select {
 		case txt := <-logTextChannel:
 			win.setLogViewText(txt)
+		case state := <-observerStateChannel:
+			win.applyObservedState(state)
+		case err := <-observerErrorChannel:
+			leper.Logger.Printf("Could not read state file %s. Reason: %v", win.observing, err)
 		case err := <-fatalBotErrorChannel:
 			// There was an error with the bot
 			win.setLogViewText("Error: " + err.Error())
 			win.handleStartStop(false)
 		case <-purchaseAlertChannel:
 			win.loadPurchasesList()
+			win.loadPositions()
 			win.loadStats()
+			win.loadJournal()
+			win.loadProfitByPeriod()
+			win.loadLedgerIssues()
 		case <-saleAlertChannel:
 			win.loadSalesList()
+			win.loadPositions()
 			win.loadStats()
+			win.loadJournal()
+			win.loadProfitByPeriod()
+			win.loadLedgerIssues()
+		case proposal := <-proposalChannel:
+			win.handleTradeProposal(proposal)
+		case explanation := <-explanationChannel:
+			win.setLogViewText("Why: " + explanation.String())
 		case <-botStoppedChannel:
 			// We have recieved a signal to stop.
 			win.handleStartStop(false)
+			win.handlePaperSessionStopped()
 
 		case e := <-win.window.Events():
 			switch e := e.(type) {
@@ -300,10 +347,14 @@ func (win *Window) Loop() error {
 						win.window.Invalidate()
 					}
 				}
+			case system.StageEvent:
+				if e.Stage < system.StageRunning {
+					// Lock the app when it goes to the background.
+					win.lockApp()
+				}
 			case system.DestroyEvent:
-				//Send signal to Bot goroutine to stop it.
-				cancelChannel <- struct{}{}
-				// TODO:: Close the bot log file.
+				//Send signal to Bot goroutine to stop it. The app waits for it to stop before exiting.
+				stopBot()
 				return e.Err
 			case *system.CommandEvent:
 				switch e.Type {
@@ -321,6 +372,11 @@ func (win *Window) Loop() error {
 					Right:  e.Insets.Right,
 				}
 				gtx := layout.NewContext(&ops, e)
+				if appLocked {
+					win.env.pad.Layout(gtx, win.layoutLockScreen)
+					e.Frame(gtx.Ops)
+					continue
+				}
 				for _, event := range win.topBar.Events(gtx) {
 					switch event := event.(type) {
 					case materials.AppBarNavigationClicked:
@@ -332,10 +388,11 @@ func (win *Window) Loop() error {
 						if viewLedgerClicked == true {
 							viewLedgerClicked = false
 						}
+						exportHistoryClicked = false
 					case materials.AppBarOverflowActionClicked:
 						switch event.Tag {
 						case exitBtn:
-							cancelChannel <- struct{}{}
+							stopBot()
 							return nil
 						case restoreDefaultBtn:
 							err := win.restoreDefaulSettings()
@@ -345,6 +402,9 @@ func (win *Window) Loop() error {
 						case viewLedgerBtn:
 							viewLedgerClicked = true
 							win.topBar.ToggleContextual(gtx.Now, "Logs")
+						case exportHistoryBtn:
+							exportHistoryClicked, exportStatus = true, ""
+							win.topBar.ToggleContextual(gtx.Now, "Export")
 						}
 					}
 				}
@@ -448,7 +508,9 @@ func (win *Window) InitBackends(logBackends map[string]*log.Logger) {
 	log.Fatal("[Leprechaun-UI] error: bot log backend not provided.")
 }
 
-func (win *Window) runBot() {
+// runBot runs the trading loop with `settings`, a copy of the UI's settings that the bot owns.
+func (win *Window) runBot(settings *leper.Configuration) {
+	leper.SetConfig(settings)
 	bot := leper.NewBot()
 	channels = bot.Channels()
 	// channels = &leper.Channels{}
@@ -458,8 +520,15 @@ func (win *Window) runBot() {
 	channels.BotStopped(botStoppedChannel)
 	channels.Purchase(purchaseAlertChannel)
 	channels.Sale(saleAlertChannel)
+	channels.Proposal(proposalChannel)
+	channels.Explanation(explanationChannel)
+	channels.Config(configChannel)
 	bot.InitChannels(channels)
-	err := bot.Run(win.cfg)
+	err := bot.Run(settings)
+	if err == leper.ErrPaperSessionComplete {
+		win.setLogViewText("The paper trading session is complete. See the Try Risk-Free page for a summary.")
+		return
+	}
 	if err != nil && err != leper.ErrCancelled {
 		leper.Logger.Print("The trading loop has exited with error: ", err.Error())
 		win.setLogViewText(fmt.Sprintln("The trading loop has exited with error: ", err.Error()))
@@ -495,11 +564,21 @@ func (win *Window) handleStartStop(userEvent bool) {
 		// only consume one click at any one time
 		return
 	}
+	if win.observing != "" {
+		// The bot can not be controlled in observer mode.
+		botBtnClicked = 0
+		return
+	}
+	if win.botState == Stopped && win.cfg.ChangelogPending() {
+		win.setLogViewText("Leprechaun has been updated. Please review the changes on the What's New page before starting the bot.")
+		botBtnClicked = 0
+		return
+	}
 	if win.botState == Stopped && !botIsStopping {
 		logViewContents = []material.LabelStyle{} // Reset log view
 
 		// Start Leprechaun in the background
-		go win.runBot()
+		go win.runBot(win.cfg.Clone())
 
 		startStopbutton.Background = ColorRed
 		// notify(BotNotification, "Leprechaun is running...")
@@ -536,6 +615,8 @@ func (win *Window) handleStartStop(userEvent bool) {
 		botIsStopping = false
 		botBtnClicked = 0
 		win.botState = Stopped
+		// Leprechaun uses the settings the user saved while the bot ran again.
+		leper.SetConfig(win.cfg)
 	}
 }
 
@@ -612,17 +693,68 @@ func (win *Window) saveUserSettings(gtx layout.Context) D {
 	// TODO: Show `material.Loading` widget beside the apply button
 	var err error
 	cfg := win.cfg
+	if win.botState != Stopped {
+		// The running bot applies a copy of the settings at its next safe point.
+		cfg = win.cfg.Clone()
+	}
 	// Save general settings
 	if win.settingsPage == GeneralSettingsView {
 		// Add the General settings to the config struct
 		cfg.RandomSnooze = randomSnoozeSwitch.Value
 		cfg.SnoozePeriod = int32(snooozePeriodFloat.Value)
 		cfg.Verbose = displayLogSwitch.Value
+		cfg.StalePositionDays = int32(stalePositionDaysFloat.Value)
+		cfg.StalePositionAlerts = stalePositionAlertsSwitch.Value
+		if cfg.AppLock, err = readAppLock(win.cfg.AppLock); err != nil {
+			return win.alert(gtx, err.Error(), ColorDanger)
+		}
+		cfg.Inflation.Enabled = inflationSwitch.Value
+		cfg.Inflation.AnnualRate = float64dp(float64(inflationRateFloat.Value/100), 3)
+		cfg.FairScheduling = fairSchedulingSwitch.Value
+		cfg.DryRun = dryRunSwitch.Value
+		cfg.RoundCallBudget = int32(roundCallBudgetFloat.Value)
+		cfg.ErrorPause.Threshold = int(errorPauseFloat.Value)
+		cfg.Backup = readBackupSettings()
 
 	} else {
 
 		// Add Trade settings to the config struct
 		cfg.ProfitMargin = float64dp(float64(profitMarginFloat.Value/100), 3)
+		cfg.PurchasePercentage = float64dp(float64(purchasePercentFloat.Value/100), 3)
+		cfg.Trade.DCA = leper.DCASettings{
+			Enabled:   dcaSwitch.Value,
+			Purchases: int32(dcaPurchasesFloat.Value),
+			Window:    int32(dcaWindowFloat.Value) * 60,
+		}
+		cfg.Trade.Pyramid.Enabled = pyramidSwitch.Value
+		cfg.Trade.Sizing = readPositionSizer(cfg.Trade.Sizing)
+		cfg.Trade.StreakSizing.Enabled = streakSizingSwitch.Value
+		cfg.Trade.VolatilitySizing.Enabled = volatilitySizingSwitch.Value
+		cfg.Trade.IdleSkip.Enabled = idleSkipSwitch.Value
+		cfg.Trade.StrategyKill.Enabled = strategyKillSwitch.Value
+		cfg.Trade.StrategyKill.MinWinRate = float64dp(float64(minWinRateFloat.Value/100), 2)
+		cfg.Trade.IdleSkip.PriceEpsilon = float64dp(float64(idleSkipEpsilonFloat.Value/100), 5)
+		cfg.Trade.Risk = leper.RiskSettings{
+			Enabled:              riskSwitch.Value,
+			MaxAssetExposure:     float64dp(float64(assetExposureFloat.Value/100), 3),
+			MaxPortfolioExposure: float64dp(float64(portfolioExposureFloat.Value/100), 3),
+			MaxDrawdown:          float64dp(float64(maxDrawdownFloat.Value/100), 3),
+		}
+		cfg.Trade.ManualApproval = approvalSwitch.Value
+		cfg.Trade.PairStatus.ExitPositions = pairExitSwitch.Value
+		cfg.Trade.ReferencePrice = leper.ReferencePriceSettings{
+			Enabled:      referencePriceSwitch.Value,
+			MaxDeviation: float64dp(float64(referenceDeviationFloat.Value/100), 3),
+		}
+		cfg.Trade.PatternSensitivity = leper.PatternSensitivity{
+			DojiTolerance:    float64dp(float64(dojiToleranceFloat.Value/100), 2),
+			BodyRatio:        float64dp(float64(bodyRatioFloat.Value/100), 2),
+			WickRatio:        float64dp(float64(wickRatioFloat.Value), 1),
+			EngulfingOverlap: float64dp(float64(engulfingOverlapFloat.Value/100), 2),
+		}
+		if err = cfg.Trade.PatternSensitivity.Validate(); err != nil {
+			return win.alert(gtx, "Invalid candlestick pattern settings", ColorDanger)
+		}
 		cfg.PurchaseUnit, err = strconv.ParseFloat(purchaseUnitEdit.Editor.Text(), 64)
 		if err != nil {
 			return win.alert(gtx, "Invalid value for purchase unit", ColorDanger)
@@ -649,17 +781,71 @@ func (win *Window) saveUserSettings(gtx layout.Context) D {
 		case "contrarian":
 			cfg.Trade.TradingMode = leper.Contrarian
 		}
+		cfg.Trade.Execution = executionGroup.Value
+		if analysisPluginGroup.Value != "" {
+			cfg.Trade.AnalysisPlugin.Name = analysisPluginGroup.Value
+		}
+		cfg.Trade.VolumeWeightedPrice = volumeWeightedSwitch.Value
+		if cfg.Trade.AnalysisPeriod, cfg.Trade.AnalysisInterval, err = readAnalysisWindow(); err != nil {
+			return win.alert(gtx, err.Error(), ColorDanger)
+		}
+		cfg.Trade.Timeframes.Interval, cfg.Trade.Timeframes.Period = readTimeframes()
+		cfg.Trade.Model.Path = readModelPath()
+		cfg.Trade.Model.Threshold = float64dp(float64(modelThresholdFloat.Value/100), 3)
+		if cfg.Trade.AnalyzerOverrides, err = readAnalyzerOverrides(); err != nil {
+			return win.alert(gtx, err.Error(), ColorDanger)
+		}
+		if cfg.Trade.DailyLoss, err = readDailyLoss(); err != nil {
+			return win.alert(gtx, err.Error(), ColorDanger)
+		}
+		cfg.Trade.SessionStop.Enabled = sessionStopSwitch.Value
+		cfg.Trade.SessionStop.MaxDrop = float64dp(float64(sessionStopFloat.Value/100), 3)
+		cfg.Trade.Confidence.MinConfidence = float64dp(float64(minConfidenceFloat.Value/100), 3)
+		cfg.Trade.Confidence.ScaleSize = confidenceSizingSwitch.Value
+		cfg.Trade.FlashMove.Enabled = flashMoveSwitch.Value
+		cfg.Trade.FlashMove.MaxMove = float64dp(float64(flashMoveFloat.Value/100), 3)
+		if cfg.Trade.ExposureCaps, err = readExposureCaps(); err != nil {
+			return win.alert(gtx, err.Error(), ColorDanger)
+		}
+		if cfg.Trade.MaxOpenPositions, err = readMaxOpenPositions(); err != nil {
+			return win.alert(gtx, err.Error(), ColorDanger)
+		}
 	}
 
+	if cfg != win.cfg {
+		// The bot owns the copy it is sent, and the UI keeps showing the settings the user saved.
+		sendSettings(cfg.Clone())
+		if updateErr := win.cfg.Update(cfg, false); updateErr != nil {
+			return win.alert(gtx, updateErr.Error(), ColorRed)
+		}
+		win.setLogViewText("Your settings will be applied once the current trades are complete.")
+		return D{}
+	}
 	// Update Leprechuan's settings
 	updateErr := win.cfg.Update(cfg, false)
 	if updateErr != nil {
 		return win.alert(gtx, err.Error(), ColorRed)
 	}
 	win.cfg.Save()
+	leper.SetConfig(win.cfg)
 	return D{}
 }
 
+// sendSettings sends settings saved while the bot runs to the bot, in place of any it has not applied yet.
+func sendSettings(cfg *leper.Configuration) {
+	for {
+		select {
+		case configChannel <- cfg:
+			return
+		default:
+			select {
+			case <-configChannel:
+			default:
+			}
+		}
+	}
+}
+
 func (win *Window) restoreDefaulSettings() error {
 	appDir, err := app.DataDir()
 	if err != nil {
@@ -669,6 +855,7 @@ func (win *Window) restoreDefaulSettings() error {
 	if err != nil {
 		return err
 	}
+	leper.SetConfig(win.cfg)
 	defaultSettingsRestored = true
 	return nil
 }
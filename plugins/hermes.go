@@ -9,9 +9,11 @@ import (
 	core "github.com/michaellormann/leprechaun/core"
 )
 
-var (
-	HRM = Hermes{NumPrices: 21, PriceInterval: 60 * time.Minute}
-)
+// NewHermes creates an instance of Hermes with its default price dimensions. Each asset is analyzed by
+// an instance of its own.
+func NewHermes() core.Analyzer {
+	return &Hermes{NumPrices: 21, PriceInterval: 60 * time.Minute}
+}
 
 func init() {
 	// This is added here, because init functions execute in no given order,
@@ -21,10 +23,8 @@ func init() {
 	if err != nil {
 		log.Fatal("Could not initialize plugins")
 	}
-	// Register the plugin
-	// core.PluginHandler.Register("hermes", Hermes{NumPrices: 21, PriceInterval: 60 * time.Minute})
-	core.PluginHandler.Register("hermes", HRM)
-	core.PluginHandler.Default = HRM
+	// Register the plugin. Hermes is the default plugin, so it is also set as `PluginHandler.Default`.
+	core.PluginHandler.RegisterFactory("hermes", NewHermes)
 	// TODO: Expose the price dimensions parameters to the user, so they can change it if they want to.
 	log.Println("hermes plugin registered")
 }
@@ -52,6 +52,8 @@ type Hermes struct {
 	predictedMove    core.ChartTrend
 	options          *core.AnalysisOptions
 	indicatorScores  []Score
+	scoredIndicators []string // Name of the indicator each score was given to.
+	depth            *core.OrderBookDepth
 }
 
 const (
@@ -65,8 +67,27 @@ const (
 	//    has its own score with respect to the overall chart trend. The margin of the difference between
 	// 	  the current price and the moving average also influences the score. The greater the margin the
 	//    higher the score.
-	// 3. Oscillators (Under construction)
-	NumIndicators = 3
+	// 3. The RSI oscillator.
+	//    The Relative Strength Index of the closing prices shows whether the asset is overbought (at the top)
+	//    or oversold (at the bottom). Each level has its own score with respect to the overall chart trend.
+	// 4. The Bollinger Bands.
+	//    The current price is examined to see if it has broken out above the upper band or below the lower
+	//    band of the closing prices. Each breakout has its own score with respect to the overall chart trend.
+	// 5. The Volume Weighted Average Price.
+	//    The current price is examined to see if it is below or above the VWAP of the candles, i.e. whether
+	//    the asset is cheap or dear relative to where most of its volume traded.
+	// 6. The depth of the order book.
+	//    The volume of the resting bids and asks near the current price is compared. Heavy bids support the
+	//    price and heavy asks cap it. Each imbalance has its own score with respect to the overall chart trend.
+	NumIndicators = 6
+
+	// BollingerWindow is the number of closing prices the Bollinger Bands are drawn over.
+	BollingerWindow = 20
+	// BollingerDeviations is the number of standard deviations between the middle band and the outer bands.
+	BollingerDeviations = 2.0
+	// DepthImbalanceThreshold is the imbalance of the order book depth (see core.OrderBookDepth.Imbalance)
+	// above which one side of the book is considered heavier than the other.
+	DepthImbalanceThreshold = 0.2
 )
 
 // Score is a weigth for each analysis parameter.
@@ -86,7 +107,6 @@ const (
 )
 const (
 	// Scores for the Indicators hermes checks
-	// TODO:: add bollinger bands inicator
 	bullChartMajorBullPattern         = ScoreOne
 	bullChartMajorBullPatternReversal = Score3Quarter
 	bullChartMajorBearPattern         = ScoreHalf
@@ -113,6 +133,21 @@ const (
 	bearChartRSIBottom = ScoreHalf
 	bullChartRSITop    = ScoreHalf
 	bullChartRSIBottom = ScoreOne
+
+	bullChartAboveUpperBand = ScoreHalf
+	bullChartBelowLowerBand = ScoreOne
+	bearChartAboveUpperBand = ScoreOne
+	bearChartBelowLowerBand = ScoreHalf
+
+	bullChartAboveVWAP = ScoreHalf
+	bullChartBelowVWAP = ScoreOne
+	bearChartAboveVWAP = ScoreOne
+	bearChartBelowVWAP = ScoreHalf
+
+	bullChartBidHeavy = ScoreOne
+	bullChartAskHeavy = ScoreHalf
+	bearChartAskHeavy = ScoreOne
+	bearChartBidHeavy = ScoreHalf
 )
 
 var (
@@ -127,51 +162,101 @@ var (
 )
 
 // Description gives a brief summary of what the plugin does and how.
-func (plugin Hermes) Description() string {
+func (plugin *Hermes) Description() string {
 	return `"Hermes is an analysis pipeline that analyzes the prices of an asset by checking a number of indicators.
 	each indicator is scored and a final score is extracted from the combination of all indicators. The final score
 	the determines the signal emitted by  Hermes, i.e BUY, SELL, WAIT"`
 }
 
 // SetOptions configures the plugin with the bots specifications
-func (plugin Hermes) SetOptions(opts *core.AnalysisOptions) error {
+func (plugin *Hermes) SetOptions(opts *core.AnalysisOptions) error {
+	if opts == nil {
+		return nil
+	}
 	plugin.options = opts
-	totalAnalysisHours := opts.AnalysisPeriod.Hours()
-	plugin.NumPrices = int(totalAnalysisHours / opts.Interval.Hours())
+	if opts.Interval > 0 {
+		plugin.NumPrices = int(opts.AnalysisPeriod / opts.Interval)
+	}
 	plugin.tradeMode = opts.Mode
+	plugin.mAvgWindow = opts.MovingAverageWindow
 	return nil
 }
 
+// DefaultOptions returns the analysis options preferred by Hermes. They may be overridden per asset.
+func (plugin *Hermes) DefaultOptions() core.AnalysisOptions {
+	return core.AnalysisOptions{Interval: plugin.PriceInterval, MovingAverageWindow: 20}
+}
+
 // SetCurrentPrice ...
-func (plugin Hermes) SetCurrentPrice(price float64) error {
+func (plugin *Hermes) SetCurrentPrice(price float64) error {
 	plugin.currentPrice = price
 	return nil
 }
 
 // SetClosingPrices ...
-func (plugin Hermes) SetClosingPrices(prices []float64) error {
+func (plugin *Hermes) SetClosingPrices(prices []float64) error {
 	plugin.prices = prices
 	plugin.LineChart = core.NewLineChart(prices)
+	if plugin.mAvgWindow > 0 {
+		plugin.LineChart.MovingAverage["PERIOD"] = plugin.mAvgWindow
+	}
 	return nil
 }
 
 // SetOHLC ...
-func (plugin Hermes) SetOHLC(candles []core.OHLC) error {
+func (plugin *Hermes) SetOHLC(candles []core.OHLC) error {
 	plugin.CandlestickChart = core.NewCandleChart(candles)
+	if plugin.options != nil {
+		// The patterns are detected with the thresholds set for the asset.
+		plugin.CandlestickChart.Sensitivity = plugin.options.Patterns
+	}
 	return nil
 }
 
-func (plugin Hermes) addScore(score Score) {
+// SetOrderBookDepth ...
+func (plugin *Hermes) SetOrderBookDepth(depth core.OrderBookDepth) error {
+	plugin.depth = &depth
+	return nil
+}
+
+func (plugin *Hermes) addScore(indicator string, score Score) {
 	plugin.indicatorScores = append(plugin.indicatorScores, score)
+	plugin.scoredIndicators = append(plugin.scoredIndicators, indicator)
+}
+
+// Explain returns the trend, patterns, price position and scores behind the last signal.
+func (plugin *Hermes) Explain() (explanation core.Explanation) {
+	explanation.Trend = string(plugin.LineChart.Trend)
+	for _, pattern := range plugin.CandlestickChart.BullishPatterns {
+		explanation.Patterns = append(explanation.Patterns, pattern.Pattern.String())
+	}
+	for _, pattern := range plugin.CandlestickChart.BearishPatterns {
+		explanation.Patterns = append(explanation.Patterns, pattern.Pattern.String())
+	}
+	switch {
+	case plugin.pos.Above:
+		explanation.PricePosition = "above"
+	case plugin.pos.Below:
+		explanation.PricePosition = "below"
+	case plugin.pos.Stable:
+		explanation.PricePosition = "at"
+	}
+	for i, score := range plugin.indicatorScores {
+		explanation.Scores = append(explanation.Scores, core.IndicatorScore{Indicator: plugin.scoredIndicators[i],
+			Score: float64(score)})
+	}
+	return
 }
 
 // Analyze examines market data and determines whether there is an uptrend of downtrend of price
-func (plugin Hermes) analyze() (err error) {
+func (plugin *Hermes) analyze() (err error) {
 	// Note: this function is a work in progress, it currently holds very simple techniques that
 	// will be updated later.
 	// todo:: provide option to just analyze price trend without any ema, i.e. don't take mean reversion into
 	// consideration.
 
+	// The scores of the previous analysis are cleared.
+	plugin.indicatorScores, plugin.scoredIndicators = nil, nil
 	// Determine the current price position with respect to the moving average
 	plugin.doPricePosition()
 	// Determine the price movement
@@ -198,19 +283,20 @@ func (plugin Hermes) analyze() (err error) {
 				core.BullishRisingThree, core.BullishRisingTwo, core.MorningDojiStar:
 				if detectedBullishPattern.PreceedingTrend.IsBullish() {
 					// bullish continuation pattern.
-					plugin.addScore(bullChartMajorBullPattern)
+					plugin.addScore("Candlestick pattern", bullChartMajorBullPattern)
 				} else if detectedBullishPattern.PreceedingTrend.IsBearish() {
 					// bullish trend preceeded by a bearish pattern.
-					plugin.addScore(bullChartMajorBullPatternReversal)
+					plugin.addScore("Candlestick pattern", bullChartMajorBullPatternReversal)
 				}
 
-			case core.BullishHarami, core.BullishHaramiCross:
+			case core.BullishHarami, core.BullishHaramiCross, core.BullishHammer, core.BullishInvertedHammer,
+				core.BullishDragonflyDoji, core.BullishDoji:
 				if detectedBullishPattern.PreceedingTrend.IsBullish() {
 					// bullish continuation pattern.
-					plugin.addScore(bullChartMinorBullPattern)
+					plugin.addScore("Candlestick pattern", bullChartMinorBullPattern)
 				} else if detectedBullishPattern.PreceedingTrend.IsBearish() {
 					// bullish trend preceeded by a bearish pattern.
-					plugin.addScore(bullChartMinorBullPatternReversal)
+					plugin.addScore("Candlestick pattern", bullChartMinorBullPatternReversal)
 				}
 			}
 		}
@@ -225,17 +311,18 @@ func (plugin Hermes) analyze() (err error) {
 				// [REMOVE] Trend reversal is likely imminent. esp. if these patterns occur at the top.
 				if detectedBearishPattern.PreceedingTrend.IsBearish() {
 					// bearish continuation pattern.
-					plugin.addScore(bullChartMajorBearPattern)
+					plugin.addScore("Candlestick pattern", bullChartMajorBearPattern)
 				} else if detectedBearishPattern.PreceedingTrend.IsBullish() {
 					// bearish pattern preceeded by a bullish trend. i.e. current trend is a reversal
-					plugin.addScore(bullChartMajorBearPatternReversal)
+					plugin.addScore("Candlestick pattern", bullChartMajorBearPatternReversal)
 				}
-			case core.BearishHarami, core.BearishHaramiCross:
+			case core.BearishHarami, core.BearishHaramiCross, core.BearishHangingMan, core.BearishShootingStar,
+				core.BearishGravestoneDoji, core.BearishDoji:
 				if detectedBearishPattern.PreceedingTrend.IsBullish() {
 					// TODO:: Refine this segment, possibly define new scores for the above patterns
-					plugin.addScore(bullChartMinorBearPatternReversal)
+					plugin.addScore("Candlestick pattern", bullChartMinorBearPatternReversal)
 				} else if detectedBearishPattern.PreceedingTrend.IsBearish() {
-					plugin.addScore(bullChartMinorBearPattern)
+					plugin.addScore("Candlestick pattern", bullChartMinorBearPattern)
 				}
 			}
 		}
@@ -252,10 +339,10 @@ func (plugin Hermes) analyze() (err error) {
 				// [REMOVE] Trend reversal is likely imminent. esp. if these patterns occur at the top.
 				if pattern.PreceedingTrend.IsBullish() {
 					// bearish pattern preceeded by a bullish trend. i.e. current trend is a reversal
-					plugin.addScore(bearChartMajorBearPatternReversal)
+					plugin.addScore("Candlestick pattern", bearChartMajorBearPatternReversal)
 				} else if pattern.PreceedingTrend.IsBearish() {
 					// bearish continuation pattern.
-					plugin.addScore(bearChartMajorBearPattern)
+					plugin.addScore("Candlestick pattern", bearChartMajorBearPattern)
 				}
 				// if plugin.tradeMode == TrendFollowing {
 				// 	// If bearish reversal occurs near the bottom keep going, else reverse trade direction.
@@ -266,12 +353,13 @@ func (plugin Hermes) analyze() (err error) {
 				// } else if pattern.PreceedingTrend.IsBearish() {
 				// 	// bearish continuation pattern.
 				// }
-			case core.BearishHarami, core.BearishHaramiCross:
+			case core.BearishHarami, core.BearishHaramiCross, core.BearishHangingMan, core.BearishShootingStar,
+				core.BearishGravestoneDoji, core.BearishDoji:
 				if pattern.PreceedingTrend.IsBullish() {
 					// TODO:: Refine this segment, possibly define new scores for the above patterns
-					plugin.addScore(bearChartMajorBearPatternReversal - ScoreQuarter)
+					plugin.addScore("Candlestick pattern", bearChartMajorBearPatternReversal-ScoreQuarter)
 				} else if pattern.PreceedingTrend.IsBearish() {
-					plugin.addScore(bearChartMajorBearPattern - ScoreQuarter)
+					plugin.addScore("Candlestick pattern", bearChartMajorBearPattern-ScoreQuarter)
 				}
 			}
 		}
@@ -285,34 +373,106 @@ func (plugin Hermes) analyze() (err error) {
 				core.BullishRisingThree, core.BullishRisingTwo, core.MorningDojiStar:
 				if pattern.PreceedingTrend.IsBullish() {
 					// bullish continuation pattern.
-					plugin.addScore(bearChartMajorBullPattern)
+					plugin.addScore("Candlestick pattern", bearChartMajorBullPattern)
 				} else if pattern.PreceedingTrend.IsBearish() {
 					// bullish trend preceeded by a bearish pattern.
-					plugin.addScore(bearChartMajorBullPatternReversal)
+					plugin.addScore("Candlestick pattern", bearChartMajorBullPatternReversal)
 				}
 
-			case core.BullishHarami, core.BullishHaramiCross:
+			case core.BullishHarami, core.BullishHaramiCross, core.BullishHammer, core.BullishInvertedHammer,
+				core.BullishDragonflyDoji, core.BullishDoji:
 				if pattern.PreceedingTrend.IsBullish() {
 					// bullish continuation pattern.
-					plugin.addScore(bearChartMajorBearPattern - ScoreQuarter)
+					plugin.addScore("Candlestick pattern", bearChartMajorBearPattern-ScoreQuarter)
 				} else if pattern.PreceedingTrend.IsBearish() {
 					// bullish trend preceeded by a bearish pattern.
-					plugin.addScore(bearChartMajorBearPattern - ScoreQuarter)
+					plugin.addScore("Candlestick pattern", bearChartMajorBearPattern-ScoreQuarter)
 				}
 			}
 		}
 	}
 
+	// Score the RSI oscillator against the overall trend of the chart.
+	if rsi, err := RSI(plugin.prices, RSIPeriod); err != nil {
+		// Too few prices is not fatal. The other indicators are still scored.
+		log.Printf("The RSI could not be computed: %v", err)
+	} else {
+		log.Printf("RSI for current price data is: %.1f", rsi)
+		switch {
+		case rsi >= RSIOverbought && chartTrend == Bullish:
+			plugin.addScore("RSI", bullChartRSITop)
+		case rsi <= RSIOversold && chartTrend == Bullish:
+			plugin.addScore("RSI", bullChartRSIBottom)
+		case rsi >= RSIOverbought && chartTrend == Bearish:
+			plugin.addScore("RSI", bearChartRSITop)
+		case rsi <= RSIOversold && chartTrend == Bearish:
+			plugin.addScore("RSI", bearChartRSIBottom)
+		}
+	}
+
+	// Score a breakout of the current price from the Bollinger Bands against the overall trend of the chart.
+	if bands, err := core.BB(plugin.prices, BollingerWindow, BollingerDeviations); err != nil {
+		log.Printf("The Bollinger Bands could not be computed: %v", err)
+	} else {
+		log.Printf("Bollinger Bands for current price data are: %.2f / %.2f / %.2f", bands.Lower, bands.Middle, bands.Upper)
+		switch {
+		case plugin.currentPrice <= 0:
+			// The current price is unknown, so there is no breakout to score.
+		case plugin.currentPrice > bands.Upper && chartTrend == Bullish:
+			plugin.addScore("Bollinger Bands", bullChartAboveUpperBand)
+		case plugin.currentPrice < bands.Lower && chartTrend == Bullish:
+			plugin.addScore("Bollinger Bands", bullChartBelowLowerBand)
+		case plugin.currentPrice > bands.Upper && chartTrend == Bearish:
+			plugin.addScore("Bollinger Bands", bearChartAboveUpperBand)
+		case plugin.currentPrice < bands.Lower && chartTrend == Bearish:
+			plugin.addScore("Bollinger Bands", bearChartBelowLowerBand)
+		}
+	}
+
+	// Score the position of the current price relative to the VWAP against the overall trend of the chart.
+	if vwap, err := core.VWAP(plugin.CandlestickChart.Candles); err != nil {
+		log.Printf("The VWAP could not be computed: %v", err)
+	} else if plugin.currentPrice > 0 {
+		log.Printf("VWAP for current price data is: %.2f", vwap)
+		switch {
+		case plugin.currentPrice > vwap && chartTrend == Bullish:
+			plugin.addScore("VWAP", bullChartAboveVWAP)
+		case plugin.currentPrice < vwap && chartTrend == Bullish:
+			plugin.addScore("VWAP", bullChartBelowVWAP)
+		case plugin.currentPrice > vwap && chartTrend == Bearish:
+			plugin.addScore("VWAP", bearChartAboveVWAP)
+		case plugin.currentPrice < vwap && chartTrend == Bearish:
+			plugin.addScore("VWAP", bearChartBelowVWAP)
+		}
+	}
+
+	// Score the imbalance of the resting orders near the current price against the overall trend of the chart.
+	if plugin.depth != nil {
+		imbalance := plugin.depth.Imbalance()
+		log.Printf("Order book depth within %.1f%% of the price: %.4f bid / %.4f asked (imbalance %.2f)",
+			plugin.depth.Band*100, plugin.depth.BidVolume, plugin.depth.AskVolume, imbalance)
+		switch {
+		case imbalance >= DepthImbalanceThreshold && chartTrend == Bullish:
+			plugin.addScore("Order book depth", bullChartBidHeavy)
+		case imbalance <= -DepthImbalanceThreshold && chartTrend == Bullish:
+			plugin.addScore("Order book depth", bullChartAskHeavy)
+		case imbalance <= -DepthImbalanceThreshold && chartTrend == Bearish:
+			plugin.addScore("Order book depth", bearChartAskHeavy)
+		case imbalance >= DepthImbalanceThreshold && chartTrend == Bearish:
+			plugin.addScore("Order book depth", bearChartBidHeavy)
+		}
+	}
+
 	return nil
 }
 
 // Score the parameters examined to get a final score.
-func (plugin Hermes) Score() {
+func (plugin *Hermes) Score() {
 
 }
 
 // doEMA computes the exponential moving average for past prices collected from the exchange.
-func (plugin Hermes) doEMA() {
+func (plugin *Hermes) doEMA() {
 	ema := ewma.NewMovingAverage()
 	fmt.Println("In ema")
 	for _, price := range plugin.prices {
@@ -323,7 +483,7 @@ func (plugin Hermes) doEMA() {
 }
 
 // doPricePosition determines postion of current price relative to the moving average.
-func (plugin Hermes) doPricePosition() {
+func (plugin *Hermes) doPricePosition() {
 	// TODO:: The margin should be compared as a percentage of the difference between the current price and
 	// the most recent price point. i.e. P(n) - P(n-1) = std_margin. margin% = margin/std_margin * 100
 	plugin.pos = core.PricePosition{}
@@ -344,11 +504,7 @@ func (plugin Hermes) doPricePosition() {
 }
 
 // Emit emits a BUY, SELL or WAIT signal based on data from `analyze()`
-func (plugin Hermes) Emit() (signal core.SIGNAL, err error) {
-	// TODO:: USE LUNO ORDER REQUEST V2 TO SEE WHAT ORDERS ARE IN THE ORDERBOOK.
-	// IF AN ORDER HAS A HIGH NUMBER OF ASSET ATTACHED TO IT AND IT IS RELATIVELY CLOSE TO YOUR PROFIT MARK
-	// YOU CAN ALIGN WITH IT.
-
+func (plugin *Hermes) Emit() (signal core.SIGNAL, err error) {
 	// TODO:: FINAL SCORING SHOULD BE IMPLEMENTED WITH FUZZY LOGIC.
 
 	err = plugin.analyze()
@@ -0,0 +1,189 @@
+package plugins
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	core "github.com/michaellormann/leprechaun/core"
+)
+
+func init() {
+	if err := core.InitPlugins(); err != nil {
+		log.Fatal("Could not initialize plugins")
+	}
+	core.PluginHandler.RegisterFactory("ichimoku", NewIchimoku)
+	log.Println("ichimoku plugin registered")
+}
+
+// NewIchimoku creates an instance of the Ichimoku plugin with the traditional periods of its lines.
+func NewIchimoku() core.Analyzer {
+	return &Ichimoku{TenkanPeriod: 9, KijunPeriod: 26, SenkouPeriod: 52, PriceInterval: 60 * time.Minute}
+}
+
+// Ichimoku is an analysis plugin for longer-horizon trend signals. It draws the Ichimoku Cloud
+// (Ichimoku Kinko Hyo) over the candles of an asset and signals a trade when the conversion line
+// (Tenkan-sen) crosses the base line (Kijun-sen) on the side of the cloud the price is on.
+// It always follows the trend, whatever the trading mode.
+type Ichimoku struct {
+	TenkanPeriod  int           // Number of candles the conversion line (Tenkan-sen) is drawn over.
+	KijunPeriod   int           // Number of candles the base line (Kijun-sen) is drawn over. It is also the cloud's displacement.
+	SenkouPeriod  int           // Number of candles the second leading span (Senkou Span B) is drawn over.
+	PriceInterval time.Duration // Time interval between each candle.
+	candles       []core.OHLC
+	currentPrice  float64
+}
+
+// IchimokuCloud holds the lines of the Ichimoku Cloud at a candle.
+type IchimokuCloud struct {
+	Tenkan, Kijun float64 // The conversion and base lines.
+	// SenkouA and SenkouB are the leading spans that bound the cloud. They were computed `KijunPeriod`
+	// candles earlier and shifted forward.
+	SenkouA, SenkouB float64
+}
+
+// Top returns the upper bound of the cloud.
+func (c IchimokuCloud) Top() float64 {
+	return math.Max(c.SenkouA, c.SenkouB)
+}
+
+// Bottom returns the lower bound of the cloud.
+func (c IchimokuCloud) Bottom() float64 {
+	return math.Min(c.SenkouA, c.SenkouB)
+}
+
+// Description gives a brief summary of what the plugin does and how.
+func (plugin *Ichimoku) Description() string {
+	return `"Ichimoku draws the Ichimoku Cloud over hourly candles. It goes long when the conversion line crosses
+	above the base line while the price is above the cloud, and short when it crosses below the base line while the
+	price is below the cloud. Otherwise it waits. It needs a few days of candles and suits longer-horizon trends."`
+}
+
+// DefaultOptions returns the analysis options preferred by Ichimoku: enough hourly candles to draw the
+// cloud at the latest candle and at the one before it. They may be overridden per asset.
+func (plugin *Ichimoku) DefaultOptions() core.AnalysisOptions {
+	candles := plugin.candlesNeeded()
+	return core.AnalysisOptions{AnalysisPeriod: time.Duration(candles) * plugin.PriceInterval, Interval: plugin.PriceInterval}
+}
+
+// SetOptions configures the plugin with the bots specifications. Ichimoku only uses the candles it
+// receives, so the options are not kept.
+func (plugin *Ichimoku) SetOptions(opts *core.AnalysisOptions) error {
+	return nil
+}
+
+// SetCurrentPrice ...
+func (plugin *Ichimoku) SetCurrentPrice(price float64) error {
+	plugin.currentPrice = price
+	return nil
+}
+
+// SetClosingPrices ...
+func (plugin *Ichimoku) SetClosingPrices(prices []float64) error {
+	return nil
+}
+
+// SetOHLC ...
+func (plugin *Ichimoku) SetOHLC(candles []core.OHLC) error {
+	plugin.candles = candles
+	return nil
+}
+
+// candlesNeeded returns the number of candles needed to draw the cloud at the latest two candles.
+func (plugin *Ichimoku) candlesNeeded() int {
+	longest := plugin.SenkouPeriod
+	if plugin.KijunPeriod > longest {
+		longest = plugin.KijunPeriod
+	}
+	if plugin.TenkanPeriod > longest {
+		longest = plugin.TenkanPeriod
+	}
+	return longest + plugin.KijunPeriod + 1
+}
+
+// midpoint returns the midpoint of the highest high and the lowest low of `candles`.
+func midpoint(candles []core.OHLC) float64 {
+	high, low := candles[0].High, candles[0].Low
+	for _, candle := range candles[1:] {
+		high, low = math.Max(high, candle.High), math.Min(low, candle.Low)
+	}
+	return (high + low) / 2
+}
+
+// cloudAt draws the Ichimoku Cloud at the candle with index `ix`. The candles before it must cover
+// the longest period plus the displacement.
+func (plugin *Ichimoku) cloudAt(ix int) (cloud IchimokuCloud) {
+	lines := func(end int) (tenkan, kijun float64) {
+		return midpoint(plugin.candles[end-plugin.TenkanPeriod+1 : end+1]),
+			midpoint(plugin.candles[end-plugin.KijunPeriod+1 : end+1])
+	}
+	cloud.Tenkan, cloud.Kijun = lines(ix)
+	// The leading spans at a candle were computed `KijunPeriod` candles before it.
+	shifted := ix - plugin.KijunPeriod
+	tenkan, kijun := lines(shifted)
+	cloud.SenkouA = (tenkan + kijun) / 2
+	cloud.SenkouB = midpoint(plugin.candles[shifted-plugin.SenkouPeriod+1 : shifted+1])
+	return
+}
+
+// Cloud returns the Ichimoku Cloud at the latest candle and at the one before it.
+func (plugin *Ichimoku) Cloud() (latest, previous IchimokuCloud, err error) {
+	if plugin.TenkanPeriod <= 0 || plugin.KijunPeriod <= 0 || plugin.SenkouPeriod <= 0 {
+		return latest, previous, fmt.Errorf("invalid ichimoku periods (%d, %d, %d)", plugin.TenkanPeriod,
+			plugin.KijunPeriod, plugin.SenkouPeriod)
+	}
+	needed := plugin.candlesNeeded()
+	if len(plugin.candles) < needed {
+		return latest, previous, fmt.Errorf("%w (%d candles, the Ichimoku Cloud needs %d)", core.ErrNotEnoughPrices,
+			len(plugin.candles), needed)
+	}
+	last := len(plugin.candles) - 1
+	return plugin.cloudAt(last), plugin.cloudAt(last - 1), nil
+}
+
+// Explain returns the lines of the cloud at the latest candle and the side of the cloud the price is on.
+func (plugin *Ichimoku) Explain() (explanation core.Explanation) {
+	latest, _, err := plugin.Cloud()
+	if err != nil {
+		explanation.Notes = []string{err.Error()}
+		return
+	}
+	price := plugin.currentPrice
+	if price <= 0 {
+		price = plugin.candles[len(plugin.candles)-1].Close
+	}
+	switch {
+	case price > latest.Top():
+		explanation.Notes = append(explanation.Notes, "the price is above the cloud")
+	case price < latest.Bottom():
+		explanation.Notes = append(explanation.Notes, "the price is below the cloud")
+	default:
+		explanation.Notes = append(explanation.Notes, "the price is in the cloud")
+	}
+	explanation.Notes = append(explanation.Notes, fmt.Sprintf("conversion line %.2f, base line %.2f, cloud %.2f to %.2f",
+		latest.Tenkan, latest.Kijun, latest.Bottom(), latest.Top()))
+	return
+}
+
+// Emit emits a BUY, SELL or WAIT signal. A cross of the conversion and base lines at the latest candle
+// is only followed if the price is on the same side of the cloud.
+func (plugin *Ichimoku) Emit() (signal core.SIGNAL, err error) {
+	latest, previous, err := plugin.Cloud()
+	if err != nil {
+		return core.SignalWait, err
+	}
+	price := plugin.currentPrice
+	if price <= 0 {
+		price = plugin.candles[len(plugin.candles)-1].Close
+	}
+	crossedAbove := previous.Tenkan <= previous.Kijun && latest.Tenkan > latest.Kijun
+	crossedBelow := previous.Tenkan >= previous.Kijun && latest.Tenkan < latest.Kijun
+	switch {
+	case crossedAbove && price > latest.Top():
+		return core.SignalLong, nil
+	case crossedBelow && price < latest.Bottom():
+		return core.SignalShort, nil
+	}
+	return core.SignalWait, nil
+}
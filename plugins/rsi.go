@@ -0,0 +1,19 @@
+package plugins
+
+import "github.com/michaellormann/leprechaun/indicators"
+
+const (
+	// RSIPeriod is the number of price changes the RSI oscillator averages over.
+	RSIPeriod = 14
+	// RSIOverbought is the RSI at or above which an asset is considered overbought, i.e. at the top.
+	RSIOverbought = 70.0
+	// RSIOversold is the RSI at or below which an asset is considered oversold, i.e. at the bottom.
+	RSIOversold = 30.0
+)
+
+// RSI computes the Relative Strength Index of the closing prices, oldest first, over `period` price
+// changes. The average gains and losses are smoothed with Wilder's method, so every price contributes.
+// The result ranges from 0 to 100.
+func RSI(prices []float64, period int) (float64, error) {
+	return indicators.RSI(prices, period)
+}